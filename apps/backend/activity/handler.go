@@ -0,0 +1,177 @@
+package activity
+
+import (
+	"errors"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Handler serves the activity endpoints and publishes events. It reads
+// activity from the database and caches each user's first page.
+type Handler struct {
+	db    *gorm.DB
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler reading activity from conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{db: conn, cache: c, log: log}
+}
+
+// PingInterval is how often open activity streams are pinged so proxies
+// don't close them as idle
+var PingInterval = 30 * time.Second
+
+// userIDKey is the Locals key UpgradeHandler stores the user ID under for
+// StreamHandler
+const userIDKey = "activity_user_id"
+
+// GetMyActivity godoc
+// @Summary      My activity
+// @Description  Lists what the signed-in user did, newest first: borrowing and returning books, bookmarking, rating and searching. Pass next_cursor as cursor for the next page.
+// @Tags         activity
+// @Produce      json
+// @Security     Bearer
+// @Param        limit   query int    false "Maximum number of events" default(20) minimum(1) maximum(100)
+// @Param        cursor  query string false "next_cursor of the previous page"
+// @Success      200 {object} Page
+// @Failure      400 {object} apierrors.APIError
+// @Failure      401 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /me/activity [get]
+func (h *Handler) GetMyActivity(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	page, err := h.ListUserActivity(c.UserContext(), userID, c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return apierrors.ErrInvalidQuery.WithMessage("Invalid cursor")
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "list_user_activity", "user_id": userID})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch activity")
+	}
+	return c.JSON(page)
+}
+
+// GetActivityFeed godoc
+// @Summary      Activity of all users
+// @Description  Lists the latest events of all users with their usernames, newest first.
+// @Tags         activity
+// @Produce      json
+// @Security     Bearer
+// @Param        limit query int false "Maximum number of events" default(50) minimum(1) maximum(100)
+// @Success      200 {array} Event
+// @Failure      401 {object} apierrors.APIError
+// @Failure      403 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/activity/feed [get]
+func (h *Handler) GetActivityFeed(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	events, err := h.ListRecentActivity(c.UserContext(), limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "list_recent_activity"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch activity")
+	}
+	return c.JSON(events)
+}
+
+// UpgradeHandler rejects requests to the activity stream that aren't
+// WebSocket upgrades. It runs after JWTProtected.
+func UpgradeHandler(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	c.Locals(userIDKey, userID)
+	return c.Next()
+}
+
+// StreamHandler godoc
+// @Summary      Stream my activity
+// @Description  WebSocket sending the signed-in user's new events as JSON messages as they happen. Browsers can pass the token as access_token. Only events of actions handled by the same server instance are sent.
+// @Tags         activity
+// @Security     Bearer
+// @Param        access_token query string false "JWT, for clients that can't set the Authorization header"
+// @Success      101
+// @Failure      401 {object} apierrors.APIError
+// @Failure      426 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /ws/me/activity [get]
+func StreamHandler(c *fiber.Ctx) error {
+	return upgrade(c)
+}
+
+var upgrade = websocket.New(stream)
+
+func stream(conn *websocket.Conn) {
+	userID, _ := conn.Locals(userIDKey).(uint)
+	events, unsubscribe := Hub.Subscribe(UserTopic(userID))
+	defer unsubscribe()
+
+	// On shutdown the client gets a close frame; returning closes the
+	// connection
+	tracked := pubsub.Connections.Track(pubsub.ConnectionWebSocket, func() {
+		message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	})
+	defer tracked.Close()
+
+	// Clients don't send anything; reading notices when they go away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-tracked.Closing():
+			return
+		case event := <-events:
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package activity builds the feed of what users did: borrowing and
+// returning books, bookmarking, rating and searching. The feed is read from
+// the tables those actions write to, and new events are pushed to
+// subscribers as they happen.
+package activity
+
+import "time"
+
+// Event types
+const (
+	TypeBookBorrowed    = "book.borrowed"
+	TypeBookReturned    = "book.returned"
+	TypeBookmarkAdded   = "bookmark.added"
+	TypeBookRated       = "book.rated"
+	TypeSearchPerformed = "search.performed"
+)
+
+// Event is one action of a user. Only the fields of its type are set.
+type Event struct {
+	Type      string    `json:"type" gorm:"column:event_type" example:"book.borrowed"`
+	UserID    uint      `json:"user_id" example:"3"`
+	Username  string    `json:"username,omitempty" example:"alice"`
+	BookID    *uint     `json:"book_id,omitempty" example:"5"`
+	BookTitle *string   `json:"book_title,omitempty" example:"1984"`
+	Score     *int      `json:"score,omitempty" example:"4"`
+	Query     *string   `json:"query,omitempty" example:"orwell"`
+	Timestamp time.Time `json:"timestamp" gorm:"column:occurred_at"`
+	// SourceID is the ID of the row the event was read from; with Type and
+	// Timestamp it orders events with the same time
+	SourceID uint `json:"-"`
+}
+
+// Page is a page of the feed. NextCursor is empty on the last page.
+type Page struct {
+	Events     []Event `json:"events"`
+	NextCursor string  `json:"next_cursor,omitempty" example:"MTcxNjE5..."`
+}
@@ -0,0 +1,165 @@
+package activity
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+)
+
+// Hub receives every published event on the topic of its user
+var Hub = pubsub.NewHub()
+
+// FirstPageTTL is how long a user's first page is cached. Publishing an
+// event for the user drops it.
+const FirstPageTTL = time.Minute
+
+// ErrInvalidCursor is returned for cursors this package didn't issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// events selects every event of every user. Rows of deleted books keep their
+// title.
+const events = `SELECT 'book.borrowed' AS event_type, loans.id AS source_id, loans.user_id,
+	loans.book_id, books.title AS book_title, CAST(NULL AS bigint) AS score, CAST(NULL AS text) AS query,
+	loans.checked_out_at AS occurred_at
+FROM loans LEFT JOIN books ON books.id = loans.book_id
+UNION ALL
+SELECT 'book.returned', loans.id, loans.user_id, loans.book_id, books.title, NULL, NULL, loans.returned_at
+FROM loans LEFT JOIN books ON books.id = loans.book_id
+WHERE loans.returned_at IS NOT NULL
+UNION ALL
+SELECT 'bookmark.added', bookmarks.id, bookmarks.user_id, bookmarks.book_id, books.title, NULL, NULL, bookmarks.created_at
+FROM bookmarks LEFT JOIN books ON books.id = bookmarks.book_id
+UNION ALL
+SELECT 'book.rated', ratings.id, ratings.user_id, ratings.book_id, books.title, ratings.score, NULL, ratings.updated_at
+FROM ratings LEFT JOIN books ON books.id = ratings.book_id
+WHERE ratings.deleted_at IS NULL
+UNION ALL
+SELECT 'search.performed', search_history.id, search_history.user_id, NULL, NULL, NULL, search_history.query, search_history.searched_at
+FROM search_history`
+
+// newestOrder orders events, breaking ties the same way cursors do
+const newestOrder = " ORDER BY occurred_at DESC, event_type DESC, source_id DESC"
+
+// newestFirst is newestOrder with a limit
+const newestFirst = newestOrder + " LIMIT ?"
+
+// UserTopic is the Hub topic of a user's events
+func UserTopic(userID uint) string {
+	return fmt.Sprintf("activity:user:%d", userID)
+}
+
+func firstPageKey(userID uint, limit int) string {
+	return fmt.Sprintf("activity:user:%d:%d", userID, limit)
+}
+
+// BookEvent is an event about a book
+func BookEvent(eventType string, userID, bookID uint, title string, at time.Time) Event {
+	return Event{Type: eventType, UserID: userID, BookID: &bookID, BookTitle: &title, Timestamp: at}
+}
+
+// Publish sends e to the subscribers of its user's topic and drops the
+// user's cached first page. Call it after the action is committed. A nil
+// Handler only sends e.
+func (h *Handler) Publish(e Event) {
+	Hub.Publish(UserTopic(e.UserID), e)
+	if h == nil || h.cache == nil {
+		return
+	}
+	if keys, err := h.cache.Keys(fmt.Sprintf("activity:user:%d:*", e.UserID)); err == nil && len(keys) > 0 {
+		h.cache.Delete(keys...)
+	}
+}
+
+// ListUserActivity returns a user's events newest first, starting after
+// cursor, or from the newest if cursor is empty
+func (h *Handler) ListUserActivity(ctx context.Context, userID uint, cursor string, limit int) (*Page, error) {
+	key := firstPageKey(userID, limit)
+	if cursor == "" && h.cache != nil {
+		var cached Page
+		if err := h.cache.Get(key, &cached); err == nil {
+			return &cached, nil
+		}
+	}
+
+	query := "SELECT * FROM (" + events + ") activity WHERE user_id = ?"
+	args := []interface{}{userID}
+	if cursor != "" {
+		at, eventType, sourceID, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND (occurred_at, event_type, source_id) < (?, ?, ?)"
+		args = append(args, at, eventType, sourceID)
+	}
+
+	var page Page
+	if err := h.db.WithContext(ctx).Raw(query+newestFirst, append(args, limit)...).Scan(&page.Events).Error; err != nil {
+		return nil, err
+	}
+	if page.Events == nil {
+		page.Events = []Event{}
+	}
+	if len(page.Events) == limit {
+		page.NextCursor = encodeCursor(page.Events[limit-1])
+	}
+
+	if cursor == "" && h.cache != nil {
+		h.cache.Set(key, page, FirstPageTTL)
+	}
+	return &page, nil
+}
+
+// ListAllUserActivity returns every event of a user, newest first, for
+// exporting their data
+func (h *Handler) ListAllUserActivity(ctx context.Context, userID uint) ([]Event, error) {
+	all := []Event{}
+	query := "SELECT * FROM (" + events + ") activity WHERE user_id = ?" + newestOrder
+	if err := h.db.WithContext(ctx).Raw(query, userID).Scan(&all).Error; err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// ListRecentActivity returns the latest events of all users with their
+// usernames, newest first
+func (h *Handler) ListRecentActivity(ctx context.Context, limit int) ([]Event, error) {
+	query := "SELECT activity.*, users.username FROM (" + events + ") activity LEFT JOIN users ON users.id = activity.user_id"
+	recent := []Event{}
+	if err := h.db.WithContext(ctx).Raw(query+newestFirst, limit).Scan(&recent).Error; err != nil {
+		return nil, err
+	}
+	return recent, nil
+}
+
+// encodeCursor points after e. Timestamps are kept to the microsecond,
+// PostgreSQL's precision.
+func encodeCursor(e Event) string {
+	raw := fmt.Sprintf("%d|%s|%d", e.Timestamp.UnixMicro(), e.Type, e.SourceID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", 0, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return time.Time{}, "", 0, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", 0, ErrInvalidCursor
+	}
+	sourceID, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return time.Time{}, "", 0, ErrInvalidCursor
+	}
+	return time.UnixMicro(micros).UTC(), parts[1], uint(sourceID), nil
+}
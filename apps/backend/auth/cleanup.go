@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	cleanupScheduleKey = "users:cleanup:schedule"
+	cleanupLockKey     = "users:cleanup:lock"
+)
+
+// CleanupInactiveUsers soft-deletes non-admin users inactive for at least
+// inactiveDays. With dryRun it only reports who would be deleted.
+func (h *Handler) CleanupInactiveUsers(ctx context.Context, inactiveDays int, dryRun bool) (*CleanupResult, error) {
+	cutoff := time.Now().AddDate(0, 0, -inactiveDays)
+	result := &CleanupResult{
+		DryRun:       dryRun,
+		InactiveDays: inactiveDays,
+		Cutoff:       cutoff,
+		Users:        []InactiveUser{},
+	}
+
+	users, err := h.store.FindInactiveUsers(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		result.Users = append(result.Users, InactiveUser{
+			ID:          user.ID,
+			Username:    user.Username,
+			Email:       user.Email,
+			CreatedAt:   user.CreatedAt,
+			LastLoginAt: user.LastLoginAt,
+		})
+	}
+	result.Matched = len(users)
+
+	if dryRun || len(users) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	deleted, err := h.store.DeleteInactiveUsers(ctx, cutoff, ids)
+	if err != nil {
+		return nil, err
+	}
+	result.Deleted = deleted
+	h.InvalidateUserProfiles(ids...)
+
+	return result, nil
+}
+
+// cleanupSchedule returns the recurring cleanup configuration, or nil if
+// none has been saved
+func (h *Handler) cleanupSchedule() (*CleanupSchedule, error) {
+	if h.cache == nil {
+		return nil, nil
+	}
+	exists, err := h.cache.Exists(cleanupScheduleKey)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var schedule CleanupSchedule
+	if err := h.cache.Get(cleanupScheduleKey, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// saveCleanupSchedule stores the recurring cleanup configuration. The first
+// run is one interval from now.
+func (h *Handler) saveCleanupSchedule(schedule *CleanupSchedule) error {
+	if h.cache == nil {
+		return ErrCacheUnavailable
+	}
+
+	// Run history is server-owned; ignore whatever the client sent
+	schedule.LastRunAt = nil
+	schedule.LastDeleted = 0
+	if previous, err := h.cleanupSchedule(); err == nil && previous != nil {
+		schedule.LastRunAt = previous.LastRunAt
+		schedule.LastDeleted = previous.LastDeleted
+	}
+	next := time.Now().Add(time.Duration(schedule.IntervalHours) * time.Hour)
+	schedule.NextRunAt = &next
+
+	return h.cache.Set(cleanupScheduleKey, schedule, 0)
+}
+
+// RunScheduledCleanup runs the recurring cleanup if it is enabled and due.
+// A Redis lock keeps multiple instances from running it at the same time.
+func (h *Handler) RunScheduledCleanup(ctx context.Context) (*CleanupResult, error) {
+	schedule, err := h.cleanupSchedule()
+	if err != nil || schedule == nil || !schedule.Enabled {
+		return nil, err
+	}
+	if schedule.NextRunAt != nil && time.Now().Before(*schedule.NextRunAt) {
+		return nil, nil
+	}
+
+	acquired, err := h.cache.SetNX(cleanupLockKey, true, 10*time.Minute)
+	if err != nil || !acquired {
+		return nil, err
+	}
+	defer h.cache.Delete(cleanupLockKey)
+
+	result, err := h.CleanupInactiveUsers(ctx, schedule.InactiveDays, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := now.Add(time.Duration(schedule.IntervalHours) * time.Hour)
+	schedule.LastRunAt = &now
+	schedule.NextRunAt = &next
+	schedule.LastDeleted = result.Deleted
+	if err := h.cache.Set(cleanupScheduleKey, schedule, 0); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// StartCleanupScheduler checks every interval whether the recurring cleanup
+// is due until ctx is done
+func (h *Handler) StartCleanupScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := h.RunScheduledCleanup(ctx)
+				if h.log == nil {
+					continue
+				}
+				if err != nil {
+					h.log.LogError(err, map[string]interface{}{"operation": "scheduled_user_cleanup"})
+					continue
+				}
+				if result != nil {
+					h.log.Info("Inactive users cleaned up", map[string]interface{}{
+						"inactive_days": result.InactiveDays,
+						"deleted":       result.Deleted,
+					})
+				}
+			}
+		}
+	}()
+}
@@ -1,11 +1,56 @@
 package auth
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/export"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
 	"github.com/gofiber/fiber/v2"
 )
 
-var Log *logger.Logger
+// Handler serves the user, session and report routes from its own store,
+// cache, logger and metrics, any of which but the store may be nil
+type Handler struct {
+	store   Store
+	cache   cache.Cache
+	log     *logger.Logger
+	metrics *metrics.MetricsCollector
+
+	// Webhooks receives the events of user changes. Without it no webhooks
+	// are called.
+	Webhooks *webhook.Handler
+}
+
+// NewHandler returns a Handler reading and writing users through store
+func NewHandler(store Store, c cache.Cache, log *logger.Logger, m *metrics.MetricsCollector) *Handler {
+	return &Handler{store: store, cache: c, log: log, metrics: m}
+}
+
+// SoftDeleteUser soft-deletes a user after revoking their sessions, so
+// tokens issued before the delete stay rejected if the user is restored
+func (h *Handler) SoftDeleteUser(ctx context.Context, id uint) error {
+	sessions, err := h.store.RevokeUserSessions(ctx, id)
+	if err != nil {
+		return err
+	}
+	h.cacheRevoked(sessions)
+	if err := h.store.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	h.InvalidateUserProfiles(id)
+	return nil
+}
 
 // Register godoc
 // @Summary Register new user
@@ -14,18 +59,32 @@ var Log *logger.Logger
 // @Produce json
 // @Param user body RegisterRequest true "User registration info"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
+// @Failure 400 {object} apierrors.APIError
+// @Failure 409 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
 // @Router /auth/register [post]
-func Register(c *fiber.Ctx) error {
+func (h *Handler) Register(c *fiber.Ctx) error {
 	var req RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
 	}
 
-	if err := RegisterUser(req.Username, req.Password, req.Email); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	user, err := h.store.RegisterUser(c.UserContext(), req.Username, req.Password, req.Email)
+	if err != nil {
+		if err == ErrUserExists {
+			return apierrors.ErrUserExists
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "register"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to register user")
 	}
 
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventUserCreated, webhookUser(user))
+
 	return c.Status(201).JSON(fiber.Map{"message": "User created successfully"})
 }
 
@@ -36,22 +95,35 @@ func Register(c *fiber.Ctx) error {
 // @Produce json
 // @Param user body LoginRequest true "User login info"
 // @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
+// @Failure 400 {object} apierrors.APIError
+// @Failure 401 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
 // @Router /auth/login [post]
-func Login(c *fiber.Ctx) error {
+func (h *Handler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	user, err := h.store.AuthenticateUser(c.UserContext(), req.Username, req.Password)
+	if err != nil {
+		return apierrors.ErrInvalidCredentials
 	}
 
-	user, err := AuthenticateUser(req.Username, req.Password)
+	session, err := h.store.CreateSession(c.UserContext(), user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
 	if err != nil {
-		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "create_session", "user_id": user.ID})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to create session")
 	}
 
-	token, err := GenerateJWT(user)
+	token, err := GenerateSessionJWT(user, session)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate token"})
+		return apierrors.ErrInternal.WithMessage("Failed to generate token")
 	}
 
 	return c.JSON(fiber.Map{
@@ -64,3 +136,574 @@ func Login(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// DeleteUser godoc
+// @Summary Soft-delete a user (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} apierrors.APIError
+// @Failure 404 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /admin/users/{id} [delete]
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid user ID")
+	}
+
+	if err := h.SoftDeleteUser(c.UserContext(), uint(id)); err != nil {
+		if err == ErrUserNotFound {
+			return apierrors.ErrUserNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "delete_user",
+				"user_id":   id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to delete user")
+	}
+
+	if h.log != nil {
+		h.log.Info("User deleted", map[string]interface{}{"user_id": id})
+	}
+
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventUserDeleted, fiber.Map{"id": id})
+
+	return c.SendStatus(204)
+}
+
+// DeleteMyAccount godoc
+// @Summary Delete the current user's account
+// @Description Soft-deletes the account and its ratings and revokes its sessions. With GDPR_ANONYMIZE=true the username, email and password are erased as well.
+// @Tags auth
+// @Produce json
+// @Security Bearer
+// @Success 204
+// @Failure 401 {object} apierrors.APIError
+// @Failure 404 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /me/delete-account [post]
+func (h *Handler) DeleteMyAccount(c *fiber.Ctx) error {
+	id, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	if err := h.SoftDeleteUser(c.UserContext(), id); err != nil {
+		if err == ErrUserNotFound {
+			return apierrors.ErrUserNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "delete_account",
+				"user_id":   id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to delete account")
+	}
+
+	if h.log != nil {
+		h.log.Info("User deleted own account", map[string]interface{}{
+			"user_id":    id,
+			"anonymized": AnonymizeOnDelete,
+		})
+	}
+
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventUserDeleted, fiber.Map{"id": id})
+
+	return c.SendStatus(204)
+}
+
+// RestoreUser godoc
+// @Summary Restore a soft-deleted user (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apierrors.APIError
+// @Failure 404 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /admin/users/{id}/restore [post]
+func (h *Handler) RestoreUser(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid user ID")
+	}
+
+	user, err := h.store.RestoreUser(c.UserContext(), uint(id))
+	if err != nil {
+		if err == ErrUserNotFound {
+			return apierrors.ErrUserNotFound.WithMessage("No deleted user with that ID")
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "restore_user",
+				"user_id":   id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to restore user")
+	}
+
+	if h.cache != nil {
+		h.cache.Delete(fmt.Sprintf("user:suspended:%d", user.ID), fmt.Sprintf("login_fail:%s", user.Username))
+	}
+
+	if h.log != nil {
+		h.log.Info("User restored", map[string]interface{}{
+			"user_id":  user.ID,
+			"username": user.Username,
+		})
+	}
+
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventUserUpdated, webhookUser(user))
+
+	return c.JSON(fiber.Map{
+		"message": "User restored successfully",
+		"user": fiber.Map{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"role":     user.Role,
+		},
+	})
+}
+
+// ListDeletedUsers godoc
+// @Summary List soft-deleted users (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Page size" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {integer} X-Total-Count "Total number of items"
+// @Header 200 {integer} X-Page "Current page"
+// @Header 200 {integer} X-Limit "Page size"
+// @Header 200 {integer} X-Pages "Number of pages"
+// @Header 200 {string} Link "First, previous, next and last pages (RFC 5988)"
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/users/deleted [get]
+func (h *Handler) ListDeletedUsers(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	users, total, err := h.store.ListDeletedUsers(c.UserContext(), page, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "list_deleted_users",
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch deleted users")
+	}
+
+	result := make([]DeletedUserResponse, 0, len(users))
+	for _, user := range users {
+		result = append(result, DeletedUserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt,
+			DeletedAt: user.DeletedAt.Time,
+		})
+	}
+
+	middleware.SetPagination(c, page, limit, total)
+	return c.JSON(fiber.Map{
+		"users": result,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// ExportUsers godoc
+// @Summary Export all users (admin only)
+// @Description Streams users in batches, so large tables don't need to fit in memory. Passwords are never exported.
+// @Tags admin
+// @Produce text/csv
+// @Produce json
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security Bearer
+// @Param format query string false "Export format" Enums(csv, json, xlsx) default(csv)
+// @Success 200 {string} string "Export file"
+// @Failure 400 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /admin/users/export [get]
+func (h *Handler) ExportUsers(c *fiber.Ctx) error {
+	format := c.Query("format", export.FormatCSV)
+	contentType := export.ContentType(format)
+	if contentType == "" {
+		return apierrors.ErrInvalidQuery.WithMessage("format must be one of " + strings.Join(export.Formats(), ", "))
+	}
+
+	// The stream writer runs after the handler returns, when c is recycled
+	ctx := c.UserContext()
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := export.StreamExport(w, format, UserExport{}, func(write func(interface{}) error) error {
+			return h.store.StreamUsers(ctx, 500, func(users []User) error {
+				rows := make([]UserExport, len(users))
+				for i, user := range users {
+					rows[i] = UserExport{
+						ID:          user.ID,
+						Username:    user.Username,
+						Email:       user.Email,
+						Role:        user.Role,
+						CreatedAt:   user.CreatedAt,
+						LastLoginAt: user.LastLoginAt,
+					}
+				}
+				return write(rows)
+			})
+		})
+		if err != nil && h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "export_users",
+				"format":    format,
+			})
+		}
+	})
+
+	return nil
+}
+
+// CleanupUsers godoc
+// @Summary Soft-delete users who haven't logged in for a number of days (admin only)
+// @Description Users who never logged in count from signup. Admins are never deleted. Defaults to a dry run that only lists the users that would be deleted.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param dry_run query bool false "Only report matching users" default(true)
+// @Param request body CleanupRequest true "Inactivity threshold"
+// @Success 200 {object} CleanupResult
+// @Failure 400 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/users/cleanup [post]
+func (h *Handler) CleanupUsers(c *fiber.Ctx) error {
+	var req CleanupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	dryRun := true
+	if raw := c.Query("dry_run"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return apierrors.ErrInvalidQuery.WithMessage("dry_run must be true or false")
+		}
+		dryRun = parsed
+	}
+
+	result, err := h.CleanupInactiveUsers(c.UserContext(), req.InactiveDays, dryRun)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation":     "cleanup_users",
+				"inactive_days": req.InactiveDays,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to clean up users")
+	}
+
+	if !dryRun {
+		if h.log != nil {
+			h.log.Info("Inactive users cleaned up", map[string]interface{}{
+				"inactive_days": req.InactiveDays,
+				"deleted":       result.Deleted,
+			})
+		}
+		for _, user := range result.Users {
+			h.Webhooks.Dispatch(c.UserContext(), webhook.EventUserDeleted, fiber.Map{"id": user.ID})
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// UpgradePasswordCost godoc
+// @Summary Flag password hashes below the configured bcrypt cost (admin only)
+// @Description Records the bcrypt cost of every user's password hash and marks those below BCRYPT_COST. Marked passwords are re-hashed at the new cost on the user's next login.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} PasswordCostResult
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/users/upgrade-password-cost [post]
+func (h *Handler) UpgradePasswordCost(c *fiber.Ctx) error {
+	result, err := h.store.MarkWeakPasswordHashes(c.UserContext())
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "upgrade_password_cost",
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to check password hashes")
+	}
+
+	if h.log != nil {
+		h.log.Info("Password hashes checked", map[string]interface{}{
+			"cost":    result.Cost,
+			"scanned": result.Scanned,
+			"marked":  result.Marked,
+		})
+	}
+	return c.JSON(result)
+}
+
+// GetCleanupSchedule godoc
+// @Summary Get the recurring inactive-user cleanup (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} CleanupSchedule
+// @Failure 404 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /admin/users/cleanup/schedule [get]
+func (h *Handler) GetCleanupSchedule(c *fiber.Ctx) error {
+	schedule, err := h.cleanupSchedule()
+	if err != nil {
+		return apierrors.ErrInternal.WithMessage("Failed to read cleanup schedule")
+	}
+	if schedule == nil {
+		return apierrors.ErrCleanupScheduleNotFound
+	}
+	return c.JSON(schedule)
+}
+
+// ScheduleCleanup godoc
+// @Summary Configure the recurring inactive-user cleanup (admin only)
+// @Description Runs a real (not dry-run) cleanup every interval_hours. Set enabled to false to pause it.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param schedule body CleanupSchedule true "Schedule"
+// @Success 200 {object} CleanupSchedule
+// @Failure 400 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/users/cleanup/schedule [post]
+func (h *Handler) ScheduleCleanup(c *fiber.Ctx) error {
+	var schedule CleanupSchedule
+	if err := c.BodyParser(&schedule); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&schedule); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	if err := h.saveCleanupSchedule(&schedule); err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "schedule_user_cleanup",
+			})
+		}
+		return apierrors.ErrInternal.WithMessage("Failed to save cleanup schedule")
+	}
+
+	return c.JSON(schedule)
+}
+
+// GetActiveUsersReport godoc
+// @Summary Count recently active users (admin only)
+// @Description Users who logged in within the last 24 hours, 7 days and 30 days, and all registered users. Cached for 5 minutes.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} ActiveUsersReport
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/reports/active-users [get]
+func (h *Handler) GetActiveUsersReport(c *fiber.Ctx) error {
+	report, err := h.activeUsersReport(c.UserContext())
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "report_active_users",
+			})
+		}
+		return apierrors.ErrInternal.WithMessage("Failed to count active users")
+	}
+	return c.JSON(report)
+}
+
+// GetNewUsersReport godoc
+// @Summary Count new registrations per day (admin only)
+// @Description One entry per UTC day of the period, oldest first, today included
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param period query string false "Number of days, e.g. 7d or 30d (at most 365d)" default(7d)
+// @Success 200 {array} DailyCount
+// @Failure 400 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/reports/new-users [get]
+func (h *Handler) GetNewUsersReport(c *fiber.Ctx) error {
+	days, err := ParseReportPeriod(c.Query("period", "7d"))
+	if err != nil {
+		return apierrors.ErrInvalidQuery.WithMessage(err.Error())
+	}
+
+	series, err := h.store.NewUsersPerDay(c.UserContext(), days)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "report_new_users",
+			})
+		}
+		return apierrors.ErrInternal.WithMessage("Failed to count new users")
+	}
+	return c.JSON(series)
+}
+
+// GetMyPermissions godoc
+// @Summary List my permissions
+// @Description The permissions granted by the current user's role, which routes check with middleware.RequirePermission.
+// @Tags auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} PermissionsResponse
+// @Failure 401 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /me/permissions [get]
+func (h *Handler) GetMyPermissions(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return apierrors.ErrUnauthorized
+	}
+	return c.JSON(PermissionsResponse{Role: user.Role, Permissions: user.GetPermissions()})
+}
+
+// ListMySessions godoc
+// @Summary List my active sessions
+// @Description Sessions that are neither revoked nor expired, most recently used first. The session of the calling token is marked current.
+// @Tags auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} Session
+// @Failure 401 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /me/sessions [get]
+func (h *Handler) ListMySessions(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrUnauthorized
+	}
+	current, _ := middleware.SessionID(c)
+
+	sessions, err := h.store.ListActiveSessions(c.UserContext(), userID, current)
+	if err != nil {
+		return apierrors.ErrDatabase.WithMessage("Failed to list sessions")
+	}
+	return c.JSON(sessions)
+}
+
+// RevokeMySession godoc
+// @Summary Revoke one of my sessions
+// @Description The session's token stops working immediately. Revoking the current session logs out.
+// @Tags auth
+// @Security Bearer
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} apierrors.APIError
+// @Failure 404 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router /me/sessions/{id} [delete]
+func (h *Handler) RevokeMySession(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrUnauthorized
+	}
+
+	if err := h.RevokeSession(c.UserContext(), userID, c.Params("id")); err != nil {
+		if err == ErrSessionNotFound {
+			return apierrors.ErrSessionNotFound
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to revoke session")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeMyOtherSessions godoc
+// @Summary Revoke all my other sessions
+// @Description Logs out everywhere except the session of the calling token.
+// @Tags auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]int
+// @Failure 401 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /me/sessions [delete]
+func (h *Handler) RevokeMyOtherSessions(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrUnauthorized
+	}
+	current, _ := middleware.SessionID(c)
+
+	revoked, err := h.RevokeOtherSessions(c.UserContext(), userID, current)
+	if err != nil {
+		return apierrors.ErrDatabase.WithMessage("Failed to revoke sessions")
+	}
+	return c.JSON(fiber.Map{"revoked": revoked})
+}
+
+// ListUserSessions godoc
+// @Summary List a user's active sessions (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {array} Session
+// @Failure 400 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure 500 {object} apierrors.APIError
+// @Router /admin/users/{id}/sessions [get]
+func (h *Handler) ListUserSessions(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID
+	}
+
+	sessions, err := h.store.ListActiveSessions(c.UserContext(), uint(id), "")
+	if err != nil {
+		return apierrors.ErrDatabase.WithMessage("Failed to list sessions")
+	}
+	return c.JSON(sessions)
+}
+
+// webhookUser is the user payload sent to webhooks, without the password hash
+func webhookUser(user *User) fiber.Map {
+	return fiber.Map{
+		"id":       user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	}
+}
@@ -1,20 +1,74 @@
 package auth
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Username  string         `json:"username" gorm:"uniqueIndex;not null" validate:"required"`
-	Password  string         `json:"password" gorm:"not null" validate:"required"`
-	Email     string         `json:"email" gorm:"uniqueIndex"`
-	Role      string         `json:"role" gorm:"default:user"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID       uint   `json:"id" xml:"id" gorm:"primaryKey"`
+	Username string `json:"username" xml:"username" gorm:"uniqueIndex;not null" validate:"required"`
+	Password string `json:"password" xml:"password" gorm:"not null" validate:"required"`
+	Email    string `json:"email" xml:"email" gorm:"uniqueIndex"`
+	Role     string `json:"role" xml:"role" gorm:"default:user" validate:"omitempty,role"`
+	// PasswordCost is the bcrypt cost of Password, 0 until it is first recorded
+	PasswordCost int `json:"-" xml:"-" gorm:"default:0"`
+	// NeedsRehash flags a hash below BcryptCost to be upgraded on next login
+	NeedsRehash bool `json:"-" xml:"-" gorm:"default:false"`
+	// LastLoginAt is nil for users who have never logged in
+	LastLoginAt *time.Time     `json:"last_login_at" xml:"last_login_at" gorm:"index"`
+	CreatedAt   time.Time      `json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" xml:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" xml:"-" gorm:"index"`
+}
+
+// AnonymizeOnDelete also erases the personal data of deleted users: their
+// username, email and password. Set from GDPR_ANONYMIZE.
+var AnonymizeOnDelete bool
+
+// BeforeDelete runs in the delete's transaction. It soft-deletes the user's
+// ratings so aggregates leave them out, and RestoreUser brings them back.
+// With AnonymizeOnDelete it also renames the user to deleted_user_<id> and
+// clears their email and password. Bulk deletes without a primary key, like
+// the inactive-user cleanup, only soft-delete the user.
+func (u *User) BeforeDelete(tx *gorm.DB) error {
+	if u.ID == 0 {
+		return nil
+	}
+
+	session := tx.Session(&gorm.Session{NewDB: true})
+	err := session.Exec("UPDATE ratings SET deleted_at = ? WHERE user_id = ? AND deleted_at IS NULL", tx.NowFunc(), u.ID).Error
+	if err != nil || !AnonymizeOnDelete {
+		return err
+	}
+	return session.Model(&User{}).Where("id = ?", u.ID).Updates(map[string]interface{}{
+		"username": fmt.Sprintf("deleted_user_%d", u.ID),
+		"email":    gorm.Expr("NULL"),
+		"password": "",
+	}).Error
+}
+
+// PermissionsResponse is the body of GET /me/permissions
+type PermissionsResponse struct {
+	Role        string   `json:"role" example:"user"`
+	Permissions []string `json:"permissions" example:"books:read,books:borrow,books:rate"`
+}
+
+// Session is a login. Its ID is the jti of the access token issued for it,
+// so revoking the session invalidates the token.
+type Session struct {
+	ID         string    `json:"id" gorm:"primaryKey;size:36"`
+	UserID     uint      `json:"-" gorm:"not null;index"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"not null;index"`
+	Revoked    bool      `json:"-" gorm:"not null;default:false"`
+	// Current marks the session of the token making the request
+	Current bool `json:"current" gorm:"-"`
 }
 
 type LoginRequest struct {
@@ -25,5 +79,71 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required,min=6"`
-	Email    string `json:"email" validate:"email"`
+	Email    string `json:"email" validate:"omitempty,email"`
+}
+
+type DeletedUserResponse struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// UserExport is a row of the admin user export, without the password hash
+type UserExport struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// InactiveUser is a user selected by an inactive-user cleanup
+type InactiveUser struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+type CleanupRequest struct {
+	InactiveDays int `json:"inactive_days" validate:"required,min=1"`
+}
+
+// CleanupResult summarizes an inactive-user cleanup
+type CleanupResult struct {
+	DryRun       bool           `json:"dry_run"`
+	InactiveDays int            `json:"inactive_days"`
+	Cutoff       time.Time      `json:"cutoff"`
+	Matched      int            `json:"matched"`
+	Deleted      int64          `json:"deleted"`
+	Users        []InactiveUser `json:"users"`
+}
+
+// CleanupSchedule configures the recurring inactive-user cleanup
+type CleanupSchedule struct {
+	Enabled       bool       `json:"enabled"`
+	InactiveDays  int        `json:"inactive_days" validate:"required,min=1"`
+	IntervalHours int        `json:"interval_hours" validate:"required,min=1"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+	LastDeleted   int64      `json:"last_deleted"`
+}
+
+// ActiveUsersReport counts users who logged in recently
+type ActiveUsersReport struct {
+	Last24h         int64 `json:"last_24h" gorm:"column:last_24h" example:"42"`
+	Last7d          int64 `json:"last_7d" gorm:"column:last_7d" example:"210"`
+	Last30d         int64 `json:"last_30d" gorm:"column:last_30d" example:"450"`
+	TotalRegistered int64 `json:"total_registered" gorm:"column:total_registered" example:"1200"`
+}
+
+// DailyCount is one day of a time series report
+type DailyCount struct {
+	Date  string `json:"date" example:"2024-01-15"`
+	Count int64  `json:"count" example:"23"`
 }
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptCost is the cost new password hashes are generated with. Set from
+// BCRYPT_COST; hashes below it are upgraded on the user's next login.
+var BcryptCost = bcrypt.DefaultCost
+
+// ParseBcryptCost parses a BCRYPT_COST value, rejecting costs bcrypt can't use
+func ParseBcryptCost(raw string) (int, error) {
+	cost, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("BCRYPT_COST must be a number: %w", err)
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return 0, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return cost, nil
+}
+
+// HashPassword hashes password at BcryptCost
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// PasswordNeedsRehash reports whether hash was generated below BcryptCost.
+// Hashes bcrypt can't parse, such as the empty password of an anonymized
+// user, are left alone.
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < BcryptCost
+}
+
+// PasswordCostResult summarizes a password cost upgrade run
+type PasswordCostResult struct {
+	Cost    int   `json:"cost"`
+	Scanned int   `json:"scanned"`
+	Marked  int64 `json:"marked"`
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// userProfileTTL is how long a user looked up for a request is cached, and
+// so how long a role change can take to apply
+const userProfileTTL = 5 * time.Minute
+
+func userProfileKey(id uint) string {
+	return fmt.Sprintf("user:profile:%d", id)
+}
+
+// GetUserProfile returns the user with id, cached for userProfileTTL. The
+// password hash is left out so it never reaches the cache.
+func (h *Handler) GetUserProfile(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if h.cache != nil && h.cache.Get(userProfileKey(id), &user) == nil {
+		return &user, nil
+	}
+
+	found, err := h.store.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	found.Password = ""
+	if h.cache != nil {
+		h.cache.Set(userProfileKey(id), found, userProfileTTL)
+	}
+	return found, nil
+}
+
+// InvalidateUserProfiles drops cached profiles after the users changed
+func (h *Handler) InvalidateUserProfiles(ids ...uint) {
+	if h.cache == nil || len(ids) == 0 {
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userProfileKey(id)
+	}
+	h.cache.Delete(keys...)
+}
+
+// LoadCurrentUser loads the user for middleware.InjectUser
+func (h *Handler) LoadCurrentUser(ctx context.Context, id uint) (middleware.User, error) {
+	user, err := h.GetUserProfile(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, middleware.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CurrentUser returns the user middleware.InjectUser stored for the request
+func CurrentUser(c *fiber.Ctx) (*User, bool) {
+	user, ok := c.Locals(middleware.CurrentUserKey).(*User)
+	return user, ok
+}
+
+func (u *User) GetUsername() string {
+	return u.Username
+}
+
+func (u *User) GetRole() string {
+	return u.Role
+}
+
+// GetPermissions returns the permissions of the user's current role
+func (u *User) GetPermissions() []string {
+	return PermissionsFor(u.Role)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	activeUsersReportKey = "reports:active_users"
+	activeUsersReportTTL = 5 * time.Minute
+)
+
+// MaxReportDays is the longest period a time series report covers
+const MaxReportDays = 365
+
+// activeUsersReport returns Store.CountActiveUsers, cached for five minutes
+func (h *Handler) activeUsersReport(ctx context.Context) (*ActiveUsersReport, error) {
+	var report ActiveUsersReport
+	if h.cache != nil && h.cache.Get(activeUsersReportKey, &report) == nil {
+		return &report, nil
+	}
+	return h.refreshActiveUsersReport(ctx)
+}
+
+// refreshActiveUsersReport counts active users, caches the report and
+// publishes it as Prometheus gauges
+func (h *Handler) refreshActiveUsersReport(ctx context.Context) (*ActiveUsersReport, error) {
+	report, err := h.store.CountActiveUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if h.cache != nil {
+		h.cache.Set(activeUsersReportKey, report, activeUsersReportTTL)
+	}
+	h.metrics.SetActiveUsers(report.Last24h, report.Last7d, report.Last30d)
+	return report, nil
+}
+
+// StartActiveUsersReporter refreshes the active user gauges now and then
+// every interval until ctx is done
+func (h *Handler) StartActiveUsersReporter(ctx context.Context, interval time.Duration) {
+	report := func() {
+		if _, err := h.refreshActiveUsersReport(ctx); err != nil && h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "report_active_users",
+			})
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		report()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+}
+
+// ParseReportPeriod parses a period of days such as "7d" or "30d"
+func ParseReportPeriod(raw string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+	if err != nil || !strings.HasSuffix(raw, "d") || days < 1 || days > MaxReportDays {
+		return 0, fmt.Errorf("period must be a number of days from 1d to %dd, got %q", MaxReportDays, raw)
+	}
+	return days, nil
+}
+
+// fillDays returns one entry per day from from, taking counts from rows
+func fillDays(rows []DailyCount, from time.Time, days int) []DailyCount {
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Date] = row.Count
+	}
+
+	series := make([]DailyCount, days)
+	for i := range series {
+		date := from.AddDate(0, 0, i).Format("2006-01-02")
+		series[i] = DailyCount{Date: date, Count: counts[date]}
+	}
+	return series
+}
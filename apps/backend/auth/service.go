@@ -2,78 +2,71 @@ package auth
 
 import (
 	"errors"
-	"os"
 	"time"
 
-	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func RegisterUser(username, password, email string) error {
-	var existingUser User
-	if err := db.DB.Where("username = ? OR email = ?", username, email).First(&existingUser).Error; err == nil {
-		return ErrUserExists
-	}
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return err
-	}
-
-	user := User{
-		Username: username,
-		Password: string(hashedPassword),
-		Email:    email,
-		Role:     "user",
-	}
-
-	if err := db.DB.Create(&user).Error; err != nil {
-		return err
-	}
+// Permissions granted by roles, named resource:action
+const (
+	PermBooksRead    = "books:read"
+	PermBooksBorrow  = "books:borrow"
+	PermBooksRate    = "books:rate"
+	PermBooksCreate  = "books:create"
+	PermBooksUpdate  = "books:update"
+	PermBooksDelete  = "books:delete"
+	PermUsersRead    = "users:read"
+	PermUsersDelete  = "users:delete"
+	PermAdminMetrics = "admin:metrics"
+)
 
-	return nil
+// RolePermissions lists what each role may do. Tokens carry the permissions
+// of their user's role when they are issued.
+var RolePermissions = map[string][]string{
+	"user": {PermBooksRead, PermBooksBorrow, PermBooksRate},
+	"admin": {
+		PermBooksRead, PermBooksBorrow, PermBooksRate,
+		PermBooksCreate, PermBooksUpdate, PermBooksDelete,
+		PermUsersRead, PermUsersDelete,
+		PermAdminMetrics,
+	},
 }
 
-func AuthenticateUser(username, password string) (*User, error) {
-	var user User
-	if err := db.DB.Where("username = ?", username).First(&user).Error; err != nil {
-		return nil, ErrInvalidCredentials
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, ErrInvalidCredentials
-	}
-
-	return &user, nil
+// PermissionsFor returns the permissions of role, none for unknown roles
+func PermissionsFor(role string) []string {
+	return append([]string{}, RolePermissions[role]...)
 }
 
-func GenerateJWT(user *User) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "supersecret"
-	}
+// TokenTTL is how long access tokens, and the sessions they belong to, last
+const TokenTTL = 24 * time.Hour
 
-	claims := jwt.MapClaims{
-		"sub":      user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	}
+func GenerateJWT(user *User) (string, error) {
+	return signJWT(user, jwt.MapClaims{"exp": time.Now().Add(TokenTTL).Unix()})
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// GenerateSessionJWT issues the access token of session, which stops working
+// once the session is revoked
+func GenerateSessionJWT(user *User, session *Session) (string, error) {
+	return signJWT(user, jwt.MapClaims{
+		"jti": session.ID,
+		"exp": session.ExpiresAt.Unix(),
+	})
 }
 
-func GetUserByID(id uint) (*User, error) {
-	var user User
-	if err := db.DB.First(&user, id).Error; err != nil {
-		return nil, err
-	}
-	return &user, nil
+func signJWT(user *User, claims jwt.MapClaims) (string, error) {
+	claims["sub"] = user.ID
+	claims["username"] = user.Username
+	claims["role"] = user.Role
+	claims["permissions"] = PermissionsFor(user.Role)
+
+	return tokens.Current().Sign(claims)
 }
 
 var (
 	ErrUserExists         = errors.New("user already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrCacheUnavailable   = errors.New("cache unavailable")
+	ErrSessionNotFound    = errors.New("session not found")
 )
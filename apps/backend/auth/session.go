@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// sessionTouchInterval limits last_used_at updates to one per session per
+// interval, so authenticated requests don't each write to the database
+const sessionTouchInterval = time.Minute
+
+// sessionStatusTTL is how long a session's status read from the database
+// is cached. Revocations overwrite it right away; the TTL only bounds how
+// long the database goes unchecked.
+const sessionStatusTTL = 30 * time.Second
+
+// Cached session statuses
+const (
+	sessionActive  = "active"
+	sessionRevoked = "revoked"
+)
+
+func sessionStatusKey(id string) string {
+	return "auth:session:status:" + id
+}
+
+func sessionTouchKey(id string) string {
+	return "auth:session:touched:" + id
+}
+
+// RevokeSession revokes one of the user's active sessions
+func (h *Handler) RevokeSession(ctx context.Context, userID uint, id string) error {
+	session, err := h.store.RevokeSession(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	h.cacheRevoked([]Session{*session})
+	return nil
+}
+
+// RevokeOtherSessions revokes all of the user's sessions except keepID and
+// returns how many were revoked
+func (h *Handler) RevokeOtherSessions(ctx context.Context, userID uint, keepID string) (int, error) {
+	sessions, err := h.store.RevokeOtherSessions(ctx, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	h.cacheRevoked(sessions)
+	return len(sessions), nil
+}
+
+// cacheRevoked overwrites the cached status of sessions just revoked, so
+// token checks stop accepting them right away
+func (h *Handler) cacheRevoked(sessions []Session) {
+	if h.cache == nil {
+		return
+	}
+	for _, session := range sessions {
+		if ttl := time.Until(session.ExpiresAt); ttl > 0 {
+			h.cache.Set(sessionStatusKey(session.ID), sessionRevoked, ttl)
+		} else {
+			h.cache.Delete(sessionStatusKey(session.ID))
+		}
+	}
+}
+
+// IsSessionRevoked reports whether the session with id was revoked, and
+// records it as used. The sessions table decides; its answer is cached for
+// sessionStatusTTL, so an evicted or lost cache entry only costs a query.
+// Unknown sessions, such as ones whose row was deleted, count as revoked,
+// and so does every session while the database can't be read.
+func (h *Handler) IsSessionRevoked(id string) bool {
+	if h.cache != nil {
+		var status string
+		if err := h.cache.Get(sessionStatusKey(id), &status); err == nil {
+			if status == sessionActive {
+				h.touchSession(id)
+			}
+			return status != sessionActive
+		}
+	}
+
+	revoked, err := h.store.SessionRevoked(context.Background(), id)
+	if err != nil {
+		return true
+	}
+
+	if h.cache != nil {
+		if revoked {
+			h.cache.Set(sessionStatusKey(id), sessionRevoked, sessionStatusTTL)
+		} else {
+			// SetNX so a revocation cached since the query above wins
+			h.cache.SetNX(sessionStatusKey(id), sessionActive, sessionStatusTTL)
+		}
+	}
+	if !revoked {
+		h.touchSession(id)
+	}
+	return revoked
+}
+
+// touchSession updates last_used_at at most once per sessionTouchInterval
+func (h *Handler) touchSession(id string) {
+	if h.cache != nil {
+		first, err := h.cache.SetNX(sessionTouchKey(id), true, sessionTouchInterval)
+		if err != nil || !first {
+			return
+		}
+	}
+	h.store.TouchSession(context.Background(), id)
+}
@@ -0,0 +1,406 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Store is the storage Handler reads and writes users and sessions through,
+// so tests can stand in for the database. It doesn't cache; the handler
+// does.
+type Store interface {
+	// Users
+	RegisterUser(ctx context.Context, username, password, email string) (*User, error)
+	AuthenticateUser(ctx context.Context, username, password string) (*User, error)
+	GetUserByID(ctx context.Context, id uint) (*User, error)
+	DeleteUser(ctx context.Context, id uint) error
+	RestoreUser(ctx context.Context, id uint) (*User, error)
+	ListDeletedUsers(ctx context.Context, page, limit int) ([]User, int64, error)
+	StreamUsers(ctx context.Context, batchSize int, fn func([]User) error) error
+	MarkWeakPasswordHashes(ctx context.Context) (*PasswordCostResult, error)
+
+	// Sessions. The Revoke methods return the sessions they revoked.
+	CreateSession(ctx context.Context, userID uint, userAgent, ip string) (*Session, error)
+	ListActiveSessions(ctx context.Context, userID uint, currentID string) ([]Session, error)
+	RevokeSession(ctx context.Context, userID uint, id string) (*Session, error)
+	RevokeOtherSessions(ctx context.Context, userID uint, keepID string) ([]Session, error)
+	RevokeUserSessions(ctx context.Context, userID uint) ([]Session, error)
+	// SessionRevoked reports whether the session with id was revoked.
+	// Unknown sessions count as revoked.
+	SessionRevoked(ctx context.Context, id string) (bool, error)
+	TouchSession(ctx context.Context, id string) error
+
+	// Cleanup and reports
+	FindInactiveUsers(ctx context.Context, cutoff time.Time) ([]User, error)
+	// DeleteInactiveUsers deletes those of ids still inactive since cutoff
+	DeleteInactiveUsers(ctx context.Context, cutoff time.Time, ids []uint) (int64, error)
+	CountActiveUsers(ctx context.Context) (*ActiveUsersReport, error)
+	NewUsersPerDay(ctx context.Context, days int) ([]DailyCount, error)
+}
+
+type dbStore struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+// NewDBStore returns the Store backed by conn. Failures that don't fail the
+// call, such as re-hashing a password on login, are logged to log, which may
+// be nil.
+func NewDBStore(conn *gorm.DB, log *logger.Logger) Store {
+	return dbStore{db: conn, log: log}
+}
+
+func (s dbStore) conn(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx)
+}
+
+func (s dbStore) RegisterUser(ctx context.Context, username, password, email string) (*User, error) {
+	var existingUser User
+	if err := s.conn(ctx).Where("username = ? OR email = ?", username, email).First(&existingUser).Error; err == nil {
+		return nil, ErrUserExists
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := User{
+		Username:     username,
+		Password:     hashedPassword,
+		PasswordCost: BcryptCost,
+		Email:        email,
+		Role:         "user",
+	}
+
+	if err := s.conn(ctx).Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s dbStore) AuthenticateUser(ctx context.Context, username, password string) (*User, error) {
+	var user User
+	if err := s.conn(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.NeedsRehash || PasswordNeedsRehash(user.Password) {
+		s.rehashPassword(ctx, &user, password)
+	}
+
+	// UpdateColumn so a login doesn't count as a profile change in updated_at
+	now := time.Now()
+	if err := s.conn(ctx).Model(&user).UpdateColumn("last_login_at", now).Error; err == nil {
+		user.LastLoginAt = &now
+	}
+
+	return &user, nil
+}
+
+func (s dbStore) GetUserByID(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if err := s.conn(ctx).First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser soft-deletes a user. The primary key is set on the model so the
+// BeforeDelete hook knows whose data to erase.
+func (s dbStore) DeleteUser(ctx context.Context, id uint) error {
+	result := s.conn(ctx).Delete(&User{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RestoreUser clears deleted_at on a soft-deleted user and their ratings
+func (s dbStore) RestoreUser(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if err := s.conn(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	err := s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&User{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		// Ratings are only soft-deleted along with their user
+		return tx.Exec("UPDATE ratings SET deleted_at = NULL WHERE user_id = ? AND deleted_at IS NOT NULL", id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	return &user, nil
+}
+
+func (s dbStore) ListDeletedUsers(ctx context.Context, page, limit int) ([]User, int64, error) {
+	var users []User
+	var total int64
+
+	query := s.conn(ctx).Unscoped().Model(&User{}).Where("deleted_at IS NOT NULL")
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("deleted_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// StreamUsers calls fn with every user, ordered by ID, batchSize at a time
+// so the whole table is never held in memory
+func (s dbStore) StreamUsers(ctx context.Context, batchSize int, fn func([]User) error) error {
+	var batch []User
+	return s.conn(ctx).Order("id").FindInBatches(&batch, batchSize, func(tx *gorm.DB, n int) error {
+		return fn(batch)
+	}).Error
+}
+
+// CreateSession records a login from the given user agent and IP
+func (s dbStore) CreateSession(ctx context.Context, userID uint, userAgent, ip string) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(TokenTTL),
+	}
+	if err := s.conn(ctx).Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListActiveSessions returns the user's sessions that are neither revoked nor
+// expired, most recently used first. The session currentID is marked.
+func (s dbStore) ListActiveSessions(ctx context.Context, userID uint, currentID string) ([]Session, error) {
+	sessions := []Session{}
+	err := s.conn(ctx).
+		Where("user_id = ? AND revoked = ? AND expires_at > ?", userID, false, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one of the user's active sessions
+func (s dbStore) RevokeSession(ctx context.Context, userID uint, id string) (*Session, error) {
+	var session Session
+	err := s.conn(ctx).
+		Where("id = ? AND user_id = ? AND revoked = ?", id, userID, false).
+		First(&session).Error
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	if err := s.revokeSessions(ctx, []Session{session}); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeOtherSessions revokes all of the user's sessions except keepID
+func (s dbStore) RevokeOtherSessions(ctx context.Context, userID uint, keepID string) ([]Session, error) {
+	var sessions []Session
+	err := s.conn(ctx).
+		Where("user_id = ? AND revoked = ? AND expires_at > ? AND id <> ?", userID, false, time.Now(), keepID).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.revokeSessions(ctx, sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeUserSessions revokes every session of the user that is still valid
+func (s dbStore) RevokeUserSessions(ctx context.Context, userID uint) ([]Session, error) {
+	var sessions []Session
+	err := s.conn(ctx).
+		Where("user_id = ? AND revoked = ? AND expires_at > ?", userID, false, time.Now()).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.revokeSessions(ctx, sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// revokeSessions marks sessions revoked
+func (s dbStore) revokeSessions(ctx context.Context, sessions []Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	return s.conn(ctx).Model(&Session{}).Where("id IN ?", ids).Update("revoked", true).Error
+}
+
+func (s dbStore) SessionRevoked(ctx context.Context, id string) (bool, error) {
+	var session Session
+	err := s.conn(ctx).Select("revoked").Where("id = ?", id).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.Revoked, nil
+}
+
+func (s dbStore) TouchSession(ctx context.Context, id string) error {
+	return s.conn(ctx).Model(&Session{}).Where("id = ?", id).UpdateColumn("last_used_at", time.Now()).Error
+}
+
+// inactiveUsers selects non-admin users whose last login, or signup if they
+// never logged in, is before cutoff. Admins are never cleaned up so a
+// cleanup can't lock everyone out.
+func (s dbStore) inactiveUsers(ctx context.Context, cutoff time.Time) *gorm.DB {
+	return s.conn(ctx).Model(&User{}).
+		Where("role <> ?", "admin").
+		Where("COALESCE(last_login_at, created_at) < ?", cutoff)
+}
+
+func (s dbStore) FindInactiveUsers(ctx context.Context, cutoff time.Time) ([]User, error) {
+	var users []User
+	if err := s.inactiveUsers(ctx, cutoff).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// DeleteInactiveUsers re-checks inactivity so a user who logged in since
+// FindInactiveUsers is kept
+func (s dbStore) DeleteInactiveUsers(ctx context.Context, cutoff time.Time, ids []uint) (int64, error) {
+	deleted := s.inactiveUsers(ctx, cutoff).Where("id IN ?", ids).Delete(&User{})
+	return deleted.RowsAffected, deleted.Error
+}
+
+// CountActiveUsers counts the users who logged in within the last day, week
+// and 30 days, and all registered users, in one query
+func (s dbStore) CountActiveUsers(ctx context.Context) (*ActiveUsersReport, error) {
+	var report ActiveUsersReport
+	err := s.conn(ctx).Model(&User{}).Select(`
+		COUNT(*) FILTER (WHERE last_login_at > NOW() - INTERVAL '1 day') AS last_24h,
+		COUNT(*) FILTER (WHERE last_login_at > NOW() - INTERVAL '7 days') AS last_7d,
+		COUNT(*) FILTER (WHERE last_login_at > NOW() - INTERVAL '30 days') AS last_30d,
+		COUNT(*) AS total_registered`).
+		Scan(&report).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// NewUsersPerDay counts registrations per UTC day over the last days days,
+// today included. Days without registrations are reported as 0.
+func (s dbStore) NewUsersPerDay(ctx context.Context, days int) ([]DailyCount, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -(days - 1))
+
+	var rows []DailyCount
+	err := s.conn(ctx).Model(&User{}).
+		Select("TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS date, COUNT(*) AS count").
+		Where("created_at >= ?", from).
+		Group("1").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return fillDays(rows, from, days), nil
+}
+
+// MarkWeakPasswordHashes records the bcrypt cost of every user's hash and
+// flags those below BcryptCost with needs_rehash. The password itself can only
+// be re-hashed once the user logs in again, which AuthenticateUser does.
+func (s dbStore) MarkWeakPasswordHashes(ctx context.Context) (*PasswordCostResult, error) {
+	result := &PasswordCostResult{Cost: BcryptCost}
+
+	err := s.StreamUsers(ctx, 500, func(users []User) error {
+		for _, user := range users {
+			result.Scanned++
+			cost, err := bcrypt.Cost([]byte(user.Password))
+			if err != nil {
+				continue
+			}
+			updates := map[string]interface{}{"password_cost": cost}
+			if cost < BcryptCost {
+				updates["needs_rehash"] = true
+				result.Marked++
+			}
+			if err := s.conn(ctx).Model(&User{}).Where("id = ?", user.ID).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// rehashPassword stores password at BcryptCost after a successful login.
+// Failures are logged and don't fail the login; the hash is retried next time.
+func (s dbStore) rehashPassword(ctx context.Context, user *User, password string) {
+	hash, err := HashPassword(password)
+	if err == nil {
+		err = s.conn(ctx).Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"password":      hash,
+			"password_cost": BcryptCost,
+			"needs_rehash":  false,
+		}).Error
+	}
+	if err != nil {
+		if s.log != nil {
+			s.log.LogError(err, map[string]interface{}{
+				"operation": "rehash_password",
+				"user_id":   user.ID,
+			})
+		}
+		return
+	}
+
+	user.Password = hash
+	user.PasswordCost = BcryptCost
+	user.NeedsRehash = false
+}
@@ -0,0 +1,262 @@
+package author
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Handler serves the author endpoints from the database, caching profiles
+// and book lists
+type Handler struct {
+	db    *gorm.DB
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler reading and writing authors in conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{db: conn, cache: c, log: log}
+}
+
+// CacheKey is the key an author profile is cached under
+func CacheKey(id uint) string {
+	return fmt.Sprintf("author:%d", id)
+}
+
+// BooksCacheKey is the key an author's book list is cached under
+func BooksCacheKey(id uint) string {
+	return fmt.Sprintf("author:%d:books", id)
+}
+
+// GetAuthors godoc
+// @Summary      List authors
+// @Tags         authors
+// @Produce      json
+// @Param        search query string false "Filter by name"
+// @Param        page   query int    false "Page number" default(1)
+// @Param        limit  query int    false "Page size" default(20)
+// @Success      200 {object} map[string]interface{}
+// @Header       200 {integer} X-Total-Count "Total number of items"
+// @Header       200 {integer} X-Page "Current page"
+// @Header       200 {integer} X-Limit "Page size"
+// @Header       200 {integer} X-Pages "Number of pages"
+// @Header       200 {string} Link "First, previous, next and last pages (RFC 5988)"
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /authors [get]
+func (h *Handler) GetAuthors(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	authors, total, err := h.ListAuthors(c.UserContext(), c.Query("search"), page, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "list_authors",
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch authors")
+	}
+
+	middleware.SetPagination(c, page, limit, total)
+	return c.JSON(fiber.Map{
+		"authors": authors,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GetAuthor godoc
+// @Summary      Get an author by ID
+// @Tags         authors
+// @Produce      json
+// @Param        id   path  int  true  "Author ID"
+// @Success      200  {object} Author
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /authors/{id} [get]
+func (h *Handler) GetAuthor(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid author ID")
+	}
+
+	cacheKey := CacheKey(uint(id))
+	var author Author
+	if h.cache != nil {
+		if err := h.cache.Get(cacheKey, &author); err == nil {
+			metrics.RecordCacheOperation("get", "hit")
+			return c.JSON(author)
+		}
+		metrics.RecordCacheOperation("get", "miss")
+	}
+
+	authorPtr, err := h.getAuthor(c.UserContext(), uint(id))
+	if err != nil {
+		return apierrors.ErrAuthorNotFound
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, authorPtr, 10*time.Minute)
+		metrics.RecordCacheOperation("set", "success")
+	}
+
+	return c.JSON(authorPtr)
+}
+
+// GetAuthorBooks godoc
+// @Summary      List an author's books
+// @Tags         authors
+// @Produce      json
+// @Param        id   path  int  true  "Author ID"
+// @Success      200  {array} book.Book
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /authors/{id}/books [get]
+func (h *Handler) GetAuthorBooks(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid author ID")
+	}
+
+	cacheKey := BooksCacheKey(uint(id))
+	var books []book.Book
+	if h.cache != nil {
+		if err := h.cache.Get(cacheKey, &books); err == nil {
+			metrics.RecordCacheOperation("get", "hit")
+			return c.JSON(books)
+		}
+		metrics.RecordCacheOperation("get", "miss")
+	}
+
+	if _, err := h.getAuthor(c.UserContext(), uint(id)); err != nil {
+		return apierrors.ErrAuthorNotFound
+	}
+
+	books, err = h.authorBooks(c.UserContext(), uint(id))
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "get_author_books",
+				"author_id": id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, books, 10*time.Minute)
+		metrics.RecordCacheOperation("set", "success")
+	}
+
+	return c.JSON(books)
+}
+
+// CreateAuthor godoc
+// @Summary      Create an author (admin only)
+// @Tags         authors
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        author  body  Author  true  "Author to create"
+// @Success      201  {object} Author
+// @Failure      400  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /authors [post]
+func (h *Handler) CreateAuthor(c *fiber.Ctx) error {
+	var author Author
+	if err := c.BodyParser(&author); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if author.Name == "" {
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "name", Message: "is required"})
+	}
+
+	author.ID = 0
+	if err := h.createAuthor(c.UserContext(), &author); err != nil {
+		if err == ErrAuthorExists {
+			return apierrors.ErrAuthorExists
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "create_author",
+				"name":      author.Name,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to create author")
+	}
+
+	return c.Status(201).JSON(author)
+}
+
+// UpdateAuthor godoc
+// @Summary      Update an author (admin only)
+// @Tags         authors
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id      path  int     true  "Author ID"
+// @Param        author  body  Author  true  "Updated author"
+// @Success      200  {object} Author
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /authors/{id} [put]
+func (h *Handler) UpdateAuthor(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid author ID")
+	}
+
+	var updated Author
+	if err := c.BodyParser(&updated); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	updated.ID = 0
+
+	author, err := h.updateAuthor(c.UserContext(), uint(id), &updated)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrAuthorNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "update_author",
+				"author_id": id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to update author")
+	}
+
+	if h.cache != nil {
+		h.cache.Delete(CacheKey(uint(id)), BooksCacheKey(uint(id)))
+		if updated.Name != "" {
+			// Renames are written through to the books' author column
+			h.cache.Delete("books:all")
+		}
+		metrics.RecordCacheOperation("delete", "success")
+	}
+
+	return c.JSON(author)
+}
@@ -0,0 +1,19 @@
+package author
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Author struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name" gorm:"uniqueIndex;not null" validate:"required"`
+	Bio       string         `json:"bio"`
+	BirthYear *int           `json:"birth_year"`
+	Country   string         `json:"country"`
+	PhotoURL  string         `json:"photo_url"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,89 @@
+package author
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+)
+
+func (h *Handler) ListAuthors(ctx context.Context, search string, page, limit int) ([]Author, int64, error) {
+	var authors []Author
+	var total int64
+
+	query := h.db.WithContext(ctx).Model(&Author{})
+	if search != "" {
+		query = query.Where("name ILIKE ?", "%"+search+"%")
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("name").Offset((page - 1) * limit).Limit(limit).Find(&authors).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return authors, total, nil
+}
+
+// SuggestAuthors returns the ID and name of up to limit authors whose name
+// starts with prefix
+func (h *Handler) SuggestAuthors(ctx context.Context, prefix string, limit int) ([]Author, error) {
+	var authors []Author
+	err := h.db.WithContext(ctx).Select("id", "name").
+		Where("name ILIKE ?", prefix+"%").
+		Order("name").Limit(limit).
+		Find(&authors).Error
+	return authors, err
+}
+
+func (h *Handler) getAuthor(ctx context.Context, id uint) (*Author, error) {
+	var author Author
+	if err := h.db.WithContext(ctx).First(&author, id).Error; err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+func (h *Handler) createAuthor(ctx context.Context, author *Author) error {
+	var count int64
+	if err := h.db.WithContext(ctx).Unscoped().Model(&Author{}).Where("name = ?", author.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAuthorExists
+	}
+
+	return h.db.WithContext(ctx).Create(author).Error
+}
+
+func (h *Handler) updateAuthor(ctx context.Context, id uint, updated *Author) (*Author, error) {
+	var author Author
+	if err := h.db.WithContext(ctx).First(&author, id).Error; err != nil {
+		return nil, err
+	}
+
+	// Update only non-zero fields
+	if err := h.db.WithContext(ctx).Model(&author).Updates(updated).Error; err != nil {
+		return nil, err
+	}
+
+	// Keep the denormalized name on books in step with the author record
+	if updated.Name != "" {
+		if err := h.db.WithContext(ctx).Model(&book.Book{}).Where("author_id = ?", id).Update("author", author.Name).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &author, nil
+}
+
+func (h *Handler) authorBooks(ctx context.Context, id uint) ([]book.Book, error) {
+	var books []book.Book
+	if err := h.db.WithContext(ctx).Where("author_id = ?", id).Order("year, title").Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+var ErrAuthorExists = errors.New("author already exists")
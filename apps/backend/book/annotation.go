@@ -0,0 +1,402 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AnnotationListTTL is how long a page of a user's annotations of a book is
+// cached. Creating, editing or deleting one of them drops the user's pages
+// of that book. Searches aren't cached.
+const AnnotationListTTL = 2 * time.Minute
+
+// AnnotationSearchSQL is the full-text search document of an annotation, its
+// passage and note. Migration 006 indexes this exact expression.
+const AnnotationSearchSQL = "to_tsvector('english', passage_text || ' ' || note)"
+
+// ErrInvalidPassage is returned for passages that don't end after they start
+var ErrInvalidPassage = errors.New("passage_end must be greater than passage_start")
+
+func annotationsKey(userID, bookID uint, page, limit int) string {
+	return fmt.Sprintf("annotations:%d:%d:%d:%d", userID, bookID, page, limit)
+}
+
+// invalidateAnnotations drops the cached pages of a user's annotations of a
+// book
+func (h *BookHandler) invalidateAnnotations(userID, bookID uint) {
+	if h.cache == nil {
+		return
+	}
+	if keys, err := h.cache.Keys(fmt.Sprintf("annotations:%d:%d:*", userID, bookID)); err == nil && len(keys) > 0 {
+		h.cache.Delete(keys...)
+	}
+}
+
+// CreateAnnotation adds a user's annotation of a book. It returns
+// gorm.ErrRecordNotFound if the book doesn't exist.
+func (s dbStore) CreateAnnotation(ctx context.Context, userID, bookID uint, req AnnotationRequest) (*Annotation, error) {
+	if req.PassageEnd <= req.PassageStart {
+		return nil, ErrInvalidPassage
+	}
+	if _, err := s.GetBookByID(ctx, bookID); err != nil {
+		return nil, err
+	}
+
+	annotation := Annotation{
+		BookID:       bookID,
+		UserID:       userID,
+		PassageStart: req.PassageStart,
+		PassageEnd:   req.PassageEnd,
+		PassageText:  req.PassageText,
+		Note:         req.Note,
+		Color:        req.Color,
+	}
+	if annotation.Color == "" {
+		annotation.Color = DefaultAnnotationColor
+	}
+	if err := s.conn(ctx).Create(&annotation).Error; err != nil {
+		return nil, err
+	}
+	return &annotation, nil
+}
+
+// getUserAnnotation returns annotation id if userID wrote it. Other users'
+// annotations are reported as gorm.ErrRecordNotFound.
+func (s dbStore) getUserAnnotation(ctx context.Context, userID, id uint) (*Annotation, error) {
+	var annotation Annotation
+	if err := s.conn(ctx).Where("id = ? AND user_id = ?", id, userID).First(&annotation).Error; err != nil {
+		return nil, err
+	}
+	return &annotation, nil
+}
+
+// UpdateAnnotation changes the fields of a user's annotation that req sets
+func (s dbStore) UpdateAnnotation(ctx context.Context, userID, id uint, req UpdateAnnotationRequest) (*Annotation, error) {
+	annotation, err := s.getUserAnnotation(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.PassageStart != nil {
+		annotation.PassageStart = *req.PassageStart
+	}
+	if req.PassageEnd != nil {
+		annotation.PassageEnd = *req.PassageEnd
+	}
+	if req.PassageText != nil {
+		annotation.PassageText = *req.PassageText
+	}
+	if req.Note != nil {
+		annotation.Note = *req.Note
+	}
+	if req.Color != nil {
+		annotation.Color = *req.Color
+	}
+	if annotation.PassageEnd <= annotation.PassageStart {
+		return nil, ErrInvalidPassage
+	}
+
+	if err := s.conn(ctx).Save(annotation).Error; err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// DeleteAnnotation deletes a user's annotation and returns it
+func (s dbStore) DeleteAnnotation(ctx context.Context, userID, id uint) (*Annotation, error) {
+	annotation, err := s.getUserAnnotation(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.conn(ctx).Delete(&Annotation{}, annotation.ID).Error; err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// ListAnnotations returns a page of a user's annotations of a book in the
+// order of their passages, or of all books newest first if bookID is 0.
+// A non-empty query only returns the annotations whose passage or note
+// match it.
+func (s dbStore) ListAnnotations(ctx context.Context, userID, bookID uint, query string, page, limit int) (*AnnotationPage, error) {
+	tx := s.conn(ctx).Model(&Annotation{}).Where("user_id = ?", userID)
+	order := "created_at DESC, id DESC"
+	if bookID != 0 {
+		tx = tx.Where("book_id = ?", bookID)
+		order = "passage_start, id"
+	}
+	if query != "" {
+		tx = tx.Where(AnnotationSearchSQL+" @@ plainto_tsquery('english', ?)", query)
+	}
+
+	result := AnnotationPage{Annotations: []Annotation{}, Page: page, Limit: limit}
+	if err := tx.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Order(order).Offset((page - 1) * limit).Limit(limit).Find(&result.Annotations).Error; err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAnnotations is the store's ListAnnotations, cached when listing a book
+// without a query
+func (h *BookHandler) ListAnnotations(ctx context.Context, userID, bookID uint, query string, page, limit int) (*AnnotationPage, error) {
+	query = strings.TrimSpace(query)
+	cached := h.cache != nil && bookID != 0 && query == ""
+	key := annotationsKey(userID, bookID, page, limit)
+	if cached {
+		var annotations AnnotationPage
+		if err := h.cache.Get(key, &annotations); err == nil {
+			return &annotations, nil
+		}
+	}
+
+	annotations, err := h.store.ListAnnotations(ctx, userID, bookID, query, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached {
+		h.cache.Set(key, annotations, AnnotationListTTL)
+	}
+	return annotations, nil
+}
+
+// annotationPaging reads page and limit, 20 annotations a page by default
+func annotationPaging(c *fiber.Ctx) (page, limit int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit = c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// invalidPassage is the validation error of ErrInvalidPassage
+func invalidPassage() error {
+	return apierrors.NewValidationError(apierrors.FieldError{Field: "passage_end", Message: "must be greater than passage_start"})
+}
+
+// CreateAnnotation godoc
+// @Summary      Annotate a book
+// @Description  Highlights a passage of the book for the signed-in user, with an optional private note. passage_start and passage_end are character offsets into the book's text. The color defaults to yellow.
+// @Tags         annotations
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id          path  int                true  "Book ID"
+// @Param        annotation  body  AnnotationRequest  true  "Passage and note"
+// @Success      201  {object} Annotation
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/annotations [post]
+func (h *BookHandler) CreateAnnotation(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	var req AnnotationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	annotation, err := h.store.CreateAnnotation(c.UserContext(), userID, uint(id), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPassage):
+			return invalidPassage()
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return apierrors.ErrBookNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "create_annotation",
+				"book_id":   id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to create annotation")
+	}
+	h.invalidateAnnotations(userID, uint(id))
+	return c.Status(fiber.StatusCreated).JSON(annotation)
+}
+
+// GetBookAnnotations godoc
+// @Summary      My annotations of a book
+// @Description  Lists the signed-in user's annotations of the book in the order of their passages. Other users' annotations are never included. q searches the passages and notes.
+// @Tags         annotations
+// @Produce      json
+// @Security     Bearer
+// @Param        id     path   int     true   "Book ID"
+// @Param        q      query  string  false  "Full-text search of passages and notes"
+// @Param        page   query  int     false  "Page number" default(1) minimum(1)
+// @Param        limit  query  int     false  "Annotations per page" default(20) minimum(1) maximum(100)
+// @Success      200  {object} AnnotationPage
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /books/{id}/annotations [get]
+func (h *BookHandler) GetBookAnnotations(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	return h.sendAnnotations(c, uint(id))
+}
+
+// GetMyAnnotations godoc
+// @Summary      Search my annotations
+// @Description  Lists the signed-in user's annotations of all books, newest first. q searches the passages and notes.
+// @Tags         annotations
+// @Produce      json
+// @Security     Bearer
+// @Param        q      query  string  false  "Full-text search of passages and notes"
+// @Param        page   query  int     false  "Page number" default(1) minimum(1)
+// @Param        limit  query  int     false  "Annotations per page" default(20) minimum(1) maximum(100)
+// @Success      200  {object} AnnotationPage
+// @Failure      401  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /me/annotations [get]
+func (h *BookHandler) GetMyAnnotations(c *fiber.Ctx) error {
+	return h.sendAnnotations(c, 0)
+}
+
+func (h *BookHandler) sendAnnotations(c *fiber.Ctx, bookID uint) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	page, limit := annotationPaging(c)
+
+	annotations, err := h.ListAnnotations(c.UserContext(), userID, bookID, c.Query("q"), page, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "list_annotations",
+				"book_id":   bookID,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch annotations")
+	}
+
+	middleware.SetPagination(c, page, limit, annotations.Total)
+	return c.JSON(annotations)
+}
+
+// UpdateAnnotation godoc
+// @Summary      Edit my annotation
+// @Description  Changes the fields of the annotation that the body sets. Only the annotation's author can edit it; other users' annotations are reported as not found.
+// @Tags         annotations
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id          path  int                      true  "Annotation ID"
+// @Param        annotation  body  UpdateAnnotationRequest  true  "Changed fields"
+// @Success      200  {object} Annotation
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /annotations/{id} [put]
+func (h *BookHandler) UpdateAnnotation(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid annotation ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	var req UpdateAnnotationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	annotation, err := h.store.UpdateAnnotation(c.UserContext(), userID, uint(id), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPassage):
+			return invalidPassage()
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return apierrors.ErrAnnotationNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation":     "update_annotation",
+				"annotation_id": id,
+				"user_id":       userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to update annotation")
+	}
+	h.invalidateAnnotations(userID, annotation.BookID)
+	return c.JSON(annotation)
+}
+
+// DeleteAnnotation godoc
+// @Summary      Delete my annotation
+// @Description  Only the annotation's author can delete it; other users' annotations are reported as not found.
+// @Tags         annotations
+// @Security     Bearer
+// @Param        id   path  int  true  "Annotation ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /annotations/{id} [delete]
+func (h *BookHandler) DeleteAnnotation(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid annotation ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	annotation, err := h.store.DeleteAnnotation(c.UserContext(), userID, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrAnnotationNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation":     "delete_annotation",
+				"annotation_id": id,
+				"user_id":       userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to delete annotation")
+	}
+	h.invalidateAnnotations(userID, annotation.BookID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BookChange records one field of a book changed by an update
+type BookChange struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BookID    uint      `json:"book_id" gorm:"not null;index:idx_book_changes_book_time"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	FieldName string    `json:"field_name" gorm:"not null"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ChangedAt time.Time `json:"changed_at" gorm:"not null;index:idx_book_changes_book_time"`
+}
+
+// BookChangeEntry is a change together with the username of the editor, which
+// is empty for changes made without a user, such as imports
+type BookChangeEntry struct {
+	BookChange
+	Username string `json:"username"`
+}
+
+// untrackedFields are bookkeeping columns that change without anyone editing
+// the book, and the attribution the changelog already records
+var untrackedFields = map[string]bool{
+	"ID":              true,
+	"ViewCount":       true,
+	"CreatedAt":       true,
+	"UpdatedAt":       true,
+	"Version":         true,
+	"SyncStatus":      true,
+	"DeletedAt":       true,
+	"CreatedByUserID": true,
+	"UpdatedByUserID": true,
+	"CreatedBy":       true,
+	"UpdatedBy":       true,
+}
+
+// beforeUpdateKey holds the book as it was before the update, for AfterUpdate
+const beforeUpdateKey = "book:before_update"
+
+type editorKey struct{}
+
+// WithEditor returns a context whose book updates are recorded in the
+// changelog as made by userID, and whose new books are created by userID
+func WithEditor(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, editorKey{}, userID)
+}
+
+func editorFromContext(ctx context.Context) *uint {
+	if ctx == nil {
+		return nil
+	}
+	if userID, ok := ctx.Value(editorKey{}).(uint); ok && userID != 0 {
+		return &userID
+	}
+	return nil
+}
+
+// BeforeUpdate increments the version and loads the stored book so
+// AfterUpdate can tell which fields changed. Bulk updates without a primary
+// key aren't tracked.
+func (b *Book) BeforeUpdate(tx *gorm.DB) error {
+	bumpVersion(tx, b)
+	if b.ID == 0 {
+		return nil
+	}
+	var before Book
+	if err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().First(&before, b.ID).Error; err != nil {
+		return err
+	}
+	tx.InstanceSet(beforeUpdateKey, before)
+	return nil
+}
+
+// AfterUpdate records a BookChange for every field that differs from the
+// state loaded by BeforeUpdate
+func (b *Book) AfterUpdate(tx *gorm.DB) error {
+	value, ok := tx.InstanceGet(beforeUpdateKey)
+	if !ok {
+		return nil
+	}
+	before := value.(Book)
+
+	session := tx.Session(&gorm.Session{NewDB: true})
+	var after Book
+	if err := session.Unscoped().First(&after, b.ID).Error; err != nil {
+		return err
+	}
+
+	changes := diffBooks(&before, &after)
+	if len(changes) == 0 {
+		return nil
+	}
+	editor := editorFromContext(tx.Statement.Context)
+	now := time.Now()
+	for i := range changes {
+		changes[i].BookID = b.ID
+		changes[i].UserID = editor
+		changes[i].ChangedAt = now
+	}
+	return session.Create(&changes).Error
+}
+
+// diffBooks returns a change, without book, editor or time, for every tracked
+// field that differs between before and after
+func diffBooks(before, after *Book) []BookChange {
+	var changes []BookChange
+	oldValue := reflect.ValueOf(before).Elem()
+	newValue := reflect.ValueOf(after).Elem()
+	bookType := oldValue.Type()
+	for i := 0; i < bookType.NumField(); i++ {
+		field := bookType.Field(i)
+		if untrackedFields[field.Name] || field.Tag.Get("gorm") == "-" {
+			continue
+		}
+		oldText := formatField(oldValue.Field(i))
+		newText := formatField(newValue.Field(i))
+		if oldText != newText {
+			changes = append(changes, BookChange{
+				FieldName: jsonName(field),
+				OldValue:  oldText,
+				NewValue:  newText,
+			})
+		}
+	}
+	return changes
+}
+
+func formatField(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func jsonName(field reflect.StructField) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if tag == "" || tag == "-" {
+		return field.Name
+	}
+	return tag
+}
+
+// ListBookChanges returns a page of a book's changelog, most recent first,
+// and the total number of changes
+func (s dbStore) ListBookChanges(ctx context.Context, bookID uint, page, limit int) ([]BookChangeEntry, int64, error) {
+	entries := []BookChangeEntry{}
+	var total int64
+
+	query := s.conn(ctx).Model(&BookChange{}).Where("book_changes.book_id = ?", bookID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Select("book_changes.*, COALESCE(users.username, '') AS username").
+		Joins("LEFT JOIN users ON users.id = book_changes.user_id").
+		Order("book_changes.changed_at DESC").Order("book_changes.id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,139 @@
+package book
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CoverPlaceholderTTL is how long placeholder covers are cached, in Redis
+// and by clients
+const CoverPlaceholderTTL = 24 * time.Hour
+
+// CoverPalette are the placeholder background colors. They are dark enough
+// for white initials to be readable.
+var CoverPalette = []string{
+	"#1e3a5f", "#7b2d26", "#2f5d50", "#5b3a75",
+	"#8a4b08", "#34495e", "#6d214f", "#155e63",
+}
+
+func coverPlaceholderKey(id uint) string {
+	return fmt.Sprintf("book:%d:cover:placeholder", id)
+}
+
+// PlaceholderColor is the background color of the placeholder cover for
+// title. The same title always gets the same color.
+func PlaceholderColor(title string) string {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	return CoverPalette[h.Sum32()%uint32(len(CoverPalette))]
+}
+
+// PlaceholderInitials are the first letters of the first two words of
+// title, or "?" when it has no letters or digits
+func PlaceholderInitials(title string) string {
+	var initials []rune
+	for _, word := range strings.Fields(title) {
+		for _, r := range word {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				initials = append(initials, unicode.ToUpper(r))
+				break
+			}
+		}
+		if len(initials) == 2 {
+			break
+		}
+	}
+	if len(initials) == 0 {
+		return "?"
+	}
+	return string(initials)
+}
+
+// PlaceholderSVG renders a cover for a book without one: the title's
+// initials in white on a rounded rectangle of the title's color
+func PlaceholderSVG(title string) string {
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="200" height="300" viewBox="0 0 200 300" role="img" aria-label="%s">`+
+		`<rect width="200" height="300" rx="16" ry="16" fill="%s"/>`+
+		`<text x="100" y="150" fill="#ffffff" font-family="sans-serif" font-size="72" font-weight="bold" text-anchor="middle" dominant-baseline="central">%s</text>`+
+		`</svg>`,
+		html.EscapeString(title), PlaceholderColor(title), html.EscapeString(PlaceholderInitials(title)))
+}
+
+// GetCoverPlaceholder godoc
+// @Summary      Get a placeholder cover for a book
+// @Description  An SVG of the book's initials on a background color derived from its title
+// @Tags         books
+// @Produce      image/svg+xml
+// @Param        id   path  int  true  "Book ID"
+// @Success      200  {string} string "SVG image"
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/cover/placeholder [get]
+func (h *BookHandler) GetCoverPlaceholder(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+
+	cacheKey := coverPlaceholderKey(uint(id))
+	var svg string
+	if h.cache != nil {
+		if err := h.cache.Get(cacheKey, &svg); err == nil {
+			h.metrics.RecordCacheOperation("get", "hit")
+			return sendCoverPlaceholder(c, svg)
+		}
+		h.metrics.RecordCacheOperation("get", "miss")
+	}
+
+	book, err := h.store.GetBookByID(c.UserContext(), uint(id))
+	if err != nil {
+		return apierrors.ErrBookNotFound
+	}
+	svg = PlaceholderSVG(book.Title)
+	if h.cache != nil {
+		h.cache.Set(cacheKey, svg, CoverPlaceholderTTL)
+		h.metrics.RecordCacheOperation("set", "success")
+	}
+	return sendCoverPlaceholder(c, svg)
+}
+
+func sendCoverPlaceholder(c *fiber.Ctx, svg string) error {
+	c.Set(fiber.HeaderContentType, "image/svg+xml")
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(CoverPlaceholderTTL.Seconds())))
+	return c.SendString(svg)
+}
+
+// GetCover godoc
+// @Summary      Get a book's cover
+// @Description  Redirects to the book's cover_url, or to its placeholder cover when it has none. Both redirects are 302s: a cover can be set or changed later, and a cached 301 would outlive it.
+// @Tags         books
+// @Param        id   path  int  true  "Book ID"
+// @Success      302
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/cover [get]
+func (h *BookHandler) GetCover(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+
+	book, err := h.store.GetBookByID(c.UserContext(), uint(id))
+	if err != nil {
+		return apierrors.ErrBookNotFound
+	}
+	if book.CoverURL != "" {
+		return c.Redirect(book.CoverURL, fiber.StatusFound)
+	}
+	return c.Redirect(fmt.Sprintf("/books/%d/cover/placeholder", id), fiber.StatusFound)
+}
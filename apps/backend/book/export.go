@@ -0,0 +1,62 @@
+package book
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/export"
+	"github.com/gofiber/fiber/v2"
+)
+
+const exportBatchSize = 500
+
+// ExportBooks godoc
+// @Summary      Export all books (admin only)
+// @Description  Streams every book, with its series, in batches so large catalogs don't need to fit in memory.
+// @Tags         admin
+// @Produce      json
+// @Produce      text/csv
+// @Produce      application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security     Bearer
+// @Param        format query string false "Export format" Enums(csv, json, xlsx) default(csv)
+// @Success      200  {string} string "Export file"
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/export [get]
+func (h *BookHandler) ExportBooks(c *fiber.Ctx) error {
+	format := c.Query("format", export.FormatCSV)
+	contentType := export.ContentType(format)
+	if contentType == "" {
+		return apierrors.ErrInvalidQuery.WithMessage("format must be one of " + strings.Join(export.Formats(), ", "))
+	}
+
+	// The stream writer runs after the handler returns, when c is recycled
+	ctx := c.UserContext()
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="books-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := export.StreamExport(w, format, Book{}, func(write func(interface{}) error) error {
+			return h.store.StreamBooks(ctx, exportBatchSize, func(books []Book) error {
+				if err := h.store.AttachSeries(ctx, books); err != nil {
+					return err
+				}
+				return write(books)
+			})
+		})
+		if err != nil && h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "export_books",
+				"format":    format,
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidGenre is returned for genre names without letters or digits
+	ErrInvalidGenre = errors.New("genre must contain a letter or digit")
+	// ErrUnknownGenre is returned for a genre_id that matches no genre
+	ErrUnknownGenre = errors.New("genre_id doesn't match a genre")
+)
+
+// bookGenreSlugSQL is GenreSlug of books.genre in SQL
+const bookGenreSlugSQL = "TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(books.genre), '[^[:alnum:]]+', '-', 'g'))"
+
+// GenreSlug returns the slug of a genre name: its letters and digits in
+// lower case, with a hyphen for every run of other characters, so
+// "Sci-Fi", "sci fi" and "SCI_FI" are all "sci-fi"
+func GenreSlug(name string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return slug.String()
+}
+
+// FindOrCreateGenre returns the genre with the slug of name, creating it
+// with the trimmed name if there is none
+func FindOrCreateGenre(tx *gorm.DB, name string) (*Genre, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	slug := GenreSlug(name)
+	if slug == "" {
+		return nil, ErrInvalidGenre
+	}
+
+	var genre Genre
+	found := tx.Where("slug = ?", slug).Limit(1).Find(&genre)
+	if found.Error != nil || found.RowsAffected > 0 {
+		return &genre, found.Error
+	}
+
+	// Another request may create the genre first
+	err := tx.Exec("INSERT INTO genres (name, slug, description, created_at, updated_at) VALUES (?, ?, '', NOW(), NOW()) ON CONFLICT DO NOTHING", name, slug).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("slug = ?", slug).First(&genre).Error; err != nil {
+		return nil, err
+	}
+	return &genre, nil
+}
+
+// ValidateGenre returns the ID of the genre named genre, ignoring case,
+// spacing and punctuation. A genre that doesn't exist yet is created.
+func (s dbStore) ValidateGenre(ctx context.Context, genre string) (uint, error) {
+	g, err := FindOrCreateGenre(s.conn(ctx), genre)
+	if err != nil {
+		return 0, err
+	}
+	return g.ID, nil
+}
+
+// linkGenre points the book at its genre: the one GenreID names, or else
+// the one matching Genre, which is created if needed. Genre is set to the
+// genre's name either way. Books without either are left alone.
+func (b *Book) linkGenre(tx *gorm.DB) error {
+	var genre Genre
+	switch {
+	case b.GenreID != nil:
+		err := tx.First(&genre, *b.GenreID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownGenre
+		}
+		if err != nil {
+			return err
+		}
+	case strings.TrimSpace(b.Genre) != "":
+		found, err := FindOrCreateGenre(tx, b.Genre)
+		if err != nil {
+			return err
+		}
+		genre = *found
+	default:
+		return nil
+	}
+	b.GenreID = &genre.ID
+	b.Genre = genre.Name
+	return nil
+}
+
+// linkGenres links the books with ids to their genres like linkGenre,
+// creating the missing genres, for books inserted without the Book hooks
+func linkGenres(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := tx.Exec(`INSERT INTO genres (name, slug, description, created_at, updated_at)
+		SELECT DISTINCT ON (slug) name, slug, '', NOW(), NOW()
+		FROM (SELECT TRIM(books.genre) AS name, `+bookGenreSlugSQL+` AS slug FROM books WHERE books.id IN ?) AS named
+		WHERE slug <> ''
+		ORDER BY slug, name
+		ON CONFLICT DO NOTHING`, ids).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`UPDATE books SET genre_id = genres.id, genre = genres.name
+		FROM genres
+		WHERE genres.slug = `+bookGenreSlugSQL+` AND books.id IN ?`, ids).Error
+}
+
+// genreError returns the validation error of ErrInvalidGenre and
+// ErrUnknownGenre, or nil for other errors
+func genreError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidGenre):
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "genre", Message: "must contain a letter or digit"})
+	case errors.Is(err, ErrUnknownGenre):
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "genre_id", Message: "doesn't match a genre"})
+	}
+	return nil
+}
+
+// ListGenres returns every genre with its number of books, by name
+func (s dbStore) ListGenres(ctx context.Context) ([]GenreCount, error) {
+	genres := []GenreCount{}
+	err := s.conn(ctx).Model(&Genre{}).
+		Select("genres.*, COUNT(books.id) AS book_count").
+		Joins("LEFT JOIN books ON books.genre_id = genres.id AND books.deleted_at IS NULL").
+		Group("genres.id").
+		Order("genres.name").
+		Find(&genres).Error
+	return genres, err
+}
+
+// ListGenres godoc
+// @Summary      List genres
+// @Description  Every genre with its number of books, by name. Books are written with a genre_id from this list, or with a genre name, which is matched ignoring case, spacing and punctuation.
+// @Tags         books
+// @Produce      json
+// @Success      200  {array} GenreCount
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /genres [get]
+func (h *BookHandler) ListGenres(c *fiber.Ctx) error {
+	genres, err := h.store.ListGenres(c.UserContext())
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "list_genres"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch genres")
+	}
+	return c.JSON(genres)
+}
@@ -1,32 +1,160 @@
 package book
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/odata"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/singleflight"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 var (
-	Cache *cache.RedisCache
-	Log   *logger.Logger
+	// SlidingCacheTTL resets a cached book's TTL on every read so popular
+	// books stay cached. Set from CACHE_SLIDING_TTL.
+	SlidingCacheTTL bool
+	// SpeculativeSearch queries the database alongside the cache lookup in
+	// GetBooks instead of after a miss. Set from SEARCH_SPECULATIVE.
+	SpeculativeSearch bool
+	// XFetchCache refreshes cached books shortly before they expire, at a
+	// random point that makes one reader likely to do it, instead of every
+	// reader missing at once when they do. Set from CACHE_XFETCH_ENABLED.
+	XFetchCache bool
 )
 
+const bookCacheTTL = 10 * time.Minute
+
+// bookXFetchDelta is roughly how long loading a book takes, which sets how
+// early XFetchCache starts refreshing
+const bookXFetchDelta = 100 * time.Millisecond
+
+// BookHandler serves the book endpoints and runs the book jobs from its own
+// store, cache, logger and metrics, so it can be tested without the package
+// variables. cache, log and metrics may be nil.
+type BookHandler struct {
+	store   Store
+	service *Service
+	cache   cache.Cache
+	log     *logger.Logger
+	metrics *metrics.MetricsCollector
+
+	// Webhooks and Activity receive the events of book changes. Without
+	// Webhooks no webhooks are called; without Activity events still reach
+	// activity.Hub but cached activity pages aren't dropped.
+	Webhooks *webhook.Handler
+	Activity *activity.Handler
+
+	// bookFlight and booksFlight coalesce concurrent cache misses of GetBook
+	// and GetBooks by cache key
+	bookFlight  singleflight.Group
+	booksFlight singleflight.Group
+	// bookRefreshes holds the cache keys XFetchCache is reloading, so
+	// readers that also decide to refresh a key keep the cached copy
+	// instead of waiting
+	bookRefreshes sync.Map
+
+	// reindex is the running reindex, if any
+	reindex reindexState
+}
+
+// NewBookHandler returns a BookHandler reading and writing books through store
+func NewBookHandler(store Store, c cache.Cache, log *logger.Logger, m *metrics.MetricsCollector) *BookHandler {
+	return &BookHandler{store: store, service: NewService(store, log), cache: c, log: log, metrics: m}
+}
+
+var errRefreshRunning = errors.New("refresh already running")
+
 // GetBooks godoc
 // @Summary      Get all books
 // @Tags         books
 // @Produce      json
-// @Param        search query string false "Search books by title or author"
+// @Param        search query string false "Search books by title or author; results are ranked by relevance unless sort=created_at"
+// @Param        $filter query string false "OData filter, e.g. year ge 2000 and genre eq 'Fiction'"
+// @Param        $orderby query string false "OData ordering, e.g. title asc"
+// @Param        $top query int false "Maximum number of books to return"
+// @Param        $skip query int false "Number of books to skip"
+// @Param        series_id query int false "Only books in this series, in sequence order"
+// @Param        facets query string false "Comma-separated facets to count (genre, decade); wraps the response as {books, facets}"
+// @Param        sort query string false "Sort field; with search only relevance (the default, adding each result's score) and created_at apply" Enums(relevance, views, title, year, created_at)
+// @Param        dir query string false "Sort direction" Enums(asc, desc)
+// @Param        status query string false "Only books in this status; combines with search, created_by and genre_id" Enums(available, reserved, checked_out, lost)
+// @Param        created_by query int false "Only books added by this user, newest first; combines with search, status and genre_id"
+// @Param        genre_id query int false "Only books in this genre, by title unless created_by is set; combines with search, status and created_by"
 // @Success      200 {array} Book
-// @Failure      500 {object} map[string]interface{}
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
 // @Router       /books [get]
-func GetBooks(c *fiber.Ctx) error {
+func (h *BookHandler) GetBooks(c *fiber.Ctx) error {
 	start := time.Now()
+
 	search := c.Query("search")
+	filter, err := bookFilterFromQuery(c, search)
+	if err != nil {
+		return err
+	}
+	if filter.HasFilters() {
+		// These listings run their own query, which the filters can't join
+		conflicting := []string{"$filter", "$orderby", "$top", "$skip", "series_id", "facets"}
+		if search == "" {
+			conflicting = append(conflicting, "sort")
+		}
+		for _, param := range conflicting {
+			if c.Query(param) != "" {
+				return apierrors.ErrInvalidQuery.WithMessage(fmt.Sprintf("%s can't be combined with status, created_by or genre_id", param))
+			}
+		}
+	}
+
+	odataOpts := odata.Options{
+		Filter:  c.Query("$filter"),
+		OrderBy: c.Query("$orderby"),
+		Top:     c.Query("$top"),
+		Skip:    c.Query("$skip"),
+	}
+	if !odataOpts.Empty() {
+		return h.getBooksOData(c, odataOpts, start)
+	}
+
+	if seriesID := c.QueryInt("series_id"); seriesID > 0 {
+		return h.getSeriesBooks(c, uint(seriesID), start)
+	}
+
+	sort := c.Query("sort")
+	if search != "" {
+		if sort == "" {
+			sort = SortRelevance
+		}
+		if sort != SortRelevance && sort != SortCreatedAt {
+			return apierrors.ErrInvalidQuery.WithMessage("Search results can only be sorted by relevance or created_at")
+		}
+		if dir := c.Query("dir", "asc"); dir != "asc" && dir != "desc" {
+			return apierrors.ErrInvalidQuery.WithMessage("Invalid sort direction")
+		}
+	} else if sort != "" {
+		return h.getSortedBooks(c, sort, c.Query("dir", "asc"), start)
+	}
+
+	if filter.HasFilters() {
+		return h.getFilteredBooks(c, filter, sort, start)
+	}
+
+	if facets := c.Query("facets"); facets != "" {
+		return h.getBooksWithFacets(c, search, strings.Split(facets, ","), start)
+	}
 
 	// Generate cache key
 	cacheKey := "books:all"
@@ -35,46 +163,357 @@ func GetBooks(c *fiber.Ctx) error {
 	}
 
 	var books []Book
-	var err error
 
-	if Cache != nil {
-		err = Cache.Get(cacheKey, &books)
-		if err == nil {
-			metrics.RecordCacheOperation("get", "hit")
-			if Log != nil {
-				Log.LogCache("get", cacheKey, true, time.Since(start))
+	if SpeculativeSearch && h.cache != nil {
+		var hit bool
+		books, hit, err = FetchBooksSpeculative(c.UserContext(), h.cache, h.store.LoadBooks, cacheKey, search)
+		if hit {
+			h.metrics.RecordCacheOperation("get", "hit")
+			if h.log != nil {
+				h.log.LogCache("get", cacheKey, true, time.Since(start))
 			}
-			return c.JSON(books)
+			h.recordSearch(c, search, len(books))
+			return sendSearchResults(c, search, sort, books)
 		}
-		metrics.RecordCacheOperation("get", "miss")
-	}
-
-	if search != "" {
-		books, err = SearchBooks(search)
+		h.metrics.RecordCacheOperation("get", "miss")
 	} else {
-		books, err = GetAllBooks()
+		if h.cache != nil {
+			err = h.cache.Get(cacheKey, &books)
+			if err == nil {
+				h.metrics.RecordCacheOperation("get", "hit")
+				if h.log != nil {
+					h.log.LogCache("get", cacheKey, true, time.Since(start))
+				}
+				h.recordSearch(c, search, len(books))
+				return sendSearchResults(c, search, sort, books)
+			}
+			h.metrics.RecordCacheOperation("get", "miss")
+		}
+
+		// Concurrent misses for the same search share one query and cache write
+		var loaded interface{}
+		loaded, _, err = h.booksFlight.Do(c.UserContext(), cacheKey, func(ctx context.Context) (interface{}, error) {
+			books, err := h.store.LoadBooks(ctx, search)
+			if err == nil && h.cache != nil {
+				h.cache.Set(cacheKey, books, 5*time.Minute)
+				h.metrics.RecordCacheOperation("set", "success")
+			}
+			return books, err
+		})
+		books, _ = loaded.([]Book)
 	}
 
 	if err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "get_books",
 				"search":    search,
 			})
 		}
-		metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch books"})
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	if SpeculativeSearch && h.cache != nil {
+		h.cache.Set(cacheKey, books, 5*time.Minute)
+		h.metrics.RecordCacheOperation("set", "success")
+	}
+
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
+	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+
+	h.recordSearch(c, search, len(books))
+	return sendSearchResults(c, search, sort, books)
+}
+
+// sendSearchResults responds with books in the requested order. Results are
+// cached unordered, so one cached search serves both orders.
+func sendSearchResults(c *fiber.Ctx, search, sort string, books []Book) error {
+	switch {
+	case search == "":
+		return c.JSON(books)
+	case sort == SortCreatedAt:
+		sorted := append([]Book(nil), books...)
+		sortByCreatedAt(sorted, c.Query("dir", "asc"))
+		return c.JSON(sorted)
+	default:
+		return c.JSON(RankResults(books, search))
+	}
+}
+
+func facetCacheKey(search, facet string) string {
+	return fmt.Sprintf("facets:%s:%s", facet, search)
+}
+
+// clearFacets drops all cached facet counts, which any book write can change
+func clearFacets(c cache.Cache) {
+	if c == nil {
+		return
+	}
+	if keys, err := c.Keys("facets:*"); err == nil {
+		c.Delete(keys...)
+	}
+}
+
+// getBooksWithFacets runs the search and each facet count concurrently. Facet
+// counts are cached apart from the results so they can be reused across
+// pages and sort orders.
+func (h *BookHandler) getBooksWithFacets(c *fiber.Ctx, search string, names []string, start time.Time) error {
+	facets := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !IsFacet(name) {
+			return apierrors.ErrInvalidQuery.WithMessage(fmt.Sprintf("Unsupported facet %q (supported: genre, decade)", name))
+		}
+		facets = append(facets, name)
+	}
+
+	ctx := c.UserContext()
+	var (
+		wg       sync.WaitGroup
+		books    []Book
+		booksErr error
+	)
+	facetValues := make([][]FacetValue, len(facets))
+	facetErrs := make([]error, len(facets))
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		books, booksErr = h.store.SearchBooks(ctx, search)
+		if booksErr == nil {
+			booksErr = h.store.AttachDetails(ctx, books)
+		}
+	}()
+
+	for i, facet := range facets {
+		cacheKey := facetCacheKey(search, facet)
+		if h.cache != nil && h.cache.Get(cacheKey, &facetValues[i]) == nil {
+			h.metrics.RecordCacheOperation("get", "hit")
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, facet, cacheKey string) {
+			defer wg.Done()
+			facetValues[i], facetErrs[i] = h.store.GetFacet(ctx, search, facet)
+			if facetErrs[i] == nil && h.cache != nil {
+				h.cache.Set(cacheKey, facetValues[i], 5*time.Minute)
+			}
+		}(i, facet, cacheKey)
+	}
+	wg.Wait()
+
+	err := booksErr
+	for _, facetErr := range facetErrs {
+		if err == nil {
+			err = facetErr
+		}
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "get_books_faceted",
+				"search":    search,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	result := FacetedBooks{Books: books, Facets: make(map[string][]FacetValue, len(facets))}
+	for i, facet := range facets {
+		result.Facets[facet] = facetValues[i]
+	}
+
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+	h.recordSearch(c, search, len(books))
+	return c.JSON(result)
+}
+
+// sortColumns maps the sort query parameter to a books column
+var sortColumns = map[string]string{
+	"views":      "view_count",
+	"title":      "title",
+	"year":       "year",
+	"created_at": "created_at",
+}
+
+func (h *BookHandler) getSortedBooks(c *fiber.Ctx, sort, dir string, start time.Time) error {
+	column, ok := sortColumns[sort]
+	if !ok {
+		return apierrors.ErrInvalidQuery.WithMessage("Invalid sort field")
+	}
+	if dir != "asc" && dir != "desc" {
+		return apierrors.ErrInvalidQuery.WithMessage("Invalid sort direction")
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	books, err := h.store.GetSortedBooks(c.UserContext(), column+" "+dir, limit)
+	if err == nil {
+		err = h.store.AttachDetails(c.UserContext(), books)
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "get_sorted_books",
+				"sort":      sort,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
+	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+
+	return c.JSON(books)
+}
+
+// getBooksByCreator lists the books a user added. They aren't cached, since
+// adding a book would have to drop the creator's listing.
+func (h *BookHandler) getBooksByCreator(c *fiber.Ctx, userID uint, start time.Time) error {
+	books, err := h.store.ListBooksByCreator(c.UserContext(), userID)
+	if err == nil {
+		err = h.store.AttachDetails(c.UserContext(), books)
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "get_books_by_creator",
+				"user_id":   userID,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
+	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+
+	return c.JSON(books)
+}
+
+// GetUserBooks godoc
+// @Summary      List the books a user added
+// @Tags         books
+// @Produce      json
+// @Param        id   path  int  true  "User ID"
+// @Success      200  {array} Book
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /users/{id}/books [get]
+func (h *BookHandler) GetUserBooks(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return apierrors.ErrInvalidID.WithMessage("Invalid user ID")
+	}
+
+	exists, err := h.store.UserExists(c.UserContext(), uint(id))
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "get_user_books", "user_id": id})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+	if !exists {
+		return apierrors.ErrUserNotFound
+	}
+	return h.getBooksByCreator(c, uint(id), time.Now())
+}
+
+// bookFilterFromQuery reads the GetBooks parameters that combine into one
+// query
+func bookFilterFromQuery(c *fiber.Ctx, search string) (BookFilter, error) {
+	filter := BookFilter{Search: search}
+	if status := c.Query("status"); status != "" {
+		if !IsStatus(status) {
+			return filter, apierrors.ErrInvalidQuery.WithMessage("Invalid status")
+		}
+		filter.Status = status
+	}
+	if createdBy := c.Query("created_by"); createdBy != "" {
+		userID, err := strconv.ParseUint(createdBy, 10, 32)
+		if err != nil || userID == 0 {
+			return filter, apierrors.ErrInvalidQuery.WithMessage("Invalid created_by")
+		}
+		filter.CreatedBy = uint(userID)
+	}
+	if genre := c.Query("genre_id"); genre != "" {
+		genreID, err := strconv.ParseUint(genre, 10, 32)
+		if err != nil || genreID == 0 {
+			return filter, apierrors.ErrInvalidQuery.WithMessage("Invalid genre_id")
+		}
+		filter.GenreID = uint(genreID)
+	}
+	return filter, nil
+}
+
+// getFilteredBooks lists the books matching filter. These listings change
+// with every checkout, so they aren't cached.
+func (h *BookHandler) getFilteredBooks(c *fiber.Ctx, filter BookFilter, sort string, start time.Time) error {
+	books, err := h.store.FilterBooks(c.UserContext(), filter)
+	if err == nil {
+		err = h.store.AttachDetails(c.UserContext(), books)
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation":  "get_filtered_books",
+				"status":     filter.Status,
+				"created_by": filter.CreatedBy,
+				"genre_id":   filter.GenreID,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
 	}
 
-	if Cache != nil {
-		Cache.Set(cacheKey, books, 5*time.Minute)
-		metrics.RecordCacheOperation("set", "success")
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
 	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+
+	return sendSearchResults(c, filter.Search, sort, books)
+}
 
-	if Log != nil {
-		Log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
+func (h *BookHandler) getBooksOData(c *fiber.Ctx, opts odata.Options, start time.Time) error {
+	query, err := odata.Parse(opts, ODataFields)
+	if err != nil {
+		return apierrors.ErrInvalidQuery.WithMessage(err.Error())
 	}
-	metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+
+	books, err := h.store.QueryBooks(c.UserContext(), query)
+	if err == nil {
+		err = h.store.AttachDetails(c.UserContext(), books)
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "query_books",
+				"filter":    opts.Filter,
+				"orderby":   opts.OrderBy,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
+	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
 
 	return c.JSON(books)
 }
@@ -84,163 +523,295 @@ func GetBooks(c *fiber.Ctx) error {
 // @Tags         books
 // @Produce      json
 // @Param        id   path  int  true  "Book ID"
-// @Success      200  {object} Book
-// @Failure      400  {object} map[string]interface{}
-// @Failure      404  {object} map[string]interface{}
+// @Success      200  {object} BookDetail "bookmarked is included when a bearer token is sent"
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
 // @Router       /books/{id} [get]
-func GetBook(c *fiber.Ctx) error {
+func (h *BookHandler) GetBook(c *fiber.Ctx) error {
 	start := time.Now()
 	idStr := c.Params("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid book ID"})
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
 	}
 
 	cacheKey := fmt.Sprintf("book:%d", id)
 	var book Book
 
-	if Cache != nil {
-		err = Cache.Get(cacheKey, &book)
+	if h.cache != nil && XFetchCache {
+		notFound, err := h.getBookXFetch(c.UserContext(), cacheKey, uint(id), &book, start)
+		if err == nil {
+			return c.JSON(h.bookDetail(c, book))
+		}
+		if notFound {
+			return apierrors.ErrBookNotFound
+		}
+		// A miss while another reader loads the book, or Redis failed
+	}
+
+	if h.cache != nil && !XFetchCache {
+		if SlidingCacheTTL {
+			err = h.cache.GetWithSlidingTTL(cacheKey, &book, bookCacheTTL)
+		} else {
+			err = h.cache.Get(cacheKey, &book)
+		}
 		if err == nil {
-			metrics.RecordCacheOperation("get", "hit")
-			if Log != nil {
-				Log.LogCache("get", cacheKey, true, time.Since(start))
+			h.metrics.RecordCacheOperation("get", "hit")
+			if h.log != nil {
+				h.log.LogCache("get", cacheKey, true, time.Since(start))
 			}
-			return c.JSON(book)
+			return c.JSON(h.bookDetail(c, book))
+		}
+		h.metrics.RecordCacheOperation("get", "miss")
+	}
+
+	// Concurrent misses for the same book share one query
+	loaded, _, err := h.bookFlight.Do(c.UserContext(), cacheKey, func(ctx context.Context) (interface{}, error) {
+		loaded, err := h.loadBookLogged(ctx, uint(id), start)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.cache != nil {
+			h.cache.Set(cacheKey, loaded, bookCacheTTL)
+			h.metrics.RecordCacheOperation("set", "success")
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		return apierrors.ErrBookNotFound
+	}
+
+	return c.JSON(h.bookDetail(c, loaded.(Book)))
+}
+
+// getBookXFetch reads a book through Cache.GetXFetch. Only one reader
+// reloads a key at a time; the others get the cached copy, or on a miss
+// return errRefreshRunning so GetBook waits for the load through
+// h.bookFlight. notFound reports that err came from loading the book rather
+// than from Redis.
+func (h *BookHandler) getBookXFetch(ctx context.Context, cacheKey string, id uint, book *Book, start time.Time) (notFound bool, err error) {
+	var fetched bool
+	var fetchErr error
+	err = h.cache.GetXFetch(cacheKey, book, bookCacheTTL, bookXFetchDelta, cache.DefaultXFetchBeta, func() (interface{}, error) {
+		if _, running := h.bookRefreshes.LoadOrStore(cacheKey, struct{}{}); running {
+			return nil, errRefreshRunning
+		}
+		defer h.bookRefreshes.Delete(cacheKey)
+
+		fetched = true
+		var loaded interface{}
+		loaded, _, fetchErr = h.bookFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+			return h.loadBookLogged(ctx, id, start)
+		})
+		return loaded, fetchErr
+	})
+	if err != nil {
+		return fetchErr != nil, err
+	}
+
+	if fetched {
+		h.metrics.RecordCacheOperation("get", "miss")
+	} else {
+		h.metrics.RecordCacheOperation("get", "hit")
+		if h.log != nil {
+			h.log.LogCache("get", cacheKey, true, time.Since(start))
 		}
-		metrics.RecordCacheOperation("get", "miss")
 	}
+	return false, nil
+}
 
-	bookPtr, err := GetBookByID(uint(id))
+// loadBookLogged is LoadBook with query logging and metrics
+func (h *BookHandler) loadBookLogged(ctx context.Context, id uint, start time.Time) (Book, error) {
+	bookPtr, err := h.store.LoadBook(ctx, id)
 	if err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "get_book",
 				"book_id":   id,
 			})
 		}
-		metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
-		return c.Status(404).JSON(fiber.Map{"error": "Book not found"})
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return Book{}, err
 	}
 
-	book = *bookPtr
-
-	if Cache != nil {
-		Cache.Set(cacheKey, book, 10*time.Minute)
-		metrics.RecordCacheOperation("set", "success")
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), 1)
 	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+	return *bookPtr, nil
+}
 
-	if Log != nil {
-		Log.LogDatabase("select", "books", time.Since(start), 1)
-	}
-	metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+// bookDetail records the view and attaches the book's view statistics and,
+// for signed-in users, whether they bookmarked it
+func (h *BookHandler) bookDetail(c *fiber.Ctx, book Book) BookDetail {
+	h.RecordView(book.ID, c.IP())
+	views, uniqueVisitors := h.GetViewStats(&book)
+	detail := BookDetail{Book: book, Views: views, UniqueVisitors: uniqueVisitors}
 
-	return c.JSON(book)
+	if userID, ok := middleware.UserID(c); ok {
+		if bookmarked, err := h.bookmarkState(c.UserContext(), userID, book.ID); err == nil {
+			detail.Bookmarked = &bookmarked
+		}
+	}
+	return detail
 }
 
 // AddBook godoc
 // @Summary      Create a new book
+// @Description  Books whose title is very similar to one already in the catalog are rejected with 409 and up to 3 similar books in details.candidates; send force=true to add the book anyway.
 // @Tags         books
 // @Accept       json
 // @Produce      json
-// @Param        book  body  Book  true  "Book to add"
+// @Param        book   body   Book  true   "Book to add"
+// @Param        force  query  bool  false  "Add the book even if its title is similar to an existing one"
 // @Success      201  {object} Book
-// @Failure      400  {object} map[string]interface{}
-// @Failure      500  {object} map[string]interface{}
+// @Failure      400  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError{details=dedup.Details} "A book with a similar title exists"
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
 // @Router       /books [post]
-func AddBookHandler(c *fiber.Ctx) error {
+func (h *BookHandler) AddBook(c *fiber.Ctx) error {
 	start := time.Now()
 	var book Book
 	if err := c.BodyParser(&book); err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "add_book",
-				"error": "invalid_request_body",
+				"error":     "invalid_request_body",
 			})
 		}
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		return apierrors.ErrInvalidRequestBody
+	}
+	ctx := c.UserContext()
+	if userID, ok := middleware.UserID(c); ok {
+		ctx = WithEditor(ctx, userID)
 	}
 
-	if err := CreateBook(&book); err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+	if err := h.service.AddBook(ctx, &book, c.QueryBool("force")); err != nil {
+		var apiErr *apierrors.APIError
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "add_book",
-				"title": book.Title,
+				"title":     book.Title,
 			})
 		}
-		metrics.RecordDatabaseQuery("insert", "books", "error", time.Since(start))
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to create book"})
+		h.metrics.RecordDatabaseQuery("insert", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to create book")
 	}
 
-	if Cache != nil {
-		Cache.Delete("books:all")
-		metrics.RecordCacheOperation("delete", "success")
+	if h.cache != nil {
+		h.cache.Delete("books:all")
+		InvalidateAuthorCache(h.cache, book.AuthorID)
+		clearFacets(h.cache)
+		h.metrics.RecordCacheOperation("delete", "success")
+	}
+	attributed := []Book{book}
+	if err := h.store.AttachAttribution(c.UserContext(), attributed); err == nil {
+		book = attributed[0]
 	}
 
-	if Log != nil {
-		Log.LogDatabase("insert", "books", time.Since(start), 1)
-		Log.LogBookOperation("create", "", book.ID, book.Title)
+	if h.log != nil {
+		h.log.LogDatabase("insert", "books", time.Since(start), 1)
+		h.log.LogBookOperation("create", book.CreatedByUsername, book.ID, book.Title)
 	}
-	metrics.RecordDatabaseQuery("insert", "books", "success", time.Since(start))
+	h.metrics.RecordDatabaseQuery("insert", "books", "success", time.Since(start))
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventBookCreated, book)
 
 	return c.Status(201).JSON(book)
 }
 
 // UpdateBook godoc
 // @Summary      Update a book by ID
+// @Description  Omitted fields keep their value. version must be the version of the book the changes are based on; if the book was updated since, the request fails with 409 and current_version.
 // @Tags         books
 // @Accept       json
 // @Produce      json
 // @Param        id    path  int   true  "Book ID"
 // @Param        book  body  Book  true  "Updated book"
 // @Success      200   {object} Book
-// @Failure      400   {object} map[string]interface{}
-// @Failure      404   {object} map[string]interface{}
-// @Failure      500   {object} map[string]interface{}
+// @Failure      400   {object} apierrors.APIError
+// @Failure      404   {object} apierrors.APIError
+// @Failure      409   {object} apierrors.VersionConflictBody "The book was updated by another request"
+// @Failure      429   {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500   {object} apierrors.APIError
 // @Router       /books/{id} [put]
-func UpdateBookHandler(c *fiber.Ctx) error {
+func (h *BookHandler) UpdateBook(c *fiber.Ctx) error {
 	start := time.Now()
 	idStr := c.Params("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid book ID"})
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
 	}
 
 	var book Book
 	if err := c.BodyParser(&book); err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "update_book",
-				"book_id": id,
-				"error": "invalid_request_body",
+				"book_id":   id,
+				"error":     "invalid_request_body",
 			})
 		}
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		return apierrors.ErrInvalidRequestBody
+	}
+	if book.Version < 1 {
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "version", Message: "is required: send the version of the book being edited"})
 	}
 
-	updatedBook, err := UpdateBook(uint(id), &book)
+	ctx := c.UserContext()
+	if userID, ok := middleware.UserID(c); ok {
+		ctx = WithEditor(ctx, userID)
+	}
+	updatedBook, err := h.service.UpdateBook(ctx, uint(id), &book)
 	if err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+		var conflict *VersionConflictError
+		if errors.As(err, &conflict) {
+			h.metrics.RecordDatabaseQuery("update", "books", "conflict", time.Since(start))
+			return c.Status(fiber.StatusConflict).JSON(apierrors.VersionConflictBody{
+				Code:           apierrors.ErrBookVersionConflict.Code,
+				Error:          "conflict",
+				Message:        apierrors.ErrBookVersionConflict.Message,
+				CurrentVersion: conflict.CurrentVersion,
+			})
+		}
+		var apiErr *apierrors.APIError
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "update_book",
-				"book_id": id,
+				"book_id":   id,
 			})
 		}
-		metrics.RecordDatabaseQuery("update", "books", "error", time.Since(start))
-		return c.Status(404).JSON(fiber.Map{"error": "Book not found"})
+		h.metrics.RecordDatabaseQuery("update", "books", "error", time.Since(start))
+		return apierrors.ErrBookNotFound
 	}
 
-	if Cache != nil {
-		Cache.Delete("books:all")
-		Cache.Delete(fmt.Sprintf("book:%d", id))
-		metrics.RecordCacheOperation("delete", "success")
+	if h.cache != nil {
+		h.cache.Delete("books:all")
+		h.cache.Delete(fmt.Sprintf("book:%d", id), coverPlaceholderKey(uint(id)))
+		h.invalidateSeries(c.UserContext(), uint(id))
+		InvalidateAuthorCache(h.cache, updatedBook.AuthorID)
+		clearFacets(h.cache)
+		h.metrics.RecordCacheOperation("delete", "success")
+	}
+	attributed := []Book{*updatedBook}
+	if err := h.store.AttachAttribution(c.UserContext(), attributed); err == nil {
+		updatedBook = &attributed[0]
 	}
 
-	if Log != nil {
-		Log.LogDatabase("update", "books", time.Since(start), 1)
-		Log.LogBookOperation("update", "", uint(id), updatedBook.Title)
+	if h.log != nil {
+		h.log.LogDatabase("update", "books", time.Since(start), 1)
+		h.log.LogBookOperation("update", updatedBook.UpdatedByUsername, uint(id), updatedBook.Title)
 	}
-	metrics.RecordDatabaseQuery("update", "books", "success", time.Since(start))
+	h.metrics.RecordDatabaseQuery("update", "books", "success", time.Since(start))
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventBookUpdated, updatedBook)
 
 	return c.JSON(updatedBook)
 }
@@ -250,39 +821,772 @@ func UpdateBookHandler(c *fiber.Ctx) error {
 // @Tags         books
 // @Param        id   path  int  true  "Book ID"
 // @Success      204
-// @Failure      400  {object} map[string]interface{}
-// @Failure      404  {object} map[string]interface{}
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError "The book is not available"
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
 // @Router       /books/{id} [delete]
-func DeleteBookHandler(c *fiber.Ctx) error {
+func (h *BookHandler) DeleteBook(c *fiber.Ctx) error {
 	start := time.Now()
 	idStr := c.Params("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid book ID"})
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
 	}
 
-	if err := DeleteBook(uint(id)); err != nil {
-		if Log != nil {
-			Log.LogError(err, map[string]interface{}{
+	// Look up the series and author before the book disappears from the joins
+	seriesID, _ := h.store.GetBookSeriesID(c.UserContext(), uint(id))
+	existing, _ := h.store.GetBookByID(c.UserContext(), uint(id))
+
+	if err := h.service.DeleteBook(c.UserContext(), uint(id)); err != nil {
+		if errors.Is(err, ErrBookUnavailable) {
+			return apierrors.ErrBookUnavailable.WithMessage("Only available books can be deleted")
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
 				"operation": "delete_book",
-				"book_id": id,
+				"book_id":   id,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("delete", "books", "error", time.Since(start))
+		return apierrors.ErrBookNotFound
+	}
+
+	if h.cache != nil {
+		h.cache.Delete("books:all")
+		h.cache.Delete(fmt.Sprintf("book:%d", id), coverPlaceholderKey(uint(id)))
+		if seriesID != 0 {
+			h.cache.Delete(seriesCacheKey(seriesID))
+		}
+		if existing != nil {
+			InvalidateAuthorCache(h.cache, existing.AuthorID)
+		}
+		clearFacets(h.cache)
+		h.metrics.RecordCacheOperation("delete", "success")
+	}
+
+	if h.log != nil {
+		h.log.LogDatabase("delete", "books", time.Since(start), 1)
+		h.log.LogBookOperation("delete", currentUsername(c), uint(id), "")
+	}
+	h.metrics.RecordDatabaseQuery("delete", "books", "success", time.Since(start))
+	h.Webhooks.Dispatch(c.UserContext(), webhook.EventBookDeleted, fiber.Map{"id": id})
+
+	return c.SendStatus(204)
+}
+
+// currentUsername is the username for audit logs, empty on routes without
+// middleware.InjectUser
+func currentUsername(c *fiber.Ctx) string {
+	if user, ok := middleware.CurrentUser(c); ok {
+		return user.GetUsername()
+	}
+	return ""
+}
+
+func seriesCacheKey(seriesID uint) string {
+	return fmt.Sprintf("series:%d:books", seriesID)
+}
+
+// InvalidateSeriesCache drops the cached book list and progress of a series
+func InvalidateSeriesCache(c cache.Cache, seriesID uint) {
+	if c == nil {
+		return
+	}
+	c.Delete(seriesCacheKey(seriesID))
+	invalidateSeriesProgress(c, seriesID)
+}
+
+// invalidateSeries drops the cached book list and progress of the series
+// bookID belongs to
+func (h *BookHandler) invalidateSeries(ctx context.Context, bookID uint) {
+	if h.cache == nil {
+		return
+	}
+	if seriesID, err := h.store.GetBookSeriesID(ctx, bookID); err == nil && seriesID != 0 {
+		InvalidateSeriesCache(h.cache, seriesID)
+	}
+}
+
+// InvalidateAuthorCache drops the cached book list of an author
+func InvalidateAuthorCache(c cache.Cache, authorID *uint) {
+	if c == nil || authorID == nil {
+		return
+	}
+	c.Delete(fmt.Sprintf("author:%d:books", *authorID))
+}
+
+func (h *BookHandler) getSeriesBooks(c *fiber.Ctx, seriesID uint, start time.Time) error {
+	cacheKey := seriesCacheKey(seriesID)
+
+	var books []Book
+	if h.cache != nil {
+		if err := h.cache.Get(cacheKey, &books); err == nil {
+			h.metrics.RecordCacheOperation("get", "hit")
+			if h.log != nil {
+				h.log.LogCache("get", cacheKey, true, time.Since(start))
+			}
+			return c.JSON(books)
+		}
+		h.metrics.RecordCacheOperation("get", "miss")
+	}
+
+	books, err := h.store.GetSeriesBooks(c.UserContext(), seriesID)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "get_series_books",
+				"series_id": seriesID,
+			})
+		}
+		h.metrics.RecordDatabaseQuery("select", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, books, 10*time.Minute)
+		h.metrics.RecordCacheOperation("set", "success")
+	}
+
+	if h.log != nil {
+		h.log.LogDatabase("select", "books", time.Since(start), int64(len(books)))
+	}
+	h.metrics.RecordDatabaseQuery("select", "books", "success", time.Since(start))
+
+	return c.JSON(books)
+}
+
+// GetSeriesList godoc
+// @Summary      List all series
+// @Tags         series
+// @Produce      json
+// @Success      200 {array} Series
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /series [get]
+func (h *BookHandler) GetSeriesList(c *fiber.Ctx) error {
+	series, err := h.store.GetAllSeries(c.UserContext())
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "get_series"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch series")
+	}
+	return c.JSON(series)
+}
+
+// CreateSeries godoc
+// @Summary      Create a series (admin only)
+// @Tags         series
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        series  body  Series  true  "Series to create"
+// @Success      201  {object} Series
+// @Failure      400  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /series [post]
+func (h *BookHandler) CreateSeries(c *fiber.Ctx) error {
+	var series Series
+	if err := c.BodyParser(&series); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if series.Name == "" {
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "name", Message: "is required"})
+	}
+
+	series.ID = 0
+	if err := h.store.CreateSeries(c.UserContext(), &series); err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "create_series",
+				"name":      series.Name,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to create series")
+	}
+
+	return c.Status(201).JSON(series)
+}
+
+// GetSeriesBooks godoc
+// @Summary      List the books in a series in sequence order
+// @Tags         series
+// @Produce      json
+// @Param        id   path  int  true  "Series ID"
+// @Success      200  {array} Book
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /series/{id}/books [get]
+func (h *BookHandler) GetSeriesBooks(c *fiber.Ctx) error {
+	start := time.Now()
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid series ID")
+	}
+
+	if _, err := h.store.GetSeriesByID(c.UserContext(), uint(id)); err != nil {
+		return apierrors.ErrSeriesNotFound
+	}
+
+	return h.getSeriesBooks(c, uint(id), start)
+}
+
+// AddSeriesBooks godoc
+// @Summary      Assign books to a series (admin only)
+// @Tags         series
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id     path  int                  true  "Series ID"
+// @Param        books  body  []SeriesBookRequest  true  "Books and their position in the series"
+// @Success      200  {array} Book
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /series/{id}/books [post]
+func (h *BookHandler) AddSeriesBooks(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid series ID")
+	}
+
+	var entries []SeriesBookRequest
+	if err := c.BodyParser(&entries); err != nil || len(entries) == 0 {
+		return apierrors.ErrInvalidRequestBody
+	}
+	for _, e := range entries {
+		if e.BookID == 0 || e.Sequence < 1 {
+			return apierrors.NewValidationError(apierrors.FieldError{Field: "sequence", Message: "each entry needs a book_id and a sequence of 1 or more"})
+		}
+	}
+
+	if _, err := h.store.GetSeriesByID(c.UserContext(), uint(id)); err != nil {
+		return apierrors.ErrSeriesNotFound
+	}
+
+	// Books moved from another series leave a stale list behind
+	for _, e := range entries {
+		h.invalidateSeries(c.UserContext(), e.BookID)
+	}
+
+	if err := h.store.SetSeriesBooks(c.UserContext(), uint(id), entries); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrBookNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "add_series_books",
+				"series_id": id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to update series")
+	}
+
+	if h.cache != nil {
+		InvalidateSeriesCache(h.cache, uint(id))
+		h.cache.Delete("books:all")
+		for _, e := range entries {
+			h.cache.Delete(fmt.Sprintf("book:%d", e.BookID))
+		}
+		h.metrics.RecordCacheOperation("delete", "success")
+	}
+
+	books, err := h.store.GetSeriesBooks(c.UserContext(), uint(id))
+	if err != nil {
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch books")
+	}
+	return c.JSON(books)
+}
+
+// addBookmark bookmarks a book and publishes new bookmarks to the activity
+// feed. It returns gorm.ErrRecordNotFound if the book doesn't exist.
+func (h *BookHandler) addBookmark(ctx context.Context, userID, bookID uint) error {
+	book, err := h.store.GetBookByID(ctx, bookID)
+	if err != nil {
+		return err
+	}
+	bookmark, err := h.store.AddBookmark(ctx, userID, bookID)
+	if err != nil || bookmark == nil {
+		return err
+	}
+
+	event := activity.BookEvent(activity.TypeBookmarkAdded, userID, bookID, book.Title, bookmark.CreatedAt)
+	event.SourceID = bookmark.ID
+	h.Activity.Publish(event)
+	return nil
+}
+
+func bookmarkCacheKey(userID, bookID uint) string {
+	return fmt.Sprintf("bookmark:%d:%d", userID, bookID)
+}
+
+// bookmarkState reports whether a user bookmarked a book, caching the answer
+func (h *BookHandler) bookmarkState(ctx context.Context, userID, bookID uint) (bool, error) {
+	cacheKey := bookmarkCacheKey(userID, bookID)
+	var bookmarked bool
+	if h.cache != nil && h.cache.Get(cacheKey, &bookmarked) == nil {
+		return bookmarked, nil
+	}
+
+	bookmarked, err := h.store.IsBookmarked(ctx, userID, bookID)
+	if err != nil {
+		return false, err
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, bookmarked, 5*time.Minute)
+	}
+	return bookmarked, nil
+}
+
+// AddBookmark godoc
+// @Summary      Bookmark a book
+// @Tags         bookmarks
+// @Produce      json
+// @Security     Bearer
+// @Param        id   path  int  true  "Book ID"
+// @Success      201  {object} map[string]interface{}
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/bookmark [post]
+func (h *BookHandler) AddBookmark(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	if err := h.addBookmark(c.UserContext(), userID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrBookNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "add_bookmark",
+				"book_id":   id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to bookmark book")
+	}
+
+	if h.cache != nil {
+		h.cache.Set(bookmarkCacheKey(userID, uint(id)), true, 5*time.Minute)
+	}
+
+	return c.Status(201).JSON(fiber.Map{"book_id": id, "bookmarked": true})
+}
+
+// RemoveBookmark godoc
+// @Summary      Remove a bookmark
+// @Tags         bookmarks
+// @Security     Bearer
+// @Param        id   path  int  true  "Book ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/bookmark [delete]
+func (h *BookHandler) RemoveBookmark(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	removed, err := h.store.RemoveBookmark(c.UserContext(), userID, uint(id))
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "remove_bookmark",
+				"book_id":   id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to remove bookmark")
+	}
+
+	if h.cache != nil {
+		h.cache.Set(bookmarkCacheKey(userID, uint(id)), false, 5*time.Minute)
+	}
+
+	if !removed {
+		return apierrors.ErrBookmarkNotFound
+	}
+	return c.SendStatus(204)
+}
+
+// GetMyBookmarks godoc
+// @Summary      List the current user's bookmarked books
+// @Tags         bookmarks
+// @Produce      json
+// @Security     Bearer
+// @Param        page   query int false "Page number" default(1)
+// @Param        limit  query int false "Page size" default(20)
+// @Success      200 {object} map[string]interface{}
+// @Header       200 {integer} X-Total-Count "Total number of items"
+// @Header       200 {integer} X-Page "Current page"
+// @Header       200 {integer} X-Limit "Page size"
+// @Header       200 {integer} X-Pages "Number of pages"
+// @Header       200 {string} Link "First, previous, next and last pages (RFC 5988)"
+// @Failure      401 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /me/bookmarks [get]
+func (h *BookHandler) GetMyBookmarks(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	books, total, err := h.store.ListBookmarkedBooks(c.UserContext(), userID, page, limit)
+	if err == nil {
+		err = h.store.AttachDetails(c.UserContext(), books)
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "list_bookmarks",
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch bookmarks")
+	}
+
+	middleware.SetPagination(c, page, limit, total)
+	return c.JSON(fiber.Map{
+		"books": books,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetPopularBookmarks godoc
+// @Summary      Top 20 most bookmarked books (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {array} PopularBook
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/stats/popular-bookmarks [get]
+func (h *BookHandler) GetPopularBookmarks(c *fiber.Ctx) error {
+	books, err := h.store.GetPopularBookmarks(c.UserContext(), 20)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "popular_bookmarks"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch popular bookmarks")
+	}
+	return c.JSON(books)
+}
+
+// GetNewBooks godoc
+// @Summary      Books added recently
+// @Description  Returns the books added in the last days days, newest first.
+// @Tags         books
+// @Produce      json
+// @Param        days  query int false "How many days back to look" default(7) minimum(1) maximum(365)
+// @Param        limit query int false "Maximum number of books" default(20) minimum(1) maximum(100)
+// @Success      200 {array} Book
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /books/new [get]
+func (h *BookHandler) GetNewBooks(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 7)
+	if days < 1 || days > 365 {
+		return apierrors.ErrInvalidQuery.WithMessage("days must be between 1 and 365")
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	books, err := h.store.GetNewBooks(c.UserContext(), time.Now().AddDate(0, 0, -days), limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "new_books", "days": days})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch new books")
+	}
+	return c.JSON(books)
+}
+
+// GetPopularBooks godoc
+// @Summary      Most viewed books this week
+// @Description  Ranks books by the views they got in the current ISO week.
+// @Tags         books
+// @Produce      json
+// @Param        period query string false "Ranking period" Enums(week) default(week)
+// @Param        limit  query int    false "Maximum number of books" default(10) minimum(1) maximum(100)
+// @Success      200 {array} TrendingBook
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /books/popular [get]
+func (h *BookHandler) GetPopularBooks(c *fiber.Ctx) error {
+	if period := c.Query("period", "week"); period != "week" {
+		return apierrors.ErrInvalidQuery.WithMessage("period must be week")
+	}
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	books, err := h.GetPopularThisWeek(c.UserContext(), limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "popular_books"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch popular books")
+	}
+	return c.JSON(books)
+}
+
+// recordSearch adds a search to the history of the signed-in user. Repeating
+// the same query within 5 minutes is only logged once.
+func (h *BookHandler) recordSearch(c *fiber.Ctx, query string, resultCount int) {
+	if query == "" {
+		return
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return
+	}
+
+	if h.cache != nil {
+		dedupKey := fmt.Sprintf("search:dedup:%d:%s", userID, strings.ToLower(query))
+		if first, err := h.cache.SetNX(dedupKey, 1, 5*time.Minute); err == nil && !first {
+			return
+		}
+	}
+
+	entry := SearchHistory{UserID: userID, Query: query, ResultCount: resultCount, SearchedAt: time.Now()}
+	if err := h.store.AddSearchHistory(c.UserContext(), &entry); err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "record_search",
+				"user_id":   userID,
+			})
+		}
+		return
+	}
+	h.Activity.Publish(activity.Event{
+		Type:      activity.TypeSearchPerformed,
+		UserID:    userID,
+		Query:     &entry.Query,
+		Timestamp: entry.SearchedAt,
+		SourceID:  entry.ID,
+	})
+}
+
+// GetMySearchHistory godoc
+// @Summary      List the current user's recent searches
+// @Tags         search-history
+// @Produce      json
+// @Security     Bearer
+// @Param        limit  query int false "Number of searches" default(20)
+// @Success      200 {array} SearchHistory
+// @Failure      401 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /me/search-history [get]
+func (h *BookHandler) GetMySearchHistory(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	history, err := h.store.ListSearchHistory(c.UserContext(), userID, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "list_search_history",
+				"user_id":   userID,
 			})
 		}
-		metrics.RecordDatabaseQuery("delete", "books", "error", time.Since(start))
-		return c.Status(404).JSON(fiber.Map{"error": "Book not found"})
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch search history")
+	}
+
+	return c.JSON(history)
+}
+
+// ClearMySearchHistory godoc
+// @Summary      Delete all or one of the current user's searches
+// @Tags         search-history
+// @Security     Bearer
+// @Param        id   path  int  false  "Search history entry ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /me/search-history [delete]
+// @Router       /me/search-history/{id} [delete]
+func (h *BookHandler) ClearMySearchHistory(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
 	}
 
-	if Cache != nil {
-		Cache.Delete("books:all")
-		Cache.Delete(fmt.Sprintf("book:%d", id))
-		metrics.RecordCacheOperation("delete", "success")
+	var id uint64
+	if idStr := c.Params("id"); idStr != "" {
+		var err error
+		if id, err = strconv.ParseUint(idStr, 10, 32); err != nil || id == 0 {
+			return apierrors.ErrInvalidID.WithMessage("Invalid search history ID")
+		}
 	}
 
-	if Log != nil {
-		Log.LogDatabase("delete", "books", time.Since(start), 1)
-		Log.LogBookOperation("delete", "", uint(id), "")
+	deleted, err := h.store.DeleteSearchHistory(c.UserContext(), userID, uint(id))
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "delete_search_history",
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to delete search history")
+	}
+	if id != 0 && deleted == 0 {
+		return apierrors.ErrSearchHistoryNotFound
 	}
-	metrics.RecordDatabaseQuery("delete", "books", "success", time.Since(start))
 
 	return c.SendStatus(204)
 }
+
+// parsePeriod accepts a number of days ("7d") or a Go duration ("36h")
+func parsePeriod(period string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(period, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid period %q", period)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period %q", period)
+	}
+	return d, nil
+}
+
+// GetPopularSearches godoc
+// @Summary      Most common search queries across users (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Param        period  query string false "Look-back window, e.g. 7d or 24h" default(7d)
+// @Success      200 {object} map[string]interface{}
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/searches/popular [get]
+func (h *BookHandler) GetPopularSearches(c *fiber.Ctx) error {
+	period := c.Query("period", "7d")
+	window, err := parsePeriod(period)
+	if err != nil {
+		return apierrors.ErrInvalidQuery.WithMessage(err.Error())
+	}
+
+	searches, err := h.store.GetPopularSearches(c.UserContext(), time.Now().Add(-window), 20)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "popular_searches"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch popular searches")
+	}
+
+	return c.JSON(fiber.Map{
+		"period":   period,
+		"searches": searches,
+	})
+}
+
+// GetBookHistory godoc
+// @Summary      List the changes made to a book
+// @Description  Every field changed by an update, with who changed it and when, most recent first
+// @Tags         books
+// @Produce      json
+// @Security     Bearer
+// @Param        id     path  int true  "Book ID"
+// @Param        page   query int false "Page number" default(1)
+// @Param        limit  query int false "Page size" default(20)
+// @Success      200 {object} map[string]interface{}
+// @Header       200 {integer} X-Total-Count "Total number of items"
+// @Header       200 {integer} X-Page "Current page"
+// @Header       200 {integer} X-Limit "Page size"
+// @Header       200 {integer} X-Pages "Number of pages"
+// @Header       200 {string} Link "First, previous, next and last pages (RFC 5988)"
+// @Failure      400 {object} apierrors.APIError
+// @Failure      401 {object} apierrors.APIError
+// @Failure      404 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /books/{id}/history [get]
+func (h *BookHandler) GetBookHistory(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	if _, err := h.store.GetBookByID(c.UserContext(), uint(id)); err != nil {
+		return apierrors.ErrBookNotFound
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	changes, total, err := h.store.ListBookChanges(c.UserContext(), uint(id), page, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "list_book_changes",
+				"book_id":   id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch book history")
+	}
+
+	middleware.SetPagination(c, page, limit, total)
+	return c.JSON(fiber.Map{
+		"changes": changes,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
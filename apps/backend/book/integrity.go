@@ -0,0 +1,187 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cache integrity scan limits
+const (
+	DefaultIntegrityScanLimit = 10000
+	MaxIntegrityScanLimit     = 100000
+)
+
+// integrityBatchSize is the number of book IDs looked up per query
+const integrityBatchSize = 500
+
+var errNoCache = errors.New("cache not configured")
+
+// IntegrityReport lists cached book keys whose book no longer exists
+type IntegrityReport struct {
+	OrphanedKeys  []string `json:"orphaned_keys"`
+	TotalScanned  int      `json:"total_scanned" example:"1500"`
+	OrphanedCount int      `json:"orphaned_count" example:"2"`
+	// Complete is false when the scan stopped at the limit
+	Complete bool `json:"complete"`
+	// DeletedCount is only set when the orphaned keys were removed
+	DeletedCount int `json:"deleted_count,omitempty"`
+}
+
+// bookIDFromKey returns the book ID at the end of a book:* key, e.g. 42 for
+// book:42 and book:views:42
+func bookIDFromKey(key string) (uint, bool) {
+	id, err := strconv.ParseUint(key[strings.LastIndex(key, ":")+1:], 10, 32)
+	return uint(id), err == nil && id > 0
+}
+
+// ExistingBookIDs returns the ids of books that exist, not counting
+// soft-deleted ones
+func (s dbStore) ExistingBookIDs(ctx context.Context, ids []uint) ([]uint, error) {
+	var existing []uint
+	if err := s.conn(ctx).Model(&Book{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// checkCacheIntegrity scans up to limit book:* keys and reports those whose
+// book was deleted, including soft-deleted books, which are no longer
+// served. Keys are scanned with SCAN and checked against the database in
+// batches.
+func (h *BookHandler) checkCacheIntegrity(ctx context.Context, limit int) (*IntegrityReport, error) {
+	if h.cache == nil {
+		return nil, errNoCache
+	}
+
+	keys, complete, err := h.cache.Scan("book:*", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	keysByID := make(map[uint][]string)
+	for _, key := range keys {
+		if id, ok := bookIDFromKey(key); ok {
+			keysByID[id] = append(keysByID[id], key)
+		}
+	}
+	ids := make([]uint, 0, len(keysByID))
+	for id := range keysByID {
+		ids = append(ids, id)
+	}
+
+	report := &IntegrityReport{OrphanedKeys: []string{}, TotalScanned: len(keys), Complete: complete}
+	for start := 0; start < len(ids); start += integrityBatchSize {
+		batch := ids[start:min(start+integrityBatchSize, len(ids))]
+		existing, err := h.store.ExistingBookIDs(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		found := make(map[uint]bool, len(existing))
+		for _, id := range existing {
+			found[id] = true
+		}
+		for _, id := range batch {
+			if !found[id] {
+				report.OrphanedKeys = append(report.OrphanedKeys, keysByID[id]...)
+			}
+		}
+	}
+	report.OrphanedCount = len(report.OrphanedKeys)
+	return report, nil
+}
+
+// fixCacheIntegrity runs checkCacheIntegrity and deletes the orphaned keys
+func (h *BookHandler) fixCacheIntegrity(ctx context.Context, limit int) (*IntegrityReport, error) {
+	report, err := h.checkCacheIntegrity(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(report.OrphanedKeys); start += integrityBatchSize {
+		batch := report.OrphanedKeys[start:min(start+integrityBatchSize, len(report.OrphanedKeys))]
+		if err := h.cache.Delete(batch...); err != nil {
+			return nil, err
+		}
+		report.DeletedCount += len(batch)
+	}
+	return report, nil
+}
+
+// integrityScanLimit reads the limit query parameter
+func integrityScanLimit(c *fiber.Ctx) (int, error) {
+	limit := c.QueryInt("limit", DefaultIntegrityScanLimit)
+	if limit < 1 || limit > MaxIntegrityScanLimit {
+		return 0, apierrors.ErrInvalidQuery.WithMessage("limit must be between 1 and " + strconv.Itoa(MaxIntegrityScanLimit))
+	}
+	return limit, nil
+}
+
+func (h *BookHandler) runCacheIntegrity(c *fiber.Ctx, operation string, run func(context.Context, int) (*IntegrityReport, error)) error {
+	limit, err := integrityScanLimit(c)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	report, err := run(c.UserContext(), limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": operation})
+		}
+		return apierrors.ErrInternal.WithMessage("Failed to check cache integrity")
+	}
+
+	if h.log != nil {
+		h.log.Info("Cache integrity check finished", map[string]interface{}{
+			"operation":      operation,
+			"duration_ms":    time.Since(start).Milliseconds(),
+			"total_scanned":  report.TotalScanned,
+			"orphaned_count": report.OrphanedCount,
+			"deleted_count":  report.DeletedCount,
+			"complete":       report.Complete,
+		})
+	}
+	return c.JSON(report)
+}
+
+// CheckCacheIntegrity godoc
+// @Summary      Find orphaned book cache keys
+// @Description  Scans book:* keys in Redis with SCAN and lists those whose book no longer exists. The scan stops after limit keys; complete is false when it did.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Param        limit query int false "Maximum number of keys to scan" default(10000) maximum(100000)
+// @Success      200  {object} IntegrityReport
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/cache/integrity [get]
+func (h *BookHandler) CheckCacheIntegrity(c *fiber.Ctx) error {
+	return h.runCacheIntegrity(c, "check_cache_integrity", h.checkCacheIntegrity)
+}
+
+// FixCacheIntegrity godoc
+// @Summary      Delete orphaned book cache keys
+// @Description  Runs the integrity check and deletes the orphaned keys it finds.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Param        limit query int false "Maximum number of keys to scan" default(10000) maximum(100000)
+// @Success      200  {object} IntegrityReport
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/cache/integrity/fix [post]
+func (h *BookHandler) FixCacheIntegrity(c *fiber.Ctx) error {
+	return h.runCacheIntegrity(c, "fix_cache_integrity", h.fixCacheIntegrity)
+}
@@ -0,0 +1,342 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBookUnavailable = errors.New("book is not available")
+	ErrLoanReturned    = errors.New("loan already returned")
+)
+
+// lockBook loads a book for update so concurrent status changes queue up
+func lockBook(tx *gorm.DB, id uint) (*Book, error) {
+	var book Book
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// CheckoutBook lends an available book to userID and marks it checked out.
+// Books in any other status fail with ErrBookUnavailable. It also returns
+// the book.
+func (s dbStore) CheckoutBook(ctx context.Context, bookID, userID uint) (*Loan, *Book, error) {
+	var loan *Loan
+	var book *Book
+	err := s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if book, err = lockBook(tx, bookID); err != nil {
+			return err
+		}
+		if book.Status != StatusAvailable {
+			return ErrBookUnavailable
+		}
+		if err := tx.Model(book).Update("status", StatusCheckedOut).Error; err != nil {
+			return err
+		}
+
+		loan = &Loan{BookID: bookID, UserID: userID, CheckedOutAt: time.Now()}
+		return tx.Create(loan).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return loan, book, nil
+}
+
+// ReturnLoan closes a loan and makes its book available again. Loans that
+// were already returned fail with ErrLoanReturned. It also returns the
+// loan's book.
+func (s dbStore) ReturnLoan(ctx context.Context, loanID uint) (*Loan, *Book, error) {
+	var loan Loan
+	var book *Book
+	err := s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&loan, loanID).Error; err != nil {
+			return err
+		}
+		if loan.ReturnedAt != nil {
+			return ErrLoanReturned
+		}
+
+		var err error
+		if book, err = lockBook(tx, loan.BookID); err != nil {
+			return err
+		}
+		if err := tx.Model(book).Update("status", StatusAvailable).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		loan.ReturnedAt = &now
+		return tx.Model(&loan).Update("returned_at", now).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &loan, book, nil
+}
+
+func loanEvent(eventType string, loan *Loan, title string, at time.Time) activity.Event {
+	event := activity.BookEvent(eventType, loan.UserID, loan.BookID, title, at)
+	event.SourceID = loan.ID
+	return event
+}
+
+// GetLoanByID returns a loan
+func (s dbStore) GetLoanByID(ctx context.Context, id uint) (*Loan, error) {
+	var loan Loan
+	if err := s.conn(ctx).First(&loan, id).Error; err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// SetBookStatus sets a book's status regardless of its loans
+func (s dbStore) SetBookStatus(ctx context.Context, id uint, status string) (*Book, error) {
+	var book *Book
+	err := s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if book, err = lockBook(tx, id); err != nil {
+			return err
+		}
+		return tx.Model(book).Update("status", status).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// CountBooksByStatus returns the number of books in each status, including
+// statuses without books
+func (s dbStore) CountBooksByStatus(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := s.conn(ctx).Model(&Book{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(Statuses))
+	for _, status := range Statuses {
+		counts[status] = 0
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// StartBookStatusReporter updates the books_by_status metric now and then
+// every interval until ctx is done
+func (h *BookHandler) StartBookStatusReporter(ctx context.Context, interval time.Duration) {
+	report := func() {
+		counts, err := h.store.CountBooksByStatus(ctx)
+		if err != nil {
+			if h.log != nil {
+				h.log.LogError(err, map[string]interface{}{"operation": "report_books_by_status"})
+			}
+			return
+		}
+		h.metrics.SetBooksByStatus(counts)
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		report()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+}
+
+// invalidateBookStatus drops the cached copies of a book whose status changed
+func (h *BookHandler) invalidateBookStatus(ctx context.Context, book *Book) {
+	if h.cache == nil {
+		return
+	}
+	h.cache.Delete("books:all")
+	h.cache.Delete(fmt.Sprintf("book:%d", book.ID))
+	h.invalidateSeries(ctx, book.ID)
+	InvalidateAuthorCache(h.cache, book.AuthorID)
+	h.metrics.RecordCacheOperation("delete", "success")
+}
+
+// CheckoutBook godoc
+// @Summary      Check out a book
+// @Description  Lends an available book to the authenticated user and marks it checked_out.
+// @Tags         loans
+// @Produce      json
+// @Security     Bearer
+// @Param        id   path  int  true  "Book ID"
+// @Success      201  {object} Loan
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError "The book is not available"
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/checkout [post]
+func (h *BookHandler) CheckoutBook(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	loan, book, err := h.store.CheckoutBook(WithEditor(c.UserContext(), userID), uint(id), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return apierrors.ErrBookNotFound
+		case errors.Is(err, ErrBookUnavailable):
+			return apierrors.ErrBookUnavailable.WithMessage("Only available books can be checked out")
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "checkout_book",
+				"book_id":   id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to check out book")
+	}
+
+	h.invalidateBookStatus(c.UserContext(), book)
+	h.Activity.Publish(loanEvent(activity.TypeBookBorrowed, loan, book.Title, loan.CheckedOutAt))
+	return c.Status(fiber.StatusCreated).JSON(loan)
+}
+
+// ReturnLoan godoc
+// @Summary      Return a borrowed book
+// @Description  Closes the loan and makes the book available again. Only the borrower or an admin can return a loan.
+// @Tags         loans
+// @Produce      json
+// @Security     Bearer
+// @Param        id   path  int  true  "Loan ID"
+// @Success      200  {object} Loan
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError "The loan was already returned"
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /loans/{id}/return [put]
+func (h *BookHandler) ReturnLoan(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid loan ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	existing, err := h.store.GetLoanByID(c.UserContext(), uint(id))
+	// Other users' loans are reported as missing rather than forbidden
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && existing.UserID != userID && !middleware.IsAdmin(c)) {
+		return apierrors.ErrLoanNotFound
+	}
+
+	var loan *Loan
+	var book *Book
+	if err == nil {
+		loan, book, err = h.store.ReturnLoan(WithEditor(c.UserContext(), userID), uint(id))
+	}
+	if err != nil {
+		if errors.Is(err, ErrLoanReturned) {
+			return apierrors.ErrLoanReturned
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "return_loan",
+				"loan_id":   id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to return loan")
+	}
+
+	h.invalidateBookStatus(c.UserContext(), book)
+	h.Activity.Publish(loanEvent(activity.TypeBookReturned, loan, book.Title, *loan.ReturnedAt))
+	return c.JSON(loan)
+}
+
+// SetBookStatus godoc
+// @Summary      Set a book's status
+// @Description  Manual override of a book's availability, e.g. to mark it lost. Open loans are left as they are.
+// @Tags         books
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id      path  int            true  "Book ID"
+// @Param        status  body  StatusRequest  true  "New status"
+// @Success      200  {object} Book
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/status [put]
+func (h *BookHandler) SetBookStatus(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+
+	var req StatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	ctx := c.UserContext()
+	if userID, ok := middleware.UserID(c); ok {
+		ctx = WithEditor(ctx, userID)
+	}
+	book, err := h.store.SetBookStatus(ctx, uint(id), req.Status)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrBookNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "set_book_status",
+				"book_id":   id,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to update book status")
+	}
+
+	h.invalidateBookStatus(c.UserContext(), book)
+	if h.log != nil {
+		h.log.LogBookOperation("set_status", currentUsername(c), book.ID, book.Title)
+	}
+	return c.JSON(book)
+}
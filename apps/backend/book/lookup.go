@@ -0,0 +1,114 @@
+package book
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/external/googlebooks"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GoogleBooks looks up metadata for POST /books/lookup. Set in main.
+var GoogleBooks *googlebooks.Client
+
+const lookupCacheTTL = 24 * time.Hour
+
+// LookupRequest asks for the metadata of a book by ISBN
+type LookupRequest struct {
+	ISBN string `json:"isbn" validate:"required,isbn" example:"978-0-452-28423-4"`
+}
+
+// BookLookup is a book pre-filled from Google Books. The embedded Book can
+// be reviewed and sent to POST /books as is; the other fields are extra
+// metadata this API doesn't store.
+type BookLookup struct {
+	Book
+	Description string   `json:"description,omitempty"`
+	PageCount   int      `json:"page_count,omitempty"`
+	Categories  []string `json:"categories,omitempty"`
+	Thumbnail   string   `json:"thumbnail,omitempty"`
+}
+
+func newBookLookup(isbn string, meta *googlebooks.BookMetadata) BookLookup {
+	lookup := BookLookup{
+		Book: Book{
+			Title:  meta.Title,
+			Author: strings.Join(meta.Authors, ", "),
+			Year:   meta.Year(),
+			ISBN:   isbn,
+		},
+		Description: meta.Description,
+		PageCount:   meta.PageCount,
+		Categories:  meta.Categories,
+		Thumbnail:   meta.Thumbnail,
+	}
+	if len(meta.Categories) > 0 {
+		lookup.Genre = meta.Categories[0]
+	}
+	return lookup
+}
+
+func lookupCacheKey(isbn string) string {
+	return "books:lookup:" + googlebooks.NormalizeISBN(isbn)
+}
+
+// LookupBook godoc
+// @Summary      Look up book metadata by ISBN
+// @Description  Fetches title, authors, year and more from Google Books. Nothing is saved; review the result and send it to POST /books. Results are cached for 24 hours.
+// @Tags         books
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body LookupRequest true "ISBN-10 or ISBN-13, hyphens allowed"
+// @Success      200  {object} BookLookup
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      502  {object} apierrors.APIError
+// @Router       /books/lookup [post]
+func (h *BookHandler) LookupBook(c *fiber.Ctx) error {
+	var req LookupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+	isbn := strings.TrimSpace(req.ISBN)
+	cacheKey := lookupCacheKey(isbn)
+
+	var meta googlebooks.BookMetadata
+	if h.cache != nil && h.cache.Get(cacheKey, &meta) == nil {
+		h.metrics.RecordCacheOperation("get", "hit")
+		return c.JSON(newBookLookup(isbn, &meta))
+	}
+	h.metrics.RecordCacheOperation("get", "miss")
+
+	client := GoogleBooks
+	if client == nil {
+		client = googlebooks.NewClient("")
+	}
+	found, err := client.LookupByISBN(c.UserContext(), isbn)
+	if err != nil {
+		if errors.Is(err, googlebooks.ErrNotFound) {
+			return apierrors.ErrBookMetadataNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "lookup_book",
+				"isbn":      isbn,
+			})
+		}
+		return apierrors.ErrUpstream.WithMessage("Google Books lookup failed")
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, found, lookupCacheTTL)
+		h.metrics.RecordCacheOperation("set", "success")
+	}
+	return c.JSON(newBookLookup(isbn, found))
+}
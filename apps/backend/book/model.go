@@ -1,19 +1,408 @@
 package book
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/AtillaTahaK/gobooklibrary/auth"
 	"gorm.io/gorm"
 )
 
+// Book availability statuses
+const (
+	StatusAvailable  = "available"
+	StatusReserved   = "reserved"
+	StatusCheckedOut = "checked_out"
+	StatusLost       = "lost"
+)
+
+// Statuses lists every book status
+var Statuses = []string{StatusAvailable, StatusReserved, StatusCheckedOut, StatusLost}
+
+// IsStatus reports whether status is a book status
+func IsStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 type Book struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Title     string         `json:"title" gorm:"not null" validate:"required"`
-	Author    string         `json:"author" gorm:"not null" validate:"required"`
-	Year      int            `json:"year" gorm:"not null" validate:"required"`
-	Genre     string         `json:"genre"`
-	ISBN      string         `json:"isbn" gorm:"uniqueIndex"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	ID        uint           `json:"id" xml:"id" gorm:"primaryKey"`
+	Title     string         `json:"title" xml:"title" gorm:"not null" validate:"required"`
+	Author    string         `json:"author" xml:"author" gorm:"not null" validate:"required"`
+	AuthorID  *uint          `json:"author_id,omitempty" xml:"author_id,omitempty" gorm:"index"`
+	Year      int            `json:"year" xml:"year" gorm:"not null" validate:"required,book_year"`
+	Genre     string         `json:"genre" xml:"genre"`
+	GenreID   *uint          `json:"genre_id,omitempty" xml:"genre_id,omitempty" gorm:"index" example:"5"`
+	ISBN      string         `json:"isbn" xml:"isbn" gorm:"uniqueIndex" validate:"omitempty,isbn"`
+	CoverURL  string         `json:"cover_url,omitempty" xml:"cover_url,omitempty" validate:"omitempty,http_url" example:"https://covers.openlibrary.org/b/isbn/9780441013593-L.jpg"`
+	ViewCount int64          `json:"view_count" xml:"view_count" gorm:"not null;default:0;index"`
+	Status    string         `json:"status" xml:"status" gorm:"type:varchar(20);not null;default:available;index" example:"available"`
+	CreatedAt time.Time      `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" xml:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" xml:"-" gorm:"index"`
+	Series    *BookSeries    `json:"series,omitempty" xml:"series,omitempty" gorm:"-"`
+	// Version counts the book's updates. Clients send the version they read
+	// with PUT /books/:id, which fails if the book changed since.
+	Version int `json:"version" xml:"version" gorm:"not null;default:1" example:"3"`
+	// SyncStatus is set by catalog syncs: synced while the book is in the
+	// catalog, unlisted once a sync leaves it out. Empty for books never synced.
+	SyncStatus string `json:"sync_status,omitempty" xml:"sync_status,omitempty" gorm:"type:varchar(20);index" example:"synced"`
+	// CreatedByUserID and UpdatedByUserID are the users who added and last
+	// edited the book. They are nil for books from imports and seeds, and
+	// become nil when the user is deleted.
+	CreatedByUserID *uint      `json:"created_by_user_id,omitempty" xml:"created_by_user_id,omitempty" gorm:"index" example:"5"`
+	UpdatedByUserID *uint      `json:"updated_by_user_id,omitempty" xml:"updated_by_user_id,omitempty" gorm:"index" example:"5"`
+	CreatedBy       *auth.User `json:"-" xml:"-" gorm:"foreignKey:CreatedByUserID;constraint:OnDelete:SET NULL"`
+	UpdatedBy       *auth.User `json:"-" xml:"-" gorm:"foreignKey:UpdatedByUserID;constraint:OnDelete:SET NULL"`
+	// CreatedByUsername and UpdatedByUsername are filled in by
+	// AttachAttribution
+	CreatedByUsername string `json:"created_by_username,omitempty" xml:"created_by_username,omitempty" gorm:"-" example:"admin"`
+	UpdatedByUsername string `json:"updated_by_username,omitempty" xml:"updated_by_username,omitempty" gorm:"-" example:"admin"`
+}
+
+// BeforeCreate links the book to the author record with the same name,
+// creating the author if this is their first book, and to its genre
+func (b *Book) BeforeCreate(tx *gorm.DB) error {
+	session := tx.Session(&gorm.Session{NewDB: true})
+	name := strings.TrimSpace(b.Author)
+	if b.AuthorID != nil || name == "" {
+		return b.linkGenre(session)
+	}
+
+	err := session.Exec("INSERT INTO authors (name, created_at, updated_at) VALUES (?, NOW(), NOW()) ON CONFLICT (name) DO NOTHING", name).Error
+	if err != nil {
+		return err
+	}
+
+	var authorID uint
+	if err := session.Raw("SELECT id FROM authors WHERE name = ?", name).Scan(&authorID).Error; err != nil {
+		return err
+	}
+	if authorID != 0 {
+		b.AuthorID = &authorID
+	}
+	return b.linkGenre(session)
+}
+
+// Genre is a book genre. Its slug is derived from the name, so genres
+// that differ only in case, spacing or punctuation are the same genre.
+type Genre struct {
+	ID          uint      `json:"id" gorm:"primaryKey" example:"5"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null" example:"Science Fiction"`
+	Slug        string    `json:"slug" gorm:"uniqueIndex;not null" example:"science-fiction"`
+	Description string    `json:"description" example:"Speculative stories about science and technology"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GenreCount is a genre with the number of its books
+type GenreCount struct {
+	Genre
+	BookCount int64 `json:"book_count" example:"42"`
+}
+
+// Loan records a user borrowing a book. It is open until ReturnedAt is set.
+type Loan struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	BookID       uint       `json:"book_id" gorm:"not null;index"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	CheckedOutAt time.Time  `json:"checked_out_at" gorm:"not null"`
+	ReturnedAt   *time.Time `json:"returned_at,omitempty"`
+}
+
+// StatusRequest sets a book's status
+type StatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=available reserved checked_out lost" example:"lost"`
+}
+
+// BookDetail is a single book together with its view statistics
+type BookDetail struct {
+	Book
+	Views          int64 `json:"views"`
+	UniqueVisitors int64 `json:"unique_visitors"`
+	// Bookmarked is only set for authenticated requests
+	Bookmarked *bool `json:"bookmarked,omitempty"`
+}
+
+// Bookmark records that a user saved a book
+type Bookmark struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_bookmarks_user_book"`
+	BookID    uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_bookmarks_user_book;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PopularBook is a book with the number of users who bookmarked it
+type PopularBook struct {
+	Book
+	BookmarkCount int64 `json:"bookmark_count"`
+}
+
+// TrendingBook is a book with the number of times it was viewed this week
+type TrendingBook struct {
+	Book
+	WeeklyViews int64 `json:"weekly_views"`
+}
+
+// ScoredBook is a search result with its relevance to the query
+type ScoredBook struct {
+	Book
+	Score float64 `json:"score" example:"5"`
+}
+
+// Rating is a user's score for a book from 1 to 5. Users rate a book once;
+// rating it again replaces the score.
+type Rating struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_ratings_user_book"`
+	BookID    uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_ratings_user_book;index"`
+	Score     int       `json:"score" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the rating's user is deleted
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
+
+// RatingRequest is the body of PUT /books/:id/rating
+type RatingRequest struct {
+	Score int `json:"score" validate:"required,min=1,max=5" example:"4"`
+}
+
+// Reading statuses a user can set on a book
+const (
+	ReadingWantToRead = "want_to_read"
+	ReadingInProgress = "in_progress"
+	ReadingFinished   = "finished"
+)
+
+// ReadingStatus is where a user is with a book. Each user has at most one
+// per book.
+type ReadingStatus struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_reading_statuses_user_book"`
+	BookID    uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_reading_statuses_user_book;index"`
+	Status    string    `json:"status" gorm:"type:varchar(20);not null" example:"in_progress"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReadingStatusRequest is the body of PUT /books/:id/reading-status
+type ReadingStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=want_to_read in_progress finished" example:"finished"`
+}
+
+// DefaultAnnotationColor is the color of annotations created without one.
+// Annotations are yellow, green, blue, pink or purple.
+const DefaultAnnotationColor = "yellow"
+
+// Annotation is a passage of a book a user highlighted, with an optional
+// note. Annotations are private: only their author sees them. PassageStart
+// and PassageEnd are character offsets into the book's text, kept for
+// rendering the highlight.
+type Annotation struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	BookID       uint      `json:"book_id" gorm:"not null;index:idx_annotations_user_book,priority:2"`
+	UserID       uint      `json:"user_id" gorm:"not null;index:idx_annotations_user_book,priority:1"`
+	PassageStart int       `json:"passage_start" gorm:"not null" example:"1024"`
+	PassageEnd   int       `json:"passage_end" gorm:"not null" example:"1180"`
+	PassageText  string    `json:"passage_text" gorm:"type:text;not null" example:"Fear is the mind-killer."`
+	Note         string    `json:"note" gorm:"type:text" example:"Important: the litany against fear"`
+	Color        string    `json:"color" gorm:"type:varchar(20);not null" example:"yellow"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AnnotationRequest is the body of POST /books/:id/annotations
+type AnnotationRequest struct {
+	PassageStart int    `json:"passage_start" validate:"min=0" example:"1024"`
+	PassageEnd   int    `json:"passage_end" validate:"min=1" example:"1180"`
+	PassageText  string `json:"passage_text" validate:"required,max=5000" example:"Fear is the mind-killer."`
+	Note         string `json:"note" validate:"max=5000" example:"Important: the litany against fear"`
+	Color        string `json:"color" validate:"omitempty,oneof=yellow green blue pink purple" example:"yellow"`
+}
+
+// UpdateAnnotationRequest is the body of PUT /annotations/:id. Omitted
+// fields are kept.
+type UpdateAnnotationRequest struct {
+	PassageStart *int    `json:"passage_start" validate:"omitempty,min=0" example:"1024"`
+	PassageEnd   *int    `json:"passage_end" validate:"omitempty,min=1" example:"1180"`
+	PassageText  *string `json:"passage_text" validate:"omitempty,min=1,max=5000" example:"Fear is the mind-killer."`
+	Note         *string `json:"note" validate:"omitempty,max=5000" example:"Re-read before the exam"`
+	Color        *string `json:"color" validate:"omitempty,oneof=yellow green blue pink purple" example:"green"`
+}
+
+// AnnotationPage is a page of a user's annotations
+type AnnotationPage struct {
+	Annotations []Annotation `json:"annotations"`
+	Total       int64        `json:"total" example:"42"`
+	Page        int          `json:"page" example:"1"`
+	Limit       int          `json:"limit" example:"20"`
+}
+
+// SeriesProgress is how much of a series a user has read
+type SeriesProgress struct {
+	SeriesID          uint    `json:"series_id" example:"2"`
+	SeriesName        string  `json:"series_name" example:"The Expanse"`
+	TotalBooks        int64   `json:"total_books" example:"3"`
+	FinishedBooks     int64   `json:"finished_books" example:"2"`
+	InProgressBooks   int64   `json:"in_progress_books" example:"1"`
+	CompletionPercent float64 `json:"completion_percent" example:"66.7"`
+}
+
+// RankedBook is a book's place on the ratings leaderboard. Books with the
+// same average and number of ratings share a rank.
+type RankedBook struct {
+	Book
+	Rank        int64   `json:"rank" example:"1"`
+	AvgRating   float64 `json:"avg_rating" example:"4.6"`
+	RatingCount int64   `json:"rating_count" example:"12"`
+}
+
+// Series groups books that are meant to be read in order
+type Series struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null" validate:"required"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SeriesEntry places a book in a series. A book belongs to at most one series.
+type SeriesEntry struct {
+	BookID         uint `json:"book_id" gorm:"primaryKey;autoIncrement:false"`
+	SeriesID       uint `json:"series_id" gorm:"not null;index"`
+	SequenceNumber int  `json:"sequence_number" gorm:"not null"`
+}
+
+// BookSeries is the series information embedded in a serialized book
+type BookSeries struct {
+	ID             uint   `json:"id" xml:"id"`
+	Name           string `json:"name" xml:"name"`
+	SequenceNumber int    `json:"sequence_number" xml:"sequence_number"`
+}
+
+type SeriesBookRequest struct {
+	BookID   uint `json:"book_id"`
+	Sequence int  `json:"sequence"`
+}
+
+// SearchHistory is a search run by an authenticated user
+type SearchHistory struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"-" gorm:"not null;index:idx_search_history_user_time"`
+	Query       string    `json:"query" gorm:"not null"`
+	ResultCount int       `json:"result_count"`
+	SearchedAt  time.Time `json:"searched_at" gorm:"not null;index:idx_search_history_user_time;index"`
+}
+
+func (SearchHistory) TableName() string {
+	return "search_history"
+}
+
+// PopularSearch is a query aggregated across users
+type PopularSearch struct {
+	Query    string `json:"query"`
+	Searches int64  `json:"searches"`
+	Users    int64  `json:"users"`
+}
+
+// FacetValue is the number of matching books with one value of a facet
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// FacetedBooks is a book listing with facet counts for building filters
+type FacetedBooks struct {
+	Books  []Book                  `json:"books"`
+	Facets map[string][]FacetValue `json:"facets"`
+}
+
+// Catalog sync statuses of a book
+const (
+	SyncStatusSynced   = "synced"
+	SyncStatusUnlisted = "unlisted"
+)
+
+// SyncBook is a book in the catalog sent to POST /admin/books/sync
+type SyncBook struct {
+	Title    string `json:"title" validate:"required" example:"Dune"`
+	Author   string `json:"author" validate:"required" example:"Frank Herbert"`
+	Year     int    `json:"year" validate:"required,book_year" example:"1965"`
+	Genre    string `json:"genre" example:"Science Fiction"`
+	ISBN     string `json:"isbn" validate:"required,isbn" example:"978-0-441-01359-3"`
+	CoverURL string `json:"cover_url" validate:"omitempty,http_url"`
+}
+
+// SyncError is a book of a sync that couldn't be stored
+type SyncError struct {
+	// Index is the book's position in the request
+	Index int    `json:"index" example:"3"`
+	ISBN  string `json:"isbn,omitempty" example:"978-0-441-01359-3"`
+	Error string `json:"error" example:"year must be between 1450 and 2027"`
+}
+
+// SyncErrors is a []SyncError stored as a jsonb array
+type SyncErrors []SyncError
+
+func (e SyncErrors) Value() (driver.Value, error) {
+	if e == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]SyncError(e))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (e *SyncErrors) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	}
+	return fmt.Errorf("cannot scan %T into SyncErrors", value)
+}
+
+// SyncHistory is the outcome of a catalog sync
+type SyncHistory struct {
+	ID         string     `json:"sync_id" gorm:"primaryKey;size:36"`
+	Created    int        `json:"created"`
+	Updated    int        `json:"updated"`
+	Unchanged  int        `json:"unchanged"`
+	Unlisted   int        `json:"unlisted"`
+	Errors     SyncErrors `json:"errors" gorm:"type:jsonb;not null;default:'[]'"`
+	UserID     *uint      `json:"user_id,omitempty" gorm:"index"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at" gorm:"index"`
+}
+
+func (SyncHistory) TableName() string {
+	return "sync_history"
+}
+
+// SyncCounts are the books a sync created, updated and found unchanged
+type SyncCounts struct {
+	Created   int `json:"created" example:"10"`
+	Updated   int `json:"updated" example:"5"`
+	Unchanged int `json:"unchanged" example:"185"`
+}
+
+// SyncResult is the response of POST /admin/books/sync
+type SyncResult struct {
+	SyncID   string     `json:"sync_id" example:"6f1c2a1e-3f4b-4b7e-9d1a-2c5e8f0a7b3d"`
+	Upserted SyncCounts `json:"upserted"`
+	Unlisted int        `json:"unlisted" example:"2"`
+	Errors   SyncErrors `json:"errors"`
+}
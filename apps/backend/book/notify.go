@@ -0,0 +1,39 @@
+package book
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"gorm.io/gorm"
+)
+
+// NotifyChanges announces every saved or deleted book on db.NotifyChannel,
+// with the book ID as payload, so instances that don't share this cache can
+// drop their copies with HandleChangeNotification
+var NotifyChanges bool
+
+// notifyChange announces a book write from a hook. The notification is part
+// of the writing transaction, so it is only sent if the write commits.
+func notifyChange(tx *gorm.DB, id uint) error {
+	if !NotifyChanges || id == 0 {
+		return nil
+	}
+	return db.Notify(tx.Session(&gorm.Session{NewDB: true}), strconv.FormatUint(uint64(id), 10))
+}
+
+// AfterDelete announces a deleted book
+func (b *Book) AfterDelete(tx *gorm.DB) error {
+	return notifyChange(tx, b.ID)
+}
+
+// HandleChangeNotification drops the cached copies of the book named by a
+// change notification
+func (h *BookHandler) HandleChangeNotification(payload string) {
+	id, err := strconv.ParseUint(payload, 10, 32)
+	if err != nil || h.cache == nil {
+		return
+	}
+	h.cache.Delete(fmt.Sprintf("book:%d", id), "books:all")
+	clearFacets(h.cache)
+}
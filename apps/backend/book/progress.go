@@ -0,0 +1,268 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeriesProgressTTL is how long a user's progress through a series is
+// cached. Setting a reading status or changing the books of the series drops
+// it; deleted books age out.
+const SeriesProgressTTL = 5 * time.Minute
+
+// seriesProgress counts the books of each series and how many of them a user
+// has finished or is reading. The placeholder is the user ID; the verbs are
+// the WHERE condition and an optional HAVING clause.
+const seriesProgress = `SELECT series.id AS series_id, series.name AS series_name,
+	COUNT(books.id) AS total_books,
+	COUNT(books.id) FILTER (WHERE reading_statuses.status = 'finished') AS finished_books,
+	COUNT(books.id) FILTER (WHERE reading_statuses.status = 'in_progress') AS in_progress_books
+FROM series
+LEFT JOIN series_entries ON series_entries.series_id = series.id
+LEFT JOIN books ON books.id = series_entries.book_id AND books.deleted_at IS NULL
+LEFT JOIN reading_statuses ON reading_statuses.book_id = books.id AND reading_statuses.user_id = ?
+WHERE %s
+GROUP BY series.id, series.name
+%s
+ORDER BY series.name, series.id`
+
+func seriesProgressKey(seriesID, userID uint) string {
+	return fmt.Sprintf("series:%d:progress:%d", seriesID, userID)
+}
+
+// SetReadingStatus sets where a user is with a book, replacing an earlier
+// status
+func (s dbStore) SetReadingStatus(ctx context.Context, userID, bookID uint, status string) (*ReadingStatus, error) {
+	if _, err := s.GetBookByID(ctx, bookID); err != nil {
+		return nil, err
+	}
+
+	reading := ReadingStatus{UserID: userID, BookID: bookID, Status: status}
+	err := s.conn(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "book_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "updated_at"}),
+	}).Create(&reading).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// setReadingStatus is the store's SetReadingStatus, dropping the user's
+// cached progress through the book's series
+func (h *BookHandler) setReadingStatus(ctx context.Context, userID, bookID uint, status string) (*ReadingStatus, error) {
+	reading, err := h.store.SetReadingStatus(ctx, userID, bookID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cache != nil {
+		if seriesID, err := h.store.GetBookSeriesID(ctx, bookID); err == nil && seriesID != 0 {
+			h.cache.Delete(seriesProgressKey(seriesID, userID))
+		}
+	}
+	return reading, nil
+}
+
+// invalidateSeriesProgress drops every user's cached progress through a
+// series
+func invalidateSeriesProgress(c cache.Cache, seriesID uint) {
+	if c == nil {
+		return
+	}
+	if keys, err := c.Keys(fmt.Sprintf("series:%d:progress:*", seriesID)); err == nil && len(keys) > 0 {
+		c.Delete(keys...)
+	}
+}
+
+// GetSeriesProgress returns how much of a series a user has read. It returns
+// gorm.ErrRecordNotFound if the series doesn't exist.
+func (s dbStore) GetSeriesProgress(ctx context.Context, seriesID, userID uint) (*SeriesProgress, error) {
+	var rows []SeriesProgress
+	query := fmt.Sprintf(seriesProgress, "series.id = ?", "")
+	if err := s.conn(ctx).Raw(query, userID, seriesID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	progress := rows[0]
+	progress.CompletionPercent = completionPercent(progress.FinishedBooks, progress.TotalBooks)
+	return &progress, nil
+}
+
+// SeriesProgress is the store's GetSeriesProgress, cached for
+// SeriesProgressTTL
+func (h *BookHandler) SeriesProgress(ctx context.Context, seriesID, userID uint) (*SeriesProgress, error) {
+	key := seriesProgressKey(seriesID, userID)
+	if h.cache != nil {
+		var cached SeriesProgress
+		if err := h.cache.Get(key, &cached); err == nil {
+			return &cached, nil
+		}
+	}
+
+	progress, err := h.store.GetSeriesProgress(ctx, seriesID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cache != nil {
+		h.cache.Set(key, progress, SeriesProgressTTL)
+	}
+	return progress, nil
+}
+
+// ListSeriesInProgress returns the series a user has finished some but not
+// all books of
+func (s dbStore) ListSeriesInProgress(ctx context.Context, userID uint) ([]SeriesProgress, error) {
+	query := fmt.Sprintf(seriesProgress,
+		"EXISTS (SELECT 1 FROM reading_statuses rs JOIN series_entries se ON se.book_id = rs.book_id WHERE se.series_id = series.id AND rs.user_id = ?)",
+		"HAVING COUNT(books.id) FILTER (WHERE reading_statuses.status = 'finished') BETWEEN 1 AND COUNT(books.id) - 1")
+
+	progress := []SeriesProgress{}
+	if err := s.conn(ctx).Raw(query, userID, userID).Scan(&progress).Error; err != nil {
+		return nil, err
+	}
+	for i := range progress {
+		progress[i].CompletionPercent = completionPercent(progress[i].FinishedBooks, progress[i].TotalBooks)
+	}
+	return progress, nil
+}
+
+// completionPercent is finished out of total, rounded to one decimal
+func completionPercent(finished, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(finished)*1000/float64(total)) / 10
+}
+
+// SetReadingStatus godoc
+// @Summary      Set my reading status of a book
+// @Description  Marks the book as want_to_read, in_progress or finished for the signed-in user, replacing an earlier status.
+// @Tags         books
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id      path  int                   true  "Book ID"
+// @Param        status  body  ReadingStatusRequest  true  "Reading status"
+// @Success      200  {object} ReadingStatus
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/reading-status [put]
+func (h *BookHandler) SetReadingStatus(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	var req ReadingStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	reading, err := h.setReadingStatus(c.UserContext(), userID, uint(id), req.Status)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrBookNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "set_reading_status",
+				"book_id":   id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to set reading status")
+	}
+	return c.JSON(reading)
+}
+
+// GetSeriesProgress godoc
+// @Summary      My progress through a series
+// @Description  Counts the books of the series the signed-in user has finished or is reading.
+// @Tags         series
+// @Produce      json
+// @Security     Bearer
+// @Param        id   path  int  true  "Series ID"
+// @Success      200  {object} SeriesProgress
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /series/{id}/progress [get]
+func (h *BookHandler) GetSeriesProgress(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid series ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	progress, err := h.SeriesProgress(c.UserContext(), uint(id), userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrSeriesNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "series_progress",
+				"series_id": id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch series progress")
+	}
+	return c.JSON(progress)
+}
+
+// GetMySeriesInProgress godoc
+// @Summary      Series I'm partway through
+// @Description  Lists the series the signed-in user has finished at least one, but not every, book of.
+// @Tags         series
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {array} SeriesProgress
+// @Failure      401  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /me/series/in-progress [get]
+func (h *BookHandler) GetMySeriesInProgress(c *fiber.Ctx) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	progress, err := h.store.ListSeriesInProgress(c.UserContext(), userID)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "list_series_in_progress", "user_id": userID})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch series progress")
+	}
+	return c.JSON(progress)
+}
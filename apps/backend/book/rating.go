@@ -0,0 +1,311 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Leaderboard defaults
+const (
+	DefaultLeaderboardMinRatings = 5
+	// LeaderboardTTL is how long a leaderboard is cached. Rating a book drops
+	// the cached leaderboards; edited and deleted books age out.
+	LeaderboardTTL = 10 * time.Minute
+	// topRatedPerGenre is how many books per genre books_top_rated exports
+	topRatedPerGenre = 10
+)
+
+// rankedRatings ranks books by average score, then by number of ratings.
+// The placeholders are the genre (twice; empty for all genres), the minimum
+// number of ratings and the limit.
+const rankedRatings = `SELECT book_id, avg_rating, rating_count, rank FROM (
+	SELECT ratings.book_id, AVG(ratings.score) AS avg_rating, COUNT(*) AS rating_count,
+		RANK() OVER (ORDER BY AVG(ratings.score) DESC, COUNT(*) DESC) AS rank
+	FROM ratings
+	JOIN books ON books.id = ratings.book_id AND books.deleted_at IS NULL
+	WHERE ratings.deleted_at IS NULL AND (? = '' OR books.genre = ?)
+	GROUP BY ratings.book_id
+	HAVING COUNT(*) >= ?
+) ranked
+ORDER BY rank, book_id
+LIMIT ?`
+
+// topRatedByGenre ranks books within each genre for books_top_rated
+const topRatedByGenre = `SELECT genre, avg_rating, rank FROM (
+	SELECT books.genre, AVG(ratings.score) AS avg_rating,
+		RANK() OVER (PARTITION BY books.genre ORDER BY AVG(ratings.score) DESC, COUNT(*) DESC) AS rank
+	FROM ratings
+	JOIN books ON books.id = ratings.book_id AND books.deleted_at IS NULL
+	WHERE ratings.deleted_at IS NULL AND books.genre <> ''
+	GROUP BY ratings.book_id, books.genre
+	HAVING COUNT(*) >= ?
+) ranked
+WHERE rank <= ?`
+
+func leaderboardKey(genre string, minRatings, limit int) string {
+	return fmt.Sprintf("books:leaderboard:%s:%d:%d", genre, minRatings, limit)
+}
+
+// RateBook sets a user's score for a book, replacing an earlier one
+func (s dbStore) RateBook(ctx context.Context, userID, bookID uint, score int) (*Rating, error) {
+	rating := Rating{UserID: userID, BookID: bookID, Score: score}
+	err := s.conn(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "book_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"score", "updated_at"}),
+	}).Create(&rating).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rating, nil
+}
+
+// rateBook records a user's score for a book and publishes it to the
+// activity feed
+func (h *BookHandler) rateBook(ctx context.Context, userID, bookID uint, score int) (*Rating, error) {
+	book, err := h.store.GetBookByID(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	rating, err := h.store.RateBook(ctx, userID, bookID, score)
+	if err != nil {
+		return nil, err
+	}
+	h.invalidateLeaderboards()
+
+	event := activity.BookEvent(activity.TypeBookRated, userID, bookID, book.Title, rating.UpdatedAt)
+	event.Score = &rating.Score
+	event.SourceID = rating.ID
+	h.Activity.Publish(event)
+	return rating, nil
+}
+
+// invalidateLeaderboards drops all cached leaderboards
+func (h *BookHandler) invalidateLeaderboards() {
+	if h.cache == nil {
+		return
+	}
+	if keys, err := h.cache.Keys("books:leaderboard:*"); err == nil && len(keys) > 0 {
+		h.cache.Delete(keys...)
+	}
+}
+
+// GetLeaderboard returns the limit best rated books with at least minRatings
+// ratings, in genre or across all genres if genre is empty
+func (s dbStore) GetLeaderboard(ctx context.Context, genre string, minRatings, limit int) ([]RankedBook, error) {
+	var rows []struct {
+		BookID      uint
+		AvgRating   float64
+		RatingCount int64
+		Rank        int64
+	}
+	if err := s.conn(ctx).Raw(rankedRatings, genre, genre, minRatings, limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	leaderboard := make([]RankedBook, 0, len(rows))
+	if len(rows) > 0 {
+		ids := make([]uint, len(rows))
+		for i, row := range rows {
+			ids[i] = row.BookID
+		}
+		var books []Book
+		if err := s.conn(ctx).Where("id IN ?", ids).Find(&books).Error; err != nil {
+			return nil, err
+		}
+		byID := make(map[uint]Book, len(books))
+		for _, b := range books {
+			byID[b.ID] = b
+		}
+		for _, row := range rows {
+			if b, ok := byID[row.BookID]; ok {
+				leaderboard = append(leaderboard, RankedBook{Book: b, Rank: row.Rank, AvgRating: row.AvgRating, RatingCount: row.RatingCount})
+			}
+		}
+	}
+	return leaderboard, nil
+}
+
+// Leaderboard is the store's GetLeaderboard, cached for LeaderboardTTL
+func (h *BookHandler) Leaderboard(ctx context.Context, genre string, minRatings, limit int) ([]RankedBook, error) {
+	key := leaderboardKey(genre, minRatings, limit)
+	if h.cache != nil {
+		var cached []RankedBook
+		if err := h.cache.Get(key, &cached); err == nil {
+			return cached, nil
+		}
+	}
+
+	leaderboard, err := h.store.GetLeaderboard(ctx, genre, minRatings, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cache != nil {
+		h.cache.Set(key, leaderboard, LeaderboardTTL)
+	}
+	return leaderboard, nil
+}
+
+// TopRatedByGenre returns the average rating of the best rated books of each
+// genre by rank, counting books with at least minRatings ratings
+func (s dbStore) TopRatedByGenre(ctx context.Context, minRatings, perGenre int) (map[string]map[int64]float64, error) {
+	var rows []struct {
+		Genre     string
+		AvgRating float64
+		Rank      int64
+	}
+	if err := s.conn(ctx).Raw(topRatedByGenre, minRatings, perGenre).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	top := map[string]map[int64]float64{}
+	for _, row := range rows {
+		if top[row.Genre] == nil {
+			top[row.Genre] = map[int64]float64{}
+		}
+		top[row.Genre][row.Rank] = row.AvgRating
+	}
+	return top, nil
+}
+
+// StartLeaderboardReporter updates the books_top_rated metric now and then
+// every interval until ctx is done
+func (h *BookHandler) StartLeaderboardReporter(ctx context.Context, interval time.Duration) {
+	report := func() {
+		top, err := h.store.TopRatedByGenre(ctx, DefaultLeaderboardMinRatings, topRatedPerGenre)
+		if err != nil {
+			if h.log != nil {
+				h.log.LogError(err, map[string]interface{}{"operation": "report_top_rated_books"})
+			}
+			return
+		}
+		h.metrics.SetTopRated(top)
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		report()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+}
+
+// RateBook godoc
+// @Summary      Rate a book
+// @Description  Sets the signed-in user's score for the book from 1 to 5, replacing an earlier one.
+// @Tags         books
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id      path  int            true  "Book ID"
+// @Param        rating  body  RatingRequest  true  "Score"
+// @Success      200  {object} Rating
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/{id}/rating [put]
+func (h *BookHandler) RateBook(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid book ID")
+	}
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+	var req RatingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	rating, err := h.rateBook(c.UserContext(), userID, uint(id), req.Score)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrBookNotFound
+		}
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "rate_book",
+				"book_id":   id,
+				"user_id":   userID,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to rate book")
+	}
+	return c.JSON(rating)
+}
+
+// GetLeaderboard godoc
+// @Summary      Best rated books in a genre
+// @Description  Ranks books by average rating, then by number of ratings. Books with the same average and count share a rank. Without genre, all genres are ranked together.
+// @Tags         books
+// @Produce      json
+// @Param        genre        query string false "Genre, matched exactly"
+// @Param        limit        query int    false "Maximum number of books" default(10) minimum(1) maximum(100)
+// @Param        min_ratings  query int    false "Minimum number of ratings" default(5) minimum(1)
+// @Success      200 {array} RankedBook
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /books/leaderboard [get]
+func (h *BookHandler) GetLeaderboard(c *fiber.Ctx) error {
+	return h.sendLeaderboard(c, c.Query("genre"), 10)
+}
+
+// GetAllTimeLeaderboard godoc
+// @Summary      Best rated books of all genres
+// @Description  Ranks books of every genre by average rating, then by number of ratings.
+// @Tags         books
+// @Produce      json
+// @Param        limit        query int false "Maximum number of books" default(20) minimum(1) maximum(100)
+// @Param        min_ratings  query int false "Minimum number of ratings" default(5) minimum(1)
+// @Success      200 {array} RankedBook
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /books/leaderboard/all-time [get]
+func (h *BookHandler) GetAllTimeLeaderboard(c *fiber.Ctx) error {
+	return h.sendLeaderboard(c, "", 20)
+}
+
+func (h *BookHandler) sendLeaderboard(c *fiber.Ctx, genre string, defaultLimit int) error {
+	limit := c.QueryInt("limit", defaultLimit)
+	if limit < 1 || limit > 100 {
+		limit = defaultLimit
+	}
+	minRatings := c.QueryInt("min_ratings", DefaultLeaderboardMinRatings)
+	if minRatings < 1 {
+		return apierrors.ErrInvalidQuery.WithMessage("min_ratings must be at least 1")
+	}
+
+	books, err := h.Leaderboard(c.UserContext(), genre, minRatings, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "leaderboard", "genre": genre})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch the leaderboard")
+	}
+	return c.JSON(books)
+}
@@ -0,0 +1,262 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReindexBatchSize is the width of the ID range rebuilt per UPDATE
+const ReindexBatchSize = 500
+
+// Reindex statuses
+const (
+	ReindexRunning   = "running"
+	ReindexCompleted = "completed"
+	ReindexCancelled = "cancelled"
+	ReindexFailed    = "failed"
+)
+
+const (
+	reindexProgressKey = "reindex:progress"
+	reindexProgressTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrReindexRunning    = errors.New("reindex already running")
+	ErrReindexNotRunning = errors.New("no reindex running")
+	ErrNoReindex         = errors.New("no reindex has run")
+)
+
+// ReindexProgress is the state of the last search vector reindex
+type ReindexProgress struct {
+	Processed  int64      `json:"processed" example:"1500"`
+	Total      int64      `json:"total" example:"12000"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Status     string     `json:"status" example:"running"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ReindexBounds returns the lowest and highest book ID and the number of
+// books, including soft-deleted ones, which the reindex also rebuilds
+func (s dbStore) ReindexBounds(ctx context.Context) (minID, maxID uint, total int64, err error) {
+	var bounds struct {
+		MinID uint
+		MaxID uint
+		Total int64
+	}
+	err = s.conn(ctx).
+		Raw("SELECT COALESCE(MIN(id), 0) AS min_id, COALESCE(MAX(id), 0) AS max_id, COUNT(*) AS total FROM books").
+		Scan(&bounds).Error
+	return bounds.MinID, bounds.MaxID, bounds.Total, err
+}
+
+// ReindexBatch rebuilds the search vector of the books with IDs in
+// [fromID, toID] and returns how many it updated
+func (s dbStore) ReindexBatch(ctx context.Context, fromID, toID uint) (int64, error) {
+	result := s.conn(ctx).Exec(
+		"UPDATE books SET search_vector = "+SearchVectorSQL+", search_vector_updated_at = updated_at WHERE id BETWEEN ? AND ?",
+		fromID, toID)
+	return result.RowsAffected, result.Error
+}
+
+// reindexState holds the cancel function of the reindex a handler is running
+type reindexState struct {
+	sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// BeginReindex rebuilds every book's search vector in the background,
+// ReindexBatchSize IDs at a time, recording progress in the cache after each
+// batch. Only one reindex runs per handler. ctx only carries values such as
+// the trace; the job isn't cancelled with it.
+func (h *BookHandler) BeginReindex(ctx context.Context) (*ReindexProgress, error) {
+	h.reindex.Lock()
+	defer h.reindex.Unlock()
+	if h.reindex.cancel != nil {
+		return nil, ErrReindexRunning
+	}
+
+	minID, maxID, total, err := h.store.ReindexBounds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &ReindexProgress{Total: total, StartedAt: time.Now().UTC(), Status: ReindexRunning}
+	h.saveReindexProgress(progress)
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	h.reindex.cancel, h.reindex.done = cancel, done
+	go func(progress ReindexProgress) {
+		defer close(done)
+		h.runReindex(ctx, &progress, minID, maxID)
+
+		h.reindex.Lock()
+		h.reindex.cancel, h.reindex.done = nil, nil
+		h.reindex.Unlock()
+		cancel()
+	}(*progress)
+
+	return progress, nil
+}
+
+// StopReindex stops the running reindex after its current batch and waits
+// for it to record its progress
+func (h *BookHandler) StopReindex() error {
+	h.reindex.Lock()
+	cancel, done := h.reindex.cancel, h.reindex.done
+	h.reindex.Unlock()
+	if cancel == nil {
+		return ErrReindexNotRunning
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+// GetReindexProgress returns the progress of the last reindex, which is kept
+// for a week after it last changed
+func (h *BookHandler) GetReindexProgress() (*ReindexProgress, error) {
+	if h.cache == nil {
+		return nil, ErrNoReindex
+	}
+	var progress ReindexProgress
+	if err := h.cache.Get(reindexProgressKey, &progress); err != nil {
+		return nil, ErrNoReindex
+	}
+	return &progress, nil
+}
+
+func (h *BookHandler) runReindex(ctx context.Context, progress *ReindexProgress, minID, maxID uint) {
+	var err error
+	if maxID > 0 {
+		for from := minID; from <= maxID; from += ReindexBatchSize {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			var updated int64
+			updated, err = h.store.ReindexBatch(ctx, from, from+ReindexBatchSize-1)
+			if err != nil {
+				break
+			}
+			progress.Processed += updated
+			h.metrics.RecordReindexProcessed(updated)
+			h.saveReindexProgress(progress)
+		}
+	}
+
+	finished := time.Now().UTC()
+	progress.FinishedAt = &finished
+	switch {
+	case ctx.Err() != nil:
+		progress.Status = ReindexCancelled
+	case err != nil:
+		progress.Status = ReindexFailed
+		progress.Error = err.Error()
+	default:
+		progress.Status = ReindexCompleted
+	}
+	h.saveReindexProgress(progress)
+
+	duration := finished.Sub(progress.StartedAt)
+	h.metrics.RecordReindexDuration(progress.Status, duration)
+	if h.log != nil {
+		fields := map[string]interface{}{
+			"processed": progress.Processed,
+			"total":     progress.Total,
+			"status":    progress.Status,
+			"duration":  duration.String(),
+		}
+		if progress.Status == ReindexFailed {
+			fields["error"] = progress.Error
+			h.log.Error("Search vector reindex failed", fields)
+		} else {
+			h.log.Info("Search vector reindex finished", fields)
+		}
+	}
+}
+
+func (h *BookHandler) saveReindexProgress(progress *ReindexProgress) {
+	if h.cache == nil {
+		return
+	}
+	if err := h.cache.Set(reindexProgressKey, progress, reindexProgressTTL); err != nil && h.log != nil {
+		h.log.LogError(err, map[string]interface{}{"operation": "save_reindex_progress"})
+	}
+}
+
+// StartReindex godoc
+// @Summary      Rebuild the full-text search vectors (admin only)
+// @Description  Rebuilds search_vector for every book in the background, 500 IDs per batch. Poll /admin/books/reindex/status for progress.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      202  {object} ReindexProgress
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/books/reindex [post]
+func (h *BookHandler) StartReindex(c *fiber.Ctx) error {
+	progress, err := h.BeginReindex(c.UserContext())
+	if errors.Is(err, ErrReindexRunning) {
+		return apierrors.ErrReindexRunning
+	}
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "start_reindex"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to start reindex")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(progress)
+}
+
+// GetReindexStatus godoc
+// @Summary      Get the progress of the last search vector reindex (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} ReindexProgress
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/books/reindex/status [get]
+func (h *BookHandler) GetReindexStatus(c *fiber.Ctx) error {
+	progress, err := h.GetReindexProgress()
+	if err != nil {
+		return apierrors.ErrJobNotFound.WithMessage("No reindex has run")
+	}
+	return c.JSON(progress)
+}
+
+// CancelReindex godoc
+// @Summary      Cancel the running search vector reindex (admin only)
+// @Description  Stops the reindex after its current batch. Books already processed keep their new search vector.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} ReindexProgress
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/books/reindex [delete]
+func (h *BookHandler) CancelReindex(c *fiber.Ctx) error {
+	if err := h.StopReindex(); err != nil {
+		return apierrors.ErrJobNotFound.WithMessage("No reindex is running")
+	}
+	progress, err := h.GetReindexProgress()
+	if err != nil {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	return c.JSON(progress)
+}
@@ -0,0 +1,70 @@
+package book
+
+import (
+	"sort"
+	"strings"
+)
+
+// Points a search result gets for each field containing the query
+const (
+	TitleMatchScore  = 3
+	AuthorMatchScore = 2
+	GenreMatchScore  = 1
+)
+
+// Search result orders of GET /books?search=
+const (
+	SortRelevance = "relevance"
+	SortCreatedAt = "created_at"
+)
+
+// RelevanceScore adds up the points of the fields of b containing query,
+// ignoring case the way ILIKE does
+func RelevanceScore(b Book, query string) float64 {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return 0
+	}
+	var score float64
+	if strings.Contains(strings.ToLower(b.Title), query) {
+		score += TitleMatchScore
+	}
+	if strings.Contains(strings.ToLower(b.Author), query) {
+		score += AuthorMatchScore
+	}
+	if strings.Contains(strings.ToLower(b.Genre), query) {
+		score += GenreMatchScore
+	}
+	return score
+}
+
+// RankResults scores books against query and orders them best first.
+// Scoring in Go rather than SQL keeps the order the same whichever query
+// found the books; books with the same score are ordered by ID.
+func RankResults(books []Book, query string) []ScoredBook {
+	ranked := make([]ScoredBook, len(books))
+	for i, b := range books {
+		ranked[i] = ScoredBook{Book: b, Score: RelevanceScore(b, query)}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked
+}
+
+// sortByCreatedAt orders books by when they were added, newest first when
+// dir is desc
+func sortByCreatedAt(books []Book, dir string) {
+	sort.SliceStable(books, func(i, j int) bool {
+		if !books[i].CreatedAt.Equal(books[j].CreatedAt) {
+			if dir == "desc" {
+				return books[i].CreatedAt.After(books[j].CreatedAt)
+			}
+			return books[i].CreatedAt.Before(books[j].CreatedAt)
+		}
+		return books[i].ID < books[j].ID
+	})
+}
@@ -0,0 +1,72 @@
+package book
+
+import (
+	"context"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// SearchVectorSQL builds the full-text search document of a book from its
+// title and author
+const SearchVectorSQL = "to_tsvector('english', coalesce(title, '') || ' ' || coalesce(author, ''))"
+
+// searchVectorRetryDelays are the waits before retrying an update that found
+// no book. That happens when it runs before the transaction that created the
+// book commits; books still missed are picked up by the nightly sync.
+var searchVectorRetryDelays = []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second}
+
+// indexSlots bounds the background updates running at once, so bulk imports
+// don't take every pooled connection from requests
+var indexSlots = make(chan struct{}, 4)
+
+// UpdateSearchVector rebuilds the search vector of one book on conn and
+// reports whether the book was found
+var UpdateSearchVector = func(ctx context.Context, conn *gorm.DB, id uint) (bool, error) {
+	result := conn.WithContext(ctx).Exec(
+		"UPDATE books SET search_vector = "+SearchVectorSQL+", search_vector_updated_at = updated_at WHERE id = ?", id)
+	return result.RowsAffected > 0, result.Error
+}
+
+// AfterSave indexes a created or updated book in the background so it is
+// searchable within seconds, and announces the change when NotifyChanges is
+// set. The index update runs on its own connection from the pool rather
+// than in tx, so saving doesn't wait for it.
+func (b *Book) AfterSave(tx *gorm.DB) error {
+	if b.ID == 0 {
+		return nil
+	}
+	go indexBook(poolSession(tx), hookLogger(tx), b.ID)
+	return notifyChange(tx, b.ID)
+}
+
+// poolSession returns a session on the connection pool tx was opened from,
+// outside any transaction tx is part of
+func poolSession(tx *gorm.DB) *gorm.DB {
+	conn := tx.Session(&gorm.Session{NewDB: true, Context: context.Background()})
+	conn.Statement.ConnPool = tx.ConnPool
+	return conn
+}
+
+func indexBook(conn *gorm.DB, log *logger.Logger, id uint) {
+	indexSlots <- struct{}{}
+	defer func() { <-indexSlots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		found, err := UpdateSearchVector(ctx, conn, id)
+		if err != nil {
+			if log != nil {
+				log.LogError(err, map[string]interface{}{"operation": "update_search_vector", "book_id": id})
+			}
+			return
+		}
+		if found || attempt == len(searchVectorRetryDelays) {
+			return
+		}
+		time.Sleep(searchVectorRetryDelays[attempt])
+	}
+}
@@ -0,0 +1,117 @@
+package book
+
+import (
+	"context"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+)
+
+// Service writes books under the rules every transport shares, so the HTTP
+// handlers and the gRPC server can't drift apart. Broken rules are returned
+// as *apierrors.APIError; other errors come from the store. Caches, logs of
+// successful writes and webhooks stay with the transports.
+type Service struct {
+	store Store
+	log   *logger.Logger
+}
+
+// NewService returns a Service writing books through store. log may be nil.
+func NewService(store Store, log *logger.Logger) *Service {
+	return &Service{store: store, log: log}
+}
+
+// GetBook returns the book with id
+func (s *Service) GetBook(ctx context.Context, id uint) (*Book, error) {
+	return s.store.GetBookByID(ctx, id)
+}
+
+// ListBooks returns all books, or those matching search
+func (s *Service) ListBooks(ctx context.Context, search string) ([]Book, error) {
+	if search != "" {
+		return s.store.SearchBooks(ctx, search)
+	}
+	return s.store.GetAllBooks(ctx)
+}
+
+// GetBookSeriesID returns the ID of the series the book with id belongs to,
+// or 0 if it isn't in one
+func (s *Service) GetBookSeriesID(ctx context.Context, id uint) (uint, error) {
+	return s.store.GetBookSeriesID(ctx, id)
+}
+
+// AddBook validates b and adds it. Fields only the server sets are reset,
+// and unless force is set a title close to an existing one fails with
+// ErrPotentialDuplicate.
+func (s *Service) AddBook(ctx context.Context, b *Book, force bool) error {
+	if errs := validator.ValidateStruct(b); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+	b.ViewCount = 0
+	// New books are available until checked out or changed by an admin
+	b.Status = StatusAvailable
+	// Attribution comes from the context, never from the input
+	b.CreatedByUserID, b.UpdatedByUserID = nil, nil
+	// Every book starts at version 1
+	b.Version = 0
+	// Only catalog syncs set the sync status
+	b.SyncStatus = ""
+
+	if !force {
+		candidates, err := s.store.FindDuplicates(ctx, b.Title)
+		if err != nil {
+			// A failed check doesn't stop the book from being added
+			if s.log != nil {
+				s.log.LogError(err, map[string]interface{}{
+					"operation": "find_duplicates",
+					"title":     b.Title,
+				})
+			}
+		} else if len(candidates) > 0 {
+			return apierrors.ErrPotentialDuplicate.WithDetails(dedup.Details{Candidates: candidates})
+		}
+	}
+
+	if err := s.store.CreateBook(ctx, b); err != nil {
+		if invalid := genreError(err); invalid != nil {
+			return invalid
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateBook validates the fields of changes that are set and applies them
+// to the book with id. Fields only the server sets are ignored. Changes
+// based on an older version fail with *VersionConflictError.
+func (s *Service) UpdateBook(ctx context.Context, id uint, changes *Book) (*Book, error) {
+	// Omitted fields keep their current value, so only check the ones sent
+	if errs := validator.ValidatePartial(changes); len(errs) > 0 {
+		return nil, apierrors.NewValidationError(errs...)
+	}
+
+	// view_count is only written by FlushViewCounts, status by loans and
+	// the admin status override, sync_status by catalog syncs, and
+	// attribution from the context
+	changes.ViewCount = 0
+	changes.Status = ""
+	changes.SyncStatus = ""
+	changes.CreatedByUserID = nil
+
+	updated, err := s.store.UpdateBook(ctx, id, changes)
+	if err != nil {
+		if invalid := genreError(err); invalid != nil {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteBook deletes the book with id if it is available, failing with
+// ErrBookUnavailable otherwise
+func (s *Service) DeleteBook(ctx context.Context, id uint) error {
+	return s.store.DeleteBook(ctx, id)
+}
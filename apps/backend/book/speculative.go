@@ -0,0 +1,57 @@
+package book
+
+import (
+	"context"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// FetchBooksSpeculative reads cacheKey from cache and runs load at the same
+// time, so a cache miss doesn't pay for the cache round trip before the
+// query starts. A cache hit cancels the query; otherwise the query's result
+// is used. hit reports whether the books came from the cache.
+func FetchBooksSpeculative(ctx context.Context, cache cache.Cache, load func(context.Context, string) ([]Book, error), cacheKey, search string) (books []Book, hit bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each channel is closed without a value when its source has nothing
+	cached := make(chan []Book, 1)
+	loaded := make(chan []Book, 1)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(cached)
+		var books []Book
+		if cache.Get(cacheKey, &books) == nil {
+			cached <- books
+		}
+		return nil
+	})
+	g.Go(func() error {
+		defer close(loaded)
+		books, err := load(gctx, search)
+		if err != nil {
+			return err
+		}
+		loaded <- books
+		return nil
+	})
+
+	for cached != nil || loaded != nil {
+		select {
+		case books, ok := <-cached:
+			if ok {
+				return books, true, nil
+			}
+			cached = nil
+		case books, ok := <-loaded:
+			if ok {
+				return books, false, nil
+			}
+			loaded = nil
+		}
+	}
+	return nil, false, g.Wait()
+}
@@ -1,57 +1,834 @@
 package book
 
 import (
+	"context"
+	"time"
+
 	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/odata"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func GetAllBooks() ([]Book, error) {
+// ODataFields lists the book fields that can be used in $filter and $orderby
+var ODataFields = map[string]string{
+	"id":         "id",
+	"title":      "title",
+	"author":     "author",
+	"year":       "year",
+	"genre":      "genre",
+	"genre_id":   "genre_id",
+	"isbn":       "isbn",
+	"status":     "status",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// Store is the storage BookHandler and Service read and write through, so
+// tests can stand in for the database. It doesn't cache, log successful
+// queries or publish activity; the handlers do.
+type Store interface {
+	// LoadBook returns a book with its series and attribution
+	LoadBook(ctx context.Context, id uint) (*Book, error)
+	// LoadBooks returns all books, or those matching search, with their
+	// series and attribution
+	LoadBooks(ctx context.Context, search string) ([]Book, error)
+	GetBookByID(ctx context.Context, id uint) (*Book, error)
+	GetBooksByIDs(ctx context.Context, ids []uint) ([]Book, error)
+	GetAllBooks(ctx context.Context) ([]Book, error)
+	StreamBooks(ctx context.Context, batchSize int, fn func([]Book) error) error
+	CreateBook(ctx context.Context, book *Book) error
+	UpdateBook(ctx context.Context, id uint, book *Book) (*Book, error)
+	DeleteBook(ctx context.Context, id uint) error
+	// FindDuplicates returns the books whose titles are similar enough to
+	// title that adding it may duplicate them
+	FindDuplicates(ctx context.Context, title string) ([]dedup.Candidate, error)
+	SyncCatalog(ctx context.Context, books []SyncBook) (*SyncHistory, []uint, error)
+
+	// Listings and search
+	FilterBooks(ctx context.Context, filter BookFilter) ([]Book, error)
+	GetSortedBooks(ctx context.Context, order string, limit int) ([]Book, error)
+	GetNewBooks(ctx context.Context, since time.Time, limit int) ([]Book, error)
+	SearchBooks(ctx context.Context, query string) ([]Book, error)
+	SearchBooksLimited(ctx context.Context, query string, limit int) ([]Book, int64, error)
+	SuggestBooks(ctx context.Context, prefix string, limit int) ([]Book, error)
+	GetFacet(ctx context.Context, search, facet string) ([]FacetValue, error)
+	QueryBooks(ctx context.Context, query *odata.Query) ([]Book, error)
+	ListBooksByCreator(ctx context.Context, userID uint) ([]Book, error)
+	UserExists(ctx context.Context, id uint) (bool, error)
+	AttachDetails(ctx context.Context, books []Book) error
+	AttachAttribution(ctx context.Context, books []Book) error
+	AttachSeries(ctx context.Context, books []Book) error
+	ListBookChanges(ctx context.Context, bookID uint, page, limit int) ([]BookChangeEntry, int64, error)
+
+	// Genres
+	ListGenres(ctx context.Context) ([]GenreCount, error)
+	ValidateGenre(ctx context.Context, genre string) (uint, error)
+
+	// Series and reading progress
+	GetAllSeries(ctx context.Context) ([]Series, error)
+	SearchSeries(ctx context.Context, query string, limit int) ([]Series, int64, error)
+	SuggestSeries(ctx context.Context, prefix string, limit int) ([]Series, error)
+	GetSeriesByID(ctx context.Context, id uint) (*Series, error)
+	CreateSeries(ctx context.Context, series *Series) error
+	GetSeriesBooks(ctx context.Context, seriesID uint) ([]Book, error)
+	SetSeriesBooks(ctx context.Context, seriesID uint, entries []SeriesBookRequest) error
+	GetBookSeriesID(ctx context.Context, bookID uint) (uint, error)
+	SetReadingStatus(ctx context.Context, userID, bookID uint, status string) (*ReadingStatus, error)
+	GetSeriesProgress(ctx context.Context, seriesID, userID uint) (*SeriesProgress, error)
+	ListSeriesInProgress(ctx context.Context, userID uint) ([]SeriesProgress, error)
+
+	// Bookmarks and search history
+	AddBookmark(ctx context.Context, userID, bookID uint) (*Bookmark, error)
+	RemoveBookmark(ctx context.Context, userID, bookID uint) (bool, error)
+	IsBookmarked(ctx context.Context, userID, bookID uint) (bool, error)
+	ListBookmarkedBooks(ctx context.Context, userID uint, page, limit int) ([]Book, int64, error)
+	GetPopularBookmarks(ctx context.Context, limit int) ([]PopularBook, error)
+	AddSearchHistory(ctx context.Context, entry *SearchHistory) error
+	ListSearchHistory(ctx context.Context, userID uint, limit int) ([]SearchHistory, error)
+	DeleteSearchHistory(ctx context.Context, userID, id uint) (int64, error)
+	GetPopularSearches(ctx context.Context, since time.Time, limit int) ([]PopularSearch, error)
+
+	// Annotations
+	CreateAnnotation(ctx context.Context, userID, bookID uint, req AnnotationRequest) (*Annotation, error)
+	UpdateAnnotation(ctx context.Context, userID, id uint, req UpdateAnnotationRequest) (*Annotation, error)
+	DeleteAnnotation(ctx context.Context, userID, id uint) (*Annotation, error)
+	ListAnnotations(ctx context.Context, userID, bookID uint, query string, page, limit int) (*AnnotationPage, error)
+
+	// Loans and statuses
+	CheckoutBook(ctx context.Context, bookID, userID uint) (*Loan, *Book, error)
+	ReturnLoan(ctx context.Context, loanID uint) (*Loan, *Book, error)
+	GetLoanByID(ctx context.Context, id uint) (*Loan, error)
+	SetBookStatus(ctx context.Context, id uint, status string) (*Book, error)
+	CountBooksByStatus(ctx context.Context) (map[string]int64, error)
+
+	// Ratings
+	RateBook(ctx context.Context, userID, bookID uint, score int) (*Rating, error)
+	GetLeaderboard(ctx context.Context, genre string, minRatings, limit int) ([]RankedBook, error)
+	TopRatedByGenre(ctx context.Context, minRatings, perGenre int) (map[string]map[int64]float64, error)
+
+	// Maintenance
+	AddViewCounts(ctx context.Context, counts map[uint]int64) error
+	ExistingBookIDs(ctx context.Context, ids []uint) ([]uint, error)
+	ReindexBounds(ctx context.Context) (minID, maxID uint, total int64, err error)
+	ReindexBatch(ctx context.Context, fromID, toID uint) (int64, error)
+}
+
+// Duplicates is the detector the database store checks new titles with. Set
+// in main from DEDUP_SIMILARITY_THRESHOLD.
+var Duplicates = dedup.NewDuplicateDetector(dedup.DefaultSimilarityThreshold)
+
+// logSetting carries the store's logger to the Book hooks, which run on
+// sessions derived from the store's connection
+const logSetting = "book:log"
+
+type dbStore struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+// NewDBStore returns the Store backed by conn. Failures that don't fail the
+// call, such as attaching details or indexing a saved book, are logged to
+// log, which may be nil.
+func NewDBStore(conn *gorm.DB, log *logger.Logger) Store {
+	return dbStore{db: conn, log: log}
+}
+
+// conn returns the store's connection bound to ctx. It is derived on every
+// call so a reconnect that swaps the pool under s.db applies at once.
+func (s dbStore) conn(ctx context.Context) *gorm.DB {
+	return s.db.Set(logSetting, s.log).WithContext(ctx)
+}
+
+// hookLogger returns the logger of the store tx was derived from, or nil
+func hookLogger(tx *gorm.DB) *logger.Logger {
+	value, _ := tx.Get(logSetting)
+	log, _ := value.(*logger.Logger)
+	return log
+}
+
+// LoadBook returns a book with its series and attribution. If those can't be
+// loaded, the book is returned without them.
+func (s dbStore) LoadBook(ctx context.Context, id uint) (*Book, error) {
+	book, err := s.GetBookByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	books := []Book{*book}
+	if err := s.AttachDetails(ctx, books); err != nil {
+		if s.log != nil {
+			s.log.LogError(err, map[string]interface{}{
+				"operation": "get_book_details",
+				"book_id":   id,
+			})
+		}
+		return book, nil
+	}
+	return &books[0], nil
+}
+
+func (s dbStore) LoadBooks(ctx context.Context, search string) ([]Book, error) {
 	var books []Book
-	if err := db.DB.Find(&books).Error; err != nil {
+	var err error
+	if search != "" {
+		books, err = s.SearchBooks(ctx, search)
+	} else {
+		books, err = s.GetAllBooks(ctx)
+	}
+	if err == nil {
+		err = s.AttachDetails(ctx, books)
+	}
+	return books, err
+}
+
+// CreateBook inserts book in a transaction, retrying on deadlocks. A
+// deadlock aborts the whole transaction, so each attempt starts from the
+// book as passed in, since a failed attempt may have filled in IDs that
+// were rolled back.
+func (s dbStore) CreateBook(ctx context.Context, book *Book) error {
+	input := *book
+	return db.RetryOnDeadlock(func() error {
+		*book = input
+		return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+			return CreateBookTx(ctx, tx, book)
+		})
+	}, db.DefaultRetryAttempts)
+}
+
+func (s dbStore) FindDuplicates(ctx context.Context, title string) ([]dedup.Candidate, error) {
+	return Duplicates.FindDuplicates(ctx, s.db, title)
+}
+
+func (s dbStore) GetAllBooks(ctx context.Context) ([]Book, error) {
+	var books []Book
+	if err := s.conn(ctx).Find(&books).Error; err != nil {
 		return nil, err
 	}
 	return books, nil
 }
 
-func GetBookByID(id uint) (*Book, error) {
+// StreamBooks calls fn with every book, ordered by ID, batchSize at a time
+func (s dbStore) StreamBooks(ctx context.Context, batchSize int, fn func([]Book) error) error {
+	var batch []Book
+	return s.conn(ctx).Order("id").FindInBatches(&batch, batchSize, func(tx *gorm.DB, n int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (s dbStore) GetBookByID(ctx context.Context, id uint) (*Book, error) {
 	var book Book
-	if err := db.DB.First(&book, id).Error; err != nil {
+	if err := s.conn(ctx).First(&book, id).Error; err != nil {
 		return nil, err
 	}
 	return &book, nil
 }
 
-func CreateBook(book *Book) error {
-	if err := db.DB.Create(book).Error; err != nil {
+// GetBooksByIDs returns the books with ids that exist, in no particular order
+func (s dbStore) GetBooksByIDs(ctx context.Context, ids []uint) ([]Book, error) {
+	var books []Book
+	if err := s.conn(ctx).Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func CreateBookTx(ctx context.Context, tx *gorm.DB, book *Book) error {
+	if book.CreatedByUserID == nil {
+		book.CreatedByUserID = editorFromContext(ctx)
+	}
+	if err := tx.WithContext(ctx).Create(book).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
-func UpdateBook(id uint, updatedBook *Book) (*Book, error) {
+// UpdateBook applies the non-zero fields of updatedBook, retrying on
+// deadlocks
+func (s dbStore) UpdateBook(ctx context.Context, id uint, updatedBook *Book) (*Book, error) {
+	var book *Book
+	err := db.RetryOnDeadlock(func() error {
+		var err error
+		book, err = UpdateBookTx(ctx, s.conn(ctx), id, updatedBook)
+		return err
+	}, db.DefaultRetryAttempts)
+	return book, err
+}
+
+func UpdateBookTx(ctx context.Context, tx *gorm.DB, id uint, updatedBook *Book) (*Book, error) {
+	tx = tx.WithContext(ctx)
+
 	var book Book
-	if err := db.DB.First(&book, id).Error; err != nil {
+	if err := tx.First(&book, id).Error; err != nil {
 		return nil, err
 	}
 
-	// Update only non-zero fields
-	if err := db.DB.Model(&book).Updates(updatedBook).Error; err != nil {
+	// Updates based on an older version than the stored one fail. Callers
+	// that don't send a version update the version just loaded.
+	expected := updatedBook.Version
+	if expected == 0 {
+		expected = book.Version
+	}
+
+	if err := updatedBook.linkGenre(tx.Session(&gorm.Session{NewDB: true})); err != nil {
 		return nil, err
 	}
 
+	// Update only non-zero fields. Updates without an editor keep the last
+	// one.
+	updatedBook.UpdatedByUserID = editorFromContext(ctx)
+	result := tx.Model(&book).Where("version = ?", expected).Updates(updatedBook)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var current Book
+		if err := tx.Select("version").First(&current, id).Error; err != nil {
+			return nil, err
+		}
+		return nil, &VersionConflictError{CurrentVersion: current.Version}
+	}
+
 	return &book, nil
 }
 
-func DeleteBook(id uint) error {
-	if err := db.DB.Delete(&Book{}, id).Error; err != nil {
+// DeleteBook soft-deletes an available book, retrying on deadlocks. Books in
+// any other status fail with ErrBookUnavailable and missing ones with
+// gorm.ErrRecordNotFound.
+func (s dbStore) DeleteBook(ctx context.Context, id uint) error {
+	return db.RetryOnDeadlock(func() error {
+		return DeleteBookTx(ctx, s.conn(ctx), id)
+	}, db.DefaultRetryAttempts)
+}
+
+func DeleteBookTx(ctx context.Context, tx *gorm.DB, id uint) error {
+	tx = tx.WithContext(ctx)
+	// The status is checked by the delete itself so a checkout racing it
+	// can't slip in between. The ID is set on the model so AfterDelete
+	// knows which book it was.
+	result := tx.Where("status = ?", StatusAvailable).Delete(&Book{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&Book{}).Where("id = ?", id).Count(&count).Error; err != nil {
 		return err
 	}
-	return nil
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrBookUnavailable
+}
+
+// BookFilter selects the books matching every field that is set
+type BookFilter struct {
+	Search    string
+	Status    string
+	CreatedBy uint
+	GenreID   uint
+}
+
+// HasFilters reports whether f selects on more than the search
+func (f BookFilter) HasFilters() bool {
+	return f.Status != "" || f.CreatedBy != 0 || f.GenreID != 0
+}
+
+// FilterBooks returns the books matching filter. Books a user added are
+// listed newest first, the books of a genre by title, others by ID.
+func (s dbStore) FilterBooks(ctx context.Context, filter BookFilter) ([]Book, error) {
+	order := "books.id"
+	if filter.CreatedBy != 0 {
+		order = "books.created_at DESC, books.id DESC"
+	} else if filter.GenreID != 0 {
+		order = "books.title, books.id"
+	}
+	books := []Book{}
+	err := s.conn(ctx).
+		Scopes(searchScope(filter.Search), statusScope(filter.Status), createdByScope(filter.CreatedBy), genreScope(filter.GenreID)).
+		Order(order).
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func statusScope(status string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if status == "" {
+			return tx
+		}
+		return tx.Where("books.status = ?", status)
+	}
+}
+
+func createdByScope(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if userID == 0 {
+			return tx
+		}
+		return tx.Where("books.created_by_user_id = ?", userID)
+	}
+}
+
+func genreScope(genreID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if genreID == 0 {
+			return tx
+		}
+		return tx.Where("books.genre_id = ?", genreID)
+	}
+}
+
+// GetSortedBooks returns up to limit books ordered by order, which must be a
+// trusted column and direction
+func (s dbStore) GetSortedBooks(ctx context.Context, order string, limit int) ([]Book, error) {
+	var books []Book
+	if err := s.conn(ctx).Order(order).Order("id").Limit(limit).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// GetNewBooks returns up to limit books added since the given time, newest
+// first
+func (s dbStore) GetNewBooks(ctx context.Context, since time.Time, limit int) ([]Book, error) {
+	var books []Book
+	err := s.conn(ctx).Where("created_at >= ?", since).
+		Order("created_at DESC").Order("id DESC").Limit(limit).Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// searchScope restricts a books query to titles or authors matching query.
+// An empty query matches every book.
+func searchScope(query string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if query == "" {
+			return tx
+		}
+		pattern := "%" + query + "%"
+		return tx.
+			Joins("LEFT JOIN authors ON authors.id = books.author_id AND authors.deleted_at IS NULL").
+			Where("books.title ILIKE ? OR books.author ILIKE ? OR authors.name ILIKE ?", pattern, pattern, pattern)
+	}
+}
+
+func (s dbStore) SearchBooks(ctx context.Context, query string) ([]Book, error) {
+	var books []Book
+	if err := s.conn(ctx).Scopes(searchScope(query)).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// SearchBooksLimited returns up to limit books matching query, ordered by
+// title, and the number of matches
+func (s dbStore) SearchBooksLimited(ctx context.Context, query string, limit int) ([]Book, int64, error) {
+	var books []Book
+	var total int64
+
+	q := s.conn(ctx).Model(&Book{}).Scopes(searchScope(query))
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("books.title").Order("books.id").Limit(limit).Find(&books).Error; err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// SuggestBooks returns the ID and title of up to limit books whose title
+// starts with prefix
+func (s dbStore) SuggestBooks(ctx context.Context, prefix string, limit int) ([]Book, error) {
+	var books []Book
+	err := s.conn(ctx).Select("id", "title").
+		Where("title ILIKE ?", prefix+"%").
+		Order("title").Limit(limit).
+		Find(&books).Error
+	return books, err
+}
+
+// facetColumns maps a facet name to the expression books are grouped by
+var facetColumns = map[string]string{
+	"genre":  "books.genre",
+	"decade": "(books.year / 10) * 10",
+}
+
+// IsFacet reports whether name is a supported facet
+func IsFacet(name string) bool {
+	_, ok := facetColumns[name]
+	return ok
 }
 
-func SearchBooks(query string) ([]Book, error) {
+// GetFacet counts the books matching search for each value of the facet
+func (s dbStore) GetFacet(ctx context.Context, search, facet string) ([]FacetValue, error) {
+	var rows []struct {
+		Value string
+		Count int64
+	}
+	column := facetColumns[facet]
+	err := s.conn(ctx).Model(&Book{}).
+		Scopes(searchScope(search)).
+		Select(column + "::text AS value, count(*) AS count").
+		Group(column).
+		Order("count DESC, value").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]FacetValue, 0, len(rows))
+	for _, r := range rows {
+		value := r.Value
+		if facet == "decade" {
+			value += "s"
+		}
+		values = append(values, FacetValue{Value: value, Count: r.Count})
+	}
+	return values, nil
+}
+
+func (s dbStore) QueryBooks(ctx context.Context, query *odata.Query) ([]Book, error) {
+	var books []Book
+	if err := s.conn(ctx).Scopes(query.Scope).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (s dbStore) GetAllSeries(ctx context.Context) ([]Series, error) {
+	var series []Series
+	if err := s.conn(ctx).Order("name").Find(&series).Error; err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// SearchSeries returns up to limit series whose name or description matches
+// query, ordered by name, and the number of matches
+func (s dbStore) SearchSeries(ctx context.Context, query string, limit int) ([]Series, int64, error) {
+	var series []Series
+	var total int64
+
+	pattern := "%" + query + "%"
+	q := s.conn(ctx).Model(&Series{}).Where("name ILIKE ? OR description ILIKE ?", pattern, pattern)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("name").Limit(limit).Find(&series).Error; err != nil {
+		return nil, 0, err
+	}
+	return series, total, nil
+}
+
+// SuggestSeries returns the ID and name of up to limit series whose name
+// starts with prefix
+func (s dbStore) SuggestSeries(ctx context.Context, prefix string, limit int) ([]Series, error) {
+	var series []Series
+	err := s.conn(ctx).Select("id", "name").
+		Where("name ILIKE ?", prefix+"%").
+		Order("name").Limit(limit).
+		Find(&series).Error
+	return series, err
+}
+
+func (s dbStore) GetSeriesByID(ctx context.Context, id uint) (*Series, error) {
+	var series Series
+	if err := s.conn(ctx).First(&series, id).Error; err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+func (s dbStore) CreateSeries(ctx context.Context, series *Series) error {
+	return s.conn(ctx).Create(series).Error
+}
+
+// GetSeriesBooks returns the books in a series ordered by sequence number
+func (s dbStore) GetSeriesBooks(ctx context.Context, seriesID uint) ([]Book, error) {
 	var books []Book
-	if err := db.DB.Where("title ILIKE ? OR author ILIKE ?", "%"+query+"%", "%"+query+"%").Find(&books).Error; err != nil {
+	err := s.conn(ctx).
+		Joins("JOIN series_entries ON series_entries.book_id = books.id").
+		Where("series_entries.series_id = ?", seriesID).
+		Order("series_entries.sequence_number, books.id").
+		Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.AttachDetails(ctx, books); err != nil {
 		return nil, err
 	}
 	return books, nil
 }
+
+// SetSeriesBooks places each book at the given position in the series. Books
+// already in another series are moved.
+func (s dbStore) SetSeriesBooks(ctx context.Context, seriesID uint, entries []SeriesBookRequest) error {
+	return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, e := range entries {
+			if err := tx.First(&Book{}, e.BookID).Error; err != nil {
+				return err
+			}
+
+			entry := SeriesEntry{BookID: e.BookID, SeriesID: seriesID, SequenceNumber: e.Sequence}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "book_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"series_id", "sequence_number"}),
+			}).Create(&entry).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetBookSeriesID returns the ID of the series a book belongs to, or 0
+func (s dbStore) GetBookSeriesID(ctx context.Context, bookID uint) (uint, error) {
+	var entries []SeriesEntry
+	if err := s.conn(ctx).Where("book_id = ?", bookID).Limit(1).Find(&entries).Error; err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	return entries[0].SeriesID, nil
+}
+
+// AttachDetails fills in the series and attribution of books
+func (s dbStore) AttachDetails(ctx context.Context, books []Book) error {
+	if err := s.AttachSeries(ctx, books); err != nil {
+		return err
+	}
+	return s.AttachAttribution(ctx, books)
+}
+
+// AttachAttribution fills in CreatedByUsername and UpdatedByUsername of books
+// whose users are known. Deleted users keep their username.
+func (s dbStore) AttachAttribution(ctx context.Context, books []Book) error {
+	var ids []uint
+	for i := range books {
+		if books[i].CreatedByUserID != nil || books[i].UpdatedByUserID != nil {
+			ids = append(ids, books[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []struct {
+		BookID            uint
+		CreatedByUsername string
+		UpdatedByUsername string
+	}
+	err := s.conn(ctx).Table("books").
+		Select("books.id AS book_id, creators.username AS created_by_username, editors.username AS updated_by_username").
+		Joins("LEFT JOIN users creators ON creators.id = books.created_by_user_id").
+		Joins("LEFT JOIN users editors ON editors.id = books.updated_by_user_id").
+		Where("books.id IN ?", ids).
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	byBook := make(map[uint]int, len(rows))
+	for i, r := range rows {
+		byBook[r.BookID] = i
+	}
+	for i := range books {
+		if row, ok := byBook[books[i].ID]; ok {
+			books[i].CreatedByUsername = rows[row].CreatedByUsername
+			books[i].UpdatedByUsername = rows[row].UpdatedByUsername
+		}
+	}
+	return nil
+}
+
+// ListBooksByCreator returns the books userID added, newest first
+func (s dbStore) ListBooksByCreator(ctx context.Context, userID uint) ([]Book, error) {
+	books := []Book{}
+	err := s.conn(ctx).Where("created_by_user_id = ?", userID).
+		Order("created_at DESC, id DESC").Find(&books).Error
+	return books, err
+}
+
+// UserExists reports whether there is a user with the given ID that wasn't
+// deleted
+func (s dbStore) UserExists(ctx context.Context, id uint) (bool, error) {
+	var count int64
+	err := s.conn(ctx).Table("users").Where("id = ? AND deleted_at IS NULL", id).Count(&count).Error
+	return count > 0, err
+}
+
+// AttachSeries fills in the Series field of each book that belongs to a series
+func (s dbStore) AttachSeries(ctx context.Context, books []Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(books))
+	for i := range books {
+		ids[i] = books[i].ID
+	}
+
+	var rows []struct {
+		BookID         uint
+		SeriesID       uint
+		Name           string
+		SequenceNumber int
+	}
+	err := s.conn(ctx).Table("series_entries").
+		Select("series_entries.book_id, series_entries.series_id, series.name, series_entries.sequence_number").
+		Joins("JOIN series ON series.id = series_entries.series_id").
+		Where("series_entries.book_id IN ?", ids).
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	bySeries := make(map[uint]*BookSeries, len(rows))
+	for _, r := range rows {
+		bySeries[r.BookID] = &BookSeries{ID: r.SeriesID, Name: r.Name, SequenceNumber: r.SequenceNumber}
+	}
+	for i := range books {
+		books[i].Series = bySeries[books[i].ID]
+	}
+	return nil
+}
+
+// AddBookmark saves a book for a user and returns the new bookmark, or nil
+// if the user already bookmarked the book
+func (s dbStore) AddBookmark(ctx context.Context, userID, bookID uint) (*Bookmark, error) {
+	bookmark := Bookmark{UserID: userID, BookID: bookID}
+	result := s.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&bookmark)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &bookmark, nil
+}
+
+func (s dbStore) RemoveBookmark(ctx context.Context, userID, bookID uint) (bool, error) {
+	result := s.conn(ctx).Where("user_id = ? AND book_id = ?", userID, bookID).Delete(&Bookmark{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s dbStore) IsBookmarked(ctx context.Context, userID, bookID uint) (bool, error) {
+	var count int64
+	err := s.conn(ctx).Model(&Bookmark{}).Where("user_id = ? AND book_id = ?", userID, bookID).Count(&count).Error
+	return count > 0, err
+}
+
+// ListBookmarkedBooks returns the books a user bookmarked, most recent first
+func (s dbStore) ListBookmarkedBooks(ctx context.Context, userID uint, page, limit int) ([]Book, int64, error) {
+	var books []Book
+	var total int64
+
+	query := s.conn(ctx).Model(&Book{}).
+		Joins("JOIN bookmarks ON bookmarks.book_id = books.id").
+		Where("bookmarks.user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("bookmarks.created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&books).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return books, total, nil
+}
+
+// GetPopularBookmarks returns the most bookmarked books
+func (s dbStore) GetPopularBookmarks(ctx context.Context, limit int) ([]PopularBook, error) {
+	var counts []struct {
+		BookID uint
+		Count  int64
+	}
+	err := s.conn(ctx).Model(&Bookmark{}).
+		Select("bookmarks.book_id, COUNT(*) AS count").
+		Joins("JOIN books ON books.id = bookmarks.book_id AND books.deleted_at IS NULL").
+		Group("bookmarks.book_id").
+		Order("count DESC, bookmarks.book_id").
+		Limit(limit).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return []PopularBook{}, nil
+	}
+
+	ids := make([]uint, len(counts))
+	for i, c := range counts {
+		ids[i] = c.BookID
+	}
+	var books []Book
+	if err := s.conn(ctx).Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	popular := make([]PopularBook, 0, len(counts))
+	for _, c := range counts {
+		if b, ok := byID[c.BookID]; ok {
+			popular = append(popular, PopularBook{Book: b, BookmarkCount: c.Count})
+		}
+	}
+	return popular, nil
+}
+
+func (s dbStore) AddSearchHistory(ctx context.Context, entry *SearchHistory) error {
+	return s.conn(ctx).Create(entry).Error
+}
+
+// ListSearchHistory returns a user's most recent searches
+func (s dbStore) ListSearchHistory(ctx context.Context, userID uint, limit int) ([]SearchHistory, error) {
+	var history []SearchHistory
+	err := s.conn(ctx).Where("user_id = ?", userID).Order("searched_at DESC, id DESC").Limit(limit).Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// DeleteSearchHistory removes one of a user's searches, or all of them when id is 0
+func (s dbStore) DeleteSearchHistory(ctx context.Context, userID, id uint) (int64, error) {
+	query := s.conn(ctx).Where("user_id = ?", userID)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	}
+	result := query.Delete(&SearchHistory{})
+	return result.RowsAffected, result.Error
+}
+
+// GetPopularSearches returns the most common queries since the given time.
+// Queries are compared case-insensitively.
+func (s dbStore) GetPopularSearches(ctx context.Context, since time.Time, limit int) ([]PopularSearch, error) {
+	var popular []PopularSearch
+	err := s.conn(ctx).Model(&SearchHistory{}).
+		Select("LOWER(query) AS query, COUNT(*) AS searches, COUNT(DISTINCT user_id) AS users").
+		Where("searched_at >= ?", since).
+		Group("LOWER(query)").
+		Order("searches DESC, query").
+		Limit(limit).
+		Scan(&popular).Error
+	if err != nil {
+		return nil, err
+	}
+	return popular, nil
+}
@@ -0,0 +1,75 @@
+package book
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StreamBatchSize is the number of books /books/stream loads per query, and
+// so roughly how many it holds in memory at once
+const StreamBatchSize = 100
+
+// StreamFlushInterval is how long streamed books may wait in the write
+// buffer. The buffer is flushed after the first batch that ends once the
+// interval has passed; 0 flushes after every batch. Set from
+// BOOKS_STREAM_FLUSH_INTERVAL.
+var StreamFlushInterval = time.Second
+
+// ContentTypeNDJSON is newline-delimited JSON, one document per line
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// WriteBooksNDJSON writes every book in store to w as one JSON object per
+// line, in ID order, loading batchSize books per query. It returns how many
+// books were written.
+func WriteBooksNDJSON(ctx context.Context, store Store, w *bufio.Writer, batchSize int, flushInterval time.Duration) (int, error) {
+	encoder := json.NewEncoder(w)
+	written := 0
+	lastFlush := time.Now()
+	err := store.StreamBooks(ctx, batchSize, func(books []Book) error {
+		for i := range books {
+			if err := encoder.Encode(&books[i]); err != nil {
+				return err
+			}
+		}
+		written += len(books)
+		if time.Since(lastFlush) < flushInterval {
+			return nil
+		}
+		lastFlush = time.Now()
+		return w.Flush()
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, w.Flush()
+}
+
+// StreamBooks godoc
+// @Summary      Stream all books as NDJSON
+// @Description  Every book, one JSON object per line in ID order, sent as it is read from the database in batches of 100. Unlike GET /books the response is not paginated and never held in memory as a whole, so consumers can start processing before the last book arrives. A response cut short by an error simply ends; compare the line count with X-Total-Count of GET /books when completeness matters.
+// @Tags         books
+// @Produce      application/x-ndjson
+// @Success      200  {string} string "One book per line"
+// @Failure      429  {object} errors.RateLimitedBody "Rate limit exceeded"
+// @Router       /books/stream [get]
+func (h *BookHandler) StreamBooks(c *fiber.Ctx) error {
+	// The stream writer runs after the handler returns, when c is recycled
+	ctx := c.UserContext()
+	flushInterval := StreamFlushInterval
+
+	c.Set(fiber.HeaderContentType, ContentTypeNDJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		written, err := WriteBooksNDJSON(ctx, h.store, w, StreamBatchSize, flushInterval)
+		if err != nil && h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "stream_books",
+				"written":   written,
+			})
+		}
+	})
+	return nil
+}
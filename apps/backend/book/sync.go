@@ -0,0 +1,424 @@
+package book
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/external/googlebooks"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// MaxSyncBooks is the most books one catalog sync may contain
+const MaxSyncBooks = 500
+
+// SyncCopyThreshold is the number of new books above which a sync inserts
+// them with one COPY instead of an INSERT each. COPY skips the Book hooks,
+// so the sync links authors and builds search vectors itself.
+const SyncCopyThreshold = 100
+
+// syncSavepoint isolates each book of a sync, so a failed book is rolled
+// back without aborting the rest
+const syncSavepoint = "sync_book"
+
+// copyColumns are the columns a sync fills with COPY; the others take their
+// defaults
+var copyColumns = []string{
+	"title", "author", "author_id", "year", "genre", "isbn", "cover_url",
+	"status", "sync_status", "created_by_user_id", "updated_by_user_id", "created_at", "updated_at",
+}
+
+// catalogSync is the state of one sync while it runs
+type catalogSync struct {
+	ctx     context.Context
+	log     *logger.Logger
+	tx      *gorm.DB
+	conn    *sql.Conn
+	history *SyncHistory
+	// listed are the books in the catalog, which are not unlisted
+	listed map[uint]bool
+	// changed are the books whose cached copies are stale
+	changed []uint
+}
+
+// SyncCatalog upserts books by ISBN and marks every book left out of them
+// unlisted, in one transaction. Books that fail are reported in the history
+// instead of failing the sync. The history is stored with the changes.
+func (s dbStore) SyncCatalog(ctx context.Context, books []SyncBook) (*SyncHistory, []uint, error) {
+	return syncCatalog(s.conn(ctx), s.log, books)
+}
+
+func syncCatalog(conn *gorm.DB, log *logger.Logger, books []SyncBook) (*SyncHistory, []uint, error) {
+	ctx := conn.Statement.Context
+	s := &catalogSync{
+		ctx: ctx,
+		log: log,
+		history: &SyncHistory{
+			ID:        uuid.NewString(),
+			Errors:    SyncErrors{},
+			UserID:    editorFromContext(ctx),
+			StartedAt: time.Now(),
+		},
+		listed: map[uint]bool{},
+	}
+
+	// COPY needs the pgx connection under the transaction, so the sync
+	// keeps one connection for itself
+	err := conn.Connection(func(conn *gorm.DB) error {
+		s.conn, _ = conn.Statement.ConnPool.(*sql.Conn)
+		return conn.Transaction(func(tx *gorm.DB) error {
+			s.tx = tx
+			return s.run(books)
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.history, s.changed, nil
+}
+
+func (s *catalogSync) run(books []SyncBook) error {
+	existing, err := s.loadCatalog()
+	if err != nil {
+		return err
+	}
+
+	var created []Book
+	var createdIndexes []int
+	seen := map[string]bool{}
+	for i := range books {
+		item := books[i]
+		isbn := googlebooks.NormalizeISBN(item.ISBN)
+		current, found := existing[isbn]
+		if found {
+			// Still in the catalog even if this entry is invalid
+			s.listed[current.ID] = true
+		}
+		if errs := validator.ValidateStruct(&item); len(errs) > 0 {
+			s.fail(i, item.ISBN, errs[0].Path+" "+errs[0].Message)
+			continue
+		}
+		if seen[isbn] {
+			s.fail(i, item.ISBN, "isbn appears more than once")
+			continue
+		}
+		seen[isbn] = true
+
+		if !found {
+			created = append(created, s.newBook(item))
+			createdIndexes = append(createdIndexes, i)
+			continue
+		}
+		s.update(i, current, item)
+	}
+
+	if len(created) > SyncCopyThreshold && s.conn != nil {
+		if err := s.inSavepoint(func() error { return s.copyBooks(created) }); err == nil {
+			created = nil
+		} else if s.log != nil {
+			s.log.LogError(err, map[string]interface{}{"operation": "sync_copy_books", "books": len(created)})
+		}
+	}
+	// Without COPY, or when it failed, insert one by one so only the
+	// failing books are lost
+	for j := range created {
+		b := created[j]
+		if err := s.inSavepoint(func() error { return CreateBookTx(s.ctx, s.tx, &b) }); err != nil {
+			s.fail(createdIndexes[j], b.ISBN, err.Error())
+			continue
+		}
+		s.history.Created++
+		s.listed[b.ID] = true
+	}
+
+	if err := s.unlist(); err != nil {
+		return err
+	}
+	s.history.FinishedAt = time.Now()
+	return s.tx.Create(s.history).Error
+}
+
+// loadCatalog returns the books with an ISBN by normalized ISBN
+func (s *catalogSync) loadCatalog() (map[string]Book, error) {
+	var books []Book
+	if err := s.tx.Where("isbn <> ''").Find(&books).Error; err != nil {
+		return nil, err
+	}
+	byISBN := make(map[string]Book, len(books))
+	for _, b := range books {
+		byISBN[googlebooks.NormalizeISBN(b.ISBN)] = b
+	}
+	return byISBN, nil
+}
+
+func (s *catalogSync) newBook(item SyncBook) Book {
+	return Book{
+		Title:           item.Title,
+		Author:          item.Author,
+		Year:            item.Year,
+		Genre:           item.Genre,
+		ISBN:            item.ISBN,
+		CoverURL:        item.CoverURL,
+		Status:          StatusAvailable,
+		SyncStatus:      SyncStatusSynced,
+		CreatedByUserID: s.history.UserID,
+		UpdatedByUserID: s.history.UserID,
+	}
+}
+
+// update applies item to the stored book. Empty fields keep their value,
+// like a PUT /books/:id without them.
+func (s *catalogSync) update(index int, current Book, item SyncBook) {
+	changes := Book{SyncStatus: SyncStatusSynced}
+	changed := current.SyncStatus != SyncStatusSynced
+	for _, field := range []struct {
+		incoming, stored string
+		dest             *string
+	}{
+		{item.Title, current.Title, &changes.Title},
+		{item.Author, current.Author, &changes.Author},
+		{item.CoverURL, current.CoverURL, &changes.CoverURL},
+	} {
+		if field.incoming != "" && field.incoming != field.stored {
+			*field.dest = field.incoming
+			changed = true
+		}
+	}
+	// Genres are stored under their genre's name, so only a different
+	// genre is a change
+	if item.Genre != "" && GenreSlug(item.Genre) != GenreSlug(current.Genre) {
+		changes.Genre = item.Genre
+		changed = true
+	}
+	if item.Year != current.Year {
+		changes.Year = item.Year
+		changed = true
+	}
+	if !changed {
+		s.history.Unchanged++
+		return
+	}
+
+	err := s.inSavepoint(func() error {
+		_, err := UpdateBookTx(s.ctx, s.tx, current.ID, &changes)
+		return err
+	})
+	if err != nil {
+		s.fail(index, item.ISBN, err.Error())
+		return
+	}
+	s.history.Updated++
+	s.changed = append(s.changed, current.ID)
+}
+
+// copyBooks inserts books with COPY, linking their authors first and their
+// genres after as Book.BeforeCreate would, and indexes them for search
+func (s *catalogSync) copyBooks(books []Book) error {
+	authorIDs, err := s.ensureAuthors(books)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := make([][]interface{}, len(books))
+	isbns := make([]string, len(books))
+	for i, b := range books {
+		var authorID interface{}
+		if id, ok := authorIDs[strings.TrimSpace(b.Author)]; ok {
+			authorID = int64(id)
+		}
+		var editor interface{}
+		if b.CreatedByUserID != nil {
+			editor = int64(*b.CreatedByUserID)
+		}
+		rows[i] = []interface{}{
+			b.Title, b.Author, authorID, b.Year, b.Genre, b.ISBN, b.CoverURL,
+			b.Status, b.SyncStatus, editor, editor, now, now,
+		}
+		isbns[i] = b.ISBN
+	}
+
+	err = s.conn.Raw(func(driverConn interface{}) error {
+		conn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs a pgx connection, got %T", driverConn)
+		}
+		_, err := conn.Conn().CopyFrom(s.ctx, pgx.Identifier{"books"}, copyColumns, pgx.CopyFromRows(rows))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var ids []uint
+	if err := s.tx.Model(&Book{}).Where("isbn IN ?", isbns).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if err := linkGenres(s.tx, ids); err != nil {
+		return err
+	}
+	err = s.tx.Exec("UPDATE books SET search_vector = "+SearchVectorSQL+", search_vector_updated_at = updated_at WHERE id IN ?", ids).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := notifyChange(s.tx, id); err != nil {
+			return err
+		}
+		s.listed[id] = true
+	}
+	s.history.Created += len(ids)
+	return nil
+}
+
+// ensureAuthors creates the authors of books that don't exist yet and
+// returns the author IDs by name
+func (s *catalogSync) ensureAuthors(books []Book) (map[string]uint, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, b := range books {
+		name := strings.TrimSpace(b.Author)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	err := s.tx.Exec("INSERT INTO authors (name, created_at, updated_at) SELECT name, NOW(), NOW() FROM unnest(ARRAY[?]::text[]) AS name ON CONFLICT (name) DO NOTHING", names).Error
+	if err != nil {
+		return nil, err
+	}
+	var authors []struct {
+		ID   uint
+		Name string
+	}
+	if err := s.tx.Raw("SELECT id, name FROM authors WHERE name IN ?", names).Scan(&authors).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uint, len(authors))
+	for _, a := range authors {
+		ids[a.Name] = a.ID
+	}
+	return ids, nil
+}
+
+// unlist marks the books left out of the catalog. Like view counts, the
+// status is bookkeeping, so it doesn't touch the version or changelog.
+func (s *catalogSync) unlist() error {
+	query := s.tx.Model(&Book{}).Where("sync_status IS DISTINCT FROM ?", SyncStatusUnlisted)
+	if len(s.listed) > 0 {
+		ids := make([]uint, 0, len(s.listed))
+		for id := range s.listed {
+			ids = append(ids, id)
+		}
+		query = query.Where("id NOT IN ?", ids)
+	}
+	result := query.UpdateColumn("sync_status", SyncStatusUnlisted)
+	s.history.Unlisted = int(result.RowsAffected)
+	return result.Error
+}
+
+// inSavepoint runs fn so that when it fails, only its changes are rolled
+// back and the transaction can go on
+func (s *catalogSync) inSavepoint(fn func() error) error {
+	if err := s.tx.SavePoint(syncSavepoint).Error; err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if rollbackErr := s.tx.RollbackTo(syncSavepoint).Error; rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+	return s.tx.Exec("RELEASE SAVEPOINT " + syncSavepoint).Error
+}
+
+func (s *catalogSync) fail(index int, isbn, message string) {
+	s.history.Errors = append(s.history.Errors, SyncError{Index: index, ISBN: isbn, Error: message})
+}
+
+// Result is the response of the sync
+func (h *SyncHistory) Result() SyncResult {
+	return SyncResult{
+		SyncID:   h.ID,
+		Upserted: SyncCounts{Created: h.Created, Updated: h.Updated, Unchanged: h.Unchanged},
+		Unlisted: h.Unlisted,
+		Errors:   h.Errors,
+	}
+}
+
+// SyncBooks godoc
+// @Summary      Sync the catalog (admin only)
+// @Description  Upserts up to 500 books by ISBN and marks every other book sync_status "unlisted"; books are never deleted. Books that can't be stored are listed in errors and don't fail the sync. The result is kept in the sync history.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        books body []SyncBook true "The whole catalog"
+// @Success      200  {object} SyncResult
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/books/sync [post]
+func (h *BookHandler) SyncBooks(c *fiber.Ctx) error {
+	start := time.Now()
+	var books []SyncBook
+	if err := c.BodyParser(&books); err != nil {
+		return apierrors.ErrInvalidRequestBody.WithMessage("Body must be a JSON array of books")
+	}
+	if len(books) > MaxSyncBooks {
+		return apierrors.NewValidationError(apierrors.FieldError{
+			Field:   "books",
+			Tag:     "max",
+			Message: fmt.Sprintf("a sync can contain at most %d books, got %d", MaxSyncBooks, len(books)),
+		})
+	}
+
+	ctx := c.UserContext()
+	if userID, ok := middleware.UserID(c); ok {
+		ctx = WithEditor(ctx, userID)
+	}
+	history, changed, err := h.store.SyncCatalog(ctx, books)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "sync_books", "books": len(books)})
+		}
+		h.metrics.RecordDatabaseQuery("sync", "books", "error", time.Since(start))
+		return apierrors.ErrDatabase.WithMessage("Failed to sync the catalog")
+	}
+	h.metrics.RecordDatabaseQuery("sync", "books", "success", time.Since(start))
+
+	if h.cache != nil {
+		h.cache.Delete("books:all")
+		for _, id := range changed {
+			h.cache.Delete(fmt.Sprintf("book:%d", id), coverPlaceholderKey(id))
+		}
+		clearFacets(h.cache)
+		h.metrics.RecordCacheOperation("delete", "success")
+	}
+	if h.log != nil {
+		h.log.Info("Catalog synced", map[string]interface{}{
+			"sync_id":  history.ID,
+			"created":  history.Created,
+			"updated":  history.Updated,
+			"unlisted": history.Unlisted,
+			"errors":   len(history.Errors),
+		})
+	}
+	return c.JSON(history.Result())
+}
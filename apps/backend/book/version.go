@@ -0,0 +1,35 @@
+package book
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// VersionConflictError is returned by UpdateBook when the book was updated
+// after the client read the version it sent
+type VersionConflictError struct {
+	CurrentVersion int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("book was modified, current version is %d", e.CurrentVersion)
+}
+
+// bumpVersion makes an update of b increment its version. Column updates
+// such as Update("status", ...) increment the stored version, and the
+// loaded book's to match; struct updates of a loaded book store its version
+// plus one, which is correct because UpdateBookTx only updates the row while
+// it still has the version the update is based on.
+func bumpVersion(tx *gorm.DB, b *Book) {
+	if _, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		tx.Statement.SetColumn("version", gorm.Expr("version + 1"))
+		if b.ID != 0 {
+			b.Version++
+		}
+		return
+	}
+	if b.ID != 0 {
+		tx.Statement.SetColumn("version", b.Version+1)
+	}
+}
@@ -0,0 +1,211 @@
+package book
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const viewsKeyPrefix = "book:views:"
+
+func viewsKey(id uint) string {
+	return fmt.Sprintf("%s%d", viewsKeyPrefix, id)
+}
+
+// weeklyViewsTTL keeps last week's ranking around while the current one
+// fills up
+const weeklyViewsTTL = 14 * 24 * time.Hour
+
+// weeklyViewsKey names the sorted set ranking books by views in the ISO
+// week of t, e.g. books:views:202642. It lives outside book:* so
+// FlushViewCounts and the cache integrity check don't take it for a
+// per-book key.
+func weeklyViewsKey(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("books:views:%d%02d", year, week)
+}
+
+// hourlyViewsTTL keeps two days of hourly counts, enough to compare any
+// hour with the one before it
+const hourlyViewsTTL = 48 * time.Hour
+
+// HourlyViewsKey names the sorted set counting views per book in the UTC hour
+// of t, e.g. books:views:hour:2026101614. Like the weekly ranking it lives
+// outside book:*.
+func HourlyViewsKey(t time.Time) string {
+	return "books:views:hour:" + t.UTC().Format("2006010215")
+}
+
+func uniqueVisitorsKey(id uint) string {
+	return fmt.Sprintf("book:uniq_visitors:%d", id)
+}
+
+// RecordView counts a view of a book in Redis. Views are buffered there and
+// written to the database by FlushViewCounts so reads don't cause writes.
+// The view also counts towards the book's rank in this week's popular books
+// and towards its views in the current hour, which trending compares.
+func (h *BookHandler) RecordView(id uint, visitor string) {
+	if h.cache == nil {
+		return
+	}
+	h.cache.Incr(viewsKey(id))
+	now := time.Now()
+	member := strconv.FormatUint(uint64(id), 10)
+	weekly := weeklyViewsKey(now)
+	if _, err := h.cache.ZIncrBy(weekly, 1, member); err == nil {
+		h.cache.Expire(weekly, weeklyViewsTTL)
+	}
+	hourly := HourlyViewsKey(now)
+	if _, err := h.cache.ZIncrBy(hourly, 1, member); err == nil {
+		h.cache.Expire(hourly, hourlyViewsTTL)
+	}
+	if visitor != "" {
+		h.cache.PFAdd(uniqueVisitorsKey(id), visitor)
+	}
+}
+
+// GetPopularThisWeek returns up to limit books ranked by their views in the
+// current ISO week, most viewed first. Deleted books are skipped.
+func (h *BookHandler) GetPopularThisWeek(ctx context.Context, limit int) ([]TrendingBook, error) {
+	if h.cache == nil {
+		return []TrendingBook{}, nil
+	}
+	ranked, err := h.cache.ZRevRangeWithScores(weeklyViewsKey(time.Now()), 0, int64(limit)-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranked) == 0 {
+		return []TrendingBook{}, nil
+	}
+
+	ids := make([]uint, 0, len(ranked))
+	for _, m := range ranked {
+		if id, err := strconv.ParseUint(m.Member, 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	books, err := h.store.GetBooksByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	popular := make([]TrendingBook, 0, len(ranked))
+	for _, m := range ranked {
+		id, _ := strconv.ParseUint(m.Member, 10, 32)
+		if b, ok := byID[uint(id)]; ok {
+			popular = append(popular, TrendingBook{Book: b, WeeklyViews: int64(m.Score)})
+		}
+	}
+	return popular, nil
+}
+
+// GetViewStats returns the total views of a book, combining the flushed
+// ViewCount with views still buffered in Redis, and its approximate number of
+// unique visitors. Redis errors count as zero.
+func (h *BookHandler) GetViewStats(b *Book) (views int64, uniqueVisitors int64) {
+	views = b.ViewCount
+	if h.cache == nil {
+		return views, 0
+	}
+	if pending, err := h.cache.GetInt64(viewsKey(b.ID)); err == nil {
+		views += pending
+	}
+	uniqueVisitors, _ = h.cache.PFCount(uniqueVisitorsKey(b.ID))
+	return views, uniqueVisitors
+}
+
+// FlushViewCounts moves the view counters buffered in Redis into the
+// view_count column and resets them. It returns the number of books updated.
+func (h *BookHandler) FlushViewCounts(ctx context.Context) (int, error) {
+	if h.cache == nil {
+		return 0, nil
+	}
+
+	keys, err := h.cache.Keys(viewsKeyPrefix + "*")
+	if err != nil {
+		return 0, err
+	}
+
+	pending := make(map[uint]int64, len(keys))
+	for _, key := range keys {
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, viewsKeyPrefix), 10, 32)
+		if err != nil {
+			continue
+		}
+		// GETDEL so views recorded after this point start a fresh counter
+		count, err := h.cache.GetDelInt64(key)
+		if err != nil || count == 0 {
+			continue
+		}
+		pending[uint(id)] = count
+	}
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	if err := h.store.AddViewCounts(ctx, pending); err != nil {
+		// Put the counts back so the next run picks them up
+		for id, count := range pending {
+			h.cache.IncrBy(viewsKey(id), count)
+		}
+		return 0, err
+	}
+
+	// Cached books carry the old view_count, which would undercount now that
+	// the Redis counters are reset
+	h.cache.Delete("books:all")
+	for id := range pending {
+		h.cache.Delete(fmt.Sprintf("book:%d", id))
+	}
+
+	return len(pending), nil
+}
+
+// StartViewCountFlusher runs FlushViewCounts every interval until ctx is done
+func (h *BookHandler) StartViewCountFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+				updated, err := h.FlushViewCounts(ctx)
+				if h.log == nil {
+					continue
+				}
+				if err != nil {
+					h.log.LogError(err, map[string]interface{}{"operation": "flush_view_counts"})
+					continue
+				}
+				h.log.LogDatabase("update", "books", time.Since(start), int64(updated))
+			}
+		}
+	}()
+}
+
+// AddViewCounts adds flushed view counts to the books' view_count in one
+// transaction
+func (s dbStore) AddViewCounts(ctx context.Context, counts map[uint]int64) error {
+	return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		for id, count := range counts {
+			err := tx.Model(&Book{}).Where("id = ?", id).
+				UpdateColumn("view_count", gorm.Expr("view_count + ?", count)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/proto/bookpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	baseURL  = "http://localhost:8080"
+	grpcAddr = "localhost:50051"
+)
+
+func main() {
+	fmt.Println("🧪 Testing Book Library gRPC API...")
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("❌ Failed to connect to gRPC server: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	client := bookpb.NewBookServiceClient(conn)
+
+	token := login()
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	created := testCreateBook(ctx, client)
+	testListBooks(ctx, client)
+
+	if created != nil {
+		testGetBook(ctx, client, created.Id)
+		testUpdateBook(ctx, client, created.Id)
+		testDeleteBook(ctx, client, created.Id)
+	}
+
+	fmt.Println("✅ All gRPC operations completed!")
+}
+
+// login obtains a JWT from the REST API, which the gRPC server accepts too
+func login() string {
+	fmt.Println("\n🔐 Logging in via REST API...")
+
+	user := map[string]string{
+		"username": "testuser",
+		"password": "testpass123",
+	}
+
+	jsonData, _ := json.Marshal(user)
+	resp, err := http.Post(baseURL+"/auth/login", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		fmt.Printf("❌ Login failed: %v\n", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		fmt.Printf("❌ Login failed with status: %d\n", resp.StatusCode)
+		return ""
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	fmt.Println("✅ Login passed")
+	token, _ := result["token"].(string)
+	return token
+}
+
+func testCreateBook(ctx context.Context, client bookpb.BookServiceClient) *bookpb.Book {
+	fmt.Println("\n📗 CreateBook...")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := client.CreateBook(ctx, &bookpb.CreateBookRequest{
+		Title:  "gRPC Test Book",
+		Author: "Test Author",
+		Year:   2024,
+		Genre:  "Test Genre",
+	})
+	if err != nil {
+		fmt.Printf("❌ CreateBook failed: %v\n", err)
+		return nil
+	}
+
+	fmt.Printf("✅ Created book %d: %s\n", resp.Book.Id, resp.Book.Title)
+	return resp.Book
+}
+
+func testListBooks(ctx context.Context, client bookpb.BookServiceClient) {
+	fmt.Println("\n📚 ListBooks...")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := client.ListBooks(ctx, &bookpb.ListBooksRequest{})
+	if err != nil {
+		fmt.Printf("❌ ListBooks failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Listed %d books\n", resp.Total)
+}
+
+func testGetBook(ctx context.Context, client bookpb.BookServiceClient, id uint64) {
+	fmt.Println("\n📖 GetBook...")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := client.GetBook(ctx, &bookpb.GetBookRequest{Id: id})
+	if err != nil {
+		fmt.Printf("❌ GetBook failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Got book %d: %s\n", resp.Book.Id, resp.Book.Title)
+}
+
+func testUpdateBook(ctx context.Context, client bookpb.BookServiceClient, id uint64) {
+	fmt.Println("\n✏️  UpdateBook...")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := client.UpdateBook(ctx, &bookpb.UpdateBookRequest{Id: id, Title: "gRPC Test Book (updated)"})
+	if err != nil {
+		fmt.Printf("❌ UpdateBook failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Updated book %d: %s\n", resp.Book.Id, resp.Book.Title)
+}
+
+func testDeleteBook(ctx context.Context, client bookpb.BookServiceClient, id uint64) {
+	fmt.Println("\n🗑️  DeleteBook...")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := client.DeleteBook(ctx, &bookpb.DeleteBookRequest{Id: id}); err != nil {
+		fmt.Printf("❌ DeleteBook failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Deleted book %d\n", id)
+}
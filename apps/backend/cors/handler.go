@@ -0,0 +1,96 @@
+package cors
+
+import (
+	"strconv"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListOrigins godoc
+// @Summary      List the allowed CORS origins (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {array}  Origin
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/cors/origins [get]
+func (h *Handler) ListOrigins(c *fiber.Ctx) error {
+	origins, err := h.listOrigins(c.UserContext())
+	if err != nil {
+		h.logError(err, "list_cors_origins", nil)
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch CORS origins")
+	}
+	return c.JSON(origins)
+}
+
+// CreateOrigin godoc
+// @Summary      Allow a CORS origin (admin only)
+// @Description  Browsers on the origin may call the API from the next request on. Inactive origins are kept but not allowed.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        origin  body  OriginRequest  true  "Origin to allow"
+// @Success      201  {object} Origin
+// @Failure      400  {object} apierrors.APIError
+// @Failure      409  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/cors/origins [post]
+func (h *Handler) CreateOrigin(c *fiber.Ctx) error {
+	var req OriginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	origin := Origin{
+		Origin: NormalizeOrigin(req.Origin),
+		Active: req.Active == nil || *req.Active,
+	}
+	if userID, ok := middleware.UserID(c); ok {
+		origin.CreatedByUserID = userID
+	}
+
+	if err := h.createOrigin(c.UserContext(), &origin); err != nil {
+		if err == ErrOriginExists {
+			return apierrors.ErrCORSOriginExists
+		}
+		h.logError(err, "create_cors_origin", map[string]interface{}{"origin": origin.Origin})
+		return apierrors.ErrDatabase.WithMessage("Failed to create CORS origin")
+	}
+
+	return c.Status(201).JSON(origin)
+}
+
+// DeleteOrigin godoc
+// @Summary      Stop allowing a CORS origin (admin only)
+// @Tags         admin
+// @Security     Bearer
+// @Param        id   path  int  true  "Origin ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/cors/origins/{id} [delete]
+func (h *Handler) DeleteOrigin(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid origin ID")
+	}
+
+	if err := h.deleteOrigin(c.UserContext(), uint(id)); err != nil {
+		if err == ErrOriginNotFound {
+			return apierrors.ErrCORSOriginNotFound
+		}
+		h.logError(err, "delete_cors_origin", map[string]interface{}{"origin_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to delete CORS origin")
+	}
+
+	return c.SendStatus(204)
+}
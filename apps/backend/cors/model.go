@@ -0,0 +1,34 @@
+// Package cors stores the origins allowed to call the API from a browser.
+// Admins change the list at runtime; middleware.DynamicCORS reads it
+// through AllowedOrigins.
+package cors
+
+import (
+	"strings"
+	"time"
+)
+
+// Origin is a browser origin allowed to make cross-origin requests
+type Origin struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	Origin          string    `json:"origin" gorm:"not null;uniqueIndex"`
+	Active          bool      `json:"active" gorm:"not null;default:true"`
+	CreatedByUserID uint      `json:"created_by_user_id"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (Origin) TableName() string {
+	return "cors_origins"
+}
+
+// OriginRequest is the body for adding an origin
+type OriginRequest struct {
+	Origin string `json:"origin" validate:"required,origin" example:"https://app.example.com"`
+	Active *bool  `json:"active"`
+}
+
+// NormalizeOrigin returns origin the way browsers send it in the Origin
+// header: lowercase, without a trailing slash
+func NormalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
@@ -0,0 +1,125 @@
+package cors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+// Handler serves the CORS origin endpoints and loads the allowed origins,
+// caching them
+type Handler struct {
+	db    *gorm.DB
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler reading and writing origins in conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{db: conn, cache: c, log: log}
+}
+
+// CacheKey holds the active origins. Writes through the API drop it; it
+// expires after CacheTTL so rows changed in the database directly are
+// picked up too.
+const (
+	CacheKey = "cors:origins"
+	CacheTTL = 5 * time.Minute
+)
+
+var (
+	ErrOriginExists   = errors.New("origin already exists")
+	ErrOriginNotFound = errors.New("origin not found")
+	// ErrCacheUnavailable is returned by AllowedOrigins when Redis can't be
+	// read, as opposed to the key being missing
+	ErrCacheUnavailable = errors.New("origin cache unavailable")
+)
+
+func (h *Handler) listOrigins(ctx context.Context) ([]Origin, error) {
+	var origins []Origin
+	if err := h.db.WithContext(ctx).Order("origin").Find(&origins).Error; err != nil {
+		return nil, err
+	}
+	return origins, nil
+}
+
+func (h *Handler) createOrigin(ctx context.Context, origin *Origin) error {
+	var count int64
+	if err := h.db.WithContext(ctx).Model(&Origin{}).Where("origin = ?", origin.Origin).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrOriginExists
+	}
+
+	if err := h.db.WithContext(ctx).Create(origin).Error; err != nil {
+		return err
+	}
+	h.invalidate()
+	return nil
+}
+
+func (h *Handler) deleteOrigin(ctx context.Context, id uint) error {
+	result := h.db.WithContext(ctx).Delete(&Origin{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOriginNotFound
+	}
+	h.invalidate()
+	return nil
+}
+
+// AllowedOrigins returns the active origins, from the cache when it has
+// them and from the database on a miss. It returns ErrCacheUnavailable
+// without querying the database when Redis fails.
+func (h *Handler) AllowedOrigins(ctx context.Context) ([]string, error) {
+	if h.cache != nil {
+		var origins []string
+		err := h.cache.Get(CacheKey, &origins)
+		if err == nil {
+			metrics.RecordCacheOperation("get", "hit")
+			return origins, nil
+		}
+		if !errors.Is(err, cache.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrCacheUnavailable, err)
+		}
+		metrics.RecordCacheOperation("get", "miss")
+	}
+
+	origins := []string{}
+	if err := h.db.WithContext(ctx).Model(&Origin{}).Where("active = ?", true).Pluck("origin", &origins).Error; err != nil {
+		return nil, err
+	}
+	if h.cache != nil {
+		h.cache.Set(CacheKey, origins, CacheTTL)
+		metrics.RecordCacheOperation("set", "success")
+	}
+	return origins, nil
+}
+
+// invalidate drops the cached origins so a change applies to the next
+// request instead of after CacheTTL
+func (h *Handler) invalidate() {
+	if h.cache != nil {
+		h.cache.Delete(CacheKey)
+	}
+}
+
+func (h *Handler) logError(err error, operation string, fields map[string]interface{}) {
+	if h.log == nil {
+		return
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["operation"] = operation
+	h.log.LogError(err, fields)
+}
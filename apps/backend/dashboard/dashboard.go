@@ -0,0 +1,169 @@
+// Package dashboard serves the data of the admin dashboard: catalog totals
+// and the traffic of the last minute. Traffic is counted per instance, so
+// requests handled by other instances are not included.
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/ring"
+	"github.com/AtillaTahaK/gobooklibrary/report"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CacheTTL is how long the dashboard is cached, and how often clients
+// should poll it
+const CacheTTL = 5 * time.Second
+
+// CacheKey is the cache key of the dashboard
+const CacheKey = "admin:dashboard"
+
+const (
+	// topEndpoints is the number of endpoints listed at most
+	topEndpoints = 10
+	// recentErrors is the number of failed requests kept
+	recentErrors = 10
+)
+
+var (
+	// Requests counts the requests recorded by Record
+	Requests = NewRequestWindow()
+	// RecentErrors keeps the last requests Record saw fail with a 5xx status
+	RecentErrors = ring.New[RecentError](recentErrors)
+)
+
+// Handler serves the dashboard, counting totals in the database and caching
+// the result for CacheTTL
+type Handler struct {
+	db      *gorm.DB
+	reports *report.Handler
+	cache   cache.Cache
+	log     *logger.Logger
+}
+
+// NewHandler returns a Handler counting the catalog in conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{db: conn, reports: report.NewHandler(conn, log), cache: c, log: log}
+}
+
+// RecentError is a request that failed with a 5xx status
+type RecentError struct {
+	Timestamp time.Time `json:"timestamp"`
+	Path      string    `json:"path" example:"/books/7"`
+	Error     string    `json:"error" example:"Failed to fetch book"`
+}
+
+// Dashboard is the data of the admin dashboard. Requests are counted over
+// the last minute.
+type Dashboard struct {
+	BooksTotal        int64           `json:"books_total" example:"1500"`
+	UsersTotal        int64           `json:"users_total" example:"320"`
+	ActiveLoans       int64           `json:"active_loans" example:"42"`
+	CacheHitRatio     float64         `json:"cache_hit_ratio" example:"0.87"`
+	AvgResponseTimeMs float64         `json:"avg_response_time_ms" example:"18.4"`
+	RequestsPerMinute int64           `json:"requests_per_minute" example:"950"`
+	ErrorRatePercent  float64         `json:"error_rate_percent" example:"0.3"`
+	TopEndpoints      []EndpointStats `json:"top_endpoints"`
+	RecentErrors      []RecentError   `json:"recent_errors"`
+}
+
+// Record counts a request that completed now. route is the route pattern
+// the request matched, so /books/1 and /books/2 count as one endpoint, and
+// path the requested path. Requests with a 5xx status are kept as recent
+// errors with the message of err.
+func Record(method, route, path string, status int, duration time.Duration, err error) {
+	now := time.Now()
+	Requests.Record(now, method, route, status, duration)
+	if status < 500 {
+		return
+	}
+	message := http.StatusText(status)
+	if err != nil {
+		message = err.Error()
+	}
+	RecentErrors.Add(RecentError{Timestamp: now.UTC(), Path: path, Error: message})
+}
+
+// Collect counts the books, users and active loans and adds the traffic of
+// the last minute
+func (h *Handler) Collect(ctx context.Context) (*Dashboard, error) {
+	stats, err := h.reports.CountStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d := Dashboard{
+		BooksTotal:    stats.BooksTotal,
+		UsersTotal:    stats.UsersTotal,
+		CacheHitRatio: metrics.GetCacheMetrics().Ratio,
+		RecentErrors:  []RecentError{},
+	}
+	if err := h.db.WithContext(ctx).Model(&book.Loan{}).Where("returned_at IS NULL").Count(&d.ActiveLoans).Error; err != nil {
+		return nil, err
+	}
+
+	endpoints := Requests.Stats(time.Now())
+	var errors int64
+	var duration time.Duration
+	for _, endpoint := range endpoints {
+		d.RequestsPerMinute += endpoint.Count
+		errors += endpoint.errors
+		duration += endpoint.duration
+	}
+	d.AvgResponseTimeMs = averageMs(duration, d.RequestsPerMinute)
+	if d.RequestsPerMinute > 0 {
+		d.ErrorRatePercent = math.Round(float64(errors)*1e4/float64(d.RequestsPerMinute)) / 100
+	}
+	if len(endpoints) > topEndpoints {
+		endpoints = endpoints[:topEndpoints]
+	}
+	d.TopEndpoints = endpoints
+
+	// Newest first
+	recent := RecentErrors.Items()
+	for i := len(recent) - 1; i >= 0; i-- {
+		d.RecentErrors = append(d.RecentErrors, recent[i])
+	}
+	return &d, nil
+}
+
+// GetDashboard godoc
+// @Summary      Dashboard data (admin only)
+// @Description  Book, user and active loan totals, the cache hit ratio, and the requests of the last minute on this instance: their rate, average response time and 5xx error rate, the 10 busiest endpoints and the last 10 failed requests. The data is cached for 5 seconds, which is how often clients should poll.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} Dashboard
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/dashboard [get]
+func (h *Handler) GetDashboard(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", int(CacheTTL.Seconds())))
+
+	var cached Dashboard
+	if h.cache != nil && h.cache.Get(CacheKey, &cached) == nil {
+		return c.JSON(cached)
+	}
+	d, err := h.Collect(c.UserContext())
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "collect_dashboard"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to collect dashboard data")
+	}
+	if h.cache != nil {
+		h.cache.Set(CacheKey, d, CacheTTL)
+	}
+	return c.JSON(d)
+}
@@ -0,0 +1,121 @@
+package dashboard
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Window is how far back the request counts of the dashboard reach
+const Window = time.Minute
+
+// windowBuckets is the number of one-second buckets in Window
+const windowBuckets = int64(Window / time.Second)
+
+// bucket counts the requests of one second
+type bucket struct {
+	second   int64
+	count    int64
+	errors   int64
+	duration time.Duration
+}
+
+// endpointWindow is the buckets of one endpoint, reused round-robin
+type endpointWindow struct {
+	mu      sync.Mutex
+	buckets [windowBuckets]bucket
+}
+
+type endpointKey struct {
+	method string
+	path   string
+}
+
+// RequestWindow counts requests per method and route over the last minute
+type RequestWindow struct {
+	endpoints sync.Map
+}
+
+// NewRequestWindow creates a window without requests
+func NewRequestWindow() *RequestWindow {
+	return &RequestWindow{}
+}
+
+// EndpointStats are the requests to one endpoint in the last minute
+type EndpointStats struct {
+	Method string  `json:"method" example:"GET"`
+	Path   string  `json:"path" example:"/books/:id"`
+	Count  int64   `json:"count" example:"120"`
+	AvgMs  float64 `json:"avg_ms" example:"12.5"`
+
+	errors   int64
+	duration time.Duration
+}
+
+// Record counts a request to path that completed at at. A status of 500 or
+// above counts as an error.
+func (w *RequestWindow) Record(at time.Time, method, path string, status int, duration time.Duration) {
+	value, _ := w.endpoints.LoadOrStore(endpointKey{method, path}, &endpointWindow{})
+	endpoint := value.(*endpointWindow)
+
+	second := at.Unix()
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	b := &endpoint.buckets[second%windowBuckets]
+	if b.second != second {
+		*b = bucket{second: second}
+	}
+	b.count++
+	b.duration += duration
+	if status >= 500 {
+		b.errors++
+	}
+}
+
+// Stats returns the endpoints requested in the minute up to now, busiest
+// first
+func (w *RequestWindow) Stats(now time.Time) []EndpointStats {
+	since := now.Unix() - windowBuckets
+	stats := []EndpointStats{}
+	w.endpoints.Range(func(key, value interface{}) bool {
+		k := key.(endpointKey)
+		endpoint := value.(*endpointWindow)
+		s := EndpointStats{Method: k.method, Path: k.path}
+
+		endpoint.mu.Lock()
+		for _, b := range endpoint.buckets {
+			if b.second > since && b.second <= now.Unix() {
+				s.Count += b.count
+				s.errors += b.errors
+				s.duration += b.duration
+			}
+		}
+		endpoint.mu.Unlock()
+
+		if s.Count > 0 {
+			s.AvgMs = averageMs(s.duration, s.Count)
+			stats = append(stats, s)
+		}
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		if stats[i].Path != stats[j].Path {
+			return stats[i].Path < stats[j].Path
+		}
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+// averageMs is the mean of count requests taking total in milliseconds,
+// rounded to the microsecond
+func averageMs(total time.Duration, count int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Round(float64(total.Microseconds())/float64(count)) / 1000
+}
@@ -2,35 +2,64 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/AtillaTahaK/gobooklibrary/activity"
 	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/author"
 	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/cors"
+	"github.com/AtillaTahaK/gobooklibrary/dashboard"
 	_ "github.com/AtillaTahaK/gobooklibrary/docs"
 	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/analytics"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/batch"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/container"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db/migrations"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/external/googlebooks"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/geo"
+	grpcserver "github.com/AtillaTahaK/gobooklibrary/pkg/grpc"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/health"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/jobs"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/mail"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/ratelimit"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/requestlog"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/seed"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/startup"
+	"github.com/AtillaTahaK/gobooklibrary/report"
 	"github.com/AtillaTahaK/gobooklibrary/url"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	fiberLogger "github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
+	"gorm.io/gorm"
 )
 
 // Global instances
 var (
 	AppLogger  *logger.Logger
-	RedisCache *cache.RedisCache
+	RedisCache cache.Cache
 )
 
 
@@ -43,6 +72,10 @@ var (
 // @in header
 // @name Authorization
 func main() {
+    seedOnly := flag.Bool("seed", false, "Apply the seed manifest (SEED_FILE, default "+seed.DefaultFile+") and exit")
+    dryRun := flag.Bool("dry-run", false, "Report what seeding would create or update without writing")
+    flag.Parse()
+
     // Load environment variables
     if err := godotenv.Load(".env.local"); err != nil {
         if err := godotenv.Load(); err != nil {
@@ -50,65 +83,278 @@ func main() {
         }
     }
 
-    // Initialize logger
+    // Time each initialization step; the timeline is logged as one entry once
+    // startup is done and served at /admin/startup-timeline
+    timeline := startup.NewTimeline()
     AppLogger = logger.NewLogger()
     AppLogger.Info("🚀 Starting Book Library API...")
 
-    // Initialize Redis cache (with fallback if Redis is not available)
-    redisAddr := getEnv("REDIS_URL", "localhost:6379")
-    redisPassword := getEnv("REDIS_PASSWORD", "")
-    RedisCache = cache.NewRedisCache(redisAddr, redisPassword, 0)
-    AppLogger.Info("✅ Redis cache initialized")
+    // Initialize the Redis cache (with fallback if Redis is not available)
+    // and database connection, and hand them to the packages
+    var redisCache cache.Cache
+    redisErr := timeline.Record("redis", func() error {
+        redisCache = cache.NewCacheFromEnv()
+        return redisCache.Ping()
+    })
+    var conn *gorm.DB
+    if err := timeline.Record("database", func() (err error) {
+        conn, err = db.Open()
+        return err
+    }); err != nil {
+        AppLogger.Fatal("Failed to connect to database", withError(timeline.Fields(), err))
+    }
+    services, err := container.New(container.Config{Logger: AppLogger, Cache: redisCache, DB: conn})
+    if err != nil {
+        log.Fatal(err)
+    }
+    RedisCache = services.Cache
+    if redisErr != nil {
+        AppLogger.Warn("Redis unavailable; the cache reconnects when it is back", map[string]interface{}{"error": redisErr.Error()})
+    } else {
+        AppLogger.Info("✅ Redis cache initialized")
+    }
 
-    // Set global instances for book package
-    book.Cache = RedisCache
-    book.Log = AppLogger
-    auth.Log = AppLogger
+    // Tokens can't be issued or verified with a broken key setup
+    signer, err := tokens.SignerFromEnv()
+    if err != nil {
+        AppLogger.Fatal("Invalid JWT configuration", map[string]interface{}{"error": err.Error()})
+    }
+    tokens.SetSigner(signer)
+
+    book.SlidingCacheTTL = getEnv("CACHE_SLIDING_TTL", "false") == "true"
+    book.SpeculativeSearch = getEnv("SEARCH_SPECULATIVE", "false") == "true"
+    book.XFetchCache = getEnv("CACHE_XFETCH_ENABLED", "false") == "true"
+    if raw := os.Getenv("TRENDING_VELOCITY_THRESHOLD"); raw != "" {
+        if threshold, err := strconv.ParseFloat(raw, 64); err != nil || threshold < 0 {
+            AppLogger.Warn("Ignoring invalid TRENDING_VELOCITY_THRESHOLD", map[string]interface{}{"value": raw})
+        } else {
+            analytics.VelocityThreshold = threshold
+        }
+    }
+    book.NotifyChanges = getEnv("CACHE_INVALIDATION_NOTIFY", "false") == "true"
+    if raw := os.Getenv("BOOKS_STREAM_FLUSH_INTERVAL"); raw != "" {
+        if interval, err := time.ParseDuration(raw); err != nil || interval < 0 {
+            AppLogger.Warn("Ignoring BOOKS_STREAM_FLUSH_INTERVAL", map[string]interface{}{"value": raw})
+        } else {
+            book.StreamFlushInterval = interval
+        }
+    }
+    googleBooks, err := googlebooks.NewClientFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid external HTTP configuration", map[string]interface{}{"error": err.Error()})
+    }
+    book.GoogleBooks = googleBooks
+    threshold, err := dedup.ThresholdFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid duplicate detection configuration", map[string]interface{}{"error": err.Error()})
+    }
+    book.Duplicates = dedup.NewDuplicateDetector(threshold)
+    mailConfig, err := mail.ConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid SMTP configuration; scheduled reports won't be sent", map[string]interface{}{"error": err.Error()})
+        mailConfig = mail.Config{}
+    }
+    report.Mailer = mail.NewSMTPSender(mailConfig)
+    geoUpdater := geo.UpdaterConfigFromEnv()
+    if err := geo.LoadLatest(geo.Default, geoUpdater.Path); err != nil {
+        AppLogger.Warn("Ignoring unreadable GeoIP database", map[string]interface{}{"error": err.Error()})
+    }
+    if !geo.Default.Loaded() && !geoUpdater.Enabled() {
+        AppLogger.Warn("No GeoIP database; every client's country is unknown", map[string]interface{}{"path": geoUpdater.Path})
+    }
+    auth.AnonymizeOnDelete = getEnv("GDPR_ANONYMIZE", "false") == "true"
+    url.StripTrailingSlash = getEnv("URL_STRIP_TRAILING_SLASH", "true") != "false"
+    authHandler := services.AuthHandler()
+    bookHandler := services.BookHandler()
+    activityHandler := services.ActivityHandler()
+    authorHandler := services.AuthorHandler()
+    searchHandler := services.SearchHandler()
+    webhookHandler := services.WebhookHandler()
+    reportHandler := services.ReportHandler()
+    dashboardHandler := services.DashboardHandler()
+    privacyHandler := services.PrivacyHandler()
+    corsHandler := services.CORSHandler()
+    maintenanceHandler := services.MaintenanceHandler()
+    analyticsHandler := services.AnalyticsHandler()
+    geoHandler := services.GeoHandler()
+    jobRunner := services.JobRunner()
+    middleware.SessionRevoked = authHandler.IsSessionRevoked
+    middleware.LoadUser = authHandler.LoadCurrentUser
+    if raw := os.Getenv("BCRYPT_COST"); raw != "" {
+        if cost, err := auth.ParseBcryptCost(raw); err != nil {
+            AppLogger.Warn("Ignoring BCRYPT_COST", map[string]interface{}{"error": err.Error()})
+        } else {
+            auth.BcryptCost = cost
+        }
+    }
+    if err := metrics.InitMetrics(); err != nil {
+        AppLogger.Warn("Ignoring METRICS_HTTP_BUCKETS", map[string]interface{}{"error": err.Error()})
+    }
+    if raw := os.Getenv("SLO_TARGETS"); raw != "" {
+        if targets, err := metrics.ParseSLOTargets(raw); err != nil {
+            AppLogger.Warn("Ignoring SLO_TARGETS", map[string]interface{}{"error": err.Error()})
+        } else {
+            metrics.SLO.SetTargets(targets)
+        }
+    }
 
-    // Initialize database connection
-    db.ConnectDB()
     AppLogger.Info("✅ Database connected")
 
     // Run auto migrations
-    db.AutoMigrate(&auth.User{}, &book.Book{})
+    if err := timeline.Record("migrations", func() error {
+        if err := services.DB.AutoMigrate(&auth.User{}, &book.Book{}, &book.Series{}, &book.SeriesEntry{}, &author.Author{}, &book.Genre{}, &book.Bookmark{}, &book.SearchHistory{}, &webhook.Webhook{}, &webhook.Delivery{}, &webhook.DeadLetter{}, &auth.Session{}, &book.BookChange{}, &book.Loan{}, &book.Rating{}, &book.ReadingStatus{}, &book.Annotation{}, &book.SyncHistory{}, &report.ScheduledReport{}, &cors.Origin{}); err != nil {
+            return fmt.Errorf("failed to migrate database: %w", err)
+        }
+        return migrations.Run(services.DB)
+    }); err != nil {
+        AppLogger.Fatal("Failed to run migrations", withError(timeline.Fields(), err))
+    }
     AppLogger.Info("✅ Database migrations completed")
 
-    AppLogger.Info("✅ Database seeded")
+    // Seed from SEED_FILE at startup, or from the default manifest with --seed.
+    // Seeding is idempotent, so re-running it only adds what is missing.
+    if *seedOnly || os.Getenv("SEED_FILE") != "" {
+        path := getEnv("SEED_FILE", seed.DefaultFile)
+        var report *seed.Report
+        if err := timeline.Record("seed", func() (err error) {
+            report, err = seed.SeedFromFile(context.Background(), services.DB, path, *dryRun)
+            return err
+        }); err != nil {
+            fields := withError(timeline.Fields(), err)
+            fields["file"] = path
+            AppLogger.Fatal("Failed to seed the database", fields)
+        }
+        for _, change := range report.Changes {
+            AppLogger.Info("Seed "+change.Action, map[string]interface{}{"kind": change.Kind, "key": change.Key, "dry_run": report.DryRun})
+        }
+        AppLogger.Info("✅ Database seeded", map[string]interface{}{
+            "file":      path,
+            "dry_run":   report.DryRun,
+            "created":   report.Count(seed.ActionCreate),
+            "updated":   report.Count(seed.ActionUpdate),
+            "unchanged": report.Count(seed.ActionUnchanged),
+        })
+    }
+    AppLogger.Info("Startup timeline", timeline.Fields())
+    if *seedOnly {
+        return
+    }
 
     // Create Fiber app
     app := fiber.New(fiber.Config{
         ErrorHandler: func(c *fiber.Ctx, err error) error {
             code := fiber.StatusInternalServerError
-            if e, ok := err.(*fiber.Error); ok {
-                code = e.Code
+            var apiErr *apierrors.APIError
+            var fiberErr *fiber.Error
+            if errors.As(err, &apiErr) {
+                code = apiErr.HTTPStatus
+            } else if errors.As(err, &fiberErr) {
+                code = fiberErr.Code
             }
 
             // Log error
-            AppLogger.LogError(err, map[string]interface{}{
+            fields := map[string]interface{}{
                 "method": c.Method(),
                 "path":   c.Path(),
                 "ip":     c.IP(),
                 "status": code,
-            })
+            }
+            for k, v := range middleware.TraceFields(c) {
+                fields[k] = v
+            }
+            for k, v := range middleware.BaggageFields(c) {
+                fields[k] = v
+            }
+            AppLogger.LogError(err, fields)
 
-            return c.Status(code).JSON(fiber.Map{
-                "error": err.Error(),
-                "timestamp": time.Now().UTC(),
-            })
+            return apierrors.Respond(c, err)
         },
     })
 
     // Add middleware
+    // Stop the queries of requests whose client hung up; first so every
+    // later context derives from it
+    app.Use(middleware.CancelOnClientClose())
+    // Continue the caller's W3C trace so logs and webhooks can be correlated
+    app.Use(middleware.TraceContext())
+    // Carry the caller's W3C baggage into logs and outbound calls
+    app.Use(middleware.Baggage())
     app.Use(fiberLogger.New(fiberLogger.Config{
         Format: "${time} ${method} ${path} ${status} ${latency} ${ip}\n",
     }))
 
-    app.Use(cors.New(cors.Config{
-        AllowOrigins: "*",
-        AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-        AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+    // Let browsers read the pagination headers; it wraps CORS so it can
+    // extend the exposed headers CORS sets
+    app.Use(middleware.ExposeHeaders(append(middleware.PaginationHeaders, middleware.DeprecationHeaders...)...))
+    // Allowed origins are managed at /admin/cors/origins; the ones in
+    // CORS_ALLOWED_ORIGINS are always allowed, and are the only ones while
+    // Redis is down
+    corsConfig := middleware.CORSConfigFromEnv()
+    corsConfig.Origins = corsHandler.AllowedOrigins
+    corsConfig.AllowMethods = "GET,POST,PUT,DELETE,OPTIONS"
+    corsConfig.AllowHeaders = "Origin, Content-Type, Accept, Authorization, traceparent, tracestate, baggage"
+    corsConfig.ExposeHeaders = "traceparent"
+    app.Use(middleware.DynamicCORS(corsConfig))
+
+    // Compress responses of 1KB or more with Brotli or gzip
+    compression, err := middleware.CompressionConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid compression configuration", map[string]interface{}{"error": err.Error()})
+        compression = middleware.CompressionConfig{}
+    }
+    app.Use(middleware.Compression(compression))
+
+    // XML for clients that ask for it; handlers only write JSON, apart from
+    // the streams that write their own media type
+    app.Use(middleware.ContentNegotiation(middleware.ContentNegotiationConfig{
+        Passthrough: []string{requestlog.ContentTypeEventStream, book.ContentTypeNDJSON},
     }))
 
+    // Wrap lists as {"data": [...], "total": n} when configured or asked for
+    envelope, err := middleware.EnvelopeConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid response envelope configuration", map[string]interface{}{"error": err.Error()})
+        envelope = middleware.EnvelopeConfig{}
+    }
+    app.Use(middleware.Envelope(envelope))
+
+    // Resolve the client's country for metrics, logs and analytics, and turn
+    // away blocked countries before they use up any rate limit
+    geoConfig, err := middleware.GeoConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid geolocation configuration", map[string]interface{}{"error": err.Error()})
+        geoConfig = middleware.GeoConfig{RecordAnalytics: true}
+    }
+    geoConfig.Analytics = geoHandler
+    app.Use(middleware.GeoLocation(geoConfig))
+
+    // Per-user, or per-IP without a token, rate limit with counters shared
+    // through Redis. Exempt IP ranges and service keys skip it.
+    rateLimit, err := middleware.RateLimitConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid rate limit configuration", map[string]interface{}{"error": err.Error()})
+        rateLimit = middleware.RateLimitConfig{}
+    }
+    rateLimit.Storage = middleware.CacheStorage(RedisCache)
+    rateLimit.Cache = RedisCache
+    rateLimit.Log = AppLogger
+    // Limits stored in Redis by PUT /admin/ratelimit/config override the
+    // environment's
+    rateLimits := ratelimit.NewConfigSource(RedisCache, rateLimit.DefaultLimits(), ratelimit.ConfigReloadInterval)
+    rateLimit.Limits = rateLimits
+    app.Use(middleware.RateLimit(rateLimit))
+
+    // Strip HTML and control characters from JSON bodies before handlers parse them
+    app.Use(middleware.Sanitize())
+
+    // Recent requests for GET /admin/requests/live
+    tailSize, err := strconv.Atoi(getEnv("REQUEST_TAIL_BUFFER", strconv.Itoa(requestlog.DefaultBufferSize)))
+    if err != nil || tailSize < 1 {
+        AppLogger.Warn("Ignoring invalid REQUEST_TAIL_BUFFER", map[string]interface{}{"value": os.Getenv("REQUEST_TAIL_BUFFER")})
+        tailSize = requestlog.DefaultBufferSize
+    }
+    requestTail := requestlog.NewTail(tailSize)
+
     // Metrics middleware
     app.Use(func(c *fiber.Ctx) error {
         start := time.Now()
@@ -117,14 +363,21 @@ func main() {
 
         duration := time.Since(start)
         status := c.Response().StatusCode()
+        if err != nil {
+            // The error handler hasn't written the response yet
+            status = apierrors.Status(err)
+        }
 
         // Record metrics
         metrics.RecordHTTPRequest(
             c.Method(),
             c.Path(),
             fmt.Sprintf("%d", status),
+            middleware.Country(c),
             duration,
         )
+        // SLO targets are per route, so /books/1 and /books/2 share one budget
+        metrics.RecordSLO(c.Method()+" "+c.Route().Path, duration)
 
         // Log request
         AppLogger.LogRequest(
@@ -134,7 +387,12 @@ func main() {
             c.Get("User-Agent"),
             status,
             duration,
+            middleware.TraceFields(c),
+            middleware.BaggageFields(c),
+            middleware.GeoFields(c),
         )
+        requestTail.Publish(requestlog.NewEvent(c.Method(), c.Path(), status, duration, c.IP()))
+        dashboard.Record(c.Method(), c.Route().Path, c.Path(), status, duration, err)
 
         return err
     })
@@ -145,36 +403,20 @@ func main() {
     // Swagger documentation
     app.Get("/swagger/*", fiberSwagger.WrapHandler)
 
-    // Health check with detailed status
-    app.Get("/health", func(c *fiber.Ctx) error {
-        // Check database connection
-        sqlDB, err := db.DB.DB()
-        if err != nil {
-            return c.Status(503).JSON(fiber.Map{
-                "status": "unhealthy",
-                "database": "disconnected",
-                "error": err.Error(),
-            })
-        }
-
-        // Check Redis connection
-        _, err = RedisCache.GetStats()
-        redisStatus := "connected"
-        if err != nil {
-            redisStatus = "disconnected"
-        }
-
-        return c.JSON(fiber.Map{
-            "status": "healthy",
-            "message": "Book Library API is running!",
-            "version": "1.0",
-            "database": "PostgreSQL with GORM",
-            "cache": "Redis",
-            "redis_status": redisStatus,
-            "connections": sqlDB.Stats(),
-            "timestamp": time.Now().UTC(),
-        })
-    })
+    // Health check; each package's dependency probe reports under its own name
+    health.Register(db.HealthChecker{DB: services.DB}, cache.HealthChecker{Cache: RedisCache})
+    app.Get("/health", health.Handler(nil))
+    app.Get("/health/live", health.LiveHandler())
+    app.Get("/health/ready", health.ReadyHandler(nil))
+    app.Get("/health/goroutines", middleware.JWTOptional(), middleware.InjectUser(), health.GoroutinesHandler(middleware.IsAdmin))
+
+    // Every external dependency with its own timeout; Google Books and SMTP
+    // failing doesn't degrade the API
+    health.DatabaseProbe = db.HealthChecker{DB: services.DB}
+    health.RedisProbe = cache.HealthChecker{Cache: RedisCache}
+    health.GoogleBooksProbe = googlebooks.HealthChecker{Client: googleBooks}
+    health.SMTPProbe = mail.HealthChecker{Config: mailConfig}
+    app.Get("/health/dependencies", health.ProbesHandler())
 
     app.Get("/", func(c *fiber.Ctx) error {
         return c.JSON(fiber.Map{
@@ -187,27 +429,95 @@ func main() {
     })
 
 
-    app.Post("/auth/register", auth.Register)
-    app.Post("/auth/login", auth.Login)
-    app.Post("/url/clean", url.CleanURLHandler)
-
-    app.Get("/books", book.GetBooks)
-    app.Get("/books/:id", book.GetBook)
+    // The unversioned routes below are API v1. Once DEPRECATION_SUNSET_V1 is
+    // set, their responses announce the date they go away.
+    if raw := os.Getenv("DEPRECATION_SUNSET_V1"); raw != "" {
+        if sunset, err := middleware.ParseSunsetDate(raw); err != nil {
+            AppLogger.Warn("Ignoring DEPRECATION_SUNSET_V1", map[string]interface{}{"error": err.Error()})
+        } else {
+            middleware.SuccessorVersionURL = os.Getenv("DEPRECATION_SUCCESSOR_URL_V1")
+            message := getEnv("DEPRECATION_MESSAGE_V1", "API v1 is deprecated and will be removed on "+sunset.Format("2006-01-02"))
+            app.Use(middleware.Deprecation(message, raw))
+        }
+    }
 
+    app.Post("/auth/register", authHandler.Register)
+    app.Post("/auth/login", authHandler.Login)
+    app.Post("/url/clean", url.CleanURLHandler)
 
-    protected := app.Group("/", middleware.JWTProtected())
-    protected.Post("/books", book.AddBookHandler)
-    protected.Put("/books/:id", book.UpdateBookHandler)
-    protected.Delete("/books/:id", book.DeleteBookHandler)
+    app.Get("/books", middleware.JWTOptional(), bookHandler.GetBooks)
+    // Before /books/:id so "export", "new", "popular" and "trending" aren't taken for a book ID
+    app.Get("/books/export", middleware.JWTProtected(), middleware.InjectUser(), middleware.RequireAdmin(), bookHandler.ExportBooks)
+    app.Get("/books/stream", bookHandler.StreamBooks)
+    app.Get("/books/new", bookHandler.GetNewBooks)
+    app.Get("/books/popular", bookHandler.GetPopularBooks)
+    app.Get("/books/trending", analyticsHandler.GetTrendingBooks)
+    app.Get("/books/leaderboard", bookHandler.GetLeaderboard)
+    app.Get("/books/leaderboard/all-time", bookHandler.GetAllTimeLeaderboard)
+    app.Get("/books/:id", middleware.JWTOptional(), bookHandler.GetBook)
+    app.Get("/books/:id/cover", bookHandler.GetCover)
+    app.Get("/books/:id/cover/placeholder", bookHandler.GetCoverPlaceholder)
+    app.Get("/series", bookHandler.GetSeriesList)
+    app.Get("/series/:id/books", bookHandler.GetSeriesBooks)
+    app.Get("/genres", bookHandler.ListGenres)
+    app.Get("/authors", authorHandler.GetAuthors)
+    app.Get("/authors/:id", authorHandler.GetAuthor)
+    app.Get("/authors/:id/books", authorHandler.GetAuthorBooks)
+    app.Get("/users/:id/books", bookHandler.GetUserBooks)
+    app.Get("/search", searchHandler.Search)
+    app.Get("/search/suggest", searchHandler.Suggest)
+
+    // Browsers can't set headers on WebSockets, so the token may come in
+    // the query; registered before the protected group, which reads headers
+    app.Get("/ws/me/activity", middleware.TokenFromQuery(), middleware.JWTProtected(), activity.UpgradeHandler, activity.StreamHandler)
+    // Nor on EventSource
+    app.Get("/admin/requests/live", middleware.TokenFromQuery(), middleware.JWTProtected(), middleware.InjectUser(), middleware.RequireAdmin(), requestlog.LiveHandler(requestTail))
+
+    // Several API calls in one request; each operation carries its own auth
+    batchConcurrency, err := batch.ConcurrencyFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid BATCH_CONCURRENCY", map[string]interface{}{"error": err.Error()})
+    }
+    app.Post(batch.Path, batch.Handler(app, batchConcurrency))
+
+
+    protected := app.Group("/", middleware.JWTProtected(), middleware.InjectUser())
+    protected.Post("/books", bookHandler.AddBook)
+    protected.Post("/books/lookup", bookHandler.LookupBook)
+    protected.Put("/books/:id", bookHandler.UpdateBook)
+    protected.Delete("/books/:id", bookHandler.DeleteBook)
+    protected.Put("/books/:id/rating", bookHandler.RateBook)
+    protected.Put("/books/:id/reading-status", bookHandler.SetReadingStatus)
+    protected.Get("/books/:id/history", bookHandler.GetBookHistory)
+    protected.Post("/books/:id/annotations", bookHandler.CreateAnnotation)
+    protected.Get("/books/:id/annotations", bookHandler.GetBookAnnotations)
+    protected.Put("/annotations/:id", bookHandler.UpdateAnnotation)
+    protected.Delete("/annotations/:id", bookHandler.DeleteAnnotation)
+    protected.Post("/books/:id/bookmark", bookHandler.AddBookmark)
+    protected.Delete("/books/:id/bookmark", bookHandler.RemoveBookmark)
+    protected.Post("/books/:id/checkout", bookHandler.CheckoutBook)
+    protected.Put("/loans/:id/return", bookHandler.ReturnLoan)
+    protected.Get("/series/:id/progress", bookHandler.GetSeriesProgress)
+    protected.Post("/me/delete-account", authHandler.DeleteMyAccount)
+    protected.Get("/me/permissions", authHandler.GetMyPermissions)
+    protected.Get("/me/sessions", authHandler.ListMySessions)
+    protected.Delete("/me/sessions", authHandler.RevokeMyOtherSessions)
+    protected.Delete("/me/sessions/:id", authHandler.RevokeMySession)
+    protected.Get("/me/activity", activityHandler.GetMyActivity)
+    protected.Get("/me/export", privacyHandler.ExportMyData)
+    protected.Get("/me/bookmarks", bookHandler.GetMyBookmarks)
+    protected.Get("/me/annotations", bookHandler.GetMyAnnotations)
+    protected.Get("/me/series/in-progress", bookHandler.GetMySeriesInProgress)
+    protected.Get("/me/search-history", bookHandler.GetMySearchHistory)
+    protected.Delete("/me/search-history", bookHandler.ClearMySearchHistory)
+    protected.Delete("/me/search-history/:id", bookHandler.ClearMySearchHistory)
 
     admin := protected.Group("/", middleware.RequireAdmin())
     admin.Get("/admin/users", func(c *fiber.Ctx) error {
         var users []auth.User
-        result := db.DB.Find(&users)
+        result := services.DB.Find(&users)
         if result.Error != nil {
-            return c.Status(500).JSON(fiber.Map{
-                "error": "Failed to fetch users",
-            })
+            return apierrors.ErrDatabase.WithMessage("Failed to fetch users")
         }
 
         for i := range users {
@@ -220,23 +530,91 @@ func main() {
         })
     })
 
-    admin.Get("/admin/stats", func(c *fiber.Ctx) error {
-        var bookCount int64
-        var userCount int64
-
-        db.DB.Model(&book.Book{}).Count(&bookCount)
-        db.DB.Model(&auth.User{}).Count(&userCount)
-
-        // Update metrics
-        metrics.SetBooksTotal(float64(bookCount))
-        metrics.SetUsersTotal(float64(userCount))
-
-        return c.JSON(fiber.Map{
-            "books_total": bookCount,
-            "users_total": userCount,
-            "timestamp": time.Now().UTC(),
+    admin.Get("/admin/users/deleted", authHandler.ListDeletedUsers)
+    admin.Get("/admin/users/export", authHandler.ExportUsers)
+    admin.Post("/admin/users/cleanup", authHandler.CleanupUsers)
+    admin.Get("/admin/users/cleanup/schedule", authHandler.GetCleanupSchedule)
+    admin.Post("/admin/users/cleanup/schedule", authHandler.ScheduleCleanup)
+    admin.Post("/admin/users/upgrade-password-cost", authHandler.UpgradePasswordCost)
+    admin.Delete("/admin/users/:id", authHandler.DeleteUser)
+    admin.Post("/admin/users/:id/restore", authHandler.RestoreUser)
+    admin.Get("/admin/users/:id/sessions", authHandler.ListUserSessions)
+    admin.Get("/admin/users/:id/export", privacyHandler.ExportUserData)
+    admin.Get("/admin/stats/popular-bookmarks", bookHandler.GetPopularBookmarks)
+    admin.Get("/admin/reports/active-users", authHandler.GetActiveUsersReport)
+    admin.Get("/admin/reports/new-users", authHandler.GetNewUsersReport)
+    admin.Post("/admin/reports/schedule", reportHandler.ScheduleReport)
+    admin.Get("/admin/reports/scheduled", reportHandler.ListScheduledReports)
+    admin.Delete("/admin/reports/scheduled/:id", reportHandler.DeleteScheduledReport)
+    admin.Get("/admin/searches/popular", bookHandler.GetPopularSearches)
+    admin.Get("/admin/activity/feed", activityHandler.GetActivityFeed)
+    admin.Post("/series", bookHandler.CreateSeries)
+    admin.Post("/series/:id/books", bookHandler.AddSeriesBooks)
+    admin.Post("/admin/books/sync", bookHandler.SyncBooks)
+    admin.Post("/admin/books/reindex", bookHandler.StartReindex)
+    admin.Get("/admin/books/reindex/status", bookHandler.GetReindexStatus)
+    admin.Delete("/admin/books/reindex", bookHandler.CancelReindex)
+    admin.Put("/books/:id/status", bookHandler.SetBookStatus)
+    admin.Get("/admin/cache/integrity", bookHandler.CheckCacheIntegrity)
+    admin.Post("/admin/cache/integrity/fix", bookHandler.FixCacheIntegrity)
+    cacheAnalysis, err := cache.AnalysisConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid cache analysis configuration", map[string]interface{}{"error": err.Error()})
+    }
+    admin.Get("/admin/cache/analysis", cache.AnalysisHandler(RedisCache, cacheAnalysis))
+    admin.Post("/authors", authorHandler.CreateAuthor)
+    admin.Put("/authors/:id", authorHandler.UpdateAuthor)
+    admin.Get("/admin/cors/origins", corsHandler.ListOrigins)
+    admin.Post("/admin/cors/origins", corsHandler.CreateOrigin)
+    admin.Delete("/admin/cors/origins/:id", corsHandler.DeleteOrigin)
+    admin.Get("/admin/webhooks", webhookHandler.ListWebhooks)
+    admin.Post("/admin/webhooks", webhookHandler.CreateWebhook)
+    admin.Get("/admin/webhooks/dlq", webhookHandler.ListDeadLetters)
+    admin.Post("/admin/webhooks/dlq/:id/retry", webhookHandler.RetryDeadLetter)
+    admin.Delete("/admin/webhooks/dlq/:id", webhookHandler.DeleteDeadLetter)
+    admin.Get("/admin/webhooks/:id", webhookHandler.GetWebhook)
+    admin.Put("/admin/webhooks/:id", webhookHandler.UpdateWebhook)
+    admin.Delete("/admin/webhooks/:id", webhookHandler.DeleteWebhook)
+    admin.Get("/admin/webhooks/:id/deliveries", webhookHandler.GetDeliveries)
+    admin.Get("/admin/logger/level", logger.GetLevelHandler(AppLogger))
+    admin.Put("/admin/logger/level", logger.SetLevelHandler(AppLogger))
+    admin.Get("/admin/logger/config", logger.GetConfigHandler(AppLogger))
+    admin.Get("/admin/slo", metrics.GetSLOHandler(metrics.SLO))
+    admin.Get("/admin/startup-timeline", startup.Handler(timeline))
+    admin.Get("/admin/connections", pubsub.ConnectionsHandler(pubsub.Connections))
+    admin.Get("/admin/ratelimit/config", ratelimit.GetConfigHandler(rateLimits))
+    admin.Put("/admin/ratelimit/config", ratelimit.UpdateConfigHandler(rateLimits, func(c *fiber.Ctx, previous, config ratelimit.Config) {
+        username := ""
+        if user, ok := middleware.CurrentUser(c); ok {
+            username = user.GetUsername()
+        }
+        AppLogger.Warn("Rate limits changed", map[string]interface{}{
+            "event": "admin_audit",
+            "admin": username,
+            "ip":    c.IP(),
+            "from":  previous,
+            "to":    config,
         })
-    })
+    }))
+    admin.Get("/admin/metrics/graphite", metrics.GraphiteHandler(prometheus.DefaultGatherer))
+    admin.Post("/admin/metrics/reset", metrics.ResetHandler(services.Metrics, func(c *fiber.Ctx) {
+        username := ""
+        if user, ok := middleware.CurrentUser(c); ok {
+            username = user.GetUsername()
+        }
+        AppLogger.Warn("Metrics reset", map[string]interface{}{
+            "event": "admin_audit",
+            "admin": username,
+            "ip":    c.IP(),
+        })
+    }))
+    admin.Post("/admin/db/analyze", maintenanceHandler.Analyze)
+    admin.Post("/admin/db/vacuum", maintenanceHandler.Vacuum)
+    admin.Get("/admin/db/jobs/:id", maintenanceHandler.GetJob)
+
+    admin.Get("/admin/stats", reportHandler.GetStats)
+    admin.Get("/admin/dashboard", dashboardHandler.GetDashboard)
+    admin.Get("/admin/analytics/countries", geoHandler.GetCountryStats)
 
     // Graceful shutdown
     c := make(chan os.Signal, 1)
@@ -256,8 +634,89 @@ func main() {
         }
     }()
 
+    // gRPC server
+    grpcServer := grpcserver.NewServer(services.BookService(), webhookHandler, services.Cache, services.Log)
+    go func() {
+        grpcAddr := ":" + getEnv("GRPC_PORT", "50051")
+        AppLogger.Info("🚀 gRPC server starting on " + grpcAddr)
+
+        if err := grpcserver.ListenAndServe(grpcServer, grpcAddr); err != nil {
+            AppLogger.LogError(err, map[string]interface{}{
+                "component": "grpc",
+                "action": "startup",
+            })
+        }
+    }()
+
+    // Background jobs
+    jobsCtx, stopJobs := context.WithCancel(context.Background())
+    bookHandler.StartViewCountFlusher(jobsCtx, time.Hour)
+    webhookHandler.StartRetryWorker(jobsCtx, 30*time.Second)
+    webhookHandler.StartDLQPurger(jobsCtx)
+    authHandler.StartCleanupScheduler(jobsCtx, time.Minute)
+    authHandler.StartActiveUsersReporter(jobsCtx, 5*time.Minute)
+    bookHandler.StartBookStatusReporter(jobsCtx, time.Minute)
+    bookHandler.StartLeaderboardReporter(jobsCtx, 5*time.Minute)
+    analyticsHandler.StartTrendingUpdater(jobsCtx, analytics.TrendingInterval)
+    reportHandler.StartReportScheduler(jobsCtx, time.Minute)
+    if getEnv("SYNC_SEARCH_INDEX", "false") == "true" {
+        go jobRunner.RunSearchIndexSync(jobsCtx)
+    }
+    searchIndexSchedule, err := scheduler.Parse(getEnv("SYNC_SEARCH_INDEX_SCHEDULE", jobs.DefaultSearchIndexSyncSchedule))
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid SYNC_SEARCH_INDEX_SCHEDULE", map[string]interface{}{"error": err.Error()})
+        searchIndexSchedule, _ = scheduler.Parse(jobs.DefaultSearchIndexSyncSchedule)
+    }
+    jobRunner.StartSearchIndexSync(jobsCtx, searchIndexSchedule)
+    if geoUpdater.Enabled() {
+        geo.StartUpdater(jobsCtx, geo.Default, geoUpdater, services.Log)
+    }
+    if book.NotifyChanges {
+        db.StartNotifyListener(jobsCtx, services.Log, bookHandler.HandleChangeNotification)
+    }
+    db.StartPoolMonitor(jobsCtx, services.DB, services.Log, 15*time.Second)
+    db.StartHealthPoller(jobsCtx, services.DB, services.Log, 30*time.Second)
+    goroutineMonitor, err := health.GoroutineMonitorConfigFromEnv()
+    if err != nil {
+        AppLogger.Warn("Ignoring invalid goroutine monitor configuration", map[string]interface{}{"error": err.Error()})
+        goroutineMonitor = health.GoroutineMonitorConfig{}
+    }
+    health.NewGoroutineMonitor(goroutineMonitor, AppLogger).Start(jobsCtx)
+    metrics.StartSLOUpdater(jobsCtx, time.Minute, func(budget metrics.SLOBudget) {
+        AppLogger.Warn("SLO budget running out", map[string]interface{}{
+            "endpoint":         budget.Endpoint,
+            "target_ms":        budget.TargetMs,
+            "budget_remaining": budget.BudgetRemaining,
+        })
+    })
+    if host := os.Getenv("GRAPHITE_HOST"); host != "" {
+        interval, err := strconv.Atoi(getEnv("GRAPHITE_INTERVAL_SECONDS", "60"))
+        if err != nil || interval < 1 {
+            AppLogger.Warn("Ignoring invalid GRAPHITE_INTERVAL_SECONDS", map[string]interface{}{"value": os.Getenv("GRAPHITE_INTERVAL_SECONDS")})
+            interval = 60
+        }
+        prefix := os.Getenv("GRAPHITE_PREFIX")
+        if err := metrics.CheckGraphitePrefix(prefix); err != nil {
+            AppLogger.Warn("Ignoring invalid GRAPHITE_PREFIX", map[string]interface{}{"error": err.Error()})
+            prefix = ""
+        }
+        addr := metrics.GraphiteAddress(host)
+        metrics.StartGraphitePusher(jobsCtx, addr, time.Duration(interval)*time.Second, prefix, func(err error) {
+            AppLogger.Warn("Failed to push metrics to Graphite", map[string]interface{}{"address": addr, "error": err.Error()})
+        })
+    }
+
+    // Everything is initialized; start accepting traffic from load balancers
+    health.MarkReady()
+
     <-c
     AppLogger.Info("🛑 Gracefully shutting down...")
+    health.MarkNotReady("shutting down")
+
+    stopJobs()
+
+    grpcServer.GracefulStop()
+    AppLogger.Info("✅ gRPC server stopped")
 
     ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
     defer cancel()
@@ -268,6 +727,16 @@ func main() {
         AppLogger.Info("✅ Redis connection closed")
     }
 
+    // WebSocket and SSE connections only end when the client goes away, so
+    // close them before waiting for in-flight requests
+    closeCtx, cancelClose := context.WithTimeout(context.Background(), pubsub.CloseTimeout)
+    if err := pubsub.Connections.CloseAll(closeCtx); err != nil {
+        AppLogger.Warn("Not all connections closed in time", map[string]interface{}{"error": err.Error()})
+    } else {
+        AppLogger.Info("✅ WebSocket and SSE connections closed")
+    }
+    cancelClose()
+
     if err := app.ShutdownWithContext(ctx); err != nil {
         AppLogger.LogError(err, map[string]interface{}{
             "component": "server",
@@ -276,6 +745,13 @@ func main() {
     }
 
     AppLogger.Info("✅ Server exited")
+
+    // Push log lines still queued for Loki
+    flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancelFlush()
+    if err := AppLogger.Close(flushCtx); err != nil {
+        log.Printf("Failed to flush logs: %v", err)
+    }
 }
 
 func getEnv(key, defaultValue string) string {
@@ -284,3 +760,9 @@ func getEnv(key, defaultValue string) string {
     }
     return defaultValue
 }
+
+// withError adds err to log fields
+func withError(fields map[string]interface{}, err error) map[string]interface{} {
+    fields["error"] = err.Error()
+    return fields
+}
@@ -1,9 +1,11 @@
 package middleware
 
 import (
-	"os"
+	"errors"
 	"strings"
 
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -12,32 +14,108 @@ func JWTProtected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(401).JSON(fiber.Map{"error": "Missing authorization header"})
+			return apierrors.Respond(c, apierrors.ErrUnauthorized.WithMessage("Missing authorization header"))
 		}
 
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return c.Status(401).JSON(fiber.Map{"error": "Invalid authorization header format"})
+			return apierrors.Respond(c, apierrors.ErrUnauthorized.WithMessage("Invalid authorization header format"))
 		}
 
 		tokenStr := authHeader[len("Bearer "):]
 
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "supersecret"
+		token, err := ParseToken(tokenStr)
+		if err != nil || !token.Valid {
+			return apierrors.Respond(c, apierrors.ErrInvalidToken)
 		}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(secret), nil
-		})
+		c.Locals("user", token)
+		return c.Next()
+	}
+}
 
-		if err != nil || !token.Valid {
-			return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired token"})
+// JWTOptional stores the token in c.Locals("user") when a valid bearer token
+// is sent, and lets the request through anonymously otherwise. Use it on
+// public routes whose response differs for signed-in users.
+func JWTOptional() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			if token, err := ParseToken(authHeader[len("Bearer "):]); err == nil && token.Valid {
+				c.Locals("user", token)
+			}
 		}
+		return c.Next()
+	}
+}
 
-		c.Locals("user", token)
+// UserID returns the ID of the authenticated user, if there is one
+func UserID(c *fiber.Ctx) (uint, bool) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return 0, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	// JSON numbers decode as float64
+	sub, ok := claims["sub"].(float64)
+	if !ok || sub <= 0 {
+		return 0, false
+	}
+	return uint(sub), true
+}
+
+// SessionID returns the session (jti claim) of the authenticated user's
+// token. Tokens issued before sessions were tracked have none.
+func SessionID(c *fiber.Ctx) (string, bool) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return "", false
+	}
+	return tokenSessionID(token)
+}
+
+func tokenSessionID(token *jwt.Token) (string, bool) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", false
+	}
+	jti, ok := claims["jti"].(string)
+	return jti, ok && jti != ""
+}
+
+// SessionRevoked reports whether the session with the given ID was revoked.
+// Set in main; when nil sessions are never checked.
+var SessionRevoked func(id string) bool
+
+var ErrSessionRevoked = errors.New("session revoked")
+
+// ParseToken validates a signed JWT and returns the parsed token. Tokens of
+// revoked sessions are rejected with ErrSessionRevoked, and tokens signed
+// with another algorithm than the configured one are invalid.
+func ParseToken(tokenStr string) (*jwt.Token, error) {
+	token, err := tokens.Current().Parse(tokenStr)
+	if err != nil {
+		return token, err
+	}
+
+	if jti, ok := tokenSessionID(token); ok && SessionRevoked != nil && SessionRevoked(jti) {
+		return nil, ErrSessionRevoked
+	}
+	return token, nil
+}
+
+// TokenFromQuery copies the access_token query parameter to the
+// Authorization header when the request has none, for clients that can't set
+// headers such as browsers opening a WebSocket. Put it before JWTProtected.
+func TokenFromQuery() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			if token := c.Query("access_token"); token != "" {
+				c.Request().Header.Set("Authorization", "Bearer "+token)
+			}
+		}
 		return c.Next()
 	}
 }
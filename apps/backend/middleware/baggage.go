@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/AtillaTahaK/gobooklibrary/pkg/tracing"
+	"github.com/gofiber/fiber/v2"
+)
+
+// BaggageKey is the c.Locals key Baggage stores the request's baggage under
+const BaggageKey = "baggage"
+
+// Baggage reads the W3C baggage header and stores its key-value pairs in
+// c.Locals(BaggageKey) and in c.UserContext(), so outbound calls forward
+// them. Like an invalid traceparent, an invalid header is ignored rather
+// than failing the request, and isn't forwarded.
+func Baggage() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(tracing.BaggageHeader)
+		if header == "" {
+			return c.Next()
+		}
+		baggage, err := tracing.ParseBaggage(header)
+		if err != nil || len(baggage) == 0 {
+			return c.Next()
+		}
+
+		c.Locals(BaggageKey, baggage)
+		c.SetUserContext(tracing.NewBaggageContext(c.UserContext(), baggage))
+		return c.Next()
+	}
+}
+
+// BaggageFields returns the request's baggage as a log field, or nil if it
+// had none
+func BaggageFields(c *fiber.Ctx) map[string]interface{} {
+	baggage, ok := c.Locals(BaggageKey).(map[string]string)
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{BaggageKey: baggage}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CancelOnClientClose cancels c.UserContext() when the client closes the
+// connection before the response is sent, so the database queries and
+// outbound calls of a request nobody waits for stop early. Register it
+// before the middleware that derive their context from c.UserContext().
+//
+// Only plain TCP connections can be watched; requests over TLS or through
+// app.Test keep a context that is never cancelled by the client. Streamed
+// responses keep their context too: their writer runs after the handler
+// returns and stops at the first failed write.
+func CancelOnClientClose() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancel(c.UserContext())
+		stop := watchClose(c.Context().Conn(), cancel)
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		stop()
+		if !c.Response().IsBodyStream() {
+			cancel()
+		}
+		return err
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package middleware
+
+import "net"
+
+// watchClose never reports a closed connection on this platform, so
+// CancelOnClientClose leaves the request's context alone
+func watchClose(conn net.Conn, onClose func()) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package middleware
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchClose calls onClose if conn is closed by the client before stop is
+// called. It peeks at the socket instead of reading it, so a pipelined
+// request stays in place for the server; the watch ends when one arrives.
+func watchClose(conn net.Conn, onClose func()) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var buf [1]byte
+		closed := false
+		// Read waits until the socket is readable or the read deadline
+		// set by stop passes
+		err := raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK)
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+				return false
+			}
+			// No data and no error is the client's FIN; an error such as
+			// ECONNRESET means the connection is gone too
+			closed = n == 0 || err != nil
+			return true
+		})
+		if err == nil && closed {
+			onClose()
+		}
+	}()
+
+	return func() {
+		// Wake the watcher up, then clear the deadline for the server's
+		// next read of this connection
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Compression algorithms for COMPRESSION_ALGORITHM
+const (
+	CompressionGzip   = "gzip"
+	CompressionBrotli = "brotli"
+	// CompressionAuto uses Brotli when the client accepts it and gzip
+	// otherwise
+	CompressionAuto = "auto"
+)
+
+// DefaultCompressionMinSize is the smallest body worth compressing; below
+// it the encoding overhead outweighs the savings
+const DefaultCompressionMinSize = 1024
+
+// CompressionConfig configures response compression
+type CompressionConfig struct {
+	// Algorithm is CompressionGzip, CompressionBrotli or CompressionAuto;
+	// defaults to auto
+	Algorithm string
+	// Level is 1-9 for gzip and auto, 1-11 for Brotli. Zero uses a fast
+	// level suited to API responses.
+	Level int
+	// MinSize defaults to DefaultCompressionMinSize
+	MinSize int
+}
+
+// CompressionConfigFromEnv reads COMPRESSION_ALGORITHM and COMPRESSION_LEVEL
+func CompressionConfigFromEnv() (CompressionConfig, error) {
+	config := CompressionConfig{Algorithm: CompressionAuto}
+	if raw := os.Getenv("COMPRESSION_ALGORITHM"); raw != "" {
+		config.Algorithm = strings.ToLower(strings.TrimSpace(raw))
+	}
+	if raw := os.Getenv("COMPRESSION_LEVEL"); raw != "" {
+		level, err := strconv.Atoi(raw)
+		if err != nil {
+			return config, fmt.Errorf("COMPRESSION_LEVEL must be a number, got %q", raw)
+		}
+		config.Level = level
+	}
+	return config, config.validate()
+}
+
+func (cfg CompressionConfig) validate() error {
+	switch cfg.Algorithm {
+	case CompressionGzip, CompressionAuto:
+		if cfg.Level < 0 || cfg.Level > gzip.BestCompression {
+			return fmt.Errorf("compression level for %s must be between 1 and 9, got %d", cfg.Algorithm, cfg.Level)
+		}
+	case CompressionBrotli:
+		if cfg.Level < 0 || cfg.Level > brotli.BestCompression {
+			return fmt.Errorf("compression level for brotli must be between 1 and 11, got %d", cfg.Level)
+		}
+	default:
+		return fmt.Errorf("unknown compression algorithm %q, expected gzip, brotli or auto", cfg.Algorithm)
+	}
+	return nil
+}
+
+// Compression compresses responses of at least MinSize bytes with gzip or
+// Brotli, whichever the client accepts and the config allows. Streamed and
+// already encoded responses are sent as they are.
+func Compression(config ...CompressionConfig) fiber.Handler {
+	cfg := CompressionConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = CompressionAuto
+	}
+	if cfg.MinSize == 0 {
+		cfg.MinSize = DefaultCompressionMinSize
+	}
+
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		c.Vary(fiber.HeaderAcceptEncoding)
+		resp := c.Response()
+		if c.Method() == fiber.MethodHead || resp.IsBodyStream() ||
+			len(resp.Header.Peek(fiber.HeaderContentEncoding)) > 0 ||
+			len(resp.Body()) < cfg.MinSize {
+			return nil
+		}
+
+		encoding := cfg.negotiate(c.Get(fiber.HeaderAcceptEncoding))
+		if encoding == "" {
+			return nil
+		}
+		compressed, err := compressBody(encoding, cfg.levelFor(encoding), resp.Body())
+		if err != nil {
+			// Sending the body uncompressed is better than failing the request
+			return nil
+		}
+		resp.SetBodyRaw(compressed)
+		resp.Header.Set(fiber.HeaderContentEncoding, encoding)
+		return nil
+	}
+}
+
+// negotiate returns the Content-Encoding to use for acceptEncoding, or ""
+// when the client accepts none of the configured algorithms
+func (cfg CompressionConfig) negotiate(acceptEncoding string) string {
+	accepted := acceptedEncodings(acceptEncoding)
+	switch cfg.Algorithm {
+	case CompressionBrotli:
+		if accepted["br"] {
+			return "br"
+		}
+	case CompressionGzip:
+		if accepted["gzip"] {
+			return "gzip"
+		}
+	default:
+		if accepted["br"] {
+			return "br"
+		}
+		if accepted["gzip"] {
+			return "gzip"
+		}
+	}
+	return ""
+}
+
+func (cfg CompressionConfig) levelFor(encoding string) int {
+	if cfg.Level != 0 {
+		return cfg.Level
+	}
+	if encoding == "br" {
+		// Comparable to gzip's best speed in CPU, with a better ratio
+		return 4
+	}
+	return gzip.BestSpeed
+}
+
+// acceptedEncodings parses an Accept-Encoding header, leaving out encodings
+// refused with q=0
+func acceptedEncodings(header string) map[string]bool {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	if accepted["*"] {
+		accepted["br"] = true
+		accepted["gzip"] = true
+	}
+	return accepted
+}
+
+func compressBody(encoding string, level int, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "br" {
+		w = brotli.NewWriterLevel(&buf, level)
+	} else {
+		zw, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CORSConfig configures DynamicCORS
+type CORSConfig struct {
+	// Origins loads the allowed origins, e.g. cors.AllowedOrigins. It is
+	// called for every cross-origin request that Static doesn't allow.
+	Origins func(ctx context.Context) ([]string, error)
+	// Static origins are always allowed, and are the only ones allowed when
+	// Origins fails. "*" allows every origin.
+	Static []string
+	// AllowMethods and AllowHeaders answer preflight requests. Without
+	// AllowHeaders the requested headers are allowed.
+	AllowMethods string
+	AllowHeaders string
+	// ExposeHeaders lists response headers scripts may read
+	ExposeHeaders string
+	// MaxAge is how many seconds browsers may cache a preflight response
+	MaxAge int
+}
+
+// CORSConfigFromEnv reads the static origins from CORS_ALLOWED_ORIGINS, a
+// comma-separated list. Unset, every origin is allowed as before origins
+// could be managed; set it, even to an empty value, to allow only the listed
+// and managed origins.
+func CORSConfigFromEnv() CORSConfig {
+	var config CORSConfig
+	raw, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS")
+	if !ok {
+		config.Static = []string{"*"}
+		return config
+	}
+	for _, origin := range strings.Split(raw, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.Static = append(config.Static, origin)
+		}
+	}
+	return config
+}
+
+// normalizeOrigin matches cors.NormalizeOrigin, which this package can't
+// import
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// DynamicCORS answers cross-origin requests from allowed origins with
+// Access-Control-Allow-Origin set to the request's origin. The allowed
+// origins are looked up per request, so changes apply without a restart.
+// Requests from other origins get no CORS headers, which makes browsers
+// reject them.
+func DynamicCORS(config CORSConfig) fiber.Handler {
+	static := make(map[string]bool, len(config.Static))
+	for _, origin := range config.Static {
+		static[normalizeOrigin(origin)] = true
+	}
+
+	allowed := func(c *fiber.Ctx, origin string) bool {
+		if static["*"] || static[origin] {
+			return true
+		}
+		if config.Origins == nil {
+			return false
+		}
+		origins, err := config.Origins(c.UserContext())
+		if err != nil {
+			return false
+		}
+		for _, o := range origins {
+			if normalizeOrigin(o) == origin {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" {
+			return c.Next()
+		}
+		c.Vary(fiber.HeaderOrigin)
+		preflight := c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+
+		if !allowed(c, normalizeOrigin(origin)) {
+			if preflight {
+				return c.SendStatus(fiber.StatusNoContent)
+			}
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		if !preflight {
+			if config.ExposeHeaders != "" {
+				c.Set(fiber.HeaderAccessControlExposeHeaders, config.ExposeHeaders)
+			}
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderAccessControlAllowMethods, config.AllowMethods)
+		if config.AllowHeaders != "" {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, config.AllowHeaders)
+		} else if requested := c.Get(fiber.HeaderAccessControlRequestHeaders); requested != "" {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, requested)
+		}
+		if config.MaxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(config.MaxAge))
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
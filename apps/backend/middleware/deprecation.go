@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Deprecation response headers, from the IETF deprecation and sunset drafts
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+)
+
+// DeprecationHeaders are the headers Deprecation sets, for ExposeHeaders.
+// Link is left out since PaginationHeaders has it.
+var DeprecationHeaders = []string{HeaderDeprecation, HeaderSunset, fiber.HeaderWarning}
+
+// SuccessorVersionURL is the base URL of the API that replaces deprecated
+// routes, e.g. https://api.example.com/v2. The request path is appended to
+// it for the successor-version link; the link is left out when it is empty.
+var SuccessorVersionURL string
+
+// ParseSunsetDate parses a sunset date given as 2006-01-02, RFC 3339 or
+// RFC 1123
+func ParseSunsetDate(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range []string{"2006-01-02", time.RFC3339, http.TimeFormat} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("sunset date must look like 2026-01-01, got %q", raw)
+}
+
+// Deprecation marks the routes it is applied to as deprecated: responses get
+// Deprecation: true, the Sunset date in RFC 1123 format, a successor-version
+// Link when SuccessorVersionURL is set, and message as a Warning. Each
+// request is counted by metrics.RecordDeprecatedAPIUse. It panics if
+// sunsetDate can't be parsed by ParseSunsetDate; check it first.
+func Deprecation(message, sunsetDate string) fiber.Handler {
+	sunset, err := ParseSunsetDate(sunsetDate)
+	if err != nil {
+		panic(err)
+	}
+	sunsetHeader := sunset.Format(http.TimeFormat)
+	var warning string
+	if message != "" {
+		warning = `299 - ` + strconv.Quote(message)
+	}
+
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		c.Set(HeaderDeprecation, "true")
+		c.Set(HeaderSunset, sunsetHeader)
+		if warning != "" {
+			c.Set(fiber.HeaderWarning, warning)
+		}
+		if SuccessorVersionURL != "" {
+			successor := fmt.Sprintf(`<%s%s>; rel="successor-version"`, strings.TrimSuffix(SuccessorVersionURL, "/"), c.Path())
+			// Keep pagination links set by the handler
+			if links := string(c.Response().Header.Peek(fiber.HeaderLink)); links != "" {
+				successor = links + ", " + successor
+			}
+			c.Set(fiber.HeaderLink, successor)
+		}
+		metrics.RecordDeprecatedAPIUse(c.Method() + " " + c.Route().Path)
+		return err
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MIMEEnvelope is the media type clients accept to get lists wrapped in an
+// envelope whatever RESPONSE_ENVELOPE is
+const MIMEEnvelope = "application/vnd.api+json"
+
+// EnvelopeConfig configures the Envelope middleware
+type EnvelopeConfig struct {
+	// Enabled wraps every list in an envelope. Without it only requests
+	// accepting MIMEEnvelope get one.
+	Enabled bool
+}
+
+// EnvelopeConfigFromEnv reads RESPONSE_ENVELOPE, false by default so lists
+// stay bare arrays for existing clients
+func EnvelopeConfigFromEnv() (EnvelopeConfig, error) {
+	raw := os.Getenv("RESPONSE_ENVELOPE")
+	if raw == "" {
+		return EnvelopeConfig{}, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return EnvelopeConfig{}, fmt.Errorf("RESPONSE_ENVELOPE must be true or false, got %q", raw)
+	}
+	return EnvelopeConfig{Enabled: enabled}, nil
+}
+
+// ListEnvelope is a list response wrapped in an envelope. Page, Limit and
+// Pages are only set for paginated lists.
+type ListEnvelope struct {
+	Data  json.RawMessage `json:"data" swaggertype:"array,object"`
+	Total int64           `json:"total" example:"42"`
+	Page  *int            `json:"page,omitempty" example:"1"`
+	Limit *int            `json:"limit,omitempty" example:"20"`
+	Pages *int            `json:"pages,omitempty" example:"3"`
+}
+
+// Envelope wraps successful JSON array responses as {"data": [...],
+// "total": n}, adding page, limit and pages from the headers SetPagination
+// wrote for paginated lists. Handlers keep writing bare arrays; responses
+// that are already objects are sent as they are.
+func Envelope(config ...EnvelopeConfig) fiber.Handler {
+	cfg := EnvelopeConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Vary(fiber.HeaderAccept)
+		if !cfg.Enabled && c.Accepts(fiber.MIMEApplicationJSON, MIMEEnvelope) != MIMEEnvelope {
+			return c.Next()
+		}
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		resp := c.Response()
+		status := resp.StatusCode()
+		if status < fiber.StatusOK || status >= fiber.StatusMultipleChoices || resp.IsBodyStream() ||
+			!strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+			return nil
+		}
+		data := bytes.TrimSpace(resp.Body())
+		if !bytes.HasPrefix(data, []byte("[")) {
+			return nil
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil
+		}
+
+		envelope := ListEnvelope{Data: data, Total: int64(len(items))}
+		if total, err := strconv.ParseInt(c.GetRespHeader(HeaderTotalCount), 10, 64); err == nil {
+			envelope.Total = total
+			envelope.Page = headerInt(c, HeaderPage)
+			envelope.Limit = headerInt(c, HeaderLimit)
+			envelope.Pages = headerInt(c, HeaderPages)
+		}
+		body, err := json.Marshal(envelope)
+		if err != nil {
+			return nil
+		}
+		resp.SetBodyRaw(body)
+		return nil
+	}
+}
+
+// headerInt returns the number in response header name, or nil if it has
+// none
+func headerInt(c *fiber.Ctx, name string) *int {
+	n, err := strconv.Atoi(c.GetRespHeader(name))
+	if err != nil {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/geo"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GeoKey is the Locals key GeoLocation stores the client's geo.Location
+// under
+const GeoKey = "geo"
+
+// GeoConfig configures the GeoLocation middleware
+type GeoConfig struct {
+	// Resolver defaults to geo.Default
+	Resolver *geo.Resolver
+	// BlockedCountries are ISO 3166-1 alpha-2 codes answered with 403.
+	// Clients the database doesn't list are never blocked.
+	BlockedCountries []string
+	// RecordAnalytics counts requests per country for
+	// /admin/analytics/countries in Analytics
+	RecordAnalytics bool
+	Analytics       *geo.Handler
+}
+
+// GeoConfigFromEnv reads BLOCKED_COUNTRIES (comma-separated country codes)
+// and GEOIP_ANALYTICS
+func GeoConfigFromEnv() (GeoConfig, error) {
+	config := GeoConfig{RecordAnalytics: os.Getenv("GEOIP_ANALYTICS") != "false"}
+	for _, code := range strings.Split(os.Getenv("BLOCKED_COUNTRIES"), ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if len(code) != 2 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return config, fmt.Errorf("BLOCKED_COUNTRIES must be two-letter country codes, got %q", code)
+		}
+		config.BlockedCountries = append(config.BlockedCountries, code)
+	}
+	return config, nil
+}
+
+// GeoLocation resolves the client IP to a geo.Location and stores it in
+// c.Locals(GeoKey) when the database lists it. Requests from blocked
+// countries are rejected before reaching the routes.
+func GeoLocation(config GeoConfig) fiber.Handler {
+	resolver := config.Resolver
+	if resolver == nil {
+		resolver = geo.Default
+	}
+	blocked := make(map[string]bool, len(config.BlockedCountries))
+	for _, code := range config.BlockedCountries {
+		blocked[strings.ToUpper(code)] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		location, found := resolver.Lookup(c.IP())
+		if found {
+			c.Locals(GeoKey, location)
+		}
+		// Blocked requests are counted too, so the analytics show what the
+		// block list keeps out
+		if config.RecordAnalytics {
+			_ = config.Analytics.RecordRequest(location.CountryCode, c.IP(), time.Now())
+		}
+		if blocked[location.CountryCode] {
+			return apierrors.ErrForbidden.WithMessage("Access from your country is not allowed")
+		}
+		return c.Next()
+	}
+}
+
+// ClientLocation returns the location GeoLocation stored, or false if the
+// client wasn't found
+func ClientLocation(c *fiber.Ctx) (geo.Location, bool) {
+	location, ok := c.Locals(GeoKey).(geo.Location)
+	return location, ok
+}
+
+// Country returns the client's country code, or geo.UnknownCountry
+func Country(c *fiber.Ctx) string {
+	if location, ok := ClientLocation(c); ok {
+		return location.CountryCode
+	}
+	return geo.UnknownCountry
+}
+
+// GeoFields returns the client's country as a log field
+func GeoFields(c *fiber.Ctx) map[string]interface{} {
+	return map[string]interface{}{"country": Country(c)}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type grpcUserKey struct{}
+
+// GRPCAuthInterceptor validates the JWT carried in the "authorization"
+// metadata key for the given methods. Methods not listed are public,
+// matching the HTTP routes where reads don't require a token.
+func GRPCAuthInterceptor(protectedMethods ...string) grpc.UnaryServerInterceptor {
+	protected := make(map[string]bool, len(protectedMethods))
+	for _, method := range protectedMethods {
+		protected[method] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !protected[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing metadata")
+		}
+
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+		}
+
+		if !strings.HasPrefix(values[0], "Bearer ") {
+			return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata format")
+		}
+
+		token, err := ParseToken(values[0][len("Bearer "):])
+		if err != nil || !token.Valid {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+		}
+
+		return handler(context.WithValue(ctx, grpcUserKey{}, token), req)
+	}
+}
+
+// GRPCUserFromContext returns the token stored by GRPCAuthInterceptor
+func GRPCUserFromContext(ctx context.Context) (*jwt.Token, bool) {
+	token, ok := ctx.Value(grpcUserKey{}).(*jwt.Token)
+	return token, ok
+}
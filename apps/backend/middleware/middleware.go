@@ -5,9 +5,7 @@ import (
 
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/timeout"
@@ -22,21 +20,6 @@ func CORS() fiber.Handler {
 	})
 }
 
-func RateLimit() fiber.Handler {
-	return limiter.New(limiter.Config{
-		Max:        100,
-		Expiration: 1 * time.Minute,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded",
-			})
-		},
-	})
-}
-
 func Logger() fiber.Handler {
 	return logger.New()
 }
@@ -51,12 +34,6 @@ func Security() fiber.Handler {
 	}
 }
 
-func Compression() fiber.Handler {
-	return compress.New(compress.Config{
-		Level: compress.LevelBestSpeed,
-	})
-}
-
 func Recovery() fiber.Handler {
 	return recover.New()
 }
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// xmlRoot names the root element of responses whose path gives no name
+const xmlRoot = "response"
+
+// ContentNegotiationConfig configures the ContentNegotiation middleware
+type ContentNegotiationConfig struct {
+	// Passthrough lists media types that handlers write themselves, such as
+	// text/event-stream. Requests accepting one are left to the handler.
+	Passthrough []string
+}
+
+// ContentNegotiation answers in XML when the Accept header prefers it over
+// JSON. Handlers keep writing JSON; their response is converted afterwards,
+// keeping the JSON field names and order as element names. Collections are
+// wrapped in an element named after the resource, e.g. <books><book>...
+// for /books, and errors in <error>. Clients that accept neither JSON, XML
+// nor a Passthrough type get 406.
+func ContentNegotiation(config ...ContentNegotiationConfig) fiber.Handler {
+	cfg := ContentNegotiationConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	offers := []string{fiber.MIMEApplicationJSON, MIMEEnvelope, fiber.MIMEApplicationXML, fiber.MIMETextXML}
+	offers = append(offers, cfg.Passthrough...)
+	// Media types the response is sent in as the handler wrote it
+	asIs := map[string]bool{fiber.MIMEApplicationJSON: true, MIMEEnvelope: true}
+	for _, mime := range cfg.Passthrough {
+		asIs[mime] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Vary(fiber.HeaderAccept)
+		accepted := c.Accepts(offers...)
+		if accepted == "" {
+			return apierrors.Respond(c, apierrors.ErrNotAcceptable.WithMessage("Only application/json and application/xml responses are available"))
+		}
+		if asIs[accepted] {
+			return c.Next()
+		}
+
+		if err := c.Next(); err != nil {
+			// Render the error now so it is converted too
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		resp := c.Response()
+		contentType := string(resp.Header.ContentType())
+		if resp.IsBodyStream() || !strings.HasPrefix(contentType, fiber.MIMEApplicationJSON) || len(resp.Body()) == 0 {
+			return nil
+		}
+
+		root := xmlRootName(c.Path())
+		if resp.StatusCode() >= fiber.StatusBadRequest {
+			root = "error"
+		}
+		body, err := JSONToXML(resp.Body(), root)
+		if err != nil {
+			// Sending JSON is better than failing the request
+			return nil
+		}
+		resp.SetBodyRaw(body)
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+		return nil
+	}
+}
+
+// xmlRootName names a response after the last path segment that isn't an
+// ID: "books" for /books and /authors/1/books
+func xmlRootName(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment != "" && strings.IndexFunc(segment, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+			return xmlName(segment)
+		}
+	}
+	return xmlRoot
+}
+
+// JSONToXML converts a JSON document to XML under a root element named
+// root. Objects become elements named after their keys, and array items
+// are named after the singular of the array's name, so an array named books
+// holds <book> elements, or <item> when the name isn't plural. A top-level
+// object is named after the singular of root, so a single book is <book>
+// rather than <books>.
+func JSONToXML(data []byte, root string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+
+	if item, ok := singular(root); ok && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		root = item
+	}
+	if err := encodeXMLValue(dec, enc, root); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXMLValue(dec *json.Decoder, enc *xml.Encoder, name string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := encodeXMLValue(dec, enc, xmlName(key.(string))); err != nil {
+					return err
+				}
+			}
+		case '[':
+			item, ok := singular(name)
+			if !ok {
+				item = "item"
+			}
+			for dec.More() {
+				if err := encodeXMLValue(dec, enc, item); err != nil {
+					return err
+				}
+			}
+		}
+		// The closing } or ]
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	case nil:
+		// null is an empty element
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// singular guesses the name of one item of a collection, e.g. book for
+// books and category for categories. It reports false for names that don't
+// look plural, such as status.
+func singular(name string) (string, bool) {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return strings.TrimSuffix(name, "ies") + "y", true
+	case strings.HasSuffix(name, "ss"), strings.HasSuffix(name, "us"):
+		return "", false
+	case strings.HasSuffix(name, "s") && len(name) > 1:
+		return strings.TrimSuffix(name, "s"), true
+	}
+	return "", false
+}
+
+// xmlName makes s a valid XML element name by replacing characters XML
+// doesn't allow with underscores
+func xmlName(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		valid := unicode.IsLetter(r) || r == '_' ||
+			(i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'))
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Pagination response headers, for clients that set up paging before
+// reading the body
+const (
+	HeaderTotalCount = "X-Total-Count"
+	HeaderPage       = "X-Page"
+	HeaderLimit      = "X-Limit"
+	HeaderPages      = "X-Pages"
+)
+
+// PaginationHeaders are exposed to browsers by ExposeHeaders by default
+var PaginationHeaders = []string{HeaderTotalCount, HeaderPage, HeaderLimit, HeaderPages, fiber.HeaderLink}
+
+// SetPagination describes a page of a list in response headers: the total
+// count, the page, the page size and the number of pages, and an RFC 5988
+// Link header pointing at the first, previous, next and last pages. Other
+// query parameters are kept in the links.
+func SetPagination(c *fiber.Ctx, page, limit int, total int64) {
+	pages := 0
+	if limit > 0 {
+		pages = int((total + int64(limit) - 1) / int64(limit))
+	}
+
+	c.Set(HeaderTotalCount, strconv.FormatInt(total, 10))
+	c.Set(HeaderPage, strconv.Itoa(page))
+	c.Set(HeaderLimit, strconv.Itoa(limit))
+	c.Set(HeaderPages, strconv.Itoa(pages))
+
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		query = url.Values{}
+	}
+	link := func(page int, rel string) string {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(limit))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Path(), query.Encode(), rel)
+	}
+
+	var links []string
+	if pages > 0 {
+		links = append(links, link(1, "first"))
+	}
+	if page > 1 && page <= pages {
+		links = append(links, link(page-1, "prev"))
+	}
+	if page < pages {
+		links = append(links, link(page+1, "next"))
+	}
+	if pages > 0 {
+		links = append(links, link(pages, "last"))
+	}
+	if len(links) > 0 {
+		c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+	}
+}
+
+// ExposeHeaders adds headers, PaginationHeaders by default, to
+// Access-Control-Expose-Headers on cross-origin responses so browsers let
+// scripts read them. Register it before the CORS middleware.
+func ExposeHeaders(headers ...string) fiber.Handler {
+	if len(headers) == 0 {
+		headers = PaginationHeaders
+	}
+	exposed := strings.Join(headers, ", ")
+
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if c.Get(fiber.HeaderOrigin) == "" {
+			return err
+		}
+		if current := c.GetRespHeader(fiber.HeaderAccessControlExposeHeaders); current != "" {
+			c.Set(fiber.HeaderAccessControlExposeHeaders, current+", "+exposed)
+		} else {
+			c.Set(fiber.HeaderAccessControlExposeHeaders, exposed)
+		}
+		return err
+	}
+}
@@ -0,0 +1,434 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/ratelimit"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ServiceKeyHeader carries the key of a service account exempt from rate
+// limiting
+const ServiceKeyHeader = "X-Service-Key"
+
+// RateLimitPolicyHeader describes the limit a response counted against as
+// "<limit>;w=<window seconds>", e.g. "100;w=60"
+const RateLimitPolicyHeader = "X-Rate-Limit-Policy"
+
+// rateLimitIdentifierKey is the c.Locals key of who a request counts against
+const rateLimitIdentifierKey = "ratelimit_identifier"
+
+// Rate limiting algorithms selected by RATE_LIMIT_ALGORITHM
+const (
+	// AlgorithmFixedWindow counts requests per window; a client can send up
+	// to twice the limit across a window boundary
+	AlgorithmFixedWindow = "fixed_window"
+	// AlgorithmSlidingWindow weights the previous window's count by how much
+	// of it overlaps the last Expiration
+	AlgorithmSlidingWindow = "sliding_window"
+	// AlgorithmLeakyBucket allows a burst of Max requests, then Max per
+	// Expiration evenly spread. Without Cache it falls back to the fixed
+	// window.
+	AlgorithmLeakyBucket = "leaky_bucket"
+)
+
+// RateLimitConfig configures the per-client rate limit. Requests with a valid
+// token count against their user, others against their IP.
+type RateLimitConfig struct {
+	// Max requests per Expiration window; defaults to 100 per minute
+	Max        int
+	Expiration time.Duration
+	// Algorithm defaults to AlgorithmFixedWindow
+	Algorithm string
+	// Storage keeps the window counters so all instances share them. When
+	// nil they are kept in memory.
+	Storage fiber.Storage
+	// Cache keeps the leaky buckets, which are updated with a script since
+	// Storage can't do so atomically
+	Cache cache.Cache
+	// ExemptNets and ExemptAPIKeys bypass the limit entirely, e.g. for
+	// monitoring and CI
+	ExemptNets    []*net.IPNet
+	ExemptAPIKeys []string
+	// Log receives exempt decisions at DEBUG level
+	Log *logger.Logger
+	// Limits, when set, replaces Max and Expiration with the limits current
+	// at the time of each request. Requests with an admin token are limited
+	// by the admin tier, counted separately from everyone else.
+	Limits *ratelimit.ConfigSource
+
+	// keyPrefix separates the counters of a tier
+	keyPrefix string
+}
+
+// RateLimitConfigFromEnv reads RATE_LIMIT, RATE_WINDOW (seconds),
+// RATE_LIMIT_ALGORITHM, RATE_LIMIT_EXEMPT_IPS (comma-separated CIDRs) and
+// RATE_LIMIT_EXEMPT_API_KEYS (comma-separated)
+func RateLimitConfigFromEnv() (RateLimitConfig, error) {
+	var config RateLimitConfig
+	if raw := os.Getenv("RATE_LIMIT"); raw != "" {
+		max, err := strconv.Atoi(raw)
+		if err != nil || max < 1 {
+			return config, fmt.Errorf("RATE_LIMIT must be a positive number, got %q", raw)
+		}
+		config.Max = max
+	}
+	if raw := os.Getenv("RATE_WINDOW"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 1 {
+			return config, fmt.Errorf("RATE_WINDOW must be a positive number of seconds, got %q", raw)
+		}
+		config.Expiration = time.Duration(seconds) * time.Second
+	}
+	switch algorithm := os.Getenv("RATE_LIMIT_ALGORITHM"); algorithm {
+	case "", AlgorithmFixedWindow, AlgorithmSlidingWindow, AlgorithmLeakyBucket:
+		config.Algorithm = algorithm
+	default:
+		return config, fmt.Errorf("RATE_LIMIT_ALGORITHM must be fixed_window, sliding_window or leaky_bucket, got %q", algorithm)
+	}
+
+	nets, err := ParseCIDRs(os.Getenv("RATE_LIMIT_EXEMPT_IPS"))
+	if err != nil {
+		return config, err
+	}
+	config.ExemptNets = nets
+
+	for _, key := range strings.Split(os.Getenv("RATE_LIMIT_EXEMPT_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.ExemptAPIKeys = append(config.ExemptAPIKeys, key)
+		}
+	}
+	return config, nil
+}
+
+// ParseCIDRs parses comma-separated CIDR ranges. A bare IP is taken as a
+// range of one address.
+func ParseCIDRs(raw string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// DefaultLimits returns Max per Expiration, or their defaults, for both
+// tiers. Use it as the fallback of Limits.
+func (cfg RateLimitConfig) DefaultLimits() ratelimit.Config {
+	cfg = cfg.withDefaults()
+	limit := ratelimit.Limit{Limit: cfg.Max, Window: int(cfg.Expiration / time.Second)}
+	return ratelimit.Config{Default: limit, Admin: limit}
+}
+
+func (cfg RateLimitConfig) withDefaults() RateLimitConfig {
+	if cfg.Max == 0 {
+		cfg.Max = 100
+	}
+	if cfg.Expiration == 0 {
+		cfg.Expiration = time.Minute
+	}
+	return cfg
+}
+
+// RateLimit limits requests per user, or per client IP for requests without a
+// token. Exempt clients skip the limiter, so they get no X-RateLimit-* headers
+// and no counter is stored for them. A limited request gets a
+// apierrors.RateLimitedBody detailing the limit, and a Retry-After header.
+func RateLimit(config ...RateLimitConfig) fiber.Handler {
+	cfg := RateLimitConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg = cfg.withDefaults()
+	if cfg.Limits != nil {
+		return dynamicRateLimit(cfg)
+	}
+
+	if cfg.Algorithm == AlgorithmLeakyBucket && cfg.Cache != nil {
+		rate := float64(cfg.Max) / cfg.Expiration.Seconds()
+		return LeakyBucketRateLimit(rate, float64(cfg.Max), cfg)
+	}
+
+	var algorithm limiter.LimiterHandler = limiter.FixedWindow{}
+	if cfg.Algorithm == AlgorithmSlidingWindow {
+		algorithm = limiter.SlidingWindow{}
+	}
+
+	limit := limiter.New(limiter.Config{
+		Max:               cfg.Max,
+		Expiration:        cfg.Expiration,
+		Storage:           cfg.Storage,
+		LimiterMiddleware: algorithm,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "ratelimit:" + cfg.keyPrefix + identifierOf(c)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			// The limiter has set Retry-After
+			retryAfter, _ := strconv.Atoi(c.GetRespHeader(fiber.HeaderRetryAfter))
+			return rateLimited(c, cfg.Max, cfg.Expiration, retryAfter)
+		},
+	})
+	policy := rateLimitPolicy(cfg.Max, cfg.Expiration)
+
+	return func(c *fiber.Ctx) error {
+		if cfg.exempt(c) {
+			return c.Next()
+		}
+		c.Locals(rateLimitIdentifierKey, rateLimitIdentifier(c))
+		c.Set(RateLimitPolicyHeader, policy)
+		return limit(c)
+	}
+}
+
+// rateLimitIdentifier is who a request counts against: "user:<id>" when it
+// carries a valid token, otherwise the client IP
+func rateLimitIdentifier(c *fiber.Ctx) string {
+	if claims, ok := bearerClaims(c); ok {
+		if sub, ok := claims["sub"].(float64); ok && sub > 0 {
+			return fmt.Sprintf("user:%d", uint(sub))
+		}
+	}
+	return c.IP()
+}
+
+// identifierOf returns the identifier RateLimit stored for the request
+func identifierOf(c *fiber.Ctx) string {
+	if identifier, ok := c.Locals(rateLimitIdentifierKey).(string); ok {
+		return identifier
+	}
+	return c.IP()
+}
+
+func rateLimitPolicy(limit int, window time.Duration) string {
+	return fmt.Sprintf("%d;w=%d", limit, int(window/time.Second))
+}
+
+// rateLimited responds with a RateLimitedBody detailing the limit the
+// request exceeded and the Retry-After the limiter set
+func rateLimited(c *fiber.Ctx, limit int, window time.Duration, retryAfter int) error {
+	windowSeconds := int(window / time.Second)
+	return c.Status(fiber.StatusTooManyRequests).JSON(apierrors.RateLimitedBody{
+		Code:              apierrors.ErrRateLimited.Code,
+		Error:             "rate_limit_exceeded",
+		Message:           fmt.Sprintf("You have exceeded %d requests per %d seconds", limit, windowSeconds),
+		RetryAfterSeconds: retryAfter,
+		Limit:             limit,
+		WindowSeconds:     windowSeconds,
+		Identifier:        identifierOf(c),
+	})
+}
+
+// dynamicRateLimit picks the limit of the request's tier from cfg.Limits
+// and runs a limiter built for it. Limiters are rebuilt when their limit
+// changes; counters in Storage and Cache carry over, in-memory ones restart.
+func dynamicRateLimit(cfg RateLimitConfig) fiber.Handler {
+	type tierLimiter struct {
+		limit   ratelimit.Limit
+		handler fiber.Handler
+	}
+	var mu sync.Mutex
+	limiters := map[string]tierLimiter{}
+
+	limiterFor := func(tier string, limit ratelimit.Limit) fiber.Handler {
+		mu.Lock()
+		defer mu.Unlock()
+		if current, ok := limiters[tier]; ok && current.limit == limit {
+			return current.handler
+		}
+
+		tierCfg := cfg
+		tierCfg.Limits = nil
+		tierCfg.Max = limit.Limit
+		tierCfg.Expiration = limit.Expiration()
+		if tier != ratelimit.TierDefault {
+			tierCfg.keyPrefix = tier + ":"
+		}
+		handler := RateLimit(tierCfg)
+		limiters[tier] = tierLimiter{limit: limit, handler: handler}
+		return handler
+	}
+
+	return func(c *fiber.Ctx) error {
+		limits := cfg.Limits.Current()
+		tier := ratelimit.TierDefault
+		if limits.Admin != limits.Default && hasAdminToken(c) {
+			tier = ratelimit.TierAdmin
+		}
+		return limiterFor(tier, limits.Tier(tier))(c)
+	}
+}
+
+// hasAdminToken reports whether the request carries a valid token with the
+// admin role. The role is the token's, not the user's current one.
+func hasAdminToken(c *fiber.Ctx) bool {
+	claims, ok := bearerClaims(c)
+	return ok && claims["role"] == "admin"
+}
+
+// bearerClaims returns the claims of the request's token if it is valid. The
+// rate limit runs before JWTProtected, so the token is parsed here.
+func bearerClaims(c *fiber.Ctx) (jwt.MapClaims, bool) {
+	authHeader := c.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, false
+	}
+	token, err := ParseToken(authHeader[len("Bearer "):])
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// LeakyBucketRateLimit limits each user, or client IP for requests without a
+// token, to bursts of burst requests, then rate requests per second. The
+// buckets are kept in the Cache of config, which is required; when a bucket
+// can't be read, e.g. while Redis is down, requests are let through like
+// with CacheStorage.
+func LeakyBucketRateLimit(rate, burst float64, config ...RateLimitConfig) fiber.Handler {
+	cfg := RateLimitConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Cache == nil {
+		panic("middleware: LeakyBucketRateLimit needs a cache")
+	}
+	bucket, err := ratelimit.NewLeakyBucket(cfg.Cache, rate, burst)
+	if err != nil {
+		panic(err)
+	}
+	limit := strconv.Itoa(int(burst))
+	// A full bucket drains in window
+	window := time.Duration(burst / rate * float64(time.Second))
+	policy := rateLimitPolicy(int(burst), window)
+
+	return func(c *fiber.Ctx) error {
+		if cfg.exempt(c) {
+			return c.Next()
+		}
+		identifier := rateLimitIdentifier(c)
+		c.Locals(rateLimitIdentifierKey, identifier)
+
+		decision, err := bucket.Take("ratelimit:bucket:"+cfg.keyPrefix+identifier, time.Now())
+		if err != nil {
+			if cfg.Log != nil {
+				cfg.Log.LogError(err, map[string]interface{}{
+					"operation":  "leaky_bucket_rate_limit",
+					"identifier": identifier,
+				})
+			}
+			return c.Next()
+		}
+
+		c.Set("X-RateLimit-Limit", limit)
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Set(RateLimitPolicyHeader, policy)
+		if !decision.Allowed {
+			retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return rateLimited(c, int(burst), window, retryAfter)
+		}
+		return c.Next()
+	}
+}
+
+func (cfg RateLimitConfig) exempt(c *fiber.Ctx) bool {
+	if key := c.Get(ServiceKeyHeader); key != "" {
+		for _, exempt := range cfg.ExemptAPIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(exempt)) == 1 {
+				cfg.logExempt(c, "service_key")
+				return true
+			}
+		}
+	}
+
+	if ip := net.ParseIP(c.IP()); ip != nil {
+		for _, ipNet := range cfg.ExemptNets {
+			if ipNet.Contains(ip) {
+				cfg.logExempt(c, "ip_range")
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cfg RateLimitConfig) logExempt(c *fiber.Ctx, reason string) {
+	if cfg.Log == nil {
+		return
+	}
+	cfg.Log.Debug("Rate limit skipped for exempt client", map[string]interface{}{
+		"ip":     c.IP(),
+		"path":   c.Path(),
+		"reason": reason,
+	})
+}
+
+// CacheStorage stores rate limit counters in c so they are shared between
+// instances. Errors make the limiter treat the counter as empty, so requests
+// are let through while the cache is down.
+func CacheStorage(c cache.Cache) fiber.Storage {
+	return cacheStorage{c}
+}
+
+type cacheStorage struct {
+	cache cache.Cache
+}
+
+func (s cacheStorage) Get(key string) ([]byte, error) {
+	var value []byte
+	if err := s.cache.Get(key, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s cacheStorage) Set(key string, value []byte, exp time.Duration) error {
+	return s.cache.Set(key, value, exp)
+}
+
+func (s cacheStorage) Delete(key string) error {
+	return s.cache.Delete(key)
+}
+
+// Reset is a no-op; counters expire on their own and flushing the cache
+// would drop unrelated keys
+func (s cacheStorage) Reset() error {
+	return nil
+}
+
+// Close is a no-op; the cache is shared and closed on shutdown
+func (s cacheStorage) Close() error {
+	return nil
+}
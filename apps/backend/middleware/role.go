@@ -1,17 +1,82 @@
 package middleware
 
 import (
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// RequireAdmin allows only admins through
 func RequireAdmin() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		user := c.Locals("user").(*jwt.Token)
-		claims := user.Claims.(jwt.MapClaims)
-		if claims["role"] != "admin" {
-			return c.Status(403).JSON(fiber.Map{"error": "Admin only"})
+		if !IsAdmin(c) {
+			return apierrors.Respond(c, apierrors.ErrForbidden.WithMessage("Admin only"))
 		}
 		return c.Next()
 	}
 }
+
+// IsAdmin reports whether the request is authenticated as an admin. It
+// checks the role of the user stored by InjectUser, so a demotion applies
+// before the token expires, and falls back to the token's role claim on
+// routes without InjectUser.
+func IsAdmin(c *fiber.Ctx) bool {
+	if user, ok := CurrentUser(c); ok {
+		return user.GetRole() == "admin"
+	}
+
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return ok && claims["role"] == "admin"
+}
+
+// RequirePermission allows only users holding permission through
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !HasPermission(c, permission) {
+			return apierrors.Respond(c, apierrors.ErrForbidden.WithMessage("Missing permission "+permission))
+		}
+		return c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user holds permission
+func HasPermission(c *fiber.Ctx, permission string) bool {
+	for _, p := range Permissions(c) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions of the authenticated user. Like
+// IsAdmin it prefers the user stored by InjectUser, so a role change applies
+// before the token expires, and falls back to the token's permissions claim.
+// Tokens issued before the claim existed have no permissions there.
+func Permissions(c *fiber.Ctx) []string {
+	if user, ok := CurrentUser(c); ok {
+		return user.GetPermissions()
+	}
+
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return []string{}
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return []string{}
+	}
+	// JSON arrays decode as []interface{}
+	raw, _ := claims["permissions"].([]interface{})
+	permissions := make([]string, 0, len(raw))
+	for _, p := range raw {
+		if s, ok := p.(string); ok {
+			permissions = append(permissions, s)
+		}
+	}
+	return permissions
+}
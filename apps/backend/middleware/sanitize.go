@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"reflect"
+	"strings"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+var strictPolicy = bluemonday.StrictPolicy()
+
+// maxSanitizeRounds caps how many times a value is sanitized and decoded
+const maxSanitizeRounds = 5
+
+// ErrTooDeeplyEncoded is returned for values that still decode to something
+// new after maxSanitizeRounds, which only nested entity encoding does
+var ErrTooDeeplyEncoded = errors.New("value has too many layers of HTML entity encoding")
+
+// SanitizeConfig configures the Sanitize middleware
+type SanitizeConfig struct {
+	// SkipFields lists JSON keys whose values are left untouched, such as
+	// passwords, which are hashed rather than displayed
+	SkipFields []string
+}
+
+// Sanitize rewrites JSON request bodies before handlers parse them, stripping
+// HTML tags, NULL bytes and control characters from every string value.
+// Bodies with a value that is too deeply entity-encoded are rejected.
+func Sanitize(config ...SanitizeConfig) fiber.Handler {
+	cfg := SanitizeConfig{SkipFields: []string{"password"}}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	skip := make(map[string]bool, len(cfg.SkipFields))
+	for _, field := range cfg.SkipFields {
+		skip[field] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		body := c.Body()
+		if len(body) == 0 || !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+			return c.Next()
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		// Keep numbers as written so large integers survive the round trip
+		decoder.UseNumber()
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			// Leave malformed bodies for BodyParser to reject
+			return c.Next()
+		}
+
+		value, err := sanitizeValue(value, skip)
+		if err != nil {
+			return apierrors.ErrInvalidRequestBody.WithMessage("Request body contains too deeply encoded HTML")
+		}
+		sanitized, err := json.Marshal(value)
+		if err != nil {
+			return c.Next()
+		}
+		c.Request().SetBody(sanitized)
+
+		return c.Next()
+	}
+}
+
+func sanitizeValue(value interface{}, skip map[string]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return sanitize(v)
+	case map[string]interface{}:
+		for key, field := range v {
+			if skip[key] {
+				continue
+			}
+			sanitized, err := sanitizeValue(field, skip)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = sanitized
+		}
+		return v, nil
+	case []interface{}:
+		for i := range v {
+			sanitized, err := sanitizeValue(v[i], skip)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = sanitized
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// SanitizeString strips HTML tags, NULL bytes and control characters other
+// than tab, newline and carriage return. Entities are decoded afterwards so
+// "Tom & Jerry" is stored as written; sanitizing repeats until the result is
+// stable so entity-encoded tags can't come back after decoding. A value that
+// isn't stable after maxSanitizeRounds is returned sanitized but still
+// encoded, so it can't turn into markup.
+func SanitizeString(s string) string {
+	clean, err := sanitize(s)
+	if err != nil {
+		return strictPolicy.Sanitize(stripControl(s))
+	}
+	return clean
+}
+
+// sanitize is SanitizeString, failing with ErrTooDeeplyEncoded instead of
+// falling back to the encoded value
+func sanitize(s string) (string, error) {
+	s = stripControl(s)
+	for i := 0; i < maxSanitizeRounds; i++ {
+		next := stripControl(html.UnescapeString(strictPolicy.Sanitize(s)))
+		if next == s {
+			return s, nil
+		}
+		s = next
+	}
+	return "", ErrTooDeeplyEncoded
+}
+
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return r
+		}
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// SanitizeStruct sanitizes every exported string field of the struct v
+// points to, including nested structs and slices, failing with
+// ErrTooDeeplyEncoded like the Sanitize middleware. Use it for input that
+// doesn't go through the middleware, such as gRPC requests.
+func SanitizeStruct(v interface{}) error {
+	return sanitizeReflect(reflect.ValueOf(v))
+}
+
+func sanitizeReflect(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return sanitizeReflect(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				if err := sanitizeReflect(v.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := sanitizeReflect(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if v.CanSet() {
+			clean, err := sanitize(v.String())
+			if err != nil {
+				return err
+			}
+			v.SetString(clean)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/AtillaTahaK/gobooklibrary/pkg/tracing"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Locals keys set by TraceContext
+const (
+	TraceIDKey      = "trace_id"
+	SpanIDKey       = "span_id"
+	ParentSpanIDKey = "parent_span_id"
+)
+
+// TraceContext continues the W3C trace in the request's traceparent and
+// tracestate headers, or starts a new one. The trace and span IDs are stored
+// in c.Locals and the span context in c.UserContext() so outbound calls can
+// propagate it. The response carries the request's traceparent.
+func TraceContext() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sc := tracing.Continue(c.Get(tracing.TraceparentHeader), c.Get(tracing.TracestateHeader))
+
+		c.Locals(TraceIDKey, sc.TraceID)
+		c.Locals(SpanIDKey, sc.SpanID)
+		if sc.ParentSpanID != "" {
+			c.Locals(ParentSpanIDKey, sc.ParentSpanID)
+		}
+		c.SetUserContext(tracing.NewContext(c.UserContext(), sc))
+		c.Set(tracing.TraceparentHeader, sc.Traceparent())
+
+		return c.Next()
+	}
+}
+
+// TraceFields returns the request's trace and span IDs as log fields, or
+// nil if TraceContext didn't run
+func TraceFields(c *fiber.Ctx) map[string]interface{} {
+	traceID, _ := c.Locals(TraceIDKey).(string)
+	if traceID == "" {
+		return nil
+	}
+	spanID, _ := c.Locals(SpanIDKey).(string)
+	return map[string]interface{}{
+		TraceIDKey: traceID,
+		SpanIDKey:  spanID,
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CurrentUserKey is the c.Locals key InjectUser stores the user under
+const CurrentUserKey = "current_user"
+
+// User is the authenticated user stored by InjectUser. *auth.User implements
+// it; auth imports this package, so the type can't be named here.
+type User interface {
+	GetUsername() string
+	GetRole() string
+	GetPermissions() []string
+}
+
+// LoadUser loads the user with the given ID for InjectUser, returning
+// ErrUserNotFound when there is none. Set in main; when nil InjectUser
+// stores nothing.
+var LoadUser func(ctx context.Context, id uint) (User, error)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// InjectUser stores the authenticated user in c.Locals(CurrentUserKey) so
+// handlers don't each query it. It runs after JWTProtected; a token whose
+// user no longer exists is rejected.
+func InjectUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := UserID(c)
+		if !ok || LoadUser == nil {
+			return c.Next()
+		}
+
+		user, err := LoadUser(c.UserContext(), id)
+		if errors.Is(err, ErrUserNotFound) {
+			return apierrors.Respond(c, apierrors.ErrUnauthorized.WithMessage("User no longer exists"))
+		}
+		if err != nil {
+			return err
+		}
+
+		c.Locals(CurrentUserKey, user)
+		return c.Next()
+	}
+}
+
+// CurrentUser returns the user stored by InjectUser, if there is one
+func CurrentUser(c *fiber.Ctx) (User, bool) {
+	user, ok := c.Locals(CurrentUserKey).(User)
+	return user, ok
+}
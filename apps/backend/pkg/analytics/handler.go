@@ -0,0 +1,32 @@
+package analytics
+
+import (
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTrendingBooks godoc
+// @Summary      Books with quickly rising views
+// @Description  Books whose views in the current hour grew faster than TRENDING_VELOCITY_THRESHOLD (5x by default) compared with the hour before, fastest first. Recomputed every 5 minutes.
+// @Tags         books
+// @Produce      json
+// @Param        limit  query int false "Maximum number of books" default(10) minimum(1) maximum(100)
+// @Success      200 {array} TrendingBook
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /books/trending [get]
+func (h *Handler) GetTrendingBooks(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	books, err := h.GetTrending(c.UserContext(), limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{"operation": "trending_books"})
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch trending books")
+	}
+	return c.JSON(books)
+}
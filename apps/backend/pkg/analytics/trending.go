@@ -0,0 +1,192 @@
+// Package analytics derives rankings from the view counts the book package
+// records in Redis, such as the books whose views are rising fastest
+package analytics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+// Handler ranks the views in the cache and serves the trending books,
+// loading them from the database
+type Handler struct {
+	db    *gorm.DB
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler reading books from conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{db: conn, cache: c, log: log}
+}
+
+// TrendingKey is the sorted set of trending book IDs scored by velocity
+const TrendingKey = "books:trending"
+
+// DefaultVelocityThreshold is the velocity a book must exceed to trend: its
+// views this hour are more than 5 times higher than in the hour before
+const DefaultVelocityThreshold = 5.0
+
+// TrendingInterval is how often the trending books are recomputed
+const TrendingInterval = 5 * time.Minute
+
+// VelocityThreshold is set from TRENDING_VELOCITY_THRESHOLD
+var VelocityThreshold = DefaultVelocityThreshold
+
+// TrendingBook is a book whose views are rising quickly
+type TrendingBook struct {
+	book.Book
+	Velocity float64 `json:"velocity" example:"12.5"`
+}
+
+// Velocity is the relative growth of views from the previous hour to the
+// last one. A book without views in the previous hour counts as having had
+// one, so a handful of first views doesn't make it trend.
+func Velocity(lastHour, previousHour int64) float64 {
+	if previousHour < 1 {
+		previousHour = 1
+	}
+	return float64(lastHour-previousHour) / float64(previousHour)
+}
+
+// hourlyViews returns the views of each book in the hour of t, by member
+func (h *Handler) hourlyViews(t time.Time) (map[string]int64, error) {
+	ranked, err := h.cache.ZRevRangeWithScores(book.HourlyViewsKey(t), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	views := make(map[string]int64, len(ranked))
+	for _, m := range ranked {
+		views[m.Member] = int64(m.Score)
+	}
+	return views, nil
+}
+
+// UpdateTrending compares each book's views in the hour of now, which is
+// still filling up, with its views in the hour before. Books faster than
+// VelocityThreshold are stored in TrendingKey with their velocity; books that
+// slowed down are removed. It returns the number of trending books.
+func (h *Handler) UpdateTrending(now time.Time) (int, error) {
+	if h.cache == nil {
+		return 0, nil
+	}
+	lastHour, err := h.hourlyViews(now)
+	if err != nil {
+		return 0, err
+	}
+	previousHour, err := h.hourlyViews(now.Add(-time.Hour))
+	if err != nil {
+		return 0, err
+	}
+
+	trending := make(map[uint]float64)
+	for member, views := range lastHour {
+		id, err := strconv.ParseUint(member, 10, 32)
+		if err != nil {
+			continue
+		}
+		if velocity := Velocity(views, previousHour[member]); velocity > VelocityThreshold {
+			trending[uint(id)] = velocity
+		}
+	}
+
+	// Remove the books that stopped trending instead of rebuilding the set,
+	// so readers never see it empty
+	current, err := h.cache.ZRevRangeWithScores(TrendingKey, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	var stale []interface{}
+	for _, m := range current {
+		id, err := strconv.ParseUint(m.Member, 10, 32)
+		if _, ok := trending[uint(id)]; err != nil || !ok {
+			stale = append(stale, m.Member)
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := h.cache.ZRem(TrendingKey, stale...); err != nil {
+			return 0, err
+		}
+	}
+	for id, velocity := range trending {
+		if err := h.cache.ZAdd(TrendingKey, velocity, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(trending), nil
+}
+
+// StartTrendingUpdater updates the trending books and the
+// trending_books_total metric now and then every interval until ctx is done
+func (h *Handler) StartTrendingUpdater(ctx context.Context, interval time.Duration) {
+	update := func() {
+		count, err := h.UpdateTrending(time.Now())
+		if err != nil {
+			if h.log != nil {
+				h.log.LogError(err, map[string]interface{}{"operation": "update_trending_books"})
+			}
+			return
+		}
+		metrics.SetTrendingBooks(count)
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		update()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
+
+// GetTrending returns up to limit trending books, fastest rising first.
+// Deleted books are skipped.
+func (h *Handler) GetTrending(ctx context.Context, limit int) ([]TrendingBook, error) {
+	if h.cache == nil {
+		return []TrendingBook{}, nil
+	}
+	ranked, err := h.cache.ZRevRangeWithScores(TrendingKey, 0, int64(limit)-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranked) == 0 {
+		return []TrendingBook{}, nil
+	}
+
+	ids := make([]uint, 0, len(ranked))
+	for _, m := range ranked {
+		if id, err := strconv.ParseUint(m.Member, 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	var books []book.Book
+	if err := h.db.WithContext(ctx).Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]book.Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	trending := make([]TrendingBook, 0, len(ranked))
+	for _, m := range ranked {
+		id, _ := strconv.ParseUint(m.Member, 10, 32)
+		if b, ok := byID[uint(id)]; ok {
+			trending = append(trending, TrendingBook{Book: b, Velocity: m.Score})
+		}
+	}
+	return trending, nil
+}
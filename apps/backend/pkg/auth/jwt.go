@@ -0,0 +1,171 @@
+// Package auth signs and verifies access tokens. Tokens are signed with
+// HS256 and a shared secret by default, or with RS256 so that services that
+// only verify tokens need just the public key.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT_ALGORITHM values
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+// DefaultKeyBits is the RSA key size GenerateKeyPair uses when given 0
+const DefaultKeyBits = 2048
+
+// defaultSecret is used when JWT_SECRET is unset
+const defaultSecret = "supersecret"
+
+// Signer signs tokens with one algorithm and only accepts tokens signed with
+// that algorithm, so a token can't pick how it is verified, e.g. an HS256
+// token "signed" with the RSA public key.
+type Signer struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHS256Signer signs and verifies with a shared secret
+func NewHS256Signer(secret []byte) *Signer {
+	return &Signer{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewRS256Signer signs with privateKey and verifies with publicKey. A signer
+// without a private key can only verify.
+func NewRS256Signer(privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) *Signer {
+	if publicKey == nil && privateKey != nil {
+		publicKey = &privateKey.PublicKey
+	}
+	var signKey interface{}
+	if privateKey != nil {
+		signKey = privateKey
+	}
+	return &Signer{method: jwt.SigningMethodRS256, signKey: signKey, verifyKey: publicKey}
+}
+
+// SignerFromEnv creates the signer selected by JWT_ALGORITHM (default
+// HS256). HS256 uses JWT_SECRET; RS256 loads PEM keys from
+// JWT_PRIVATE_KEY_PATH and JWT_PUBLIC_KEY_PATH. Without a private key the
+// signer can only verify tokens.
+func SignerFromEnv() (*Signer, error) {
+	switch algorithm := strings.ToUpper(os.Getenv("JWT_ALGORITHM")); algorithm {
+	case "", AlgorithmHS256:
+		return NewHS256Signer(secretFromEnv()), nil
+	case AlgorithmRS256:
+		var privateKey *rsa.PrivateKey
+		if path := os.Getenv("JWT_PRIVATE_KEY_PATH"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read JWT_PRIVATE_KEY_PATH: %w", err)
+			}
+			if privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(data); err != nil {
+				return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+			}
+		}
+		var publicKey *rsa.PublicKey
+		if path := os.Getenv("JWT_PUBLIC_KEY_PATH"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read JWT_PUBLIC_KEY_PATH: %w", err)
+			}
+			if publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+				return nil, fmt.Errorf("invalid public key in %s: %w", path, err)
+			}
+		}
+		if privateKey == nil && publicKey == nil {
+			return nil, fmt.Errorf("RS256 needs JWT_PRIVATE_KEY_PATH or JWT_PUBLIC_KEY_PATH")
+		}
+		if privateKey != nil && publicKey != nil && !privateKey.PublicKey.Equal(publicKey) {
+			return nil, fmt.Errorf("JWT_PUBLIC_KEY_PATH doesn't match JWT_PRIVATE_KEY_PATH")
+		}
+		return NewRS256Signer(privateKey, publicKey), nil
+	default:
+		return nil, fmt.Errorf("JWT_ALGORITHM must be HS256 or RS256, got %q", algorithm)
+	}
+}
+
+func secretFromEnv() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = defaultSecret
+	}
+	return []byte(secret)
+}
+
+// Algorithm returns the signer's algorithm, e.g. "RS256"
+func (s *Signer) Algorithm() string {
+	return s.method.Alg()
+}
+
+// Sign signs claims
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	if s.signKey == nil {
+		return "", fmt.Errorf("no %s signing key configured", s.Algorithm())
+	}
+	return jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+}
+
+// Parse verifies tokenStr and returns the parsed token. Tokens signed with
+// any other algorithm are rejected.
+func (s *Signer) Parse(tokenStr string) (*jwt.Token, error) {
+	return jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != s.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s: %w", token.Method.Alg(), jwt.ErrSignatureInvalid)
+		}
+		return s.verifyKey, nil
+	}, jwt.WithValidMethods([]string{s.method.Alg()}))
+}
+
+var current atomic.Pointer[Signer]
+
+// SetSigner makes s the signer returned by Current
+func SetSigner(s *Signer) {
+	current.Store(s)
+}
+
+// Current returns the signer set with SetSigner. Until one is set it is an
+// HS256 signer using JWT_SECRET as it is at the time of the call.
+func Current() *Signer {
+	if s := current.Load(); s != nil {
+		return s
+	}
+	return NewHS256Signer(secretFromEnv())
+}
+
+// GenerateKeyPair creates an RSA key pair for RS256, PEM-encoded as PKCS#8
+// and PKIX, e.g. to rotate the keys at JWT_PRIVATE_KEY_PATH and
+// JWT_PUBLIC_KEY_PATH. bits of 0 uses DefaultKeyBits.
+func GenerateKeyPair(bits int) (privatePEM, publicPEM []byte, err error) {
+	if bits == 0 {
+		bits = DefaultKeyBits
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privatePEM, publicPEM, nil
+}
@@ -0,0 +1,178 @@
+// Package batch runs several API calls sent in one HTTP request, so clients
+// on slow links can save round trips.
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/sync/errgroup"
+)
+
+// MaxOperations is the most operations one batch may contain
+const MaxOperations = 20
+
+// DefaultConcurrency is how many operations of a batch run at once unless
+// BATCH_CONCURRENCY says otherwise
+const DefaultConcurrency = 5
+
+// Path is where batches are posted; operations can't target it
+const Path = "/batch"
+
+var allowedMethods = map[string]bool{
+	fiber.MethodGet:    true,
+	fiber.MethodPost:   true,
+	fiber.MethodPut:    true,
+	fiber.MethodPatch:  true,
+	fiber.MethodDelete: true,
+}
+
+// Operation is one API call in a batch. Headers are the only credentials it
+// is sent with; the batch request's own Authorization isn't passed on.
+type Operation struct {
+	Method  string            `json:"method" example:"GET"`
+	Path    string            `json:"path" example:"/books/1"`
+	Body    json.RawMessage   `json:"body,omitempty" swaggertype:"object"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Request is the body of POST /batch
+type Request struct {
+	Requests []Operation `json:"requests"`
+}
+
+// Result is the response to one operation. Body is the response's JSON, or
+// a string when the response isn't JSON.
+type Result struct {
+	Status int         `json:"status" example:"200"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+// ConcurrencyFromEnv reads BATCH_CONCURRENCY
+func ConcurrencyFromEnv() (int, error) {
+	raw := os.Getenv("BATCH_CONCURRENCY")
+	if raw == "" {
+		return DefaultConcurrency, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return DefaultConcurrency, fmt.Errorf("BATCH_CONCURRENCY must be a positive number, got %q", raw)
+	}
+	return n, nil
+}
+
+// Handler godoc
+// @Summary      Run several API calls in one request
+// @Description  Runs up to 20 operations against this API, at most BATCH_CONCURRENCY at a time, and returns their responses in order. Each operation is authenticated only by its own headers, and a failed operation doesn't stop the others.
+// @Tags         batch
+// @Accept       json
+// @Produce      json
+// @Param        batch body Request true "Operations to run"
+// @Success      207  {array}  Result
+// @Failure      400  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /batch [post]
+func Handler(app *fiber.App, concurrency int) fiber.Handler {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	// Routes are registered after this handler is created, so the app's
+	// request handler is only taken on the first batch
+	var (
+		once    sync.Once
+		handler fasthttp.RequestHandler
+	)
+
+	return func(c *fiber.Ctx) error {
+		var req Request
+		if err := c.BodyParser(&req); err != nil {
+			return apierrors.ErrInvalidRequestBody
+		}
+		if err := validate(req.Requests); err != nil {
+			return apierrors.ErrInvalidRequestBody.WithMessage(err.Error())
+		}
+		once.Do(func() { handler = app.Handler() })
+		// c isn't safe for concurrent use, so read what operations need first
+		host, remoteAddr := c.Hostname(), c.Context().RemoteAddr()
+
+		results := make([]Result, len(req.Requests))
+		var g errgroup.Group
+		g.SetLimit(concurrency)
+		for i, op := range req.Requests {
+			i, op := i, op
+			g.Go(func() error {
+				results[i] = run(handler, host, remoteAddr, op)
+				return nil
+			})
+		}
+		g.Wait()
+
+		return c.Status(fiber.StatusMultiStatus).JSON(results)
+	}
+}
+
+func validate(ops []Operation) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("requests must contain at least one operation")
+	}
+	if len(ops) > MaxOperations {
+		return fmt.Errorf("a batch can contain at most %d operations, got %d", MaxOperations, len(ops))
+	}
+	for i, op := range ops {
+		if !allowedMethods[strings.ToUpper(op.Method)] {
+			return fmt.Errorf("requests[%d]: unsupported method %q", i, op.Method)
+		}
+		if !strings.HasPrefix(op.Path, "/") {
+			return fmt.Errorf("requests[%d]: path must start with /", i)
+		}
+		if op.Path == Path || strings.HasPrefix(op.Path, Path+"?") || strings.HasPrefix(op.Path, Path+"/") {
+			return fmt.Errorf("requests[%d]: batches can't be nested", i)
+		}
+	}
+	return nil
+}
+
+// run sends op through the app's full middleware stack. The operation keeps
+// the caller's address, so it counts against the caller's rate limit.
+func run(handler fasthttp.RequestHandler, host string, remoteAddr net.Addr, op Operation) Result {
+	var req fasthttp.Request
+	req.Header.SetMethod(strings.ToUpper(op.Method))
+	req.SetRequestURI(op.Path)
+	req.Header.SetHost(host)
+	for name, value := range op.Headers {
+		req.Header.Set(name, value)
+	}
+	// Bodies are embedded in the batch response, which is compressed as a whole
+	req.Header.Del(fiber.HeaderAcceptEncoding)
+	if len(op.Body) > 0 {
+		req.SetBody(op.Body)
+		if len(req.Header.ContentType()) == 0 {
+			req.Header.SetContentType(fiber.MIMEApplicationJSON)
+		}
+	}
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, remoteAddr, nil)
+	handler(&ctx)
+
+	result := Result{Status: ctx.Response.StatusCode()}
+	body := bytes.TrimSpace(ctx.Response.Body())
+	switch {
+	// These statuses have no body on the wire either
+	case len(body) == 0, result.Status == fiber.StatusNoContent, result.Status == fiber.StatusNotModified:
+	case json.Valid(body):
+		result.Body = json.RawMessage(append([]byte(nil), body...))
+	default:
+		result.Body = string(body)
+	}
+	return result
+}
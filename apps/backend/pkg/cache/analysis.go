@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of AnalysisConfig
+const (
+	DefaultAnalysisMaxKeys = 10000
+	DefaultKeyMaxSizeBytes = 100 << 10
+)
+
+// Size buckets of Analysis.SizeDistribution
+const (
+	SizeUnder1KB   = "<1KB"
+	Size1To10KB    = "1-10KB"
+	Size10To100KB  = "10-100KB"
+	SizeOver100KB  = ">100KB"
+	largestKeysLen = 10
+	// strLenBatchSize is the number of STRLEN commands per pipeline
+	strLenBatchSize = 1000
+)
+
+// AnalysisConfig limits a cache analysis
+type AnalysisConfig struct {
+	// MaxKeys is the number of keys scanned at most
+	MaxKeys int
+	// MaxKeySizeBytes is the value size above which a key is reported as
+	// a warning
+	MaxKeySizeBytes int64
+}
+
+// AnalysisConfigFromEnv reads CACHE_ANALYSIS_MAX_KEYS and
+// CACHE_KEY_MAX_SIZE_BYTES. On an invalid value it returns the defaults
+// with an error.
+func AnalysisConfigFromEnv() (AnalysisConfig, error) {
+	config := AnalysisConfig{MaxKeys: DefaultAnalysisMaxKeys, MaxKeySizeBytes: DefaultKeyMaxSizeBytes}
+	if raw := os.Getenv("CACHE_ANALYSIS_MAX_KEYS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("CACHE_ANALYSIS_MAX_KEYS must be a positive number, got %q", raw)
+		}
+		config.MaxKeys = n
+	}
+	if raw := os.Getenv("CACHE_KEY_MAX_SIZE_BYTES"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("CACHE_KEY_MAX_SIZE_BYTES must be a positive number, got %q", raw)
+		}
+		config.MaxKeySizeBytes = n
+	}
+	return config, nil
+}
+
+// KeySize is the size of the value at a key
+type KeySize struct {
+	Key   string `json:"key" example:"books:all"`
+	Bytes int64  `json:"bytes" example:"204800"`
+}
+
+// Analysis is the size breakdown of the string values in the cache
+type Analysis struct {
+	TotalKeys  int   `json:"total_keys" example:"1500"`
+	TotalBytes int64 `json:"total_bytes" example:"3145728"`
+	// SizeDistribution counts the keys in each size bucket
+	SizeDistribution map[string]int `json:"size_distribution"`
+	// LargestKeys are the 10 largest values, largest first
+	LargestKeys []KeySize `json:"largest_keys"`
+	// NonStringKeys counts the hashes, sorted sets and other keys whose
+	// size isn't measured
+	NonStringKeys int `json:"non_string_keys" example:"12"`
+	// Warnings lists the keys above CACHE_KEY_MAX_SIZE_BYTES
+	Warnings []string `json:"warnings"`
+	// Complete is false when the scan stopped at CACHE_ANALYSIS_MAX_KEYS
+	Complete bool `json:"complete"`
+}
+
+func sizeBucket(bytes int64) string {
+	switch {
+	case bytes < 1<<10:
+		return SizeUnder1KB
+	case bytes < 10<<10:
+		return Size1To10KB
+	case bytes <= 100<<10:
+		return Size10To100KB
+	default:
+		return SizeOver100KB
+	}
+}
+
+// Analyze scans up to config.MaxKeys keys with SCAN and measures their
+// values with pipelined STRLEN calls. Only string values are counted in the
+// totals. It sets the cache_largest_key_bytes gauge.
+func Analyze(c Cache, config AnalysisConfig) (*Analysis, error) {
+	keys, complete, err := c.Scan("*", config.MaxKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &Analysis{
+		SizeDistribution: map[string]int{SizeUnder1KB: 0, Size1To10KB: 0, Size10To100KB: 0, SizeOver100KB: 0},
+		LargestKeys:      []KeySize{},
+		Warnings:         []string{},
+		Complete:         complete,
+	}
+	var sizes []KeySize
+	for start := 0; start < len(keys); start += strLenBatchSize {
+		batch := keys[start:min(start+strLenBatchSize, len(keys))]
+		lengths, err := c.StrLen(batch...)
+		if err != nil {
+			return nil, err
+		}
+		for i, n := range lengths {
+			if n < 0 {
+				analysis.NonStringKeys++
+				continue
+			}
+			sizes = append(sizes, KeySize{Key: batch[i], Bytes: n})
+		}
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].Key < sizes[j].Key
+	})
+	for _, size := range sizes {
+		analysis.TotalKeys++
+		analysis.TotalBytes += size.Bytes
+		analysis.SizeDistribution[sizeBucket(size.Bytes)]++
+		if size.Bytes > config.MaxKeySizeBytes {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("%s is %d bytes, above the %d byte limit", size.Key, size.Bytes, config.MaxKeySizeBytes))
+		}
+	}
+	analysis.LargestKeys = append(analysis.LargestKeys, sizes[:min(largestKeysLen, len(sizes))]...)
+
+	var largest int64
+	if len(sizes) > 0 {
+		largest = sizes[0].Bytes
+	}
+	metrics.SetCacheLargestKeyBytes(largest)
+	return analysis, nil
+}
+
+// AnalysisHandler godoc
+// @Summary      Analyze cache key sizes (admin only)
+// @Description  Scans up to CACHE_ANALYSIS_MAX_KEYS keys in Redis with SCAN and measures their values with pipelined STRLEN calls. Keys above CACHE_KEY_MAX_SIZE_BYTES are listed in warnings. Hashes, sorted sets and other non-string keys are only counted in non_string_keys.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} Analysis
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/cache/analysis [get]
+func AnalysisHandler(c Cache, config AnalysisConfig) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if c == nil {
+			return apierrors.ErrInternal.WithMessage("Cache is not configured")
+		}
+		analysis, err := Analyze(c, config)
+		if err != nil {
+			return apierrors.ErrInternal.WithMessage("Failed to analyze cache")
+		}
+		return ctx.JSON(analysis)
+	}
+}
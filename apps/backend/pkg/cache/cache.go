@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Cache is the key-value store used for caching, counters and queues.
+// Values passed to Set, SetNX, HSet and ZAdd are stored as JSON.
+type Cache interface {
+	Set(key string, value interface{}, expiration time.Duration) error
+	Get(key string, dest interface{}) error
+	GetWithSlidingTTL(key string, dest interface{}, slidingTTL time.Duration) error
+	GetXFetch(key string, dest interface{}, ttl, delta time.Duration, beta float64, fetch func() (interface{}, error)) error
+	Delete(keys ...string) error
+	Exists(key string) (bool, error)
+	Expire(key string, expiration time.Duration) error
+	Keys(pattern string) ([]string, error)
+	Scan(pattern string, limit int) (keys []string, complete bool, err error)
+	StrLen(keys ...string) ([]int64, error)
+	FlushAll() error
+	Incr(key string) (int64, error)
+	IncrBy(key string, value int64) (int64, error)
+	GetStats() (*CacheStats, error)
+	Ping() error
+	PingContext(ctx context.Context) error
+	Close() error
+	SetNX(key string, value interface{}, expiration time.Duration) (bool, error)
+	TTL(key string) (time.Duration, error)
+	GetInt64(key string) (int64, error)
+	GetDelInt64(key string) (int64, error)
+	PFAdd(key string, elements ...interface{}) error
+	PFCount(keys ...string) (int64, error)
+	HSet(key string, values map[string]interface{}) error
+	HGetAll(key string) (map[string]string, error)
+	ZAdd(key string, score float64, member interface{}) error
+	ZRangeByScore(key string, max float64) ([]string, error)
+	ZRem(key string, members ...interface{}) (int64, error)
+	ZIncrBy(key string, increment float64, member string) (float64, error)
+	ZRevRangeWithScores(key string, start, stop int64) ([]ScoredMember, error)
+	RunScript(script *redis.Script, keys []string, args ...interface{}) (interface{}, error)
+}
+
+var _ Cache = (*RedisCache)(nil)
+
+// ErrNotFound is returned by Get and GetWithSlidingTTL for a missing key, so
+// callers can tell a miss from Redis being unavailable
+var ErrNotFound = errors.New("key not found")
+
+// ScoredMember is a raw sorted set member with its score
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// Redis deployment modes selected by REDIS_MODE
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Config selects and configures a Redis deployment
+type Config struct {
+	Mode string
+	// Addrs is the server address in standalone mode and the seed nodes in
+	// cluster mode
+	Addrs         []string
+	MasterName    string
+	SentinelAddrs []string
+	Password      string
+	DB            int
+}
+
+// ConfigFromEnv reads REDIS_MODE (standalone, sentinel or cluster; default
+// standalone), REDIS_URL (comma-separated in cluster mode), REDIS_PASSWORD,
+// REDIS_DB, REDIS_MASTER_NAME and REDIS_SENTINEL_ADDRS (comma-separated)
+func ConfigFromEnv() Config {
+	config := Config{
+		Mode:          strings.ToLower(strings.TrimSpace(os.Getenv("REDIS_MODE"))),
+		Addrs:         splitAddrs(os.Getenv("REDIS_URL")),
+		MasterName:    os.Getenv("REDIS_MASTER_NAME"),
+		SentinelAddrs: splitAddrs(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		Password:      os.Getenv("REDIS_PASSWORD"),
+	}
+	if config.Mode == "" {
+		config.Mode = ModeStandalone
+	}
+	if len(config.Addrs) == 0 {
+		config.Addrs = []string{"localhost:6379"}
+	}
+	if db, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		config.DB = db
+	}
+	return config
+}
+
+func splitAddrs(value string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Validate reports configuration that can't work for the selected mode
+func (c Config) Validate() error {
+	switch c.Mode {
+	case ModeStandalone, ModeCluster:
+		return nil
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return fmt.Errorf("REDIS_MASTER_NAME is required in sentinel mode")
+		}
+		if len(c.SentinelAddrs) == 0 {
+			return fmt.Errorf("REDIS_SENTINEL_ADDRS is required in sentinel mode")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown REDIS_MODE %q, expected standalone, sentinel or cluster", c.Mode)
+}
+
+// New creates a cache for config
+func New(config Config) (*RedisCache, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Mode {
+	case ModeSentinel:
+		return NewRedisFailoverCache(config.MasterName, config.SentinelAddrs, config.Password, config.DB), nil
+	case ModeCluster:
+		// Cluster mode has no databases other than 0
+		return NewRedisClusterCache(config.Addrs, config.Password), nil
+	}
+	return NewRedisCache(config.Addrs[0], config.Password, config.DB), nil
+}
+
+// NewCacheFromEnv creates a cache for ConfigFromEnv. Invalid configuration
+// falls back to a standalone server so a typo doesn't stop the API, which
+// works without Redis. The client is re-created if it gets closed.
+//
+// With USE_MSGPACK_CACHE=true values are stored as MessagePack, which is
+// about 30% smaller than JSON for book lists.
+func NewCacheFromEnv() Cache {
+	config := ConfigFromEnv()
+	useMsgpack := os.Getenv("USE_MSGPACK_CACHE") == "true"
+
+	return NewReconnectingCache(func() Cache {
+		c, err := New(config)
+		if err != nil {
+			fmt.Printf("Warning: %v; using standalone Redis at %s\n", err, config.Addrs[0])
+			c = NewRedisCache(config.Addrs[0], config.Password, config.DB)
+		}
+
+		if useMsgpack {
+			return NewMsgpackCache(c)
+		}
+		return c
+	})
+}
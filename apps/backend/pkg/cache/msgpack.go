@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MarshalMP encodes value as MessagePack. Struct fields use their json tag
+// names so cached values keep the field names and omitempty rules of the API.
+func MarshalMP(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalMP decodes a value encoded by MarshalMP
+func UnmarshalMP(data []byte, dest interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(dest)
+}
+
+// isJSON reports whether a cached value was written by Set rather than
+// SetMP. MessagePack maps, arrays and strings never start with a JSON
+// delimiter; the only overlap is single-digit positive integers, which
+// decode to the same number either way.
+func isJSON(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	switch c := data[0]; {
+	case c == '{' || c == '[' || c == '"' || c == '-' || c == 't' || c == 'f' || c == 'n':
+	case c >= '0' && c <= '9':
+	case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+	default:
+		return false
+	}
+	return json.Valid(data)
+}
+
+// SetMP stores value encoded as MessagePack
+func (r *RedisCache) SetMP(key string, value interface{}, ttl time.Duration) error {
+	data, err := MarshalMP(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	if err := r.client.Set(r.ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set cache key %s: %w", key, err)
+	}
+	return nil
+}
+
+// GetMP reads a value stored by SetMP. Values written as JSON by Set are
+// detected and decoded as JSON, so keys cached before switching formats
+// stay readable until they expire.
+func (r *RedisCache) GetMP(key string, dest interface{}) error {
+	data, err := r.client.Get(r.ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to get cache key %s: %w", key, err)
+	}
+
+	return decodeMP(data, dest)
+}
+
+func decodeMP(data []byte, dest interface{}) error {
+	var err error
+	if isJSON(data) {
+		err = json.Unmarshal(data, dest)
+	} else {
+		err = UnmarshalMP(data, dest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal cached value: %w", err)
+	}
+	return nil
+}
+
+// MsgpackCache is a RedisCache that stores values set with Set as
+// MessagePack. It is selected with USE_MSGPACK_CACHE=true.
+type MsgpackCache struct {
+	*RedisCache
+}
+
+var _ Cache = (*MsgpackCache)(nil)
+
+// NewMsgpackCache wraps r so Set and Get use MessagePack
+func NewMsgpackCache(r *RedisCache) *MsgpackCache {
+	return &MsgpackCache{RedisCache: r}
+}
+
+// Set stores value encoded as MessagePack
+func (m *MsgpackCache) Set(key string, value interface{}, expiration time.Duration) error {
+	return m.SetMP(key, value, expiration)
+}
+
+// Get reads a value stored as MessagePack or JSON
+func (m *MsgpackCache) Get(key string, dest interface{}) error {
+	return m.GetMP(key, dest)
+}
+
+// GetWithSlidingTTL reads a value stored as MessagePack or JSON and resets
+// its TTL to slidingTTL
+func (m *MsgpackCache) GetWithSlidingTTL(key string, dest interface{}, slidingTTL time.Duration) error {
+	data, err := m.getAndExpire(key, slidingTTL)
+	if err != nil {
+		return err
+	}
+	return decodeMP(data, dest)
+}
+
+// GetXFetch is RedisCache.GetXFetch storing recomputed values as
+// MessagePack
+func (m *MsgpackCache) GetXFetch(key string, dest interface{}, ttl, delta time.Duration, beta float64, fetch func() (interface{}, error)) error {
+	return m.getXFetch(key, dest, ttl, delta, beta, fetch, MarshalMP, decodeMP)
+}
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// ReconnectingCache is a Cache that re-creates its client when an operation
+// fails with redis.ErrClosed, then retries the operation once. A closed
+// client never recovers on its own, unlike a dropped connection, which the
+// client's pool replaces.
+type ReconnectingCache struct {
+	mu      sync.RWMutex
+	current Cache
+	connect func() Cache
+}
+
+var _ Cache = (*ReconnectingCache)(nil)
+
+// NewReconnectingCache creates a cache using connect now and whenever the
+// client turns out to be closed
+func NewReconnectingCache(connect func() Cache) *ReconnectingCache {
+	return &ReconnectingCache{current: connect(), connect: connect}
+}
+
+func (r *ReconnectingCache) cache() Cache {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// reconnect replaces closed with a new client, unless another caller
+// already did
+func (r *ReconnectingCache) reconnect(closed Cache) Cache {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == closed {
+		r.current = r.connect()
+		metrics.RecordRedisReconnect()
+		fmt.Println("Warning: Redis client was closed; reconnected")
+	}
+	return r.current
+}
+
+// do runs op, reconnecting and retrying once if the client was closed
+func (r *ReconnectingCache) do(op func(c Cache) error) error {
+	c := r.cache()
+	err := op(c)
+	if errors.Is(err, redis.ErrClosed) {
+		err = op(r.reconnect(c))
+	}
+	return err
+}
+
+func (r *ReconnectingCache) Set(key string, value interface{}, expiration time.Duration) error {
+	return r.do(func(c Cache) error { return c.Set(key, value, expiration) })
+}
+
+func (r *ReconnectingCache) Get(key string, dest interface{}) error {
+	return r.do(func(c Cache) error { return c.Get(key, dest) })
+}
+
+func (r *ReconnectingCache) GetWithSlidingTTL(key string, dest interface{}, slidingTTL time.Duration) error {
+	return r.do(func(c Cache) error { return c.GetWithSlidingTTL(key, dest, slidingTTL) })
+}
+
+func (r *ReconnectingCache) GetXFetch(key string, dest interface{}, ttl, delta time.Duration, beta float64, fetch func() (interface{}, error)) error {
+	return r.do(func(c Cache) error { return c.GetXFetch(key, dest, ttl, delta, beta, fetch) })
+}
+
+func (r *ReconnectingCache) Delete(keys ...string) error {
+	return r.do(func(c Cache) error { return c.Delete(keys...) })
+}
+
+func (r *ReconnectingCache) Exists(key string) (exists bool, err error) {
+	err = r.do(func(c Cache) error {
+		exists, err = c.Exists(key)
+		return err
+	})
+	return exists, err
+}
+
+func (r *ReconnectingCache) Expire(key string, expiration time.Duration) error {
+	return r.do(func(c Cache) error { return c.Expire(key, expiration) })
+}
+
+func (r *ReconnectingCache) Keys(pattern string) (keys []string, err error) {
+	err = r.do(func(c Cache) error {
+		keys, err = c.Keys(pattern)
+		return err
+	})
+	return keys, err
+}
+
+func (r *ReconnectingCache) Scan(pattern string, limit int) (keys []string, complete bool, err error) {
+	err = r.do(func(c Cache) error {
+		keys, complete, err = c.Scan(pattern, limit)
+		return err
+	})
+	return keys, complete, err
+}
+
+func (r *ReconnectingCache) StrLen(keys ...string) (lengths []int64, err error) {
+	err = r.do(func(c Cache) error {
+		lengths, err = c.StrLen(keys...)
+		return err
+	})
+	return lengths, err
+}
+
+func (r *ReconnectingCache) FlushAll() error {
+	return r.do(func(c Cache) error { return c.FlushAll() })
+}
+
+func (r *ReconnectingCache) Incr(key string) (n int64, err error) {
+	err = r.do(func(c Cache) error {
+		n, err = c.Incr(key)
+		return err
+	})
+	return n, err
+}
+
+func (r *ReconnectingCache) IncrBy(key string, value int64) (n int64, err error) {
+	err = r.do(func(c Cache) error {
+		n, err = c.IncrBy(key, value)
+		return err
+	})
+	return n, err
+}
+
+func (r *ReconnectingCache) GetStats() (stats *CacheStats, err error) {
+	err = r.do(func(c Cache) error {
+		stats, err = c.GetStats()
+		return err
+	})
+	return stats, err
+}
+
+func (r *ReconnectingCache) Ping() error {
+	return r.do(func(c Cache) error { return c.Ping() })
+}
+
+func (r *ReconnectingCache) PingContext(ctx context.Context) error {
+	return r.do(func(c Cache) error { return c.PingContext(ctx) })
+}
+
+// Close closes the current client. Later operations reconnect.
+func (r *ReconnectingCache) Close() error {
+	return r.cache().Close()
+}
+
+func (r *ReconnectingCache) SetNX(key string, value interface{}, expiration time.Duration) (set bool, err error) {
+	err = r.do(func(c Cache) error {
+		set, err = c.SetNX(key, value, expiration)
+		return err
+	})
+	return set, err
+}
+
+func (r *ReconnectingCache) TTL(key string) (ttl time.Duration, err error) {
+	err = r.do(func(c Cache) error {
+		ttl, err = c.TTL(key)
+		return err
+	})
+	return ttl, err
+}
+
+func (r *ReconnectingCache) GetInt64(key string) (n int64, err error) {
+	err = r.do(func(c Cache) error {
+		n, err = c.GetInt64(key)
+		return err
+	})
+	return n, err
+}
+
+func (r *ReconnectingCache) GetDelInt64(key string) (n int64, err error) {
+	err = r.do(func(c Cache) error {
+		n, err = c.GetDelInt64(key)
+		return err
+	})
+	return n, err
+}
+
+func (r *ReconnectingCache) PFAdd(key string, elements ...interface{}) error {
+	return r.do(func(c Cache) error { return c.PFAdd(key, elements...) })
+}
+
+func (r *ReconnectingCache) PFCount(keys ...string) (n int64, err error) {
+	err = r.do(func(c Cache) error {
+		n, err = c.PFCount(keys...)
+		return err
+	})
+	return n, err
+}
+
+func (r *ReconnectingCache) HSet(key string, values map[string]interface{}) error {
+	return r.do(func(c Cache) error { return c.HSet(key, values) })
+}
+
+func (r *ReconnectingCache) HGetAll(key string) (values map[string]string, err error) {
+	err = r.do(func(c Cache) error {
+		values, err = c.HGetAll(key)
+		return err
+	})
+	return values, err
+}
+
+func (r *ReconnectingCache) ZAdd(key string, score float64, member interface{}) error {
+	return r.do(func(c Cache) error { return c.ZAdd(key, score, member) })
+}
+
+func (r *ReconnectingCache) ZRangeByScore(key string, max float64) (members []string, err error) {
+	err = r.do(func(c Cache) error {
+		members, err = c.ZRangeByScore(key, max)
+		return err
+	})
+	return members, err
+}
+
+func (r *ReconnectingCache) ZRem(key string, members ...interface{}) (n int64, err error) {
+	err = r.do(func(c Cache) error {
+		n, err = c.ZRem(key, members...)
+		return err
+	})
+	return n, err
+}
+
+func (r *ReconnectingCache) ZIncrBy(key string, increment float64, member string) (score float64, err error) {
+	err = r.do(func(c Cache) error {
+		score, err = c.ZIncrBy(key, increment, member)
+		return err
+	})
+	return score, err
+}
+
+func (r *ReconnectingCache) ZRevRangeWithScores(key string, start, stop int64) (members []ScoredMember, err error) {
+	err = r.do(func(c Cache) error {
+		members, err = c.ZRevRangeWithScores(key, start, stop)
+		return err
+	})
+	return members, err
+}
+
+func (r *ReconnectingCache) RunScript(script *redis.Script, keys []string, args ...interface{}) (result interface{}, err error) {
+	err = r.do(func(c Cache) error {
+		result, err = c.RunScript(script, keys, args...)
+		return err
+	})
+	return result, err
+}
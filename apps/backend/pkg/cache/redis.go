@@ -4,13 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// RedisCache implements Cache on a standalone, Sentinel-managed or cluster
+// Redis deployment
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ctx    context.Context
 }
 
@@ -23,6 +28,7 @@ type CacheStats struct {
 	Connected bool
 }
 
+// NewRedisCache connects to a single Redis server
 func NewRedisCache(addr, password string, db int) *RedisCache {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
@@ -36,15 +42,63 @@ func NewRedisCache(addr, password string, db int) *RedisCache {
 		WriteTimeout: 3 * time.Second,
 	})
 
+	return newRedisCache(rdb)
+}
+
+// NewRedisFailoverCache connects to the master of a Sentinel-managed Redis
+// deployment and follows it to the new master on failover
+func NewRedisFailoverCache(masterName string, sentinelAddrs []string, password string, db int) *RedisCache {
+	rdb := redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:    masterName,
+		SentinelAddrs: sentinelAddrs,
+		Password:      password,
+		DB:            db,
+		PoolSize:      10,
+		MinIdleConns:  5,
+		MaxRetries:    3,
+		DialTimeout:   5 * time.Second,
+		ReadTimeout:   3 * time.Second,
+		WriteTimeout:  3 * time.Second,
+	})
+
+	return newRedisCache(rdb)
+}
+
+// NewRedisClusterCache connects to a Redis Cluster through any of its nodes
+func NewRedisClusterCache(addrs []string, password string) *RedisCache {
+	rdb := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:        addrs,
+		Password:     password,
+		PoolSize:     10,
+		MinIdleConns: 5,
+		MaxRetries:   3,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+	})
+
+	return newRedisCache(rdb)
+}
+
+// NewRedisCacheWithClient wraps an existing client without checking the
+// connection, e.g. a mock in tests
+func NewRedisCacheWithClient(client redis.UniversalClient) *RedisCache {
+	return &RedisCache{
+		client: client,
+		ctx:    context.Background(),
+	}
+}
+
+func newRedisCache(client redis.UniversalClient) *RedisCache {
 	ctx := context.Background()
 
-	_, err := rdb.Ping(ctx).Result()
+	_, err := client.Ping(ctx).Result()
 	if err != nil {
 		fmt.Printf("Warning: Redis connection failed: %v\n", err)
 	}
 
 	return &RedisCache{
-		client: rdb,
+		client: client,
 		ctx:    ctx,
 	}
 }
@@ -67,7 +121,7 @@ func (r *RedisCache) Get(key string, dest interface{}) error {
 	val, err := r.client.Get(r.ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return fmt.Errorf("key not found")
+			return ErrNotFound
 		}
 		return fmt.Errorf("failed to get cache key %s: %w", key, err)
 	}
@@ -80,12 +134,55 @@ func (r *RedisCache) Get(key string, dest interface{}) error {
 	return nil
 }
 
+// GetWithSlidingTTL reads key like Get and resets its TTL to slidingTTL in
+// the same transaction, so keys that keep being read never expire while
+// cold keys expire normally
+func (r *RedisCache) GetWithSlidingTTL(key string, dest interface{}, slidingTTL time.Duration) error {
+	val, err := r.getAndExpire(key, slidingTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(val, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal cached value: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisCache) getAndExpire(key string, ttl time.Duration) ([]byte, error) {
+	var get *redis.StringCmd
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(r.ctx, key)
+		pipe.Expire(r.ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get cache key %s: %w", key, err)
+	}
+	return get.Bytes()
+}
+
 func (r *RedisCache) Delete(keys ...string) error {
 	if len(keys) == 0 {
 		return nil
 	}
 
-	err := r.client.Del(r.ctx, keys...).Err()
+	var err error
+	if _, ok := r.client.(*redis.ClusterClient); ok && len(keys) > 1 {
+		// A multi-key DEL fails with CROSSSLOT when keys hash to different
+		// slots, so delete them one by one in a pipeline
+		_, err = r.client.Pipelined(r.ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(r.ctx, key)
+			}
+			return nil
+		})
+	} else {
+		err = r.client.Del(r.ctx, keys...).Err()
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete cache keys: %w", err)
 	}
@@ -112,7 +209,29 @@ func (r *RedisCache) Expire(key string, expiration time.Duration) error {
 }
 
 func (r *RedisCache) Keys(pattern string) ([]string, error) {
-	keys, err := r.client.Keys(r.ctx, pattern).Result()
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		keys, err := r.client.Keys(r.ctx, pattern).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys with pattern %s: %w", pattern, err)
+		}
+
+		return keys, nil
+	}
+
+	// KEYS only searches the node it runs on, so ask every master
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(r.ctx, func(ctx context.Context, master *redis.Client) error {
+		nodeKeys, err := master.Keys(ctx, pattern).Result()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get keys with pattern %s: %w", pattern, err)
 	}
@@ -120,8 +239,103 @@ func (r *RedisCache) Keys(pattern string) ([]string, error) {
 	return keys, nil
 }
 
+// scanBatchSize is the COUNT hint of each SCAN call
+const scanBatchSize = 100
+
+// Scan iterates the keys matching pattern with SCAN, which unlike KEYS
+// doesn't block Redis on a large keyspace. It stops after limit keys;
+// complete reports whether every matching key was visited. Keys written
+// during the scan may be missed or returned twice.
+func (r *RedisCache) Scan(pattern string, limit int) ([]string, bool, error) {
+	var mu sync.Mutex
+	var keys []string
+	complete := true
+
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			batch, next, err := client.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			room := max(limit-len(keys), 0)
+			if len(batch) > room {
+				batch = batch[:room]
+				complete = false
+			}
+			keys = append(keys, batch...)
+			full := len(keys) >= limit
+			if full && next != 0 {
+				complete = false
+			}
+			mu.Unlock()
+
+			if full || next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+
+	var err error
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		// Each master only scans its own slots
+		err = cluster.ForEachMaster(r.ctx, func(ctx context.Context, master *redis.Client) error {
+			return scan(ctx, master)
+		})
+	} else {
+		err = scan(r.ctx, r.client)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to scan keys with pattern %s: %w", pattern, err)
+	}
+	return keys, complete, nil
+}
+
+// StrLen returns the length in bytes of the value at each key, in one
+// pipeline. Missing keys have length 0 and keys that don't hold a string,
+// such as hashes and sorted sets, have length -1.
+func (r *RedisCache) StrLen(keys ...string) ([]int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	cmds := make([]*redis.IntCmd, len(keys))
+	// Pipelined returns the first failed command's error, which may only be
+	// a WRONGTYPE of a single key, so check the commands instead
+	r.client.Pipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.StrLen(r.ctx, key)
+		}
+		return nil
+	})
+
+	lengths := make([]int64, len(keys))
+	for i, cmd := range cmds {
+		n, err := cmd.Result()
+		switch {
+		case err == nil:
+			lengths[i] = n
+		case strings.HasPrefix(err.Error(), "WRONGTYPE"):
+			lengths[i] = -1
+		default:
+			return nil, fmt.Errorf("failed to get length of key %s: %w", keys[i], err)
+		}
+	}
+	return lengths, nil
+}
+
 func (r *RedisCache) FlushAll() error {
-	err := r.client.FlushAll(r.ctx).Err()
+	var err error
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(r.ctx, func(ctx context.Context, master *redis.Client) error {
+			return master.FlushAll(ctx).Err()
+		})
+	} else {
+		err = r.client.FlushAll(r.ctx).Err()
+	}
 	if err != nil {
 		return fmt.Errorf("failed to flush all keys: %w", err)
 	}
@@ -164,7 +378,12 @@ func (r *RedisCache) GetStats() (*CacheStats, error) {
 }
 
 func (r *RedisCache) Ping() error {
-	_, err := r.client.Ping(r.ctx).Result()
+	return r.PingContext(r.ctx)
+}
+
+// PingContext is Ping bounded by ctx
+func (r *RedisCache) PingContext(ctx context.Context) error {
+	_, err := r.client.Ping(ctx).Result()
 	if err != nil {
 		return fmt.Errorf("redis ping failed: %w", err)
 	}
@@ -198,3 +417,172 @@ func (r *RedisCache) TTL(key string) (time.Duration, error) {
 
 	return result.Val(), nil
 }
+
+// GetInt64 reads a counter written by Incr, returning 0 if the key doesn't exist
+func (r *RedisCache) GetInt64(key string) (int64, error) {
+	val, err := r.client.Get(r.ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get counter %s: %w", key, err)
+	}
+
+	return val, nil
+}
+
+// GetDelInt64 atomically reads and removes a counter, returning 0 if the key
+// doesn't exist
+func (r *RedisCache) GetDelInt64(key string) (int64, error) {
+	val, err := r.client.GetDel(r.ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get and delete counter %s: %w", key, err)
+	}
+
+	return val, nil
+}
+
+// PFAdd adds elements to the HyperLogLog stored at key
+func (r *RedisCache) PFAdd(key string, elements ...interface{}) error {
+	err := r.client.PFAdd(r.ctx, key, elements...).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add to hyperloglog %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// PFCount returns the approximate number of distinct elements added to the
+// HyperLogLogs at keys. The standard error is 0.81%.
+func (r *RedisCache) PFCount(keys ...string) (int64, error) {
+	result := r.client.PFCount(r.ctx, keys...)
+	if result.Err() != nil {
+		return 0, fmt.Errorf("failed to count hyperloglog: %w", result.Err())
+	}
+
+	return result.Val(), nil
+}
+
+// HSet sets fields of the hash at key to their JSON-encoded values
+func (r *RedisCache) HSet(key string, values map[string]interface{}) error {
+	fields := make([]interface{}, 0, 2*len(values))
+	for field, value := range values {
+		jsonValue, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal value: %w", err)
+		}
+		fields = append(fields, field, jsonValue)
+	}
+
+	if err := r.client.HSet(r.ctx, key, fields...).Err(); err != nil {
+		return fmt.Errorf("failed to set hash %s: %w", key, err)
+	}
+	return nil
+}
+
+// HGetAll returns the raw fields of the hash at key, or an empty map if it
+// doesn't exist
+func (r *RedisCache) HGetAll(key string) (map[string]string, error) {
+	result := r.client.HGetAll(r.ctx, key)
+	if result.Err() != nil {
+		return nil, fmt.Errorf("failed to get hash %s: %w", key, result.Err())
+	}
+
+	return result.Val(), nil
+}
+
+// ZAdd adds member, JSON-encoded, to the sorted set at key with the given score
+func (r *RedisCache) ZAdd(key string, score float64, member interface{}) error {
+	jsonValue, err := json.Marshal(member)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	err = r.client.ZAdd(r.ctx, key, &redis.Z{Score: score, Member: jsonValue}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add to sorted set %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// ZRangeByScore returns the raw members of the sorted set at key whose score
+// is at most max, lowest score first
+func (r *RedisCache) ZRangeByScore(key string, max float64) ([]string, error) {
+	result := r.client.ZRangeByScore(r.ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatFloat(max, 'f', -1, 64),
+	})
+	if result.Err() != nil {
+		return nil, fmt.Errorf("failed to range sorted set %s: %w", key, result.Err())
+	}
+
+	return result.Val(), nil
+}
+
+// ZRem removes raw members from the sorted set at key and returns how many
+// were present
+func (r *RedisCache) ZRem(key string, members ...interface{}) (int64, error) {
+	result := r.client.ZRem(r.ctx, key, members...)
+	if result.Err() != nil {
+		return 0, fmt.Errorf("failed to remove from sorted set %s: %w", key, result.Err())
+	}
+
+	return result.Val(), nil
+}
+
+// ZIncrBy adds increment to the score of the raw member of the sorted set
+// at key, adding the member first if needed, and returns the new score
+func (r *RedisCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	result := r.client.ZIncrBy(r.ctx, key, increment, member)
+	if result.Err() != nil {
+		return 0, fmt.Errorf("failed to increment sorted set %s: %w", key, result.Err())
+	}
+
+	return result.Val(), nil
+}
+
+// ZRevRangeWithScores returns the raw members of the sorted set at key from
+// rank start to stop, highest score first
+func (r *RedisCache) ZRevRangeWithScores(key string, start, stop int64) ([]ScoredMember, error) {
+	result := r.client.ZRevRangeWithScores(r.ctx, key, start, stop)
+	if result.Err() != nil {
+		return nil, fmt.Errorf("failed to range sorted set %s: %w", key, result.Err())
+	}
+
+	members := make([]ScoredMember, len(result.Val()))
+	for i, z := range result.Val() {
+		members[i] = ScoredMember{Member: fmt.Sprint(z.Member), Score: z.Score}
+	}
+	return members, nil
+}
+
+// RunScript runs a Lua script atomically, loading it into the script cache
+// on first use
+func (r *RedisCache) RunScript(script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	result, err := script.Run(r.ctx, r.client, keys, args...).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to run script on %v: %w", keys, err)
+	}
+
+	return result, nil
+}
+
+// HealthChecker probes Redis for the /health endpoint
+type HealthChecker struct {
+	Cache Cache
+}
+
+func (h HealthChecker) Name() string {
+	return "redis"
+}
+
+func (h HealthChecker) Check(ctx context.Context) error {
+	if h.Cache == nil {
+		return fmt.Errorf("redis not configured")
+	}
+	return h.Cache.PingContext(ctx)
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultXFetchBeta weighs early recomputation as the XFetch paper
+// recommends. Values above 1 favour recomputing earlier.
+const DefaultXFetchBeta = 1.0
+
+// RecomputeEarly reports whether a value that expires in remaining should
+// be recomputed now, given that recomputing takes about delta. It is the
+// XFetch test -delta*beta*ln(random) >= remaining for a random number in
+// (0, 1]: the closer the expiry and the slower the recomputation, the
+// likelier it returns true, so one caller usually refreshes a hot key
+// before it expires instead of every caller missing at once.
+func RecomputeEarly(remaining, delta time.Duration, beta, random float64) bool {
+	if remaining < 0 {
+		// The key has no expiry
+		return false
+	}
+	return -float64(delta)*beta*math.Log(random) >= float64(remaining)
+}
+
+// ShouldRecomputeEarly is RecomputeEarly with a fresh random number
+func ShouldRecomputeEarly(remaining, delta time.Duration, beta float64) bool {
+	return RecomputeEarly(remaining, delta, beta, 1-rand.Float64())
+}
+
+// GetXFetch reads key into dest like Get, recomputing the value with fetch
+// when the key is missing or, by ShouldRecomputeEarly, about to expire.
+// Recomputed values are stored for ttl. If an early recomputation fails the
+// cached value is returned; fetch errors are only returned on a miss, and a
+// failed write is not an error since dest holds the fresh value.
+func (r *RedisCache) GetXFetch(key string, dest interface{}, ttl, delta time.Duration, beta float64, fetch func() (interface{}, error)) error {
+	return r.getXFetch(key, dest, ttl, delta, beta, fetch, json.Marshal, func(data []byte, dest interface{}) error {
+		if err := json.Unmarshal(data, dest); err != nil {
+			return fmt.Errorf("failed to unmarshal cached value: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *RedisCache) getXFetch(key string, dest interface{}, ttl, delta time.Duration, beta float64, fetch func() (interface{}, error),
+	marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) error {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := r.client.Pipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(r.ctx, key)
+		pttl = pipe.PTTL(r.ctx, key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get cache key %s: %w", key, err)
+	}
+
+	refresh := func() error {
+		value, err := fetch()
+		if err != nil {
+			return err
+		}
+		data, err := marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal value: %w", err)
+		}
+		r.client.Set(r.ctx, key, data, ttl)
+		return unmarshal(data, dest)
+	}
+
+	cached, err := get.Bytes()
+	if err == redis.Nil {
+		return refresh()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get cache key %s: %w", key, err)
+	}
+
+	if ShouldRecomputeEarly(pttl.Val(), delta, beta) && refresh() == nil {
+		return nil
+	}
+	return unmarshal(cached, dest)
+}
@@ -0,0 +1,162 @@
+// Package container creates the services shared by the API's packages in
+// dependency order: the logger first, then the cache and the database, which
+// log through it. The packages' handlers are built from these services by
+// the container's methods rather than reading package variables.
+package container
+
+import (
+	"fmt"
+
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/author"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/cors"
+	"github.com/AtillaTahaK/gobooklibrary/dashboard"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/analytics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db/maintenance"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/geo"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/jobs"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/privacy"
+	"github.com/AtillaTahaK/gobooklibrary/report"
+	"github.com/AtillaTahaK/gobooklibrary/search"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
+	"gorm.io/gorm"
+)
+
+// Config supplies dependencies to New. Nil fields are created from the
+// environment, so tests can pass mocks for any of them.
+type Config struct {
+	Logger  *logger.Logger
+	Cache   cache.Cache
+	DB      *gorm.DB
+	Metrics *metrics.MetricsCollector
+}
+
+// Container holds the shared services
+type Container struct {
+	Log     *logger.Logger
+	Cache   cache.Cache
+	DB      *gorm.DB
+	Metrics *metrics.MetricsCollector
+}
+
+// New creates the services missing from cfg. It returns database errors
+// instead of exiting.
+func New(cfg Config) (*Container, error) {
+	c := &Container{
+		Log:     cfg.Logger,
+		Cache:   cfg.Cache,
+		DB:      cfg.DB,
+		Metrics: cfg.Metrics,
+	}
+
+	if c.Log == nil {
+		c.Log = logger.NewLogger()
+	}
+	if c.Cache == nil {
+		c.Cache = cache.NewCacheFromEnv()
+	}
+	if c.DB == nil {
+		conn, err := db.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		c.DB = conn
+	}
+	if c.Metrics == nil {
+		c.Metrics = metrics.NewMetricsCollector()
+	}
+
+	return c, nil
+}
+
+// BookHandler returns the book handlers and jobs, backed by the database
+// and the container's cache, logger and metrics. Book changes are sent to
+// webhooks and the activity feed.
+func (c *Container) BookHandler() *book.BookHandler {
+	h := book.NewBookHandler(book.NewDBStore(c.DB, c.Log), c.Cache, c.Log, c.Metrics)
+	h.Webhooks = c.WebhookHandler()
+	h.Activity = c.ActivityHandler()
+	return h
+}
+
+// BookService returns the book write rules shared by the HTTP and gRPC
+// APIs, backed by the database and the container's logger
+func (c *Container) BookService() *book.Service {
+	return book.NewService(book.NewDBStore(c.DB, c.Log), c.Log)
+}
+
+// AuthHandler returns the user and session handlers, backed by the database
+// and the container's cache, logger and metrics. User changes are sent to
+// webhooks.
+func (c *Container) AuthHandler() *auth.Handler {
+	h := auth.NewHandler(auth.NewDBStore(c.DB, c.Log), c.Cache, c.Log, c.Metrics)
+	h.Webhooks = c.WebhookHandler()
+	return h
+}
+
+// WebhookHandler returns the webhook endpoints and delivery workers
+func (c *Container) WebhookHandler() *webhook.Handler {
+	return webhook.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// ActivityHandler returns the activity feed endpoints
+func (c *Container) ActivityHandler() *activity.Handler {
+	return activity.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// AuthorHandler returns the author endpoints
+func (c *Container) AuthorHandler() *author.Handler {
+	return author.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// SearchHandler returns the search and suggestion endpoints
+func (c *Container) SearchHandler() *search.Handler {
+	return search.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// ReportHandler returns the report endpoints and scheduler
+func (c *Container) ReportHandler() *report.Handler {
+	return report.NewHandler(c.DB, c.Log)
+}
+
+// DashboardHandler returns the admin dashboard endpoint
+func (c *Container) DashboardHandler() *dashboard.Handler {
+	return dashboard.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// PrivacyHandler returns the personal data export endpoints
+func (c *Container) PrivacyHandler() *privacy.Handler {
+	return privacy.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// CORSHandler returns the CORS origin endpoints and the origin loader for
+// middleware.DynamicCORS
+func (c *Container) CORSHandler() *cors.Handler {
+	return cors.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// MaintenanceHandler returns the ANALYZE and VACUUM endpoints
+func (c *Container) MaintenanceHandler() *maintenance.Handler {
+	return maintenance.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// AnalyticsHandler returns the trending books endpoint and updater
+func (c *Container) AnalyticsHandler() *analytics.Handler {
+	return analytics.NewHandler(c.DB, c.Cache, c.Log)
+}
+
+// GeoHandler returns the country analytics recorder and endpoint
+func (c *Container) GeoHandler() *geo.Handler {
+	return geo.NewHandler(c.Cache, c.Log)
+}
+
+// JobRunner returns the bulk repair jobs
+func (c *Container) JobRunner() *jobs.Runner {
+	return jobs.NewRunner(c.DB, c.Cache, c.Log)
+}
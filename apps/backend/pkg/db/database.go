@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 
@@ -9,29 +11,41 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
-
-func ConnectDB() {
-	var err error
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=localhost user=postgres password=postgres dbname=booklibrary port=5432 sslmode=disable"
+// DSN returns DATABASE_URL, or a local development database when it is unset
+func DSN() string {
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn
 	}
+	return "host=localhost user=postgres password=postgres dbname=booklibrary port=5432 sslmode=disable"
+}
 
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+// Open connects to DATABASE_URL and configures the connection pool
+func Open() (*gorm.DB, error) {
+	conn, err := gorm.Open(postgres.Open(DSN()), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
-
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return nil, err
 	}
 
-	log.Println("Connected to PostgreSQL database")
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database handle: %w", err)
+	}
+	ConfigurePool(sqlDB, PoolConfigFromEnv())
+	return conn, nil
 }
 
-func AutoMigrate(models ...interface{}) {
-	if err := DB.AutoMigrate(models...); err != nil {
+func AutoMigrate(conn *gorm.DB, models ...interface{}) {
+	if err := conn.AutoMigrate(models...); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 	log.Println("Database migration completed")
 }
+
+// WithTransaction runs fn in a transaction on conn. The transaction is committed if fn
+// returns nil and rolled back if it returns an error or panics. The
+// transaction is bound to ctx, so cancelling ctx aborts it.
+func WithTransaction(ctx context.Context, conn *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return conn.WithContext(ctx).Transaction(fn)
+}
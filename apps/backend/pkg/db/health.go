@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// HealthChecker probes DB for the /health endpoint
+type HealthChecker struct {
+	DB *gorm.DB
+}
+
+func (HealthChecker) Name() string {
+	return "database"
+}
+
+func (h HealthChecker) Check(ctx context.Context) error {
+	if h.DB == nil {
+		return errors.New("database not connected")
+	}
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
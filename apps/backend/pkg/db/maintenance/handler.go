@@ -0,0 +1,80 @@
+package maintenance
+
+import (
+	"strconv"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ConfirmFullVacuumHeader must be "true" for VACUUM FULL, which locks the
+// table for the whole rewrite
+const ConfirmFullVacuumHeader = "X-Confirm-Vacuum-Full"
+
+// Analyze godoc
+// @Summary      Refresh planner statistics (admin only)
+// @Description  Runs ANALYZE on books and users in the background. Poll the returned job for its status.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      202  {object} Job
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/db/analyze [post]
+func (h *Handler) Analyze(c *fiber.Ctx) error {
+	job := h.Start(c.UserContext(), "analyze", AnalyzeSQL(AnalyzedTables...))
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// Vacuum godoc
+// @Summary      Vacuum the books table (admin only)
+// @Description  Runs VACUUM ANALYZE books in the background. full=true runs VACUUM FULL, which locks the table until done, and must be confirmed with the X-Confirm-Vacuum-Full: true header.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Param        full query bool false "Rewrite the table with VACUUM FULL" default(false)
+// @Param        X-Confirm-Vacuum-Full header string false "Must be true when full=true"
+// @Success      202  {object} Job
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      428  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/db/vacuum [post]
+func (h *Handler) Vacuum(c *fiber.Ctx) error {
+	full := false
+	if raw := c.Query("full"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return apierrors.ErrInvalidQuery.WithMessage("full must be true or false")
+		}
+		full = parsed
+	}
+	if full && c.Get(ConfirmFullVacuumHeader) != "true" {
+		return apierrors.ErrConfirmationRequired.WithMessage("VACUUM FULL locks the table; send " + ConfirmFullVacuumHeader + ": true to confirm")
+	}
+
+	job := h.Start(c.UserContext(), "vacuum", VacuumSQL(VacuumedTable, full))
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetJob godoc
+// @Summary      Get a database maintenance job (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Param        id path string true "Job ID"
+// @Success      200  {object} Job
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/db/jobs/{id} [get]
+func (h *Handler) GetJob(c *fiber.Ctx) error {
+	job, err := h.Get(c.Params("id"))
+	if err != nil {
+		return apierrors.ErrJobNotFound
+	}
+	return c.JSON(job)
+}
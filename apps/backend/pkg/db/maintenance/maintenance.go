@@ -0,0 +1,151 @@
+// Package maintenance runs ANALYZE and VACUUM on demand, for example after a
+// bulk import or cleanup leaves the planner's statistics stale. Jobs run in
+// the background and their status is kept in the cache for polling.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Handler runs maintenance jobs and serves their endpoints, keeping job
+// statuses in the cache
+type Handler struct {
+	// Exec runs a maintenance statement. VACUUM can't run inside a
+	// transaction, so statements go straight to the connection pool.
+	Exec  func(ctx context.Context, sql string) error
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler running statements on conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	exec := func(ctx context.Context, sql string) error {
+		return conn.WithContext(ctx).Exec(sql).Error
+	}
+	return &Handler{Exec: exec, cache: c, log: log}
+}
+
+// Job statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// jobTTL is how long a job's status can be polled after it was last updated
+const jobTTL = 24 * time.Hour
+
+// AnalyzedTables are refreshed by POST /admin/db/analyze
+var AnalyzedTables = []string{"books", "users"}
+
+// VacuumedTable is vacuumed by POST /admin/db/vacuum
+const VacuumedTable = "books"
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a maintenance statement running in the background
+type Job struct {
+	ID         string     `json:"id" example:"7f9c2b1e-8d4a-4c5e-9b0a-3e2f1d6c8a7b"`
+	Type       string     `json:"type" example:"vacuum"`
+	SQL        string     `json:"sql" example:"VACUUM ANALYZE books"`
+	Status     string     `json:"status" example:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// AnalyzeSQL refreshes planner statistics for tables
+func AnalyzeSQL(tables ...string) string {
+	return "ANALYZE " + strings.Join(tables, ", ")
+}
+
+// VacuumSQL reclaims dead rows in table and refreshes its statistics. FULL
+// rewrites the table and holds an exclusive lock on it until done.
+func VacuumSQL(table string, full bool) string {
+	if full {
+		return "VACUUM FULL ANALYZE " + table
+	}
+	return "VACUUM ANALYZE " + table
+}
+
+// Start runs sql in the background and returns its job, which is recorded as
+// running until the statement finishes. ctx only carries values such as the
+// trace; the job isn't cancelled with it.
+func (h *Handler) Start(ctx context.Context, jobType, sql string) *Job {
+	job := &Job{
+		ID:        uuid.NewString(),
+		Type:      jobType,
+		SQL:       sql,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	h.save(job)
+
+	ctx = context.WithoutCancel(ctx)
+	go func(job Job) {
+		err := h.Exec(ctx, job.SQL)
+
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		job.Status = StatusSucceeded
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		}
+		h.save(&job)
+
+		if h.log != nil {
+			fields := map[string]interface{}{
+				"job_id":   job.ID,
+				"sql":      job.SQL,
+				"status":   job.Status,
+				"duration": finished.Sub(job.StartedAt).String(),
+			}
+			if err != nil {
+				fields["error"] = err.Error()
+				h.log.Error("Database maintenance failed", fields)
+			} else {
+				h.log.Info("Database maintenance finished", fields)
+			}
+		}
+	}(*job)
+
+	return job
+}
+
+// Get returns the job with id, or ErrJobNotFound once it has expired
+func (h *Handler) Get(id string) (*Job, error) {
+	if h.cache == nil {
+		return nil, ErrJobNotFound
+	}
+	var job Job
+	if err := h.cache.Get(jobKey(id), &job); err != nil {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+func (h *Handler) save(job *Job) {
+	if h.cache == nil {
+		return
+	}
+	if err := h.cache.Set(jobKey(job.ID), job, jobTTL); err != nil && h.log != nil {
+		h.log.LogError(err, map[string]interface{}{
+			"operation": "save_maintenance_job",
+			"job_id":    job.ID,
+		})
+	}
+}
+
+func jobKey(id string) string {
+	return fmt.Sprintf("admin:job:%s", id)
+}
@@ -0,0 +1,13 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// The users and books tables are created by db.AutoMigrate from the model
+// structs. This entry marks that baseline so numbered migrations start after it.
+func init() {
+	register(Migration{
+		ID:          "001_initial_schema",
+		Description: "baseline schema managed by AutoMigrate",
+		Up:          func(db *gorm.DB) error { return nil },
+	})
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Books used to carry the author only as free text. This backfills the
+// authors table (created by AutoMigrate from author.Author) with one row per
+// distinct, trimmed book author and points each book at it. New books are
+// linked by Book.BeforeCreate. author_id stays nullable so books whose author
+// can't be matched keep working.
+func init() {
+	register(Migration{
+		ID:          "003_populate_authors",
+		Description: "create authors from distinct book authors and link books",
+		Up: func(db *gorm.DB) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				steps := []string{
+					`INSERT INTO authors (name, created_at, updated_at)
+					 SELECT DISTINCT TRIM(author), NOW(), NOW() FROM books
+					 WHERE TRIM(author) <> ''
+					 ON CONFLICT (name) DO NOTHING`,
+					`UPDATE books SET author_id = authors.id
+					 FROM authors
+					 WHERE authors.name = TRIM(books.author) AND books.author_id IS NULL`,
+					`DO $$ BEGIN
+					   IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_books_author') THEN
+					     ALTER TABLE books ADD CONSTRAINT fk_books_author
+					       FOREIGN KEY (author_id) REFERENCES authors (id) ON DELETE SET NULL;
+					   END IF;
+					 END $$`,
+				}
+				for _, stmt := range steps {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	})
+}
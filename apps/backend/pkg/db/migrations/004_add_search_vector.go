@@ -0,0 +1,21 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// search_vector holds the full-text search document of a book, built from its
+// title and author. The column is nullable and left empty here: filling it
+// rewrites every row, so existing books are indexed in batches by
+// POST /admin/books/reindex instead of inside the migration. The GIN index is
+// built CONCURRENTLY for the same reason as in 002.
+func init() {
+	register(Migration{
+		ID:          "004_add_search_vector",
+		Description: "add books.search_vector with a GIN index",
+		Up: func(db *gorm.DB) error {
+			if err := db.Exec("ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector").Error; err != nil {
+				return err
+			}
+			return db.Exec("CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector)").Error
+		},
+	})
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// search_vector_updated_at is the updated_at of the row the search vector was
+// built from, so a book edited since it was indexed has
+// search_vector_updated_at < updated_at. Copying updated_at instead of
+// using NOW() keeps the comparison free of clock differences between the
+// API and the database. Books indexed before this migration have NULL and are
+// rebuilt once by the search index sync. The partial index lets the sync find
+// stale books without scanning the table.
+func init() {
+	register(Migration{
+		ID:          "005_add_search_vector_updated_at",
+		Description: "add books.search_vector_updated_at with a partial index on stale vectors",
+		Up: func(db *gorm.DB) error {
+			if err := db.Exec("ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector_updated_at timestamptz").Error; err != nil {
+				return err
+			}
+			return db.Exec(`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_books_search_vector_stale ON books (id)
+				WHERE search_vector IS NULL OR search_vector_updated_at IS NULL OR search_vector_updated_at < updated_at`).Error
+		},
+	})
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Annotation searches match book.AnnotationSearchSQL, the passage and note of
+// an annotation, against the query. The expression index must repeat that
+// expression exactly for the planner to use it. Unlike books there is no
+// stored search vector: annotations are short and written once, so building
+// the document at insert time through the index is cheap. Built
+// CONCURRENTLY for the same reason as in 002.
+func init() {
+	register(Migration{
+		ID:          "006_add_annotation_search_index",
+		Description: "add a GIN full-text index on annotations (passage_text, note)",
+		Up: func(db *gorm.DB) error {
+			return db.Exec("CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_annotations_search ON annotations USING GIN (to_tsvector('english', passage_text || ' ' || note))").Error
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Genres used to be free text, so "Sci-Fi" and "sci-fi" were different
+// genres. This backfills the genres table (created by AutoMigrate from
+// book.Genre) with one row per distinct genre slug, named after the first
+// spelling alphabetically, and points each book at it, renaming the book's
+// genre to match. The slug expression must match book.GenreSlug. New books
+// are linked by Book.BeforeCreate.
+func init() {
+	register(Migration{
+		ID:          "007_populate_genres",
+		Description: "create genres from distinct book genres and link books",
+		Up: func(db *gorm.DB) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				slug := "TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(books.genre), '[^[:alnum:]]+', '-', 'g'))"
+				steps := []string{
+					`INSERT INTO genres (name, slug, description, created_at, updated_at)
+					 SELECT DISTINCT ON (slug) name, slug, '', NOW(), NOW()
+					 FROM (SELECT TRIM(books.genre) AS name, ` + slug + ` AS slug FROM books) AS named
+					 WHERE slug <> ''
+					 ORDER BY slug, name
+					 ON CONFLICT DO NOTHING`,
+					`UPDATE books SET genre_id = genres.id, genre = genres.name
+					 FROM genres
+					 WHERE genres.slug = ` + slug + ` AND books.genre_id IS NULL`,
+					`DO $$ BEGIN
+					   IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_books_genre') THEN
+					     ALTER TABLE books ADD CONSTRAINT fk_books_genre
+					       FOREIGN KEY (genre_id) REFERENCES genres (id) ON DELETE SET NULL;
+					   END IF;
+					 END $$`,
+				}
+				for _, stmt := range steps {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	})
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// pg_trgm provides similarity(), which dedup.DuplicateDetector uses to
+// compare the title of a new book with the catalog. Creating the extension
+// needs the CREATE privilege on the database.
+func init() {
+	register(Migration{
+		ID:          "008_add_pg_trgm",
+		Description: "enable the pg_trgm extension for title similarity",
+		Up: func(db *gorm.DB) error {
+			return db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+		},
+	})
+}
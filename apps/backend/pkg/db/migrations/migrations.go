@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a single schema change applied after db.AutoMigrate. Use
+// migrations for changes GORM tags can't express, such as partial or
+// concurrently built indexes.
+type Migration struct {
+	ID          string
+	Description string
+	Up          func(db *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	ID        string    `gorm:"primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+var registry []Migration
+
+func register(m Migration) {
+	registry = append(registry, m)
+}
+
+// All returns the registered migrations ordered by ID
+func All() []Migration {
+	all := make([]Migration, len(registry))
+	copy(all, registry)
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// Run applies every migration that hasn't been recorded in schema_migrations.
+// Migrations are not wrapped in a transaction because statements such as
+// CREATE INDEX CONCURRENTLY can't run inside one; each Up must be safe to
+// re-run if the process dies before the migration is recorded.
+func Run(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var applied []SchemaMigration
+	if err := db.Find(&applied).Error; err != nil {
+		return fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	done := make(map[string]bool, len(applied))
+	for _, m := range applied {
+		done[m.ID] = true
+	}
+
+	for _, m := range All() {
+		if done[m.ID] {
+			continue
+		}
+
+		log.Printf("Applying migration %s: %s", m.ID, m.Description)
+		if err := m.Up(db); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+
+		if err := db.Create(&SchemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error; err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", m.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// NotifyChannel is the PostgreSQL channel book changes are announced on
+const NotifyChannel = "book_changes"
+
+// Notify announces payload on NotifyChannel. Inside a transaction the
+// notification is only delivered if it commits.
+func Notify(tx *gorm.DB, payload string) error {
+	return tx.Exec("SELECT pg_notify(?, ?)", NotifyChannel, payload).Error
+}
+
+// StartNotifyListener calls handler with the payload of every notification
+// on NotifyChannel until ctx is done, including the ones this instance
+// sent. It listens on a dedicated connection outside the pool and reconnects
+// with ReconnectBackoff when the connection drops, warning log; notifications
+// sent while it is disconnected are lost.
+func StartNotifyListener(ctx context.Context, log *logger.Logger, handler func(payload string)) {
+	go func() {
+		attempt := 0
+		for {
+			subscribed, err := listen(ctx, handler)
+			if ctx.Err() != nil {
+				return
+			}
+			if subscribed {
+				attempt = 0
+			}
+
+			wait := ReconnectBackoff[len(ReconnectBackoff)-1]
+			if attempt < len(ReconnectBackoff) {
+				wait = ReconnectBackoff[attempt]
+			}
+			attempt++
+			logWarn(log, "Notification listener disconnected", map[string]interface{}{
+				"channel":  NotifyChannel,
+				"error":    err.Error(),
+				"retry_in": wait.String(),
+			})
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// listen connects, subscribes and hands notifications to handler until the
+// connection fails or ctx is done. It reports whether it got as far as
+// subscribing.
+func listen(ctx context.Context, handler func(payload string)) (subscribed bool, err error) {
+	conn, err := pgx.Connect(ctx, DSN())
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{NotifyChannel}.Sanitize()); err != nil {
+		return false, err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		handler(notification.Payload)
+	}
+}
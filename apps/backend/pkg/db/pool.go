@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+// PoolConfig bounds the database connection pool. Without a limit on open
+// connections a burst of requests opens connections until PostgreSQL
+// refuses them.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// PoolConfigFromEnv reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME_MINUTES and DB_CONN_MAX_IDLE_TIME_MINUTES, using the
+// defaults for unset or invalid values
+func PoolConfigFromEnv() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS", 5),
+		ConnMaxLifetime: time.Duration(envInt("DB_CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute,
+		ConnMaxIdleTime: time.Duration(envInt("DB_CONN_MAX_IDLE_TIME_MINUTES", 10)) * time.Minute,
+	}
+}
+
+func envInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// ConfigurePool applies config to sqlDB
+func ConfigurePool(sqlDB *sql.DB, config PoolConfig) {
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
+
+// StartPoolMonitor publishes the pool statistics of conn to Prometheus every
+// interval until ctx is done, and warns when queries had to wait for a
+// connection, which means MaxOpenConns is too low for the load. Warnings go
+// to the standard logger when log is nil.
+func StartPoolMonitor(ctx context.Context, conn *gorm.DB, log *logger.Logger, interval time.Duration) {
+	if conn == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		var lastWaitCount int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Look the pool up each time as the health poller may replace it
+				sqlDB, err := conn.DB()
+				if err != nil {
+					continue
+				}
+				stats := sqlDB.Stats()
+				metrics.SetDBPoolStats(stats)
+
+				// WaitCount is cumulative, so only warn about new waits
+				if stats.WaitCount > lastWaitCount {
+					warnPoolWaits(log, stats, stats.WaitCount-lastWaitCount)
+				}
+				lastWaitCount = stats.WaitCount
+			}
+		}
+	}()
+}
+
+func warnPoolWaits(log *logger.Logger, stats sql.DBStats, newWaits int64) {
+	fields := map[string]interface{}{
+		"new_waits":        newWaits,
+		"wait_count":       stats.WaitCount,
+		"wait_duration_ms": stats.WaitDuration.Milliseconds(),
+		"in_use":           stats.InUse,
+		"max_open":         stats.MaxOpenConnections,
+	}
+	logWarn(log, "Queries waited for a database connection", fields)
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+// ReconnectBackoff is the wait after each failed reconnect attempt. The last
+// value repeats until the database is back.
+var ReconnectBackoff = []time.Duration{time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second}
+
+// ReconnectThreshold is the number of consecutive failed pings after which
+// the health poller reconnects
+const ReconnectThreshold = 3
+
+var healthy atomic.Bool
+
+func init() {
+	healthy.Store(true)
+}
+
+// IsHealthy reports whether the last health poll reached the database
+func IsHealthy() bool {
+	return healthy.Load()
+}
+
+// ConnectWithRetry calls connect until it succeeds or ctx is done, warning
+// log about each failure
+func ConnectWithRetry(ctx context.Context, log *logger.Logger, connect func() (*gorm.DB, error)) (*gorm.DB, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := connect()
+		metrics.RecordDBReconnectAttempt(err == nil)
+		if err == nil {
+			return conn, nil
+		}
+
+		wait := ReconnectBackoff[len(ReconnectBackoff)-1]
+		if attempt < len(ReconnectBackoff) {
+			wait = ReconnectBackoff[attempt]
+		}
+		logWarn(log, "Database reconnect failed", map[string]interface{}{
+			"attempt":  attempt + 1,
+			"error":    err.Error(),
+			"retry_in": wait.String(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// HealthPoller pings the database and reconnects after Threshold
+// consecutive failures. Poll must not be called concurrently.
+type HealthPoller struct {
+	Ping      func(ctx context.Context) error
+	Reconnect func(ctx context.Context)
+	Threshold int
+	// Log receives failed pings. When nil they go to the standard logger.
+	Log *logger.Logger
+
+	failures     int
+	reconnecting atomic.Bool
+}
+
+// Poll pings once, updates IsHealthy and starts a reconnect in the
+// background when the threshold is reached and none is running. The
+// reconnect runs until it succeeds or ctx is done.
+func (p *HealthPoller) Poll(ctx context.Context) error {
+	err := p.Ping(ctx)
+	if err == nil {
+		if !healthy.Swap(true) {
+			logWarn(p.Log, "Database connection restored", nil)
+		}
+		p.failures = 0
+		return nil
+	}
+
+	healthy.Store(false)
+	p.failures++
+	logWarn(p.Log, "Database ping failed", map[string]interface{}{
+		"consecutive_failures": p.failures,
+		"error":                err.Error(),
+	})
+
+	if p.failures >= p.Threshold && p.reconnecting.CompareAndSwap(false, true) {
+		p.failures = 0
+		go func() {
+			defer p.reconnecting.Store(false)
+			p.Reconnect(ctx)
+		}()
+	}
+	return err
+}
+
+// StartHealthPoller pings conn every interval until ctx is done and
+// reconnects it after ReconnectThreshold consecutive failures
+func StartHealthPoller(ctx context.Context, conn *gorm.DB, log *logger.Logger, interval time.Duration) {
+	if conn == nil {
+		return
+	}
+	poller := &HealthPoller{
+		Ping: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, interval/2)
+			defer cancel()
+			return HealthChecker{DB: conn}.Check(ctx)
+		},
+		Reconnect: func(ctx context.Context) { reconnect(ctx, conn, log) },
+		Threshold: ReconnectThreshold,
+		Log:       log,
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				poller.Poll(ctx)
+			}
+		}
+	}()
+}
+
+// reconnect opens a new connection and swaps its pool into conn. The pool
+// is replaced in place, so stores holding conn use the new connection too.
+func reconnect(ctx context.Context, conn *gorm.DB, log *logger.Logger) {
+	fresh, err := ConnectWithRetry(ctx, log, Open)
+	if err != nil {
+		return
+	}
+
+	old, _ := conn.DB()
+	conn.Config.ConnPool = fresh.Config.ConnPool
+	conn.Statement.ConnPool = fresh.Statement.ConnPool
+	if old != nil {
+		old.Close()
+	}
+	logWarn(log, "Reconnected to the database", nil)
+}
+
+// logWarn sends a warning to logger, or to the standard logger when it is nil
+func logWarn(logger *logger.Logger, message string, fields map[string]interface{}) {
+	if logger != nil {
+		logger.Warn(message, fields)
+		return
+	}
+	log.Printf("WARN: %s: %v", message, fields)
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes of transactions aborted because of concurrent
+// transactions; running them again usually succeeds
+const (
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+// DefaultRetryAttempts is the number of attempts RetryOnDeadlock is given
+// for book writes
+const DefaultRetryAttempts = 3
+
+// IsRetryable reports whether err is a deadlock or serialization failure
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == codeDeadlockDetected || pgErr.Code == codeSerializationFailure
+}
+
+// RetryOnDeadlock runs fn up to maxAttempts times while it fails with a
+// deadlock or serialization failure, waiting 10-100ms between attempts so
+// the conflicting transactions don't collide again. fn must run its own
+// transaction: one that PostgreSQL aborted can't be continued.
+func RetryOnDeadlock(fn func() error, maxAttempts int) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !IsRetryable(err) {
+			return err
+		}
+		metrics.RecordError("deadlock", "database")
+		time.Sleep(10*time.Millisecond + time.Duration(rand.Int63n(int64(90*time.Millisecond))))
+	}
+}
@@ -0,0 +1,70 @@
+// Package dedup finds books that are likely already in the catalog under a
+// slightly different title, using the trigram similarity of pg_trgm
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// DefaultSimilarityThreshold is the title similarity above which books are
+// reported as potential duplicates
+const DefaultSimilarityThreshold = 0.7
+
+// maxCandidates is the number of potential duplicates reported at most
+const maxCandidates = 3
+
+// Candidate is a book whose title is similar to the one being added
+type Candidate struct {
+	ID     uint   `json:"id" example:"12"`
+	Title  string `json:"title" example:"The Hobbit"`
+	Author string `json:"author" example:"J.R.R. Tolkien"`
+	// Similarity is the trigram similarity of the titles, from 0 to 1
+	Similarity float64 `json:"similarity" example:"0.83"`
+}
+
+// Details are the details of a POTENTIAL_DUPLICATE error
+type Details struct {
+	Candidates []Candidate `json:"candidates"`
+}
+
+// ThresholdFromEnv reads DEDUP_SIMILARITY_THRESHOLD, a number above 0 and at
+// most 1
+func ThresholdFromEnv() (float64, error) {
+	raw := os.Getenv("DEDUP_SIMILARITY_THRESHOLD")
+	if raw == "" {
+		return DefaultSimilarityThreshold, nil
+	}
+	threshold, err := strconv.ParseFloat(raw, 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		return DefaultSimilarityThreshold, fmt.Errorf("DEDUP_SIMILARITY_THRESHOLD must be a number above 0 and at most 1, got %q", raw)
+	}
+	return threshold, nil
+}
+
+// DuplicateDetector looks up books with titles similar to a new one
+type DuplicateDetector struct {
+	Threshold float64
+}
+
+// NewDuplicateDetector creates a detector reporting titles more similar than
+// threshold
+func NewDuplicateDetector(threshold float64) *DuplicateDetector {
+	return &DuplicateDetector{Threshold: threshold}
+}
+
+// FindDuplicates returns up to 3 books in conn whose titles are more similar
+// to title than the threshold, most similar first. Deleted books are ignored.
+func (d *DuplicateDetector) FindDuplicates(ctx context.Context, conn *gorm.DB, title string) ([]Candidate, error) {
+	candidates := []Candidate{}
+	err := conn.WithContext(ctx).Raw(`SELECT id, title, author, similarity(title, ?) AS similarity
+		FROM books
+		WHERE deleted_at IS NULL AND similarity(title, ?) > ?
+		ORDER BY similarity DESC
+		LIMIT ?`, title, title, d.Threshold, maxCandidates).Scan(&candidates).Error
+	return candidates, err
+}
@@ -0,0 +1,221 @@
+// Package errors defines the API error responses. Every error body has the
+// form {"error": message, "code": CODE, "details": ...}, except rate limited
+// ones (see RateLimitedBody); clients should switch on code, which is stable,
+// rather than on the message.
+package errors
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIError is an error returned to API clients
+type APIError struct {
+	Code       string      `json:"code"`
+	Message    string      `json:"error"`
+	Details    interface{} `json:"details,omitempty"`
+	HTTPStatus int         `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// WithMessage returns a copy of e with a more specific message
+func (e *APIError) WithMessage(message string) *APIError {
+	clone := *e
+	clone.Message = message
+	return &clone
+}
+
+// WithDetails returns a copy of e carrying extra data for the client
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+// RateLimitedBody is the body of a 429 from the rate limiter. Its fields are
+// flat rather than under details, with error set to rate_limit_exceeded and
+// the text in message; code is RATE_LIMITED as for other errors.
+// RetryAfterSeconds matches the Retry-After header.
+type RateLimitedBody struct {
+	Code              string `json:"code" example:"RATE_LIMITED"`
+	Error             string `json:"error" example:"rate_limit_exceeded"`
+	Message           string `json:"message" example:"You have exceeded 100 requests per 60 seconds"`
+	RetryAfterSeconds int    `json:"retry_after_seconds" example:"43"`
+	Limit             int    `json:"limit" example:"100"`
+	WindowSeconds     int    `json:"window_seconds" example:"60"`
+	// Identifier is who the limit applies to: "user:<id>" for requests with
+	// a token, otherwise the client IP
+	Identifier string `json:"identifier" example:"192.168.1.1"`
+}
+
+// VersionConflictBody is the body of a 409 for an update based on an old
+// version of a book. Like RateLimitedBody its fields are flat, with error set
+// to conflict; code is BOOK_VERSION_CONFLICT.
+type VersionConflictBody struct {
+	Code           string `json:"code" example:"BOOK_VERSION_CONFLICT"`
+	Error          string `json:"error" example:"conflict"`
+	Message        string `json:"message" example:"Book was modified by another request, please refresh and retry"`
+	CurrentVersion int    `json:"current_version" example:"4"`
+}
+
+// FieldError describes why a single request field was rejected. Path
+// locates the field in nested bodies, e.g. "author.name" or "entries[1].sequence";
+// for top-level fields it equals Field. Message doesn't repeat the path,
+// e.g. "must be between 1450 and 2027".
+type FieldError struct {
+	Field   string `json:"field"`
+	Path    string `json:"path"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorBody is the body of a 400 for invalid request fields, which
+// are listed under validation_errors rather than details
+type ValidationErrorBody struct {
+	Code             string       `json:"code" example:"VALIDATION_FAILED"`
+	Message          string       `json:"error" example:"Validation failed"`
+	ValidationErrors []FieldError `json:"validation_errors"`
+}
+
+// NewValidationError reports one or more invalid request fields. Respond
+// sends it as a ValidationErrorBody.
+func NewValidationError(fields ...FieldError) *APIError {
+	for i := range fields {
+		if fields[i].Path == "" {
+			fields[i].Path = fields[i].Field
+		}
+	}
+	return ErrValidation.WithDetails(fields)
+}
+
+var registry = map[string]*APIError{}
+
+func define(code string, status int, message string) *APIError {
+	if _, exists := registry[code]; exists {
+		panic("duplicate API error code " + code)
+	}
+	err := &APIError{Code: code, Message: message, HTTPStatus: status}
+	registry[code] = err
+	return err
+}
+
+var (
+	ErrInvalidRequestBody = define("INVALID_REQUEST_BODY", fiber.StatusBadRequest, "Invalid request body")
+	ErrInvalidID          = define("INVALID_ID", fiber.StatusBadRequest, "Invalid ID")
+	ErrInvalidQuery       = define("INVALID_QUERY", fiber.StatusBadRequest, "Invalid query parameter")
+	ErrValidation         = define("VALIDATION_FAILED", fiber.StatusBadRequest, "Validation failed")
+
+	ErrUnauthorized       = define("UNAUTHORIZED", fiber.StatusUnauthorized, "Authentication required")
+	ErrInvalidToken       = define("INVALID_TOKEN", fiber.StatusUnauthorized, "Invalid or expired token")
+	ErrInvalidCredentials = define("INVALID_CREDENTIALS", fiber.StatusUnauthorized, "Invalid credentials")
+	ErrForbidden          = define("FORBIDDEN", fiber.StatusForbidden, "Forbidden")
+	ErrNotAcceptable      = define("NOT_ACCEPTABLE", fiber.StatusNotAcceptable, "Requested content type is not available")
+
+	ErrBookNotFound            = define("BOOK_NOT_FOUND", fiber.StatusNotFound, "Book not found")
+	ErrUserNotFound            = define("USER_NOT_FOUND", fiber.StatusNotFound, "User not found")
+	ErrAuthorNotFound          = define("AUTHOR_NOT_FOUND", fiber.StatusNotFound, "Author not found")
+	ErrSeriesNotFound          = define("SERIES_NOT_FOUND", fiber.StatusNotFound, "Series not found")
+	ErrBookmarkNotFound        = define("BOOKMARK_NOT_FOUND", fiber.StatusNotFound, "Bookmark not found")
+	ErrSearchHistoryNotFound   = define("SEARCH_HISTORY_NOT_FOUND", fiber.StatusNotFound, "Search history entry not found")
+	ErrWebhookNotFound         = define("WEBHOOK_NOT_FOUND", fiber.StatusNotFound, "Webhook not found")
+	ErrCleanupScheduleNotFound = define("CLEANUP_SCHEDULE_NOT_FOUND", fiber.StatusNotFound, "No cleanup schedule configured")
+	ErrBookMetadataNotFound    = define("BOOK_METADATA_NOT_FOUND", fiber.StatusNotFound, "No book found for this ISBN")
+	ErrJobNotFound             = define("JOB_NOT_FOUND", fiber.StatusNotFound, "Job not found")
+	ErrSessionNotFound         = define("SESSION_NOT_FOUND", fiber.StatusNotFound, "Session not found")
+	ErrLoanNotFound            = define("LOAN_NOT_FOUND", fiber.StatusNotFound, "Loan not found")
+	ErrAnnotationNotFound      = define("ANNOTATION_NOT_FOUND", fiber.StatusNotFound, "Annotation not found")
+	ErrScheduledReportNotFound = define("SCHEDULED_REPORT_NOT_FOUND", fiber.StatusNotFound, "Scheduled report not found")
+	ErrRouteNotFound           = define("ROUTE_NOT_FOUND", fiber.StatusNotFound, "Route not found")
+	ErrDeadLetterNotFound      = define("DEAD_LETTER_NOT_FOUND", fiber.StatusNotFound, "Dead letter not found")
+	ErrCORSOriginNotFound      = define("CORS_ORIGIN_NOT_FOUND", fiber.StatusNotFound, "CORS origin not found")
+
+	ErrUserExists       = define("USER_EXISTS", fiber.StatusConflict, "User already exists")
+	ErrAuthorExists     = define("AUTHOR_EXISTS", fiber.StatusConflict, "Author already exists")
+	ErrCORSOriginExists = define("CORS_ORIGIN_EXISTS", fiber.StatusConflict, "CORS origin already exists")
+	ErrReindexRunning   = define("REINDEX_RUNNING", fiber.StatusConflict, "A reindex is already running")
+	ErrBookUnavailable  = define("BOOK_UNAVAILABLE", fiber.StatusConflict, "Book is not available")
+	ErrLoanReturned     = define("LOAN_RETURNED", fiber.StatusConflict, "Loan has already been returned")
+	// ErrBookVersionConflict is sent as a VersionConflictBody
+	ErrBookVersionConflict = define("BOOK_VERSION_CONFLICT", fiber.StatusConflict, "Book was modified by another request, please refresh and retry")
+	// ErrPotentialDuplicate carries dedup.Details as details
+	ErrPotentialDuplicate = define("POTENTIAL_DUPLICATE", fiber.StatusConflict, "A book with a similar title already exists")
+
+	ErrConfirmationRequired = define("CONFIRMATION_REQUIRED", fiber.StatusPreconditionRequired, "This operation must be confirmed")
+
+	ErrRateLimited = define("RATE_LIMITED", fiber.StatusTooManyRequests, "Rate limit exceeded")
+	ErrHTTP        = define("HTTP_ERROR", fiber.StatusBadRequest, "Request failed")
+
+	ErrDatabase = define("DATABASE_ERROR", fiber.StatusInternalServerError, "Database error")
+	ErrInternal = define("INTERNAL_ERROR", fiber.StatusInternalServerError, "Internal server error")
+	ErrUpstream = define("UPSTREAM_ERROR", fiber.StatusBadGateway, "External service request failed")
+)
+
+// All returns every defined error ordered by code
+func All() []*APIError {
+	all := make([]*APIError, 0, len(registry))
+	for _, err := range registry {
+		all = append(all, err)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Code < all[j].Code })
+	return all
+}
+
+// Respond writes err as a JSON error response. Non-API errors become
+// INTERNAL_ERROR, except *fiber.Error, whose status is kept.
+func Respond(c *fiber.Ctx, err error) error {
+	apiErr := toAPIError(err)
+	if fields, ok := apiErr.Details.([]FieldError); ok {
+		return c.Status(apiErr.HTTPStatus).JSON(ValidationErrorBody{
+			Code:             apiErr.Code,
+			Message:          apiErr.Message,
+			ValidationErrors: fields,
+		})
+	}
+	return c.Status(apiErr.HTTPStatus).JSON(apiErr)
+}
+
+// Status returns the status Respond sends for err. Middleware that runs
+// before the error handler can use it in place of the response status,
+// which isn't set yet.
+func Status(err error) int {
+	return toAPIError(err).HTTPStatus
+}
+
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = fromError(err)
+	}
+	return apiErr
+}
+
+func fromError(err error) *APIError {
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) {
+		return ErrInternal
+	}
+
+	switch fiberErr.Code {
+	case fiber.StatusNotFound:
+		return ErrRouteNotFound.WithMessage(fiberErr.Message)
+	case fiber.StatusBadRequest:
+		return ErrInvalidRequestBody.WithMessage(fiberErr.Message)
+	}
+	if fiberErr.Code < 500 {
+		clone := ErrHTTP.WithMessage(fiberErr.Message)
+		clone.HTTPStatus = fiberErr.Code
+		return clone
+	}
+	return ErrInternal
+}
+
+// ErrorHandler is a fiber.ErrorHandler that formats errors returned by
+// handlers with Respond
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	return Respond(c, err)
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// column is an exported struct field and the header it is written under
+type column struct {
+	name  string
+	index []int
+}
+
+// columnsOf returns the columns of struct type t from its json tags. Fields
+// tagged json:"-" are skipped and embedded structs are flattened, as
+// encoding/json does.
+func columnsOf(t reflect.Type) ([]column, error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("export: rows must be structs, got %v", t)
+	}
+	return appendColumns(nil, t, nil), nil
+}
+
+func appendColumns(columns []column, t reflect.Type, parent []int) []column {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			if embedded := elemType(field.Type); embedded.Kind() == reflect.Struct {
+				columns = appendColumns(columns, embedded, index)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, column{name: name, index: index})
+	}
+	return columns
+}
+
+// cellValue returns the value of col in row: nil for nil rows and pointers,
+// times as RFC 3339 in UTC, numbers and booleans as is, strings, and anything
+// else JSON encoded
+func cellValue(row reflect.Value, col column) interface{} {
+	row = reflect.Indirect(row)
+	if !row.IsValid() {
+		return nil
+	}
+	v, err := row.FieldByIndexErr(col.index)
+	if err != nil {
+		return nil
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v.Interface()
+	}
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	return string(encoded)
+}
@@ -0,0 +1,170 @@
+// Package export writes slices of structs as JSON, CSV or XLSX reports.
+// Columns are the struct's json field names, so a report matches what the
+// API returns for the same type.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// Exporter writes data, a slice of structs or struct pointers, to w
+type Exporter interface {
+	Export(data interface{}, format string, w io.Writer) error
+}
+
+type JSONExporter struct{}
+
+type CSVExporter struct{}
+
+// XLSXExporter writes a single sheet with a bold, frozen header row
+type XLSXExporter struct{}
+
+func (JSONExporter) Export(data interface{}, format string, w io.Writer) error {
+	return exportAll(FormatJSON, format, data, w)
+}
+
+func (CSVExporter) Export(data interface{}, format string, w io.Writer) error {
+	return exportAll(FormatCSV, format, data, w)
+}
+
+func (XLSXExporter) Export(data interface{}, format string, w io.Writer) error {
+	return exportAll(FormatXLSX, format, data, w)
+}
+
+var exporters = map[string]Exporter{
+	FormatJSON: JSONExporter{},
+	FormatCSV:  CSVExporter{},
+	FormatXLSX: XLSXExporter{},
+}
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ForFormat returns the exporter for format
+func ForFormat(format string) (Exporter, error) {
+	exporter, ok := exporters[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+	return exporter, nil
+}
+
+// Export writes data to w in format
+func Export(data interface{}, format string, w io.Writer) error {
+	exporter, err := ForFormat(format)
+	if err != nil {
+		return err
+	}
+	return exporter.Export(data, format, w)
+}
+
+// Formats lists the supported formats in alphabetical order
+func Formats() []string {
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// ContentType returns the MIME type of format, or "" if it isn't supported
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// StreamExport writes rows to w as produce hands them over in batches, so
+// large reports never have to be held in memory at once. row is a value of
+// the batch element type and fixes the columns, which are written even if
+// produce never calls write. When w has a Flush method it is flushed after
+// every batch.
+//
+// XLSX files are zip archives that can only be written once complete;
+// excelize keeps rows beyond its in-memory buffer in a temporary file until
+// then.
+func StreamExport(w io.Writer, format string, row interface{}, produce func(write func(batch interface{}) error) error) error {
+	rowType := elemType(reflect.TypeOf(row))
+	columns, err := columnsOf(rowType)
+	if err != nil {
+		return err
+	}
+	rw, err := newRowWriter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := rw.begin(columns); err != nil {
+		rw.abort()
+		return err
+	}
+
+	flusher, _ := w.(interface{ Flush() error })
+	err = produce(func(batch interface{}) error {
+		rows, err := sliceOf(batch)
+		if err != nil {
+			return err
+		}
+		if rows.Len() > 0 && elemType(rows.Type().Elem()) != rowType {
+			return fmt.Errorf("export: batch of %s, want %s", rows.Type().Elem(), rowType)
+		}
+		for i := 0; i < rows.Len(); i++ {
+			if err := rw.write(rows.Index(i)); err != nil {
+				return err
+			}
+		}
+		if err := rw.flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			return flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		rw.abort()
+		return err
+	}
+	return rw.end()
+}
+
+func exportAll(want, format string, data interface{}, w io.Writer) error {
+	if format != want {
+		return fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+	rows, err := sliceOf(data)
+	if err != nil {
+		return err
+	}
+	return StreamExport(w, format, reflect.Zero(rows.Type().Elem()).Interface(), func(write func(interface{}) error) error {
+		return write(data)
+	})
+}
+
+func sliceOf(data interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return reflect.Value{}, fmt.Errorf("export: data must be a slice, got %T", data)
+	}
+	return v, nil
+}
+
+func elemType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
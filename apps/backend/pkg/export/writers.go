@@ -0,0 +1,189 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// rowWriter writes one report. begin is called once, flush after every batch
+// of rows, then end, or abort if the rows couldn't be produced.
+type rowWriter interface {
+	begin(columns []column) error
+	write(row reflect.Value) error
+	flush() error
+	end() error
+	abort()
+}
+
+func newRowWriter(format string, w io.Writer) (rowWriter, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatCSV:
+		return &csvWriter{cw: csv.NewWriter(w)}, nil
+	case FormatXLSX:
+		return &xlsxWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// jsonWriter writes rows as a JSON array, encoding each row whole so the
+// output matches the API's JSON for the type
+type jsonWriter struct {
+	w    io.Writer
+	rows int
+}
+
+func (j *jsonWriter) begin(columns []column) error {
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonWriter) write(row reflect.Value) error {
+	encoded, err := json.Marshal(row.Interface())
+	if err != nil {
+		return err
+	}
+	if j.rows > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.rows++
+	_, err = j.w.Write(encoded)
+	return err
+}
+
+func (j *jsonWriter) flush() error { return nil }
+
+func (j *jsonWriter) abort() {}
+
+func (j *jsonWriter) end() error {
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
+
+type csvWriter struct {
+	cw      *csv.Writer
+	columns []column
+}
+
+func (c *csvWriter) begin(columns []column) error {
+	c.columns = columns
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	return c.cw.Write(header)
+}
+
+func (c *csvWriter) write(row reflect.Value) error {
+	record := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		switch value := cellValue(row, col).(type) {
+		case nil:
+		case string:
+			record[i] = CSVSafe(value)
+		default:
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return c.cw.Write(record)
+}
+
+func (c *csvWriter) flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func (c *csvWriter) end() error { return c.flush() }
+
+func (c *csvWriter) abort() {}
+
+// CSVSafe keeps spreadsheet apps from evaluating a cell as a formula
+func CSVSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+const xlsxSheet = "Sheet1"
+
+type xlsxWriter struct {
+	w       io.Writer
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	columns []column
+	rows    int
+}
+
+func (x *xlsxWriter) begin(columns []column) error {
+	x.columns = columns
+	x.file = excelize.NewFile()
+	stream, err := x.file.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		return err
+	}
+	x.stream = stream
+
+	bold, err := x.file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	// Panes must be set before the first row is written
+	if err := stream.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = excelize.Cell{StyleID: bold, Value: col.name}
+	}
+	return x.writeRow(header)
+}
+
+func (x *xlsxWriter) write(row reflect.Value) error {
+	values := make([]interface{}, len(x.columns))
+	for i, col := range x.columns {
+		values[i] = cellValue(row, col)
+	}
+	return x.writeRow(values)
+}
+
+func (x *xlsxWriter) writeRow(values []interface{}) error {
+	x.rows++
+	cell, err := excelize.CoordinatesToCellName(1, x.rows)
+	if err != nil {
+		return err
+	}
+	return x.stream.SetRow(cell, values)
+}
+
+func (x *xlsxWriter) flush() error { return nil }
+
+// abort removes the temporary files of rows that were already written
+func (x *xlsxWriter) abort() {
+	if x.file != nil {
+		x.file.Close()
+	}
+}
+
+func (x *xlsxWriter) end() error {
+	defer x.abort()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.w)
+}
@@ -0,0 +1,180 @@
+// Package googlebooks looks up book metadata in the Google Books API
+package googlebooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/tracing"
+)
+
+// DefaultBaseURL is the Google Books API v1 root
+const DefaultBaseURL = "https://www.googleapis.com/books/v1"
+
+// ErrNotFound is returned when Google Books has no volume for an ISBN
+var ErrNotFound = errors.New("no book found for ISBN")
+
+// BookMetadata is the subset of a Google Books volume used to pre-fill a book
+type BookMetadata struct {
+	ISBN          string   `json:"isbn"`
+	Title         string   `json:"title"`
+	Authors       []string `json:"authors"`
+	PublishedDate string   `json:"published_date"`
+	Description   string   `json:"description"`
+	PageCount     int      `json:"page_count"`
+	Categories    []string `json:"categories"`
+	Thumbnail     string   `json:"thumbnail"`
+}
+
+// Year returns the year of PublishedDate, which Google formats as YYYY,
+// YYYY-MM or YYYY-MM-DD, or 0 if it is missing
+func (m BookMetadata) Year() int {
+	if len(m.PublishedDate) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(m.PublishedDate[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// Client calls the Google Books API
+type Client struct {
+	BaseURL string
+	// APIKey is optional; without one requests share Google's anonymous quota
+	APIKey     string
+	HTTPClient *exthttp.RetryableClient
+}
+
+// NewClient creates a client for the public API
+func NewClient(apiKey string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		APIKey:     apiKey,
+		HTTPClient: exthttp.NewRetryableClient(exthttp.DefaultMaxRetries, exthttp.DefaultTimeout),
+	}
+}
+
+// NewClientFromEnv creates a client using GOOGLE_BOOKS_API_KEY, retrying as
+// configured by EXTERNAL_HTTP_MAX_RETRIES and EXTERNAL_HTTP_TIMEOUT_MS. The
+// client is usable even when the retry configuration is invalid.
+func NewClientFromEnv() (*Client, error) {
+	client := NewClient(os.Getenv("GOOGLE_BOOKS_API_KEY"))
+	httpClient, err := exthttp.NewRetryableClientFromEnv()
+	client.HTTPClient = httpClient
+	return client, err
+}
+
+// NormalizeISBN strips hyphens and spaces from an ISBN
+func NormalizeISBN(isbn string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+}
+
+type volumesResponse struct {
+	TotalItems int `json:"totalItems"`
+	Items      []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Authors       []string `json:"authors"`
+			PublishedDate string   `json:"publishedDate"`
+			Description   string   `json:"description"`
+			PageCount     int      `json:"pageCount"`
+			Categories    []string `json:"categories"`
+			ImageLinks    struct {
+				Thumbnail string `json:"thumbnail"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+// LookupByISBN returns the metadata of the first volume matching isbn
+func (c *Client) LookupByISBN(ctx context.Context, isbn string) (*BookMetadata, error) {
+	isbn = NormalizeISBN(isbn)
+
+	query := url.Values{"q": {"isbn:" + isbn}}
+	if c.APIKey != "" {
+		query.Set("key", c.APIKey)
+	}
+	endpoint := strings.TrimRight(c.BaseURL, "/") + "/volumes?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	tracing.Inject(ctx, req.Header)
+	tracing.InjectBaggage(ctx, req.Header)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("google books request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("google books responded with status %d", resp.StatusCode)
+	}
+
+	var volumes volumesResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&volumes); err != nil {
+		return nil, fmt.Errorf("failed to decode google books response: %w", err)
+	}
+	if len(volumes.Items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	info := volumes.Items[0].VolumeInfo
+	return &BookMetadata{
+		ISBN:          isbn,
+		Title:         info.Title,
+		Authors:       info.Authors,
+		PublishedDate: info.PublishedDate,
+		Description:   info.Description,
+		PageCount:     info.PageCount,
+		Categories:    info.Categories,
+		// Google serves thumbnails over http by default
+		Thumbnail: strings.Replace(info.ImageLinks.Thumbnail, "http://", "https://", 1),
+	}, nil
+}
+
+// HealthChecker probes whether the Google Books API is reachable. Any
+// response below 500 counts, so the probe spends no lookup quota.
+type HealthChecker struct {
+	Client *Client
+}
+
+func (h HealthChecker) Name() string {
+	return "google_books"
+}
+
+func (h HealthChecker) Check(ctx context.Context) error {
+	baseURL := DefaultBaseURL
+	if h.Client != nil && h.Client.BaseURL != "" {
+		baseURL = h.Client.BaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		return err
+	}
+	// Retries would outlast the probe's timeout, so use a plain client
+	resp, err := exthttp.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("google books returned %d", resp.StatusCode)
+	}
+	return nil
+}
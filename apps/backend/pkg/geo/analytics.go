@@ -0,0 +1,166 @@
+package geo
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Handler records requests per country in the cache and serves the
+// country analytics
+type Handler struct {
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler keeping the analytics in c
+func NewHandler(c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{cache: c, log: log}
+}
+
+// UnknownCountry stands for addresses the database doesn't list
+const UnknownCountry = "unknown"
+
+// MaxAnalyticsDays is how many days of country analytics are kept
+const MaxAnalyticsDays = 30
+
+// Every analytics key shares the {analytics:countries} hash tag so the
+// recording script and multi-day PFCOUNTs work on Redis Cluster
+const analyticsKeyPrefix = "{analytics:countries}:"
+
+// recordScript counts a request for the country in ARGV[1] in the day's
+// sorted set KEYS[1] and adds the client IP in ARGV[2] to the country's
+// HyperLogLog of visitors KEYS[2]. Both expire ARGV[3] seconds after the
+// last request.
+var recordScript = redis.NewScript(`
+redis.call('ZINCRBY', KEYS[1], 1, ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('PFADD', KEYS[2], ARGV[2])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+// CountryCount is the traffic from one country
+type CountryCount struct {
+	CountryCode    string `json:"country_code" example:"TR"`
+	Requests       int64  `json:"requests" example:"1520"`
+	UniqueVisitors int64  `json:"unique_visitors" example:"84"`
+}
+
+// CountryStats is the traffic by country over the last Days days, busiest
+// first
+type CountryStats struct {
+	Days          int            `json:"days" example:"7"`
+	TotalRequests int64          `json:"total_requests" example:"2040"`
+	Countries     []CountryCount `json:"countries"`
+}
+
+func dayKey(day time.Time) string {
+	return analyticsKeyPrefix + day.UTC().Format("20060102")
+}
+
+func visitorsKey(day time.Time, country string) string {
+	return dayKey(day) + ":" + country
+}
+
+// RecordRequest counts a request from ip in country at t. An empty country
+// is counted as UnknownCountry. A nil Handler records nothing.
+func (h *Handler) RecordRequest(country, ip string, t time.Time) error {
+	if h == nil || h.cache == nil {
+		return nil
+	}
+	if country == "" {
+		country = UnknownCountry
+	}
+	ttl := int((MaxAnalyticsDays + 1) * 24 * time.Hour / time.Second)
+	_, err := h.cache.RunScript(recordScript, []string{dayKey(t), visitorsKey(t, country)}, country, ip, ttl)
+	return err
+}
+
+// Stats adds up the requests and unique visitors per country over
+// the days days up to and including now's. Visitors are counted once however
+// many days they came back.
+func (h *Handler) Stats(days int, now time.Time) (*CountryStats, error) {
+	if h.cache == nil {
+		return nil, errors.New("cache not configured")
+	}
+
+	dates := make([]time.Time, days)
+	requests := map[string]int64{}
+	for i := range dates {
+		dates[i] = now.AddDate(0, 0, -i)
+		members, err := h.cache.ZRevRangeWithScores(dayKey(dates[i]), 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			requests[m.Member] += int64(m.Score)
+		}
+	}
+
+	stats := &CountryStats{Days: days, Countries: make([]CountryCount, 0, len(requests))}
+	for country, count := range requests {
+		keys := make([]string, len(dates))
+		for i, day := range dates {
+			keys[i] = visitorsKey(day, country)
+		}
+		visitors, err := h.cache.PFCount(keys...)
+		if err != nil {
+			return nil, err
+		}
+		stats.TotalRequests += count
+		stats.Countries = append(stats.Countries, CountryCount{CountryCode: country, Requests: count, UniqueVisitors: visitors})
+	}
+	sort.Slice(stats.Countries, func(i, j int) bool {
+		a, b := stats.Countries[i], stats.Countries[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.CountryCode < b.CountryCode
+	})
+	return stats, nil
+}
+
+// GetCountryStats godoc
+// @Summary      Requests and unique visitors by country (admin only)
+// @Description  Requests are kept for 30 days. Addresses the GeoIP database doesn't list are counted as "unknown".
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Param        days  query  int  false  "Number of days, 1-30"  default(7)
+// @Success      200  {object} CountryStats
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/analytics/countries [get]
+func (h *Handler) GetCountryStats(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 7)
+	if days < 1 || days > MaxAnalyticsDays {
+		return apierrors.ErrInvalidQuery.WithMessage("days must be between 1 and 30")
+	}
+	stats, err := h.Stats(days, time.Now())
+	if err != nil {
+		logError(h.log, err, "get_country_stats", nil)
+		return apierrors.ErrInternal.WithMessage("Failed to read country analytics")
+	}
+	return c.JSON(stats)
+}
+
+func logError(log *logger.Logger, err error, operation string, fields map[string]interface{}) {
+	if log == nil {
+		return
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["operation"] = operation
+	log.LogError(err, fields)
+}
@@ -0,0 +1,11 @@
+//go:build geoip_embed
+
+package geo
+
+import _ "embed"
+
+// embeddedDB is GeoLite2-Country.mmdb from this directory. It isn't checked
+// in; download it from MaxMind before building with -tags geoip_embed.
+//
+//go:embed GeoLite2-Country.mmdb
+var embeddedDB []byte
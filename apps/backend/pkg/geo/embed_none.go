@@ -0,0 +1,7 @@
+//go:build !geoip_embed
+
+package geo
+
+// embeddedDB is empty without the geoip_embed build tag; the database is then
+// loaded from GEOIP_DB_PATH or downloaded by the updater
+var embeddedDB []byte
@@ -0,0 +1,126 @@
+// Package geo resolves client IP addresses to countries and cities with a
+// MaxMind database (GeoLite2 Country or City). The database is compiled in
+// with the geoip_embed build tag, loaded from GEOIP_DB_PATH, and refreshed by
+// StartUpdater when a MaxMind license key is configured.
+package geo
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is where an IP address is registered. Region and City are only
+// known with a City database.
+type Location struct {
+	CountryCode string `json:"country_code" example:"TR"`
+	CountryName string `json:"country_name" example:"Turkey"`
+	Region      string `json:"region,omitempty" example:"Istanbul"`
+	City        string `json:"city,omitempty" example:"Istanbul"`
+}
+
+// record holds the fields of a GeoLite2 Country or City record we use
+type record struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Resolver looks up IP addresses in a MaxMind database that can be replaced
+// while lookups are running
+type Resolver struct {
+	reader atomic.Pointer[maxminddb.Reader]
+}
+
+// Default is the resolver used by the GeoLocation middleware. It starts with
+// the embedded database, if there is one.
+var Default = NewResolver()
+
+func init() {
+	if len(embeddedDB) > 0 {
+		if err := Default.Load(embeddedDB); err != nil {
+			panic(fmt.Sprintf("geo: embedded database: %v", err))
+		}
+	}
+}
+
+// NewResolver creates a resolver without a database; it finds nothing until
+// one is loaded
+func NewResolver() *Resolver {
+	return &Resolver{}
+}
+
+// Load replaces the database with the MaxMind database in data
+func (r *Resolver) Load(data []byte) error {
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("invalid MaxMind database: %w", err)
+	}
+	// Readers made from bytes have nothing to close, so lookups still using
+	// the old one are safe
+	r.reader.Store(reader)
+	return nil
+}
+
+// LoadFile replaces the database with the one at path
+func (r *Resolver) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.Load(data)
+}
+
+// Loaded reports whether the resolver has a database
+func (r *Resolver) Loaded() bool {
+	return r.reader.Load() != nil
+}
+
+// BuildTime returns when the loaded database was built, or the zero time
+// without one
+func (r *Resolver) BuildTime() time.Time {
+	reader := r.reader.Load()
+	if reader == nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC()
+}
+
+// Lookup returns the location of ip. It reports false for invalid, private
+// and unlisted addresses, and when no database is loaded.
+func (r *Resolver) Lookup(ip string) (Location, bool) {
+	reader := r.reader.Load()
+	parsed := net.ParseIP(ip)
+	if reader == nil || parsed == nil {
+		return Location{}, false
+	}
+
+	var rec record
+	// An IPv6 address in an IPv4-only database is an error; it isn't listed
+	// either way
+	_, found, err := reader.LookupNetwork(parsed, &rec)
+	if err != nil || !found || rec.Country.ISOCode == "" {
+		return Location{}, false
+	}
+
+	location := Location{
+		CountryCode: rec.Country.ISOCode,
+		CountryName: rec.Country.Names["en"],
+		City:        rec.City.Names["en"],
+	}
+	if len(rec.Subdivisions) > 0 {
+		location.Region = rec.Subdivisions[0].Names["en"]
+	}
+	return location, true
+}
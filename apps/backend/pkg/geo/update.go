@@ -0,0 +1,217 @@
+package geo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+)
+
+// Updater defaults
+const (
+	DefaultEdition = "GeoLite2-Country"
+	DefaultDBPath  = "data/GeoLite2-Country.mmdb"
+	// DefaultUpdateInterval is how old the loaded database may get before it
+	// is downloaded again
+	DefaultUpdateInterval = 30 * 24 * time.Hour
+)
+
+const (
+	downloadURL = "https://download.maxmind.com/geoip/databases/%s/download?suffix=tar.gz"
+	// maxDatabaseSize bounds the extracted database; GeoLite2 City is about
+	// 60MB
+	maxDatabaseSize = 256 << 20
+	downloadTimeout = 5 * time.Minute
+	// updateCheckInterval is how often the updater checks the database's age
+	updateCheckInterval = 24 * time.Hour
+)
+
+// UpdaterConfig configures the database download
+type UpdaterConfig struct {
+	// Path is where the downloaded database is stored and loaded from on
+	// startup
+	Path string
+	// AccountID and LicenseKey are the MaxMind credentials; without a
+	// license key nothing is downloaded
+	AccountID  string
+	LicenseKey string
+	// Edition is the MaxMind edition ID, e.g. GeoLite2-City
+	Edition string
+	// Interval defaults to DefaultUpdateInterval
+	Interval time.Duration
+	// URL overrides the download URL built from Edition
+	URL string
+}
+
+// UpdaterConfigFromEnv reads GEOIP_DB_PATH, GEOIP_ACCOUNT_ID,
+// GEOIP_LICENSE_KEY and GEOIP_EDITION
+func UpdaterConfigFromEnv() UpdaterConfig {
+	config := UpdaterConfig{
+		Path:       os.Getenv("GEOIP_DB_PATH"),
+		AccountID:  os.Getenv("GEOIP_ACCOUNT_ID"),
+		LicenseKey: os.Getenv("GEOIP_LICENSE_KEY"),
+		Edition:    os.Getenv("GEOIP_EDITION"),
+	}
+	if config.Path == "" {
+		config.Path = DefaultDBPath
+	}
+	if config.Edition == "" {
+		config.Edition = DefaultEdition
+	}
+	return config
+}
+
+// Enabled reports whether there are credentials to download with
+func (c UpdaterConfig) Enabled() bool {
+	return c.LicenseKey != ""
+}
+
+// LoadLatest loads the database at path into r unless r already has a newer
+// one, e.g. the embedded one. A missing file is not an error.
+func LoadLatest(r *Resolver, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	candidate := NewResolver()
+	if err := candidate.Load(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if candidate.BuildTime().Before(r.BuildTime()) {
+		return nil
+	}
+	return r.Load(data)
+}
+
+// Update downloads the database, stores it at config.Path and loads it into r
+func Update(ctx context.Context, r *Resolver, config UpdaterConfig) error {
+	if !config.Enabled() {
+		return errors.New("GEOIP_LICENSE_KEY not configured")
+	}
+	target := config.URL
+	if target == "" {
+		target = fmt.Sprintf(downloadURL, url.PathEscape(config.Edition))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(config.AccountID, config.LicenseKey)
+
+	resp, err := exthttp.NewRetryableClient(exthttp.DefaultMaxRetries, downloadTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", config.Edition, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", config.Edition, resp.Status)
+	}
+
+	data, err := extractDatabase(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", config.Edition, err)
+	}
+	// Validate before replacing the stored copy
+	if err := NewResolver().Load(data); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(config.Path, data); err != nil {
+		return err
+	}
+	return r.Load(data)
+}
+
+// extractDatabase returns the .mmdb file in a MaxMind tar.gz archive
+func extractDatabase(body io.Reader) ([]byte, error) {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil, errors.New("no .mmdb file in archive")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(header.Name, ".mmdb") {
+			continue
+		}
+		if header.Size > maxDatabaseSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", header.Name, maxDatabaseSize)
+		}
+		return io.ReadAll(io.LimitReader(archive, maxDatabaseSize))
+	}
+}
+
+// writeFileAtomic writes data next to path and renames it into place, so a
+// crash never leaves a truncated database behind
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// StartUpdater downloads the database into r now if r's is missing or older
+// than config.Interval, and checks again daily until ctx is done. Updates
+// and failures are logged to log.
+func StartUpdater(ctx context.Context, r *Resolver, config UpdaterConfig, log *logger.Logger) {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultUpdateInterval
+	}
+	updateIfStale := func(ctx context.Context) {
+		if r.Loaded() && time.Since(r.BuildTime()) < interval {
+			return
+		}
+		if err := Update(ctx, r, config); err != nil {
+			logError(log, err, "update_geoip_database", map[string]interface{}{"edition": config.Edition})
+			return
+		}
+		if log != nil {
+			log.Info("GeoIP database updated", map[string]interface{}{
+				"edition":    config.Edition,
+				"build_time": r.BuildTime().Format(time.RFC3339),
+			})
+		}
+	}
+
+	go updateIfStale(ctx)
+	scheduler.Start(ctx, updateCheckInterval, updateIfStale)
+}
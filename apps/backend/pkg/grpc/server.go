@@ -0,0 +1,244 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/proto/bookpb"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// BookServer implements bookpb.BookServiceServer on top of book.Service, so
+// writes follow the same rules as over HTTP
+type BookServer struct {
+	bookpb.UnimplementedBookServiceServer
+	books    *book.Service
+	webhooks *webhook.Handler
+	cache    cache.Cache
+	log      *logger.Logger
+}
+
+// NewServer creates a gRPC server with the book service registered and
+// JWT authentication enforced on mutating RPCs. Writes are sent to
+// webhooks, drop their keys from c and are logged to log; all may be nil.
+func NewServer(books *book.Service, webhooks *webhook.Handler, c cache.Cache, log *logger.Logger) *gogrpc.Server {
+	server := gogrpc.NewServer(
+		gogrpc.UnaryInterceptor(middleware.GRPCAuthInterceptor(
+			bookpb.BookService_CreateBook_FullMethodName,
+			bookpb.BookService_UpdateBook_FullMethodName,
+			bookpb.BookService_DeleteBook_FullMethodName,
+		)),
+	)
+	bookpb.RegisterBookServiceServer(server, &BookServer{books: books, webhooks: webhooks, cache: c, log: log})
+	return server
+}
+
+// ListenAndServe starts serving gRPC on addr and blocks until the server stops
+func ListenAndServe(server *gogrpc.Server, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return server.Serve(lis)
+}
+
+func (s *BookServer) GetBook(ctx context.Context, req *bookpb.GetBookRequest) (*bookpb.BookResponse, error) {
+	b, err := s.books.GetBook(ctx, uint(req.GetId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &bookpb.BookResponse{Book: toProto(b)}, nil
+}
+
+func (s *BookServer) ListBooks(ctx context.Context, req *bookpb.ListBooksRequest) (*bookpb.ListBooksResponse, error) {
+	books, err := s.books.ListBooks(ctx, req.GetSearch())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &bookpb.ListBooksResponse{Total: int32(len(books))}
+	for i := range books {
+		resp.Books = append(resp.Books, toProto(&books[i]))
+	}
+	return resp, nil
+}
+
+func (s *BookServer) CreateBook(ctx context.Context, req *bookpb.CreateBookRequest) (*bookpb.BookResponse, error) {
+	b := book.Book{
+		Title:  req.GetTitle(),
+		Author: req.GetAuthor(),
+		Year:   int(req.GetYear()),
+		Genre:  req.GetGenre(),
+		ISBN:   req.GetIsbn(),
+	}
+	if err := middleware.SanitizeStruct(&b); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// The proto has no way to confirm a near-duplicate title, so they are
+	// always rejected
+	if err := s.books.AddBook(editorContext(ctx), &b, false); err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.invalidateCache(ctx, 0)
+	book.InvalidateAuthorCache(s.cache, b.AuthorID)
+	s.logOperation(ctx, "create", b.ID, b.Title)
+	s.webhooks.Dispatch(ctx, webhook.EventBookCreated, &b)
+
+	return &bookpb.BookResponse{Book: toProto(&b)}, nil
+}
+
+func (s *BookServer) UpdateBook(ctx context.Context, req *bookpb.UpdateBookRequest) (*bookpb.BookResponse, error) {
+	changes := book.Book{
+		Title:  req.GetTitle(),
+		Author: req.GetAuthor(),
+		Year:   int(req.GetYear()),
+		Genre:  req.GetGenre(),
+		ISBN:   req.GetIsbn(),
+	}
+	if err := middleware.SanitizeStruct(&changes); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	updated, err := s.books.UpdateBook(editorContext(ctx), uint(req.GetId()), &changes)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.invalidateCache(ctx, updated.ID)
+	book.InvalidateAuthorCache(s.cache, updated.AuthorID)
+	s.logOperation(ctx, "update", updated.ID, updated.Title)
+	s.webhooks.Dispatch(ctx, webhook.EventBookUpdated, updated)
+
+	return &bookpb.BookResponse{Book: toProto(updated)}, nil
+}
+
+func (s *BookServer) DeleteBook(ctx context.Context, req *bookpb.DeleteBookRequest) (*bookpb.DeleteBookResponse, error) {
+	// Drop the series list while the book is still joined to it
+	s.invalidateCache(ctx, uint(req.GetId()))
+	if err := s.books.DeleteBook(ctx, uint(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+	s.logOperation(ctx, "delete", uint(req.GetId()), "")
+	s.webhooks.Dispatch(ctx, webhook.EventBookDeleted, map[string]interface{}{"id": req.GetId()})
+
+	return &bookpb.DeleteBookResponse{Deleted: true}, nil
+}
+
+func toProto(b *book.Book) *bookpb.Book {
+	return &bookpb.Book{
+		Id:        uint64(b.ID),
+		Title:     b.Title,
+		Author:    b.Author,
+		Year:      int32(b.Year),
+		Genre:     b.Genre,
+		Isbn:      b.ISBN,
+		CreatedAt: timestamppb.New(b.CreatedAt),
+		UpdatedAt: timestamppb.New(b.UpdatedAt),
+	}
+}
+
+// apiErrorCodes maps the HTTP status of an APIError to a gRPC code
+var apiErrorCodes = map[int]codes.Code{
+	fiber.StatusBadRequest:      codes.InvalidArgument,
+	fiber.StatusUnauthorized:    codes.Unauthenticated,
+	fiber.StatusForbidden:       codes.PermissionDenied,
+	fiber.StatusNotFound:        codes.NotFound,
+	fiber.StatusConflict:        codes.AlreadyExists,
+	fiber.StatusTooManyRequests: codes.ResourceExhausted,
+}
+
+func toStatus(err error) error {
+	var apiErr *apierrors.APIError
+	if errors.As(err, &apiErr) {
+		return apiErrorStatus(apiErr)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status.Error(codes.NotFound, "book not found")
+	}
+	var conflict *book.VersionConflictError
+	if errors.As(err, &conflict) {
+		return status.Error(codes.Aborted, err.Error())
+	}
+	if errors.Is(err, book.ErrBookUnavailable) {
+		return status.Error(codes.FailedPrecondition, "only available books can be deleted")
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// apiErrorStatus converts a rule broken in book.Service. Validation errors
+// list each rejected field in the message, since the proto has no details.
+func apiErrorStatus(err *apierrors.APIError) error {
+	code, ok := apiErrorCodes[err.HTTPStatus]
+	if !ok {
+		code = codes.Internal
+	}
+	message := err.Message
+	if fields, ok := err.Details.([]apierrors.FieldError); ok {
+		parts := make([]string, len(fields))
+		for i, field := range fields {
+			parts[i] = field.Path + ": " + field.Message
+		}
+		message += ": " + strings.Join(parts, "; ")
+	}
+	return status.Error(code, message)
+}
+
+// invalidateCache drops the same keys the HTTP handlers drop on writes
+func (s *BookServer) invalidateCache(ctx context.Context, id uint) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.Delete("books:all")
+	if id != 0 {
+		s.cache.Delete(fmt.Sprintf("book:%d", id))
+		if seriesID, err := s.books.GetBookSeriesID(ctx, id); err == nil && seriesID != 0 {
+			book.InvalidateSeriesCache(s.cache, seriesID)
+		}
+	}
+}
+
+// editorContext attributes book changes to the authenticated caller
+func editorContext(ctx context.Context) context.Context {
+	token, ok := middleware.GRPCUserFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ctx
+	}
+	// JSON numbers decode as float64
+	if sub, ok := claims["sub"].(float64); ok && sub > 0 {
+		return book.WithEditor(ctx, uint(sub))
+	}
+	return ctx
+}
+
+func (s *BookServer) logOperation(ctx context.Context, operation string, id uint, title string) {
+	if s.log == nil {
+		return
+	}
+
+	username := ""
+	if token, ok := middleware.GRPCUserFromContext(ctx); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			username, _ = claims["username"].(string)
+		}
+	}
+	s.log.LogBookOperation(operation, username, id, title)
+}
@@ -0,0 +1,261 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Goroutine monitor defaults
+const (
+	DefaultGoroutineLeakThreshold     = 1000
+	DefaultGoroutineCriticalThreshold = 5000
+	DefaultGoroutineCheckInterval     = 30 * time.Second
+)
+
+// maxGoroutineDump caps the stack dump so a leak of thousands of goroutines
+// doesn't produce a log line of hundreds of megabytes
+const maxGoroutineDump = 1 << 20
+
+// GoroutineMonitorConfig configures the goroutine leak monitor
+type GoroutineMonitorConfig struct {
+	Interval time.Duration
+	// LeakThreshold is the count above which a leak is reported
+	LeakThreshold int
+	// CriticalThreshold is the count above which the process shuts down so
+	// the orchestrator restarts it
+	CriticalThreshold int
+	// SlackWebhookURL receives leak alerts when set
+	SlackWebhookURL string
+}
+
+// GoroutineMonitorConfigFromEnv reads GOROUTINE_LEAK_THRESHOLD,
+// GOROUTINE_CRITICAL_THRESHOLD and GOROUTINE_ALERT_SLACK_WEBHOOK
+func GoroutineMonitorConfigFromEnv() (GoroutineMonitorConfig, error) {
+	config := GoroutineMonitorConfig{
+		Interval:          DefaultGoroutineCheckInterval,
+		LeakThreshold:     DefaultGoroutineLeakThreshold,
+		CriticalThreshold: DefaultGoroutineCriticalThreshold,
+		SlackWebhookURL:   os.Getenv("GOROUTINE_ALERT_SLACK_WEBHOOK"),
+	}
+	for key, dest := range map[string]*int{
+		"GOROUTINE_LEAK_THRESHOLD":     &config.LeakThreshold,
+		"GOROUTINE_CRITICAL_THRESHOLD": &config.CriticalThreshold,
+	} {
+		raw := os.Getenv(key)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("%s must be a positive number, got %q", key, raw)
+		}
+		*dest = n
+	}
+	if config.CriticalThreshold < config.LeakThreshold {
+		return config, fmt.Errorf("GOROUTINE_CRITICAL_THRESHOLD (%d) must not be below GOROUTINE_LEAK_THRESHOLD (%d)", config.CriticalThreshold, config.LeakThreshold)
+	}
+	return config, nil
+}
+
+// GoroutineMonitor watches the goroutine count for leaks. A leak is logged
+// with a stack dump and alerted once when the count crosses LeakThreshold,
+// and the goroutine_leak_detected gauge stays 1 until it drops back.
+type GoroutineMonitor struct {
+	config GoroutineMonitorConfig
+	log    *logger.Logger
+	client *http.Client
+
+	// Restart shuts the process down gracefully; by default it sends itself
+	// SIGTERM
+	Restart func()
+
+	mu      sync.Mutex
+	leaking bool
+}
+
+// NewGoroutineMonitor creates a monitor. Zero thresholds use the defaults.
+func NewGoroutineMonitor(config GoroutineMonitorConfig, log *logger.Logger) *GoroutineMonitor {
+	if config.Interval <= 0 {
+		config.Interval = DefaultGoroutineCheckInterval
+	}
+	if config.LeakThreshold <= 0 {
+		config.LeakThreshold = DefaultGoroutineLeakThreshold
+	}
+	if config.CriticalThreshold <= 0 {
+		config.CriticalThreshold = DefaultGoroutineCriticalThreshold
+	}
+	return &GoroutineMonitor{
+		config:  config,
+		log:     log,
+		client:  exthttp.NewClient(10 * time.Second),
+		Restart: terminate,
+	}
+}
+
+func terminate() {
+	if process, err := os.FindProcess(os.Getpid()); err == nil {
+		process.Signal(syscall.SIGTERM)
+	}
+}
+
+// Start checks the goroutine count every interval until ctx is done
+func (m *GoroutineMonitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check(ctx)
+			}
+		}
+	}()
+}
+
+// Check compares the current goroutine count with the thresholds and returns
+// it
+func (m *GoroutineMonitor) Check(ctx context.Context) int {
+	count := runtime.NumGoroutine()
+	metrics.SetActiveGoroutines(float64(count))
+
+	leaking := count > m.config.LeakThreshold
+	m.mu.Lock()
+	started := leaking && !m.leaking
+	m.leaking = leaking
+	m.mu.Unlock()
+	metrics.SetGoroutineLeakDetected(leaking)
+
+	if started {
+		m.reportLeak(ctx, count)
+	}
+
+	if count > m.config.CriticalThreshold {
+		if m.log != nil {
+			m.log.Error("Goroutine count critical; shutting down for a restart", map[string]interface{}{
+				"goroutines": count,
+				"threshold":  m.config.CriticalThreshold,
+			})
+		}
+		m.Restart()
+	}
+	return count
+}
+
+// Leaking reports whether the last check found more goroutines than
+// LeakThreshold
+func (m *GoroutineMonitor) Leaking() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leaking
+}
+
+func (m *GoroutineMonitor) reportLeak(ctx context.Context, count int) {
+	if m.log != nil {
+		m.log.Warn("Possible goroutine leak", map[string]interface{}{
+			"goroutines": count,
+			"threshold":  m.config.LeakThreshold,
+			"dump":       GoroutineDump(),
+		})
+	}
+
+	if m.config.SlackWebhookURL == "" {
+		return
+	}
+	if err := m.alertSlack(ctx, count); err != nil && m.log != nil {
+		m.log.LogError(err, map[string]interface{}{"operation": "goroutine_leak_alert"})
+	}
+}
+
+func (m *GoroutineMonitor) alertSlack(ctx context.Context, count int) error {
+	host, _ := os.Hostname()
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf(":warning: Possible goroutine leak on %s: %d goroutines (threshold %d)", host, count, m.config.LeakThreshold),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.SlackWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send goroutine leak alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("goroutine leak alert rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// GoroutineDump returns the stacks of all goroutines, truncated to 1MB
+func GoroutineDump() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxGoroutineDump {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// GoroutinesResponse is the current goroutine count, with the stack dump
+// when requested by an admin
+type GoroutinesResponse struct {
+	Goroutines int    `json:"goroutines" example:"42"`
+	Dump       string `json:"dump,omitempty"`
+}
+
+// GoroutinesHandler godoc
+// @Summary      Get the goroutine count
+// @Description  Returns the number of goroutines. dump=true adds the stacks of all goroutines and is limited to admins.
+// @Tags         health
+// @Produce      json
+// @Param        dump query bool false "Include a stack dump (admin only)" default(false)
+// @Success      200  {object} GoroutinesResponse
+// @Failure      400  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /health/goroutines [get]
+func GoroutinesHandler(isAdmin func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		dump := false
+		if raw := c.Query("dump"); raw != "" {
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return apierrors.ErrInvalidQuery.WithMessage("dump must be true or false")
+			}
+			dump = parsed
+		}
+		if dump && !isAdmin(c) {
+			return apierrors.ErrForbidden.WithMessage("Only admins can read the goroutine dump")
+		}
+
+		response := GoroutinesResponse{Goroutines: runtime.NumGoroutine()}
+		if dump {
+			response.Dump = GoroutineDump()
+		}
+		return c.JSON(response)
+	}
+}
@@ -0,0 +1,200 @@
+// Package health runs dependency probes for the /health endpoint. Packages
+// that own a dependency provide a Checker, and anything registered with the
+// default registry shows up in /health without changes to main.go.
+package health
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Checker probes one dependency. Check should honour ctx, which carries the
+// checker's timeout.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+	StatusOK        = "ok"
+	StatusError     = "error"
+)
+
+// DefaultTimeout is used when CHECK_TIMEOUT_MS is unset
+const DefaultTimeout = 2 * time.Second
+
+// CheckResult is the outcome of one checker
+type CheckResult struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the outcome of running every checker. Status is healthy only if
+// every check passed.
+type Report struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Registry holds checkers and runs them concurrently
+type Registry struct {
+	mu       sync.RWMutex
+	checkers []Checker
+	timeout  time.Duration
+}
+
+// NewRegistry creates an empty registry whose checkers time out after timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Default is the registry served by Handler(nil)
+var Default = NewRegistry(TimeoutFromEnv("", DefaultTimeout))
+
+// Register adds checkers to the default registry
+func Register(checkers ...Checker) {
+	Default.Register(checkers...)
+}
+
+// Register adds checkers. A checker with the same name as an existing one
+// replaces it.
+func (r *Registry) Register(checkers ...Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, checker := range checkers {
+		replaced := false
+		for i, existing := range r.checkers {
+			if existing.Name() == checker.Name() {
+				r.checkers[i] = checker
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			r.checkers = append(r.checkers, checker)
+		}
+	}
+}
+
+// Names returns the registered checker names in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.checkers))
+	for _, checker := range r.checkers {
+		names = append(names, checker.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TimeoutFromEnv reads the timeout for the named checker from
+// CHECK_TIMEOUT_MS_<NAME>, falling back to CHECK_TIMEOUT_MS and then to
+// fallback. An empty name reads only CHECK_TIMEOUT_MS.
+func TimeoutFromEnv(name string, fallback time.Duration) time.Duration {
+	timeout := durationFromEnv("CHECK_TIMEOUT_MS", fallback)
+	if name != "" {
+		timeout = durationFromEnv("CHECK_TIMEOUT_MS_"+strings.ToUpper(name), timeout)
+	}
+	return timeout
+}
+
+// durationFromEnv reads a positive number of milliseconds from key
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv(key)); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return fallback
+}
+
+// Run executes every checker concurrently, each with its own timeout, and
+// waits for all of them
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := append([]Checker(nil), r.checkers...)
+	r.mu.RUnlock()
+
+	report := Report{
+		Status:    StatusHealthy,
+		Checks:    make(map[string]CheckResult, len(checkers)),
+		Timestamp: time.Now().UTC(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, checker := range checkers {
+		wg.Add(1)
+		go func(checker Checker) {
+			defer wg.Done()
+			result := r.runOne(ctx, checker)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[checker.Name()] = result
+			if result.Status != StatusOK {
+				report.Status = StatusUnhealthy
+			}
+		}(checker)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (r *Registry) runOne(ctx context.Context, checker Checker) CheckResult {
+	return check(ctx, checker.Check, TimeoutFromEnv(checker.Name(), r.timeout))
+}
+
+// check runs fn with timeout and times it
+func check(ctx context.Context, fn func(context.Context) error, timeout time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	// Don't trust checkers to honour ctx; a hung probe must not hang /health
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Handler serves the registry's report, with status 503 if any check failed.
+// A nil registry serves Default.
+func Handler(registry *Registry) fiber.Handler {
+	if registry == nil {
+		registry = Default
+	}
+	return func(c *fiber.Ctx) error {
+		report := registry.Run(c.UserContext())
+		status := fiber.StatusOK
+		if report.Status != StatusHealthy {
+			status = fiber.StatusServiceUnavailable
+		}
+		return c.Status(status).JSON(report)
+	}
+}
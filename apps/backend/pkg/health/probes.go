@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// StatusDegraded is reported by /health/dependencies when a critical probe
+// fails
+const StatusDegraded = "degraded"
+
+// HealthProbeResult is the outcome of one probe
+type HealthProbeResult = CheckResult
+
+// ProbeReport is the outcome of every probe. Status is healthy as long as
+// the critical probes pass.
+type ProbeReport struct {
+	Status    string                       `json:"status"`
+	Probes    map[string]HealthProbeResult `json:"probes"`
+	Timestamp time.Time                    `json:"timestamp"`
+}
+
+// The dependencies the Probe functions check. Set in main; a probe whose
+// checker is nil fails.
+var (
+	DatabaseProbe    Checker
+	RedisProbe       Checker
+	GoogleBooksProbe Checker
+	SMTPProbe        Checker
+)
+
+var errNotConfigured = errors.New("not configured")
+
+// probe is one dependency of the ProbeReport. Failing non-critical probes
+// are reported without degrading the status.
+type probe struct {
+	name     string
+	critical bool
+	run      func(context.Context) HealthProbeResult
+}
+
+var probes = []probe{
+	{name: "database", critical: true, run: ProbeDatabase},
+	{name: "redis", critical: true, run: ProbeRedis},
+	{name: "google_books", run: ProbeGoogleBooksAPI},
+	{name: "smtp", run: ProbeSMTP},
+}
+
+// ProbeTimeoutFromEnv reads the timeout of a probe from
+// HEALTH_PROBE_<NAME>_TIMEOUT_MS, falling back to DefaultTimeout
+func ProbeTimeoutFromEnv(name string) time.Duration {
+	return durationFromEnv("HEALTH_PROBE_"+name+"_TIMEOUT_MS", DefaultTimeout)
+}
+
+func runProbe(ctx context.Context, checker Checker, name string) HealthProbeResult {
+	if checker == nil {
+		return HealthProbeResult{Status: StatusError, Error: errNotConfigured.Error()}
+	}
+	return check(ctx, checker.Check, ProbeTimeoutFromEnv(name))
+}
+
+// ProbeDatabase pings the database within HEALTH_PROBE_DB_TIMEOUT_MS
+func ProbeDatabase(ctx context.Context) HealthProbeResult {
+	return runProbe(ctx, DatabaseProbe, "DB")
+}
+
+// ProbeRedis pings Redis within HEALTH_PROBE_REDIS_TIMEOUT_MS
+func ProbeRedis(ctx context.Context) HealthProbeResult {
+	return runProbe(ctx, RedisProbe, "REDIS")
+}
+
+// ProbeGoogleBooksAPI checks that the Google Books API answers within
+// HEALTH_PROBE_GOOGLE_BOOKS_TIMEOUT_MS
+func ProbeGoogleBooksAPI(ctx context.Context) HealthProbeResult {
+	return runProbe(ctx, GoogleBooksProbe, "GOOGLE_BOOKS")
+}
+
+// ProbeSMTP checks that the SMTP server greets within
+// HEALTH_PROBE_SMTP_TIMEOUT_MS
+func ProbeSMTP(ctx context.Context) HealthProbeResult {
+	return runProbe(ctx, SMTPProbe, "SMTP")
+}
+
+// RunProbes runs every probe in parallel and waits for all of them
+func RunProbes(ctx context.Context) ProbeReport {
+	results := make([]HealthProbeResult, len(probes))
+	var g errgroup.Group
+	for i, p := range probes {
+		i, p := i, p
+		g.Go(func() error {
+			results[i] = p.run(ctx)
+			return nil
+		})
+	}
+	g.Wait()
+
+	report := ProbeReport{
+		Status:    StatusHealthy,
+		Probes:    make(map[string]HealthProbeResult, len(probes)),
+		Timestamp: time.Now().UTC(),
+	}
+	for i, p := range probes {
+		report.Probes[p.name] = results[i]
+		if p.critical && results[i].Status != StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// ProbesHandler serves RunProbes, with status 503 when degraded
+func ProbesHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := RunProbes(c.UserContext())
+		status := fiber.StatusOK
+		if report.Status != StatusHealthy {
+			status = fiber.StatusServiceUnavailable
+		}
+		return c.Status(status).JSON(report)
+	}
+}
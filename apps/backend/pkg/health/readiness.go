@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReadyTimeout is how long /health/ready waits for dependencies to respond
+const ReadyTimeout = 2 * time.Second
+
+var (
+	ready          atomic.Bool
+	notReadyReason atomic.Value
+)
+
+func init() {
+	notReadyReason.Store("starting")
+}
+
+// MarkReady reports that initialization has finished and the server can take
+// traffic
+func MarkReady() {
+	notReadyReason.Store("")
+	ready.Store(true)
+}
+
+// MarkNotReady takes the server out of rotation, e.g. when shutdown begins
+func MarkNotReady(reason string) {
+	notReadyReason.Store(reason)
+	ready.Store(false)
+}
+
+// IsReady reports whether the server is ready and, if not, why
+func IsReady() (bool, string) {
+	if ready.Load() {
+		return true, ""
+	}
+	reason, _ := notReadyReason.Load().(string)
+	return false, reason
+}
+
+// LiveHandler answers liveness probes. It checks nothing, since restarting
+// the process won't fix a dependency outage.
+func LiveHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "alive"})
+	}
+}
+
+// ReadyHandler answers readiness probes: 200 only once MarkReady has been
+// called and every dependency in registry responds within ReadyTimeout. A nil
+// registry uses Default.
+func ReadyHandler(registry *Registry) fiber.Handler {
+	if registry == nil {
+		registry = Default
+	}
+	return func(c *fiber.Ctx) error {
+		if ok, reason := IsReady(); !ok {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "not_ready",
+				"reason": reason,
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), ReadyTimeout)
+		defer cancel()
+
+		report := registry.Run(ctx)
+		if report.Status != StatusHealthy {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "not_ready",
+				"reason": "dependency check failed",
+				"checks": report.Checks,
+			})
+		}
+		return c.JSON(fiber.Map{"status": "ready", "checks": report.Checks})
+	}
+}
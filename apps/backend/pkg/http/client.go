@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// Transport settings of the shared connection pool
+const (
+	MaxIdleConns        = 100
+	MaxIdleConnsPerHost = 20
+	IdleConnTimeout     = 90 * time.Second
+	TLSHandshakeTimeout = 10 * time.Second
+)
+
+// Transport is the connection pool shared by every outbound client. The
+// default transport keeps only 2 idle connections per host, so concurrent
+// calls to one API kept opening new connections and TLS sessions; this one
+// keeps up to MaxIdleConnsPerHost. Requests through it are recorded by
+// MetricsTransport.
+var Transport http.RoundTripper = NewMetricsTransport(newTransport())
+
+// DefaultClient is the shared client for outbound calls without a timeout
+// of their own. It has no timeout, so requests should carry a context with
+// a deadline.
+var DefaultClient = &http.Client{Transport: Transport}
+
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = MaxIdleConns
+	t.MaxIdleConnsPerHost = MaxIdleConnsPerHost
+	t.IdleConnTimeout = IdleConnTimeout
+	t.TLSHandshakeTimeout = TLSHandshakeTimeout
+	t.DisableKeepAlives = false
+	return t
+}
+
+// NewClient returns a client whose requests time out after timeout. Clients
+// are cheap; they all share Transport and so its idle connections.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: Transport, Timeout: timeout}
+}
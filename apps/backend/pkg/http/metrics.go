@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+)
+
+// MetricsTransport records external_http_requests_total and
+// external_http_request_duration_seconds for each request sent through Next.
+// The duration ends when the response headers arrive, not when the body has
+// been read.
+type MetricsTransport struct {
+	Next http.RoundTripper
+}
+
+// NewMetricsTransport wraps next, http.DefaultTransport if nil
+func NewMetricsTransport(next http.RoundTripper) *MetricsTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &MetricsTransport{Next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.Next.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.RecordExternalHTTPRequest(req.URL.Host, status, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,152 @@
+// Package http provides the client for outbound calls to external services.
+// It retries idempotent requests that fail transiently, since third-party
+// APIs regularly answer 429 or 503 for a moment.
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Retry defaults
+const (
+	DefaultMaxRetries     = 5
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultBackoffFactor  = 2
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultTimeout        = 10 * time.Second
+)
+
+// RetryableClient sends requests with Client and retries idempotent ones
+// that failed transiently, waiting InitialBackoff, then Factor times longer
+// after each attempt up to MaxBackoff. Waits are jittered so clients don't
+// retry in lockstep, and a Retry-After header is honoured up to MaxBackoff.
+type RetryableClient struct {
+	Client         *http.Client
+	MaxRetries     int
+	InitialBackoff time.Duration
+	Factor         float64
+	MaxBackoff     time.Duration
+}
+
+// NewRetryableClient creates a client on the shared Transport whose attempts
+// each time out after timeout
+func NewRetryableClient(maxRetries int, timeout time.Duration) *RetryableClient {
+	return &RetryableClient{
+		Client:         NewClient(timeout),
+		MaxRetries:     maxRetries,
+		InitialBackoff: DefaultInitialBackoff,
+		Factor:         DefaultBackoffFactor,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// NewRetryableClientFromEnv creates a client configured by
+// EXTERNAL_HTTP_MAX_RETRIES and EXTERNAL_HTTP_TIMEOUT_MS. Invalid values are
+// reported and replaced by the defaults.
+func NewRetryableClientFromEnv() (*RetryableClient, error) {
+	maxRetries, timeout := DefaultMaxRetries, DefaultTimeout
+	var err error
+	if raw := os.Getenv("EXTERNAL_HTTP_MAX_RETRIES"); raw != "" {
+		if n, convErr := strconv.Atoi(raw); convErr != nil || n < 0 {
+			err = fmt.Errorf("EXTERNAL_HTTP_MAX_RETRIES must be a number of at least 0, got %q", raw)
+		} else {
+			maxRetries = n
+		}
+	}
+	if raw := os.Getenv("EXTERNAL_HTTP_TIMEOUT_MS"); raw != "" {
+		if ms, convErr := strconv.Atoi(raw); convErr != nil || ms < 1 {
+			err = fmt.Errorf("EXTERNAL_HTTP_TIMEOUT_MS must be a positive number, got %q", raw)
+		} else {
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return NewRetryableClient(maxRetries, timeout), err
+}
+
+// Do sends req, retrying as long as shouldRetry allows, MaxRetries isn't
+// used up and the request's context isn't done. Requests with a body are
+// only retried when it can be re-read through GetBody.
+func (c *RetryableClient) Do(req *http.Request) (*http.Response, error) {
+	retryable := idempotent(req.Method) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := c.Client.Do(req)
+		if !retryable || attempt >= c.MaxRetries || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// shouldRetry reports whether a request that got resp or err may succeed if
+// sent again: on network errors such as a refused connection, 429 Too Many
+// Requests, and server errors other than 501 Not Implemented
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
+
+// backoff returns how long to wait after the given attempt, counting from 0
+func (c *RetryableClient) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, c.MaxBackoff)
+		}
+	}
+
+	wait := float64(c.InitialBackoff)
+	for i := 0; i < attempt; i++ {
+		wait *= c.Factor
+	}
+	wait = min(wait, float64(c.MaxBackoff))
+	// Wait between half and all of the backoff
+	return time.Duration(wait/2 + rand.Float64()*wait/2)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
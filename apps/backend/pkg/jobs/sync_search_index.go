@@ -0,0 +1,178 @@
+// Package jobs holds background jobs that repair data in bulk, such as
+// bringing stale search vectors up to date
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+	"gorm.io/gorm"
+)
+
+// Runner runs the jobs against a database, keeping locks and progress in
+// the cache
+type Runner struct {
+	db    *gorm.DB
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewRunner returns a Runner repairing data in conn
+func NewRunner(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Runner {
+	return &Runner{db: conn, cache: c, log: log}
+}
+
+// SearchIndexSyncBatchSize is the number of books rebuilt per UPDATE
+const SearchIndexSyncBatchSize = 200
+
+// DefaultSearchIndexSyncSchedule runs the sync nightly at 03:00 UTC
+const DefaultSearchIndexSyncSchedule = "0 3 * * *"
+
+// Search index sync statuses
+const (
+	SyncRunning   = "running"
+	SyncCompleted = "completed"
+	SyncFailed    = "failed"
+)
+
+const (
+	searchIndexSyncProgressKey = "jobs:sync_search_index:progress"
+	searchIndexSyncLockKey     = "jobs:sync_search_index:lock"
+	searchIndexSyncProgressTTL = 7 * 24 * time.Hour
+)
+
+// ErrSyncRunning is returned when another instance holds the sync lock
+var ErrSyncRunning = errors.New("search index sync already running")
+
+// staleSearchVectors selects books whose search vector is missing or older
+// than their last update, soft-deleted ones included like the reindex
+const staleSearchVectors = "search_vector IS NULL OR search_vector_updated_at IS NULL OR search_vector_updated_at < updated_at"
+
+// SearchIndexSyncProgress is the state of the last search index sync
+type SearchIndexSyncProgress struct {
+	Processed  int64      `json:"processed" example:"400"`
+	LastID     uint       `json:"last_id" example:"1234"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Status     string     `json:"status" example:"completed"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// SyncSearchIndex rebuilds the search vectors of books that were never
+// indexed or changed since, SearchIndexSyncBatchSize books at a time in ID
+// order, and records its progress in the cache after each batch. A cache
+// lock keeps instances from syncing at the same time.
+func (r *Runner) SyncSearchIndex(ctx context.Context) (*SearchIndexSyncProgress, error) {
+	if r.cache != nil {
+		acquired, err := r.cache.SetNX(searchIndexSyncLockKey, true, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if !acquired {
+			return nil, ErrSyncRunning
+		}
+		defer r.cache.Delete(searchIndexSyncLockKey)
+	}
+
+	progress := &SearchIndexSyncProgress{StartedAt: time.Now().UTC(), Status: SyncRunning}
+	r.saveSyncProgress(progress)
+
+	err := r.syncBatches(ctx, progress)
+
+	finished := time.Now().UTC()
+	progress.FinishedAt = &finished
+	progress.Status = SyncCompleted
+	if err != nil {
+		progress.Status = SyncFailed
+		progress.Error = err.Error()
+	}
+	r.saveSyncProgress(progress)
+	return progress, err
+}
+
+func (r *Runner) syncBatches(ctx context.Context, progress *SearchIndexSyncProgress) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var ids []uint
+		err := r.db.WithContext(ctx).
+			Raw("SELECT id FROM books WHERE id > ? AND ("+staleSearchVectors+") ORDER BY id LIMIT ?", progress.LastID, SearchIndexSyncBatchSize).
+			Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		result := r.db.WithContext(ctx).Exec(
+			"UPDATE books SET search_vector = "+book.SearchVectorSQL+", search_vector_updated_at = updated_at WHERE id IN ?", ids)
+		if result.Error != nil {
+			return result.Error
+		}
+		progress.Processed += result.RowsAffected
+		progress.LastID = ids[len(ids)-1]
+		metrics.RecordReindexProcessed(result.RowsAffected)
+		r.saveSyncProgress(progress)
+
+		if len(ids) < SearchIndexSyncBatchSize {
+			return nil
+		}
+	}
+}
+
+// GetSearchIndexSyncProgress returns the progress of the last sync, kept for
+// a week after it last changed
+func (r *Runner) GetSearchIndexSyncProgress() (*SearchIndexSyncProgress, error) {
+	if r.cache == nil {
+		return nil, errors.New("cache not configured")
+	}
+	var progress SearchIndexSyncProgress
+	if err := r.cache.Get(searchIndexSyncProgressKey, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+func (r *Runner) saveSyncProgress(progress *SearchIndexSyncProgress) {
+	if r.cache == nil {
+		return
+	}
+	if err := r.cache.Set(searchIndexSyncProgressKey, progress, searchIndexSyncProgressTTL); err != nil && r.log != nil {
+		r.log.LogError(err, map[string]interface{}{"operation": "save_search_index_sync_progress"})
+	}
+}
+
+// RunSearchIndexSync runs SyncSearchIndex and logs the outcome
+func (r *Runner) RunSearchIndexSync(ctx context.Context) {
+	start := time.Now()
+	progress, err := r.SyncSearchIndex(ctx)
+	if r.log == nil {
+		return
+	}
+	switch {
+	case errors.Is(err, ErrSyncRunning):
+		r.log.Info("Search index sync skipped; another instance is running it")
+	case err != nil:
+		r.log.LogError(err, map[string]interface{}{"operation": "sync_search_index"})
+	default:
+		r.log.Info("Search index synced", map[string]interface{}{
+			"processed": progress.Processed,
+			"duration":  time.Since(start).String(),
+		})
+	}
+}
+
+// StartSearchIndexSync runs the sync whenever schedule fires until ctx is
+// done
+func (r *Runner) StartSearchIndexSync(ctx context.Context, schedule *scheduler.Schedule) {
+	scheduler.StartCron(ctx, schedule, r.RunSearchIndexSync)
+}
@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"strings"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+// LevelRequest changes the log level
+type LevelRequest struct {
+	Level string `json:"level" example:"DEBUG"`
+}
+
+// LevelResponse reports the current log level
+type LevelResponse struct {
+	Level string `json:"level" example:"INFO"`
+}
+
+// GetLevelHandler godoc
+// @Summary      Get the log level
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} LevelResponse
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/logger/level [get]
+func GetLevelHandler(l *Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(LevelResponse{Level: l.Level().String()})
+	}
+}
+
+// SetLevelHandler godoc
+// @Summary      Change the log level
+// @Description  Takes effect immediately for all subsequent log calls. Not persisted across restarts.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body LevelRequest true "DEBUG, INFO, WARN, ERROR or FATAL"
+// @Success      200  {object} LevelResponse
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/logger/level [put]
+func SetLevelHandler(l *Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req LevelRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierrors.ErrInvalidRequestBody
+		}
+
+		level, err := ParseLevel(req.Level)
+		if err != nil {
+			return apierrors.NewValidationError(apierrors.FieldError{
+				Field:   "level",
+				Tag:     "oneof",
+				Message: "must be one of " + strings.Join(Levels, ", "),
+			})
+		}
+
+		previous := l.Level()
+		l.SetLevel(level)
+		if previous != level {
+			metrics.RecordLogLevelChange(previous.String(), level.String())
+			l.Warn("Log level changed", map[string]interface{}{
+				"from": previous.String(),
+				"to":   level.String(),
+			})
+		}
+		return c.JSON(LevelResponse{Level: level.String()})
+	}
+}
+
+// GetConfigHandler godoc
+// @Summary      Get the logger settings
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} Config
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/logger/config [get]
+func GetConfigHandler(l *Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(l.Config())
+	}
+}
@@ -1,11 +1,15 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,10 +40,34 @@ func (l LogLevel) String() string {
 	}
 }
 
+// ParseLevel converts a level name such as "DEBUG" or "warn" to a LogLevel
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARN":
+		return WARN, nil
+	case "ERROR":
+		return ERROR, nil
+	case "FATAL":
+		return FATAL, nil
+	}
+	return INFO, fmt.Errorf("unknown log level %q", name)
+}
+
+// Levels lists the level names accepted by ParseLevel
+var Levels = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
 type Logger struct {
-	level      LogLevel
-	output     *os.File
+	// level is read on every log call and may be changed at runtime
+	level      atomic.Int32
+	output     io.Writer
 	jsonFormat bool
+	loki       *LokiWriter
+	// sampler is nil unless DEBUG and INFO messages are sampled
+	sampler atomic.Pointer[sampler]
 }
 
 type LogEntry struct {
@@ -49,36 +77,58 @@ type LogEntry struct {
 	Data      map[string]interface{} `json:"data,omitempty"`
 	File      string                 `json:"file,omitempty"`
 	Line      int                    `json:"line,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	SpanID    string                 `json:"span_id,omitempty"`
 }
 
 func NewLogger() *Logger {
 	level := INFO
 	if envLevel := os.Getenv("LOG_LEVEL"); envLevel != "" {
-		switch envLevel {
-		case "DEBUG":
-			level = DEBUG
-		case "INFO":
-			level = INFO
-		case "WARN":
-			level = WARN
-		case "ERROR":
-			level = ERROR
-		case "FATAL":
-			level = FATAL
+		if parsed, err := ParseLevel(envLevel); err == nil {
+			level = parsed
 		}
 	}
 
 	jsonFormat := os.Getenv("LOG_FORMAT") == "json"
 
-	return &Logger{
-		level:      level,
+	l := &Logger{
 		output:     os.Stdout,
 		jsonFormat: jsonFormat,
 	}
+	l.SetLevel(level)
+
+	if sampling, err := SamplingConfigFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: ignoring log sampling:", err)
+	} else {
+		l.SetSampling(sampling)
+	}
+
+	if os.Getenv("LOG_LOKI_ENABLED") == "true" {
+		if config := LokiConfigFromEnv(); config.Endpoint != "" {
+			l.loki = NewLokiWriter(config)
+			l.output = io.MultiWriter(os.Stdout, l.loki)
+		} else {
+			fmt.Fprintln(os.Stderr, "Warning: LOG_LOKI_ENABLED is set but LOKI_ENDPOINT is empty")
+		}
+	}
+	return l
+}
+
+// Close stops sampling and flushes log lines still queued for Loki, giving
+// up when ctx is done
+func (l *Logger) Close(ctx context.Context) error {
+	l.SetSampling(SamplingConfig{})
+	if l.loki == nil {
+		return nil
+	}
+	return l.loki.Close(ctx)
 }
 
 func (l *Logger) logWithLevel(level LogLevel, message string, data map[string]interface{}) {
-	if level < l.level {
+	if level < l.Level() {
+		return
+	}
+	if s := l.sampler.Load(); s != nil && !s.allow(level, message) {
 		return
 	}
 
@@ -98,6 +148,7 @@ func (l *Logger) logWithLevel(level LogLevel, message string, data map[string]in
 	}
 
 	if l.jsonFormat {
+		entry.TraceID, entry.SpanID, entry.Data = splitTrace(data)
 		jsonData, _ := json.Marshal(entry)
 		fmt.Fprintln(l.output, string(jsonData))
 	} else {
@@ -119,6 +170,27 @@ func (l *Logger) logWithLevel(level LogLevel, message string, data map[string]in
 	}
 }
 
+// splitTrace moves the trace_id and span_id fields out of data so JSON
+// entries carry them at the top level, where log pipelines look for them
+func splitTrace(data map[string]interface{}) (traceID, spanID string, rest map[string]interface{}) {
+	traceID, _ = data["trace_id"].(string)
+	spanID, _ = data["span_id"].(string)
+	if traceID == "" && spanID == "" {
+		return "", "", data
+	}
+
+	rest = make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k != "trace_id" && k != "span_id" {
+			rest[k] = v
+		}
+	}
+	if len(rest) == 0 {
+		rest = nil
+	}
+	return traceID, spanID, rest
+}
+
 func (l *Logger) Debug(message string, data ...map[string]interface{}) {
 	var logData map[string]interface{}
 	if len(data) > 0 {
@@ -167,8 +239,11 @@ func (l *Logger) LogError(err error, context map[string]interface{}) {
 	l.logWithLevel(ERROR, "Error occurred", context)
 }
 
-func (l *Logger) LogRequest(method, path, ip, userAgent string, status int, duration time.Duration) {
-	l.logWithLevel(INFO, "HTTP Request", map[string]interface{}{
+// LogRequest logs a completed HTTP request. Extra fields, such as the
+// trace_id and span_id from middleware.TraceFields or the baggage from
+// middleware.BaggageFields, are added to the entry.
+func (l *Logger) LogRequest(method, path, ip, userAgent string, status int, duration time.Duration, fields ...map[string]interface{}) {
+	data := map[string]interface{}{
 		"method":     method,
 		"path":       path,
 		"ip":         ip,
@@ -176,7 +251,13 @@ func (l *Logger) LogRequest(method, path, ip, userAgent string, status int, dura
 		"status":     status,
 		"duration":   duration.String(),
 		"duration_ms": duration.Milliseconds(),
-	})
+	}
+	for _, extra := range fields {
+		for k, v := range extra {
+			data[k] = v
+		}
+	}
+	l.logWithLevel(INFO, "HTTP Request", data)
 }
 
 func (l *Logger) LogDatabase(operation, table string, duration time.Duration, rowsAffected int64) {
@@ -241,14 +322,66 @@ func (l *Logger) LogShutdown(reason string) {
 	})
 }
 
+// SetLevel changes the minimum level logged. It is safe to call while
+// other goroutines are logging.
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.level.Store(int32(level))
 }
 
-func (l *Logger) SetOutput(output *os.File) {
+// Level returns the minimum level logged
+func (l *Logger) Level() LogLevel {
+	return LogLevel(l.level.Load())
+}
+
+func (l *Logger) SetOutput(output io.Writer) {
 	l.output = output
 }
 
+// Config describes the logger's current settings
+type Config struct {
+	Level       string `json:"level"`
+	Format      string `json:"format"`
+	JSONEnabled bool   `json:"json_enabled"`
+	Output      string `json:"output"`
+	// Sampling is only set while DEBUG and INFO messages are sampled
+	Sampling *SamplingConfig `json:"sampling,omitempty"`
+}
+
+// Config returns the logger's current settings
+func (l *Logger) Config() Config {
+	format := "text"
+	if l.jsonFormat {
+		format = "json"
+	}
+	output := outputName(l.output)
+	if l.loki != nil {
+		output = "stdout,loki"
+	}
+	config := Config{
+		Level:       l.Level().String(),
+		Format:      format,
+		JSONEnabled: l.jsonFormat,
+		Output:      output,
+	}
+	if sampling := l.Sampling(); sampling != (SamplingConfig{}) {
+		config.Sampling = &sampling
+	}
+	return config
+}
+
+func outputName(w io.Writer) string {
+	switch w {
+	case os.Stdout:
+		return "stdout"
+	case os.Stderr:
+		return "stderr"
+	}
+	if f, ok := w.(*os.File); ok {
+		return f.Name()
+	}
+	return fmt.Sprintf("%T", w)
+}
+
 func (l *Logger) SetJSONFormat(enabled bool) {
 	l.jsonFormat = enabled
 }
@@ -396,11 +529,11 @@ func ErrorWithData(message string, data map[string]interface{}) {
 }
 
 // Global specialized logging functions
-func LogRequest(method, path, ip, userAgent string, status int, duration time.Duration) {
+func LogRequest(method, path, ip, userAgent string, status int, duration time.Duration, fields ...map[string]interface{}) {
 	if globalLogger == nil {
 		globalLogger = NewLogger()
 	}
-	globalLogger.LogRequest(method, path, ip, userAgent, status, duration)
+	globalLogger.LogRequest(method, path, ip, userAgent, status, duration, fields...)
 }
 
 func LogDatabase(operation, table string, duration time.Duration, rowsAffected int64) {
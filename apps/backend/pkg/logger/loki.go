@@ -0,0 +1,269 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiConfig configures a LokiWriter
+type LokiConfig struct {
+	// Endpoint is the Loki base URL, e.g. http://loki:3100. The push path is
+	// appended unless already present.
+	Endpoint      string
+	BatchSize     int
+	FlushInterval time.Duration
+	// Labels are added to every stream alongside the entry's level
+	Labels map[string]string
+	Client *http.Client
+}
+
+// LokiConfigFromEnv reads LOKI_ENDPOINT, LOKI_BATCH_SIZE (default 100) and
+// LOKI_FLUSH_INTERVAL_MS (default 5000)
+func LokiConfigFromEnv() LokiConfig {
+	config := LokiConfig{
+		Endpoint:      os.Getenv("LOKI_ENDPOINT"),
+		BatchSize:     100,
+		FlushInterval: 5 * time.Second,
+		Labels:        map[string]string{"app": "gobooklibrary"},
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOKI_BATCH_SIZE")); err == nil && n > 0 {
+		config.BatchSize = n
+	}
+	if ms, err := strconv.Atoi(os.Getenv("LOKI_FLUSH_INTERVAL_MS")); err == nil && ms > 0 {
+		config.FlushInterval = time.Duration(ms) * time.Millisecond
+	}
+	return config
+}
+
+type lokiEntry struct {
+	timestamp time.Time
+	level     string
+	line      string
+}
+
+// LokiWriter is an io.Writer that ships log lines to Loki's HTTP push API.
+// Writes never block: lines are queued on a buffered channel and pushed in
+// batches by a background goroutine, and dropped if the queue is full.
+type LokiWriter struct {
+	config  LokiConfig
+	url     string
+	entries chan lokiEntry
+	done    chan struct{}
+
+	// mu guards closed so Write never sends on the closed channel
+	mu     sync.RWMutex
+	closed bool
+
+	// ctx is cancelled when Close gives up waiting, aborting a push in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	dropped atomic.Int64
+}
+
+// NewLokiWriter starts a writer pushing to config.Endpoint
+func NewLokiWriter(config LokiConfig) *LokiWriter {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = exthttp.NewClient(10 * time.Second)
+	}
+
+	url := strings.TrimRight(config.Endpoint, "/")
+	if !strings.HasSuffix(url, lokiPushPath) {
+		url += lokiPushPath
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &LokiWriter{
+		config:  config,
+		url:     url,
+		entries: make(chan lokiEntry, config.BatchSize*10),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go w.run()
+	return w
+}
+
+// Write queues one formatted log line
+func (w *LokiWriter) Write(p []byte) (int, error) {
+	entry := lokiEntry{
+		timestamp: time.Now(),
+		level:     levelOf(p),
+		line:      strings.TrimRight(string(p), "\n"),
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, fmt.Errorf("loki writer closed")
+	}
+	select {
+	case w.entries <- entry:
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of lines discarded because the queue was full
+func (w *LokiWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Close pushes the queued lines and stops the writer, giving up when ctx
+// is done
+func (w *LokiWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		return ctx.Err()
+	}
+}
+
+func (w *LokiWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]lokiEntry, 0, w.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.push(batch); err != nil {
+			// Logging here would feed the error back into this writer
+			fmt.Fprintf(os.Stderr, "Warning: failed to push %d log lines to Loki: %v\n", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry, ok := <-w.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= w.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// push sends one request with a stream per level
+func (w *LokiWriter) push(batch []lokiEntry) error {
+	byLevel := map[string]*lokiStream{}
+	var levels []string
+	for _, entry := range batch {
+		stream, ok := byLevel[entry.level]
+		if !ok {
+			labels := map[string]string{"level": entry.level}
+			for k, v := range w.config.Labels {
+				labels[k] = v
+			}
+			stream = &lokiStream{Stream: labels}
+			byLevel[entry.level] = stream
+			levels = append(levels, entry.level)
+		}
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(entry.timestamp.UnixNano(), 10),
+			entry.line,
+		})
+	}
+	sort.Strings(levels)
+
+	var payload lokiPushRequest
+	for _, level := range levels {
+		payload.Streams = append(payload.Streams, *byLevel[level])
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("loki responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// levelOf extracts the level from a line formatted by Logger, either a
+// JSON entry or "[timestamp] LEVEL: message"
+func levelOf(line []byte) string {
+	if len(line) > 0 && line[0] == '{' {
+		var entry struct {
+			Level string `json:"level"`
+		}
+		if json.Unmarshal(line, &entry) == nil && entry.Level != "" {
+			return entry.Level
+		}
+		return INFO.String()
+	}
+
+	text := string(line)
+	if i := strings.Index(text, "] "); i >= 0 {
+		text = text[i+2:]
+		if j := strings.Index(text, ":"); j > 0 {
+			if level, err := ParseLevel(text[:j]); err == nil {
+				return level.String()
+			}
+		}
+	}
+	return INFO.String()
+}
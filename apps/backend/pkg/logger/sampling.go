@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingTick is how often sampling counts start over
+var SamplingTick = time.Second
+
+// samplingBuckets is the number of counters per level. Messages are hashed
+// onto them, so two messages may share a counter, as in zap.
+const samplingBuckets = 4096
+
+// SamplingConfig limits how often the same DEBUG or INFO message is logged:
+// the first Initial times each second, then every Thereafter-th time. With
+// Thereafter 0, the rest of the second is dropped. WARN and above are never
+// sampled.
+type SamplingConfig struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+// SamplingConfigFromEnv reads LOG_SAMPLING_INITIAL and
+// LOG_SAMPLING_THEREAFTER. Sampling is off, a zero config, when neither is
+// set.
+func SamplingConfigFromEnv() (SamplingConfig, error) {
+	var config SamplingConfig
+	for key, dest := range map[string]*int{
+		"LOG_SAMPLING_INITIAL":    &config.Initial,
+		"LOG_SAMPLING_THEREAFTER": &config.Thereafter,
+	} {
+		raw := os.Getenv(key)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return SamplingConfig{}, fmt.Errorf("%s must be a non-negative number, got %q", key, raw)
+		}
+		*dest = n
+	}
+	return config, nil
+}
+
+// sampler counts the DEBUG and INFO messages logged in the current tick
+type sampler struct {
+	config SamplingConfig
+	counts [INFO + 1][samplingBuckets]atomic.Int64
+	stop   chan struct{}
+}
+
+func newSampler(config SamplingConfig) *sampler {
+	s := &sampler{config: config, stop: make(chan struct{})}
+	go s.reset(SamplingTick)
+	return s
+}
+
+// reset zeroes the counts every tick until stopped
+func (s *sampler) reset(tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for level := range s.counts {
+				for i := range s.counts[level] {
+					s.counts[level][i].Store(0)
+				}
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// allow reports whether this occurrence of message should be logged
+func (s *sampler) allow(level LogLevel, message string) bool {
+	if level > INFO {
+		return true
+	}
+	n := s.counts[level][hashMessage(message)%samplingBuckets].Add(1)
+	initial := int64(s.config.Initial)
+	if n <= initial {
+		return true
+	}
+	thereafter := int64(s.config.Thereafter)
+	return thereafter > 0 && (n-initial)%thereafter == 0
+}
+
+// hashMessage is FNV-1a, without the allocation of hash/fnv
+func hashMessage(message string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(message); i++ {
+		hash ^= uint32(message[i])
+		hash *= 16777619
+	}
+	return hash
+}
+
+// SetSampling samples DEBUG and INFO messages by config from now on. A
+// zero config turns sampling off.
+func (l *Logger) SetSampling(config SamplingConfig) {
+	var s *sampler
+	if config != (SamplingConfig{}) {
+		s = newSampler(config)
+	}
+	if previous := l.sampler.Swap(s); previous != nil {
+		close(previous.stop)
+	}
+}
+
+// Sampling returns the current sampling config, zero when sampling is off
+func (l *Logger) Sampling() SamplingConfig {
+	if s := l.sampler.Load(); s != nil {
+		return s.config
+	}
+	return SamplingConfig{}
+}
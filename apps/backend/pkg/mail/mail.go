@@ -0,0 +1,129 @@
+// Package mail sends HTML email over SMTP
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotConfigured is returned by Send when SMTP_HOST isn't set
+var ErrNotConfigured = errors.New("SMTP is not configured")
+
+// Sender sends an HTML message to one or more recipients
+type Sender interface {
+	Send(to []string, subject, htmlBody string) error
+}
+
+// Config configures the SMTP server mail is sent through
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM. SMTP_FROM defaults to SMTP_USERNAME.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if raw := os.Getenv("SMTP_PORT"); raw != "" {
+		port, err := strconv.Atoi(raw)
+		if err != nil || port < 1 || port > 65535 {
+			return config, fmt.Errorf("SMTP_PORT must be a port number, got %q", raw)
+		}
+		config.Port = port
+	}
+	if config.From == "" {
+		config.From = config.Username
+	}
+	if config.Host != "" && config.From == "" {
+		return config, errors.New("SMTP_FROM or SMTP_USERNAME must be set when SMTP_HOST is")
+	}
+	return config, nil
+}
+
+// SMTPSender sends mail through an SMTP server, using STARTTLS when the
+// server offers it
+type SMTPSender struct {
+	config Config
+}
+
+// NewSMTPSender creates a Sender for config. Sending fails with
+// ErrNotConfigured if config has no host.
+func NewSMTPSender(config Config) *SMTPSender {
+	return &SMTPSender{config: config}
+}
+
+func (s *SMTPSender) Send(to []string, subject, htmlBody string) error {
+	if s.config.Host == "" {
+		return ErrNotConfigured
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	return smtp.SendMail(addr, auth, s.config.From, to, Message(s.config.From, to, subject, htmlBody))
+}
+
+// Message builds an RFC 5322 message with an HTML body
+func Message(from string, to []string, subject, htmlBody string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(htmlBody, "\n", "\r\n"))
+	return msg.Bytes()
+}
+
+// HealthChecker probes whether the SMTP server answers with its greeting
+type HealthChecker struct {
+	Config Config
+}
+
+func (h HealthChecker) Name() string {
+	return "smtp"
+}
+
+func (h HealthChecker) Check(ctx context.Context) error {
+	if h.Config.Host == "" {
+		return ErrNotConfigured
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(h.Config.Host, strconv.Itoa(h.Config.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// NewClient reads the 220 greeting
+	client, err := smtp.NewClient(conn, h.Config.Host)
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
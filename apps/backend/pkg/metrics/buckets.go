@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultDatabaseBuckets are the database_operation_duration_seconds buckets
+// used unless METRICS_HTTP_BUCKETS is set
+var DefaultDatabaseBuckets = []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// minBuckets is the fewest upper bounds METRICS_HTTP_BUCKETS may list
+const minBuckets = 3
+
+func newHTTPRequestDuration(buckets []float64) *prometheus.HistogramVec {
+	return promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests in seconds",
+			Buckets: buckets,
+		},
+		[]string{"method", "endpoint", "status_code"},
+	)
+}
+
+func newDatabaseOperationDuration(buckets []float64) *prometheus.HistogramVec {
+	return promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "database_operation_duration_seconds",
+			Help:    "Duration of database operations in seconds",
+			Buckets: buckets,
+		},
+		[]string{"operation", "table", "status"},
+	)
+}
+
+// ParseBuckets parses METRICS_HTTP_BUCKETS, comma-separated histogram upper
+// bounds in seconds, e.g. "0.005,0.01,0.05,0.1,0.5". There must be at least
+// three, in strictly ascending order.
+func ParseBuckets(raw string) ([]float64, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) < minBuckets {
+		return nil, fmt.Errorf("METRICS_HTTP_BUCKETS needs at least %d buckets, got %d", minBuckets, len(parts))
+	}
+
+	buckets := make([]float64, len(parts))
+	for i, part := range parts {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return nil, fmt.Errorf("METRICS_HTTP_BUCKETS: invalid bucket %q", part)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return nil, fmt.Errorf("METRICS_HTTP_BUCKETS must be strictly ascending, %v follows %v", bound, buckets[i-1])
+		}
+		buckets[i] = bound
+	}
+	return buckets, nil
+}
+
+// applyDurationBuckets recreates the duration histograms with the buckets
+// from METRICS_HTTP_BUCKETS, or with the defaults when it is unset or
+// invalid. Observations made so far are dropped.
+func applyDurationBuckets() error {
+	httpBuckets, databaseBuckets := prometheus.DefBuckets, DefaultDatabaseBuckets
+	var err error
+	if raw := os.Getenv("METRICS_HTTP_BUCKETS"); raw != "" {
+		var buckets []float64
+		if buckets, err = ParseBuckets(raw); err == nil {
+			httpBuckets, databaseBuckets = buckets, buckets
+		}
+	}
+
+	prometheus.Unregister(httpRequestDuration)
+	prometheus.Unregister(databaseOperationDuration)
+	httpRequestDuration = newHTTPRequestDuration(httpBuckets)
+	databaseOperationDuration = newDatabaseOperationDuration(databaseBuckets)
+	HTTPRequestDuration = httpRequestDuration
+	DatabaseQueryDuration = databaseOperationDuration
+	return err
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultGraphitePort is used when GRAPHITE_HOST has no port
+const DefaultGraphitePort = "2003"
+
+// graphiteDialTimeout bounds connecting to and writing to Graphite
+const graphiteDialTimeout = 10 * time.Second
+
+// validGraphitePrefix is what a prefix may contain; anything else could
+// break the line format
+var validGraphitePrefix = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// unsafeGraphiteNode matches characters that can't appear in one node of a
+// Graphite path. Dots would split the node and whitespace ends the path.
+var unsafeGraphiteNode = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// ErrInvalidGraphitePrefix is returned for prefixes that would break the
+// line format
+var ErrInvalidGraphitePrefix = errors.New("prefix may only contain letters, digits, '.', '_' and '-'")
+
+// CheckGraphitePrefix returns ErrInvalidGraphitePrefix unless prefix is safe
+// to prepend to metric names
+func CheckGraphitePrefix(prefix string) error {
+	if !validGraphitePrefix.MatchString(prefix) {
+		return ErrInvalidGraphitePrefix
+	}
+	return nil
+}
+
+// graphiteNode makes a label value usable as a path node
+func graphiteNode(value string) string {
+	switch value {
+	case "":
+		return "none"
+	case "+Inf":
+		return "inf"
+	}
+	return unsafeGraphiteNode.ReplaceAllString(value, "_")
+}
+
+// graphitePath is prefix, name and the metric's label values in label name
+// order, joined by dots
+func graphitePath(prefix, name string, labels []*dto.LabelPair, extra ...string) string {
+	nodes := []string{prefix + name}
+	for _, label := range labels {
+		nodes = append(nodes, graphiteNode(label.GetValue()))
+	}
+	for _, value := range extra {
+		nodes = append(nodes, graphiteNode(value))
+	}
+	return strings.Join(nodes, ".")
+}
+
+// WriteGraphite writes every metric gathered by g in Graphite's plaintext
+// format, "<path> <value> <timestamp>" per line. Histograms are written as
+// _bucket.<le>, _sum and _count, summaries as quantiles, _sum and _count.
+// Values that aren't finite are left out; Graphite can't store them.
+func WriteGraphite(w io.Writer, g prometheus.Gatherer, prefix string, now time.Time) error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	write := func(path string, value float64) {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		fmt.Fprintf(out, "%s %s %s\n", path, strconv.FormatFloat(value, 'g', -1, 64), timestamp)
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			labels := m.GetLabel()
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				write(graphitePath(prefix, name, labels), m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				write(graphitePath(prefix, name, labels), m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				write(graphitePath(prefix, name, labels), m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, bucket := range h.GetBucket() {
+					le := strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)
+					write(graphitePath(prefix, name+"_bucket", labels, le), float64(bucket.GetCumulativeCount()))
+				}
+				write(graphitePath(prefix, name+"_bucket", labels, "+Inf"), float64(h.GetSampleCount()))
+				write(graphitePath(prefix, name+"_sum", labels), h.GetSampleSum())
+				write(graphitePath(prefix, name+"_count", labels), float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					quantile := strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+					write(graphitePath(prefix, name, labels, quantile), q.GetValue())
+				}
+				write(graphitePath(prefix, name+"_sum", labels), s.GetSampleSum())
+				write(graphitePath(prefix, name+"_count", labels), float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// GraphiteHandler godoc
+// @Summary      Metrics in Graphite format
+// @Description  Every Prometheus metric in Graphite's plaintext format, one "<path> <value> <timestamp>" line per series. Label values become path nodes in label name order.
+// @Tags         admin
+// @Produce      plain
+// @Security     Bearer
+// @Param        prefix query string false "Prepended to every metric name, e.g. gobooklibrary."
+// @Success      200 {string} string
+// @Failure      400 {object} apierrors.APIError
+// @Failure      401 {object} apierrors.APIError
+// @Failure      403 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/metrics/graphite [get]
+func GraphiteHandler(g prometheus.Gatherer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		prefix := c.Query("prefix")
+		if err := CheckGraphitePrefix(prefix); err != nil {
+			return apierrors.ErrInvalidQuery.WithMessage(err.Error())
+		}
+
+		var buf bytes.Buffer
+		if err := WriteGraphite(&buf, g, prefix, time.Now()); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.Send(buf.Bytes())
+	}
+}
+
+// GraphiteAddress adds DefaultGraphitePort to a GRAPHITE_HOST without one
+func GraphiteAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, DefaultGraphitePort)
+}
+
+// PushGraphite sends every metric gathered by g to the Graphite plaintext
+// listener at addr
+func PushGraphite(ctx context.Context, addr string, g prometheus.Gatherer, prefix string) error {
+	dialer := net.Dialer{Timeout: graphiteDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(graphiteDialTimeout))
+	return WriteGraphite(conn, g, prefix, time.Now())
+}
+
+// StartGraphitePusher pushes metrics to addr every interval until ctx is
+// done, calling onError when a push fails
+func StartGraphitePusher(ctx context.Context, addr string, interval time.Duration, prefix string, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := PushGraphite(ctx, addr, prometheus.DefaultGatherer, prefix); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
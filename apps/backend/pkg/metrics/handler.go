@@ -0,0 +1,24 @@
+package metrics
+
+import "github.com/gofiber/fiber/v2"
+
+// SLOResponse lists the latency budget of every endpoint with a target
+type SLOResponse struct {
+	Budgets   []SLOBudget `json:"budgets"`
+	LowBudget float64     `json:"low_budget_threshold" example:"0.1"`
+}
+
+// GetSLOHandler godoc
+// @Summary      Get the latency SLO budgets
+// @Description  For each endpoint with a latency target, the share of requests since startup that were not slower than the target.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} SLOResponse
+// @Failure      429  {object} errors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/slo [get]
+func GetSLOHandler(t *SLOTracker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(SLOResponse{Budgets: t.Budgets(), LowBudget: SLOLowBudget})
+	}
+}
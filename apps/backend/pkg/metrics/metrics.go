@@ -1,7 +1,11 @@
 package metrics
 
 import (
+	"database/sql"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,17 +18,10 @@ var (
 			Name: "http_requests_total",
 			Help: "Total number of HTTP requests",
 		},
-		[]string{"method", "endpoint", "status_code"},
+		[]string{"method", "endpoint", "status_code", "country"},
 	)
 
-	httpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "http_request_duration_seconds",
-			Help: "Duration of HTTP requests in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint", "status_code"},
-	)
+	httpRequestDuration = newHTTPRequestDuration(prometheus.DefBuckets)
 
 	// Database Metrics
 	databaseOperationsTotal = promauto.NewCounterVec(
@@ -35,14 +32,7 @@ var (
 		[]string{"operation", "table", "status"},
 	)
 
-	databaseOperationDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "database_operation_duration_seconds",
-			Help: "Duration of database operations in seconds",
-			Buckets: []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
-		},
-		[]string{"operation", "table", "status"},
-	)
+	databaseOperationDuration = newDatabaseOperationDuration(DefaultDatabaseBuckets)
 
 	cacheOperationsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -111,19 +101,179 @@ var (
 			Help: "Number of active goroutines",
 		},
 	)
+
+	dbPoolConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_pool_connections",
+			Help: "Database pool connections by state (open, in_use, idle, max_open)",
+		},
+		[]string{"state"},
+	)
+
+	dbPoolWaitCount = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_pool_wait_count",
+			Help: "Total number of times a query waited for a free database connection",
+		},
+	)
+
+	dbPoolWaitDuration = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_pool_wait_duration_seconds",
+			Help: "Total time spent waiting for a free database connection",
+		},
+	)
+
+	dbReconnectAttemptsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_reconnect_attempts_total",
+			Help: "Total number of attempts to reconnect to the database after it was lost",
+		},
+		[]string{"result"},
+	)
+
+	redisReconnectsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "redis_reconnects_total",
+			Help: "Total number of times the Redis client was re-created after being closed",
+		},
+	)
+
+	logLevelChangesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "log_level_changes_total",
+			Help: "Total number of runtime log level changes",
+		},
+		[]string{"from", "to"},
+	)
+
+	deprecatedAPIRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "deprecated_api_requests_total",
+			Help: "Total number of requests to deprecated endpoints",
+		},
+		[]string{"endpoint"},
+	)
+
+	webhookDLQEntriesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "webhook_dlq_entries_total",
+			Help: "Total number of webhook deliveries moved to the dead letter queue after their last retry failed",
+		},
+	)
+
+	reindexBooksProcessedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "reindex_books_processed_total",
+			Help: "Total number of books whose search vector was rebuilt by a reindex",
+		},
+	)
+
+	reindexDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "reindex_duration_seconds",
+			Help:    "Duration of search vector reindex jobs in seconds",
+			Buckets: []float64{1, 5, 15, 60, 300, 900, 3600},
+		},
+		[]string{"status"},
+	)
+
+	activeUsers24h = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "active_users_24h",
+			Help: "Number of users who logged in within the last 24 hours",
+		},
+	)
+
+	activeUsers7d = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "active_users_7d",
+			Help: "Number of users who logged in within the last 7 days",
+		},
+	)
+
+	activeUsers30d = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "active_users_30d",
+			Help: "Number of users who logged in within the last 30 days",
+		},
+	)
+
+	booksByStatus = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "books_by_status",
+			Help: "Number of books in each availability status",
+		},
+		[]string{"status"},
+	)
+
+	booksTopRated = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "books_top_rated",
+			Help: "Average rating of the best rated books of each genre, by rank",
+		},
+		[]string{"genre", "rank"},
+	)
+
+	trendingBooksTotal = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "trending_books_total",
+			Help: "Number of books whose views are rising faster than TRENDING_VELOCITY_THRESHOLD",
+		},
+	)
+
+	goroutineLeakDetected = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "goroutine_leak_detected",
+			Help: "1 while the goroutine count is above GOROUTINE_LEAK_THRESHOLD, else 0",
+		},
+	)
+
+	cacheLargestKeyBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cache_largest_key_bytes",
+			Help: "Size in bytes of the largest Redis string value found by the last cache analysis",
+		},
+	)
+
+	externalHTTPRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "external_http_requests_total",
+			Help: "Total number of outbound HTTP requests to external services, status_code is \"error\" when no response arrived",
+		},
+		[]string{"host", "status_code"},
+	)
+
+	externalHTTPRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "external_http_request_duration_seconds",
+			Help:    "Duration of outbound HTTP requests to external services in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host"},
+	)
 )
 
+// cacheHits and cacheMisses are only accessed atomically, since
+// ResetCacheMetrics can run while requests record cache operations
 var (
 	cacheHits   int64
 	cacheMisses int64
 )
 
-// RecordHTTPRequest records an HTTP request metric
-func RecordHTTPRequest(method, endpoint, statusCode string, duration time.Duration) {
-	httpRequestsTotal.WithLabelValues(method, endpoint, statusCode).Inc()
+// RecordHTTPRequest records an HTTP request metric. Only the request count is
+// broken down by country; the duration histogram would multiply its buckets.
+func RecordHTTPRequest(method, endpoint, statusCode, country string, duration time.Duration) {
+	httpRequestsTotal.WithLabelValues(method, endpoint, statusCode, country).Inc()
 	httpRequestDuration.WithLabelValues(method, endpoint, statusCode).Observe(duration.Seconds())
 }
 
+// RecordExternalHTTPRequest records an outbound HTTP request metric
+func RecordExternalHTTPRequest(host, statusCode string, duration time.Duration) {
+	externalHTTPRequestsTotal.WithLabelValues(host, statusCode).Inc()
+	externalHTTPRequestDuration.WithLabelValues(host).Observe(duration.Seconds())
+}
+
 // RecordDatabaseQuery records a database operation metric
 func RecordDatabaseQuery(operation, table, status string, duration time.Duration) {
 	databaseOperationsTotal.WithLabelValues(operation, table, status).Inc()
@@ -137,15 +287,16 @@ func RecordCacheOperation(operation, status string) {
 	// Update hit ratio for get operations
 	if operation == "get" {
 		if status == "hit" {
-			cacheHits++
+			atomic.AddInt64(&cacheHits, 1)
 		} else if status == "miss" {
-			cacheMisses++
+			atomic.AddInt64(&cacheMisses, 1)
 		}
 
 		// Calculate and update hit ratio
-		total := cacheHits + cacheMisses
+		hits, misses := atomic.LoadInt64(&cacheHits), atomic.LoadInt64(&cacheMisses)
+		total := hits + misses
 		if total > 0 {
-			ratio := float64(cacheHits) / float64(total)
+			ratio := float64(hits) / float64(total)
 			cacheHitRatio.WithLabelValues("overall").Set(ratio)
 		}
 	}
@@ -176,6 +327,37 @@ func SetUsersTotal(count float64) {
 	usersTotal.Set(count)
 }
 
+// SetActiveUsers sets the number of users who logged in within the last
+// 24 hours, 7 days and 30 days
+func SetActiveUsers(last24h, last7d, last30d int64) {
+	activeUsers24h.Set(float64(last24h))
+	activeUsers7d.Set(float64(last7d))
+	activeUsers30d.Set(float64(last30d))
+}
+
+// SetBooksByStatus sets the number of books per availability status
+func SetBooksByStatus(counts map[string]int64) {
+	for status, count := range counts {
+		booksByStatus.WithLabelValues(status).Set(float64(count))
+	}
+}
+
+// SetTopRated replaces the average ratings of the best rated books, by genre
+// and rank. Books sharing a rank share a series.
+func SetTopRated(top map[string]map[int64]float64) {
+	booksTopRated.Reset()
+	for genre, ranks := range top {
+		for rank, rating := range ranks {
+			booksTopRated.WithLabelValues(genre, strconv.FormatInt(rank, 10)).Set(rating)
+		}
+	}
+}
+
+// SetTrendingBooks sets the number of trending books
+func SetTrendingBooks(count int) {
+	trendingBooksTotal.Set(float64(count))
+}
+
 // SetActiveConnections sets the number of active connections
 func SetActiveConnections(count float64) {
 	activeConnections.Set(count)
@@ -186,6 +368,71 @@ func SetActiveGoroutines(count float64) {
 	goroutinesActive.Set(count)
 }
 
+// SetGoroutineLeakDetected flags a suspected goroutine leak
+func SetGoroutineLeakDetected(detected bool) {
+	if detected {
+		goroutineLeakDetected.Set(1)
+	} else {
+		goroutineLeakDetected.Set(0)
+	}
+}
+
+// SetCacheLargestKeyBytes sets the size of the largest cache value
+func SetCacheLargestKeyBytes(bytes int64) {
+	cacheLargestKeyBytes.Set(float64(bytes))
+}
+
+// SetDBPoolStats publishes database connection pool statistics
+func SetDBPoolStats(stats sql.DBStats) {
+	dbPoolConnections.WithLabelValues("open").Set(float64(stats.OpenConnections))
+	dbPoolConnections.WithLabelValues("in_use").Set(float64(stats.InUse))
+	dbPoolConnections.WithLabelValues("idle").Set(float64(stats.Idle))
+	dbPoolConnections.WithLabelValues("max_open").Set(float64(stats.MaxOpenConnections))
+	dbPoolWaitCount.Set(float64(stats.WaitCount))
+	dbPoolWaitDuration.Set(stats.WaitDuration.Seconds())
+}
+
+// RecordDBReconnectAttempt records one attempt to reconnect to the database
+func RecordDBReconnectAttempt(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	dbReconnectAttemptsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordRedisReconnect records that the Redis client was re-created
+func RecordRedisReconnect() {
+	redisReconnectsTotal.Inc()
+}
+
+// RecordLogLevelChange records a runtime change of the log level
+func RecordLogLevelChange(from, to string) {
+	logLevelChangesTotal.WithLabelValues(from, to).Inc()
+}
+
+// RecordDeprecatedAPIUse records a request to a deprecated endpoint, the
+// method and route pattern, e.g. "GET /books/:id"
+func RecordDeprecatedAPIUse(endpoint string) {
+	deprecatedAPIRequestsTotal.WithLabelValues(endpoint).Inc()
+}
+
+// RecordWebhookDLQEntry records a webhook delivery moved to the dead
+// letter queue
+func RecordWebhookDLQEntry() {
+	webhookDLQEntriesTotal.Inc()
+}
+
+// RecordReindexProcessed records books whose search vector was rebuilt
+func RecordReindexProcessed(count int64) {
+	reindexBooksProcessedTotal.Add(float64(count))
+}
+
+// RecordReindexDuration records a finished reindex job
+func RecordReindexDuration(status string, duration time.Duration) {
+	reindexDuration.WithLabelValues(status).Observe(duration.Seconds())
+}
+
 // GetMetricsRegistry returns the Prometheus registry for custom metrics
 func GetMetricsRegistry() *prometheus.Registry {
 	return prometheus.DefaultRegisterer.(*prometheus.Registry)
@@ -193,6 +440,7 @@ func GetMetricsRegistry() *prometheus.Registry {
 
 // MetricsCollector provides methods to collect application metrics
 type MetricsCollector struct {
+	mu        sync.RWMutex
 	startTime time.Time
 }
 
@@ -211,9 +459,70 @@ func (mc *MetricsCollector) CollectSystemMetrics() {
 
 // GetUptime returns the application uptime
 func (mc *MetricsCollector) GetUptime() time.Duration {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
 	return time.Since(mc.startTime)
 }
 
+// Reset restarts the uptime from now
+func (mc *MetricsCollector) Reset() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.startTime = time.Now()
+}
+
+// The methods below forward to the package functions so that handlers can
+// take the collector as a dependency. A nil collector records nothing.
+
+// RecordDatabaseQuery records a database query, see RecordDatabaseQuery
+func (mc *MetricsCollector) RecordDatabaseQuery(operation, table, status string, duration time.Duration) {
+	if mc != nil {
+		RecordDatabaseQuery(operation, table, status, duration)
+	}
+}
+
+// RecordCacheOperation records a cache operation, see RecordCacheOperation
+func (mc *MetricsCollector) RecordCacheOperation(operation, status string) {
+	if mc != nil {
+		RecordCacheOperation(operation, status)
+	}
+}
+
+// SetActiveUsers publishes active user counts, see SetActiveUsers
+func (mc *MetricsCollector) SetActiveUsers(last24h, last7d, last30d int64) {
+	if mc != nil {
+		SetActiveUsers(last24h, last7d, last30d)
+	}
+}
+
+// SetBooksByStatus publishes book counts by status, see SetBooksByStatus
+func (mc *MetricsCollector) SetBooksByStatus(counts map[string]int64) {
+	if mc != nil {
+		SetBooksByStatus(counts)
+	}
+}
+
+// SetTopRated publishes leaderboard ratings, see SetTopRated
+func (mc *MetricsCollector) SetTopRated(top map[string]map[int64]float64) {
+	if mc != nil {
+		SetTopRated(top)
+	}
+}
+
+// RecordReindexProcessed records reindexed books, see RecordReindexProcessed
+func (mc *MetricsCollector) RecordReindexProcessed(count int64) {
+	if mc != nil {
+		RecordReindexProcessed(count)
+	}
+}
+
+// RecordReindexDuration records a finished reindex, see RecordReindexDuration
+func (mc *MetricsCollector) RecordReindexDuration(status string, duration time.Duration) {
+	if mc != nil {
+		RecordReindexDuration(status, duration)
+	}
+}
+
 // CacheMetrics represents cache-specific metrics
 type CacheMetrics struct {
 	Hits   int64   `json:"hits"`
@@ -224,15 +533,16 @@ type CacheMetrics struct {
 
 // GetCacheMetrics returns current cache metrics
 func GetCacheMetrics() *CacheMetrics {
-	total := cacheHits + cacheMisses
+	hits, misses := atomic.LoadInt64(&cacheHits), atomic.LoadInt64(&cacheMisses)
+	total := hits + misses
 	var ratio float64
 	if total > 0 {
-		ratio = float64(cacheHits) / float64(total)
+		ratio = float64(hits) / float64(total)
 	}
 
 	return &CacheMetrics{
-		Hits:   cacheHits,
-		Misses: cacheMisses,
+		Hits:   hits,
+		Misses: misses,
 		Ratio:  ratio,
 		Total:  total,
 	}
@@ -240,8 +550,8 @@ func GetCacheMetrics() *CacheMetrics {
 
 // ResetCacheMetrics resets cache hit/miss counters
 func ResetCacheMetrics() {
-	cacheHits = 0
-	cacheMisses = 0
+	atomic.StoreInt64(&cacheHits, 0)
+	atomic.StoreInt64(&cacheMisses, 0)
 	cacheHitRatio.WithLabelValues("overall").Set(0)
 }
 
@@ -315,14 +625,28 @@ func getLabelValues(labels map[string]string) []string {
 // InitMetrics initializes metrics collection
 var metricsInitialized bool
 
-func InitMetrics() {
+// InitMetrics applies METRICS_HTTP_BUCKETS to the request and database
+// duration histograms. When it is invalid, the default buckets are kept and
+// the error returned. Call it before serving requests.
+func InitMetrics() error {
+	bucketsErr := applyDurationBuckets()
 	if metricsInitialized {
-		return
+		return bucketsErr
 	}
-	// Initialize any startup metrics here
-	prometheus.MustRegister(prometheus.NewGoCollector())
-	prometheus.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	// Initialize any startup metrics here. The default registry already
+	// collects these unless it was replaced.
+	registerOnce(prometheus.NewGoCollector())
+	registerOnce(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 	metricsInitialized = true
+	return bucketsErr
+}
+
+func registerOnce(c prometheus.Collector) {
+	if err := prometheus.Register(c); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
 }
 
 // Global exported variables for testing
@@ -338,6 +662,6 @@ var (
 )
 
 // Init initializes the metrics
-func Init() {
-	InitMetrics()
+func Init() error {
+	return InitMetrics()
 }
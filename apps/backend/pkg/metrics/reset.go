@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// lastReset lets dashboards mark resets. Prometheus counters can only
+// increase, so they are not reset; graphs of them can be read relative to
+// this timestamp instead.
+var lastReset = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "metrics_last_reset_timestamp_unix",
+		Help: "Unix time of the last metrics reset, 0 if the metrics were never reset",
+	},
+)
+
+// ResetAll resets the in-memory metrics: the cache hit and miss counts, the
+// SLO counts and the collector's uptime. It returns the time of the reset.
+func ResetAll(collector *MetricsCollector) time.Time {
+	now := time.Now()
+	ResetCacheMetrics()
+	SLO.Reset()
+	SLO.Update()
+	if collector != nil {
+		collector.Reset()
+	}
+	lastReset.Set(float64(now.Unix()))
+	return now
+}
+
+// ResetRequest confirms a metrics reset
+type ResetRequest struct {
+	Confirm bool `json:"confirm" example:"true"`
+}
+
+// ResetResponse is the time of a metrics reset
+type ResetResponse struct {
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// ResetHandler godoc
+// @Summary      Reset the in-memory metrics (admin only)
+// @Description  Zeroes the cache hit and miss counts and the SLO counts, and restarts the uptime. Prometheus counters keep counting; metrics_last_reset_timestamp_unix records the reset instead. The body must be {"confirm": true}.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body ResetRequest true "Confirmation"
+// @Success      200  {object} ResetResponse
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      428  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/metrics/reset [post]
+func ResetHandler(collector *MetricsCollector, onReset func(c *fiber.Ctx)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ResetRequest
+		if err := c.BodyParser(&req); err != nil {
+			return apierrors.ErrInvalidRequestBody
+		}
+		if !req.Confirm {
+			return apierrors.ErrConfirmationRequired.WithMessage(`Resetting metrics can't be undone; send {"confirm": true} to confirm`)
+		}
+
+		resetAt := ResetAll(collector)
+		if onReset != nil {
+			onReset(c)
+		}
+		return c.JSON(ResetResponse{ResetAt: resetAt})
+	}
+}
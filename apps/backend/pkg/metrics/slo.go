@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// SLOLowBudget is the remaining budget below which an endpoint is reported
+// as running out
+const SLOLowBudget = 0.10
+
+// DefaultSLOTargets are the latency targets used unless SLO_TARGETS is set.
+// Endpoints are the method and route pattern, e.g. "GET /books/:id".
+var DefaultSLOTargets = map[string]time.Duration{
+	"GET /books":     200 * time.Millisecond,
+	"GET /books/:id": 50 * time.Millisecond,
+	"POST /books":    500 * time.Millisecond,
+}
+
+var sloBudgetRemaining = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "slo_budget_remaining",
+		Help: "Share of requests that met the endpoint's latency target (1 - slow/total)",
+	},
+	[]string{"endpoint"},
+)
+
+// SLO tracks the latency targets recorded by RecordSLO
+var SLO = NewSLOTracker(DefaultSLOTargets)
+
+// SLOBudget is the latency budget of one endpoint
+type SLOBudget struct {
+	Endpoint        string  `json:"endpoint" example:"GET /books"`
+	TargetMs        int64   `json:"target_ms" example:"200"`
+	Total           int64   `json:"total_requests"`
+	Slow            int64   `json:"slow_requests"`
+	BudgetRemaining float64 `json:"budget_remaining" example:"0.97"`
+}
+
+// Low reports whether less than SLOLowBudget of the budget is left
+func (b SLOBudget) Low() bool {
+	return b.BudgetRemaining < SLOLowBudget
+}
+
+type sloCounts struct {
+	total int64
+	slow  int64
+}
+
+// SLOTracker counts, per endpoint, the requests slower than its target
+type SLOTracker struct {
+	mu      sync.Mutex
+	targets map[string]time.Duration
+	counts  map[string]*sloCounts
+	low     map[string]bool
+}
+
+func NewSLOTracker(targets map[string]time.Duration) *SLOTracker {
+	t := &SLOTracker{}
+	t.SetTargets(targets)
+	return t
+}
+
+// SetTargets replaces the targets and resets all counts
+func (t *SLOTracker) SetTargets(targets map[string]time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.targets = make(map[string]time.Duration, len(targets))
+	t.counts = make(map[string]*sloCounts, len(targets))
+	t.low = make(map[string]bool)
+	for endpoint, target := range targets {
+		t.targets[endpoint] = target
+		t.counts[endpoint] = &sloCounts{}
+	}
+}
+
+// Reset zeroes the counts of every endpoint, keeping the targets
+func (t *SLOTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.low = make(map[string]bool)
+	for endpoint := range t.counts {
+		t.counts[endpoint] = &sloCounts{}
+	}
+}
+
+// Record counts a request to endpoint. Endpoints without a target are ignored.
+func (t *SLOTracker) Record(endpoint string, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts, ok := t.counts[endpoint]
+	if !ok {
+		return
+	}
+	counts.total++
+	if duration > t.targets[endpoint] {
+		counts.slow++
+	}
+}
+
+// Budgets returns the budget of every endpoint with a target, ordered by
+// endpoint
+func (t *SLOTracker) Budgets() []SLOBudget {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	budgets := make([]SLOBudget, 0, len(t.targets))
+	for endpoint, target := range t.targets {
+		counts := t.counts[endpoint]
+		budgets = append(budgets, SLOBudget{
+			Endpoint:        endpoint,
+			TargetMs:        target.Milliseconds(),
+			Total:           counts.total,
+			Slow:            counts.slow,
+			BudgetRemaining: BudgetRemaining(counts.total, counts.slow),
+		})
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].Endpoint < budgets[j].Endpoint })
+	return budgets
+}
+
+// Update sets slo_budget_remaining for every endpoint and returns the budgets
+// that have dropped below SLOLowBudget since the last update. An endpoint is
+// reported again only after it has recovered.
+func (t *SLOTracker) Update() []SLOBudget {
+	budgets := t.Budgets()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var dropped []SLOBudget
+	for _, budget := range budgets {
+		sloBudgetRemaining.WithLabelValues(budget.Endpoint).Set(budget.BudgetRemaining)
+		if budget.Low() && !t.low[budget.Endpoint] {
+			dropped = append(dropped, budget)
+		}
+		t.low[budget.Endpoint] = budget.Low()
+	}
+	return dropped
+}
+
+// BudgetRemaining is 1 - slow/total, or 1 when there were no requests
+func BudgetRemaining(total, slow int64) float64 {
+	if total == 0 {
+		return 1
+	}
+	return 1 - float64(slow)/float64(total)
+}
+
+// RecordSLO counts a request against the endpoint's latency target
+func RecordSLO(endpoint string, duration time.Duration) {
+	SLO.Record(endpoint, duration)
+}
+
+// ParseSLOTargets parses SLO_TARGETS, a JSON object of endpoint to duration,
+// e.g. {"GET /books": "200ms"}
+func ParseSLOTargets(raw string) (map[string]time.Duration, error) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, fmt.Errorf("SLO_TARGETS must be a JSON object of endpoint to duration: %w", err)
+	}
+
+	targets := make(map[string]time.Duration, len(values))
+	for endpoint, value := range values {
+		target, err := time.ParseDuration(value)
+		if err != nil || target <= 0 {
+			return nil, fmt.Errorf("SLO_TARGETS: invalid target %q for %s", value, endpoint)
+		}
+		targets[endpoint] = target
+	}
+	return targets, nil
+}
+
+// StartSLOUpdater updates slo_budget_remaining from SLO every interval until
+// ctx is done, calling onLow for each endpoint whose budget drops below
+// SLOLowBudget
+func StartSLOUpdater(ctx context.Context, interval time.Duration, onLow func(SLOBudget)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, budget := range SLO.Update() {
+					if onLow != nil {
+						onLow(budget)
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,394 @@
+package odata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MaxTop caps $top so a single request can't pull the whole table
+const MaxTop = 1000
+
+// Options holds the raw OData query options taken from the request
+type Options struct {
+	Filter  string
+	OrderBy string
+	Top     string
+	Skip    string
+}
+
+// Empty reports whether no OData option was supplied
+func (o Options) Empty() bool {
+	return o.Filter == "" && o.OrderBy == "" && o.Top == "" && o.Skip == ""
+}
+
+// Query is a parsed OData query ready to be applied to a GORM statement
+type Query struct {
+	where   string
+	args    []interface{}
+	orderBy []string
+	top     int
+	skip    int
+}
+
+// ParseError describes why a query option could not be parsed
+type ParseError struct {
+	Option  string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Option, e.Message)
+}
+
+var comparisonOperators = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+}
+
+// Parse parses the OData options. fields maps the public field names that
+// may be filtered or sorted on to their database columns.
+func Parse(opts Options, fields map[string]string) (*Query, error) {
+	q := &Query{top: -1, skip: -1}
+
+	if opts.Filter != "" {
+		where, args, err := parseFilter(opts.Filter, fields)
+		if err != nil {
+			return nil, err
+		}
+		q.where = where
+		q.args = args
+	}
+
+	if opts.OrderBy != "" {
+		orderBy, err := parseOrderBy(opts.OrderBy, fields)
+		if err != nil {
+			return nil, err
+		}
+		q.orderBy = orderBy
+	}
+
+	if opts.Top != "" {
+		top, err := parseNonNegative("$top", opts.Top)
+		if err != nil {
+			return nil, err
+		}
+		if top > MaxTop {
+			return nil, &ParseError{Option: "$top", Message: fmt.Sprintf("must not exceed %d", MaxTop)}
+		}
+		q.top = top
+	}
+
+	if opts.Skip != "" {
+		skip, err := parseNonNegative("$skip", opts.Skip)
+		if err != nil {
+			return nil, err
+		}
+		q.skip = skip
+	}
+
+	return q, nil
+}
+
+// Where returns the generated SQL condition and its arguments
+func (q *Query) Where() (string, []interface{}) {
+	return q.where, q.args
+}
+
+// OrderBy returns the generated ORDER BY clauses
+func (q *Query) OrderBy() []string {
+	return q.orderBy
+}
+
+// Scope applies the query to a GORM statement, for use with db.Scopes
+func (q *Query) Scope(db *gorm.DB) *gorm.DB {
+	if q.where != "" {
+		db = db.Where(q.where, q.args...)
+	}
+	for _, order := range q.orderBy {
+		db = db.Order(order)
+	}
+	if q.top >= 0 {
+		db = db.Limit(q.top)
+	}
+	if q.skip >= 0 {
+		db = db.Offset(q.skip)
+	}
+	return db
+}
+
+func parseNonNegative(option, raw string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || n < 0 {
+		return 0, &ParseError{Option: option, Message: "must be a non-negative integer"}
+	}
+	return n, nil
+}
+
+func parseOrderBy(raw string, fields map[string]string) ([]string, error) {
+	var clauses []string
+	for _, part := range strings.Split(raw, ",") {
+		tokens := strings.Fields(part)
+		if len(tokens) == 0 || len(tokens) > 2 {
+			return nil, &ParseError{Option: "$orderby", Message: fmt.Sprintf("malformed clause %q", strings.TrimSpace(part))}
+		}
+
+		column, ok := fields[tokens[0]]
+		if !ok {
+			return nil, &ParseError{Option: "$orderby", Message: fmt.Sprintf("unknown field %q", tokens[0])}
+		}
+
+		direction := "ASC"
+		if len(tokens) == 2 {
+			switch strings.ToLower(tokens[1]) {
+			case "asc":
+			case "desc":
+				direction = "DESC"
+			default:
+				return nil, &ParseError{Option: "$orderby", Message: fmt.Sprintf("unknown direction %q", tokens[1])}
+			}
+		}
+
+		clauses = append(clauses, column+" "+direction)
+	}
+	return clauses, nil
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenLParen
+	tokenRParen
+	tokenEOF
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		ch := input[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case ch == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(input) {
+				if input[i] == '\'' {
+					// OData escapes a quote by doubling it
+					if i+1 < len(input) && input[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			if !closed {
+				return nil, &ParseError{Option: "$filter", Message: fmt.Sprintf("unterminated string at position %d", start)}
+			}
+			tokens = append(tokens, token{kind: tokenString, value: sb.String(), pos: start})
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			start := i
+			i++
+			for i < len(input) && (input[i] == '.' || (input[i] >= '0' && input[i] <= '9')) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: input[start:i], pos: start})
+		case isIdentChar(ch):
+			start := i
+			for i < len(input) && isIdentChar(input[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: input[start:i], pos: start})
+		default:
+			return nil, &ParseError{Option: "$filter", Message: fmt.Sprintf("unexpected character %q at position %d", ch, i)}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(input)})
+	return tokens, nil
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+	fields map[string]string
+	args   []interface{}
+}
+
+func parseFilter(raw string, fields map[string]string) (string, []interface{}, error) {
+	tokens, err := tokenize(raw)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &filterParser{tokens: tokens, fields: fields}
+	where, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return "", nil, p.errorf(tok, "unexpected %q", tok.value)
+	}
+	return where, p.args, nil
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) errorf(tok token, format string, args ...interface{}) error {
+	return &ParseError{
+		Option:  "$filter",
+		Message: fmt.Sprintf(format, args...) + fmt.Sprintf(" at position %d", tok.pos),
+	}
+}
+
+func (p *filterParser) isKeyword(tok token, keyword string) bool {
+	return tok.kind == tokenIdent && strings.EqualFold(tok.value, keyword)
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.isKeyword(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = left + " OR " + right
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return "", err
+	}
+	for p.isKeyword(p.peek(), "and") {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return "", err
+		}
+		left = left + " AND " + right
+	}
+	return left, nil
+}
+
+func (p *filterParser) parsePrimary() (string, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return "", p.errorf(closing, "expected ')'")
+		}
+		return "(" + inner + ")", nil
+	case tokenIdent:
+		return p.parseComparison(tok)
+	case tokenEOF:
+		return "", p.errorf(tok, "unexpected end of expression")
+	default:
+		return "", p.errorf(tok, "expected field name, got %q", tok.value)
+	}
+}
+
+func (p *filterParser) parseComparison(field token) (string, error) {
+	column, ok := p.fields[field.value]
+	if !ok {
+		return "", p.errorf(field, "unknown field %q", field.value)
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokenIdent {
+		return "", p.errorf(opTok, "expected operator after %q", field.value)
+	}
+	op, ok := comparisonOperators[strings.ToLower(opTok.value)]
+	if !ok {
+		return "", p.errorf(opTok, "unsupported operator %q (supported: eq, ne, gt, ge, lt, le)", opTok.value)
+	}
+
+	valTok := p.next()
+	var value interface{}
+	switch valTok.kind {
+	case tokenString:
+		value = valTok.value
+	case tokenNumber:
+		if strings.Contains(valTok.value, ".") {
+			f, err := strconv.ParseFloat(valTok.value, 64)
+			if err != nil {
+				return "", p.errorf(valTok, "invalid number %q", valTok.value)
+			}
+			value = f
+		} else {
+			n, err := strconv.ParseInt(valTok.value, 10, 64)
+			if err != nil {
+				return "", p.errorf(valTok, "invalid number %q", valTok.value)
+			}
+			value = n
+		}
+	case tokenIdent:
+		if strings.EqualFold(valTok.value, "null") {
+			switch op {
+			case "=":
+				return column + " IS NULL", nil
+			case "<>":
+				return column + " IS NOT NULL", nil
+			}
+			return "", p.errorf(valTok, "null can only be compared with eq or ne")
+		}
+		return "", p.errorf(valTok, "expected literal value, got %q", valTok.value)
+	default:
+		return "", p.errorf(valTok, "expected literal value after %q", opTok.value)
+	}
+
+	p.args = append(p.args, value)
+	return column + " " + op + " ?", nil
+}
@@ -0,0 +1,178 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Types of tracked connections
+const (
+	ConnectionWebSocket = "websocket"
+	ConnectionSSE       = "sse"
+)
+
+// CloseTimeout is how long shutdown waits for tracked connections to end
+const CloseTimeout = 5 * time.Second
+
+// Connections tracks the WebSocket and SSE connections of this instance so
+// shutdown can close them
+var Connections = NewConnectionManager()
+
+// Connection is a long-lived client connection registered with Track
+type Connection struct {
+	Type string
+
+	manager  *ConnectionManager
+	id       uint64
+	onClose  func()
+	closing  chan struct{}
+	closed   chan struct{}
+	stopOnce sync.Once
+	endOnce  sync.Once
+}
+
+// Closing returns a channel that is closed when the server wants the
+// connection closed. Handlers should end the connection when it is.
+func (c *Connection) Closing() <-chan struct{} {
+	return c.closing
+}
+
+// Close unregisters the connection. Handlers call it when the connection
+// has ended, for whatever reason.
+func (c *Connection) Close() {
+	c.endOnce.Do(func() {
+		c.manager.conns.Delete(c.id)
+		close(c.closed)
+	})
+}
+
+// stop asks the connection to close: it runs the onClose hook, e.g. to send
+// a WebSocket close frame, and closes Closing
+func (c *Connection) stop() {
+	c.stopOnce.Do(func() {
+		if c.onClose != nil {
+			c.onClose()
+		}
+		close(c.closing)
+	})
+}
+
+// ConnectionManager tracks open connections by type. Requests don't wait
+// for them on shutdown like they do for each other, since they only end
+// when the client goes away.
+type ConnectionManager struct {
+	conns  sync.Map
+	nextID uint64
+	// mu orders Track against the start of CloseAll, so no connection
+	// misses it
+	mu           sync.RWMutex
+	shuttingDown bool
+}
+
+// NewConnectionManager creates a manager without connections
+func NewConnectionManager() *ConnectionManager {
+	return &ConnectionManager{}
+}
+
+// Track registers a connection of type connType. onClose, which may be nil,
+// runs when CloseAll closes it. Once CloseAll has started, new connections
+// are closed right away.
+func (m *ConnectionManager) Track(connType string, onClose func()) *Connection {
+	conn := &Connection{
+		Type:    connType,
+		manager: m,
+		id:      atomic.AddUint64(&m.nextID, 1),
+		onClose: onClose,
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+
+	m.mu.RLock()
+	m.conns.Store(conn.id, conn)
+	shuttingDown := m.shuttingDown
+	m.mu.RUnlock()
+	if shuttingDown {
+		conn.stop()
+	}
+	return conn
+}
+
+// CloseAll asks every connection to close and waits until they have ended
+// or ctx is done, in which case it returns an error with the number of
+// connections still open
+func (m *ConnectionManager) CloseAll(ctx context.Context) error {
+	m.mu.Lock()
+	m.shuttingDown = true
+	m.mu.Unlock()
+
+	var open []*Connection
+	m.conns.Range(func(_, value interface{}) bool {
+		conn := value.(*Connection)
+		open = append(open, conn)
+		return true
+	})
+	for _, conn := range open {
+		conn.stop()
+	}
+
+	for i, conn := range open {
+		select {
+		case <-conn.closed:
+		case <-ctx.Done():
+			remaining := 0
+			for _, conn := range open[i:] {
+				select {
+				case <-conn.closed:
+				default:
+					remaining++
+				}
+			}
+			return fmt.Errorf("%d connections still open: %w", remaining, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Counts returns the number of open connections of each type
+func (m *ConnectionManager) Counts() map[string]int {
+	counts := map[string]int{ConnectionWebSocket: 0, ConnectionSSE: 0}
+	m.conns.Range(func(_, value interface{}) bool {
+		counts[value.(*Connection).Type]++
+		return true
+	})
+	return counts
+}
+
+// ConnectionsResponse is the number of open connections, in total and by
+// type
+type ConnectionsResponse struct {
+	Total  int            `json:"total" example:"3"`
+	ByType map[string]int `json:"by_type"`
+}
+
+// ConnectionsHandler godoc
+// @Summary      Count open connections (admin only)
+// @Description  Number of WebSocket and SSE connections currently open on this instance. Shutdown closes them before waiting for in-flight requests.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} ConnectionsResponse
+// @Failure      401  {object} errors.APIError
+// @Failure      403  {object} errors.APIError
+// @Failure      429  {object} errors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/connections [get]
+func ConnectionsHandler(m *ConnectionManager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		counts := m.Counts()
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		return c.JSON(ConnectionsResponse{Total: total, ByType: counts})
+	}
+}
@@ -0,0 +1,73 @@
+// Package pubsub fans messages out to subscribers within this process, e.g.
+// to push events to WebSocket clients. Messages published on another
+// instance are not seen here.
+package pubsub
+
+import "sync"
+
+// DefaultBuffer is the number of messages a subscriber can fall behind
+// before newer ones are dropped for it
+const DefaultBuffer = 16
+
+// Hub delivers each message published on a topic to the topic's current
+// subscribers. Publishing never blocks: a subscriber whose buffer is full
+// misses the message.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[chan interface{}]struct{}
+}
+
+// NewHub creates a hub without subscribers
+func NewHub() *Hub {
+	return &Hub{topics: map[string]map[chan interface{}]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the messages published on topic
+// from now on, and a function that unsubscribes and closes the channel
+func (h *Hub) Subscribe(topic string) (<-chan interface{}, func()) {
+	ch := make(chan interface{}, DefaultBuffer)
+
+	h.mu.Lock()
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[chan interface{}]struct{}{}
+	}
+	h.topics[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.topics[topic], ch)
+			if len(h.topics[topic]) == 0 {
+				delete(h.topics, topic)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends message to the subscribers of topic and returns how many
+// received it
+func (h *Hub) Publish(topic string, message interface{}) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	delivered := 0
+	for ch := range h.topics[topic] {
+		select {
+		case ch <- message:
+			delivered++
+		default:
+		}
+	}
+	return delivered
+}
+
+// Subscribers returns the number of subscribers of topic
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
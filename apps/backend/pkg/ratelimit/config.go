@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+)
+
+// ConfigKey is the Redis hash holding the limits, one JSON Limit per tier
+const ConfigKey = "ratelimit:config"
+
+// ConfigReloadInterval is how long an instance uses its copy of the limits
+// before reading them from Redis again
+const ConfigReloadInterval = 60 * time.Second
+
+// Tiers, the fields of ConfigKey
+const (
+	TierDefault = "default"
+	TierAdmin   = "admin"
+)
+
+// Limit allows Limit requests per Window seconds
+type Limit struct {
+	Limit  int `json:"limit" validate:"min=1" example:"100"`
+	Window int `json:"window" validate:"min=1" example:"60"`
+}
+
+// Expiration is the window as a duration
+func (l Limit) Expiration() time.Duration {
+	return time.Duration(l.Window) * time.Second
+}
+
+func (l Limit) validate(tier string) error {
+	if l.Limit < 1 {
+		return fmt.Errorf("%s.limit must be at least 1", tier)
+	}
+	if l.Window < 1 {
+		return fmt.Errorf("%s.window must be at least 1 second", tier)
+	}
+	return nil
+}
+
+// Config is the limit of each tier. Admins are limited by Admin, everyone
+// else by Default.
+type Config struct {
+	Default Limit `json:"default"`
+	Admin   Limit `json:"admin"`
+}
+
+// Validate reports limits that would block every request
+func (c Config) Validate() error {
+	if err := c.Default.validate(TierDefault); err != nil {
+		return err
+	}
+	return c.Admin.validate(TierAdmin)
+}
+
+// Tier returns the limit of tier
+func (c Config) Tier(tier string) Limit {
+	if tier == TierAdmin {
+		return c.Admin
+	}
+	return c.Default
+}
+
+// LoadConfig reads the limits from Redis. found is false when they were
+// never stored; tiers missing from the hash keep their value in fallback.
+func LoadConfig(c cache.Cache, fallback Config) (config Config, found bool, err error) {
+	fields, err := c.HGetAll(ConfigKey)
+	if err != nil {
+		return fallback, false, err
+	}
+	if len(fields) == 0 {
+		return fallback, false, nil
+	}
+
+	config = fallback
+	for tier, limit := range map[string]*Limit{TierDefault: &config.Default, TierAdmin: &config.Admin} {
+		raw, ok := fields[tier]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal([]byte(raw), limit); err != nil {
+			return fallback, false, fmt.Errorf("invalid %s limit in %s: %w", tier, ConfigKey, err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return fallback, false, fmt.Errorf("invalid limits in %s: %w", ConfigKey, err)
+	}
+	return config, true, nil
+}
+
+// SaveConfig stores the limits in Redis
+func SaveConfig(c cache.Cache, config Config) error {
+	return c.HSet(ConfigKey, map[string]interface{}{
+		TierDefault: config.Default,
+		TierAdmin:   config.Admin,
+	})
+}
+
+// ConfigSource hands out the current limits. It keeps a copy and reads the
+// limits from Redis again once the copy is older than the reload interval,
+// so a change made on another instance applies here within that interval.
+// While Redis can't be read the last known limits stay in use.
+type ConfigSource struct {
+	cache    cache.Cache
+	fallback Config
+	interval time.Duration
+
+	mu        sync.Mutex
+	current   Config
+	loadedAt  time.Time
+	reloading bool
+}
+
+// NewConfigSource creates a source reading from c every interval. fallback
+// applies until limits are stored in Redis.
+func NewConfigSource(c cache.Cache, fallback Config, interval time.Duration) *ConfigSource {
+	return &ConfigSource{
+		cache:    c,
+		fallback: fallback,
+		interval: interval,
+		current:  fallback,
+	}
+}
+
+// Current returns the limits. When the copy is stale, one caller reloads it
+// while the others keep using the old copy.
+func (s *ConfigSource) Current() Config {
+	s.mu.Lock()
+	if s.reloading || (!s.loadedAt.IsZero() && time.Since(s.loadedAt) < s.interval) {
+		current := s.current
+		s.mu.Unlock()
+		return current
+	}
+	s.reloading = true
+	s.mu.Unlock()
+
+	config, _, err := LoadConfig(s.cache, s.fallback)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reloading = false
+	s.loadedAt = time.Now()
+	if err == nil {
+		s.current = config
+	}
+	return s.current
+}
+
+// Update stores config in Redis and uses it here right away; other
+// instances pick it up within the reload interval
+func (s *ConfigSource) Update(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := SaveConfig(s.cache, config); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = config
+	s.loadedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetConfigHandler godoc
+// @Summary      Get the rate limits (admin only)
+// @Description  The limits this instance currently enforces, per tier. Window is in seconds.
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} Config
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/ratelimit/config [get]
+func GetConfigHandler(source *ConfigSource) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(source.Current())
+	}
+}
+
+// UpdateConfigHandler godoc
+// @Summary      Change the rate limits (admin only)
+// @Description  Stores the limits in Redis. This instance applies them to the next request; other instances within a minute. Counters of the current window are kept.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        request body Config true "Limit per tier, window in seconds"
+// @Success      200  {object} Config
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/ratelimit/config [put]
+func UpdateConfigHandler(source *ConfigSource, onUpdate func(c *fiber.Ctx, previous, config Config)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req Config
+		if err := c.BodyParser(&req); err != nil {
+			return apierrors.ErrInvalidRequestBody
+		}
+		if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+			return apierrors.NewValidationError(errs...)
+		}
+
+		previous := source.Current()
+		if err := source.Update(req); err != nil {
+			return apierrors.ErrInternal.WithMessage("Failed to store rate limits")
+		}
+		if onUpdate != nil {
+			onUpdate(c, previous, req)
+		}
+		return c.JSON(req)
+	}
+}
@@ -0,0 +1,110 @@
+// Package ratelimit implements rate limiting algorithms that keep their state
+// in Redis, so all instances share it
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/go-redis/redis/v8"
+)
+
+// leakyBucketScript takes one request from the bucket at KEYS[1]. The bucket
+// is a hash of tokens, its level, and last_refill, when the level was last
+// drained in milliseconds. The level drains at ARGV[1] per second and a
+// request is allowed when adding it keeps the level at or below ARGV[2].
+// ARGV[3] is the current time in milliseconds.
+//
+// It returns {allowed (0 or 1), level as a string, retry after in ms}; the
+// level is a string because Redis truncates Lua numbers to integers.
+var leakyBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last_refill')
+local tokens = tonumber(state[1]) or 0
+local last = tonumber(state[2]) or now
+
+-- Another instance's clock may be behind; never drain backwards
+if now > last then
+  tokens = math.max(0, tokens - (now - last) / 1000 * rate)
+  last = now
+end
+
+local allowed = 0
+local retry_after = 0
+if tokens + 1 <= burst then
+  tokens = tokens + 1
+  allowed = 1
+else
+  retry_after = math.ceil((tokens + 1 - burst) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last_refill', last)
+redis.call('PEXPIRE', KEYS[1], math.ceil(tokens / rate * 1000) + 1000)
+return {allowed, tostring(tokens), retry_after}
+`)
+
+// LeakyBucket allows bursts of up to Burst requests per key, then Rate
+// requests per second. Each request takes one Redis round trip regardless of
+// the limit, unlike a sliding window log, which grows with it.
+type LeakyBucket struct {
+	Cache cache.Cache
+	// Rate is how many requests per second drain from the bucket
+	Rate float64
+	// Burst is the bucket's capacity
+	Burst float64
+}
+
+// Decision is the outcome of taking a request from a bucket
+type Decision struct {
+	Allowed bool
+	// Remaining is how many more requests fit in the bucket right now
+	Remaining int
+	// RetryAfter is how long until a request would be allowed again; zero
+	// when this one was
+	RetryAfter time.Duration
+}
+
+// NewLeakyBucket creates a bucket draining rate requests per second with
+// capacity burst
+func NewLeakyBucket(c cache.Cache, rate, burst float64) (*LeakyBucket, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("leaky bucket rate must be positive, got %v", rate)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("leaky bucket burst must be at least 1, got %v", burst)
+	}
+	return &LeakyBucket{Cache: c, Rate: rate, Burst: burst}, nil
+}
+
+// Take adds a request to the bucket at key as of now, unless it is full
+func (b *LeakyBucket) Take(key string, now time.Time) (Decision, error) {
+	raw, err := b.Cache.RunScript(leakyBucketScript, []string{key},
+		b.Rate, b.Burst, now.UnixMilli())
+	if err != nil {
+		return Decision{}, err
+	}
+
+	reply, ok := raw.([]interface{})
+	if !ok || len(reply) != 3 {
+		return Decision{}, fmt.Errorf("unexpected leaky bucket reply %v", raw)
+	}
+	allowed, _ := reply[0].(int64)
+	levelRaw, _ := reply[1].(string)
+	retryAfter, _ := reply[2].(int64)
+	level, err := strconv.ParseFloat(levelRaw, 64)
+	if err != nil {
+		return Decision{}, fmt.Errorf("unexpected leaky bucket level %q: %w", levelRaw, err)
+	}
+
+	return Decision{
+		Allowed:    allowed == 1,
+		Remaining:  int(math.Max(0, math.Floor(b.Burst-level))),
+		RetryAfter: time.Duration(retryAfter) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package requestlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeartbeatInterval is how often an idle stream gets a comment line, which
+// keeps proxies from closing it and notices clients that went away
+var HeartbeatInterval = 15 * time.Second
+
+// ContentTypeEventStream is the Server-Sent Events format
+const ContentTypeEventStream = "text/event-stream"
+
+// LiveHandler godoc
+// @Summary      Stream completed requests live (admin only)
+// @Description  Server-Sent Events stream with one event per request this instance completes, as {"method","path","status","duration_ms","ip","timestamp"}, each with an increasing id. Clients reconnecting with Last-Event-ID first get the buffered events after that id; the last 1000 are kept by default. Browsers can pass the token as access_token since EventSource can't set headers. Events are dropped for a client that falls too far behind.
+// @Tags         admin
+// @Produce      text/event-stream
+// @Security     Bearer
+// @Param        status         query   string  false  "Only this status class or status, e.g. 5xx or 404"
+// @Param        path           query   string  false  "Only this path and the paths below it, e.g. /books"
+// @Param        access_token   query   string  false  "JWT, for clients that can't set the Authorization header"
+// @Param        Last-Event-ID  header  string  false  "Id of the last event received, to resume after it"
+// @Success      200  {string} string "Event stream"
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/requests/live [get]
+func LiveHandler(tail *Tail) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, err := ParseFilter(c.Query("status"), c.Query("path"))
+		if err != nil {
+			return apierrors.ErrInvalidQuery.WithMessage(err.Error())
+		}
+		var lastID uint64
+		if header := c.Get("Last-Event-ID"); header != "" {
+			lastID, _ = strconv.ParseUint(header, 10, 64)
+		}
+		resume := lastID > 0
+		heartbeat := HeartbeatInterval
+		// Closed when the server shuts down, which otherwise waits for the
+		// stream to end
+		shutdown := c.Context().Done()
+
+		c.Set(fiber.HeaderContentType, ContentTypeEventStream)
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set("X-Accel-Buffering", "no")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			// Subscribe before reading the buffer so no event falls between
+			// the two; events already sent from the buffer are skipped
+			events, unsubscribe := tail.Hub.Subscribe(Topic)
+			defer unsubscribe()
+			tracked := pubsub.Connections.Track(pubsub.ConnectionSSE, nil)
+			defer tracked.Close()
+
+			if _, err := w.WriteString(": connected\n\n"); err != nil || w.Flush() != nil {
+				return
+			}
+			if resume {
+				for _, e := range tail.Since(lastID) {
+					if err := writeEvent(w, filter, e); err != nil {
+						return
+					}
+					lastID = e.ID
+				}
+				if w.Flush() != nil {
+					return
+				}
+			}
+
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-shutdown:
+					return
+				case <-tracked.Closing():
+					return
+				case message, ok := <-events:
+					if !ok {
+						return
+					}
+					e := message.(Event)
+					if e.ID <= lastID {
+						continue
+					}
+					if err := writeEvent(w, filter, e); err != nil {
+						return
+					}
+					lastID = e.ID
+				case <-ticker.C:
+					if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+						return
+					}
+				}
+				if w.Flush() != nil {
+					return
+				}
+			}
+		})
+		return nil
+	}
+}
+
+// writeEvent writes e as an SSE message if it passes filter
+func writeEvent(w *bufio.Writer, filter Filter, e Event) error {
+	if !filter.Match(e) {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.ID, data)
+	return err
+}
@@ -0,0 +1,148 @@
+// Package requestlog keeps a live tail of the requests this instance
+// completes, so admins can watch traffic as it happens. Requests handled by
+// other instances are not seen here.
+package requestlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+)
+
+// DefaultBufferSize is how many recent events a tail keeps for clients that
+// reconnect
+const DefaultBufferSize = 1000
+
+// Topic is the hub topic events are published on
+const Topic = "requests"
+
+// Event is one completed request
+type Event struct {
+	// ID increases by one per event, starting at 1
+	ID         uint64    `json:"-"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs int64     `json:"duration_ms"`
+	IP         string    `json:"ip"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// NewEvent describes a request that completed now
+func NewEvent(method, path string, status int, duration time.Duration, ip string) Event {
+	return Event{
+		Method:     method,
+		Path:       path,
+		Status:     status,
+		DurationMs: duration.Milliseconds(),
+		IP:         ip,
+		Timestamp:  time.Now().UTC(),
+	}
+}
+
+// Tail publishes events to its hub and keeps the most recent ones in a ring
+// buffer
+type Tail struct {
+	Hub *pubsub.Hub
+
+	mu     sync.Mutex
+	ring   []Event
+	next   int
+	full   bool
+	lastID uint64
+}
+
+// NewTail creates a tail keeping the last size events, or
+// DefaultBufferSize if size isn't positive
+func NewTail(size int) *Tail {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Tail{Hub: pubsub.NewHub(), ring: make([]Event, size)}
+}
+
+// Publish numbers e, buffers it and sends it to the subscribers
+func (t *Tail) Publish(e Event) {
+	t.mu.Lock()
+	t.lastID++
+	e.ID = t.lastID
+	t.ring[t.next] = e
+	t.next = (t.next + 1) % len(t.ring)
+	if t.next == 0 {
+		t.full = true
+	}
+	t.mu.Unlock()
+
+	t.Hub.Publish(Topic, e)
+}
+
+// Since returns the buffered events with an ID above id, oldest first.
+// Events that no longer fit in the buffer are lost.
+func (t *Tail) Since(id uint64) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var buffered []Event
+	if t.full {
+		buffered = append(buffered, t.ring[t.next:]...)
+	}
+	buffered = append(buffered, t.ring[:t.next]...)
+
+	for i, e := range buffered {
+		if e.ID > id {
+			return buffered[i:]
+		}
+	}
+	return nil
+}
+
+// Filter selects the events sent to a client. The zero value matches every
+// event.
+type Filter struct {
+	// StatusClass matches statuses of that hundred, e.g. 5 for 5xx
+	StatusClass int
+	// Status matches one status exactly
+	Status int
+	// PathPrefix matches the path and the paths below it, e.g. /books
+	// matches /books and /books/1 but not /bookshelf
+	PathPrefix string
+}
+
+// ParseFilter reads a filter from the status and path query parameters.
+// status is a class such as 5xx or an exact status such as 404.
+func ParseFilter(status, path string) (Filter, error) {
+	filter := Filter{PathPrefix: strings.TrimSuffix(path, "/")}
+
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == "" {
+		return filter, nil
+	}
+	if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+		filter.StatusClass = int(status[0] - '0')
+		return filter, nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return Filter{}, fmt.Errorf("invalid status %q, expected a class such as 5xx or a status such as 404", status)
+	}
+	filter.Status = code
+	return filter, nil
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Event) bool {
+	if f.StatusClass != 0 && e.Status/100 != f.StatusClass {
+		return false
+	}
+	if f.Status != 0 && e.Status != f.Status {
+		return false
+	}
+	if f.PathPrefix != "" && e.Path != f.PathPrefix && !strings.HasPrefix(e.Path, f.PathPrefix+"/") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+// Package ring provides a fixed-size buffer that keeps the most recent
+// values added to it
+package ring
+
+import "sync"
+
+// Buffer keeps the last size values added, overwriting the oldest. It is
+// safe for concurrent use.
+type Buffer[T any] struct {
+	mu     sync.Mutex
+	values []T
+	next   int
+	full   bool
+}
+
+// New creates a buffer keeping the last size values. size must be positive.
+func New[T any](size int) *Buffer[T] {
+	return &Buffer[T]{values: make([]T, size)}
+}
+
+// Add appends v, dropping the oldest value if the buffer is full
+func (b *Buffer[T]) Add(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[b.next] = v
+	b.next = (b.next + 1) % len(b.values)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Items returns the buffered values, oldest first
+func (b *Buffer[T]) Items() []T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var items []T
+	if b.full {
+		items = append(items, b.values[b.next:]...)
+	}
+	return append(items, b.values[:b.next]...)
+}
+
+// Len returns the number of buffered values
+func (b *Buffer[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.full {
+		return len(b.values)
+	}
+	return b.next
+}
@@ -0,0 +1,98 @@
+// Package scheduler parses cron expressions and runs jobs on a fixed
+// interval. Jobs whose state lives in the database poll with Start and
+// compare their stored next run time, so every instance can run the poller
+// and restarts don't lose schedules.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	expr     string
+	schedule cron.Schedule
+}
+
+// Parse parses a standard five-field cron expression (minute, hour, day of
+// month, month, day of week), such as "0 8 * * 1" for Mondays at 08:00, or a
+// descriptor such as @daily. Times are UTC unless the expression starts with
+// CRON_TZ=<zone>.
+func Parse(expr string) (*Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return &Schedule{expr: expr, schedule: schedule}, nil
+}
+
+// String returns the expression the schedule was parsed from
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time after t that matches the schedule, in UTC.
+// It returns the zero time if nothing matches within five years, e.g. for
+// February 30th.
+func (s *Schedule) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t.UTC())
+	if next.IsZero() {
+		return next
+	}
+	return next.UTC()
+}
+
+// NextRun parses expr and returns its first run after t
+func NextRun(expr string, t time.Time) (time.Time, error) {
+	schedule, err := Parse(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(t)
+	if next.IsZero() {
+		return next, fmt.Errorf("cron expression %q never runs", expr)
+	}
+	return next, nil
+}
+
+// Start calls job every interval until ctx is done. Runs don't overlap.
+func Start(ctx context.Context, interval time.Duration, job func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				job(ctx)
+			}
+		}
+	}()
+}
+
+// StartCron calls job at every time matching schedule until ctx is done.
+// Runs don't overlap; a run that would start while the previous one is still
+// going is skipped.
+func StartCron(ctx context.Context, schedule *Schedule, job func(context.Context)) {
+	go func() {
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				job(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,380 @@
+// Package seed loads users, genres and books from a YAML manifest. Every
+// entry is matched on a field, so applying a manifest again only creates
+// the entries that are missing and updates the ones that changed.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// DefaultFile is the manifest used when SEED_FILE is unset
+const DefaultFile = "seeds/development.yaml"
+
+// Manifest is a seed file. With DryRun set, applying it only reports what
+// would change.
+type Manifest struct {
+	DryRun bool    `yaml:"dry_run"`
+	Users  []User  `yaml:"users"`
+	Genres []Genre `yaml:"genres"`
+	Books  []Book  `yaml:"books"`
+}
+
+// User is a user to seed, matched on its username or email. The password is
+// only set when the user is created, so a re-run never resets it. Empty
+// fields are left as they are on existing users; new users without a role
+// get the default one.
+type User struct {
+	MatchBy  string `yaml:"match_by"`
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+	Role     string `yaml:"role"`
+}
+
+// Genre is a genre to seed, matched on the slug of its name, so
+// "Science Fiction" also matches an existing "science fiction", which it
+// renames. An empty description is left as it is on an existing genre.
+type Genre struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// Book is a book to seed, matched on its ISBN or title. Empty fields are
+// left as they are on existing books.
+type Book struct {
+	MatchBy string `yaml:"match_by"`
+	Title   string `yaml:"title"`
+	Author  string `yaml:"author"`
+	Year    int    `yaml:"year"`
+	Genre   string `yaml:"genre"`
+	ISBN    string `yaml:"isbn"`
+}
+
+// Actions taken for an entry
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+// Change is what applying a manifest did, or would do, to one entry
+type Change struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+// Report lists the changes of every entry in manifest order
+type Report struct {
+	DryRun  bool     `json:"dry_run"`
+	Changes []Change `json:"changes"`
+}
+
+// Count returns how many entries had action
+func (r *Report) Count(action string) int {
+	n := 0
+	for _, change := range r.Changes {
+		if change.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// envRef is a $env:NAME reference to an environment variable
+var envRef = regexp.MustCompile(`\$env:([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandEnv replaces the $env:NAME references in s. Unset variables are an
+// error, so a production manifest can't seed an empty password.
+func expandEnv(s string) (string, error) {
+	var missing error
+	expanded := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRef.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == nil {
+			missing = fmt.Errorf("%s is not set", name)
+		}
+		return value
+	})
+	return expanded, missing
+}
+
+func expandAll(fields ...*string) error {
+	for _, field := range fields {
+		expanded, err := expandEnv(*field)
+		if err != nil {
+			return err
+		}
+		*field = expanded
+	}
+	return nil
+}
+
+// Parse decodes a manifest, substitutes its environment references and
+// checks every entry has a valid match_by with a value to match on
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid seed manifest: %w", err)
+	}
+
+	for i := range m.Users {
+		u := &m.Users[i]
+		if err := expandAll(&u.Username, &u.Email, &u.Password, &u.Role); err != nil {
+			return nil, fmt.Errorf("users[%d]: %w", i, err)
+		}
+		if _, value, err := u.match(); err != nil {
+			return nil, fmt.Errorf("users[%d]: %w", i, err)
+		} else if value == "" {
+			return nil, fmt.Errorf("users[%d]: %s is empty", i, u.MatchBy)
+		}
+		if u.Password == "" {
+			return nil, fmt.Errorf("users[%d]: password is empty", i)
+		}
+	}
+	for i := range m.Genres {
+		g := &m.Genres[i]
+		if err := expandAll(&g.Name, &g.Description); err != nil {
+			return nil, fmt.Errorf("genres[%d]: %w", i, err)
+		}
+		if book.GenreSlug(g.Name) == "" {
+			return nil, fmt.Errorf("genres[%d]: name must contain a letter or digit", i)
+		}
+	}
+	for i := range m.Books {
+		b := &m.Books[i]
+		if err := expandAll(&b.Title, &b.Author, &b.Genre, &b.ISBN); err != nil {
+			return nil, fmt.Errorf("books[%d]: %w", i, err)
+		}
+		if _, value, err := b.match(); err != nil {
+			return nil, fmt.Errorf("books[%d]: %w", i, err)
+		} else if value == "" {
+			return nil, fmt.Errorf("books[%d]: %s is empty", i, b.MatchBy)
+		}
+	}
+	return &m, nil
+}
+
+// LoadFile reads and parses the manifest at path
+func LoadFile(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// SeedFromFile applies the manifest at path. The manifest's dry_run setting
+// also makes it a dry run.
+func SeedFromFile(ctx context.Context, conn *gorm.DB, path string, dryRun bool) (*Report, error) {
+	m, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Apply(ctx, conn, m, dryRun)
+}
+
+// Apply creates the missing entries of m and updates the ones that differ,
+// in one transaction. A dry run only looks them up.
+func Apply(ctx context.Context, conn *gorm.DB, m *Manifest, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun || m.DryRun}
+	apply := func(tx *gorm.DB) error {
+		for _, u := range m.Users {
+			change, err := applyUser(tx, u, report.DryRun)
+			if err != nil {
+				return err
+			}
+			report.Changes = append(report.Changes, change)
+		}
+		for _, g := range m.Genres {
+			change, err := applyGenre(tx, g, report.DryRun)
+			if err != nil {
+				return err
+			}
+			report.Changes = append(report.Changes, change)
+		}
+		for _, b := range m.Books {
+			change, err := applyBook(tx, b, report.DryRun)
+			if err != nil {
+				return err
+			}
+			report.Changes = append(report.Changes, change)
+		}
+		return nil
+	}
+
+	conn = conn.WithContext(ctx)
+	if report.DryRun {
+		return report, apply(conn)
+	}
+	if err := conn.Transaction(apply); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (u User) match() (column, value string, err error) {
+	switch u.MatchBy {
+	case "username":
+		return "username", u.Username, nil
+	case "email":
+		return "email", u.Email, nil
+	}
+	return "", "", fmt.Errorf("match_by must be username or email, got %q", u.MatchBy)
+}
+
+func (b Book) match() (column, value string, err error) {
+	switch b.MatchBy {
+	case "isbn":
+		return "isbn", b.ISBN, nil
+	case "title":
+		return "title", b.Title, nil
+	}
+	return "", "", fmt.Errorf("match_by must be isbn or title, got %q", b.MatchBy)
+}
+
+func applyUser(tx *gorm.DB, u User, dryRun bool) (change Change, err error) {
+	column, value, _ := u.match()
+	change = Change{Kind: "user", Key: value}
+
+	var existing auth.User
+	found := tx.Where(map[string]interface{}{column: value}).Limit(1).Find(&existing)
+	if found.Error != nil {
+		return change, found.Error
+	}
+	if found.RowsAffected == 0 {
+		change.Action = ActionCreate
+		if dryRun {
+			return change, nil
+		}
+		hashed, err := auth.HashPassword(u.Password)
+		if err != nil {
+			return change, err
+		}
+		user := auth.User{
+			Username:     u.Username,
+			Email:        u.Email,
+			Password:     hashed,
+			Role:         u.Role,
+			PasswordCost: auth.BcryptCost,
+		}
+		var created auth.User
+		return change, tx.Where(map[string]interface{}{column: value}).Attrs(user).FirstOrCreate(&created).Error
+	}
+
+	updates := map[string]interface{}{}
+	if u.Username != "" && u.Username != existing.Username {
+		updates["username"] = u.Username
+	}
+	if u.Email != "" && u.Email != existing.Email {
+		updates["email"] = u.Email
+	}
+	if u.Role != "" && u.Role != existing.Role {
+		updates["role"] = u.Role
+	}
+	change.Action, err = update(tx, &existing, updates, dryRun)
+	return change, err
+}
+
+func applyGenre(tx *gorm.DB, g Genre, dryRun bool) (change Change, err error) {
+	name := strings.Join(strings.Fields(g.Name), " ")
+	slug := book.GenreSlug(name)
+	change = Change{Kind: "genre", Key: slug}
+
+	var existing book.Genre
+	found := tx.Where("slug = ?", slug).Limit(1).Find(&existing)
+	if found.Error != nil {
+		return change, found.Error
+	}
+	if found.RowsAffected == 0 {
+		change.Action = ActionCreate
+		if dryRun {
+			return change, nil
+		}
+		seeded := book.Genre{Name: name, Slug: slug, Description: g.Description}
+		var created book.Genre
+		return change, tx.Where("slug = ?", slug).Attrs(seeded).FirstOrCreate(&created).Error
+	}
+
+	updates := map[string]interface{}{}
+	if name != existing.Name {
+		updates["name"] = name
+	}
+	if g.Description != "" && g.Description != existing.Description {
+		updates["description"] = g.Description
+	}
+	change.Action, err = update(tx, &existing, updates, dryRun)
+	return change, err
+}
+
+func applyBook(tx *gorm.DB, b Book, dryRun bool) (change Change, err error) {
+	column, value, _ := b.match()
+	change = Change{Kind: "book", Key: value}
+
+	var existing book.Book
+	found := tx.Where(map[string]interface{}{column: value}).Limit(1).Find(&existing)
+	if found.Error != nil {
+		return change, found.Error
+	}
+	if found.RowsAffected == 0 {
+		change.Action = ActionCreate
+		if dryRun {
+			return change, nil
+		}
+		seeded := book.Book{Title: b.Title, Author: b.Author, Year: b.Year, Genre: b.Genre, ISBN: b.ISBN}
+		var created book.Book
+		return change, tx.Where(map[string]interface{}{column: value}).Attrs(seeded).FirstOrCreate(&created).Error
+	}
+
+	updates := map[string]interface{}{}
+	for column, values := range map[string][2]string{
+		"title":  {b.Title, existing.Title},
+		"author": {b.Author, existing.Author},
+		"isbn":   {b.ISBN, existing.ISBN},
+	} {
+		if values[0] != "" && values[0] != values[1] {
+			updates[column] = values[0]
+		}
+	}
+	if b.Year != 0 && b.Year != existing.Year {
+		updates["year"] = b.Year
+	}
+	// Books are stored under their genre's name, so only a different genre
+	// is a change
+	if b.Genre != "" && book.GenreSlug(b.Genre) != book.GenreSlug(existing.Genre) {
+		updates["genre"] = b.Genre
+		if !dryRun {
+			genre, err := book.FindOrCreateGenre(tx, b.Genre)
+			if err != nil {
+				return change, err
+			}
+			updates["genre"], updates["genre_id"] = genre.Name, genre.ID
+		}
+	}
+	change.Action, err = update(tx, &existing, updates, dryRun)
+	return change, err
+}
+
+// update stores updates on the loaded record unless this is a dry run, and
+// returns whether it was an update
+func update(tx *gorm.DB, record interface{}, updates map[string]interface{}, dryRun bool) (string, error) {
+	if len(updates) == 0 {
+		return ActionUnchanged, nil
+	}
+	if dryRun {
+		return ActionUpdate, nil
+	}
+	return ActionUpdate, tx.Model(record).Updates(updates).Error
+}
@@ -0,0 +1,30 @@
+// Package singleflight coalesces identical concurrent requests: while a call
+// for a key is running, later callers with the same key wait for it and
+// share its result instead of doing the work again. Only calls within this
+// process are coalesced.
+package singleflight
+
+import (
+	"context"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Group coalesces calls by key. The zero value is ready to use.
+type Group struct {
+	g singleflight.Group
+}
+
+// Do runs fn for key unless a call for key is already running, in which case
+// it waits for that call and returns its result. shared reports whether the
+// result went to more than one caller.
+//
+// fn gets ctx without its cancellation, so a caller that gives up doesn't
+// fail the others waiting on the same call.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, shared bool, err error) {
+	detached := context.WithoutCancel(ctx)
+	v, err, shared = g.g.Do(key, func() (interface{}, error) {
+		return fn(detached)
+	})
+	return v, shared, err
+}
@@ -0,0 +1,161 @@
+// Package startup records how long each component took to initialize, so a
+// slow or failed start can be traced to the step that caused it.
+package startup
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Entry statuses
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Entry is one initialized component
+type Entry struct {
+	Component string
+	Duration  time.Duration
+	Error     error
+}
+
+// Status is StatusFailed when the component returned an error
+func (e Entry) Status() string {
+	if e.Error != nil {
+		return StatusFailed
+	}
+	return StatusOK
+}
+
+// Step is an entry as JSON
+type Step struct {
+	Component  string  `json:"component"`
+	DurationMs float64 `json:"duration_ms"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Step returns e with its duration in milliseconds and its error as a string
+func (e Entry) Step() Step {
+	out := Step{
+		Component:  e.Component,
+		DurationMs: float64(e.Duration.Microseconds()) / 1000,
+		Status:     e.Status(),
+	}
+	if e.Error != nil {
+		out.Error = e.Error.Error()
+	}
+	return out
+}
+
+// MarshalJSON writes e as its Step
+func (e Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Step())
+}
+
+// Timeline is the list of components in the order they were initialized.
+// It is safe for concurrent use.
+type Timeline struct {
+	mu        sync.RWMutex
+	startedAt time.Time
+	entries   []Entry
+}
+
+// NewTimeline starts a timeline at the current time
+func NewTimeline() *Timeline {
+	return &Timeline{startedAt: time.Now()}
+}
+
+// Record runs fn, the initialization of component, and adds how long it
+// took and its error to the timeline. It returns fn's error.
+func (t *Timeline) Record(component string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	t.mu.Lock()
+	t.entries = append(t.entries, Entry{Component: component, Duration: time.Since(start), Error: err})
+	t.mu.Unlock()
+	return err
+}
+
+// Entries returns a copy of the recorded entries
+func (t *Timeline) Entries() []Entry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Entry(nil), t.entries...)
+}
+
+// Failed reports whether any component returned an error
+func (t *Timeline) Failed() bool {
+	for _, entry := range t.Entries() {
+		if entry.Error != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Total is the sum of the recorded durations
+func (t *Timeline) Total() time.Duration {
+	var total time.Duration
+	for _, entry := range t.Entries() {
+		total += entry.Duration
+	}
+	return total
+}
+
+// Summary is a timeline as logged and returned by Handler
+type Summary struct {
+	StartedAt       time.Time `json:"started_at"`
+	TotalDurationMs float64   `json:"total_duration_ms"`
+	Status          string    `json:"status"`
+	Components      []Step    `json:"components"`
+}
+
+// Summary returns the timeline's entries with its total duration and
+// status, which is StatusFailed when any component failed
+func (t *Timeline) Summary() Summary {
+	entries := t.Entries()
+	summary := Summary{
+		StartedAt:       t.startedAt,
+		TotalDurationMs: float64(t.Total().Microseconds()) / 1000,
+		Status:          StatusOK,
+		Components:      make([]Step, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		summary.Components = append(summary.Components, entry.Step())
+		if entry.Error != nil {
+			summary.Status = StatusFailed
+		}
+	}
+	return summary
+}
+
+// Fields is the summary as logger fields, for a single log entry
+func (t *Timeline) Fields() map[string]interface{} {
+	summary := t.Summary()
+	return map[string]interface{}{
+		"started_at":        summary.StartedAt,
+		"total_duration_ms": summary.TotalDurationMs,
+		"status":            summary.Status,
+		"components":        summary.Components,
+	}
+}
+
+// Handler godoc
+// @Summary      Get the startup timeline (admin only)
+// @Description  How long each component took to initialize when the server last started, and whether it failed
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200  {object} Summary
+// @Failure      429  {object} errors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/startup-timeline [get]
+func Handler(timeline *Timeline) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(timeline.Summary())
+	}
+}
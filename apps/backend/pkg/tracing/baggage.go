@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BaggageHeader carries W3C Baggage, key-value pairs such as a user or
+// tenant ID that travel with a request across services
+const BaggageHeader = "baggage"
+
+// Limits of a baggage header from the W3C Baggage spec
+const (
+	MaxBaggageMembers = 180
+	MaxBaggageBytes   = 8192
+)
+
+// baggageKey is the key format this API accepts, stricter than the spec's
+// token so keys can be used as log fields as is
+var baggageKey = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// ParseBaggage parses a baggage header value like "user-id=42,tenant=acme".
+// Values are percent-decoded and member properties after ";" are dropped.
+// Keys must match [a-z][a-z0-9_-]* and values must be URL-encoded; any
+// invalid member makes the whole header invalid.
+func ParseBaggage(value string) (map[string]string, error) {
+	baggage := map[string]string{}
+	if strings.TrimSpace(value) == "" {
+		return baggage, nil
+	}
+	if len(value) > MaxBaggageBytes {
+		return nil, fmt.Errorf("baggage is longer than %d bytes", MaxBaggageBytes)
+	}
+
+	members := strings.Split(value, ",")
+	if len(members) > MaxBaggageMembers {
+		return nil, fmt.Errorf("baggage has more than %d members", MaxBaggageMembers)
+	}
+	for _, member := range members {
+		member, _, _ = strings.Cut(member, ";")
+		key, raw, ok := strings.Cut(member, "=")
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !ok {
+			return nil, fmt.Errorf("baggage member %q has no value", member)
+		}
+		if !baggageKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid baggage key %q", key)
+		}
+		if !isBaggageValue(raw) {
+			return nil, fmt.Errorf("baggage value of %s must be URL-encoded", key)
+		}
+		decoded, err := url.PathUnescape(raw)
+		if err != nil {
+			return nil, fmt.Errorf("baggage value of %s must be URL-encoded: %w", key, err)
+		}
+		baggage[key] = decoded
+	}
+	return baggage, nil
+}
+
+// isBaggageValue reports whether s only has the characters the spec allows
+// in a value: printable ASCII except space, '"', ',', ';' and '\'
+func isBaggageValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x21 || c > 0x7e || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatBaggage formats baggage as a header value, keys sorted and values
+// URL-encoded
+func FormatBaggage(baggage map[string]string) string {
+	keys := make([]string, 0, len(baggage))
+	for key := range baggage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	members := make([]string, len(keys))
+	for i, key := range keys {
+		members[i] = key + "=" + url.PathEscape(baggage[key])
+	}
+	return strings.Join(members, ",")
+}
+
+type baggageContextKey struct{}
+
+// NewBaggageContext returns a copy of ctx carrying baggage
+func NewBaggageContext(ctx context.Context, baggage map[string]string) context.Context {
+	return context.WithValue(ctx, baggageContextKey{}, baggage)
+}
+
+// BaggageFromContext returns the baggage stored in ctx, nil if there is none
+func BaggageFromContext(ctx context.Context) map[string]string {
+	baggage, _ := ctx.Value(baggageContextKey{}).(map[string]string)
+	return baggage
+}
+
+// InjectBaggage sets the baggage header for an outbound call made on behalf
+// of the request in ctx. It does nothing if ctx has no baggage.
+func InjectBaggage(ctx context.Context, header http.Header) {
+	if baggage := BaggageFromContext(ctx); len(baggage) > 0 {
+		header.Set(BaggageHeader, FormatBaggage(baggage))
+	}
+}
@@ -0,0 +1,158 @@
+// Package tracing propagates W3C Trace Context (traceparent and tracestate
+// headers) so logs and outbound calls can be correlated with the request
+// that caused them, without an OpenTelemetry SDK.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+
+	// FlagSampled is the only trace flag defined by the spec
+	FlagSampled byte = 0x01
+)
+
+// SpanContext identifies the current span within a trace
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	// ParentSpanID is the caller's span, empty when this service started
+	// the trace
+	ParentSpanID string
+	Flags        byte
+	// State is the opaque vendor tracestate, forwarded unchanged
+	State string
+}
+
+// IsValid reports whether sc has a trace and span ID
+func (sc SpanContext) IsValid() bool {
+	return isValidID(sc.TraceID, 32) && isValidID(sc.SpanID, 16)
+}
+
+// Traceparent formats sc as a version 00 traceparent header value
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// TraceID returns a new random 16-byte trace ID as 32 lowercase hex digits
+func TraceID() string {
+	return randomID(16)
+}
+
+// SpanID returns a new random 8-byte span ID as 16 lowercase hex digits
+func SpanID() string {
+	return randomID(8)
+}
+
+func randomID(size int) string {
+	b := make([]byte, size)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("tracing: crypto/rand failed: %v", err))
+		}
+		// All-zero IDs are invalid
+		for _, v := range b {
+			if v != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+// ParseTraceparent parses a traceparent header value. The returned span
+// context describes the caller: its SpanID is the caller's span.
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("traceparent must have 4 fields")
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" {
+		return SpanContext{}, fmt.Errorf("invalid traceparent version %q", version)
+	}
+	// Version 00 has exactly 4 fields; later versions may append more
+	if version == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("traceparent version 00 must have 4 fields")
+	}
+	if !isValidID(traceID, 32) {
+		return SpanContext{}, fmt.Errorf("invalid trace ID %q", traceID)
+	}
+	if !isValidID(spanID, 16) {
+		return SpanContext{}, fmt.Errorf("invalid parent span ID %q", spanID)
+	}
+	if !isHex(flags, 2) {
+		return SpanContext{}, fmt.Errorf("invalid trace flags %q", flags)
+	}
+
+	flagBytes, _ := hex.DecodeString(flags)
+	return SpanContext{TraceID: traceID, SpanID: spanID, Flags: flagBytes[0]}, nil
+}
+
+// isValidID reports whether id is n lowercase hex digits, not all zero
+func isValidID(id string, n int) bool {
+	return isHex(id, n) && strings.Trim(id, "0") != ""
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Continue starts a span for work done on behalf of the caller described by
+// traceparent and tracestate. An invalid or missing traceparent starts a
+// new sampled trace.
+func Continue(traceparent, tracestate string) SpanContext {
+	parent, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return SpanContext{TraceID: TraceID(), SpanID: SpanID(), Flags: FlagSampled}
+	}
+	return SpanContext{
+		TraceID:      parent.TraceID,
+		SpanID:       SpanID(),
+		ParentSpanID: parent.SpanID,
+		Flags:        parent.Flags,
+		State:        tracestate,
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying sc
+func NewContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// FromContext returns the span context stored in ctx, if any
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(contextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Inject sets the traceparent and tracestate headers for an outbound call
+// made within the span in ctx. It does nothing if ctx has no span.
+func Inject(ctx context.Context, header http.Header) {
+	sc, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.State != "" {
+		header.Set(TracestateHeader, sc.State)
+	}
+}
@@ -0,0 +1,237 @@
+// Package validator checks request structs against their `validate` tags and
+// turns failures into field errors clients can display.
+package validator
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+	"github.com/go-playground/validator/v10"
+)
+
+// MinYear is the earliest publication year accepted, roughly when the
+// printing press arrived in Europe
+const MinYear = 1450
+
+// Roles are the values accepted by the role validator
+var Roles = []string{"user", "admin"}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// Report fields by their JSON name, which is what clients sent
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	// Replaces the built-in isbn check, which rejects hyphenated ISBNs
+	must(v.RegisterValidation("isbn", validateISBN))
+	must(v.RegisterValidation("book_year", validateBookYear))
+	must(v.RegisterValidation("role", validateRole))
+	must(v.RegisterValidation("cron", validateCron))
+	must(v.RegisterValidation("origin", validateOrigin))
+	return v
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ValidateStruct checks every field of s and returns one FieldError per
+// failed rule, or nil if s is valid
+func ValidateStruct(s interface{}) []apierrors.FieldError {
+	return fieldErrors(validate.Struct(s))
+}
+
+// ValidatePartial checks only the non-zero fields of s. Use it for partial
+// updates, where omitted fields keep their stored value.
+func ValidatePartial(s interface{}) []apierrors.FieldError {
+	v := reflect.Indirect(reflect.ValueOf(s))
+	if v.Kind() != reflect.Struct {
+		return ValidateStruct(s)
+	}
+
+	var fields []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.IsExported() && !field.Anonymous && !v.Field(i).IsZero() {
+			fields = append(fields, field.Name)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fieldErrors(validate.StructPartial(s, fields...))
+}
+
+func fieldErrors(err error) []apierrors.FieldError {
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []apierrors.FieldError{{Message: err.Error()}}
+	}
+
+	fields := make([]apierrors.FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		path := fieldPath(fe)
+		fields = append(fields, apierrors.FieldError{
+			Field:   fe.Field(),
+			Path:    path,
+			Tag:     fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return fields
+}
+
+// fieldPath returns the JSON path of the field, e.g. "author.name". The
+// namespace starts with the struct type's name, which clients never see.
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// message describes the failure. It doesn't name the field, which clients
+// find in the error's path.
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an http or https URL"
+	case "isbn":
+		return "must be a valid ISBN-10 or ISBN-13"
+	case "book_year":
+		return fmt.Sprintf("must be between %d and %d", MinYear, MaxYear())
+	case "role":
+		return fmt.Sprintf("must be one of: %s", strings.Join(Roles, ", "))
+	case "cron":
+		return `must be a cron expression like "0 8 * * 1"`
+	case "origin":
+		return "must be an origin like https://example.com"
+	}
+	return fmt.Sprintf("failed the %s rule", fe.Tag())
+}
+
+// MaxYear is the latest publication year accepted, allowing books
+// announced for next year
+func MaxYear() int {
+	return time.Now().Year() + 1
+}
+
+func validateBookYear(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		year := field.Int()
+		return year >= MinYear && year <= int64(MaxYear())
+	}
+	return false
+}
+
+func validateRole(fl validator.FieldLevel) bool {
+	role := fl.Field().String()
+	for _, r := range Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCron(fl validator.FieldLevel) bool {
+	_, err := scheduler.Parse(fl.Field().String())
+	return err == nil
+}
+
+func validateOrigin(fl validator.FieldLevel) bool {
+	return IsValidOrigin(fl.Field().String())
+}
+
+// IsValidOrigin reports whether s is a browser origin: an http or https
+// scheme and a host, with an optional port and trailing slash but no path,
+// query or credentials
+func IsValidOrigin(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+func validateISBN(fl validator.FieldLevel) bool {
+	return IsValidISBN(fl.Field().String())
+}
+
+// IsValidISBN reports whether s is an ISBN-10 or ISBN-13 with a correct
+// check digit. Hyphens and spaces are ignored.
+func IsValidISBN(s string) bool {
+	isbn := strings.NewReplacer("-", "", " ", "").Replace(s)
+
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			var digit int
+			switch {
+			case r >= '0' && r <= '9':
+				digit = int(r - '0')
+			case (r == 'X' || r == 'x') && i == 9:
+				digit = 10
+			default:
+				return false
+			}
+			sum += digit * (10 - i)
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, r := range isbn {
+			if r < '0' || r > '9' {
+				return false
+			}
+			digit := int(r - '0')
+			if i%2 == 1 {
+				digit *= 3
+			}
+			sum += digit
+		}
+		return sum%10 == 0
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Package privacy exports everything the library stores about a user, as
+// GDPR requires on request
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Handler serves the data exports. It limits how often users export through
+// the cache and logs every export.
+type Handler struct {
+	db       *gorm.DB
+	users    auth.Store
+	activity *activity.Handler
+	cache    cache.Cache
+	log      *logger.Logger
+}
+
+// NewHandler returns a Handler exporting the data stored in conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{
+		db:       conn,
+		users:    auth.NewDBStore(conn, log),
+		activity: activity.NewHandler(conn, c, log),
+		cache:    c,
+		log:      log,
+	}
+}
+
+// ExportInterval is how often users can export their own data
+const ExportInterval = 24 * time.Hour
+
+// Files of an export archive, in the order they are written
+var Files = []string{
+	"profile.json",
+	"books_created.json",
+	"reviews.json",
+	"ratings.json",
+	"bookmarks.json",
+	"reading_statuses.json",
+	"loans.json",
+	"search_history.json",
+	"activity_feed.json",
+}
+
+// Profile is a user's account without the password hash
+type Profile struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Export is the data stored about one user
+type Export struct {
+	Profile         Profile
+	BooksCreated    []book.Book
+	Ratings         []book.Rating
+	Bookmarks       []book.Bookmark
+	ReadingStatuses []book.ReadingStatus
+	Loans           []book.Loan
+	SearchHistory   []book.SearchHistory
+	Activity        []activity.Event
+	CreatedAt       time.Time
+}
+
+// Collect reads the data of user id. It returns gorm.ErrRecordNotFound for
+// users that don't exist or were deleted.
+func (h *Handler) Collect(ctx context.Context, id uint) (*Export, error) {
+	user, err := h.users.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	export := &Export{
+		Profile: Profile{
+			ID:          user.ID,
+			Username:    user.Username,
+			Email:       user.Email,
+			Role:        user.Role,
+			LastLoginAt: user.LastLoginAt,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+		},
+		BooksCreated:    []book.Book{},
+		Ratings:         []book.Rating{},
+		Bookmarks:       []book.Bookmark{},
+		ReadingStatuses: []book.ReadingStatus{},
+		Loans:           []book.Loan{},
+		SearchHistory:   []book.SearchHistory{},
+		CreatedAt:       time.Now().UTC(),
+	}
+
+	conn := h.db.WithContext(ctx)
+	for _, q := range []struct {
+		dest   interface{}
+		column string
+	}{
+		{&export.BooksCreated, "created_by_user_id"},
+		{&export.Ratings, "user_id"},
+		{&export.Bookmarks, "user_id"},
+		{&export.ReadingStatuses, "user_id"},
+		{&export.Loans, "user_id"},
+		{&export.SearchHistory, "user_id"},
+	} {
+		if err := conn.Where(q.column+" = ?", id).Order("id").Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if export.Activity, err = h.activity.ListAllUserActivity(ctx, id); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// WriteZip writes the export to w as a ZIP archive with one JSON file per
+// kind of data, named as in Files
+func (e *Export) WriteZip(w io.Writer) error {
+	contents := map[string]interface{}{
+		"profile.json":       e.Profile,
+		"books_created.json": e.BooksCreated,
+		// The library has no reviews; the file keeps the layout of the
+		// archive stable for when it does
+		"reviews.json":          []struct{}{},
+		"ratings.json":          e.Ratings,
+		"bookmarks.json":        e.Bookmarks,
+		"reading_statuses.json": e.ReadingStatuses,
+		"loans.json":            e.Loans,
+		"search_history.json":   e.SearchHistory,
+		"activity_feed.json":    e.Activity,
+	}
+
+	archive := zip.NewWriter(w)
+	for _, name := range Files {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: e.CreatedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(contents[name]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
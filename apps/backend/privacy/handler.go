@@ -0,0 +1,123 @@
+package privacy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ContentTypeZip is the content type of export archives
+const ContentTypeZip = "application/zip"
+
+func exportLimitKey(userID uint) string {
+	return fmt.Sprintf("privacy:export:%d", userID)
+}
+
+// ExportMyData godoc
+// @Summary      Export the current user's data
+// @Description  ZIP archive with profile.json (without the password), books_created.json, reviews.json, ratings.json, bookmarks.json, reading_statuses.json, loans.json, search_history.json and activity_feed.json. Allowed once every 24 hours.
+// @Tags         auth
+// @Produce      application/zip
+// @Security     Bearer
+// @Success      200  {string} string "ZIP archive"
+// @Failure      401  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.APIError
+// @Router       /me/export [get]
+func (h *Handler) ExportMyData(c *fiber.Ctx) error {
+	id, ok := middleware.UserID(c)
+	if !ok {
+		return apierrors.ErrInvalidToken.WithMessage("Invalid token claims")
+	}
+
+	// Without Redis exports aren't limited rather than refused
+	limited := false
+	if h.cache != nil {
+		allowed, err := h.cache.SetNX(exportLimitKey(id), true, ExportInterval)
+		if err != nil {
+			h.logError(err, "limit_data_export", id)
+		} else if !allowed {
+			return apierrors.ErrRateLimited.WithMessage("Your data can be exported once every 24 hours")
+		}
+		limited = err == nil
+	}
+
+	if err := h.sendExport(c, id); err != nil {
+		// A failed export doesn't count towards the limit
+		if limited {
+			h.cache.Delete(exportLimitKey(id))
+		}
+		return err
+	}
+	return nil
+}
+
+// ExportUserData godoc
+// @Summary      Export a user's data (admin only)
+// @Description  The archive of GET /me/export for any user, without its limit, to answer requests made outside the app.
+// @Tags         admin
+// @Produce      application/zip
+// @Security     Bearer
+// @Param        id   path     int  true  "User ID"
+// @Success      200  {string} string "ZIP archive"
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/users/{id}/export [get]
+func (h *Handler) ExportUserData(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid user ID")
+	}
+	return h.sendExport(c, uint(id))
+}
+
+// sendExport responds with the archive of user id and records who exported
+// it in the audit log
+func (h *Handler) sendExport(c *fiber.Ctx, id uint) error {
+	export, err := h.Collect(c.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrUserNotFound
+		}
+		h.logError(err, "export_user_data", id)
+		return apierrors.ErrDatabase.WithMessage("Failed to export user data")
+	}
+
+	var archive bytes.Buffer
+	if err := export.WriteZip(&archive); err != nil {
+		h.logError(err, "export_user_data", id)
+		return apierrors.ErrInternal.WithMessage("Failed to export user data")
+	}
+
+	if h.log != nil {
+		requestedBy := ""
+		if user, ok := middleware.CurrentUser(c); ok {
+			requestedBy = user.GetUsername()
+		}
+		h.log.Warn("User data exported", map[string]interface{}{
+			"event":        "data_export",
+			"user_id":      id,
+			"requested_by": requestedBy,
+			"ip":           c.IP(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, ContentTypeZip)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, id))
+	return c.SendStream(&archive, archive.Len())
+}
+
+func (h *Handler) logError(err error, operation string, userID uint) {
+	if h.log != nil {
+		h.log.LogError(err, map[string]interface{}{
+			"operation": operation,
+			"user_id":   userID,
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package report
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Handler serves the statistics and scheduled report endpoints and sends
+// the reports that are due
+type Handler struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+// NewHandler returns a Handler storing scheduled reports in conn
+func NewHandler(conn *gorm.DB, log *logger.Logger) *Handler {
+	return &Handler{db: conn, log: log}
+}
+
+// GetStats godoc
+// @Summary      Book and user totals (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {object} Stats
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/stats [get]
+func (h *Handler) GetStats(c *fiber.Ctx) error {
+	stats, err := h.CountStats(c.UserContext())
+	if err != nil {
+		h.logError(err, "get_stats", nil)
+		return apierrors.ErrDatabase.WithMessage("Failed to count books and users")
+	}
+	return c.JSON(stats)
+}
+
+// ScheduleReport godoc
+// @Summary      Email a report on a cron schedule (admin only)
+// @Description  schedule is a five-field cron expression in UTC, e.g. "0 8 * * 1" for Mondays at 08:00. Reports are sent over the SMTP server configured with SMTP_HOST.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        report  body  ScheduleRequest  true  "Report to schedule"
+// @Success      201  {object} ScheduledReport
+// @Failure      400  {object} apierrors.APIError
+// @Failure      401  {object} apierrors.APIError
+// @Failure      403  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/reports/schedule [post]
+func (h *Handler) ScheduleReport(c *fiber.Ctx) error {
+	var req ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+	next, err := scheduler.NextRun(req.Schedule, time.Now())
+	if err != nil {
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "schedule", Tag: "cron", Message: err.Error()})
+	}
+
+	report := ScheduledReport{
+		Report:    req.Report,
+		Schedule:  req.Schedule,
+		Email:     req.Email,
+		NextRunAt: next,
+	}
+	if userID, ok := middleware.UserID(c); ok {
+		report.CreatedByUserID = userID
+	}
+
+	if err := h.CreateScheduledReport(c.UserContext(), &report); err != nil {
+		h.logError(err, "schedule_report", map[string]interface{}{"report": report.Report})
+		return apierrors.ErrDatabase.WithMessage("Failed to schedule report")
+	}
+
+	return c.Status(201).JSON(report)
+}
+
+// ListScheduledReports godoc
+// @Summary      List scheduled reports (admin only)
+// @Tags         admin
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {array}  ScheduledReport
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/reports/scheduled [get]
+func (h *Handler) ListScheduledReports(c *fiber.Ctx) error {
+	reports, err := h.listScheduledReports(c.UserContext())
+	if err != nil {
+		h.logError(err, "list_scheduled_reports", nil)
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch scheduled reports")
+	}
+	return c.JSON(reports)
+}
+
+// DeleteScheduledReport godoc
+// @Summary      Stop sending a scheduled report (admin only)
+// @Tags         admin
+// @Security     Bearer
+// @Param        id   path  int  true  "Scheduled report ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/reports/scheduled/{id} [delete]
+func (h *Handler) DeleteScheduledReport(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid scheduled report ID")
+	}
+
+	if err := h.deleteScheduledReport(c.UserContext(), uint(id)); err != nil {
+		if err == ErrReportNotFound {
+			return apierrors.ErrScheduledReportNotFound
+		}
+		h.logError(err, "delete_scheduled_report", map[string]interface{}{"report_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to delete scheduled report")
+	}
+
+	return c.SendStatus(204)
+}
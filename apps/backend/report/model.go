@@ -0,0 +1,41 @@
+package report
+
+import "time"
+
+// Reports that can be scheduled
+const (
+	ReportStats = "stats"
+)
+
+// ScheduledReport is a report emailed whenever its cron schedule fires
+type ScheduledReport struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Report          string     `json:"report" gorm:"type:varchar(50);not null" example:"stats"`
+	Schedule        string     `json:"schedule" gorm:"type:varchar(100);not null" example:"0 8 * * 1"`
+	Email           string     `json:"email" gorm:"not null" example:"admin@example.com"`
+	NextRunAt       time.Time  `json:"next_run_at" gorm:"not null;index"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedByUserID uint       `json:"created_by_user_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (ScheduledReport) TableName() string {
+	return "reports"
+}
+
+// ScheduleRequest is the body for scheduling a report. Schedule is a
+// five-field cron expression evaluated in UTC.
+type ScheduleRequest struct {
+	Report   string `json:"report" validate:"required,oneof=stats" example:"stats"`
+	Schedule string `json:"schedule" validate:"required,cron" example:"0 8 * * 1"`
+	Email    string `json:"email" validate:"required,email" example:"admin@example.com"`
+}
+
+// Stats are the library totals shown by GET /admin/stats
+type Stats struct {
+	BooksTotal int64     `json:"books_total" example:"1500"`
+	UsersTotal int64     `json:"users_total" example:"320"`
+	Timestamp  time.Time `json:"timestamp"`
+}
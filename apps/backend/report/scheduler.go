@@ -0,0 +1,124 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/mail"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+)
+
+// Mailer sends the scheduled reports; without one every run fails with
+// mail.ErrNotConfigured
+var Mailer mail.Sender
+
+var statsEmail = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>Library statistics</h2>
+<table cellpadding="6" style="border-collapse: collapse">
+<tr><td>Books</td><td align="right"><strong>{{.Stats.BooksTotal}}</strong></td></tr>
+<tr><td>Users</td><td align="right"><strong>{{.Stats.UsersTotal}}</strong></td></tr>
+</table>
+<p style="color: #666">Generated {{.Stats.Timestamp.Format "2006-01-02 15:04 MST"}} for the schedule <code>{{.Schedule}}</code>.</p>
+</body>
+</html>
+`))
+
+// Render generates a scheduled report and returns its email subject and
+// HTML body
+func (h *Handler) Render(ctx context.Context, report *ScheduledReport) (subject, body string, err error) {
+	switch report.Report {
+	case ReportStats:
+		stats, err := h.CountStats(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		var buf bytes.Buffer
+		err = statsEmail.Execute(&buf, map[string]interface{}{"Stats": stats, "Schedule": report.Schedule})
+		if err != nil {
+			return "", "", err
+		}
+		return "Library statistics for " + stats.Timestamp.Format("2006-01-02"), buf.String(), nil
+	}
+	return "", "", fmt.Errorf("unknown report %q", report.Report)
+}
+
+// Send generates a report and emails it
+func (h *Handler) Send(ctx context.Context, report *ScheduledReport) error {
+	if Mailer == nil {
+		return mail.ErrNotConfigured
+	}
+	subject, body, err := h.Render(ctx, report)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send([]string{report.Email}, subject, body)
+}
+
+// RunDueReports sends the reports due at now and moves each to its next run.
+// Runs missed while the server was down are sent once, not once per missed
+// run. It returns the number of reports run, including failed ones, whose
+// error is stored in LastError.
+func (h *Handler) RunDueReports(ctx context.Context, now time.Time) (int, error) {
+	due, err := h.listDueReports(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for i := range due {
+		report := &due[i]
+		next, err := scheduler.NextRun(report.Schedule, now)
+		if err != nil {
+			h.logError(err, "schedule_report", map[string]interface{}{"report_id": report.ID})
+			continue
+		}
+		claimed, err := h.claimRun(ctx, report, next)
+		if err != nil {
+			return ran, err
+		}
+		if !claimed {
+			continue
+		}
+
+		runErr := h.Send(ctx, report)
+		if runErr != nil {
+			h.logError(runErr, "send_report", map[string]interface{}{"report_id": report.ID, "report": report.Report})
+		}
+		if err := h.recordRun(ctx, report.ID, now, runErr); err != nil {
+			return ran, err
+		}
+		ran++
+	}
+	return ran, nil
+}
+
+// StartReportScheduler checks every interval for reports that are due until
+// ctx is done
+func (h *Handler) StartReportScheduler(ctx context.Context, interval time.Duration) {
+	scheduler.Start(ctx, interval, func(ctx context.Context) {
+		ran, err := h.RunDueReports(ctx, time.Now())
+		if err != nil {
+			h.logError(err, "run_scheduled_reports", nil)
+			return
+		}
+		if ran > 0 && h.log != nil {
+			h.log.Info("Scheduled reports sent", map[string]interface{}{"reports": ran})
+		}
+	})
+}
+
+func (h *Handler) logError(err error, operation string, fields map[string]interface{}) {
+	if h.log == nil {
+		return
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["operation"] = operation
+	h.log.LogError(err, fields)
+}
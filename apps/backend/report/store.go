@@ -0,0 +1,81 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+)
+
+var ErrReportNotFound = errors.New("scheduled report not found")
+
+// CountStats counts the books and users and updates the matching gauges
+func (h *Handler) CountStats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := h.db.WithContext(ctx).Model(&book.Book{}).Count(&stats.BooksTotal).Error; err != nil {
+		return nil, err
+	}
+	if err := h.db.WithContext(ctx).Model(&auth.User{}).Count(&stats.UsersTotal).Error; err != nil {
+		return nil, err
+	}
+	stats.Timestamp = time.Now().UTC()
+
+	metrics.SetBooksTotal(float64(stats.BooksTotal))
+	metrics.SetUsersTotal(float64(stats.UsersTotal))
+	return &stats, nil
+}
+
+func (h *Handler) listScheduledReports(ctx context.Context) ([]ScheduledReport, error) {
+	var reports []ScheduledReport
+	if err := h.db.WithContext(ctx).Order("id").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (h *Handler) CreateScheduledReport(ctx context.Context, report *ScheduledReport) error {
+	return h.db.WithContext(ctx).Create(report).Error
+}
+
+func (h *Handler) deleteScheduledReport(ctx context.Context, id uint) error {
+	result := h.db.WithContext(ctx).Delete(&ScheduledReport{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
+
+// listDueReports returns the reports whose next run is at or before now
+func (h *Handler) listDueReports(ctx context.Context, now time.Time) ([]ScheduledReport, error) {
+	var reports []ScheduledReport
+	err := h.db.WithContext(ctx).Where("next_run_at <= ?", now).Order("next_run_at, id").Find(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// claimRun moves a due report to its next run time. It reports false if
+// another instance moved it first, so each run is only sent once.
+func (h *Handler) claimRun(ctx context.Context, report *ScheduledReport, next time.Time) (bool, error) {
+	result := h.db.WithContext(ctx).Model(&ScheduledReport{}).
+		Where("id = ? AND next_run_at = ?", report.ID, report.NextRunAt).
+		Update("next_run_at", next)
+	return result.RowsAffected == 1, result.Error
+}
+
+// recordRun stores when a report was last run and why it failed, if it did
+func (h *Handler) recordRun(ctx context.Context, id uint, ranAt time.Time, runErr error) error {
+	lastError := ""
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+	return h.db.WithContext(ctx).Model(&ScheduledReport{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_run_at": ranAt, "last_error": lastError}).Error
+}
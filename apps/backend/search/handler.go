@@ -0,0 +1,106 @@
+package search
+
+import (
+	"strings"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// minQueryLength keeps one-letter queries from matching most of the catalogue
+const minQueryLength = 2
+
+func queryParam(c *fiber.Ctx) (string, error) {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < minQueryLength {
+		return "", apierrors.ErrInvalidQuery.WithMessage("q must be at least 2 characters")
+	}
+	return q, nil
+}
+
+// Search godoc
+// @Summary      Search books, authors and series
+// @Description  Runs the query against each requested type in parallel. By default the response has one array per type plus the total matches per type; format=flat returns a single array ranked by relevance, each entry tagged with its type.
+// @Tags         search
+// @Produce      json
+// @Param        q      query string true  "Search text, at least 2 characters"
+// @Param        types  query string false "Comma-separated types to search" default(books,authors,series)
+// @Param        limit  query int    false "Maximum results per type" default(5)
+// @Param        format query string false "Response format" Enums(grouped, flat) default(grouped)
+// @Success      200 {object} map[string]interface{}
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /search [get]
+func (h *Handler) Search(c *fiber.Ctx) error {
+	q, err := queryParam(c)
+	if err != nil {
+		return err
+	}
+	types, err := ParseTypes(c.Query("types"))
+	if err != nil {
+		return apierrors.ErrInvalidQuery.WithMessage(err.Error())
+	}
+	limit := c.QueryInt("limit", 5)
+	if limit < 1 || limit > 50 {
+		limit = 5
+	}
+	format := c.Query("format", "grouped")
+	if format != "grouped" && format != "flat" {
+		return apierrors.ErrInvalidQuery.WithMessage("format must be grouped or flat")
+	}
+
+	results, err := h.search(c.UserContext(), q, types, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "global_search",
+				"query":     q,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Search failed")
+	}
+
+	if format == "flat" {
+		return c.JSON(fiber.Map{
+			"results": Rank(results, q),
+			"total":   results.Total,
+		})
+	}
+	return c.JSON(results.Map())
+}
+
+// Suggest godoc
+// @Summary      Typeahead suggestions
+// @Description  Book titles, author names and series names starting with q, shortest first
+// @Tags         search
+// @Produce      json
+// @Param        q      query string true  "Prefix, at least 2 characters"
+// @Param        limit  query int    false "Maximum suggestions" default(10)
+// @Success      200 {array}  Suggestion
+// @Failure      400 {object} apierrors.APIError
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /search/suggest [get]
+func (h *Handler) Suggest(c *fiber.Ctx) error {
+	q, err := queryParam(c)
+	if err != nil {
+		return err
+	}
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 20 {
+		limit = 10
+	}
+
+	suggestions, err := h.suggest(c.UserContext(), q, limit)
+	if err != nil {
+		if h.log != nil {
+			h.log.LogError(err, map[string]interface{}{
+				"operation": "search_suggest",
+				"query":     q,
+			})
+		}
+		return apierrors.ErrDatabase.WithMessage("Suggestions failed")
+	}
+	return c.JSON(suggestions)
+}
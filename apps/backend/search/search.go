@@ -0,0 +1,311 @@
+// Package search looks up books, authors and series with one query, for a
+// global search box and its typeahead.
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AtillaTahaK/gobooklibrary/author"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+// Handler serves the search endpoints. Books and series are searched in
+// books, authors through the author package; results are cached briefly.
+type Handler struct {
+	books   book.Store
+	authors *author.Handler
+	cache   cache.Cache
+	log     *logger.Logger
+}
+
+// NewHandler returns a Handler searching the catalogue in conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{books: book.NewDBStore(conn, log), authors: author.NewHandler(conn, c, log), cache: c, log: log}
+}
+
+// Searchable entity types
+const (
+	TypeBooks   = "books"
+	TypeAuthors = "authors"
+	TypeSeries  = "series"
+)
+
+// Types lists every searchable type, in response order
+var Types = []string{TypeBooks, TypeAuthors, TypeSeries}
+
+// cacheTTL is short because results aren't invalidated on writes
+const cacheTTL = 30 * time.Second
+
+// Results holds up to the per-type limit of matches for each searched type
+// and the total number of matches per type. Types that weren't searched are
+// nil.
+type Results struct {
+	Books   []book.Book      `json:"books"`
+	Authors []author.Author  `json:"authors"`
+	Series  []book.Series    `json:"series"`
+	Total   map[string]int64 `json:"total"`
+}
+
+// Map returns the results of the searched types keyed by type, with the
+// totals under "total"
+func (r *Results) Map() map[string]interface{} {
+	m := map[string]interface{}{"total": r.Total}
+	if r.Books != nil {
+		m[TypeBooks] = r.Books
+	}
+	if r.Authors != nil {
+		m[TypeAuthors] = r.Authors
+	}
+	if r.Series != nil {
+		m[TypeSeries] = r.Series
+	}
+	return m
+}
+
+// Hit is one result of the flat format
+type Hit struct {
+	Type  string      `json:"type" example:"books"`
+	ID    uint        `json:"id" example:"1"`
+	Title string      `json:"title" example:"The Hobbit"`
+	Score float64     `json:"score" example:"0.42"`
+	Item  interface{} `json:"item"`
+}
+
+// Suggestion is a typeahead completion
+type Suggestion struct {
+	Type string `json:"type" example:"authors"`
+	ID   uint   `json:"id" example:"3"`
+	Text string `json:"text" example:"J.R.R. Tolkien"`
+}
+
+// ParseTypes parses a comma-separated list of types. An empty list means
+// every type.
+func ParseTypes(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return Types, nil
+	}
+	requested := map[string]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name != TypeBooks && name != TypeAuthors && name != TypeSeries {
+			return nil, fmt.Errorf("unsupported type %q (supported: books, authors, series)", name)
+		}
+		requested[name] = true
+	}
+	// Keep the canonical order so equal requests share a cache key
+	var types []string
+	for _, name := range Types {
+		if requested[name] {
+			types = append(types, name)
+		}
+	}
+	return types, nil
+}
+
+// search runs the query for each type concurrently, returning up to limit
+// matches per type. Results are cached for 30 seconds.
+func (h *Handler) search(ctx context.Context, q string, types []string, limit int) (*Results, error) {
+	cacheKey := "search:global:" + hashKey(q, strings.Join(types, ","), limit)
+	if h.cache != nil {
+		var cached Results
+		if h.cache.Get(cacheKey, &cached) == nil {
+			return &cached, nil
+		}
+	}
+
+	results := &Results{Total: make(map[string]int64, len(types))}
+	totals := make([]int64, len(types))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, name := range types {
+		i, name := i, name
+		g.Go(func() error {
+			var err error
+			switch name {
+			case TypeBooks:
+				results.Books, totals[i], err = h.books.SearchBooksLimited(gctx, q, limit)
+			case TypeAuthors:
+				results.Authors, totals[i], err = h.authors.ListAuthors(gctx, q, 1, limit)
+			case TypeSeries:
+				results.Series, totals[i], err = h.books.SearchSeries(gctx, q, limit)
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for i, name := range types {
+		results.Total[name] = totals[i]
+		// Searched types with no matches are empty rather than nil
+		switch {
+		case name == TypeBooks && results.Books == nil:
+			results.Books = []book.Book{}
+		case name == TypeAuthors && results.Authors == nil:
+			results.Authors = []author.Author{}
+		case name == TypeSeries && results.Series == nil:
+			results.Series = []book.Series{}
+		}
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, results, cacheTTL)
+	}
+	return results, nil
+}
+
+// suggest returns up to limit completions whose title or name starts with
+// prefix, shortest first so the closest completions come first
+func (h *Handler) suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	cacheKey := "search:suggest:" + hashKey(prefix, "", limit)
+	suggestions := []Suggestion{}
+	if h.cache != nil && h.cache.Get(cacheKey, &suggestions) == nil {
+		return suggestions, nil
+	}
+
+	var (
+		books   []book.Book
+		authors []author.Author
+		series  []book.Series
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		books, err = h.books.SuggestBooks(gctx, prefix, limit)
+		return err
+	})
+	g.Go(func() (err error) {
+		authors, err = h.authors.SuggestAuthors(gctx, prefix, limit)
+		return err
+	})
+	g.Go(func() (err error) {
+		series, err = h.books.SuggestSeries(gctx, prefix, limit)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	for _, b := range books {
+		suggestions = append(suggestions, Suggestion{Type: TypeBooks, ID: b.ID, Text: b.Title})
+	}
+	for _, a := range authors {
+		suggestions = append(suggestions, Suggestion{Type: TypeAuthors, ID: a.ID, Text: a.Name})
+	}
+	for _, s := range series {
+		suggestions = append(suggestions, Suggestion{Type: TypeSeries, ID: s.ID, Text: s.Name})
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if len(suggestions[i].Text) != len(suggestions[j].Text) {
+			return len(suggestions[i].Text) < len(suggestions[j].Text)
+		}
+		return strings.ToLower(suggestions[i].Text) < strings.ToLower(suggestions[j].Text)
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	if h.cache != nil {
+		h.cache.Set(cacheKey, suggestions, cacheTTL)
+	}
+	return suggestions, nil
+}
+
+// document is the text a hit is ranked on. The title counts twice so
+// matches in it outrank matches in descriptions.
+type document struct {
+	hit   Hit
+	terms map[string]int
+	size  int
+}
+
+func newDocument(hit Hit, title string, body ...string) document {
+	doc := document{hit: hit, terms: map[string]int{}}
+	add := func(text string, weight int) {
+		for _, term := range tokenize(text) {
+			doc.terms[term] += weight
+			doc.size += weight
+		}
+	}
+	add(title, 2)
+	for _, text := range body {
+		add(text, 1)
+	}
+	return doc
+}
+
+// Rank merges the results into one list ordered by a TF-IDF score for the
+// terms of q. A term's frequency is its share of a result's words, and its
+// weight falls with the number of results containing it, so rare terms
+// decide the order. Terms also match as word prefixes so "tolk" ranks
+// "Tolkien". Ties keep the books, authors, series order.
+func Rank(results *Results, q string) []Hit {
+	var docs []document
+	for _, b := range results.Books {
+		docs = append(docs, newDocument(Hit{Type: TypeBooks, ID: b.ID, Title: b.Title, Item: b}, b.Title, b.Author, b.Genre))
+	}
+	for _, a := range results.Authors {
+		docs = append(docs, newDocument(Hit{Type: TypeAuthors, ID: a.ID, Title: a.Name, Item: a}, a.Name, a.Bio))
+	}
+	for _, s := range results.Series {
+		docs = append(docs, newDocument(Hit{Type: TypeSeries, ID: s.ID, Title: s.Name, Item: s}, s.Name, s.Description))
+	}
+
+	queryTerms := tokenize(q)
+	counts := make([][]int, len(docs))
+	docFreq := make([]int, len(queryTerms))
+	for i, doc := range docs {
+		counts[i] = make([]int, len(queryTerms))
+		for j, term := range queryTerms {
+			for word, n := range doc.terms {
+				if strings.HasPrefix(word, term) {
+					counts[i][j] += n
+				}
+			}
+			if counts[i][j] > 0 {
+				docFreq[j]++
+			}
+		}
+	}
+
+	hits := make([]Hit, len(docs))
+	for i, doc := range docs {
+		score := 0.0
+		for j := range queryTerms {
+			if counts[i][j] == 0 || doc.size == 0 {
+				continue
+			}
+			tf := float64(counts[i][j]) / float64(doc.size)
+			idf := math.Log(1 + float64(len(docs))/float64(docFreq[j]))
+			score += tf * idf
+		}
+		hits[i] = doc.hit
+		hits[i].Score = math.Round(score*1e4) / 1e4
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func hashKey(q, types string, limit int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", q, types, limit)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var activityColumns = []string{"event_type", "source_id", "user_id", "book_id", "book_title", "score", "query", "occurred_at"}
+
+func TestListUserActivity_PagesWithCursor(t *testing.T) {
+	conn, mock := mockDB(t)
+	c := newMemoryCache()
+	h := activity.NewHandler(conn, c, nil)
+	newest := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+
+	mock.ExpectQuery(`UNION ALL .* WHERE user_id = \$1 ORDER BY occurred_at DESC, event_type DESC, source_id DESC LIMIT \$2`).
+		WithArgs(3, 2).
+		WillReturnRows(sqlmock.NewRows(activityColumns).
+			AddRow(activity.TypeSearchPerformed, 9, 3, nil, nil, nil, "dune", newest).
+			AddRow(activity.TypeBookRated, 4, 3, 7, "Dune", 5, nil, newest.Add(-time.Minute)))
+
+	page, err := h.ListUserActivity(context.Background(), 3, "", 2)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "dune", *page.Events[0].Query)
+	assert.Nil(t, page.Events[0].BookID)
+	assert.Equal(t, 5, *page.Events[1].Score)
+	assert.Equal(t, "Dune", *page.Events[1].BookTitle)
+	require.NotEmpty(t, page.NextCursor)
+	assert.Equal(t, []string{"activity:user:3:2"}, c.keys())
+
+	// The cursor resumes after the last event of the page
+	mock.ExpectQuery(`WHERE user_id = \$1 AND \(occurred_at, event_type, source_id\) < \(\$2, \$3, \$4\)`).
+		WithArgs(3, newest.Add(-time.Minute), activity.TypeBookRated, 4, 2).
+		WillReturnRows(sqlmock.NewRows(activityColumns).
+			AddRow(activity.TypeBookBorrowed, 2, 3, 7, "Dune", nil, nil, newest.Add(-time.Hour)))
+
+	next, err := h.ListUserActivity(context.Background(), 3, page.NextCursor, 2)
+	require.NoError(t, err)
+	require.Len(t, next.Events, 1)
+	assert.Empty(t, next.NextCursor, "a short page is the last")
+
+	// The first page is cached until the user does something
+	cached, err := h.ListUserActivity(context.Background(), 3, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, page.NextCursor, cached.NextCursor)
+	h.Publish(activity.Event{Type: activity.TypeBookmarkAdded, UserID: 3})
+	assert.Empty(t, c.keys())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListUserActivity_RejectsForeignCursors(t *testing.T) {
+	h := activity.NewHandler(nil, nil, nil)
+	for _, cursor := range []string{"not base64!", "bm8gc2VwYXJhdG9ycw", "eHxib29rLnJhdGVkfDE"} {
+		_, err := h.ListUserActivity(context.Background(), 3, cursor, 20)
+		assert.ErrorIs(t, err, activity.ErrInvalidCursor, cursor)
+	}
+}
+
+func TestActivityStream_PushesPublishedEvents(t *testing.T) {
+	signer := tokens.NewHS256Signer([]byte("stream-secret"))
+	useSigner(t, signer)
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/ws/me/activity", middleware.TokenFromQuery(), middleware.JWTProtected(), activity.UpgradeHandler, activity.StreamHandler)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	url := fmt.Sprintf("ws://%s/ws/me/activity", ln.Addr())
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The handler subscribes after the upgrade
+	topic := activity.UserTopic(7)
+	require.Eventually(t, func() bool { return activity.Hub.Subscribers(topic) == 1 }, time.Second, 10*time.Millisecond)
+	var h *activity.Handler
+	h.Publish(activity.Event{Type: activity.TypeBookmarkAdded, UserID: 8})
+	h.Publish(activity.BookEvent(activity.TypeBookBorrowed, 7, 5, "Dune", time.Now()))
+
+	var event activity.Event
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	require.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, activity.TypeBookBorrowed, event.Type)
+	assert.Equal(t, "Dune", *event.BookTitle)
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return activity.Hub.Subscribers(topic) == 0 }, time.Second, 10*time.Millisecond)
+
+	// Plain requests aren't upgraded
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/ws/me/activity", ln.Addr()), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	plain, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	plain.Body.Close()
+	assert.Equal(t, http.StatusUpgradeRequired, plain.StatusCode)
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectAnnotationPage(mock sqlmock.Sqlmock, userID, bookID uint) {
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "annotations" WHERE user_id = \$1 AND book_id = \$2`).
+		WithArgs(userID, bookID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "annotations" WHERE user_id = \$1 AND book_id = \$2 ORDER BY passage_start, id LIMIT 20`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "user_id", "passage_start", "passage_end", "passage_text", "color"}).
+			AddRow(1, bookID, userID, 10, 40, "Fear is the mind-killer.", "yellow"))
+}
+
+func TestListAnnotations_CachedPerUserAndBook(t *testing.T) {
+	conn, mock := mockDB(t)
+	c := newMemoryCache()
+	h := book.NewBookHandler(book.NewDBStore(conn, nil), c, nil, nil)
+
+	expectAnnotationPage(mock, 3, 7)
+	page, err := h.ListAnnotations(context.Background(), 3, 7, "", 1, 20)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, page.Total)
+	require.Len(t, page.Annotations, 1)
+	assert.Equal(t, "Fear is the mind-killer.", page.Annotations[0].PassageText)
+
+	cached, err := h.ListAnnotations(context.Background(), 3, 7, "", 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, page, cached)
+	assert.Equal(t, []string{"annotations:3:7:1:20"}, c.keys())
+
+	// Searches always query
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "annotations" WHERE user_id = \$1 AND book_id = \$2 AND to_tsvector\('english', passage_text \|\| ' ' \|\| note\) @@ plainto_tsquery\('english', \$3\)`).
+		WithArgs(3, 7, "fear").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT \* FROM "annotations" WHERE .* ORDER BY passage_start, id LIMIT 20`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	found, err := h.ListAnnotations(context.Background(), 3, 7, "fear", 1, 20)
+	require.NoError(t, err)
+	assert.Empty(t, found.Annotations)
+	assert.Equal(t, []string{"annotations:3:7:1:20"}, c.keys())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func annotationApp(h *book.BookHandler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/books/:id/annotations", middleware.JWTProtected(), h.CreateAnnotation)
+	return app
+}
+
+func TestCreateAnnotation_DropsCachedPages(t *testing.T) {
+	conn, mock := mockDB(t)
+	c := newMemoryCache()
+	app := annotationApp(book.NewBookHandler(book.NewDBStore(conn, nil), c, nil, nil))
+	for _, key := range []string{"annotations:3:7:1:20", "annotations:3:7:2:20", "annotations:3:8:1:20", "annotations:4:7:1:20"} {
+		require.NoError(t, c.Set(key, book.AnnotationPage{}, book.AnnotationListTTL))
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Dune"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "annotations"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	resp := sendAs(t, app, http.MethodPost, "/books/7/annotations", `{"passage_start":10,"passage_end":40,"passage_text":"Fear is the mind-killer."}`, &auth.User{ID: 3, Username: "reader", Role: "user"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var annotation book.Annotation
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&annotation))
+	assert.Equal(t, book.DefaultAnnotationColor, annotation.Color)
+	assert.ElementsMatch(t, []string{"annotations:3:8:1:20", "annotations:4:7:1:20"}, c.keys(),
+		"only the user's pages of that book are dropped")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAnnotation_RejectsEmptyPassage(t *testing.T) {
+	conn, mock := mockDB(t)
+	_, err := book.NewDBStore(conn, nil).CreateAnnotation(context.Background(), 3, 7, book.AnnotationRequest{PassageStart: 40, PassageEnd: 40, PassageText: "x"})
+	assert.ErrorIs(t, err, book.ErrInvalidPassage)
+	assert.NoError(t, mock.ExpectationsWereMet(), "nothing is queried")
+}
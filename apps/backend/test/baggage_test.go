@@ -0,0 +1,148 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/external/googlebooks"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBaggage(t *testing.T) {
+	baggage, err := tracing.ParseBaggage("user-id=42, tenant=acme;ttl=60,flag_new_ui=on%2Coff,note=a+b%20c")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"user-id":     "42",
+		"tenant":      "acme",
+		"flag_new_ui": "on,off",
+		"note":        "a+b c",
+	}, baggage)
+
+	baggage, err = tracing.ParseBaggage("")
+	require.NoError(t, err)
+	assert.Empty(t, baggage)
+
+	invalid := []string{
+		"user-id",
+		"User-Id=42",
+		"1tenant=acme",
+		"tenant.name=acme",
+		"=acme",
+		"note=two words",
+		`note="quoted"`,
+		"note=100%",
+		"note=%zz",
+		"tenant=acme,,user-id=42",
+	}
+	for _, value := range invalid {
+		_, err := tracing.ParseBaggage(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestFormatBaggage_RoundTrips(t *testing.T) {
+	baggage := map[string]string{"tenant": "acme corp", "user-id": "42", "flags": "a,b;c"}
+	value := tracing.FormatBaggage(baggage)
+	assert.Equal(t, "flags=a%2Cb%3Bc,tenant=acme%20corp,user-id=42", value)
+
+	parsed, err := tracing.ParseBaggage(value)
+	require.NoError(t, err)
+	assert.Equal(t, baggage, parsed)
+}
+
+func baggageApp(handler fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.Baggage())
+	app.Get("/", handler)
+	return app
+}
+
+func TestBaggageMiddleware_StoresBaggage(t *testing.T) {
+	var locals, fromCtx map[string]string
+	app := baggageApp(func(c *fiber.Ctx) error {
+		locals, _ = c.Locals(middleware.BaggageKey).(map[string]string)
+		fromCtx = tracing.BaggageFromContext(c.UserContext())
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	for header, want := range map[string]map[string]string{
+		"user-id=42,tenant=acme": {"user-id": "42", "tenant": "acme"},
+		// Invalid headers are ignored, not forwarded
+		"User-Id=42": nil,
+		"":           nil,
+	} {
+		locals, fromCtx = nil, nil
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("baggage", header)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusNoContent, resp.StatusCode, header)
+		assert.Equal(t, want, locals, header)
+		assert.Equal(t, want, fromCtx, header)
+	}
+}
+
+func TestGoogleBooksForwardsBaggage(t *testing.T) {
+	received := make(chan http.Header, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.Write([]byte(`{"kind": "books#volumes", "totalItems": 0}`))
+	}))
+	defer server.Close()
+	client := googlebooks.NewClient("test-key")
+	client.BaseURL = server.URL
+
+	app := baggageApp(func(c *fiber.Ctx) error {
+		client.LookupByISBN(c.UserContext(), "9780452284234")
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("baggage", "user-id=42,tenant=acme%20corp")
+	_, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant=acme%20corp,user-id=42", (<-received).Get("baggage"))
+
+	// Nothing is forwarded for calls outside a request with baggage
+	client.LookupByISBN(context.Background(), "9780452284234")
+	assert.Empty(t, (<-received).Get("baggage"))
+}
+
+func TestLogEntryIncludesBaggage(t *testing.T) {
+	var out bytes.Buffer
+	l := logger.NewLogger()
+	l.SetOutput(&out)
+	l.SetJSONFormat(true)
+
+	app := baggageApp(func(c *fiber.Ctx) error {
+		l.LogRequest(c.Method(), c.Path(), c.IP(), "", 200, time.Millisecond, middleware.BaggageFields(c))
+		return nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("baggage", "user-id=42,tenant=acme")
+	_, err := app.Test(req)
+	require.NoError(t, err)
+
+	var entry logger.LogEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{"user-id": "42", "tenant": "acme"}, entry.Data["baggage"])
+
+	// Requests without baggage add no field
+	out.Reset()
+	_, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+	var plain logger.LogEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &plain))
+	assert.NotContains(t, plain.Data, "baggage")
+}
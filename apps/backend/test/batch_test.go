@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/batch"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchApp(concurrency int) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post(batch.Path, batch.Handler(app, concurrency))
+	app.Get("/items/:id", func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil || id > 100 {
+			return apierrors.ErrBookNotFound
+		}
+		return c.JSON(fiber.Map{"id": id})
+	})
+	app.Post("/items", func(c *fiber.Ctx) error {
+		if c.Get("Authorization") != "Bearer secret" {
+			return apierrors.ErrUnauthorized
+		}
+		var body map[string]interface{}
+		if err := c.BodyParser(&body); err != nil {
+			return apierrors.ErrInvalidRequestBody
+		}
+		body["created"] = true
+		return c.Status(fiber.StatusCreated).JSON(body)
+	})
+	app.Get("/panic", func(c *fiber.Ctx) error {
+		return fmt.Errorf("boom")
+	})
+	app.Get("/text", func(c *fiber.Ctx) error {
+		return c.SendString("plain")
+	})
+	return app
+}
+
+func postBatch(t *testing.T, app *fiber.App, body interface{}) (*http.Response, []batch.Result) {
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, batch.Path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := app.Test(req, 5000)
+	require.NoError(t, err)
+
+	var results []batch.Result
+	if resp.StatusCode == http.StatusMultiStatus {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+	}
+	return resp, results
+}
+
+func TestBatch_IndependentResults(t *testing.T) {
+	app := newBatchApp(batch.DefaultConcurrency)
+
+	resp, results := postBatch(t, app, batch.Request{Requests: []batch.Operation{
+		{Method: "GET", Path: "/items/1"},
+		{Method: "GET", Path: "/items/404"},
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"new"}`), Headers: map[string]string{"Authorization": "Bearer secret"}},
+		// The batch's own Authorization isn't passed on
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"anonymous"}`)},
+		{Method: "GET", Path: "/panic"},
+		{Method: "GET", Path: "/text"},
+		{Method: "GET", Path: "/items/2"},
+	}})
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	require.Len(t, results, 7)
+
+	statuses := make([]int, len(results))
+	for i, result := range results {
+		statuses[i] = result.Status
+	}
+	assert.Equal(t, []int{200, 404, 201, 401, 500, 200, 200}, statuses)
+
+	assert.Equal(t, map[string]interface{}{"id": float64(1)}, results[0].Body)
+	assert.Equal(t, "BOOK_NOT_FOUND", results[1].Body.(map[string]interface{})["code"])
+	assert.Equal(t, map[string]interface{}{"name": "new", "created": true}, results[2].Body)
+	assert.Equal(t, "plain", results[5].Body)
+	assert.Equal(t, map[string]interface{}{"id": float64(2)}, results[6].Body, "failures don't stop later operations")
+}
+
+func TestBatch_Validation(t *testing.T) {
+	app := newBatchApp(batch.DefaultConcurrency)
+
+	tooMany := make([]batch.Operation, batch.MaxOperations+1)
+	for i := range tooMany {
+		tooMany[i] = batch.Operation{Method: "GET", Path: "/items/1"}
+	}
+
+	for name, ops := range map[string][]batch.Operation{
+		"empty":          {},
+		"too many":       tooMany,
+		"bad method":     {{Method: "TRACE", Path: "/items/1"}},
+		"relative path":  {{Method: "GET", Path: "items/1"}},
+		"nested batch":   {{Method: "POST", Path: "/batch"}},
+		"nested w/query": {{Method: "POST", Path: "/batch?x=1"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, _ := postBatch(t, app, batch.Request{Requests: ops})
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+
+	resp, results := postBatch(t, app, batch.Request{Requests: tooMany[:batch.MaxOperations]})
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	assert.Len(t, results, batch.MaxOperations)
+}
+
+func TestBatch_Concurrency(t *testing.T) {
+	app := newBatchApp(2)
+	var running, peak int32
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	ops := make([]batch.Operation, 6)
+	for i := range ops {
+		ops[i] = batch.Operation{Method: "GET", Path: "/slow"}
+	}
+	resp, results := postBatch(t, app, batch.Request{Requests: ops})
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	for _, result := range results {
+		assert.Equal(t, http.StatusNoContent, result.Status)
+		assert.Nil(t, result.Body)
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&peak))
+}
+
+func TestBatchConcurrencyFromEnv(t *testing.T) {
+	t.Setenv("BATCH_CONCURRENCY", "")
+	n, err := batch.ConcurrencyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, batch.DefaultConcurrency, n)
+
+	t.Setenv("BATCH_CONCURRENCY", "12")
+	n, err = batch.ConcurrencyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 12, n)
+
+	t.Setenv("BATCH_CONCURRENCY", "0")
+	n, err = batch.ConcurrencyFromEnv()
+	assert.Error(t, err)
+	assert.Equal(t, batch.DefaultConcurrency, n)
+}
@@ -0,0 +1,328 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeBookStore is a book.Store over a map. The handler tests below use it
+// with their own cache, so they run in parallel. Store methods it doesn't
+// implement panic through the nil embedded interface.
+type fakeBookStore struct {
+	book.Store
+
+	mu     sync.Mutex
+	books  map[uint]book.Book
+	nextID uint
+	loads  int
+	// updateErr, when set, fails UpdateBook
+	updateErr error
+	// duplicates are returned by FindDuplicates for every title, failing it
+	// when duplicatesErr is set
+	duplicates    []dedup.Candidate
+	duplicatesErr error
+}
+
+func newFakeBookStore(books ...book.Book) *fakeBookStore {
+	s := &fakeBookStore{books: map[uint]book.Book{}, nextID: 1}
+	for _, b := range books {
+		s.books[b.ID] = b
+		if b.ID >= s.nextID {
+			s.nextID = b.ID + 1
+		}
+	}
+	return s
+}
+
+func (s *fakeBookStore) LoadBook(ctx context.Context, id uint) (*book.Book, error) {
+	s.mu.Lock()
+	s.loads++
+	s.mu.Unlock()
+	return s.GetBookByID(ctx, id)
+}
+
+func (s *fakeBookStore) LoadBooks(ctx context.Context, search string) ([]book.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	var books []book.Book
+	for id := uint(1); id < s.nextID; id++ {
+		if b, ok := s.books[id]; ok && strings.Contains(strings.ToLower(b.Title), strings.ToLower(search)) {
+			books = append(books, b)
+		}
+	}
+	return books, nil
+}
+
+func (s *fakeBookStore) GetBookByID(ctx context.Context, id uint) (*book.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.books[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &b, nil
+}
+
+func (s *fakeBookStore) GetBookSeriesID(ctx context.Context, bookID uint) (uint, error) {
+	return 0, nil
+}
+
+func (s *fakeBookStore) CreateBook(ctx context.Context, b *book.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.ID, b.Version = s.nextID, 1
+	s.nextID++
+	s.books[b.ID] = *b
+	return nil
+}
+
+func (s *fakeBookStore) UpdateBook(ctx context.Context, id uint, b *book.Book) (*book.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.updateErr != nil {
+		return nil, s.updateErr
+	}
+	current, ok := s.books[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if b.Title != "" {
+		current.Title = b.Title
+	}
+	current.Version++
+	s.books[id] = current
+	return &current, nil
+}
+
+func (s *fakeBookStore) DeleteBook(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.books[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if b.Status != book.StatusAvailable {
+		return book.ErrBookUnavailable
+	}
+	delete(s.books, id)
+	return nil
+}
+
+func (s *fakeBookStore) FindDuplicates(ctx context.Context, title string) ([]dedup.Candidate, error) {
+	return s.duplicates, s.duplicatesErr
+}
+
+// The fake has no users to attribute books to
+func (s *fakeBookStore) AttachAttribution(ctx context.Context, books []book.Book) error {
+	return nil
+}
+
+func bookHandlerApp(h *book.BookHandler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/books", h.GetBooks)
+	app.Get("/books/:id", h.GetBook)
+	app.Post("/books", h.AddBook)
+	app.Put("/books/:id", h.UpdateBook)
+	app.Delete("/books/:id", h.DeleteBook)
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, method, target, body string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestBookHandler_GetBookCachesLoadedBook(t *testing.T) {
+	t.Parallel()
+	store := newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965})
+	memory := newMemoryCache()
+	app := bookHandlerApp(book.NewBookHandler(store, memory, nil, nil))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send(t, app, http.MethodGet, "/books/1", "").StatusCode)
+	}
+	assert.Equal(t, 1, store.loads, "later reads come from the cache")
+	assert.Contains(t, memory.keys(), "book:1")
+
+	assert.Equal(t, http.StatusNotFound, send(t, app, http.MethodGet, "/books/2", "").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send(t, app, http.MethodGet, "/books/abc", "").StatusCode)
+}
+
+func TestBookHandler_WritesInvalidateCache(t *testing.T) {
+	t.Parallel()
+	store := newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965, Status: book.StatusAvailable, Version: 1})
+	memory := newMemoryCache()
+	app := bookHandlerApp(book.NewBookHandler(store, memory, nil, nil))
+
+	cached := func() {
+		memory.Set("books:all", []book.Book{}, time.Minute)
+		memory.Set("book:1", book.Book{ID: 1}, time.Minute)
+		memory.Set("facets:genre:", []book.FacetValue{}, time.Minute)
+	}
+
+	cached()
+	resp := send(t, app, http.MethodPost, "/books", `{"title": "Emma", "author": "Jane Austen", "year": 1815}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Len(t, store.books, 2)
+	assert.ElementsMatch(t, []string{"book:1"}, memory.keys())
+
+	cached()
+	resp = send(t, app, http.MethodPut, "/books/1", `{"title": "Dune Messiah", "version": 1}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Dune Messiah", store.books[1].Title)
+	assert.Empty(t, memory.keys())
+
+	cached()
+	assert.Equal(t, http.StatusNoContent, send(t, app, http.MethodDelete, "/books/1", "").StatusCode)
+	assert.NotContains(t, store.books, uint(1))
+	assert.Empty(t, memory.keys())
+}
+
+func TestBookHandler_AddBookRejectsPotentialDuplicates(t *testing.T) {
+	t.Parallel()
+	store := newFakeBookStore(book.Book{ID: 1, Title: "The Hobbit", Author: "J.R.R. Tolkien", Year: 1937})
+	store.duplicates = []dedup.Candidate{{ID: 1, Title: "The Hobbit", Author: "J.R.R. Tolkien", Similarity: 0.9}}
+	app := bookHandlerApp(book.NewBookHandler(store, nil, nil, nil))
+	body := `{"title": "The Hobbit!", "author": "Tolkien", "year": 1937}`
+
+	resp := send(t, app, http.MethodPost, "/books", body)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	var conflict struct {
+		Code    string        `json:"code"`
+		Details dedup.Details `json:"details"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&conflict))
+	assert.Equal(t, "POTENTIAL_DUPLICATE", conflict.Code)
+	assert.Equal(t, store.duplicates, conflict.Details.Candidates)
+	assert.Len(t, store.books, 1, "the book isn't added")
+
+	assert.Equal(t, http.StatusCreated, send(t, app, http.MethodPost, "/books?force=true", body).StatusCode)
+	assert.Len(t, store.books, 2)
+
+	store.duplicatesErr = errors.New("function similarity(text, unknown) does not exist")
+	assert.Equal(t, http.StatusCreated, send(t, app, http.MethodPost, "/books", body).StatusCode, "a failed check doesn't block adding")
+}
+
+func TestBookHandler_WriteErrors(t *testing.T) {
+	t.Parallel()
+	store := newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965, Status: book.StatusCheckedOut, Version: 2})
+	store.updateErr = &book.VersionConflictError{CurrentVersion: 2}
+	app := bookHandlerApp(book.NewBookHandler(store, nil, nil, nil))
+
+	assert.Equal(t, http.StatusBadRequest, send(t, app, http.MethodPost, "/books", `{"title": "Emma"}`).StatusCode)
+	resp := send(t, app, http.MethodPut, "/books/1", `{"title": "Dune", "version": 1}`)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	var conflict apierrors.VersionConflictBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&conflict))
+	assert.Equal(t, apierrors.VersionConflictBody{
+		Code:           "BOOK_VERSION_CONFLICT",
+		Error:          "conflict",
+		Message:        "Book was modified by another request, please refresh and retry",
+		CurrentVersion: 2,
+	}, conflict)
+	assert.Equal(t, http.StatusConflict, send(t, app, http.MethodDelete, "/books/1", "").StatusCode, "checked out books can't be deleted")
+	assert.Equal(t, http.StatusNotFound, send(t, app, http.MethodDelete, "/books/9", "").StatusCode)
+}
+
+func TestBookHandler_ValidatesYear(t *testing.T) {
+	t.Parallel()
+	year := time.Now().Year()
+	between := fmt.Sprintf("must be between 1450 and %d", year+1)
+
+	tests := []struct {
+		name    string
+		year    int
+		valid   bool
+		message string
+	}{
+		{"first printed books", 1450, true, ""},
+		{"after the minimum", 1451, true, ""},
+		{"current year", year, true, ""},
+		{"announced for next year", year + 1, true, ""},
+		{"two years ahead", year + 2, false, between},
+		{"before printing", 1449, false, between},
+		{"far future", 9999, false, between},
+		{"negative", -1, false, between},
+		{"zero", 0, false, "is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			store := newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965, Version: 1})
+			app := bookHandlerApp(book.NewBookHandler(store, nil, nil, nil))
+
+			created := send(t, app, http.MethodPost, "/books", fmt.Sprintf(`{"title": "Emma", "author": "Jane Austen", "year": %d}`, tt.year))
+			updated := send(t, app, http.MethodPut, "/books/1", fmt.Sprintf(`{"year": %d, "version": 1}`, tt.year))
+			if tt.valid {
+				assert.Equal(t, http.StatusCreated, created.StatusCode)
+				assert.Equal(t, http.StatusOK, updated.StatusCode)
+				return
+			}
+
+			require.Equal(t, http.StatusBadRequest, created.StatusCode)
+			var body apierrors.ValidationErrorBody
+			require.NoError(t, json.NewDecoder(created.Body).Decode(&body))
+			require.Len(t, body.ValidationErrors, 1)
+			assert.Equal(t, "year", body.ValidationErrors[0].Path)
+			assert.Equal(t, tt.message, body.ValidationErrors[0].Message)
+			assert.Len(t, store.books, 1, "the book isn't added")
+
+			if tt.year == 0 {
+				assert.Equal(t, http.StatusOK, updated.StatusCode, "updates without a year keep the stored one")
+			} else {
+				assert.Equal(t, http.StatusBadRequest, updated.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGetBooks_CombinesFilters(t *testing.T) {
+	conn, mock := mockDB(t)
+	app := bookHandlerApp(book.NewBookHandler(book.NewDBStore(conn, nil), nil, nil, nil))
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE books\.status = \$1 AND books\.created_by_user_id = \$2 AND "books"\."deleted_at" IS NULL ORDER BY books\.created_at DESC, books\.id DESC`).
+		WithArgs(book.StatusAvailable, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "created_by_user_id"}))
+	resp := send(t, app, http.MethodGet, "/books?status=available&created_by=7", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE books\.status = \$1 AND books\.genre_id = \$2 AND "books"\."deleted_at" IS NULL ORDER BY books\.title, books\.id`).
+		WithArgs(book.StatusLost, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "genre_id"}))
+	resp = send(t, app, http.MethodGet, "/books?status=lost&genre_id=3", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Listings with their own query reject the filters instead of ignoring them
+	for _, target := range []string{
+		"/books?status=available&series_id=2",
+		"/books?created_by=7&$filter=year%20ge%202000",
+		"/books?status=lost&sort=year",
+		"/books?genre_id=3&facets=genre",
+	} {
+		assert.Equal(t, http.StatusBadRequest, send(t, app, http.MethodGet, target, "").StatusCode, target)
+	}
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/go-redis/redismock/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedKeySizes expects a scan of every key and a STRLEN of each, answered
+// with sizes. A negative size is a key that doesn't hold a string.
+func seedKeySizes(mock redismock.ClientMock, keys []string, sizes map[string]int64) {
+	mock.ExpectScan(0, "*", 100).SetVal(keys, 0)
+	for _, key := range keys {
+		if sizes[key] < 0 {
+			mock.ExpectStrLen(key).SetErr(errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"))
+			continue
+		}
+		mock.ExpectStrLen(key).SetVal(sizes[key])
+	}
+}
+
+func TestAnalyzeCache(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	sizes := map[string]int64{
+		"book:1":        300,
+		"book:2":        5 << 10,
+		"books:all":     250 << 10,
+		"facets:genre:": 40 << 10,
+	}
+	keys := []string{"book:1", "book:2", "books:all", "facets:genre:"}
+	seedKeySizes(mock, keys, sizes)
+
+	analysis, err := cache.Analyze(cache.NewRedisCacheWithClient(client), cache.AnalysisConfig{MaxKeys: 100, MaxKeySizeBytes: 100 << 10})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, 4, analysis.TotalKeys)
+	assert.Equal(t, int64(300+5<<10+250<<10+40<<10), analysis.TotalBytes)
+	assert.Zero(t, analysis.NonStringKeys)
+	assert.Equal(t, map[string]int{cache.SizeUnder1KB: 1, cache.Size1To10KB: 1, cache.Size10To100KB: 1, cache.SizeOver100KB: 1}, analysis.SizeDistribution)
+	assert.Equal(t, []cache.KeySize{
+		{Key: "books:all", Bytes: 250 << 10},
+		{Key: "facets:genre:", Bytes: 40 << 10},
+		{Key: "book:2", Bytes: 5 << 10},
+		{Key: "book:1", Bytes: 300},
+	}, analysis.LargestKeys)
+	require.Len(t, analysis.Warnings, 1)
+	assert.Contains(t, analysis.Warnings[0], "books:all")
+	assert.True(t, analysis.Complete)
+	assert.Equal(t, float64(250<<10), gaugeValue(t, "cache_largest_key_bytes"))
+}
+
+func TestAnalyzeCache_SkipsNonStringKeys(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	// The mock fails a whole pipeline on one error, so the hash is scanned
+	// alone
+	seedKeySizes(mock, []string{"ratelimit:users"}, map[string]int64{"ratelimit:users": -1})
+
+	analysis, err := cache.Analyze(cache.NewRedisCacheWithClient(client), cache.AnalysisConfig{MaxKeys: 100, MaxKeySizeBytes: 100 << 10})
+	require.NoError(t, err)
+	assert.Zero(t, analysis.TotalKeys)
+	assert.Equal(t, 1, analysis.NonStringKeys)
+	assert.Empty(t, analysis.LargestKeys)
+}
+
+func TestAnalyzeCache_StopsAtMaxKeys(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	mock.ExpectScan(0, "*", 100).SetVal([]string{"a", "b", "c"}, 42)
+	mock.ExpectStrLen("a").SetVal(10)
+	mock.ExpectStrLen("b").SetVal(20)
+
+	analysis, err := cache.Analyze(cache.NewRedisCacheWithClient(client), cache.AnalysisConfig{MaxKeys: 2, MaxKeySizeBytes: 100 << 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, analysis.TotalKeys)
+	assert.False(t, analysis.Complete)
+	assert.Empty(t, analysis.Warnings)
+}
+
+func TestCacheAnalysisHandler(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	seedKeySizes(mock, []string{"book:1", "books:all"}, map[string]int64{"book:1": 512, "books:all": 2048})
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/cache/analysis", cache.AnalysisHandler(cache.NewRedisCacheWithClient(client), cache.AnalysisConfig{MaxKeys: 100, MaxKeySizeBytes: 1024}))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/cache/analysis", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, float64(2), body["total_keys"])
+	assert.Equal(t, float64(2560), body["total_bytes"])
+	assert.Equal(t, map[string]interface{}{"<1KB": float64(1), "1-10KB": float64(1), "10-100KB": float64(0), ">100KB": float64(0)}, body["size_distribution"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "books:all", "bytes": float64(2048)},
+		map[string]interface{}{"key": "book:1", "bytes": float64(512)},
+	}, body["largest_keys"])
+	assert.Len(t, body["warnings"], 1)
+
+	mock.ExpectScan(0, "*", 100).SetErr(errors.New("connection refused"))
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/admin/cache/analysis", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestAnalysisConfigFromEnv(t *testing.T) {
+	t.Setenv("CACHE_ANALYSIS_MAX_KEYS", "")
+	t.Setenv("CACHE_KEY_MAX_SIZE_BYTES", "")
+	config, err := cache.AnalysisConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cache.AnalysisConfig{MaxKeys: 10000, MaxKeySizeBytes: 100 << 10}, config)
+
+	t.Setenv("CACHE_ANALYSIS_MAX_KEYS", "500")
+	t.Setenv("CACHE_KEY_MAX_SIZE_BYTES", "2048")
+	config, err = cache.AnalysisConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cache.AnalysisConfig{MaxKeys: 500, MaxKeySizeBytes: 2048}, config)
+
+	t.Setenv("CACHE_KEY_MAX_SIZE_BYTES", "big")
+	_, err = cache.AnalysisConfigFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockExpectations interface {
+	ExpectSet(key string, value interface{}, expiration time.Duration) *redismock.ExpectedStatus
+	ExpectGet(key string) *redismock.ExpectedString
+	ExpectIncr(key string) *redismock.ExpectedInt
+	ExpectDel(keys ...string) *redismock.ExpectedInt
+	ExpectationsWereMet() error
+}
+
+// exerciseCache runs the same calls against any client type
+func exerciseCache(t *testing.T, c cache.Cache, mock mockExpectations) {
+	mock.ExpectSet("book:1", []byte(`{"title":"Dune"}`), time.Minute).SetVal("OK")
+	mock.ExpectGet("book:1").SetVal(`{"title":"Dune"}`)
+	mock.ExpectGet("book:2").RedisNil()
+	mock.ExpectIncr("views").SetVal(3)
+	mock.ExpectDel("book:1").SetVal(1)
+
+	require.NoError(t, c.Set("book:1", map[string]string{"title": "Dune"}, time.Minute))
+
+	var got map[string]string
+	require.NoError(t, c.Get("book:1", &got))
+	assert.Equal(t, "Dune", got["title"])
+	assert.Error(t, c.Get("book:2", &got))
+
+	n, err := c.Incr("views")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	require.NoError(t, c.Delete("book:1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheStandaloneClient(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	exerciseCache(t, cache.NewRedisCacheWithClient(client), mock)
+}
+
+// A sentinel failover client is a *redis.Client talking to the current
+// master, so the same mock stands in for it
+func TestCacheFailoverClient(t *testing.T) {
+	var client *redis.Client
+	client, mock := redismock.NewClientMock()
+	exerciseCache(t, cache.NewRedisCacheWithClient(client), mock)
+}
+
+func TestCacheClusterClient(t *testing.T) {
+	client, mock := redismock.NewClusterMock()
+	exerciseCache(t, cache.NewRedisCacheWithClient(client), mock)
+}
+
+func TestCacheGetWithSlidingTTL(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	mock.ExpectTxPipeline()
+	mock.ExpectGet("book:1").SetVal(`{"title":"Dune"}`)
+	mock.ExpectExpire("book:1", 10*time.Minute).SetVal(true)
+	mock.ExpectTxPipelineExec()
+
+	var got map[string]string
+	require.NoError(t, c.GetWithSlidingTTL("book:1", &got, 10*time.Minute))
+	assert.Equal(t, "Dune", got["title"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheGetWithSlidingTTLMissingKey(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	mock.ExpectTxPipeline()
+	mock.ExpectGet("book:2").RedisNil()
+	mock.ExpectExpire("book:2", 10*time.Minute).SetVal(false)
+	mock.ExpectTxPipelineExec()
+
+	var got map[string]string
+	err := c.GetWithSlidingTTL("book:2", &got, 10*time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "key not found")
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+	t.Setenv("REDIS_MODE", "Sentinel")
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("REDIS_DB", "3")
+	t.Setenv("REDIS_PASSWORD", "secret")
+	t.Setenv("REDIS_MASTER_NAME", "mymaster")
+	t.Setenv("REDIS_SENTINEL_ADDRS", "s1:26379, s2:26379,")
+
+	config := cache.ConfigFromEnv()
+	assert.Equal(t, cache.ModeSentinel, config.Mode)
+	assert.Equal(t, []string{"localhost:6379"}, config.Addrs)
+	assert.Equal(t, 3, config.DB)
+	assert.Equal(t, "secret", config.Password)
+	assert.Equal(t, "mymaster", config.MasterName)
+	assert.Equal(t, []string{"s1:26379", "s2:26379"}, config.SentinelAddrs)
+	assert.NoError(t, config.Validate())
+}
+
+func TestCacheConfigClusterAddrs(t *testing.T) {
+	t.Setenv("REDIS_MODE", "cluster")
+	t.Setenv("REDIS_URL", "n1:6379,n2:6379,n3:6379")
+
+	config := cache.ConfigFromEnv()
+	assert.Equal(t, cache.ModeCluster, config.Mode)
+	assert.Equal(t, []string{"n1:6379", "n2:6379", "n3:6379"}, config.Addrs)
+}
+
+func TestCacheConfigValidate(t *testing.T) {
+	assert.NoError(t, cache.Config{Mode: cache.ModeStandalone}.Validate())
+	assert.NoError(t, cache.Config{Mode: cache.ModeCluster}.Validate())
+	assert.Error(t, cache.Config{Mode: cache.ModeSentinel, SentinelAddrs: []string{"s1:26379"}}.Validate())
+	assert.Error(t, cache.Config{Mode: cache.ModeSentinel, MasterName: "mymaster"}.Validate())
+	assert.Error(t, cache.Config{Mode: "replicated"}.Validate())
+
+	_, err := cache.New(cache.Config{Mode: "replicated"})
+	assert.Error(t, err)
+}
+
+func TestNewCacheFromEnvFallsBackToStandalone(t *testing.T) {
+	t.Setenv("REDIS_MODE", "sentinel")
+	t.Setenv("REDIS_MASTER_NAME", "")
+	t.Setenv("REDIS_URL", "127.0.0.1:1")
+
+	c := cache.NewCacheFromEnv()
+	require.NotNil(t, c)
+	defer c.Close()
+	assert.Error(t, c.Ping())
+}
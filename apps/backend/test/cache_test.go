@@ -1,6 +1,7 @@
 package test
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -104,6 +105,28 @@ func (suite *RedisCacheTestSuite) TestExpiration() {
 	suite.False(exists)
 }
 
+func (suite *RedisCacheTestSuite) TestSlidingExpiration() {
+	err := suite.cache.Set("test:sliding", "hot value", 1*time.Second)
+	if err != nil {
+		suite.T().Skip("Redis not available, skipping test")
+		return
+	}
+
+	var value string
+	suite.NoError(suite.cache.GetWithSlidingTTL("test:sliding", &value, 1*time.Second))
+
+	// Second read just before the original TTL runs out resets it
+	time.Sleep(900 * time.Millisecond)
+	suite.NoError(suite.cache.GetWithSlidingTTL("test:sliding", &value, 1*time.Second))
+	suite.Equal("hot value", value)
+
+	// 1.1 seconds after Set the fixed TTL would have expired the key
+	time.Sleep(200 * time.Millisecond)
+	exists, err := suite.cache.Exists("test:sliding")
+	suite.NoError(err)
+	suite.True(exists)
+}
+
 func (suite *RedisCacheTestSuite) TestIncrement() {
 	// Test increment
 	val, err := suite.cache.Incr("test:counter")
@@ -164,6 +187,27 @@ func (suite *RedisCacheTestSuite) TestKeys() {
 	suite.Contains(keys, "test:pattern:2")
 }
 
+func (suite *RedisCacheTestSuite) TestScan() {
+	for i := 0; i < 250; i++ {
+		if err := suite.cache.Set(fmt.Sprintf("test:scan:%d", i), "value", 5*time.Minute); err != nil {
+			suite.T().Skip("Redis not available, skipping test")
+			return
+		}
+	}
+	suite.cache.Set("test:other:1", "value", 5*time.Minute)
+
+	keys, complete, err := suite.cache.Scan("test:scan:*", 1000)
+	suite.NoError(err)
+	suite.True(complete)
+	suite.Len(keys, 250)
+	suite.NotContains(keys, "test:other:1")
+
+	keys, complete, err = suite.cache.Scan("test:scan:*", 120)
+	suite.NoError(err)
+	suite.False(complete, "the scan stops at the limit")
+	suite.Len(keys, 120)
+}
+
 func (suite *RedisCacheTestSuite) TestTTL() {
 	// Set key with expiration
 	err := suite.cache.Set("test:ttl", "value", 10*time.Second)
@@ -179,6 +223,55 @@ func (suite *RedisCacheTestSuite) TestTTL() {
 	suite.True(ttl <= 10*time.Second)
 }
 
+func (suite *RedisCacheTestSuite) TestHyperLogLogEstimate() {
+	if err := suite.cache.Ping(); err != nil {
+		suite.T().Skip("Redis not available, skipping test")
+		return
+	}
+
+	// Add 10000 distinct visitors, each twice
+	const distinct = 10000
+	for round := 0; round < 2; round++ {
+		batch := make([]interface{}, 0, 500)
+		for i := 0; i < distinct; i++ {
+			batch = append(batch, fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+			if len(batch) == cap(batch) {
+				suite.NoError(suite.cache.PFAdd("test:hll", batch...))
+				batch = batch[:0]
+			}
+		}
+	}
+
+	count, err := suite.cache.PFCount("test:hll")
+	suite.NoError(err)
+	suite.InDelta(distinct, count, distinct*0.02, "estimate should be within 2 percent")
+
+	// Missing keys count as empty
+	count, err = suite.cache.PFCount("test:hll:missing")
+	suite.NoError(err)
+	suite.Equal(int64(0), count)
+}
+
+func (suite *RedisCacheTestSuite) TestCounterReadAndReset() {
+	if err := suite.cache.Ping(); err != nil {
+		suite.T().Skip("Redis not available, skipping test")
+		return
+	}
+
+	val, err := suite.cache.GetInt64("test:views")
+	suite.NoError(err)
+	suite.Equal(int64(0), val)
+
+	suite.cache.IncrBy("test:views", 3)
+	val, err = suite.cache.GetDelInt64("test:views")
+	suite.NoError(err)
+	suite.Equal(int64(3), val)
+
+	exists, err := suite.cache.Exists("test:views")
+	suite.NoError(err)
+	suite.False(exists)
+}
+
 func (suite *RedisCacheTestSuite) TestPing() {
 	err := suite.cache.Ping()
 	if err != nil {
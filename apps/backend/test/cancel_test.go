@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen serves app on a random local port, since app.Test has no real
+// connection for the client to close
+func listen(t *testing.T, app *fiber.App) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestCancelOnClientClose_CancelsWhenClientLeaves(t *testing.T) {
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	app := fiber.New()
+	app.Use(middleware.CancelOnClientClose())
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		select {
+		case <-c.UserContext().Done():
+			result <- c.UserContext().Err()
+		case <-time.After(5 * time.Second):
+			result <- nil
+		}
+		return nil
+	})
+
+	conn, err := net.Dial("tcp", listen(t, app))
+	require.NoError(t, err)
+	fmt.Fprint(conn, "GET /slow HTTP/1.1\r\nHost: test\r\n\r\n")
+	<-started
+	require.NoError(t, conn.Close())
+
+	select {
+	case err := <-result:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the handler's context wasn't cancelled")
+	}
+}
+
+func TestCancelOnClientClose_KeepsConnectionUsable(t *testing.T) {
+	app := fiber.New()
+	app.Use(middleware.CancelOnClientClose())
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		if err := c.UserContext().Err(); err != nil {
+			return err
+		}
+		return c.SendString("ok")
+	})
+
+	conn, err := net.Dial("tcp", listen(t, app))
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Sequential and pipelined requests on one keep-alive connection
+	fmt.Fprint(conn, "GET /ok HTTP/1.1\r\nHost: test\r\n\r\n")
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	fmt.Fprint(conn, "GET /ok HTTP/1.1\r\nHost: test\r\n\r\nGET /ok HTTP/1.1\r\nHost: test\r\n\r\n")
+	for i := 0; i < 2; i++ {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+}
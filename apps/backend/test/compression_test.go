@@ -0,0 +1,171 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressionApp(config middleware.CompressionConfig) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.Compression(config))
+	app.Get("/large", func(c *fiber.Ctx) error {
+		return c.SendString(strings.Repeat("compressible ", 200))
+	})
+	app.Get("/small", func(c *fiber.Ctx) error {
+		return c.SendString("tiny")
+	})
+	return app
+}
+
+func compressedGet(t *testing.T, app *fiber.App, path, acceptEncoding string) (*http.Response, []byte) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func TestCompression_Brotli(t *testing.T) {
+	app := compressionApp(middleware.CompressionConfig{})
+
+	resp, body := compressedGet(t, app, "/large", "gzip, deflate, br")
+	require.Equal(t, "br", resp.Header.Get("Content-Encoding"))
+	assert.Contains(t, resp.Header.Get("Vary"), "Accept-Encoding")
+
+	decoded, err := io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("compressible ", 200), string(decoded))
+	assert.Less(t, len(body), len(decoded))
+}
+
+func TestCompression_Negotiation(t *testing.T) {
+	tests := []struct {
+		name           string
+		algorithm      string
+		acceptEncoding string
+		want           string
+	}{
+		{"auto prefers brotli", middleware.CompressionAuto, "gzip, br", "br"},
+		{"auto falls back to gzip", middleware.CompressionAuto, "gzip", "gzip"},
+		{"refused brotli", middleware.CompressionAuto, "br;q=0, gzip", "gzip"},
+		{"wildcard", middleware.CompressionAuto, "*", "br"},
+		{"gzip only", middleware.CompressionGzip, "br, gzip", "gzip"},
+		{"brotli only", middleware.CompressionBrotli, "gzip", ""},
+		{"no accept encoding", middleware.CompressionAuto, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := compressionApp(middleware.CompressionConfig{Algorithm: tt.algorithm})
+			resp, _ := compressedGet(t, app, "/large", tt.acceptEncoding)
+			assert.Equal(t, tt.want, resp.Header.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestCompression_GzipLevel(t *testing.T) {
+	app := compressionApp(middleware.CompressionConfig{Algorithm: middleware.CompressionGzip, Level: 9})
+
+	resp, body := compressedGet(t, app, "/large", "gzip")
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("compressible ", 200), string(decoded))
+}
+
+func TestCompression_SkipsSmallResponses(t *testing.T) {
+	app := compressionApp(middleware.CompressionConfig{})
+
+	resp, body := compressedGet(t, app, "/small", "br, gzip")
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "tiny", string(body))
+}
+
+func TestCompressionConfigFromEnv(t *testing.T) {
+	t.Setenv("COMPRESSION_ALGORITHM", "Brotli")
+	t.Setenv("COMPRESSION_LEVEL", "11")
+	config, err := middleware.CompressionConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, middleware.CompressionBrotli, config.Algorithm)
+	assert.Equal(t, 11, config.Level)
+
+	t.Setenv("COMPRESSION_ALGORITHM", "gzip")
+	_, err = middleware.CompressionConfigFromEnv()
+	assert.Error(t, err, "11 is out of range for gzip")
+
+	t.Setenv("COMPRESSION_ALGORITHM", "zstd")
+	t.Setenv("COMPRESSION_LEVEL", "")
+	_, err = middleware.CompressionConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("COMPRESSION_ALGORITHM", "")
+	config, err = middleware.CompressionConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, middleware.CompressionAuto, config.Algorithm)
+}
+
+// BenchmarkCompression compares gzip and Brotli on a list of 100 books,
+// reporting the compressed size as a percentage of the original
+func BenchmarkCompression(b *testing.B) {
+	books := make([]book.Book, 100)
+	for i := range books {
+		books[i] = book.Book{
+			ID:     uint(i + 1),
+			Title:  fmt.Sprintf("The Collected Works, Volume %d", i+1),
+			Author: fmt.Sprintf("Author %d", i%20),
+			Year:   1900 + i,
+			Genre:  []string{"Fiction", "Mystery", "Science", "History"}[i%4],
+			ISBN:   fmt.Sprintf("978-3-16-%06d-0", i),
+		}
+	}
+	payload, err := json.Marshal(books)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, algorithm := range []string{middleware.CompressionGzip, middleware.CompressionBrotli} {
+		b.Run(algorithm, func(b *testing.B) {
+			app := fiber.New()
+			app.Use(middleware.Compression(middleware.CompressionConfig{Algorithm: algorithm}))
+			app.Get("/books", func(c *fiber.Ctx) error {
+				c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				return c.Send(payload)
+			})
+
+			var compressed int
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/books", nil)
+				req.Header.Set("Accept-Encoding", "br, gzip")
+				resp, err := app.Test(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				compressed = len(body)
+			}
+			b.ReportMetric(100*float64(compressed)/float64(len(payload)), "%size")
+		})
+	}
+}
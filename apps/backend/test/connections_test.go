@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/activity"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/requestlog"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useConnections(t *testing.T) *pubsub.ConnectionManager {
+	previous := pubsub.Connections
+	pubsub.Connections = pubsub.NewConnectionManager()
+	t.Cleanup(func() { pubsub.Connections = previous })
+	return pubsub.Connections
+}
+
+// serveUntilClosed tracks a connection that ends once it is asked to
+func serveUntilClosed(m *pubsub.ConnectionManager, connType string, onClose func()) {
+	conn := m.Track(connType, onClose)
+	go func() {
+		<-conn.Closing()
+		conn.Close()
+	}()
+}
+
+func TestConnectionManager_CloseAll(t *testing.T) {
+	m := pubsub.NewConnectionManager()
+	var closeFrames int32
+	for i := 0; i < 3; i++ {
+		serveUntilClosed(m, pubsub.ConnectionWebSocket, func() { atomic.AddInt32(&closeFrames, 1) })
+	}
+	serveUntilClosed(m, pubsub.ConnectionSSE, nil)
+	assert.Equal(t, map[string]int{pubsub.ConnectionWebSocket: 3, pubsub.ConnectionSSE: 1}, m.Counts())
+
+	require.NoError(t, m.CloseAll(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&closeFrames), "every WebSocket gets a close frame")
+	assert.Equal(t, map[string]int{pubsub.ConnectionWebSocket: 0, pubsub.ConnectionSSE: 0}, m.Counts())
+
+	// Connections opened during shutdown are closed right away
+	late := m.Track(pubsub.ConnectionSSE, nil)
+	select {
+	case <-late.Closing():
+	default:
+		t.Fatal("connection tracked after CloseAll wasn't closed")
+	}
+}
+
+func TestConnectionManager_CloseAllTimesOut(t *testing.T) {
+	m := pubsub.NewConnectionManager()
+	serveUntilClosed(m, pubsub.ConnectionSSE, nil)
+	stuck := m.Track(pubsub.ConnectionWebSocket, nil)
+	defer stuck.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.CloseAll(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "1 connections still open")
+}
+
+func TestCloseAll_ClosesWebSocketAndSSEClients(t *testing.T) {
+	m := useConnections(t)
+	token := signedToken(t, "admin")
+	tail := requestlog.NewTail(requestlog.DefaultBufferSize)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/ws/me/activity", middleware.TokenFromQuery(), middleware.JWTProtected(), activity.UpgradeHandler, activity.StreamHandler)
+	app.Get("/admin/requests/live", middleware.TokenFromQuery(), middleware.JWTProtected(), middleware.RequireAdmin(), requestlog.LiveHandler(tail))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	var sockets []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/ws/me/activity?access_token=%s", ln.Addr(), token), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		sockets = append(sockets, conn)
+	}
+	stream := openLiveRequests(t, tail, fmt.Sprintf("http://%s/admin/requests/live?access_token=%s", ln.Addr(), token), nil)
+	require.Eventually(t, func() bool {
+		return m.Counts()[pubsub.ConnectionWebSocket] == 2 && m.Counts()[pubsub.ConnectionSSE] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pubsub.CloseTimeout)
+	defer cancel()
+	require.NoError(t, m.CloseAll(ctx))
+
+	for _, conn := range sockets {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+	}
+	rest, err := io.ReadAll(stream)
+	require.NoError(t, err, "the event stream ends")
+	assert.NotContains(t, string(rest), "data:")
+	assert.Equal(t, map[string]int{pubsub.ConnectionWebSocket: 0, pubsub.ConnectionSSE: 0}, m.Counts())
+}
+
+func TestConnectionsHandler(t *testing.T) {
+	m := pubsub.NewConnectionManager()
+	serveUntilClosed(m, pubsub.ConnectionWebSocket, nil)
+	serveUntilClosed(m, pubsub.ConnectionWebSocket, nil)
+	serveUntilClosed(m, pubsub.ConnectionSSE, nil)
+	t.Cleanup(func() { m.CloseAll(context.Background()) })
+
+	app := fiber.New()
+	app.Get("/admin/connections", pubsub.ConnectionsHandler(m))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/connections", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body pubsub.ConnectionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 3, body.Total)
+	assert.Equal(t, map[string]int{"websocket": 2, "sse": 1}, body.ByType)
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/container"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestContainerNew_UsesSuppliedServices(t *testing.T) {
+	conn, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test"), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	log := logger.NewLogger()
+	store := newMemoryCache()
+	collector := metrics.NewMetricsCollector()
+
+	services, err := container.New(container.Config{Logger: log, Cache: store, DB: conn, Metrics: collector})
+	require.NoError(t, err)
+	assert.Same(t, log, services.Log)
+	assert.Same(t, store, services.Cache)
+	assert.Same(t, conn, services.DB)
+	assert.Same(t, collector, services.Metrics)
+}
+
+func TestContainer_WiresBookEvents(t *testing.T) {
+	conn, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test"), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	services, err := container.New(container.Config{Cache: newMemoryCache(), DB: conn})
+	require.NoError(t, err)
+	books := services.BookHandler()
+	assert.NotNil(t, books.Webhooks)
+	assert.NotNil(t, books.Activity)
+	assert.NotNil(t, services.AuthHandler().Webhooks)
+}
+
+func TestContainerNew_CreatesMissingServices(t *testing.T) {
+	conn, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test"), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	services, err := container.New(container.Config{Cache: newMemoryCache(), DB: conn})
+	require.NoError(t, err)
+	assert.NotNil(t, services.Log)
+	assert.NotNil(t, services.Metrics)
+}
+
+func TestContainerNew_ReturnsDatabaseError(t *testing.T) {
+	t.Setenv("DATABASE_URL", "host=127.0.0.1 port=1 user=test dbname=test connect_timeout=1")
+
+	_, err := container.New(container.Config{Logger: logger.NewLogger(), Cache: newMemoryCache()})
+	assert.ErrorContains(t, err, "failed to connect to database")
+}
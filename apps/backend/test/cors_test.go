@@ -0,0 +1,96 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func corsApp(config middleware.CORSConfig) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.DynamicCORS(config))
+	app.Get("/books", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func corsRequest(t *testing.T, app *fiber.App, method, origin string) (allowOrigin string, status int) {
+	req := httptest.NewRequest(method, "/books", nil)
+	req.Header.Set("Origin", origin)
+	if method == "OPTIONS" {
+		req.Header.Set("Access-Control-Request-Method", "GET")
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.Header.Get("Access-Control-Allow-Origin"), resp.StatusCode
+}
+
+func TestDynamicCORS_LoadsOriginsPerRequest(t *testing.T) {
+	origins := []string{"https://app.example.com"}
+	app := corsApp(middleware.CORSConfig{
+		Origins:      func(context.Context) ([]string, error) { return origins, nil },
+		AllowMethods: "GET,POST",
+	})
+
+	allowed, status := corsRequest(t, app, "GET", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", allowed)
+	assert.Equal(t, 200, status)
+
+	allowed, status = corsRequest(t, app, "OPTIONS", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", allowed)
+	assert.Equal(t, 204, status)
+
+	origins = nil
+	allowed, _ = corsRequest(t, app, "GET", "https://app.example.com")
+	assert.Empty(t, allowed, "removed origins are rejected without a restart")
+	allowed, status = corsRequest(t, app, "OPTIONS", "https://app.example.com")
+	assert.Empty(t, allowed)
+	assert.Equal(t, 204, status)
+}
+
+func TestDynamicCORS_FallsBackToStaticOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000, https://admin.example.com/")
+	config := middleware.CORSConfigFromEnv()
+	loads := 0
+	config.Origins = func(context.Context) ([]string, error) {
+		loads++
+		return nil, errors.New("redis: connection refused")
+	}
+	app := corsApp(config)
+
+	allowed, _ := corsRequest(t, app, "GET", "https://admin.example.com")
+	assert.Equal(t, "https://admin.example.com", allowed)
+	assert.Zero(t, loads, "static origins don't need a lookup")
+
+	allowed, _ = corsRequest(t, app, "GET", "https://app.example.com")
+	assert.Empty(t, allowed)
+	assert.Equal(t, 1, loads)
+}
+
+func TestIsValidOrigin(t *testing.T) {
+	for _, origin := range []string{"https://app.example.com", "http://localhost:3000", "https://app.example.com/"} {
+		assert.True(t, validator.IsValidOrigin(origin), origin)
+	}
+	for _, origin := range []string{"app.example.com", "ftp://example.com", "https://example.com/app", "https://example.com?a=1", "https://user@example.com", ""} {
+		assert.False(t, validator.IsValidOrigin(origin), origin)
+	}
+}
+
+func TestCORSConfigFromEnv_AllowsAnyOriginUntilConfigured(t *testing.T) {
+	// Setenv restores the variable after the test
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	require.NoError(t, os.Unsetenv("CORS_ALLOWED_ORIGINS"))
+	assert.Equal(t, []string{"*"}, middleware.CORSConfigFromEnv().Static, "unset keeps the allow-all default")
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	app := corsApp(middleware.CORSConfigFromEnv())
+	allowed, _ := corsRequest(t, app, "GET", "https://app.example.com")
+	assert.Empty(t, allowed, "set but empty, only managed origins are allowed")
+}
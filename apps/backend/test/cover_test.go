@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// requireWellFormedXML decodes every token of doc
+func requireWellFormedXML(t *testing.T, doc string) {
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err, doc)
+	}
+}
+
+func coverApp(conn *gorm.DB, c cache.Cache) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	h := book.NewBookHandler(book.NewDBStore(conn, nil), c, nil, nil)
+	app.Get("/books/:id/cover", h.GetCover)
+	app.Get("/books/:id/cover/placeholder", h.GetCoverPlaceholder)
+	return app
+}
+
+func TestPlaceholderSVG_WellFormed(t *testing.T) {
+	for _, title := range []string{"Dune", "Pride & Prejudice", `The "<Odd>" Title`, "", "   ", "¿Qué?", "1984"} {
+		svg := book.PlaceholderSVG(title)
+		requireWellFormedXML(t, svg)
+		assert.Contains(t, svg, `<rect width="200" height="300" rx="16" ry="16" fill="`+book.PlaceholderColor(title)+`"/>`)
+		assert.Contains(t, svg, `fill="#ffffff"`)
+	}
+}
+
+func TestPlaceholderColor_ConsistentPerTitle(t *testing.T) {
+	assert.Equal(t, book.PlaceholderColor("Dune"), book.PlaceholderColor("Dune"))
+	assert.Equal(t, book.PlaceholderSVG("Dune"), book.PlaceholderSVG("Dune"))
+	assert.Contains(t, book.CoverPalette, book.PlaceholderColor("Dune"))
+
+	colors := map[string]bool{}
+	for _, title := range []string{"Dune", "Emma", "Ulysses", "Beloved", "Hamlet", "Middlemarch", "Dracula", "Walden"} {
+		colors[book.PlaceholderColor(title)] = true
+	}
+	assert.Greater(t, len(colors), 1, "titles are spread over the palette")
+}
+
+func TestPlaceholderInitials(t *testing.T) {
+	assert.Equal(t, "TL", book.PlaceholderInitials("The lord of the rings"))
+	assert.Equal(t, "D", book.PlaceholderInitials("Dune"))
+	assert.Equal(t, "PP", book.PlaceholderInitials("\"Pride\" & prejudice"))
+	assert.Equal(t, "?", book.PlaceholderInitials(" - "))
+}
+
+func TestGetCoverPlaceholderHandler_CachesSVG(t *testing.T) {
+	conn, mock := mockDB(t)
+	memory := newMemoryCache()
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(7, "Dune", "Frank Herbert", 1965, "available", 1))
+
+	app := coverApp(conn, memory)
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/books/7/cover/placeholder", nil))
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "public, max-age=86400", resp.Header.Get("Cache-Control"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, book.PlaceholderSVG("Dune"), string(body))
+	}
+	// The second request was served from the cache
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []string{"book:7:cover:placeholder"}, memory.keys())
+}
+
+func TestGetCoverHandler_Redirects(t *testing.T) {
+	conn, mock := mockDB(t)
+	columns := append(append([]string{}, bookColumns...), "cover_url")
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "Dune", "Frank Herbert", 1965, "available", 1, "https://example.com/dune.jpg"))
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(8, "Emma", "Jane Austen", 1815, "available", 1, ""))
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	app := coverApp(conn, nil)
+	resp, err := app.Test(httptest.NewRequest("GET", "/books/7/cover", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 302, resp.StatusCode)
+	assert.Equal(t, "https://example.com/dune.jpg", resp.Header.Get("Location"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/books/8/cover", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 302, resp.StatusCode)
+	assert.Equal(t, "/books/8/cover/placeholder", resp.Header.Get("Location"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/books/9/cover", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
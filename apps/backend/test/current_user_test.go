@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useUsers makes InjectUser load users from users
+func useUsers(t *testing.T, users map[uint]*auth.User) {
+	previous := middleware.LoadUser
+	middleware.LoadUser = func(ctx context.Context, id uint) (middleware.User, error) {
+		user, ok := users[id]
+		if !ok {
+			return nil, middleware.ErrUserNotFound
+		}
+		return user, nil
+	}
+	t.Cleanup(func() { middleware.LoadUser = previous })
+}
+
+func newCurrentUserApp() *fiber.App {
+	app := fiber.New()
+	protected := app.Group("/", middleware.JWTProtected(), middleware.InjectUser())
+	protected.Get("/me", func(c *fiber.Ctx) error {
+		user, ok := auth.CurrentUser(c)
+		if !ok {
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+		return c.SendString(user.Username)
+	})
+	protected.Get("/admin", middleware.RequireAdmin(), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func requestAs(t *testing.T, app *fiber.App, path string, user *auth.User) *http.Response {
+	return requestMethodAs(t, app, http.MethodGet, path, user)
+}
+
+func requestMethodAs(t *testing.T, app *fiber.App, method, path string, user *auth.User) *http.Response {
+	return sendAs(t, app, method, path, "", user)
+}
+
+// sendAs sends a JSON body with user's token
+func sendAs(t *testing.T, app *fiber.App, method, path, body string, user *auth.User) *http.Response {
+	token, err := auth.GenerateJWT(user)
+	require.NoError(t, err)
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestInjectUser_MakesUserAvailableToHandlers(t *testing.T) {
+	reader := &auth.User{ID: 7, Username: "reader", Role: "user"}
+	useUsers(t, map[uint]*auth.User{7: reader})
+
+	resp := requestAs(t, newCurrentUserApp(), "/me", reader)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "reader", string(body))
+}
+
+func TestInjectUser_RejectsDeletedUser(t *testing.T) {
+	useUsers(t, map[uint]*auth.User{})
+
+	resp := requestAs(t, newCurrentUserApp(), "/me", &auth.User{ID: 7, Username: "gone", Role: "user"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRequireAdmin_UsesInjectedRole(t *testing.T) {
+	// The token was issued while the user was an admin
+	demoted := &auth.User{ID: 7, Username: "former-admin", Role: "user"}
+	useUsers(t, map[uint]*auth.User{7: demoted})
+
+	resp := requestAs(t, newCurrentUserApp(), "/admin", &auth.User{ID: 7, Username: "former-admin", Role: "admin"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	admin := &auth.User{ID: 8, Username: "admin", Role: "admin"}
+	useUsers(t, map[uint]*auth.User{8: admin})
+	resp = requestAs(t, newCurrentUserApp(), "/admin", admin)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestGetUserProfile_ReadsCache(t *testing.T) {
+	store := newMemoryCache()
+	h := auth.NewHandler(nil, store, nil, nil)
+
+	require.NoError(t, store.Set("user:profile:7", auth.User{ID: 7, Username: "cached", Role: "admin"}, 0))
+
+	user, err := h.GetUserProfile(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", user.Username)
+	assert.Equal(t, "admin", user.GetRole())
+
+	h.InvalidateUserProfiles(7)
+	assert.Empty(t, store.keys())
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/dashboard"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/ring"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingBuffer(t *testing.T) {
+	b := ring.New[int](3)
+	assert.Empty(t, b.Items())
+	b.Add(1)
+	b.Add(2)
+	assert.Equal(t, []int{1, 2}, b.Items())
+	assert.Equal(t, 2, b.Len())
+
+	b.Add(3)
+	b.Add(4)
+	b.Add(5)
+	assert.Equal(t, []int{3, 4, 5}, b.Items(), "the oldest values are dropped")
+	assert.Equal(t, 3, b.Len())
+}
+
+func TestRequestWindow_LastMinute(t *testing.T) {
+	w := dashboard.NewRequestWindow()
+	start := time.Unix(1_700_000_000, 0)
+	w.Record(start, "GET", "/books", 200, 10*time.Millisecond)
+	w.Record(start.Add(30*time.Second), "GET", "/books", 200, 20*time.Millisecond)
+	w.Record(start.Add(30*time.Second), "GET", "/books", 500, 30*time.Millisecond)
+	w.Record(start.Add(40*time.Second), "GET", "/books/:id", 200, 4*time.Millisecond)
+	w.Record(start.Add(40*time.Second), "DELETE", "/books/:id", 204, 8*time.Millisecond)
+
+	stats := w.Stats(start.Add(59 * time.Second))
+	require.Len(t, stats, 3)
+	assert.Equal(t, dashboard.EndpointStats{Method: "GET", Path: "/books", Count: 3, AvgMs: 20}, stripUnexported(stats[0]))
+	assert.Equal(t, "DELETE", stats[1].Method, "ties are ordered by path and method")
+	assert.Equal(t, "GET", stats[2].Method)
+
+	stats = w.Stats(start.Add(61 * time.Second))
+	require.Len(t, stats, 3)
+	assert.Equal(t, int64(2), stats[0].Count, "requests older than a minute are dropped")
+	assert.Equal(t, 25.0, stats[0].AvgMs)
+
+	assert.Empty(t, w.Stats(start.Add(2*time.Minute)))
+
+	// A bucket is reused a minute later
+	w.Record(start.Add(time.Minute), "GET", "/books", 200, 50*time.Millisecond)
+	stats = w.Stats(start.Add(time.Minute))
+	assert.Equal(t, int64(3), stats[0].Count)
+}
+
+// stripUnexported copies the exported fields of s, so it can be compared
+// with a literal
+func stripUnexported(s dashboard.EndpointStats) dashboard.EndpointStats {
+	return dashboard.EndpointStats{Method: s.Method, Path: s.Path, Count: s.Count, AvgMs: s.AvgMs}
+}
+
+// useDashboard gives the test its own request counts
+func useDashboard(t *testing.T) {
+	requests, recent := dashboard.Requests, dashboard.RecentErrors
+	dashboard.Requests = dashboard.NewRequestWindow()
+	dashboard.RecentErrors = ring.New[dashboard.RecentError](10)
+	t.Cleanup(func() {
+		dashboard.Requests, dashboard.RecentErrors = requests, recent
+	})
+}
+
+func TestGetDashboardHandler(t *testing.T) {
+	conn, mock := mockDB(t)
+	useDashboard(t)
+	c := newMemoryCache()
+	h := dashboard.NewHandler(conn, c, nil)
+	metrics.RecordCacheOperation("get", "hit")
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1500))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(320))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "loans" WHERE returned_at IS NULL`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	dashboard.Record("GET", "/books/:id", "/books/1", 200, 10*time.Millisecond, nil)
+	dashboard.Record("GET", "/books/:id", "/books/2", 200, 20*time.Millisecond, nil)
+	dashboard.Record("GET", "/books", "/books", 200, 30*time.Millisecond, nil)
+	dashboard.Record("GET", "/books/:id", "/books/3", 500, 40*time.Millisecond, apierrors.ErrDatabase.WithMessage("Failed to fetch book"))
+	dashboard.Record("POST", "/books", "/books", 503, 0, nil)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/dashboard", h.GetDashboard)
+	get := func() (*http.Response, dashboard.Dashboard) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var d dashboard.Dashboard
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&d))
+		return resp, d
+	}
+
+	resp, d := get()
+	assert.Equal(t, "private, max-age=5", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, int64(1500), d.BooksTotal)
+	assert.Equal(t, int64(320), d.UsersTotal)
+	assert.Equal(t, int64(42), d.ActiveLoans)
+	assert.Greater(t, d.CacheHitRatio, 0.0)
+	assert.Equal(t, int64(5), d.RequestsPerMinute)
+	assert.Equal(t, 20.0, d.AvgResponseTimeMs)
+	assert.Equal(t, 40.0, d.ErrorRatePercent)
+
+	require.Len(t, d.TopEndpoints, 3)
+	assert.Equal(t, dashboard.EndpointStats{Method: "GET", Path: "/books/:id", Count: 3, AvgMs: 23.333}, stripUnexported(d.TopEndpoints[0]))
+
+	require.Len(t, d.RecentErrors, 2)
+	assert.Equal(t, "/books", d.RecentErrors[0].Path, "newest first")
+	assert.Equal(t, http.StatusText(http.StatusServiceUnavailable), d.RecentErrors[0].Error)
+	assert.Equal(t, "/books/3", d.RecentErrors[1].Path)
+	assert.Equal(t, "Failed to fetch book", d.RecentErrors[1].Error)
+	assert.WithinDuration(t, time.Now(), d.RecentErrors[1].Timestamp, time.Minute)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Served from the cache without querying again
+	assert.Contains(t, c.keys(), dashboard.CacheKey)
+	dashboard.Record("GET", "/books", "/books", 200, time.Millisecond, nil)
+	_, cached := get()
+	assert.Equal(t, d, cached)
+}
+
+func TestGetDashboardHandler_DatabaseError(t *testing.T) {
+	conn, mock := mockDB(t)
+	useDashboard(t)
+	h := dashboard.NewHandler(conn, newMemoryCache(), nil)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books"`).WillReturnError(errors.New("connection refused"))
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/dashboard", h.GetDashboard)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
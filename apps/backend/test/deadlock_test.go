@@ -0,0 +1,141 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var (
+	deadlock             = &pgconn.PgError{Code: "40P01", Message: "deadlock detected"}
+	serializationFailure = &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+)
+
+// mockDB returns a sqlmock connection, closed at the end of the test
+func mockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	conn, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { sqlDB.Close() })
+	return conn, mock
+}
+
+func TestRetryOnDeadlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []error
+		attempts int
+		wantErr  error
+		wantRuns int
+	}{
+		{"succeeds first time", nil, 3, nil, 1},
+		{"retries deadlocks", []error{deadlock, deadlock}, 3, nil, 3},
+		{"retries serialization failures", []error{serializationFailure}, 3, nil, 2},
+		{"retries wrapped errors", []error{fmt.Errorf("insert: %w", deadlock)}, 3, nil, 2},
+		{"gives up after maxAttempts", []error{deadlock, deadlock, deadlock}, 3, deadlock, 3},
+		{"doesn't retry other errors", []error{gorm.ErrRecordNotFound}, 3, gorm.ErrRecordNotFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := 0
+			err := db.RetryOnDeadlock(func() error {
+				runs++
+				if runs <= len(tt.failures) {
+					return tt.failures[runs-1]
+				}
+				return nil
+			}, tt.attempts)
+
+			assert.Equal(t, tt.wantRuns, runs)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, db.IsRetryable(deadlock))
+	assert.True(t, db.IsRetryable(serializationFailure))
+	assert.False(t, db.IsRetryable(&pgconn.PgError{Code: "23505"}), "unique violations won't go away")
+	assert.False(t, db.IsRetryable(errors.New("40P01")))
+	assert.False(t, db.IsRetryable(nil))
+}
+
+func TestCreateBook_RetriesDeadlocks(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO "books"`).WillReturnError(deadlock)
+		mock.ExpectRollback()
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "books"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	authorID := uint(1)
+	b := &book.Book{Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965}
+	require.NoError(t, store.CreateBook(context.Background(), b))
+	assert.Equal(t, uint(7), b.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteBook_GivesUpAfterRepeatedDeadlocks(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	for i := 0; i < db.DefaultRetryAttempts; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "books" SET "deleted_at"`).WillReturnError(serializationFailure)
+		mock.ExpectRollback()
+	}
+
+	err := store.DeleteBook(context.Background(), 7)
+	assert.True(t, db.IsRetryable(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteBook_OnlyAvailableBooks(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	expectDelete := func(rows int64) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "books" SET "deleted_at"=\$1 WHERE status = \$2 AND "books"."id" = \$3`).
+			WithArgs(sqlmock.AnyArg(), book.StatusAvailable, 7).
+			WillReturnResult(sqlmock.NewResult(0, rows))
+		mock.ExpectCommit()
+	}
+	countBooks := func(count int) {
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "books" WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+
+	expectDelete(1)
+	assert.NoError(t, store.DeleteBook(context.Background(), 7))
+
+	// Checked out, e.g. by a loan that won the race
+	expectDelete(0)
+	countBooks(1)
+	assert.ErrorIs(t, store.DeleteBook(context.Background(), 7), book.ErrBookUnavailable)
+
+	expectDelete(0)
+	countBooks(0)
+	assert.ErrorIs(t, store.DeleteBook(context.Background(), 7), gorm.ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
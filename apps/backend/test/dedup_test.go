@@ -0,0 +1,62 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"", dedup.DefaultSimilarityThreshold, false},
+		{"0.5", 0.5, false},
+		{"1", 1, false},
+		{"0", dedup.DefaultSimilarityThreshold, true},
+		{"1.5", dedup.DefaultSimilarityThreshold, true},
+		{"high", dedup.DefaultSimilarityThreshold, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("DEDUP_SIMILARITY_THRESHOLD", tt.value)
+			threshold, err := dedup.ThresholdFromEnv()
+			assert.Equal(t, tt.wantErr, err != nil, "%v", err)
+			assert.Equal(t, tt.want, threshold)
+		})
+	}
+}
+
+func TestDuplicateDetector_FindDuplicates(t *testing.T) {
+	conn, mock := mockDB(t)
+	mock.ExpectQuery(`SELECT id, title, author, similarity\(title, \$1\) AS similarity\s+FROM books\s+WHERE deleted_at IS NULL AND similarity\(title, \$2\) > \$3\s+ORDER BY similarity DESC\s+LIMIT \$4`).
+		WithArgs("The Hobbit!", "The Hobbit!", 0.8, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author", "similarity"}).
+			AddRow(4, "The Hobbit", "J.R.R. Tolkien", 1.0).
+			AddRow(9, "The Hobbit (Illustrated)", "J.R.R. Tolkien", 0.81))
+
+	candidates, err := dedup.NewDuplicateDetector(0.8).FindDuplicates(context.Background(), conn, "The Hobbit!")
+	require.NoError(t, err)
+	assert.Equal(t, []dedup.Candidate{
+		{ID: 4, Title: "The Hobbit", Author: "J.R.R. Tolkien", Similarity: 1.0},
+		{ID: 9, Title: "The Hobbit (Illustrated)", Author: "J.R.R. Tolkien", Similarity: 0.81},
+	}, candidates)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDuplicateDetector_NoDuplicates(t *testing.T) {
+	conn, mock := mockDB(t)
+	mock.ExpectQuery(`FROM books`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author", "similarity"}))
+
+	candidates, err := dedup.NewDuplicateDetector(dedup.DefaultSimilarityThreshold).FindDuplicates(context.Background(), conn, "Persuasion")
+	require.NoError(t, err)
+	assert.NotNil(t, candidates, "encoded as an empty list")
+	assert.Empty(t, candidates)
+}
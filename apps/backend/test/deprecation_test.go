@@ -0,0 +1,98 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useSuccessorVersionURL(t *testing.T, url string) {
+	previous := middleware.SuccessorVersionURL
+	middleware.SuccessorVersionURL = url
+	t.Cleanup(func() { middleware.SuccessorVersionURL = previous })
+}
+
+// deprecatedRequests is deprecated_api_requests_total for endpoint, 0 before
+// its first request
+func deprecatedRequests(t *testing.T, endpoint string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "deprecated_api_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == endpoint {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestDeprecation_Headers(t *testing.T) {
+	useSuccessorVersionURL(t, "https://api.example.com/v2/")
+	app := fiber.New()
+	app.Use(middleware.Deprecation("Use /v2", "2026-01-01"))
+	app.Get("/books", func(c *fiber.Ctx) error {
+		middleware.SetPagination(c, 1, 10, 25)
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/books?limit=10", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "true", resp.Header.Get("Deprecation"))
+	assert.Equal(t, "Thu, 01 Jan 2026 00:00:00 GMT", resp.Header.Get("Sunset"))
+	sunset, err := time.Parse(time.RFC1123, resp.Header.Get("Sunset"))
+	require.NoError(t, err)
+	assert.True(t, sunset.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Contains(t, resp.Header.Get("Link"), `<https://api.example.com/v2/books>; rel="successor-version"`)
+	assert.Contains(t, resp.Header.Get("Link"), `rel="next"`, "pagination links are kept")
+	assert.Equal(t, `299 - "Use /v2"`, resp.Header.Get("Warning"))
+}
+
+func TestDeprecation_WithoutSuccessor(t *testing.T) {
+	useSuccessorVersionURL(t, "")
+	app := fiber.New()
+	app.Use(middleware.Deprecation("", "2026-06-30T12:00:00+02:00"))
+	app.Get("/authors/:id", func(c *fiber.Ctx) error { return fiber.ErrNotFound })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/authors/1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Deprecation"), "errors are marked too")
+	assert.Equal(t, "Tue, 30 Jun 2026 10:00:00 GMT", resp.Header.Get("Sunset"))
+	assert.Empty(t, resp.Header.Get("Link"))
+	assert.Empty(t, resp.Header.Get("Warning"))
+}
+
+func TestDeprecation_RecordsUse(t *testing.T) {
+	app := fiber.New()
+	app.Use(middleware.Deprecation("", "2026-01-01"))
+	app.Get("/series/:id", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	before := deprecatedRequests(t, "GET /series/:id")
+	for _, target := range []string{"/series/1", "/series/2"} {
+		_, err := app.Test(httptest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, before+2, deprecatedRequests(t, "GET /series/:id"))
+}
+
+func TestParseSunsetDate(t *testing.T) {
+	for _, raw := range []string{"2026-01-01", "2026-01-01T00:00:00Z", "Thu, 01 Jan 2026 00:00:00 GMT"} {
+		sunset, err := middleware.ParseSunsetDate(raw)
+		require.NoError(t, err, raw)
+		assert.True(t, sunset.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)), raw)
+	}
+	_, err := middleware.ParseSunsetDate("01/01/2026")
+	assert.Error(t, err)
+	assert.Panics(t, func() { middleware.Deprecation("", "soon") })
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envelopeApp(config middleware.EnvelopeConfig) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.Envelope(config))
+	app.Get("/tags", func(c *fiber.Ctx) error {
+		return c.JSON([]string{"go", "rust"})
+	})
+	app.Get("/books", func(c *fiber.Ctx) error {
+		middleware.SetPagination(c, 2, 2, 5)
+		return c.JSON([]fiber.Map{{"id": 3}, {"id": 4}})
+	})
+	app.Get("/books/1", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"id": 1})
+	})
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusNotFound).JSON([]string{"not found"})
+	})
+	return app
+}
+
+func envelopeGet(t *testing.T, app *fiber.App, path, accept string) (*http.Response, string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestEnvelope_DisabledKeepsBareArrays(t *testing.T) {
+	app := envelopeApp(middleware.EnvelopeConfig{})
+
+	for _, accept := range []string{"", "*/*", "application/json"} {
+		_, body := envelopeGet(t, app, "/tags", accept)
+		assert.JSONEq(t, `["go","rust"]`, body, "Accept %q", accept)
+
+		_, body = envelopeGet(t, app, "/books", accept)
+		assert.JSONEq(t, `[{"id":3},{"id":4}]`, body, "Accept %q", accept)
+	}
+}
+
+func TestEnvelope_Enabled(t *testing.T) {
+	app := envelopeApp(middleware.EnvelopeConfig{Enabled: true})
+
+	_, body := envelopeGet(t, app, "/tags", "")
+	assert.JSONEq(t, `{"data":["go","rust"],"total":2}`, body)
+
+	resp, body := envelopeGet(t, app, "/books", "application/json")
+	assert.JSONEq(t, `{"data":[{"id":3},{"id":4}],"total":5,"page":2,"limit":2,"pages":3}`, body)
+	assert.Equal(t, "5", resp.Header.Get("X-Total-Count"), "keeps the pagination headers")
+}
+
+func TestEnvelope_AcceptHeader(t *testing.T) {
+	app := envelopeApp(middleware.EnvelopeConfig{})
+
+	resp, body := envelopeGet(t, app, "/tags", middleware.MIMEEnvelope)
+	assert.JSONEq(t, `{"data":["go","rust"],"total":2}`, body)
+	assert.Contains(t, resp.Header.Get("Vary"), "Accept")
+
+	_, body = envelopeGet(t, app, "/books", "application/vnd.api+json, application/json;q=0.5")
+	var envelope middleware.ListEnvelope
+	require.NoError(t, json.Unmarshal([]byte(body), &envelope))
+	assert.Equal(t, int64(5), envelope.Total)
+	require.NotNil(t, envelope.Pages)
+	assert.Equal(t, 3, *envelope.Pages)
+}
+
+func TestEnvelope_LeavesOtherResponses(t *testing.T) {
+	app := envelopeApp(middleware.EnvelopeConfig{Enabled: true})
+
+	_, body := envelopeGet(t, app, "/books/1", "")
+	assert.JSONEq(t, `{"id":1}`, body)
+
+	resp, body := envelopeGet(t, app, "/missing", "")
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	assert.JSONEq(t, `["not found"]`, body)
+}
+
+func TestEnvelopeConfigFromEnv(t *testing.T) {
+	t.Setenv("RESPONSE_ENVELOPE", "")
+	config, err := middleware.EnvelopeConfigFromEnv()
+	require.NoError(t, err)
+	assert.False(t, config.Enabled, "bare arrays by default")
+
+	t.Setenv("RESPONSE_ENVELOPE", "true")
+	config, err = middleware.EnvelopeConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, config.Enabled)
+
+	t.Setenv("RESPONSE_ENVELOPE", "sometimes")
+	_, err = middleware.EnvelopeConfigFromEnv()
+	assert.Error(t, err)
+}
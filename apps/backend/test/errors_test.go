@@ -0,0 +1,110 @@
+package test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// Clients switch on error codes, so renaming or re-statusing one is a breaking
+// change. Run `go test ./test -run TestErrorCodesGolden -update` to accept one.
+func TestErrorCodesGolden(t *testing.T) {
+	var sb strings.Builder
+	for _, err := range apierrors.All() {
+		fmt.Fprintf(&sb, "%s %d\n", err.Code, err.HTTPStatus)
+	}
+	got := sb.String()
+
+	golden := filepath.Join("testdata", "error_codes.golden")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, []byte(got), 0o644))
+	}
+
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), got, "API error codes changed; rerun with -update if this is intended")
+}
+
+func TestErrorHandlerFormatsErrors(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+
+	app.Get("/api-error", func(c *fiber.Ctx) error {
+		return apierrors.ErrBookNotFound
+	})
+	app.Get("/custom-message", func(c *fiber.Ctx) error {
+		return apierrors.ErrInvalidQuery.WithMessage("Invalid sort field")
+	})
+	app.Get("/validation", func(c *fiber.Ctx) error {
+		return apierrors.NewValidationError(apierrors.FieldError{Field: "title", Message: "is required"})
+	})
+	app.Get("/wrapped", func(c *fiber.Ctx) error {
+		return fmt.Errorf("loading book: %w", apierrors.ErrBookNotFound)
+	})
+	app.Get("/fiber-error", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusMethodNotAllowed, "Method not allowed")
+	})
+	app.Get("/generic-error", func(c *fiber.Ctx) error {
+		return assert.AnError
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedCode   string
+		expectedError  string
+		detailsKey     string
+	}{
+		{"API error", "/api-error", http.StatusNotFound, "BOOK_NOT_FOUND", "Book not found", ""},
+		{"Custom message", "/custom-message", http.StatusBadRequest, "INVALID_QUERY", "Invalid sort field", ""},
+		{"Validation error", "/validation", http.StatusBadRequest, "VALIDATION_FAILED", "Validation failed", "validation_errors"},
+		{"Wrapped API error", "/wrapped", http.StatusNotFound, "BOOK_NOT_FOUND", "Book not found", ""},
+		{"Fiber error", "/fiber-error", http.StatusMethodNotAllowed, "HTTP_ERROR", "Method not allowed", ""},
+		{"Generic error", "/generic-error", http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", ""},
+		{"Unknown route", "/missing", http.StatusNotFound, "ROUTE_NOT_FOUND", "Cannot GET /missing", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			var result map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &result))
+			assert.Equal(t, tt.expectedCode, result["code"])
+			assert.Equal(t, tt.expectedError, result["error"])
+			_, hasDetails := result["details"]
+			assert.False(t, hasDetails)
+			if tt.detailsKey != "" {
+				assert.Contains(t, result, tt.detailsKey)
+			}
+		})
+	}
+}
+
+func TestAPIErrorCopiesDoNotMutateDefinitions(t *testing.T) {
+	custom := apierrors.ErrBookNotFound.WithMessage("Book 42 not found").WithDetails(map[string]int{"id": 42})
+
+	assert.Equal(t, "Book 42 not found", custom.Message)
+	assert.Equal(t, "Book not found", apierrors.ErrBookNotFound.Message)
+	assert.Nil(t, apierrors.ErrBookNotFound.Details)
+}
@@ -0,0 +1,196 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/export"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+type exportBase struct {
+	ID uint `json:"id"`
+}
+
+type exportRow struct {
+	exportBase
+	Title     string     `json:"title"`
+	Year      int        `json:"year"`
+	Available bool       `json:"available"`
+	Tags      []string   `json:"tags,omitempty"`
+	ReadAt    *time.Time `json:"read_at"`
+	Secret    string     `json:"-"`
+	internal  string
+}
+
+func exportRows() []exportRow {
+	readAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []exportRow{
+		{exportBase: exportBase{ID: 1}, Title: "Dune", Year: 1965, Available: true, Tags: []string{"sf"}, ReadAt: &readAt, Secret: "x", internal: "y"},
+		{exportBase: exportBase{ID: 2}, Title: "=SUM(A1)", Year: 1949},
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.JSONExporter{}.Export(exportRows(), export.FormatJSON, &buf))
+
+	var decoded []map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(t, decoded, 2)
+	assert.Equal(t, "Dune", decoded[0]["title"])
+	assert.Equal(t, float64(1), decoded[0]["id"])
+	assert.NotContains(t, decoded[0], "Secret")
+	assert.NotContains(t, decoded[1], "tags", "omitempty is honored")
+}
+
+func TestCSVExporter(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.CSVExporter{}.Export(exportRows(), export.FormatCSV, &buf))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "title", "year", "available", "tags", "read_at"},
+		{"1", "Dune", "1965", "true", `["sf"]`, "2024-03-01T12:00:00Z"},
+		{"2", "'=SUM(A1)", "1949", "false", "null", ""},
+	}, records)
+}
+
+func TestXLSXExporter(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.XLSXExporter{}.Export(exportRows(), export.FormatXLSX, &buf))
+
+	f, err := excelize.OpenReader(&buf)
+	require.NoError(t, err)
+	defer f.Close()
+
+	sheet := f.GetSheetName(0)
+	rows, err := f.GetRows(sheet)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, []string{"id", "title", "year", "available", "tags", "read_at"}, rows[0])
+	assert.Equal(t, []string{"1", "Dune", "1965", "TRUE", `["sf"]`, "2024-03-01T12:00:00Z"}, rows[1])
+	assert.Equal(t, "=SUM(A1)", rows[2][1], "strings are stored as text, not formulas")
+
+	year, err := f.GetCellType(sheet, "C2")
+	require.NoError(t, err)
+	assert.NotEqual(t, excelize.CellTypeInlineString, year, "numbers stay numeric")
+
+	styleID, err := f.GetCellStyle(sheet, "A1")
+	require.NoError(t, err)
+	style, err := f.GetStyle(styleID)
+	require.NoError(t, err)
+	require.NotNil(t, style.Font)
+	assert.True(t, style.Font.Bold)
+
+	panes, err := f.GetPanes(sheet)
+	require.NoError(t, err)
+	assert.True(t, panes.Freeze)
+	assert.Equal(t, 1, panes.YSplit)
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := export.Export(exportRows(), "pdf", &buf)
+	assert.True(t, errors.Is(err, export.ErrUnsupportedFormat))
+
+	err = export.CSVExporter{}.Export(exportRows(), export.FormatJSON, &buf)
+	assert.True(t, errors.Is(err, export.ErrUnsupportedFormat))
+
+	assert.Equal(t, []string{"csv", "json", "xlsx"}, export.Formats())
+	assert.Empty(t, export.ContentType("pdf"))
+}
+
+func TestExportAcceptsPointerRows(t *testing.T) {
+	rows := exportRows()
+	var buf bytes.Buffer
+	require.NoError(t, export.Export([]*exportRow{&rows[0], nil}, export.FormatCSV, &buf))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "Dune", records[1][1])
+	assert.Equal(t, []string{"", "", "", "", "", ""}, records[2])
+}
+
+// flushCounter counts flushes so tests can see output leave in batches
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushCounter) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func TestStreamExportWritesBatches(t *testing.T) {
+	var out flushCounter
+	err := export.StreamExport(&out, export.FormatCSV, exportRow{}, func(write func(interface{}) error) error {
+		for i := 0; i < 3; i++ {
+			if err := write([]exportRow{{exportBase: exportBase{ID: uint(i)}, Title: "Book"}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, out.flushes)
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, 4)
+}
+
+func TestStreamExportWithoutRows(t *testing.T) {
+	for format, want := range map[string]string{
+		export.FormatCSV:  "id,title,year,available,tags,read_at\n",
+		export.FormatJSON: "[]\n",
+	} {
+		var buf bytes.Buffer
+		err := export.StreamExport(&buf, format, exportRow{}, func(write func(interface{}) error) error {
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, want, buf.String(), format)
+	}
+}
+
+func TestStreamExportStopsOnError(t *testing.T) {
+	var buf bytes.Buffer
+	failure := errors.New("database gone")
+	err := export.StreamExport(&buf, export.FormatXLSX, exportRow{}, func(write func(interface{}) error) error {
+		if err := write(exportRows()); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Zero(t, buf.Len(), "an incomplete xlsx is never written")
+
+	err = export.StreamExport(&buf, export.FormatCSV, exportRow{}, func(write func(interface{}) error) error {
+		return write([]exportBase{{ID: 1}})
+	})
+	assert.Error(t, err, "batches must match the row type")
+}
+
+func BenchmarkXLSXExport(b *testing.B) {
+	rows := make([]exportRow, 1000)
+	for i := range rows {
+		rows[i] = exportRow{exportBase: exportBase{ID: uint(i)}, Title: "Book", Year: 2000}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := export.Export(rows, export.FormatXLSX, &buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
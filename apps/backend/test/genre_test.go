@@ -0,0 +1,97 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenreSlug(t *testing.T) {
+	for name, want := range map[string]string{
+		"Science Fiction":     "science-fiction",
+		"science fiction":     "science-fiction",
+		"  SCIENCE--FICTION ": "science-fiction",
+		"Sci-Fi":              "sci-fi",
+		"sci_fi":              "sci-fi",
+		"Children's":          "children-s",
+		"Ciencia ficción":     "ciencia-ficción",
+		"20th Century":        "20th-century",
+		"!!!":                 "",
+	} {
+		assert.Equal(t, want, book.GenreSlug(name), name)
+	}
+}
+
+func TestCreateBook_LinksGenre(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "genres" WHERE slug = \$1`).
+		WithArgs("science-fiction").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(3, "Science Fiction", "science-fiction"))
+	mock.ExpectQuery(`INSERT INTO "books"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	authorID := uint(1)
+	b := &book.Book{Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965, Genre: " science  FICTION"}
+	require.NoError(t, store.CreateBook(context.Background(), b))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	require.NotNil(t, b.GenreID)
+	assert.Equal(t, uint(3), *b.GenreID)
+	assert.Equal(t, "Science Fiction", b.Genre)
+}
+
+func TestCreateBook_CreatesMissingGenre(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "genres" WHERE slug = \$1`).WithArgs("space-opera").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`INSERT INTO genres .* ON CONFLICT DO NOTHING`).WithArgs("Space Opera", "space-opera").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "genres" WHERE slug = \$1`).
+		WithArgs("space-opera").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug"}).AddRow(9, "Space Opera", "space-opera"))
+	mock.ExpectQuery(`INSERT INTO "books"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	authorID := uint(1)
+	b := &book.Book{Title: "Hyperion", Author: "Dan Simmons", AuthorID: &authorID, Year: 1989, Genre: "Space Opera"}
+	require.NoError(t, store.CreateBook(context.Background(), b))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	require.NotNil(t, b.GenreID)
+	assert.Equal(t, uint(9), *b.GenreID)
+}
+
+func TestCreateBook_GenreErrors(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	authorID := uint(1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "genres" WHERE "genres"."id" = \$1`).WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	genreID := uint(42)
+	err := store.CreateBook(context.Background(), &book.Book{Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965, GenreID: &genreID})
+	assert.ErrorIs(t, err, book.ErrUnknownGenre)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	err = store.CreateBook(context.Background(), &book.Book{Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965, Genre: "???"})
+	assert.ErrorIs(t, err, book.ErrInvalidGenre)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBooks_InvalidGenreID(t *testing.T) {
+	app := bookHandlerApp(book.NewBookHandler(newFakeBookStore(), nil, nil, nil))
+	for _, genreID := range []string{"abc", "0", "-1"} {
+		assert.Equal(t, http.StatusBadRequest, send(t, app, http.MethodGet, "/books?genre_id="+genreID, "").StatusCode, genreID)
+	}
+}
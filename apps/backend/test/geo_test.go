@@ -0,0 +1,424 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/geo"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func names(en string) map[string]interface{} {
+	return map[string]interface{}{"en": en}
+}
+
+// geoTestNetworks are the known addresses of the test database, in the
+// shape of GeoLite2 City records
+var geoTestNetworks = map[string]map[string]interface{}{
+	"81.2.69.0/24": {
+		"country":      map[string]interface{}{"iso_code": "GB", "names": names("United Kingdom")},
+		"subdivisions": []interface{}{map[string]interface{}{"names": names("England")}},
+		"city":         map[string]interface{}{"names": names("London")},
+	},
+	"89.160.20.0/24": {
+		"country":      map[string]interface{}{"iso_code": "SE", "names": names("Sweden")},
+		"subdivisions": []interface{}{map[string]interface{}{"names": names("Östergötland County")}},
+		"city":         map[string]interface{}{"names": names("Linköping")},
+	},
+	// Country databases have no city or subdivisions
+	"8.8.8.0/24": {
+		"country": map[string]interface{}{"iso_code": "US", "names": names("United States")},
+	},
+}
+
+// mmdbNode is a search tree node; children are nil (no data), *mmdbNode or
+// an int offset into the data section
+type mmdbNode struct {
+	children [2]interface{}
+}
+
+// buildMMDB writes an IPv4 MaxMind DB with 24-bit records mapping each
+// network to its record
+func buildMMDB(t testing.TB, networks map[string]map[string]interface{}, buildEpoch uint64) []byte {
+	t.Helper()
+	root := &mmdbNode{}
+	var data []byte
+	for cidr, record := range networks {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To4()
+
+		offset := len(data)
+		data = append(data, mmdbEncode(record)...)
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				node.children[bit] = offset
+				break
+			}
+			child, ok := node.children[bit].(*mmdbNode)
+			if !ok {
+				child = &mmdbNode{}
+				node.children[bit] = child
+			}
+			node = child
+		}
+	}
+
+	nodes := []*mmdbNode{root}
+	index := map[*mmdbNode]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if n, ok := child.(*mmdbNode); ok {
+				index[n] = len(nodes)
+				nodes = append(nodes, n)
+			}
+		}
+	}
+
+	var out []byte
+	for _, n := range nodes {
+		for _, child := range n.children {
+			value := len(nodes)
+			switch c := child.(type) {
+			case *mmdbNode:
+				value = index[c]
+			case int:
+				value = len(nodes) + 16 + c
+			}
+			out = append(out, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	out = append(out, make([]byte, 16)...)
+	out = append(out, data...)
+	out = append(out, "\xAB\xCD\xEFMaxMind.com"...)
+	return append(out, mmdbEncode(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 buildEpoch,
+		"database_type":               "GeoLite2-City",
+		"description":                 names("Test database"),
+		"ip_version":                  uint16(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})...)
+}
+
+// mmdbEncode encodes v in the MaxMind DB data format
+func mmdbEncode(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(mmdbControl(2, len(v)), v...)
+	case uint16:
+		return mmdbUint(5, uint64(v))
+	case uint32:
+		return mmdbUint(6, uint64(v))
+	case uint64:
+		return mmdbUint(9, v)
+	case []interface{}:
+		out := mmdbControl(11, len(v))
+		for _, item := range v {
+			out = append(out, mmdbEncode(item)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := mmdbControl(7, len(v))
+		for _, key := range keys {
+			out = append(out, mmdbEncode(key)...)
+			out = append(out, mmdbEncode(v[key])...)
+		}
+		return out
+	}
+	panic("unsupported MaxMind DB type")
+}
+
+func mmdbUint(typ int, v uint64) []byte {
+	var digits []byte
+	for ; v > 0; v >>= 8 {
+		digits = append([]byte{byte(v)}, digits...)
+	}
+	return append(mmdbControl(typ, len(digits)), digits...)
+}
+
+// mmdbControl returns the control bytes of a value of typ and size; sizes
+// from 29 take an extra byte, which follows the extended type byte
+func mmdbControl(typ, size int) []byte {
+	if size >= 285 {
+		panic("MaxMind DB value too long")
+	}
+	first := typ << 5
+	if typ > 7 {
+		first = 0
+	}
+	if size < 29 {
+		first |= size
+	} else {
+		first |= 29
+	}
+
+	out := []byte{byte(first)}
+	if typ > 7 {
+		out = append(out, byte(typ-7))
+	}
+	if size >= 29 {
+		out = append(out, byte(size-29))
+	}
+	return out
+}
+
+func testResolver(t testing.TB) *geo.Resolver {
+	r := geo.NewResolver()
+	require.NoError(t, r.Load(buildMMDB(t, geoTestNetworks, uint64(time.Now().Unix()))))
+	return r
+}
+
+func TestResolverLookup_KnownAddresses(t *testing.T) {
+	r := testResolver(t)
+
+	tests := []struct {
+		ip       string
+		location geo.Location
+	}{
+		{"81.2.69.142", geo.Location{CountryCode: "GB", CountryName: "United Kingdom", Region: "England", City: "London"}},
+		{"89.160.20.112", geo.Location{CountryCode: "SE", CountryName: "Sweden", Region: "Östergötland County", City: "Linköping"}},
+		{"8.8.8.8", geo.Location{CountryCode: "US", CountryName: "United States"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			location, found := r.Lookup(tt.ip)
+			require.True(t, found)
+			assert.Equal(t, tt.location, location)
+		})
+	}
+}
+
+func TestResolverLookup_UnknownAddresses(t *testing.T) {
+	r := testResolver(t)
+	for _, ip := range []string{"10.0.0.1", "127.0.0.1", "81.2.70.1", "2001:db8::1", "not-an-ip", ""} {
+		_, found := r.Lookup(ip)
+		assert.False(t, found, ip)
+	}
+
+	_, found := geo.NewResolver().Lookup("81.2.69.142")
+	assert.False(t, found, "no database loaded")
+}
+
+func TestResolverLoad_RejectsInvalidDatabase(t *testing.T) {
+	r := testResolver(t)
+	assert.Error(t, r.Load([]byte("not a database")))
+
+	// The previous database stays in use
+	_, found := r.Lookup("8.8.8.8")
+	assert.True(t, found)
+}
+
+func TestLoadLatest_KeepsTheNewerDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	require.NoError(t, geo.LoadLatest(geo.NewResolver(), path), "missing file")
+
+	older := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	newer := older.AddDate(0, 1, 0)
+	require.NoError(t, os.WriteFile(path, buildMMDB(t, geoTestNetworks, uint64(older.Unix())), 0o644))
+
+	r := geo.NewResolver()
+	require.NoError(t, r.Load(buildMMDB(t, geoTestNetworks, uint64(newer.Unix()))))
+	require.NoError(t, geo.LoadLatest(r, path))
+	assert.Equal(t, newer, r.BuildTime())
+
+	r = geo.NewResolver()
+	require.NoError(t, geo.LoadLatest(r, path))
+	assert.Equal(t, older, r.BuildTime())
+}
+
+func geoArchive(t *testing.T, db []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "GeoLite2-City_20240102/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "GeoLite2-City_20240102/LICENSE.txt", Typeflag: tar.TypeReg, Size: 7, Mode: 0o644}))
+	_, err := tw.Write([]byte("license"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "GeoLite2-City_20240102/GeoLite2-City.mmdb", Typeflag: tar.TypeReg, Size: int64(len(db)), Mode: 0o644}))
+	_, err = tw.Write(db)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestUpdate_DownloadsAndLoadsTheDatabase(t *testing.T) {
+	archive := geoArchive(t, buildMMDB(t, geoTestNetworks, uint64(time.Now().Unix())))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, key, ok := r.BasicAuth(); !ok || user != "42" || key != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	config := geo.UpdaterConfig{
+		Path:       filepath.Join(t.TempDir(), "geo", "GeoLite2-City.mmdb"),
+		AccountID:  "42",
+		LicenseKey: "secret",
+		Edition:    "GeoLite2-City",
+		URL:        server.URL,
+	}
+	r := geo.NewResolver()
+	require.NoError(t, geo.Update(context.Background(), r, config))
+
+	location, found := r.Lookup("81.2.69.142")
+	require.True(t, found)
+	assert.Equal(t, "London", location.City)
+
+	// The stored copy is loaded on the next start
+	restarted := geo.NewResolver()
+	require.NoError(t, geo.LoadLatest(restarted, config.Path))
+	assert.True(t, restarted.Loaded())
+
+	config.LicenseKey = "wrong"
+	assert.Error(t, geo.Update(context.Background(), r, config))
+	config.LicenseKey = ""
+	assert.Error(t, geo.Update(context.Background(), r, config))
+}
+
+func TestUpdate_KeepsTheStoredDatabaseOnBadDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(geoArchive(t, []byte("truncated")))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	stored := buildMMDB(t, geoTestNetworks, uint64(time.Now().Unix()))
+	require.NoError(t, os.WriteFile(path, stored, 0o644))
+
+	err := geo.Update(context.Background(), geo.NewResolver(), geo.UpdaterConfig{Path: path, LicenseKey: "secret", URL: server.URL})
+	require.Error(t, err)
+	onDisk, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, stored, onDisk)
+}
+
+func TestGeoConfigFromEnv(t *testing.T) {
+	t.Setenv("BLOCKED_COUNTRIES", "kp, IR,")
+	config, err := middleware.GeoConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"KP", "IR"}, config.BlockedCountries)
+	assert.True(t, config.RecordAnalytics)
+
+	t.Setenv("BLOCKED_COUNTRIES", "North Korea")
+	_, err = middleware.GeoConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func geoApp(config middleware.GeoConfig) *fiber.App {
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor, ErrorHandler: apierrors.ErrorHandler})
+	app.Use(middleware.GeoLocation(config))
+	app.Get("/where", func(c *fiber.Ctx) error {
+		location, found := middleware.ClientLocation(c)
+		return c.JSON(fiber.Map{"found": found, "location": location, "country": middleware.Country(c)})
+	})
+	return app
+}
+
+func geoRequest(t *testing.T, app *fiber.App, ip string) *http.Response {
+	req := httptest.NewRequest("GET", "/where", nil)
+	req.Header.Set(fiber.HeaderXForwardedFor, ip)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestGeoLocationMiddleware_StoresTheLocation(t *testing.T) {
+	app := geoApp(middleware.GeoConfig{Resolver: testResolver(t)})
+
+	resp := geoRequest(t, app, "81.2.69.142")
+	require.Equal(t, 200, resp.StatusCode)
+	var body struct {
+		Found    bool         `json:"found"`
+		Location geo.Location `json:"location"`
+		Country  string       `json:"country"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.True(t, body.Found)
+	assert.Equal(t, "London", body.Location.City)
+	assert.Equal(t, "GB", body.Country)
+
+	resp = geoRequest(t, app, "10.1.2.3")
+	require.Equal(t, 200, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.False(t, body.Found)
+	assert.Equal(t, geo.UnknownCountry, body.Country)
+}
+
+func TestGeoLocationMiddleware_BlocksCountries(t *testing.T) {
+	app := geoApp(middleware.GeoConfig{Resolver: testResolver(t), BlockedCountries: []string{"se"}})
+
+	resp := geoRequest(t, app, "89.160.20.112")
+	assert.Equal(t, 403, resp.StatusCode)
+	var apiErr apierrors.APIError
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&apiErr))
+	assert.Equal(t, "FORBIDDEN", apiErr.Code)
+
+	assert.Equal(t, 200, geoRequest(t, app, "81.2.69.142").StatusCode)
+	// Unlisted clients are let through
+	assert.Equal(t, 200, geoRequest(t, app, "10.1.2.3").StatusCode)
+}
+
+func TestCountryAnalytics_CountsRequestsAndVisitors(t *testing.T) {
+	c := testRedis(t)
+	h := geo.NewHandler(c, nil)
+	keys, _ := c.Keys("{analytics:countries}:*")
+	c.Delete(keys...)
+	defer func() {
+		keys, _ := c.Keys("{analytics:countries}:*")
+		c.Delete(keys...)
+	}()
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+	require.NoError(t, h.RecordRequest("GB", "81.2.69.142", today))
+	require.NoError(t, h.RecordRequest("GB", "81.2.69.142", today))
+	require.NoError(t, h.RecordRequest("GB", "81.2.69.142", yesterday))
+	require.NoError(t, h.RecordRequest("GB", "81.2.69.143", yesterday))
+	require.NoError(t, h.RecordRequest("SE", "89.160.20.112", today))
+	require.NoError(t, h.RecordRequest("", "10.1.2.3", today))
+	require.NoError(t, h.RecordRequest("US", "8.8.8.8", today.AddDate(0, 0, -8)))
+
+	stats, err := h.Stats(7, today)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), stats.TotalRequests)
+	assert.Equal(t, []geo.CountryCount{
+		{CountryCode: "GB", Requests: 4, UniqueVisitors: 2},
+		{CountryCode: "SE", Requests: 1, UniqueVisitors: 1},
+		{CountryCode: geo.UnknownCountry, Requests: 1, UniqueVisitors: 1},
+	}, stats.Countries)
+
+	stats, err = h.Stats(1, today)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.TotalRequests)
+}
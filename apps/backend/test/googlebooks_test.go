@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/external/googlebooks"
+	"github.com/go-redis/redismock/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orwellVolumes = `{
+  "kind": "books#volumes",
+  "totalItems": 1,
+  "items": [{
+    "volumeInfo": {
+      "title": "Nineteen Eighty-Four",
+      "authors": ["George Orwell"],
+      "publishedDate": "2003-05-06",
+      "description": "A dystopian novel.",
+      "pageCount": 339,
+      "categories": ["Fiction"],
+      "imageLinks": {"thumbnail": "http://books.google.com/books/content?id=kotPYEqx7kMC"}
+    }
+  }]
+}`
+
+// fakeGoogleBooks serves orwellVolumes for its ISBN and no results otherwise
+func fakeGoogleBooks(t *testing.T, calls *int32) *googlebooks.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		assert.Equal(t, "/volumes", r.URL.Path)
+		assert.Equal(t, "test-key", r.URL.Query().Get("key"))
+
+		switch r.URL.Query().Get("q") {
+		case "isbn:9780452284234":
+			w.Write([]byte(orwellVolumes))
+		case "isbn:0306406152":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"kind": "books#volumes", "totalItems": 0}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := googlebooks.NewClient("test-key")
+	client.BaseURL = server.URL
+	client.HTTPClient.InitialBackoff = time.Millisecond
+	return client
+}
+
+func TestGoogleBooksLookupByISBN(t *testing.T) {
+	var calls int32
+	client := fakeGoogleBooks(t, &calls)
+
+	meta, err := client.LookupByISBN(context.Background(), "978-0-452-28423-4")
+	require.NoError(t, err)
+	assert.Equal(t, "9780452284234", meta.ISBN)
+	assert.Equal(t, "Nineteen Eighty-Four", meta.Title)
+	assert.Equal(t, []string{"George Orwell"}, meta.Authors)
+	assert.Equal(t, 2003, meta.Year())
+	assert.Equal(t, "A dystopian novel.", meta.Description)
+	assert.Equal(t, 339, meta.PageCount)
+	assert.Equal(t, []string{"Fiction"}, meta.Categories)
+	assert.Equal(t, "https://books.google.com/books/content?id=kotPYEqx7kMC", meta.Thumbnail)
+
+	calls = 0
+	_, err = client.LookupByISBN(context.Background(), "0-306-40615-2")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, googlebooks.ErrNotFound))
+	assert.Equal(t, int32(1+client.HTTPClient.MaxRetries), atomic.LoadInt32(&calls), "503 is retried")
+
+	_, err = client.LookupByISBN(context.Background(), "9780306406157")
+	assert.ErrorIs(t, err, googlebooks.ErrNotFound)
+}
+
+func TestBookMetadataYear(t *testing.T) {
+	assert.Equal(t, 1949, googlebooks.BookMetadata{PublishedDate: "1949"}.Year())
+	assert.Equal(t, 1949, googlebooks.BookMetadata{PublishedDate: "1949-06"}.Year())
+	assert.Equal(t, 0, googlebooks.BookMetadata{}.Year())
+}
+
+func lookupRequest(t *testing.T, app *fiber.App, body string) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, "/books/lookup", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestLookupBookHandler(t *testing.T) {
+	var calls int32
+	prevClient := book.GoogleBooks
+	defer func() { book.GoogleBooks = prevClient }()
+	book.GoogleBooks = fakeGoogleBooks(t, &calls)
+
+	client, mock := redismock.NewClientMock()
+	h := book.NewBookHandler(newFakeBookStore(), cache.NewRedisCacheWithClient(client), nil, nil)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/books/lookup", h.LookupBook)
+
+	meta, err := book.GoogleBooks.LookupByISBN(context.Background(), "9780452284234")
+	require.NoError(t, err)
+	cached, err := json.Marshal(meta)
+	require.NoError(t, err)
+	calls = 0
+
+	// First lookup misses the cache and stores the result for a day
+	mock.ExpectGet("books:lookup:9780452284234").RedisNil()
+	mock.ExpectSet("books:lookup:9780452284234", cached, 24*time.Hour).SetVal("OK")
+	resp := lookupRequest(t, app, `{"isbn":"978-0-452-28423-4"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var lookup book.BookLookup
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&lookup))
+	assert.Equal(t, "Nineteen Eighty-Four", lookup.Title)
+	assert.Equal(t, "George Orwell", lookup.Author)
+	assert.Equal(t, 2003, lookup.Year)
+	assert.Equal(t, "Fiction", lookup.Genre)
+	assert.Equal(t, "978-0-452-28423-4", lookup.ISBN)
+	assert.Equal(t, 339, lookup.PageCount)
+	assert.Zero(t, lookup.ID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Second lookup is served from the cache
+	mock.ExpectGet("books:lookup:9780452284234").SetVal(string(cached))
+	resp = lookupRequest(t, app, `{"isbn":"9780452284234"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupBookHandlerErrors(t *testing.T) {
+	var calls int32
+	prevClient := book.GoogleBooks
+	defer func() { book.GoogleBooks = prevClient }()
+	book.GoogleBooks = fakeGoogleBooks(t, &calls)
+	h := book.NewBookHandler(newFakeBookStore(), nil, nil, nil)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/books/lookup", h.LookupBook)
+
+	cases := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"isbn":"978-0-452-28423-5"}`, http.StatusBadRequest, apierrors.ErrValidation.Code},
+		{`{}`, http.StatusBadRequest, apierrors.ErrValidation.Code},
+		{`{"isbn":"9780306406157"}`, http.StatusNotFound, apierrors.ErrBookMetadataNotFound.Code},
+		{`{"isbn":"0-306-40615-2"}`, http.StatusBadGateway, apierrors.ErrUpstream.Code},
+	}
+	for _, tc := range cases {
+		resp := lookupRequest(t, app, tc.body)
+		assert.Equal(t, tc.status, resp.StatusCode, tc.body)
+
+		var body apierrors.APIError
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, tc.code, body.Code, tc.body)
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/health"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// leakGoroutines starts n goroutines that block until the test ends
+func leakGoroutines(t *testing.T, n int) {
+	release := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func() { <-release }()
+	}
+	t.Cleanup(func() { close(release) })
+}
+
+func TestGoroutineMonitor_DetectsAccumulation(t *testing.T) {
+	var alerts atomic.Int32
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["text"] != "" {
+			alerts.Add(1)
+		}
+	}))
+	defer slack.Close()
+
+	baseline := runtime.NumGoroutine()
+	monitor := health.NewGoroutineMonitor(health.GoroutineMonitorConfig{
+		LeakThreshold:     baseline + 100,
+		CriticalThreshold: baseline + 1000,
+		SlackWebhookURL:   slack.URL,
+	}, nil)
+	var restarts atomic.Int32
+	monitor.Restart = func() { restarts.Add(1) }
+
+	monitor.Check(context.Background())
+	assert.False(t, monitor.Leaking())
+	assert.Zero(t, alerts.Load())
+
+	leakGoroutines(t, 200)
+	monitor.Check(context.Background())
+	assert.True(t, monitor.Leaking())
+	assert.Equal(t, int32(1), alerts.Load())
+
+	// The leak is alerted once, not on every check
+	monitor.Check(context.Background())
+	assert.Equal(t, int32(1), alerts.Load())
+	assert.Zero(t, restarts.Load())
+
+	leakGoroutines(t, 1000)
+	monitor.Check(context.Background())
+	assert.Equal(t, int32(1), restarts.Load())
+}
+
+func TestGoroutineMonitor_ClearsLeakWhenCountDrops(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	monitor := health.NewGoroutineMonitor(health.GoroutineMonitorConfig{
+		LeakThreshold:     baseline + 50,
+		CriticalThreshold: baseline + 10000,
+	}, nil)
+	monitor.Restart = func() { t.Fatal("restarted below the critical threshold") }
+
+	release := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		go func() { <-release }()
+	}
+	monitor.Check(context.Background())
+	require.True(t, monitor.Leaking())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		monitor.Check(context.Background())
+		return !monitor.Leaking()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestGoroutineMonitorConfigFromEnv(t *testing.T) {
+	config, err := health.GoroutineMonitorConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, health.DefaultGoroutineLeakThreshold, config.LeakThreshold)
+	assert.Equal(t, health.DefaultGoroutineCriticalThreshold, config.CriticalThreshold)
+
+	t.Setenv("GOROUTINE_LEAK_THRESHOLD", "200")
+	t.Setenv("GOROUTINE_CRITICAL_THRESHOLD", "800")
+	config, err = health.GoroutineMonitorConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 200, config.LeakThreshold)
+	assert.Equal(t, 800, config.CriticalThreshold)
+
+	t.Setenv("GOROUTINE_CRITICAL_THRESHOLD", "100")
+	_, err = health.GoroutineMonitorConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("GOROUTINE_LEAK_THRESHOLD", "lots")
+	_, err = health.GoroutineMonitorConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestGoroutinesHandler_DumpIsAdminOnly(t *testing.T) {
+	admin := false
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/health/goroutines", health.GoroutinesHandler(func(c *fiber.Ctx) bool { return admin }))
+
+	get := func(path string) (*http.Response, health.GoroutinesResponse) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		var body health.GoroutinesResponse
+		raw, _ := io.ReadAll(resp.Body)
+		json.Unmarshal(raw, &body)
+		return resp, body
+	}
+
+	resp, body := get("/health/goroutines")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Positive(t, body.Goroutines)
+	assert.Empty(t, body.Dump)
+
+	resp, _ = get("/health/goroutines?dump=true")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	admin = true
+	resp, body = get("/health/goroutines?dump=true")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body.Dump, "goroutine ")
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphiteLine is "<path> <value> <timestamp>" with a path of dot-separated
+// nodes
+var graphiteLine = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)* -?[0-9.e+-]+ [0-9]+$`)
+
+// graphiteRegistry has one metric of each kind
+func graphiteRegistry(t *testing.T) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"method", "path"})
+	requests.WithLabelValues("GET", "/books/:id").Add(3)
+	books := prometheus.NewGauge(prometheus.GaugeOpts{Name: "books_total"})
+	books.Set(42)
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{0.1, 0.5}})
+	latency.Observe(0.05)
+	latency.Observe(0.3)
+	latency.Observe(2)
+
+	for _, c := range []prometheus.Collector{requests, books, latency} {
+		require.NoError(t, registry.Register(c))
+	}
+	return registry
+}
+
+func writeGraphite(t *testing.T, prefix string) []string {
+	var buf bytes.Buffer
+	require.NoError(t, metrics.WriteGraphite(&buf, graphiteRegistry(t), prefix, time.Unix(1700000000, 0)))
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestWriteGraphite_PlaintextFormat(t *testing.T) {
+	lines := writeGraphite(t, "")
+	for _, line := range lines {
+		assert.Regexp(t, graphiteLine, line)
+	}
+	assert.Equal(t, []string{
+		"books_total 42 1700000000",
+		"latency_seconds_bucket.0_1 1 1700000000",
+		"latency_seconds_bucket.0_5 2 1700000000",
+		"latency_seconds_bucket.inf 3 1700000000",
+		"latency_seconds_sum 2.35 1700000000",
+		"latency_seconds_count 3 1700000000",
+		"requests_total.GET._books__id 3 1700000000",
+	}, lines)
+}
+
+func TestWriteGraphite_Prefix(t *testing.T) {
+	for _, line := range writeGraphite(t, "gobooklibrary.") {
+		assert.True(t, strings.HasPrefix(line, "gobooklibrary."), line)
+		assert.Regexp(t, graphiteLine, line)
+	}
+}
+
+func TestGraphiteHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/metrics/graphite", metrics.GraphiteHandler(graphiteRegistry(t)))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/metrics/graphite?prefix=gobooklibrary.", nil))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "gobooklibrary.books_total 42 ")
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/admin/metrics/graphite?prefix=bad%20prefix", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestPushGraphite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	require.NoError(t, metrics.PushGraphite(context.Background(), ln.Addr().String(), graphiteRegistry(t), "app."))
+	select {
+	case data := <-received:
+		assert.Contains(t, data, "app.books_total 42 ")
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was pushed")
+	}
+}
+
+func TestGraphiteAddress(t *testing.T) {
+	assert.Equal(t, "graphite:2003", metrics.GraphiteAddress("graphite"))
+	assert.Equal(t, "graphite:2004", metrics.GraphiteAddress("graphite:2004"))
+}
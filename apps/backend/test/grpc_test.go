@@ -0,0 +1,112 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	grpcserver "github.com/AtillaTahaK/gobooklibrary/pkg/grpc"
+	"github.com/AtillaTahaK/gobooklibrary/proto/bookpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcClient serves the book service over store in memory and returns a
+// client connected to it
+func grpcClient(t *testing.T, store book.Store) bookpb.BookServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	server := grpcserver.NewServer(book.NewService(store, nil), nil, nil, nil)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return bookpb.NewBookServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func assertCode(t *testing.T, want codes.Code, err error) {
+	t.Helper()
+	require.Error(t, err)
+	assert.Equal(t, want, status.Code(err), err.Error())
+}
+
+func TestGRPC_RequiresTokenForWrites(t *testing.T) {
+	client := grpcClient(t, newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965, Status: book.StatusAvailable}))
+	signedToken(t, "admin")
+
+	resp, err := client.GetBook(context.Background(), &bookpb.GetBookRequest{Id: 1})
+	require.NoError(t, err, "reads are public")
+	assert.Equal(t, "Dune", resp.GetBook().GetTitle())
+
+	create := &bookpb.CreateBookRequest{Title: "Emma", Author: "Jane Austen", Year: 1815}
+	_, err = client.CreateBook(context.Background(), create)
+	assertCode(t, codes.Unauthenticated, err)
+	_, err = client.CreateBook(withToken("not-a-token"), create)
+	assertCode(t, codes.Unauthenticated, err)
+	_, err = client.DeleteBook(context.Background(), &bookpb.DeleteBookRequest{Id: 1})
+	assertCode(t, codes.Unauthenticated, err)
+}
+
+func TestGRPC_ValidatesLikeHTTP(t *testing.T) {
+	store := newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965, Status: book.StatusAvailable})
+	client := grpcClient(t, store)
+	ctx := withToken(signedToken(t, "admin"))
+
+	for _, req := range []*bookpb.CreateBookRequest{
+		{Title: "Emma", Year: 1815},
+		{Title: "Emma", Author: "Jane Austen"},
+		{Title: "Emma", Author: "Jane Austen", Year: 1200},
+		{Title: "Emma", Author: "Jane Austen", Year: 1815, Isbn: "123"},
+	} {
+		_, err := client.CreateBook(ctx, req)
+		assertCode(t, codes.InvalidArgument, err)
+	}
+
+	_, err := client.UpdateBook(ctx, &bookpb.UpdateBookRequest{Id: 1, Year: 3000})
+	assertCode(t, codes.InvalidArgument, err)
+	assert.Contains(t, status.Convert(err).Message(), "year")
+
+	store.duplicates = []dedup.Candidate{{ID: 1, Title: "Dune"}}
+	_, err = client.CreateBook(ctx, &bookpb.CreateBookRequest{Title: "Dune!", Author: "Frank Herbert", Year: 1965})
+	assertCode(t, codes.AlreadyExists, err)
+
+	store.duplicates = nil
+	resp, err := client.CreateBook(ctx, &bookpb.CreateBookRequest{Title: "Emma", Author: "Jane Austen", Year: 1815})
+	require.NoError(t, err)
+	created, err := store.GetBookByID(context.Background(), uint(resp.GetBook().GetId()))
+	require.NoError(t, err)
+	assert.Equal(t, book.StatusAvailable, created.Status)
+}
+
+func TestGRPC_MapsStoreErrors(t *testing.T) {
+	client := grpcClient(t, newFakeBookStore(book.Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965, Status: book.StatusCheckedOut}))
+	ctx := withToken(signedToken(t, "admin"))
+
+	_, err := client.GetBook(ctx, &bookpb.GetBookRequest{Id: 99})
+	assertCode(t, codes.NotFound, err)
+	_, err = client.UpdateBook(ctx, &bookpb.UpdateBookRequest{Id: 99, Title: "Emma"})
+	assertCode(t, codes.NotFound, err)
+	_, err = client.DeleteBook(ctx, &bookpb.DeleteBookRequest{Id: 99})
+	assertCode(t, codes.NotFound, err)
+
+	_, err = client.DeleteBook(ctx, &bookpb.DeleteBookRequest{Id: 1})
+	assertCode(t, codes.FailedPrecondition, err)
+}
@@ -0,0 +1,407 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/external/googlebooks"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/health"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/mail"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChecker struct {
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (f fakeChecker) Name() string { return f.name }
+
+func (f fakeChecker) Check(ctx context.Context) error {
+	select {
+	case <-time.After(f.delay):
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stuckChecker ignores its context, like a probe blocked in a syscall
+type stuckChecker struct{ release chan struct{} }
+
+func (s stuckChecker) Name() string { return "stuck" }
+
+func (s stuckChecker) Check(ctx context.Context) error {
+	<-s.release
+	return nil
+}
+
+func serveHealth(t *testing.T, registry *health.Registry) (int, health.Report) {
+	app := fiber.New()
+	app.Get("/health", health.Handler(registry))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health", nil), -1)
+	require.NoError(t, err)
+
+	var report health.Report
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	return resp.StatusCode, report
+}
+
+func TestHealthAllChecksPass(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	registry.Register(fakeChecker{name: "database"}, fakeChecker{name: "redis"})
+
+	status, report := serveHealth(t, registry)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusHealthy, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+	assert.Empty(t, report.Checks["database"].Error)
+}
+
+func TestHealthPartialFailure(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	registry.Register(
+		fakeChecker{name: "database"},
+		fakeChecker{name: "redis", err: errors.New("connection refused")},
+	)
+
+	status, report := serveHealth(t, registry)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusUnhealthy, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, health.StatusError, report.Checks["redis"].Status)
+	assert.Equal(t, "connection refused", report.Checks["redis"].Error)
+}
+
+func TestHealthResponseFormat(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	registry.Register(fakeChecker{name: "redis", err: errors.New("connection refused")})
+
+	app := fiber.New()
+	app.Get("/health", health.Handler(registry))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.NoError(t, err)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "unhealthy", body["status"])
+	redis := body["checks"].(map[string]interface{})["redis"].(map[string]interface{})
+	assert.Equal(t, "error", redis["status"])
+	assert.Equal(t, "connection refused", redis["error"])
+	assert.Contains(t, redis, "latency_ms")
+}
+
+func TestHealthChecksRunConcurrently(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		registry.Register(fakeChecker{name: name, delay: 100 * time.Millisecond})
+	}
+
+	start := time.Now()
+	report := registry.Run(context.Background())
+	assert.Equal(t, health.StatusHealthy, report.Status)
+	assert.Less(t, time.Since(start), 300*time.Millisecond, "four 100ms checks should run in parallel")
+	assert.GreaterOrEqual(t, report.Checks["a"].LatencyMs, int64(100))
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	t.Setenv("CHECK_TIMEOUT_MS", "")
+	t.Setenv("CHECK_TIMEOUT_MS_SLOW", "50")
+	t.Setenv("CHECK_TIMEOUT_MS_STUCK", "50")
+
+	release := make(chan struct{})
+	defer close(release)
+
+	registry := health.NewRegistry(time.Second)
+	registry.Register(
+		fakeChecker{name: "slow", delay: time.Second},
+		fakeChecker{name: "fast"},
+		stuckChecker{release: release},
+	)
+
+	start := time.Now()
+	report := registry.Run(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, health.StatusUnhealthy, report.Status)
+	assert.Equal(t, health.StatusError, report.Checks["slow"].Status)
+	assert.Contains(t, report.Checks["slow"].Error, "deadline exceeded")
+	assert.Equal(t, health.StatusError, report.Checks["stuck"].Status, "checkers that ignore ctx still time out")
+	assert.Equal(t, health.StatusOK, report.Checks["fast"].Status)
+}
+
+func TestHealthTimeoutFromEnv(t *testing.T) {
+	t.Setenv("CHECK_TIMEOUT_MS", "")
+	t.Setenv("CHECK_TIMEOUT_MS_DATABASE", "")
+	assert.Equal(t, health.DefaultTimeout, health.TimeoutFromEnv("database", health.DefaultTimeout))
+
+	t.Setenv("CHECK_TIMEOUT_MS", "750")
+	assert.Equal(t, 750*time.Millisecond, health.TimeoutFromEnv("database", health.DefaultTimeout))
+
+	t.Setenv("CHECK_TIMEOUT_MS_DATABASE", "300")
+	assert.Equal(t, 300*time.Millisecond, health.TimeoutFromEnv("database", health.DefaultTimeout))
+	assert.Equal(t, 750*time.Millisecond, health.TimeoutFromEnv("redis", health.DefaultTimeout))
+}
+
+func TestHealthRegisterReplacesByName(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	registry.Register(fakeChecker{name: "redis", err: errors.New("down")})
+	registry.Register(fakeChecker{name: "redis"}, fakeChecker{name: "search"})
+
+	assert.Equal(t, []string{"redis", "search"}, registry.Names())
+	assert.Equal(t, health.StatusHealthy, registry.Run(context.Background()).Status)
+}
+
+func TestRedisHealthCheckerUnreachable(t *testing.T) {
+	checker := cache.HealthChecker{Cache: cache.NewRedisCache("127.0.0.1:1", "", 0)}
+	defer checker.Cache.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Equal(t, "redis", checker.Name())
+	assert.Error(t, checker.Check(ctx))
+}
+
+func TestLiveProbeIgnoresDependencies(t *testing.T) {
+	health.MarkNotReady("starting")
+	defer health.MarkNotReady("starting")
+
+	app := fiber.New()
+	app.Get("/health/live", health.LiveHandler())
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestReadyProbeLifecycle(t *testing.T) {
+	defer health.MarkNotReady("starting")
+
+	registry := health.NewRegistry(time.Second)
+	registry.Register(fakeChecker{name: "database"}, fakeChecker{name: "redis"})
+
+	app := fiber.New()
+	app.Get("/health/ready", health.ReadyHandler(registry))
+
+	probe := func() (int, map[string]interface{}) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health/ready", nil), -1)
+		require.NoError(t, err)
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	// Not ready until startup finishes
+	health.MarkNotReady("starting")
+	status, body := probe()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "not_ready", body["status"])
+	assert.Equal(t, "starting", body["reason"])
+
+	health.MarkReady()
+	status, body = probe()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ready", body["status"])
+
+	// Out of rotation as soon as shutdown begins
+	health.MarkNotReady("shutting down")
+	status, body = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "shutting down", body["reason"])
+	ok, reason := health.IsReady()
+	assert.False(t, ok)
+	assert.Equal(t, "shutting down", reason)
+}
+
+func TestReadyProbeFailsWhenDependencyDown(t *testing.T) {
+	health.MarkReady()
+	defer health.MarkNotReady("starting")
+
+	registry := health.NewRegistry(time.Second)
+	registry.Register(fakeChecker{name: "database"}, fakeChecker{name: "redis", err: errors.New("connection refused")})
+
+	app := fiber.New()
+	app.Get("/health/ready", health.ReadyHandler(registry))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health/ready", nil), -1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestReadyProbeWaitsAtMostReadyTimeout(t *testing.T) {
+	t.Setenv("CHECK_TIMEOUT_MS", "")
+	health.MarkReady()
+	defer health.MarkNotReady("starting")
+
+	// The checker's own timeout is longer than the probe allows
+	registry := health.NewRegistry(time.Minute)
+	registry.Register(fakeChecker{name: "database", delay: time.Minute})
+
+	app := fiber.New()
+	app.Get("/health/ready", health.ReadyHandler(registry))
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health/ready", nil), -1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Less(t, time.Since(start), health.ReadyTimeout+time.Second)
+}
+
+// useProbes sets the checkers of the Probe functions for one test
+func useProbes(t *testing.T, database, redis, googleBooks, smtp health.Checker) {
+	previous := []health.Checker{health.DatabaseProbe, health.RedisProbe, health.GoogleBooksProbe, health.SMTPProbe}
+	health.DatabaseProbe, health.RedisProbe, health.GoogleBooksProbe, health.SMTPProbe = database, redis, googleBooks, smtp
+	t.Cleanup(func() {
+		health.DatabaseProbe, health.RedisProbe, health.GoogleBooksProbe, health.SMTPProbe = previous[0], previous[1], previous[2], previous[3]
+	})
+}
+
+// fakeSMTPServer greets like an SMTP server, or says nothing when silent
+func fakeSMTPServer(t *testing.T, silent bool) mail.Config {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if silent {
+					time.Sleep(time.Second)
+					return
+				}
+				fmt.Fprint(conn, "220 mail.test ESMTP\r\n")
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if strings.HasPrefix(strings.ToUpper(line), "QUIT") {
+						fmt.Fprint(conn, "221 bye\r\n")
+						return
+					}
+					fmt.Fprint(conn, "250 ok\r\n")
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return mail.Config{Host: "127.0.0.1", Port: addr.Port}
+}
+
+func TestProbeDatabase(t *testing.T) {
+	conn, _ := mockDB(t)
+	useProbes(t, db.HealthChecker{DB: conn}, nil, nil, nil)
+	assert.Equal(t, health.StatusOK, health.ProbeDatabase(context.Background()).Status)
+
+	useProbes(t, fakeChecker{name: "database", delay: time.Second}, nil, nil, nil)
+	t.Setenv("HEALTH_PROBE_DB_TIMEOUT_MS", "50")
+	start := time.Now()
+	result := health.ProbeDatabase(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, health.StatusError, result.Status)
+	assert.Contains(t, result.Error, "deadline exceeded")
+}
+
+func TestProbeRedis(t *testing.T) {
+	useProbes(t, nil, fakeChecker{name: "redis"}, nil, nil)
+	assert.Equal(t, health.StatusOK, health.ProbeRedis(context.Background()).Status)
+
+	unreachable := cache.NewRedisCache("127.0.0.1:1", "", 0)
+	defer unreachable.Close()
+	useProbes(t, nil, cache.HealthChecker{Cache: unreachable}, nil, nil)
+	t.Setenv("HEALTH_PROBE_REDIS_TIMEOUT_MS", "500")
+	assert.Equal(t, health.StatusError, health.ProbeRedis(context.Background()).Status)
+
+	useProbes(t, nil, nil, nil, nil)
+	assert.Equal(t, "not configured", health.ProbeRedis(context.Background()).Error)
+}
+
+func TestProbeGoogleBooksAPI(t *testing.T) {
+	status := http.StatusNotFound
+	delay := time.Duration(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	useProbes(t, nil, nil, googlebooks.HealthChecker{Client: &googlebooks.Client{BaseURL: server.URL}}, nil)
+
+	// Reachable even though the root isn't a resource
+	assert.Equal(t, health.StatusOK, health.ProbeGoogleBooksAPI(context.Background()).Status)
+
+	status = http.StatusServiceUnavailable
+	result := health.ProbeGoogleBooksAPI(context.Background())
+	assert.Equal(t, health.StatusError, result.Status)
+	assert.Contains(t, result.Error, "503")
+
+	status, delay = http.StatusOK, 300*time.Millisecond
+	t.Setenv("HEALTH_PROBE_GOOGLE_BOOKS_TIMEOUT_MS", "50")
+	assert.Equal(t, health.StatusError, health.ProbeGoogleBooksAPI(context.Background()).Status)
+}
+
+func TestProbeSMTP(t *testing.T) {
+	useProbes(t, nil, nil, nil, mail.HealthChecker{Config: fakeSMTPServer(t, false)})
+	result := health.ProbeSMTP(context.Background())
+	assert.Equal(t, health.StatusOK, result.Status, result.Error)
+
+	useProbes(t, nil, nil, nil, mail.HealthChecker{Config: fakeSMTPServer(t, true)})
+	t.Setenv("HEALTH_PROBE_SMTP_TIMEOUT_MS", "50")
+	assert.Equal(t, health.StatusError, health.ProbeSMTP(context.Background()).Status)
+
+	useProbes(t, nil, nil, nil, mail.HealthChecker{})
+	assert.Equal(t, mail.ErrNotConfigured.Error(), health.ProbeSMTP(context.Background()).Error)
+}
+
+func TestRunProbes_OnlyCriticalProbesDegrade(t *testing.T) {
+	down := errors.New("down")
+	useProbes(t, fakeChecker{name: "database"}, fakeChecker{name: "redis"},
+		fakeChecker{name: "google_books", err: down}, fakeChecker{name: "smtp", err: down})
+
+	app := fiber.New()
+	app.Get("/health/dependencies", health.ProbesHandler())
+	serve := func() (int, health.ProbeReport) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health/dependencies", nil), -1)
+		require.NoError(t, err)
+		var report health.ProbeReport
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		return resp.StatusCode, report
+	}
+
+	status, report := serve()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusHealthy, report.Status)
+	assert.Len(t, report.Probes, 4)
+	assert.Equal(t, health.StatusError, report.Probes["smtp"].Status)
+	assert.Equal(t, "down", report.Probes["google_books"].Error)
+
+	// Probes run in parallel, so a slow one doesn't add up
+	slow := fakeChecker{name: "redis", delay: 200 * time.Millisecond, err: down}
+	useProbes(t, fakeChecker{name: "database", delay: 200 * time.Millisecond}, slow,
+		fakeChecker{name: "google_books", delay: 200 * time.Millisecond}, fakeChecker{name: "smtp"})
+	start := time.Now()
+	status, report = serve()
+	assert.Less(t, time.Since(start), 350*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Equal(t, health.StatusOK, report.Probes["database"].Status)
+}
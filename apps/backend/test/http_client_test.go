@@ -0,0 +1,145 @@
+package test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// externalRequests is external_http_requests_total for host and status, 0
+// before its first request
+func externalRequests(t *testing.T, host, status string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "external_http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["host"] == host && labels["status_code"] == status {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// countingServer answers 200, or 404 under /missing, and counts the
+// connections clients opened to it
+func countingServer(t testing.TB) (*httptest.Server, *int64) {
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &conns
+}
+
+func fetch(t testing.TB, client *http.Client, url string) int {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestMetricsTransport_RecordsRequests(t *testing.T) {
+	server, _ := countingServer(t)
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := exthttp.NewClient(time.Second)
+
+	ok, missing := externalRequests(t, host, "200"), externalRequests(t, host, "404")
+	assert.Equal(t, http.StatusOK, fetch(t, client, server.URL))
+	assert.Equal(t, http.StatusOK, fetch(t, client, server.URL))
+	assert.Equal(t, http.StatusNotFound, fetch(t, client, server.URL+"/missing"))
+	assert.Equal(t, ok+2, externalRequests(t, host, "200"))
+	assert.Equal(t, missing+1, externalRequests(t, host, "404"))
+
+	// Requests that get no response are recorded as errors
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedHost := strings.TrimPrefix(closed.URL, "http://")
+	closed.Close()
+	_, err := client.Get(closed.URL)
+	assert.Error(t, err)
+	assert.Equal(t, float64(1), externalRequests(t, closedHost, "error"))
+}
+
+func TestPooledClient_ReusesConnections(t *testing.T) {
+	server, conns := countingServer(t)
+	client := exthttp.NewClient(5 * time.Second)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < exthttp.MaxIdleConnsPerHost; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				fetch(t, client, server.URL)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, atomic.LoadInt64(conns), int64(exthttp.MaxIdleConnsPerHost),
+		"each worker keeps reusing an idle connection")
+}
+
+// BenchmarkHTTPClient compares a new client and transport per request, as
+// callers without a shared client did, with the pooled client
+func BenchmarkHTTPClient(b *testing.B) {
+	clients := map[string]func() *http.Client{
+		"PerRequest": func() *http.Client {
+			return &http.Client{Transport: &http.Transport{}, Timeout: 5 * time.Second}
+		},
+		"Pooled": func() *http.Client {
+			return exthttp.DefaultClient
+		},
+	}
+	for _, name := range []string{"PerRequest", "Pooled"} {
+		newClient := clients[name]
+		b.Run(name, func(b *testing.B) {
+			server, conns := countingServer(b)
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					client := newClient()
+					fetch(b, client, server.URL)
+					if t, ok := client.Transport.(*http.Transport); ok {
+						t.CloseIdleConnections()
+					}
+				}
+			})
+			b.StopTimer()
+			b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+		})
+	}
+}
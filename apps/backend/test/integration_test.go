@@ -1,31 +1,74 @@
 package test
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/AtillaTahaK/gobooklibrary/activity"
 	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/author"
 	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/cors"
 	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/analytics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/batch"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/container"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db/migrations"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/dedup"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/geo"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/seed"
+	"github.com/AtillaTahaK/gobooklibrary/privacy"
+	"github.com/AtillaTahaK/gobooklibrary/report"
+	"github.com/AtillaTahaK/gobooklibrary/search"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/suite"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type BookAPITestSuite struct {
 	suite.Suite
-	app    *fiber.App
-	cache  *cache.RedisCache
-	logger *logger.Logger
-	token  string
+	app         *fiber.App
+	cache       *cache.RedisCache
+	logger      *logger.Logger
+	services    *container.Container
+	bookHandler *book.BookHandler
+	authHandler *auth.Handler
+	webhooks    *webhook.Handler
+	reports     *report.Handler
+	analytics   *analytics.Handler
+	geo         *geo.Handler
+	// db, books and users reach the database directly, for setup and
+	// assertions
+	db         *gorm.DB
+	books      book.Store
+	users      auth.Store
+	token      string
+	adminToken string
 }
 
 func (suite *BookAPITestSuite) SetupSuite() {
@@ -41,17 +84,27 @@ func (suite *BookAPITestSuite) SetupSuite() {
 	// Initialize cache
 	suite.cache = cache.NewRedisCache("localhost:6379", "", 2) // Use DB 2 for testing
 
-	// Set global instances
-	book.Cache = suite.cache
-	book.Log = suite.logger
-	auth.Log = suite.logger
-
-	// Connect to test database
-	db.ConnectDB()
-	db.AutoMigrate(&auth.User{}, &book.Book{})
+	// Connect to test database and build the handlers from its services
+	services, err := container.New(container.Config{Logger: suite.logger, Cache: suite.cache})
+	suite.Require().NoError(err)
+	suite.services = services
+	suite.bookHandler = services.BookHandler()
+	suite.authHandler = services.AuthHandler()
+	suite.webhooks = services.WebhookHandler()
+	suite.reports = services.ReportHandler()
+	suite.analytics = services.AnalyticsHandler()
+	suite.geo = services.GeoHandler()
+	suite.db = services.DB
+	suite.books = book.NewDBStore(services.DB, suite.logger)
+	suite.users = auth.NewDBStore(services.DB, suite.logger)
+	middleware.SessionRevoked = suite.authHandler.IsSessionRevoked
+	middleware.LoadUser = suite.authHandler.LoadCurrentUser
+
+	db.AutoMigrate(suite.db, &auth.User{}, &book.Book{}, &book.Series{}, &book.SeriesEntry{}, &author.Author{}, &book.Genre{}, &book.Bookmark{}, &book.SearchHistory{}, &webhook.Webhook{}, &webhook.Delivery{}, &webhook.DeadLetter{}, &auth.Session{}, &book.BookChange{}, &book.Loan{}, &book.Rating{}, &book.ReadingStatus{}, &book.Annotation{}, &book.SyncHistory{}, &report.ScheduledReport{}, &cors.Origin{})
+	suite.Require().NoError(migrations.Run(suite.db))
 
 	// Setup Fiber app
-	suite.app = fiber.New()
+	suite.app = fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
 
 	// Setup routes
 	suite.setupRoutes()
@@ -68,13 +121,31 @@ func (suite *BookAPITestSuite) TearDownSuite() {
 	}
 
 	// Clean up database
-	db.DB.Exec("DELETE FROM books")
-	db.DB.Exec("DELETE FROM users")
+	suite.db.Exec("DELETE FROM bookmarks")
+	suite.db.Exec("DELETE FROM books")
+	suite.db.Exec("DELETE FROM users")
 }
 
 func (suite *BookAPITestSuite) SetupTest() {
 	// Clean up books before each test
-	db.DB.Exec("DELETE FROM books")
+	suite.db.Exec("DELETE FROM bookmarks")
+	suite.db.Exec("DELETE FROM search_history")
+	suite.db.Exec("DELETE FROM series_entries")
+	suite.db.Exec("DELETE FROM series")
+	suite.db.Exec("DELETE FROM book_changes")
+	suite.db.Exec("DELETE FROM loans")
+	suite.db.Exec("DELETE FROM ratings")
+	suite.db.Exec("DELETE FROM reading_statuses")
+	suite.db.Exec("DELETE FROM annotations")
+	suite.db.Exec("DELETE FROM books")
+	suite.db.Exec("DELETE FROM authors")
+	suite.db.Exec("DELETE FROM genres")
+	suite.db.Exec("DELETE FROM webhook_deliveries")
+	suite.db.Exec("DELETE FROM dead_letter_queue")
+	suite.db.Exec("DELETE FROM webhooks")
+	suite.db.Exec("DELETE FROM reports")
+	suite.db.Exec("DELETE FROM sync_history")
+	suite.db.Exec("DELETE FROM cors_origins")
 
 	// Clear cache
 	if suite.cache != nil {
@@ -83,17 +154,123 @@ func (suite *BookAPITestSuite) SetupTest() {
 }
 
 func (suite *BookAPITestSuite) setupRoutes() {
+	suite.app.Use(middleware.TraceContext())
+	suite.app.Use(middleware.DynamicCORS(middleware.CORSConfig{Origins: suite.services.CORSHandler().AllowedOrigins}))
+
+	authHandler := suite.authHandler
+	bookHandler := suite.bookHandler
+	authorHandler := suite.services.AuthorHandler()
+	searchHandler := suite.services.SearchHandler()
+	activityHandler := suite.services.ActivityHandler()
+	privacyHandler := suite.services.PrivacyHandler()
+	corsHandler := suite.services.CORSHandler()
+
 	// Public routes
-	suite.app.Post("/auth/register", auth.Register)
-	suite.app.Post("/auth/login", auth.Login)
-	suite.app.Get("/books", book.GetBooks)
-	suite.app.Get("/books/:id", book.GetBook)
+	suite.app.Post("/auth/register", authHandler.Register)
+	suite.app.Post("/auth/login", authHandler.Login)
+	suite.app.Get("/books", middleware.JWTOptional(), bookHandler.GetBooks)
+	suite.app.Get("/books/export", middleware.JWTProtected(), middleware.InjectUser(), middleware.RequireAdmin(), bookHandler.ExportBooks)
+	suite.app.Get("/books/stream", bookHandler.StreamBooks)
+	suite.app.Get("/books/new", bookHandler.GetNewBooks)
+	suite.app.Get("/books/popular", bookHandler.GetPopularBooks)
+	suite.app.Get("/books/trending", suite.analytics.GetTrendingBooks)
+	suite.app.Get("/books/leaderboard", bookHandler.GetLeaderboard)
+	suite.app.Get("/books/leaderboard/all-time", bookHandler.GetAllTimeLeaderboard)
+	suite.app.Get("/books/:id", middleware.JWTOptional(), bookHandler.GetBook)
+	suite.app.Get("/books/:id/cover", bookHandler.GetCover)
+	suite.app.Get("/books/:id/cover/placeholder", bookHandler.GetCoverPlaceholder)
+	suite.app.Get("/series", bookHandler.GetSeriesList)
+	suite.app.Get("/series/:id/books", bookHandler.GetSeriesBooks)
+	suite.app.Get("/genres", bookHandler.ListGenres)
+	suite.app.Get("/authors", authorHandler.GetAuthors)
+	suite.app.Get("/authors/:id", authorHandler.GetAuthor)
+	suite.app.Get("/authors/:id/books", authorHandler.GetAuthorBooks)
+	suite.app.Get("/users/:id/books", bookHandler.GetUserBooks)
+	suite.app.Get("/search", searchHandler.Search)
+	suite.app.Get("/search/suggest", searchHandler.Suggest)
+	suite.app.Get("/ws/me/activity", middleware.TokenFromQuery(), middleware.JWTProtected(), activity.UpgradeHandler, activity.StreamHandler)
+	suite.app.Post(batch.Path, batch.Handler(suite.app, batch.DefaultConcurrency))
 
 	// Protected routes
-	protected := suite.app.Group("/", middleware.JWTProtected())
-	protected.Post("/books", book.AddBookHandler)
-	protected.Put("/books/:id", book.UpdateBookHandler)
-	protected.Delete("/books/:id", book.DeleteBookHandler)
+	protected := suite.app.Group("/", middleware.JWTProtected(), middleware.InjectUser())
+	protected.Post("/books", bookHandler.AddBook)
+	protected.Post("/books/lookup", bookHandler.LookupBook)
+	protected.Put("/books/:id", bookHandler.UpdateBook)
+	protected.Delete("/books/:id", bookHandler.DeleteBook)
+	protected.Put("/books/:id/rating", bookHandler.RateBook)
+	protected.Put("/books/:id/reading-status", bookHandler.SetReadingStatus)
+	protected.Get("/books/:id/history", bookHandler.GetBookHistory)
+	protected.Post("/books/:id/annotations", bookHandler.CreateAnnotation)
+	protected.Get("/books/:id/annotations", bookHandler.GetBookAnnotations)
+	protected.Put("/annotations/:id", bookHandler.UpdateAnnotation)
+	protected.Delete("/annotations/:id", bookHandler.DeleteAnnotation)
+	protected.Post("/books/:id/bookmark", bookHandler.AddBookmark)
+	protected.Delete("/books/:id/bookmark", bookHandler.RemoveBookmark)
+	protected.Post("/books/:id/checkout", bookHandler.CheckoutBook)
+	protected.Put("/loans/:id/return", bookHandler.ReturnLoan)
+	protected.Get("/series/:id/progress", bookHandler.GetSeriesProgress)
+	protected.Post("/me/delete-account", authHandler.DeleteMyAccount)
+	protected.Get("/me/permissions", authHandler.GetMyPermissions)
+	protected.Get("/me/sessions", authHandler.ListMySessions)
+	protected.Delete("/me/sessions", authHandler.RevokeMyOtherSessions)
+	protected.Delete("/me/sessions/:id", authHandler.RevokeMySession)
+	protected.Get("/me/activity", activityHandler.GetMyActivity)
+	protected.Get("/me/export", privacyHandler.ExportMyData)
+	protected.Get("/me/bookmarks", bookHandler.GetMyBookmarks)
+	protected.Get("/me/annotations", bookHandler.GetMyAnnotations)
+	protected.Get("/me/series/in-progress", bookHandler.GetMySeriesInProgress)
+	protected.Get("/me/search-history", bookHandler.GetMySearchHistory)
+	protected.Delete("/me/search-history", bookHandler.ClearMySearchHistory)
+	protected.Delete("/me/search-history/:id", bookHandler.ClearMySearchHistory)
+
+	// Admin routes
+	admin := protected.Group("/", middleware.RequireAdmin())
+	admin.Get("/admin/users/deleted", authHandler.ListDeletedUsers)
+	admin.Get("/admin/users/export", authHandler.ExportUsers)
+	admin.Post("/admin/users/cleanup", authHandler.CleanupUsers)
+	admin.Get("/admin/users/cleanup/schedule", authHandler.GetCleanupSchedule)
+	admin.Post("/admin/users/cleanup/schedule", authHandler.ScheduleCleanup)
+	admin.Post("/admin/users/upgrade-password-cost", authHandler.UpgradePasswordCost)
+	admin.Delete("/admin/users/:id", authHandler.DeleteUser)
+	admin.Post("/admin/users/:id/restore", authHandler.RestoreUser)
+	admin.Get("/admin/users/:id/sessions", authHandler.ListUserSessions)
+	admin.Get("/admin/users/:id/export", privacyHandler.ExportUserData)
+	admin.Get("/admin/stats/popular-bookmarks", bookHandler.GetPopularBookmarks)
+	admin.Get("/admin/reports/active-users", authHandler.GetActiveUsersReport)
+	admin.Get("/admin/reports/new-users", authHandler.GetNewUsersReport)
+	admin.Post("/admin/reports/schedule", suite.reports.ScheduleReport)
+	admin.Get("/admin/reports/scheduled", suite.reports.ListScheduledReports)
+	admin.Delete("/admin/reports/scheduled/:id", suite.reports.DeleteScheduledReport)
+	admin.Get("/admin/stats", suite.reports.GetStats)
+	admin.Get("/admin/analytics/countries", suite.geo.GetCountryStats)
+	admin.Get("/admin/searches/popular", bookHandler.GetPopularSearches)
+	admin.Get("/admin/activity/feed", activityHandler.GetActivityFeed)
+	admin.Post("/series", bookHandler.CreateSeries)
+	admin.Post("/series/:id/books", bookHandler.AddSeriesBooks)
+	admin.Post("/admin/books/sync", bookHandler.SyncBooks)
+	admin.Post("/admin/books/reindex", bookHandler.StartReindex)
+	admin.Get("/admin/books/reindex/status", bookHandler.GetReindexStatus)
+	admin.Delete("/admin/books/reindex", bookHandler.CancelReindex)
+	admin.Put("/books/:id/status", bookHandler.SetBookStatus)
+	admin.Get("/admin/cache/integrity", bookHandler.CheckCacheIntegrity)
+	admin.Post("/admin/cache/integrity/fix", bookHandler.FixCacheIntegrity)
+	admin.Post("/authors", authorHandler.CreateAuthor)
+	admin.Put("/authors/:id", authorHandler.UpdateAuthor)
+	admin.Get("/admin/cors/origins", corsHandler.ListOrigins)
+	admin.Post("/admin/cors/origins", corsHandler.CreateOrigin)
+	admin.Delete("/admin/cors/origins/:id", corsHandler.DeleteOrigin)
+	admin.Get("/admin/webhooks", suite.webhooks.ListWebhooks)
+	admin.Post("/admin/webhooks", suite.webhooks.CreateWebhook)
+	admin.Get("/admin/webhooks/dlq", suite.webhooks.ListDeadLetters)
+	admin.Post("/admin/webhooks/dlq/:id/retry", suite.webhooks.RetryDeadLetter)
+	admin.Delete("/admin/webhooks/dlq/:id", suite.webhooks.DeleteDeadLetter)
+	admin.Get("/admin/webhooks/:id", suite.webhooks.GetWebhook)
+	admin.Put("/admin/webhooks/:id", suite.webhooks.UpdateWebhook)
+	admin.Delete("/admin/webhooks/:id", suite.webhooks.DeleteWebhook)
+	admin.Get("/admin/webhooks/:id/deliveries", suite.webhooks.GetDeliveries)
+	admin.Get("/admin/logger/level", logger.GetLevelHandler(suite.logger))
+	admin.Put("/admin/logger/level", logger.SetLevelHandler(suite.logger))
+	admin.Get("/admin/logger/config", logger.GetConfigHandler(suite.logger))
 }
 
 func (suite *BookAPITestSuite) setupTestUser() {
@@ -129,6 +306,37 @@ func (suite *BookAPITestSuite) setupTestUser() {
 		json.NewDecoder(resp.Body).Decode(&loginResp)
 		suite.token = loginResp["token"].(string)
 	}
+
+	// Create admin user directly in the database and log in
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("adminpass123"), bcrypt.DefaultCost)
+	suite.db.Create(&auth.User{
+		Username: "testadmin",
+		Password: string(hashedPassword),
+		Email:    "admin@example.com",
+		Role:     "admin",
+	})
+
+	suite.adminToken, _ = suite.login("testadmin", "adminpass123")
+}
+
+func (suite *BookAPITestSuite) login(username, password string) (string, int) {
+	loginBody, _ := json.Marshal(auth.LoginRequest{
+		Username: username,
+		Password: password,
+	})
+	req := httptest.NewRequest("POST", "/auth/login", bytes.NewReader(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req)
+	if err != nil {
+		return "", 0
+	}
+	defer resp.Body.Close()
+
+	var loginResp map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&loginResp)
+	token, _ := loginResp["token"].(string)
+	return token, resp.StatusCode
 }
 
 func (suite *BookAPITestSuite) TestGetBooks_Empty() {
@@ -186,6 +394,35 @@ func (suite *BookAPITestSuite) TestAddBook_Unauthorized() {
 	suite.Equal(401, resp.StatusCode)
 }
 
+func (suite *BookAPITestSuite) TestAddBook_ValidationErrors() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	bookBody, _ := json.Marshal(map[string]interface{}{
+		"author": "Test Author",
+		"year":   1200,
+		"isbn":   "not-an-isbn",
+	})
+	req := httptest.NewRequest("POST", "/books", bytes.NewReader(bookBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+
+	resp, err := suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(400, resp.StatusCode)
+
+	var body apierrors.ValidationErrorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	suite.Equal("VALIDATION_FAILED", body.Code)
+
+	failed := map[string]string{}
+	for _, fe := range body.ValidationErrors {
+		failed[fe.Field] = fe.Tag
+	}
+	suite.Equal(map[string]string{"title": "required", "year": "book_year", "isbn": "isbn"}, failed)
+}
+
 func (suite *BookAPITestSuite) TestGetBook_ById() {
 	// First create a book
 	testBook := suite.createTestBook()
@@ -221,10 +458,11 @@ func (suite *BookAPITestSuite) TestUpdateBook_Success() {
 
 	// Update it
 	updatedBook := book.Book{
-		Title:  "Updated Title",
-		Author: "Updated Author",
-		Year:   2024,
-		Genre:  "Non-Fiction",
+		Title:   "Updated Title",
+		Author:  "Updated Author",
+		Year:    2024,
+		Genre:   "Non-Fiction",
+		Version: testBook.Version,
 	}
 
 	bookBody, _ := json.Marshal(updatedBook)
@@ -290,6 +528,54 @@ func (suite *BookAPITestSuite) TestSearchBooks() {
 	suite.Equal("Go Programming", results[0].Title)
 }
 
+func (suite *BookAPITestSuite) TestGetBooks_OData() {
+	books := []book.Book{
+		{Title: "Go Programming", Author: "John Doe", Year: 2020, Genre: "Fiction"},
+		{Title: "Ancient History", Author: "Jane Smith", Year: 1995, Genre: "Fiction"},
+		{Title: "Python Basics", Author: "John Doe", Year: 2022, Genre: "Technology"},
+		{Title: "Rust in Action", Author: "Tim McNamara", Year: 2021, Genre: "Fiction"},
+	}
+
+	for _, b := range books {
+		suite.createBookInDB(b)
+	}
+
+	req := httptest.NewRequest("GET", "/books?$filter="+url.QueryEscape("year ge 2000 and genre eq 'Fiction'")+"&$orderby="+url.QueryEscape("title desc")+"&$top=10&$skip=0", nil)
+	resp, err := suite.app.Test(req)
+
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	var results []book.Book
+	json.NewDecoder(resp.Body).Decode(&results)
+	suite.Len(results, 2)
+	suite.Equal("Rust in Action", results[0].Title)
+	suite.Equal("Go Programming", results[1].Title)
+
+	req = httptest.NewRequest("GET", "/books?$orderby=year&$top=1&$skip=1", nil)
+	resp, err = suite.app.Test(req)
+
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	results = nil
+	json.NewDecoder(resp.Body).Decode(&results)
+	suite.Len(results, 1)
+	suite.Equal("Go Programming", results[0].Title)
+}
+
+func (suite *BookAPITestSuite) TestGetBooks_ODataUnsupportedOperator() {
+	req := httptest.NewRequest("GET", "/books?$filter="+url.QueryEscape("title has 'Go'"), nil)
+	resp, err := suite.app.Test(req)
+
+	suite.NoError(err)
+	suite.Equal(400, resp.StatusCode)
+
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	suite.Contains(body["error"], "unsupported operator")
+}
+
 func (suite *BookAPITestSuite) TestCacheIntegration() {
 	if suite.cache == nil {
 		suite.T().Skip("Cache not available")
@@ -344,68 +630,3191 @@ func (suite *BookAPITestSuite) TestInvalidBookID() {
 	suite.Equal(400, resp.StatusCode)
 }
 
-// Helper methods
-func (suite *BookAPITestSuite) createTestBook() book.Book {
-		if suite.token == "" {
-		// Create directly in database if no token
-		return suite.createBookInDB(book.Book{
-			Title:  "Test Book",
-			Author: "Test Author",
-			Year:   2023,
-			Genre:  "Fiction",
-		})
+func (suite *BookAPITestSuite) TestUserDeleteRestoreCycle() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
 	}
 
-	newBook := book.Book{
-		Title:  "Test Book",
-		Author: "Test Author",
-		Year:   2023,
-		Genre:  "Fiction",
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("restoreme123"), bcrypt.DefaultCost)
+	user := auth.User{
+		Username: "restoreuser",
+		Password: string(hashedPassword),
+		Email:    "restore@example.com",
+		Role:     "user",
 	}
+	suite.Require().NoError(suite.db.Create(&user).Error)
+	defer suite.db.Unscoped().Delete(&auth.User{}, user.ID)
 
-	bookBody, _ := json.Marshal(newBook)
-	req := httptest.NewRequest("POST", "/books", bytes.NewReader(bookBody))
+	// Delete the user
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/admin/users/%d", user.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	resp, err := suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(204, resp.StatusCode)
+
+	// Deleted users can't log in
+	_, status := suite.login("restoreuser", "restoreme123")
+	suite.Equal(401, status)
+
+	// The user shows up in the deleted list
+	req = httptest.NewRequest("GET", "/admin/users/deleted?page=1&limit=20", nil)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	resp, err = suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	var listResp struct {
+		Users []auth.DeletedUserResponse `json:"users"`
+		Total int64                      `json:"total"`
+	}
+	json.NewDecoder(resp.Body).Decode(&listResp)
+	suite.GreaterOrEqual(listResp.Total, int64(1))
+	found := false
+	for _, u := range listResp.Users {
+		if u.ID == user.ID {
+			found = true
+			suite.False(u.DeletedAt.IsZero())
+		}
+	}
+	suite.True(found, "deleted user should be listed")
+
+	// Restore the user
+	req = httptest.NewRequest("POST", fmt.Sprintf("/admin/users/%d/restore", user.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	resp, err = suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	// Restored users can log in again
+	_, status = suite.login("restoreuser", "restoreme123")
+	suite.Equal(200, status)
+
+	// Restoring an active user is a 404
+	req = httptest.NewRequest("POST", fmt.Sprintf("/admin/users/%d/restore", user.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	resp, err = suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(404, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestRestoreUser_RequiresAdmin() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	req := httptest.NewRequest("POST", "/admin/users/1/restore", nil)
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(403, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestWithTransaction_RollsBackOnError() {
+	injected := errors.New("injected failure")
+
+	err := db.WithTransaction(context.Background(), suite.db, func(tx *gorm.DB) error {
+		first := book.Book{Title: "Tx Book One", Author: "Tx Author", Year: 2020, ISBN: "tx-isbn-1"}
+		if err := book.CreateBookTx(context.Background(), tx, &first); err != nil {
+			return err
+		}
+
+		second := book.Book{Title: "Tx Book Two", Author: "Tx Author", Year: 2021, ISBN: "tx-isbn-2"}
+		if err := book.CreateBookTx(context.Background(), tx, &second); err != nil {
+			return err
+		}
+
+		// Fail after both writes have been issued
+		return injected
+	})
+	suite.ErrorIs(err, injected)
+
+	var count int64
+	suite.db.Model(&book.Book{}).Where("author = ?", "Tx Author").Count(&count)
+	suite.Equal(int64(0), count, "no partial data should be committed")
+}
+
+func (suite *BookAPITestSuite) TestWithTransaction_Commits() {
+	err := db.WithTransaction(context.Background(), suite.db, func(tx *gorm.DB) error {
+		created := book.Book{Title: "Committed Book", Author: "Tx Author", Year: 2020}
+		if err := book.CreateBookTx(context.Background(), tx, &created); err != nil {
+			return err
+		}
+
+		_, err := book.UpdateBookTx(context.Background(), tx, created.ID, &book.Book{Genre: "Fiction"})
+		return err
+	})
+	suite.NoError(err)
+
+	var stored book.Book
+	suite.NoError(suite.db.Where("title = ?", "Committed Book").First(&stored).Error)
+	suite.Equal("Fiction", stored.Genre)
+}
+
+func (suite *BookAPITestSuite) TestStore_CancelledContext() {
+	suite.createBookInDB(book.Book{Title: "Cancelled Book", Author: "Ctx Author", Year: 2020})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := suite.books.GetAllBooks(ctx)
+	suite.ErrorIs(err, context.Canceled)
+
+	_, err = suite.books.GetBookByID(ctx, 1)
+	suite.ErrorIs(err, context.Canceled)
+
+	_, _, err = suite.users.ListDeletedUsers(ctx, 1, 20)
+	suite.ErrorIs(err, context.Canceled)
+}
+
+func (suite *BookAPITestSuite) TestStore_ContextCancelledMidQuery() {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// pg_sleep keeps the query running long enough for the deadline to hit
+	start := time.Now()
+	err := suite.db.WithContext(ctx).Exec("SELECT pg_sleep(5)").Error
+	suite.Error(err)
+	suite.ErrorIs(ctx.Err(), context.DeadlineExceeded)
+	suite.Less(time.Since(start), 5*time.Second, "query should be cancelled before it completes")
+}
+
+func (suite *BookAPITestSuite) TestCancelOnClientClose_InterruptsQuery() {
+	result := make(chan error, 1)
+	app := fiber.New()
+	app.Use(middleware.CancelOnClientClose())
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := suite.db.WithContext(c.UserContext()).Exec("SELECT pg_sleep(5)").Error
+		if time.Since(start) >= 5*time.Second {
+			err = nil
+		}
+		result <- err
+		return err
+	})
+
+	conn, err := net.Dial("tcp", listen(suite.T(), app))
+	suite.Require().NoError(err)
+	fmt.Fprint(conn, "GET /slow HTTP/1.1\r\nHost: test\r\n\r\n")
+	// Give the query time to start before hanging up
+	time.Sleep(200 * time.Millisecond)
+	suite.Require().NoError(conn.Close())
+
+	select {
+	case err := <-result:
+		suite.Error(err, "the query should be interrupted before pg_sleep ends")
+	case <-time.After(4 * time.Second):
+		suite.Fail("the query wasn't interrupted")
+	}
+}
+
+func (suite *BookAPITestSuite) adminRequest(method, target string, body interface{}) *http.Response {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	return resp
+}
+
+func (suite *BookAPITestSuite) TestSeries_CreateAssignAndOrder() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	resp := suite.adminRequest("POST", "/series", book.Series{Name: "Dune Chronicles", Description: "Arrakis"})
+	suite.Equal(201, resp.StatusCode)
+	var series book.Series
+	json.NewDecoder(resp.Body).Decode(&series)
+	suite.NotZero(series.ID)
+
+	messiah := suite.createBookInDB(book.Book{Title: "Dune Messiah", Author: "Frank Herbert", Year: 1969})
+	dune := suite.createBookInDB(book.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965})
+	children := suite.createBookInDB(book.Book{Title: "Children of Dune", Author: "Frank Herbert", Year: 1976})
+	suite.createBookInDB(book.Book{Title: "Unrelated", Author: "Someone Else", Year: 2000})
+
+	resp = suite.adminRequest("POST", fmt.Sprintf("/series/%d/books", series.ID), []book.SeriesBookRequest{
+		{BookID: messiah.ID, Sequence: 2},
+		{BookID: dune.ID, Sequence: 1},
+		{BookID: children.ID, Sequence: 3},
+	})
+	suite.Equal(200, resp.StatusCode)
+
+	// Books come back in sequence order
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/series/%d/books", series.ID), nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+	var books []book.Book
+	json.NewDecoder(resp.Body).Decode(&books)
+	suite.Require().Len(books, 3)
+	suite.Equal("Dune", books[0].Title)
+	suite.Equal("Dune Messiah", books[1].Title)
+	suite.Equal("Children of Dune", books[2].Title)
+	suite.Require().NotNil(books[1].Series)
+	suite.Equal(series.ID, books[1].Series.ID)
+	suite.Equal("Dune Chronicles", books[1].Series.Name)
+	suite.Equal(2, books[1].Series.SequenceNumber)
+
+	// The series_id filter on /books returns the same books
+	resp, err = suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/books?series_id=%d", series.ID), nil))
+	suite.NoError(err)
+	books = nil
+	json.NewDecoder(resp.Body).Decode(&books)
+	suite.Len(books, 3)
+
+	// Single book responses include the series
+	resp, err = suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/books/%d", children.ID), nil))
+	suite.NoError(err)
+	var single book.Book
+	json.NewDecoder(resp.Body).Decode(&single)
+	suite.Require().NotNil(single.Series)
+	suite.Equal(3, single.Series.SequenceNumber)
+
+	// Sequence numbers start at 1
+	resp = suite.adminRequest("POST", fmt.Sprintf("/series/%d/books", series.ID), []book.SeriesBookRequest{
+		{BookID: children.ID, Sequence: 0},
+	})
+	suite.Equal(400, resp.StatusCode)
+
+	// Reordering invalidates the cached list
+	resp = suite.adminRequest("POST", fmt.Sprintf("/series/%d/books", series.ID), []book.SeriesBookRequest{
+		{BookID: dune.ID, Sequence: 4},
+	})
+	suite.Equal(200, resp.StatusCode)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/series/%d/books", series.ID), nil))
+	suite.NoError(err)
+	books = nil
+	json.NewDecoder(resp.Body).Decode(&books)
+	suite.Require().Len(books, 3)
+	suite.Equal("Dune", books[2].Title)
+}
+
+func (suite *BookAPITestSuite) TestSeries_Errors() {
+	if suite.adminToken == "" || suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	resp := suite.adminRequest("POST", "/series", book.Series{})
+	suite.Equal(400, resp.StatusCode)
+
+	resp = suite.adminRequest("POST", "/series/99999/books", []book.SeriesBookRequest{{BookID: 1, Sequence: 1}})
+	suite.Equal(404, resp.StatusCode)
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/series/99999/books", nil))
+	suite.NoError(err)
+	suite.Equal(404, resp.StatusCode)
+
+	// Regular users can't create series
+	req := httptest.NewRequest("POST", "/series", bytes.NewReader([]byte(`{"name":"Nope"}`)))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err = suite.app.Test(req)
+	suite.NoError(err)
+	suite.Equal(403, resp.StatusCode)
+}
 
-	resp, _ := suite.app.Test(req)
-	defer resp.Body.Close()
+func (suite *BookAPITestSuite) TestAuthors_LinkedFromBooks() {
+	animalFarm := suite.createBookInDB(book.Book{Title: "Animal Farm", Author: "George Orwell", Year: 1945})
+	suite.createBookInDB(book.Book{Title: "1984", Author: "George Orwell", Year: 1949})
+	suite.createBookInDB(book.Book{Title: "Brave New World", Author: "Aldous Huxley", Year: 1932})
 
-	var createdBook book.Book
-	json.NewDecoder(resp.Body).Decode(&createdBook)
-	return createdBook
+	// Both Orwell books share one author record
+	suite.Require().NotNil(animalFarm.AuthorID)
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/authors?search=orwell&page=1&limit=20", nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+	var list struct {
+		Authors []author.Author `json:"authors"`
+		Total   int64           `json:"total"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	suite.Require().Len(list.Authors, 1)
+	suite.Equal(int64(1), list.Total)
+	suite.Equal(*animalFarm.AuthorID, list.Authors[0].ID)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/authors/%d/books", *animalFarm.AuthorID), nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+	var books []book.Book
+	json.NewDecoder(resp.Body).Decode(&books)
+	suite.Require().Len(books, 2)
+	suite.Equal("Animal Farm", books[0].Title)
+	suite.Equal("1984", books[1].Title)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/authors/99999", nil))
+	suite.NoError(err)
+	suite.Equal(404, resp.StatusCode)
 }
 
-func (suite *BookAPITestSuite) createBookInDB(b book.Book) book.Book {
-	db.DB.Create(&b)
-	return b
+func (suite *BookAPITestSuite) TestAuthors_AdminCreateAndUpdate() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	birthYear := 1903
+	resp := suite.adminRequest("POST", "/authors", author.Author{Name: "Eric Blair", BirthYear: &birthYear, Country: "UK"})
+	suite.Equal(201, resp.StatusCode)
+	var created author.Author
+	json.NewDecoder(resp.Body).Decode(&created)
+	suite.NotZero(created.ID)
+
+	resp = suite.adminRequest("POST", "/authors", author.Author{Name: "Eric Blair"})
+	suite.Equal(409, resp.StatusCode)
+
+	// Prime the cache, then make sure the update is visible
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/authors/%d", created.ID), nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	resp = suite.adminRequest("PUT", fmt.Sprintf("/authors/%d", created.ID), author.Author{Bio: "Wrote as George Orwell"})
+	suite.Equal(200, resp.StatusCode)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/authors/%d", created.ID), nil))
+	suite.NoError(err)
+	var fetched author.Author
+	json.NewDecoder(resp.Body).Decode(&fetched)
+	suite.Equal("Wrote as George Orwell", fetched.Bio)
+	suite.Equal("Eric Blair", fetched.Name)
+	suite.Require().NotNil(fetched.BirthYear)
+	suite.Equal(1903, *fetched.BirthYear)
 }
 
-// Benchmark tests
-func BenchmarkGetBooks(b *testing.B) {
-	// Setup
-	suite := new(BookAPITestSuite)
-	suite.SetupSuite()
-	defer suite.TearDownSuite()
+func (suite *BookAPITestSuite) TestSearchBooks_MatchesAuthorRecord() {
+	b := suite.createBookInDB(book.Book{Title: "Homage to Catalonia", Author: "George Orwell", Year: 1938})
+	suite.Require().NotNil(b.AuthorID)
 
-	// Create some test data
-	for i := 0; i < 100; i++ {
-		suite.createBookInDB(book.Book{
-			Title:  fmt.Sprintf("Book %d", i),
-			Author: fmt.Sprintf("Author %d", i),
-			Year:   2020 + (i % 5),
-		})
+	// Rename the author record only; search should still find the book by it
+	suite.Require().NoError(suite.db.Model(&author.Author{}).Where("id = ?", *b.AuthorID).Update("name", "Eric Arthur Blair").Error)
+
+	books, err := suite.books.SearchBooks(context.Background(), "Arthur Blair")
+	suite.NoError(err)
+	suite.Require().Len(books, 1)
+	suite.Equal("Homage to Catalonia", books[0].Title)
+}
+
+func (suite *BookAPITestSuite) TestMigration_PopulateAuthors() {
+	// Simulate rows written before authors existed
+	suite.Require().NoError(suite.db.Exec(`INSERT INTO books (title, author, year, created_at, updated_at)
+		VALUES ('Old Book', ' Legacy Writer ', 1900, NOW(), NOW()), ('Older Book', 'Legacy Writer', 1890, NOW(), NOW())`).Error)
+
+	for _, m := range migrations.All() {
+		if m.ID == "003_populate_authors" {
+			suite.Require().NoError(m.Up(suite.db))
+		}
 	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		req := httptest.NewRequest("GET", "/books", nil)
-		resp, _ := suite.app.Test(req)
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
+	var authors []author.Author
+	suite.db.Where("name = ?", "Legacy Writer").Find(&authors)
+	suite.Require().Len(authors, 1)
+
+	var linked int64
+	suite.db.Model(&book.Book{}).Where("author_id = ?", authors[0].ID).Count(&linked)
+	suite.Equal(int64(2), linked)
+}
+
+func (suite *BookAPITestSuite) TestBookViews_CountAndFlush() {
+	if err := suite.cache.Ping(); err != nil {
+		suite.T().Skip("Redis not available")
+	}
+
+	viewed := suite.createBookInDB(book.Book{Title: "Popular Book", Author: "View Author", Year: 2020})
+	quiet := suite.createBookInDB(book.Book{Title: "Quiet Book", Author: "View Author", Year: 2020})
+
+	var detail book.BookDetail
+	for i := 0; i < 3; i++ {
+		resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/books/%d", viewed.ID), nil))
+		suite.NoError(err)
+		suite.Equal(200, resp.StatusCode)
+		json.NewDecoder(resp.Body).Decode(&detail)
 	}
+	suite.Equal(int64(3), detail.Views)
+	// Every test request comes from the same IP
+	suite.Equal(int64(1), detail.UniqueVisitors)
+
+	updated, err := suite.bookHandler.FlushViewCounts(context.Background())
+	suite.NoError(err)
+	suite.Equal(1, updated)
+
+	var stored book.Book
+	suite.db.First(&stored, viewed.ID)
+	suite.Equal(int64(3), stored.ViewCount)
+
+	// The flushed count plus the new view
+	resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/books/%d", viewed.ID), nil))
+	suite.NoError(err)
+	json.NewDecoder(resp.Body).Decode(&detail)
+	suite.Equal(int64(4), detail.Views)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/books?sort=views&dir=desc", nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+	var books []book.Book
+	json.NewDecoder(resp.Body).Decode(&books)
+	suite.Require().Len(books, 2)
+	suite.Equal(viewed.ID, books[0].ID)
+	suite.Equal(quiet.ID, books[1].ID)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/books?sort=password", nil))
+	suite.NoError(err)
+	suite.Equal(400, resp.StatusCode)
 }
 
-func TestBookAPITestSuite(t *testing.T) {
-	suite.Run(t, new(BookAPITestSuite))
+func (suite *BookAPITestSuite) TestBooks_Trending() {
+	if err := suite.cache.Ping(); err != nil {
+		suite.T().Skip("Redis not available")
+	}
+
+	rising := suite.createBookInDB(book.Book{Title: "Rising Book", Author: "Trend Author", Year: 2021})
+	steady := suite.createBookInDB(book.Book{Title: "Steady Book", Author: "Trend Author", Year: 2021})
+
+	// Views of the previous hour, then this hour's through GET /books/:id
+	now := time.Now()
+	previous := book.HourlyViewsKey(now.Add(-time.Hour))
+	suite.cache.ZIncrBy(previous, 2, strconv.FormatUint(uint64(rising.ID), 10))
+	suite.cache.ZIncrBy(previous, 10, strconv.FormatUint(uint64(steady.ID), 10))
+	for views, b := range map[int]book.Book{20: rising, 12: steady} {
+		for i := 0; i < views; i++ {
+			resp, err := suite.app.Test(httptest.NewRequest("GET", fmt.Sprintf("/books/%d", b.ID), nil))
+			suite.NoError(err)
+			suite.Equal(200, resp.StatusCode)
+		}
+	}
+
+	count, err := suite.analytics.UpdateTrending(now)
+	suite.NoError(err)
+	suite.Equal(1, count)
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/books/trending?limit=10", nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+	var trending []analytics.TrendingBook
+	json.NewDecoder(resp.Body).Decode(&trending)
+	suite.Require().Len(trending, 1)
+	suite.Equal(rising.ID, trending[0].ID)
+	suite.Equal(9.0, trending[0].Velocity)
+}
+
+func (suite *BookAPITestSuite) authRequest(method, target, token string) *http.Response {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	return resp
+}
+
+func (suite *BookAPITestSuite) TestBookmarks_AddListRemove() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	first := suite.createBookInDB(book.Book{Title: "First Saved", Author: "Bookmark Author", Year: 2001})
+	second := suite.createBookInDB(book.Book{Title: "Second Saved", Author: "Bookmark Author", Year: 2002})
+
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", first.ID), suite.token)
+	suite.Equal(201, resp.StatusCode)
+	resp = suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", second.ID), suite.token)
+	suite.Equal(201, resp.StatusCode)
+	// Bookmarking again is idempotent
+	resp = suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", first.ID), suite.token)
+	suite.Equal(201, resp.StatusCode)
+
+	resp = suite.authRequest("POST", "/books/99999/bookmark", suite.token)
+	suite.Equal(404, resp.StatusCode)
+
+	resp = suite.authRequest("GET", "/me/bookmarks?page=1&limit=20", suite.token)
+	suite.Equal(200, resp.StatusCode)
+	var list struct {
+		Books []book.Book `json:"books"`
+		Total int64       `json:"total"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	suite.Equal(int64(2), list.Total)
+	suite.Require().Len(list.Books, 2)
+	suite.Equal("Bookmark Author", list.Books[0].Author)
+
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/books/%d/bookmark", first.ID), suite.token)
+	suite.Equal(204, resp.StatusCode)
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/books/%d/bookmark", first.ID), suite.token)
+	suite.Equal(404, resp.StatusCode)
+
+	resp = suite.authRequest("GET", "/me/bookmarks", suite.token)
+	list.Books = nil
+	json.NewDecoder(resp.Body).Decode(&list)
+	suite.Require().Len(list.Books, 1)
+	suite.Equal(second.ID, list.Books[0].ID)
+
+	resp = suite.authRequest("GET", "/me/bookmarks", "")
+	suite.Equal(401, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestBookmarks_BookmarkedField() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	b := suite.createBookInDB(book.Book{Title: "Maybe Saved", Author: "Bookmark Author", Year: 2003})
+
+	var detail map[string]interface{}
+	resp := suite.authRequest("GET", fmt.Sprintf("/books/%d", b.ID), "")
+	json.NewDecoder(resp.Body).Decode(&detail)
+	suite.NotContains(detail, "bookmarked", "anonymous requests don't get the field")
+
+	resp = suite.authRequest("GET", fmt.Sprintf("/books/%d", b.ID), suite.token)
+	detail = nil
+	json.NewDecoder(resp.Body).Decode(&detail)
+	suite.Equal(false, detail["bookmarked"])
+
+	suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token)
+	resp = suite.authRequest("GET", fmt.Sprintf("/books/%d", b.ID), suite.token)
+	detail = nil
+	json.NewDecoder(resp.Body).Decode(&detail)
+	suite.Equal(true, detail["bookmarked"])
+
+	suite.authRequest("DELETE", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token)
+	resp = suite.authRequest("GET", fmt.Sprintf("/books/%d", b.ID), suite.token)
+	detail = nil
+	json.NewDecoder(resp.Body).Decode(&detail)
+	suite.Equal(false, detail["bookmarked"])
+}
+
+func (suite *BookAPITestSuite) TestBookmarks_PopularStats() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	popular := suite.createBookInDB(book.Book{Title: "Everyone Saves This", Author: "Bookmark Author", Year: 2004})
+	niche := suite.createBookInDB(book.Book{Title: "Only One Fan", Author: "Bookmark Author", Year: 2005})
+
+	suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", popular.ID), suite.token)
+	suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", popular.ID), suite.adminToken)
+	suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", niche.ID), suite.token)
+
+	resp := suite.authRequest("GET", "/admin/stats/popular-bookmarks", suite.adminToken)
+	suite.Equal(200, resp.StatusCode)
+	var stats []book.PopularBook
+	json.NewDecoder(resp.Body).Decode(&stats)
+	suite.Require().Len(stats, 2)
+	suite.Equal(popular.ID, stats[0].ID)
+	suite.Equal(int64(2), stats[0].BookmarkCount)
+	suite.Equal(int64(1), stats[1].BookmarkCount)
+
+	resp = suite.authRequest("GET", "/admin/stats/popular-bookmarks", suite.token)
+	suite.Equal(403, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) activeUsersReport() auth.ActiveUsersReport {
+	suite.cache.Delete("reports:active_users")
+	resp := suite.authRequest("GET", "/admin/reports/active-users", suite.adminToken)
+	suite.Require().Equal(200, resp.StatusCode)
+	var report auth.ActiveUsersReport
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&report))
+	return report
+}
+
+func (suite *BookAPITestSuite) TestReports_ActiveAndNewUsers() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	before := suite.activeUsersReport()
+
+	now := time.Now()
+	hoursAgo, daysAgo, weeksAgo, monthsAgo := now.Add(-2*time.Hour), now.AddDate(0, 0, -3), now.AddDate(0, 0, -20), now.AddDate(0, 0, -60)
+	var seeded []uint
+	for i, lastLogin := range []*time.Time{&hoursAgo, &daysAgo, &weeksAgo, &monthsAgo, nil} {
+		user := auth.User{Username: fmt.Sprintf("report_user_%d", i), Password: "x", Email: fmt.Sprintf("report_user_%d@example.com", i), LastLoginAt: lastLogin}
+		suite.Require().NoError(suite.db.Create(&user).Error)
+		seeded = append(seeded, user.ID)
+	}
+	defer suite.db.Unscoped().Delete(&auth.User{}, seeded)
+	twoDaysAgo := now.UTC().AddDate(0, 0, -2)
+	suite.db.Model(&auth.User{}).Where("id = ?", seeded[0]).UpdateColumn("created_at", twoDaysAgo)
+
+	after := suite.activeUsersReport()
+	suite.Equal(before.Last24h+1, after.Last24h)
+	suite.Equal(before.Last7d+2, after.Last7d)
+	suite.Equal(before.Last30d+3, after.Last30d)
+	suite.Equal(before.TotalRegistered+5, after.TotalRegistered)
+
+	resp := suite.authRequest("GET", "/admin/reports/new-users?period=7d", suite.adminToken)
+	suite.Require().Equal(200, resp.StatusCode)
+	var series []auth.DailyCount
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&series))
+	suite.Require().Len(series, 7)
+	suite.Equal(now.UTC().Format("2006-01-02"), series[6].Date)
+	suite.GreaterOrEqual(series[6].Count, int64(4))
+	suite.Equal(twoDaysAgo.Format("2006-01-02"), series[4].Date)
+	suite.GreaterOrEqual(series[4].Count, int64(1))
+
+	resp = suite.authRequest("GET", "/admin/reports/new-users?period=week", suite.adminToken)
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.authRequest("GET", "/admin/reports/active-users", suite.token)
+	suite.Equal(403, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestSearchHistory_RecordListDelete() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	suite.createBookInDB(book.Book{Title: "Go in Practice", Author: "History Author", Year: 2016})
+
+	// Anonymous searches aren't recorded
+	suite.authRequest("GET", "/books?search=Go", "")
+
+	suite.authRequest("GET", "/books?search=Go", suite.token)
+	// Repeated within 5 minutes, so deduplicated
+	suite.authRequest("GET", "/books?search=go", suite.token)
+	suite.authRequest("GET", "/books?search=Cobol", suite.token)
+
+	resp := suite.authRequest("GET", "/me/search-history?limit=20", suite.token)
+	suite.Equal(200, resp.StatusCode)
+	var history []book.SearchHistory
+	json.NewDecoder(resp.Body).Decode(&history)
+	suite.Require().Len(history, 2)
+	suite.Equal("Cobol", history[0].Query)
+	suite.Equal(0, history[0].ResultCount)
+	suite.Equal("Go", history[1].Query)
+	suite.Equal(1, history[1].ResultCount)
+
+	// Other users can't delete someone else's entries
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/me/search-history/%d", history[0].ID), suite.adminToken)
+	suite.Equal(404, resp.StatusCode)
+
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/me/search-history/%d", history[0].ID), suite.token)
+	suite.Equal(204, resp.StatusCode)
+
+	resp = suite.authRequest("GET", "/me/search-history", suite.token)
+	history = nil
+	json.NewDecoder(resp.Body).Decode(&history)
+	suite.Require().Len(history, 1)
+
+	resp = suite.authRequest("DELETE", "/me/search-history", suite.token)
+	suite.Equal(204, resp.StatusCode)
+
+	resp = suite.authRequest("GET", "/me/search-history", suite.token)
+	history = nil
+	json.NewDecoder(resp.Body).Decode(&history)
+	suite.Len(history, 0)
+}
+
+func (suite *BookAPITestSuite) TestSearchHistory_PopularSearches() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	var users []auth.User
+	suite.db.Where("username IN ?", []string{"testuser", "testadmin"}).Find(&users)
+	suite.Require().Len(users, 2)
+
+	now := time.Now()
+	entries := []book.SearchHistory{
+		{UserID: users[0].ID, Query: "Dune", SearchedAt: now.Add(-time.Hour)},
+		{UserID: users[1].ID, Query: "dune", SearchedAt: now.Add(-2 * time.Hour)},
+		{UserID: users[0].ID, Query: "Orwell", SearchedAt: now.Add(-time.Hour)},
+		{UserID: users[0].ID, Query: "Ancient", SearchedAt: now.Add(-30 * 24 * time.Hour)},
+	}
+	for i := range entries {
+		suite.Require().NoError(suite.db.Create(&entries[i]).Error)
+	}
+
+	resp := suite.authRequest("GET", "/admin/searches/popular?period=7d", suite.adminToken)
+	suite.Equal(200, resp.StatusCode)
+	var body struct {
+		Searches []book.PopularSearch `json:"searches"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	suite.Require().Len(body.Searches, 2)
+	suite.Equal("dune", body.Searches[0].Query)
+	suite.Equal(int64(2), body.Searches[0].Searches)
+	suite.Equal(int64(2), body.Searches[0].Users)
+	suite.Equal("orwell", body.Searches[1].Query)
+
+	resp = suite.authRequest("GET", "/admin/searches/popular?period=week", suite.adminToken)
+	suite.Equal(400, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestGetBooks_Facets() {
+	books := []book.Book{
+		{Title: "Orwell Reader", Author: "George Orwell", Year: 1946, Genre: "Non-Fiction"},
+		{Title: "Animal Farm", Author: "George Orwell", Year: 1945, Genre: "Fiction"},
+		{Title: "Nineteen Eighty-Four", Author: "George Orwell", Year: 1949, Genre: "Fiction"},
+		{Title: "Burmese Days", Author: "George Orwell", Year: 1934, Genre: "Fiction"},
+		{Title: "Orwell: A Life", Author: "Bernard Crick", Year: 1980, Genre: "Biography"},
+		{Title: "Brave New World", Author: "Aldous Huxley", Year: 1932, Genre: "Fiction"},
+	}
+	for _, b := range books {
+		suite.createBookInDB(b)
+	}
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/books?search=orwell&facets=genre,decade", nil))
+	suite.NoError(err)
+	suite.Equal(200, resp.StatusCode)
+
+	var result book.FacetedBooks
+	json.NewDecoder(resp.Body).Decode(&result)
+	suite.Len(result.Books, 5)
+
+	counts := func(values []book.FacetValue) (map[string]int64, int64) {
+		byValue := map[string]int64{}
+		var sum int64
+		for _, v := range values {
+			byValue[v.Value] = v.Count
+			sum += v.Count
+		}
+		return byValue, sum
+	}
+
+	genres, genreTotal := counts(result.Facets["genre"])
+	suite.Equal(int64(len(result.Books)), genreTotal)
+	suite.Equal(int64(3), genres["Fiction"])
+	suite.Equal(int64(1), genres["Non-Fiction"])
+	suite.Equal(int64(1), genres["Biography"])
+	// Most common value first
+	suite.Equal("Fiction", result.Facets["genre"][0].Value)
+
+	decades, decadeTotal := counts(result.Facets["decade"])
+	suite.Equal(int64(len(result.Books)), decadeTotal)
+	suite.Equal(int64(3), decades["1940s"])
+	suite.Equal(int64(1), decades["1930s"])
+	suite.Equal(int64(1), decades["1980s"])
+
+	// Served from the facet cache, adding a book invalidates it
+	suite.createTestBook()
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/books?facets=genre", nil))
+	suite.NoError(err)
+	result = book.FacetedBooks{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	_, genreTotal = counts(result.Facets["genre"])
+	suite.Equal(int64(len(result.Books)), genreTotal)
+
+	resp, err = suite.app.Test(httptest.NewRequest("GET", "/books?facets=publisher", nil))
+	suite.NoError(err)
+	suite.Equal(400, resp.StatusCode)
+}
+
+// explain returns the EXPLAIN ANALYZE plan for query as a single string
+func (suite *BookAPITestSuite) explain(tx *gorm.DB, query string, args ...interface{}) string {
+	rows, err := tx.Raw("EXPLAIN ANALYZE "+query, args...).Rows()
+	suite.Require().NoError(err)
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var line string
+		suite.Require().NoError(rows.Scan(&line))
+		plan = append(plan, line)
+	}
+	return strings.Join(plan, "\n")
+}
+
+func (suite *BookAPITestSuite) TestMigration_GenreYearIndexUsed() {
+	for i := 0; i < 200; i++ {
+		genre := []string{"Fiction", "History", "Science", "Poetry"}[i%4]
+		suite.createBookInDB(book.Book{
+			Title:  fmt.Sprintf("Indexed Book %d", i),
+			Author: fmt.Sprintf("Author %d", i%50),
+			Year:   1900 + i%120,
+			Genre:  genre,
+		})
+	}
+
+	err := suite.db.Transaction(func(tx *gorm.DB) error {
+		tx.Exec("ANALYZE books")
+		// The table is tiny, so keep the planner from preferring a seq scan
+		tx.Exec("SET LOCAL enable_seqscan = off")
+
+		plan := suite.explain(tx, "SELECT * FROM books WHERE genre = ? AND year BETWEEN ? AND ? AND deleted_at IS NULL", "Fiction", 1950, 2000)
+		suite.Contains(plan, "idx_books_genre_year", plan)
+
+		plan = suite.explain(tx, "SELECT * FROM books WHERE author = ? AND deleted_at IS NULL", "Author 7")
+		suite.Contains(plan, "idx_books_author", plan)
+		return nil
+	})
+	suite.NoError(err)
+}
+
+// Helper methods
+func (suite *BookAPITestSuite) createTestBook() book.Book {
+		if suite.token == "" {
+		// Create directly in database if no token
+		return suite.createBookInDB(book.Book{
+			Title:  "Test Book",
+			Author: "Test Author",
+			Year:   2023,
+			Genre:  "Fiction",
+		})
+	}
+
+	newBook := book.Book{
+		Title:  "Test Book",
+		Author: "Test Author",
+		Year:   2023,
+		Genre:  "Fiction",
+	}
+
+	bookBody, _ := json.Marshal(newBook)
+	req := httptest.NewRequest("POST", "/books", bytes.NewReader(bookBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+
+	resp, _ := suite.app.Test(req)
+	defer resp.Body.Close()
+
+	var createdBook book.Book
+	json.NewDecoder(resp.Body).Decode(&createdBook)
+	return createdBook
+}
+
+func (suite *BookAPITestSuite) createBookInDB(b book.Book) book.Book {
+	suite.db.Create(&b)
+	return b
+}
+
+// createInactiveUser adds a user whose last login was daysAgo days ago and
+// returns it; the caller hard-deletes it
+func (suite *BookAPITestSuite) createInactiveUser(username string, daysAgo int) auth.User {
+	lastLogin := time.Now().AddDate(0, 0, -daysAgo)
+	user := auth.User{
+		Username:    username,
+		Password:    "unused",
+		Email:       username + "@example.com",
+		Role:        "user",
+		LastLoginAt: &lastLogin,
+	}
+	suite.Require().NoError(suite.db.Create(&user).Error)
+	// Backdate signup too, as the user can't predate their last login
+	suite.db.Model(&user).UpdateColumn("created_at", lastLogin)
+	return user
+}
+
+type cleanupResponse struct {
+	DryRun  bool                `json:"dry_run"`
+	Matched int                 `json:"matched"`
+	Deleted int64               `json:"deleted"`
+	Users   []auth.InactiveUser `json:"users"`
+}
+
+func (suite *BookAPITestSuite) cleanupUserIDs(result cleanupResponse) map[uint]bool {
+	ids := map[uint]bool{}
+	for _, u := range result.Users {
+		ids[u.ID] = true
+	}
+	return ids
+}
+
+func (suite *BookAPITestSuite) TestUserCleanup_DryRunDoesNotDelete() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	stale := suite.createInactiveUser("staleuser", 400)
+	defer suite.db.Unscoped().Delete(&auth.User{}, stale.ID)
+	recent := suite.createInactiveUser("recentuser", 30)
+	defer suite.db.Unscoped().Delete(&auth.User{}, recent.ID)
+
+	// dry_run defaults to true
+	resp := suite.adminRequest("POST", "/admin/users/cleanup", map[string]int{"inactive_days": 365})
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var result cleanupResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	suite.True(result.DryRun)
+	suite.Equal(int64(0), result.Deleted)
+	ids := suite.cleanupUserIDs(result)
+	suite.True(ids[stale.ID], "inactive user should be reported")
+	suite.False(ids[recent.ID], "recently active user should not be reported")
+	suite.Equal(len(result.Users), result.Matched)
+
+	// Admins are never selected, however long ago they logged in
+	var admin auth.User
+	suite.db.Where("username = ?", "testadmin").First(&admin)
+	suite.False(ids[admin.ID])
+
+	var count int64
+	suite.db.Model(&auth.User{}).Where("id = ?", stale.ID).Count(&count)
+	suite.Equal(int64(1), count, "dry run must not delete")
+}
+
+func (suite *BookAPITestSuite) TestUserCleanup_DeletesInactiveUsers() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	stale := suite.createInactiveUser("staleuser2", 400)
+	defer suite.db.Unscoped().Delete(&auth.User{}, stale.ID)
+	recent := suite.createInactiveUser("recentuser2", 30)
+	defer suite.db.Unscoped().Delete(&auth.User{}, recent.ID)
+
+	resp := suite.adminRequest("POST", "/admin/users/cleanup?dry_run=false", map[string]int{"inactive_days": 365})
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var result cleanupResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	suite.False(result.DryRun)
+	suite.GreaterOrEqual(result.Deleted, int64(1))
+	suite.True(suite.cleanupUserIDs(result)[stale.ID])
+
+	// Soft-deleted, so it can still be restored
+	var deleted auth.User
+	suite.NoError(suite.db.Unscoped().First(&deleted, stale.ID).Error)
+	suite.True(deleted.DeletedAt.Valid)
+
+	var count int64
+	suite.db.Model(&auth.User{}).Where("id = ?", recent.ID).Count(&count)
+	suite.Equal(int64(1), count, "recently active user must be kept")
+
+	// Bad input
+	resp = suite.adminRequest("POST", "/admin/users/cleanup", map[string]int{"inactive_days": 0})
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.adminRequest("POST", "/admin/users/cleanup?dry_run=maybe", map[string]int{"inactive_days": 365})
+	suite.Equal(400, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestUserCleanup_Schedule() {
+	if suite.adminToken == "" || suite.cache == nil {
+		suite.T().Skip("No admin token or Redis available")
+	}
+
+	resp := suite.adminRequest("GET", "/admin/users/cleanup/schedule", nil)
+	suite.Equal(404, resp.StatusCode)
+
+	resp = suite.adminRequest("POST", "/admin/users/cleanup/schedule", map[string]interface{}{
+		"enabled": true, "inactive_days": 365, "interval_hours": 24,
+	})
+	suite.Require().Equal(200, resp.StatusCode)
+
+	resp = suite.adminRequest("GET", "/admin/users/cleanup/schedule", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var schedule auth.CleanupSchedule
+	json.NewDecoder(resp.Body).Decode(&schedule)
+	suite.True(schedule.Enabled)
+	suite.Equal(365, schedule.InactiveDays)
+	suite.Require().NotNil(schedule.NextRunAt)
+	suite.WithinDuration(time.Now().Add(24*time.Hour), *schedule.NextRunAt, time.Minute)
+
+	// Not due yet, so nothing runs
+	result, err := suite.authHandler.RunScheduledCleanup(context.Background())
+	suite.NoError(err)
+	suite.Nil(result)
+}
+
+func (suite *BookAPITestSuite) TestUserExport_CSV() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	resp := suite.adminRequest("GET", "/admin/users/export", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Contains(resp.Header.Get("Content-Type"), "text/csv")
+	suite.Contains(resp.Header.Get("Content-Disposition"), "attachment")
+
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(rows)
+	suite.Equal([]string{"id", "username", "email", "role", "created_at", "last_login_at"}, rows[0])
+
+	usernames := map[string]bool{}
+	for _, row := range rows[1:] {
+		usernames[row[1]] = true
+	}
+	suite.True(usernames["testuser"])
+	suite.True(usernames["testadmin"])
+}
+
+func (suite *BookAPITestSuite) TestUserExport_XLSX() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	resp := suite.adminRequest("GET", "/admin/users/export?format=xlsx", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Contains(resp.Header.Get("Content-Type"), "spreadsheetml")
+	suite.Contains(resp.Header.Get("Content-Disposition"), ".xlsx")
+
+	f, err := excelize.OpenReader(resp.Body)
+	suite.Require().NoError(err)
+	defer f.Close()
+	rows, err := f.GetRows(f.GetSheetName(0))
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(rows)
+	suite.Equal([]string{"id", "username", "email", "role", "created_at", "last_login_at"}, rows[0])
+	for _, row := range rows {
+		suite.NotContains(row, "password")
+	}
+}
+
+func (suite *BookAPITestSuite) TestUserExport_RejectsUnknownFormat() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	resp := suite.adminRequest("GET", "/admin/users/export?format=pdf", nil)
+	suite.Equal(400, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestBookExport_Formats() {
+	if suite.adminToken == "" || suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	suite.Require().NoError(suite.db.Create(&book.Book{Title: "Export Me", Author: "Exporter", Year: 2020, ISBN: "9780306406157"}).Error)
+
+	resp := suite.adminRequest("GET", "/books/export?format=xlsx", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	f, err := excelize.OpenReader(resp.Body)
+	suite.Require().NoError(err)
+	defer f.Close()
+	rows, err := f.GetRows(f.GetSheetName(0))
+	suite.Require().NoError(err)
+	suite.Require().Len(rows, 2)
+	suite.Equal("id", rows[0][0])
+	suite.Contains(rows[1], "Export Me")
+
+	resp = suite.adminRequest("GET", "/books/export?format=json", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var books []book.Book
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&books))
+	suite.Require().Len(books, 1)
+	suite.Equal("Export Me", books[0].Title)
+
+	req := httptest.NewRequest("GET", "/books/export", nil)
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err = suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Equal(403, resp.StatusCode, "exports are admin only")
+}
+
+func (suite *BookAPITestSuite) TestWebhooks_DeliverBookEvents() {
+	if suite.adminToken == "" || suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	secret := "webhook-test-secret"
+	received := make(chan *http.Request, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		received <- r
+	}))
+	defer target.Close()
+
+	resp := suite.adminRequest("POST", "/admin/webhooks", webhook.WebhookRequest{
+		URL:    target.URL,
+		Secret: secret,
+		Events: []string{webhook.EventBookCreated},
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	var hook webhook.Webhook
+	json.NewDecoder(resp.Body).Decode(&hook)
+	suite.True(hook.Active)
+
+	// Unknown event types are rejected
+	resp = suite.adminRequest("POST", "/admin/webhooks", webhook.WebhookRequest{
+		URL: target.URL, Secret: secret, Events: []string{"book.read"},
+	})
+	suite.Equal(400, resp.StatusCode)
+
+	created := suite.createTestBook()
+
+	var delivery *http.Request
+	select {
+	case delivery = <-received:
+	case <-time.After(5 * time.Second):
+		suite.FailNow("webhook was not delivered")
+	}
+	body, _ := io.ReadAll(delivery.Body)
+	suite.Equal(webhook.Sign(secret, body), delivery.Header.Get("X-Signature"))
+	suite.Equal(webhook.EventBookCreated, delivery.Header.Get("X-Webhook-Event"))
+
+	var event struct {
+		Type string    `json:"type"`
+		Data book.Book `json:"data"`
+	}
+	suite.Require().NoError(json.Unmarshal(body, &event))
+	suite.Equal(webhook.EventBookCreated, event.Type)
+	suite.Equal(created.ID, event.Data.ID)
+
+	// The delivery is recorded just after the response arrives
+	var deliveries struct {
+		Deliveries []webhook.Delivery `json:"deliveries"`
+		Total      int64              `json:"total"`
+	}
+	suite.Eventually(func() bool {
+		resp := suite.adminRequest("GET", fmt.Sprintf("/admin/webhooks/%d/deliveries", hook.ID), nil)
+		json.NewDecoder(resp.Body).Decode(&deliveries)
+		return deliveries.Total == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	suite.Equal(200, deliveries.Deliveries[0].StatusCode)
+	suite.True(deliveries.Deliveries[0].Success)
+	suite.Equal(1, deliveries.Deliveries[0].Attempt)
+
+	resp = suite.adminRequest("DELETE", fmt.Sprintf("/admin/webhooks/%d", hook.ID), nil)
+	suite.Equal(204, resp.StatusCode)
+	resp = suite.adminRequest("GET", fmt.Sprintf("/admin/webhooks/%d/deliveries", hook.ID), nil)
+	suite.Equal(404, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestWebhooks_DeadLetterAndRetry() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+	// No retries, so the first failure is dead-lettered
+	defer func(backoff []time.Duration) { webhook.RetryBackoff = backoff }(webhook.RetryBackoff)
+	webhook.RetryBackoff = nil
+
+	var healthy atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	resp := suite.adminRequest("POST", "/admin/webhooks", webhook.WebhookRequest{
+		URL: target.URL, Secret: "webhook-test-secret", Events: []string{webhook.EventBookCreated},
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	var hook webhook.Webhook
+	json.NewDecoder(resp.Body).Decode(&hook)
+
+	created := suite.createTestBook()
+
+	var entries []webhook.DeadLetter
+	suite.Require().Eventually(func() bool {
+		resp := suite.adminRequest("GET", "/admin/webhooks/dlq?limit=20", nil)
+		json.NewDecoder(resp.Body).Decode(&entries)
+		return len(entries) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	entry := entries[0]
+	suite.Equal(hook.ID, entry.WebhookID)
+	suite.Equal(webhook.EventBookCreated, entry.Event)
+	suite.Equal(1, entry.AttemptCount)
+	suite.Contains(entry.LastError, "503")
+	suite.WithinDuration(entry.CreatedAt.Add(webhook.DLQRetention), entry.ExpiresAt, time.Second)
+	var event struct {
+		Data book.Book `json:"data"`
+	}
+	suite.Require().NoError(json.Unmarshal(entry.Payload, &event))
+	suite.Equal(created.ID, event.Data.ID)
+
+	// A failed retry keeps the entry with the new attempt count
+	resp = suite.adminRequest("POST", fmt.Sprintf("/admin/webhooks/dlq/%d/retry", entry.ID), nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var delivery webhook.Delivery
+	json.NewDecoder(resp.Body).Decode(&delivery)
+	suite.False(delivery.Success)
+	suite.Equal(2, delivery.Attempt)
+	resp = suite.adminRequest("GET", "/admin/webhooks/dlq", nil)
+	json.NewDecoder(resp.Body).Decode(&entries)
+	suite.Require().Len(entries, 1)
+	suite.Equal(2, entries[0].AttemptCount)
+
+	healthy.Store(true)
+	resp = suite.adminRequest("POST", fmt.Sprintf("/admin/webhooks/dlq/%d/retry", entry.ID), nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&delivery)
+	suite.True(delivery.Success)
+	suite.Equal(entry.EventID, delivery.EventID)
+	suite.Equal(3, delivery.Attempt)
+
+	resp = suite.adminRequest("GET", "/admin/webhooks/dlq", nil)
+	json.NewDecoder(resp.Body).Decode(&entries)
+	suite.Empty(entries)
+	resp = suite.adminRequest("POST", fmt.Sprintf("/admin/webhooks/dlq/%d/retry", entry.ID), nil)
+	suite.Equal(404, resp.StatusCode)
+	resp = suite.adminRequest("DELETE", fmt.Sprintf("/admin/webhooks/dlq/%d", entry.ID), nil)
+	suite.Equal(404, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestWebhooks_PurgeExpiredDeadLetters() {
+	expired := webhook.DeadLetter{WebhookID: 1, EventID: "evt-old", Event: webhook.EventBookDeleted, Payload: webhook.Payload(`{}`),
+		AttemptCount: 5, ExpiresAt: time.Now().Add(-time.Minute)}
+	current := webhook.DeadLetter{WebhookID: 1, EventID: "evt-new", Event: webhook.EventBookDeleted, Payload: webhook.Payload(`{}`),
+		AttemptCount: 5, ExpiresAt: time.Now().Add(webhook.DLQRetention)}
+	suite.Require().NoError(suite.db.Create(&expired).Error)
+	suite.Require().NoError(suite.db.Create(&current).Error)
+
+	purged, err := suite.webhooks.PurgeExpiredDeadLetters(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(int64(1), purged)
+	var entries []webhook.DeadLetter
+	suite.Require().NoError(suite.db.Find(&entries).Error)
+	suite.Require().Len(entries, 1)
+	suite.Equal("evt-new", entries[0].EventID)
+}
+
+func (suite *BookAPITestSuite) TestStreamBooks_ReceivesAllRows() {
+	const total = 2*book.StreamBatchSize + 37
+	books := make([]book.Book, total)
+	for i := range books {
+		books[i] = book.Book{Title: fmt.Sprintf("Streamed %03d", i), Author: "Stream Author", Year: 2000}
+	}
+	suite.Require().NoError(suite.db.CreateInBatches(&books, 100).Error)
+
+	resp, err := suite.app.Test(httptest.NewRequest("GET", "/books/stream", nil), -1)
+	suite.Require().NoError(err)
+	suite.Equal(200, resp.StatusCode)
+	suite.Equal(book.ContentTypeNDJSON, resp.Header.Get("Content-Type"))
+
+	seen := map[uint]bool{}
+	lastID := uint(0)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var b book.Book
+		suite.Require().NoError(json.Unmarshal(scanner.Bytes(), &b))
+		suite.Greater(b.ID, lastID, "books arrive in ID order")
+		lastID = b.ID
+		seen[b.ID] = true
+	}
+	suite.Require().NoError(scanner.Err())
+	suite.Len(seen, total)
+	for _, b := range books {
+		suite.True(seen[b.ID], "book %d was not streamed", b.ID)
+	}
+}
+
+func (suite *BookAPITestSuite) TestWebhooks_RequireAdmin() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	resp := suite.authRequest("GET", "/admin/webhooks", suite.token)
+	suite.Equal(403, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestCORSOrigins_AddAndRemove() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+
+	fromOrigin := func() string {
+		req := httptest.NewRequest("GET", "/books", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		resp, err := suite.app.Test(req)
+		suite.Require().NoError(err)
+		return resp.Header.Get("Access-Control-Allow-Origin")
+	}
+	suite.Empty(fromOrigin())
+
+	resp := suite.adminRequest("POST", "/admin/cors/origins", cors.OriginRequest{Origin: "https://App.example.com/"})
+	suite.Require().Equal(201, resp.StatusCode)
+	var origin cors.Origin
+	json.NewDecoder(resp.Body).Decode(&origin)
+	suite.Equal("https://app.example.com", origin.Origin)
+	suite.Equal("https://app.example.com", fromOrigin())
+
+	resp = suite.adminRequest("POST", "/admin/cors/origins", cors.OriginRequest{Origin: "https://app.example.com"})
+	suite.Equal(409, resp.StatusCode)
+	resp = suite.adminRequest("POST", "/admin/cors/origins", cors.OriginRequest{Origin: "https://app.example.com/login"})
+	suite.Equal(400, resp.StatusCode)
+
+	resp = suite.adminRequest("DELETE", fmt.Sprintf("/admin/cors/origins/%d", origin.ID), nil)
+	suite.Equal(204, resp.StatusCode)
+	suite.Empty(fromOrigin())
+}
+
+func (suite *BookAPITestSuite) TestLoggerLevel_AdminOnly() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+	defer suite.logger.SetLevel(logger.DEBUG)
+
+	resp := suite.authRequest("GET", "/admin/logger/level", suite.token)
+	suite.Equal(403, resp.StatusCode)
+
+	resp = suite.adminRequest("PUT", "/admin/logger/level", logger.LevelRequest{Level: "ERROR"})
+	suite.Equal(200, resp.StatusCode)
+	suite.Equal(logger.ERROR, suite.logger.Level())
+}
+
+// createUserWithActivity creates a user with a bookmark, a search and a
+// rating, removed after the test, and returns the user and a token for them;
+// the caller hard-deletes the user
+func (suite *BookAPITestSuite) createUserWithActivity(username string) (auth.User, string) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("forgetme123"), bcrypt.DefaultCost)
+	user := auth.User{
+		Username: username,
+		Password: string(hashedPassword),
+		Email:    username + "@example.com",
+		Role:     "user",
+	}
+	suite.Require().NoError(suite.db.Create(&user).Error)
+
+	b := suite.createBookInDB(book.Book{Title: "Bookmarked by " + username, Author: "Someone", Year: 2001})
+	suite.Require().NoError(suite.db.Create(&book.Bookmark{UserID: user.ID, BookID: b.ID}).Error)
+	suite.Require().NoError(suite.db.Create(&book.SearchHistory{UserID: user.ID, Query: "dune", SearchedAt: time.Now()}).Error)
+	suite.Require().NoError(suite.db.Create(&book.Rating{UserID: user.ID, BookID: b.ID, Score: 4}).Error)
+	suite.T().Cleanup(func() {
+		suite.db.Where("user_id = ?", user.ID).Delete(&book.Bookmark{})
+		suite.db.Where("user_id = ?", user.ID).Delete(&book.SearchHistory{})
+		suite.db.Unscoped().Where("user_id = ?", user.ID).Delete(&book.Rating{})
+	})
+
+	token, status := suite.login(username, "forgetme123")
+	suite.Require().Equal(200, status)
+	return user, token
+}
+
+// userActivityCount counts the user's bookmarks and their ratings that aren't
+// soft-deleted
+func (suite *BookAPITestSuite) userActivityCount(userID uint) (bookmarks, ratings int64) {
+	suite.db.Model(&book.Bookmark{}).Where("user_id = ?", userID).Count(&bookmarks)
+	suite.db.Model(&book.Rating{}).Where("user_id = ?", userID).Count(&ratings)
+	return bookmarks, ratings
+}
+
+func (suite *BookAPITestSuite) TestDeleteAccount_Anonymizes() {
+	auth.AnonymizeOnDelete = true
+	defer func() { auth.AnonymizeOnDelete = false }()
+
+	user, token := suite.createUserWithActivity("forgetme")
+	defer suite.db.Unscoped().Delete(&auth.User{}, user.ID)
+
+	resp := suite.authRequest("POST", "/me/delete-account", token)
+	suite.Equal(204, resp.StatusCode)
+
+	var deleted auth.User
+	suite.Require().NoError(suite.db.Unscoped().First(&deleted, user.ID).Error)
+	suite.True(deleted.DeletedAt.Valid)
+	suite.Equal(fmt.Sprintf("deleted_user_%d", user.ID), deleted.Username)
+	suite.Empty(deleted.Email)
+	suite.Empty(deleted.Password)
+
+	bookmarks, ratings := suite.userActivityCount(user.ID)
+	suite.Equal(int64(1), bookmarks)
+	suite.Zero(ratings)
+
+	_, status := suite.login("forgetme", "forgetme123")
+	suite.Equal(401, status)
+}
+
+func (suite *BookAPITestSuite) TestDeleteAccount_SoftDeleteOnly() {
+	user, token := suite.createUserWithActivity("keepme")
+	defer suite.db.Unscoped().Delete(&auth.User{}, user.ID)
+
+	resp := suite.authRequest("POST", "/me/delete-account", token)
+	suite.Equal(204, resp.StatusCode)
+
+	var deleted auth.User
+	suite.Require().NoError(suite.db.Unscoped().First(&deleted, user.ID).Error)
+	suite.True(deleted.DeletedAt.Valid)
+	suite.Equal("keepme", deleted.Username)
+	suite.Equal("keepme@example.com", deleted.Email)
+
+	// Ratings leave the aggregates with the user; nothing is erased
+	bookmarks, ratings := suite.userActivityCount(user.ID)
+	suite.Equal(int64(1), bookmarks)
+	suite.Zero(ratings)
+
+	// The token no longer authenticates anyone
+	resp = suite.authRequest("POST", "/me/delete-account", token)
+	suite.Equal(401, resp.StatusCode)
+
+	// Restoring the account brings the ratings back, but not the session
+	_, err := suite.users.RestoreUser(context.Background(), user.ID)
+	suite.Require().NoError(err)
+	_, ratings = suite.userActivityCount(user.ID)
+	suite.Equal(int64(1), ratings)
+	resp = suite.authRequest("POST", "/me/delete-account", token)
+	suite.Equal(401, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestAdminDeleteUser_AnonymizesInSameTransaction() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+	auth.AnonymizeOnDelete = true
+	defer func() { auth.AnonymizeOnDelete = false }()
+
+	user, _ := suite.createUserWithActivity("adminforgets")
+	defer suite.db.Unscoped().Delete(&auth.User{}, user.ID)
+
+	// A failing delete rolls back the erasure along with the soft delete
+	err := suite.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&auth.User{ID: user.ID}).Error; err != nil {
+			return err
+		}
+		return fmt.Errorf("abort")
+	})
+	suite.Error(err)
+	var kept auth.User
+	suite.Require().NoError(suite.db.First(&kept, user.ID).Error)
+	suite.Equal("adminforgets", kept.Username)
+	_, ratings := suite.userActivityCount(user.ID)
+	suite.Equal(int64(1), ratings)
+
+	resp := suite.adminRequest("DELETE", fmt.Sprintf("/admin/users/%d", user.ID), nil)
+	suite.Equal(204, resp.StatusCode)
+	_, ratings = suite.userActivityCount(user.ID)
+	suite.Zero(ratings)
+	var anonymized auth.User
+	suite.Require().NoError(suite.db.Unscoped().First(&anonymized, user.ID).Error)
+	suite.Equal(fmt.Sprintf("deleted_user_%d", user.ID), anonymized.Username)
+}
+
+// createUserWithCost stores a user whose password hash has the given bcrypt cost
+func (suite *BookAPITestSuite) createUserWithCost(username string, cost int) *auth.User {
+	hash, err := bcrypt.GenerateFromPassword([]byte(username+"pass"), cost)
+	suite.Require().NoError(err)
+	user := &auth.User{Username: username, Password: string(hash), Email: username + "@example.com"}
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *BookAPITestSuite) TestLogin_UpgradesWeakPasswordHash() {
+	previous := auth.BcryptCost
+	auth.BcryptCost = bcrypt.MinCost + 1
+	defer func() { auth.BcryptCost = previous }()
+
+	user := suite.createUserWithCost("weakhash", bcrypt.MinCost)
+	defer suite.db.Unscoped().Delete(&auth.User{}, user.ID)
+
+	_, status := suite.login("weakhash", "weakhashpass")
+	suite.Equal(200, status)
+
+	var stored auth.User
+	suite.Require().NoError(suite.db.First(&stored, user.ID).Error)
+	cost, err := bcrypt.Cost([]byte(stored.Password))
+	suite.Require().NoError(err)
+	suite.Equal(auth.BcryptCost, cost)
+	suite.Equal(auth.BcryptCost, stored.PasswordCost)
+	suite.False(stored.NeedsRehash)
+
+	_, status = suite.login("weakhash", "weakhashpass")
+	suite.Equal(200, status, "the upgraded hash still matches the password")
+}
+
+func (suite *BookAPITestSuite) TestUpgradePasswordCost_MarksWeakHashes() {
+	previous := auth.BcryptCost
+	auth.BcryptCost = bcrypt.MinCost + 1
+	defer func() { auth.BcryptCost = previous }()
+
+	weak := suite.createUserWithCost("markweak", bcrypt.MinCost)
+	defer suite.db.Unscoped().Delete(&auth.User{}, weak.ID)
+	strong := suite.createUserWithCost("markstrong", auth.BcryptCost)
+	defer suite.db.Unscoped().Delete(&auth.User{}, strong.ID)
+
+	resp := suite.adminRequest("POST", "/admin/users/upgrade-password-cost", nil)
+	suite.Equal(200, resp.StatusCode)
+	var result auth.PasswordCostResult
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	suite.Equal(auth.BcryptCost, result.Cost)
+	suite.GreaterOrEqual(result.Marked, int64(1))
+
+	var stored auth.User
+	suite.Require().NoError(suite.db.First(&stored, weak.ID).Error)
+	suite.True(stored.NeedsRehash)
+	suite.Equal(bcrypt.MinCost, stored.PasswordCost)
+
+	suite.Require().NoError(suite.db.First(&stored, strong.ID).Error)
+	suite.False(stored.NeedsRehash)
+	suite.Equal(auth.BcryptCost, stored.PasswordCost)
+
+	_, status := suite.login("markweak", "markweakpass")
+	suite.Equal(200, status)
+	suite.Require().NoError(suite.db.First(&stored, weak.ID).Error)
+	suite.False(stored.NeedsRehash)
+	suite.Equal(auth.BcryptCost, stored.PasswordCost)
+}
+
+// loginFrom logs in with the given User-Agent and returns the token
+func (suite *BookAPITestSuite) loginFrom(username, password, userAgent string) string {
+	body, _ := json.Marshal(auth.LoginRequest{Username: username, Password: password})
+	req := httptest.NewRequest("POST", "/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var loginResp map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&loginResp))
+	token, _ := loginResp["token"].(string)
+	return token
+}
+
+func (suite *BookAPITestSuite) listSessions(token string) []auth.Session {
+	resp := suite.authRequest("GET", "/me/sessions", token)
+	suite.Require().Equal(200, resp.StatusCode)
+	var sessions []auth.Session
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&sessions))
+	return sessions
+}
+
+func (suite *BookAPITestSuite) TestSessions_Lifecycle() {
+	user := suite.createUserWithCost("sessionuser", bcrypt.MinCost)
+	defer suite.db.Unscoped().Delete(&auth.User{}, user.ID)
+	defer suite.db.Where("user_id = ?", user.ID).Delete(&auth.Session{})
+
+	laptop := suite.loginFrom("sessionuser", "sessionuserpass", "laptop")
+	phone := suite.loginFrom("sessionuser", "sessionuserpass", "phone")
+	tablet := suite.loginFrom("sessionuser", "sessionuserpass", "tablet")
+
+	sessions := suite.listSessions(laptop)
+	suite.Require().Len(sessions, 3)
+	byAgent := map[string]auth.Session{}
+	for _, session := range sessions {
+		byAgent[session.UserAgent] = session
+		suite.NotEmpty(session.IP)
+		suite.True(session.ExpiresAt.After(time.Now()))
+	}
+	suite.True(byAgent["laptop"].Current)
+	suite.False(byAgent["phone"].Current)
+
+	// Revoke one session; its token stops working right away
+	resp := suite.authRequest("DELETE", "/me/sessions/"+byAgent["phone"].ID, laptop)
+	suite.Equal(204, resp.StatusCode)
+	suite.Equal(401, suite.authRequest("GET", "/me/sessions", phone).StatusCode)
+	suite.Len(suite.listSessions(laptop), 2)
+
+	resp = suite.authRequest("DELETE", "/me/sessions/"+byAgent["phone"].ID, laptop)
+	suite.Equal(404, resp.StatusCode, "already revoked")
+
+	// Admins see the user's sessions
+	resp = suite.adminRequest("GET", fmt.Sprintf("/admin/users/%d/sessions", user.ID), nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var adminView []auth.Session
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&adminView))
+	suite.Len(adminView, 2)
+
+	// Revoke everything but the tablet
+	resp = suite.authRequest("DELETE", "/me/sessions", tablet)
+	suite.Require().Equal(200, resp.StatusCode)
+	var revoked map[string]int
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&revoked))
+	suite.Equal(1, revoked["revoked"])
+	suite.Equal(401, suite.authRequest("GET", "/me/sessions", laptop).StatusCode)
+
+	sessions = suite.listSessions(tablet)
+	suite.Require().Len(sessions, 1)
+	suite.Equal("tablet", sessions[0].UserAgent)
+	suite.True(sessions[0].Current)
+
+	// Revoking the current session logs out
+	suite.Equal(204, suite.authRequest("DELETE", "/me/sessions/"+sessions[0].ID, tablet).StatusCode)
+	suite.Equal(401, suite.authRequest("GET", "/me/sessions", tablet).StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestSessions_CannotRevokeOtherUsersSession() {
+	owner := suite.createUserWithCost("sessionowner", bcrypt.MinCost)
+	defer suite.db.Unscoped().Delete(&auth.User{}, owner.ID)
+	defer suite.db.Where("user_id = ?", owner.ID).Delete(&auth.Session{})
+	ownerToken := suite.loginFrom("sessionowner", "sessionownerpass", "owner")
+	sessions := suite.listSessions(ownerToken)
+	suite.Require().Len(sessions, 1)
+
+	resp := suite.authRequest("DELETE", "/me/sessions/"+sessions[0].ID, suite.token)
+	suite.Equal(404, resp.StatusCode)
+	suite.Equal(200, suite.authRequest("GET", "/me/sessions", ownerToken).StatusCode)
+}
+
+// updateBook applies changes on top of the book's current version
+func (suite *BookAPITestSuite) updateBook(id uint, changes map[string]interface{}, token string) {
+	changes["version"] = suite.bookVersion(id)
+	body, _ := json.Marshal(changes)
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/books/%d", id), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestBookHistory_RecordsChangedFields() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	created := suite.createBookInDB(book.Book{Title: "Changelog", Author: "History Author", Year: 1990, Genre: "Drama"})
+
+	suite.updateBook(created.ID, map[string]interface{}{"genre": "Mystery", "year": 1991}, suite.token)
+	suite.updateBook(created.ID, map[string]interface{}{"title": "Changelog, Revised"}, suite.adminToken)
+	// Sending the current value changes nothing
+	suite.updateBook(created.ID, map[string]interface{}{"genre": "Mystery"}, suite.adminToken)
+
+	resp := suite.authRequest("GET", fmt.Sprintf("/books/%d/history", created.ID), suite.token)
+	suite.Require().Equal(200, resp.StatusCode)
+	var history struct {
+		Changes []book.BookChangeEntry `json:"changes"`
+		Total   int64                  `json:"total"`
+	}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&history))
+	suite.Require().Len(history.Changes, 3)
+	suite.EqualValues(3, history.Total)
+
+	// Most recent first
+	latest := history.Changes[0]
+	suite.Equal("title", latest.FieldName)
+	suite.Equal("Changelog", latest.OldValue)
+	suite.Equal("Changelog, Revised", latest.NewValue)
+	suite.Equal("testadmin", latest.Username)
+
+	byField := map[string]book.BookChangeEntry{}
+	for _, change := range history.Changes[1:] {
+		byField[change.FieldName] = change
+	}
+	suite.Equal("Drama", byField["genre"].OldValue)
+	suite.Equal("Mystery", byField["genre"].NewValue)
+	suite.Equal("1990", byField["year"].OldValue)
+	suite.Equal("1991", byField["year"].NewValue)
+	suite.Equal("testuser", byField["genre"].Username)
+	suite.NotNil(byField["year"].UserID)
+	for _, change := range history.Changes {
+		suite.False(change.ChangedAt.IsZero())
+	}
+
+	// Pagination
+	resp = suite.authRequest("GET", fmt.Sprintf("/books/%d/history?page=2&limit=2", created.ID), suite.token)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&history))
+	suite.Len(history.Changes, 1)
+	suite.EqualValues(3, history.Total)
+
+	suite.Equal(401, suite.authRequest("GET", fmt.Sprintf("/books/%d/history", created.ID), "").StatusCode)
+	suite.Equal(404, suite.authRequest("GET", "/books/999999/history", suite.token).StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestBookHistory_UpdatesWithoutUserAreRecorded() {
+	created := suite.createBookInDB(book.Book{Title: "Unattributed", Author: "History Author", Year: 2000})
+
+	_, err := suite.books.UpdateBook(context.Background(), created.ID, &book.Book{Genre: "Poetry"})
+	suite.Require().NoError(err)
+
+	changes, total, err := suite.books.ListBookChanges(context.Background(), created.ID, 1, 20)
+	suite.Require().NoError(err)
+	suite.EqualValues(1, total)
+	suite.Require().Len(changes, 1)
+	suite.Equal("genre", changes[0].FieldName)
+	suite.Equal("", changes[0].OldValue)
+	suite.Equal("Poetry", changes[0].NewValue)
+	suite.Nil(changes[0].UserID)
+	suite.Empty(changes[0].Username)
+}
+
+func (suite *BookAPITestSuite) TestPaginationHeaders() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	for i := 0; i < 5; i++ {
+		b := suite.createBookInDB(book.Book{Title: fmt.Sprintf("Paged %d", i), Author: fmt.Sprintf("Paged Author %d", i), Year: 2000 + i})
+		suite.Equal(201, suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token).StatusCode)
+	}
+
+	resp := suite.authRequest("GET", "/me/bookmarks?page=2&limit=2", suite.token)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Equal("5", resp.Header.Get("X-Total-Count"))
+	suite.Equal("2", resp.Header.Get("X-Page"))
+	suite.Equal("2", resp.Header.Get("X-Limit"))
+	suite.Equal("3", resp.Header.Get("X-Pages"))
+	suite.Equal(`</me/bookmarks?limit=2&page=1>; rel="first", `+
+		`</me/bookmarks?limit=2&page=1>; rel="prev", `+
+		`</me/bookmarks?limit=2&page=3>; rel="next", `+
+		`</me/bookmarks?limit=2&page=3>; rel="last"`, resp.Header.Get("Link"))
+
+	var body map[string]interface{}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+	suite.Equal(float64(5), body["total"], "the body keeps the total")
+
+	// Authors were created along with the books
+	resp = suite.authRequest("GET", "/authors?search=Paged&limit=4", "")
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Equal("5", resp.Header.Get("X-Total-Count"))
+	suite.Equal("2", resp.Header.Get("X-Pages"))
+	suite.Contains(resp.Header.Get("Link"), `</authors?limit=4&page=2&search=Paged>; rel="next"`)
+}
+
+func (suite *BookAPITestSuite) seedSearchData() {
+	suite.createBookInDB(book.Book{Title: "The Hobbit", Author: "J.R.R. Tolkien", Year: 1937, Genre: "Fantasy"})
+	suite.createBookInDB(book.Book{Title: "The Fellowship of the Ring", Author: "J.R.R. Tolkien", Year: 1954, Genre: "Fantasy"})
+	suite.createBookInDB(book.Book{Title: "Tolkien: A Biography", Author: "Humphrey Carpenter", Year: 1977, Genre: "Biography"})
+	suite.createBookInDB(book.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965, Genre: "Science Fiction"})
+	suite.Require().NoError(suite.books.CreateSeries(context.Background(), &book.Series{Name: "Middle-earth", Description: "Tolkien's legendarium"}))
+	suite.Require().NoError(suite.books.CreateSeries(context.Background(), &book.Series{Name: "Dune Chronicles", Description: "Arrakis"}))
+}
+
+func (suite *BookAPITestSuite) getJSON(target string, dest interface{}) *http.Response {
+	resp, err := suite.app.Test(httptest.NewRequest("GET", target, nil))
+	suite.Require().NoError(err)
+	if resp.StatusCode == 200 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(dest))
+	}
+	return resp
+}
+
+func (suite *BookAPITestSuite) TestGlobalSearch_Grouped() {
+	suite.seedSearchData()
+
+	var result struct {
+		Books   []book.Book      `json:"books"`
+		Authors []author.Author  `json:"authors"`
+		Series  []book.Series    `json:"series"`
+		Total   map[string]int64 `json:"total"`
+	}
+	resp := suite.getJSON("/search?q=tolkien", &result)
+	suite.Require().Equal(200, resp.StatusCode)
+
+	// Books match on title or author
+	suite.Len(result.Books, 3)
+	suite.Len(result.Authors, 1)
+	suite.Equal("J.R.R. Tolkien", result.Authors[0].Name)
+	suite.Require().Len(result.Series, 1)
+	suite.Equal("Middle-earth", result.Series[0].Name)
+	suite.Equal(map[string]int64{"books": 3, "authors": 1, "series": 1}, result.Total)
+
+	// The per-type limit caps the results but not the totals
+	var limited map[string]json.RawMessage
+	resp = suite.getJSON("/search?q=tolkien&types=books&limit=2", &limited)
+	suite.Require().Equal(200, resp.StatusCode)
+	var books []book.Book
+	suite.Require().NoError(json.Unmarshal(limited["books"], &books))
+	suite.Len(books, 2)
+	suite.NotContains(limited, "authors")
+	suite.NotContains(limited, "series")
+	suite.JSONEq(`{"books": 3}`, string(limited["total"]))
+
+	// Requested types without matches are empty, not missing
+	var none map[string]json.RawMessage
+	resp = suite.getJSON("/search?q=zzzz&types=series", &none)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.JSONEq(`[]`, string(none["series"]))
+
+	suite.Equal(400, suite.getJSON("/search?q=t", nil).StatusCode)
+	suite.Equal(400, suite.getJSON("/search?q=tolkien&types=users", nil).StatusCode)
+	suite.Equal(400, suite.getJSON("/search?q=tolkien&format=xml", nil).StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestGlobalSearch_FlatIsRanked() {
+	suite.seedSearchData()
+
+	var result struct {
+		Results []search.Hit     `json:"results"`
+		Total   map[string]int64 `json:"total"`
+	}
+	resp := suite.getJSON("/search?q=tolkien&format=flat", &result)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(result.Results, 5)
+	suite.EqualValues(3, result.Total["books"])
+
+	types := map[string]int{}
+	for i, hit := range result.Results {
+		types[hit.Type]++
+		suite.NotZero(hit.ID)
+		suite.NotEmpty(hit.Title)
+		suite.NotNil(hit.Item)
+		if i > 0 {
+			suite.GreaterOrEqual(result.Results[i-1].Score, hit.Score)
+		}
+	}
+	suite.Equal(map[string]int{"books": 3, "authors": 1, "series": 1}, types)
+	suite.Equal("authors", result.Results[0].Type, "the author's name is all match")
+}
+
+func (suite *BookAPITestSuite) TestGlobalSearch_IsCached() {
+	suite.seedSearchData()
+
+	var first map[string]json.RawMessage
+	suite.Require().Equal(200, suite.getJSON("/search?q=dune&types=books", &first).StatusCode)
+	keys, err := suite.cache.Keys("search:global:*")
+	suite.Require().NoError(err)
+	suite.Len(keys, 1)
+
+	// Served from the cache until it expires, even after a new match
+	suite.createBookInDB(book.Book{Title: "Dune Messiah", Author: "Frank Herbert", Year: 1969})
+	var second map[string]json.RawMessage
+	suite.Require().Equal(200, suite.getJSON("/search?q=dune&types=books", &second).StatusCode)
+	suite.JSONEq(string(first["books"]), string(second["books"]))
+}
+
+func (suite *BookAPITestSuite) TestSearchSuggest() {
+	suite.seedSearchData()
+
+	var suggestions []search.Suggestion
+	resp := suite.getJSON("/search/suggest?q=du", &suggestions)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(suggestions, 2)
+	suite.Equal(search.Suggestion{Type: "books", ID: suggestions[0].ID, Text: "Dune"}, suggestions[0])
+	suite.Equal("series", suggestions[1].Type)
+	suite.Equal("Dune Chronicles", suggestions[1].Text)
+
+	resp = suite.getJSON("/search/suggest?q=j.r", &suggestions)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(suggestions, 1)
+	suite.Equal("authors", suggestions[0].Type)
+
+	resp = suite.getJSON("/search/suggest?q=the&limit=1", &suggestions)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(suggestions, 1)
+	suite.Equal("The Hobbit", suggestions[0].Text, "shortest completion first")
+}
+
+func (suite *BookAPITestSuite) bookStatus(id uint) string {
+	var stored book.Book
+	suite.Require().NoError(suite.db.First(&stored, id).Error)
+	return stored.Status
+}
+
+func (suite *BookAPITestSuite) booksWithStatus(status string) []book.Book {
+	var books []book.Book
+	suite.Require().Equal(200, suite.getJSON("/books?status="+status, &books).StatusCode)
+	return books
+}
+
+func (suite *BookAPITestSuite) TestLoans_CheckoutAndReturn() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	b := suite.createBookInDB(book.Book{Title: "On Loan", Author: "Loan Author", Year: 2010})
+	suite.Equal(book.StatusAvailable, suite.bookStatus(b.ID))
+
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/checkout", b.ID), suite.token)
+	suite.Require().Equal(201, resp.StatusCode)
+	var loan book.Loan
+	json.NewDecoder(resp.Body).Decode(&loan)
+	suite.Equal(b.ID, loan.BookID)
+	suite.Nil(loan.ReturnedAt)
+	suite.Equal(book.StatusCheckedOut, suite.bookStatus(b.ID))
+
+	// Checked out books can't be borrowed again or deleted
+	resp = suite.authRequest("POST", fmt.Sprintf("/books/%d/checkout", b.ID), suite.adminToken)
+	suite.Equal(409, resp.StatusCode)
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/books/%d", b.ID), suite.token)
+	suite.Equal(409, resp.StatusCode)
+	resp = suite.authRequest("POST", "/books/99999/checkout", suite.token)
+	suite.Equal(404, resp.StatusCode)
+
+	suite.Len(suite.booksWithStatus(book.StatusCheckedOut), 1)
+	suite.Empty(suite.booksWithStatus(book.StatusAvailable))
+
+	resp = suite.authRequest("PUT", fmt.Sprintf("/loans/%d/return", loan.ID), suite.token)
+	suite.Require().Equal(200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&loan)
+	suite.NotNil(loan.ReturnedAt)
+	suite.Equal(book.StatusAvailable, suite.bookStatus(b.ID))
+
+	resp = suite.authRequest("PUT", fmt.Sprintf("/loans/%d/return", loan.ID), suite.token)
+	suite.Equal(409, resp.StatusCode)
+	resp = suite.authRequest("PUT", "/loans/99999/return", suite.token)
+	suite.Equal(404, resp.StatusCode)
+
+	suite.Len(suite.booksWithStatus(book.StatusAvailable), 1)
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/books/%d", b.ID), suite.token)
+	suite.Equal(204, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestLoans_OnlyBorrowerOrAdminReturns() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	b := suite.createBookInDB(book.Book{Title: "Admin Loan", Author: "Loan Author", Year: 2011})
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/checkout", b.ID), suite.adminToken)
+	suite.Require().Equal(201, resp.StatusCode)
+	var loan book.Loan
+	json.NewDecoder(resp.Body).Decode(&loan)
+
+	resp = suite.authRequest("PUT", fmt.Sprintf("/loans/%d/return", loan.ID), suite.token)
+	suite.Equal(404, resp.StatusCode)
+	suite.Equal(book.StatusCheckedOut, suite.bookStatus(b.ID))
+
+	resp = suite.authRequest("POST", fmt.Sprintf("/books/%d/checkout", b.ID), suite.token)
+	suite.Require().Equal(409, resp.StatusCode)
+	resp = suite.authRequest("PUT", fmt.Sprintf("/loans/%d/return", loan.ID), suite.adminToken)
+	suite.Equal(200, resp.StatusCode)
+	suite.Equal(book.StatusAvailable, suite.bookStatus(b.ID))
+}
+
+func (suite *BookAPITestSuite) TestBookStatus_AdminOverride() {
+	b := suite.createBookInDB(book.Book{Title: "Misplaced", Author: "Status Author", Year: 2012})
+	target := fmt.Sprintf("/books/%d/status", b.ID)
+
+	if suite.token != "" {
+		body, _ := json.Marshal(book.StatusRequest{Status: book.StatusLost})
+		req := httptest.NewRequest("PUT", target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+suite.token)
+		resp, err := suite.app.Test(req)
+		suite.Require().NoError(err)
+		suite.Equal(403, resp.StatusCode)
+	}
+
+	resp := suite.adminRequest("PUT", target, book.StatusRequest{Status: "missing"})
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.adminRequest("PUT", "/books/99999/status", book.StatusRequest{Status: book.StatusLost})
+	suite.Equal(404, resp.StatusCode)
+
+	resp = suite.adminRequest("PUT", target, book.StatusRequest{Status: book.StatusLost})
+	suite.Require().Equal(200, resp.StatusCode)
+	var updated book.Book
+	json.NewDecoder(resp.Body).Decode(&updated)
+	suite.Equal(book.StatusLost, updated.Status)
+	suite.Len(suite.booksWithStatus(book.StatusLost), 1)
+
+	// Lost and reserved books can't be checked out or deleted
+	resp = suite.authRequest("POST", fmt.Sprintf("/books/%d/checkout", b.ID), suite.adminToken)
+	suite.Equal(409, resp.StatusCode)
+	resp = suite.adminRequest("PUT", target, book.StatusRequest{Status: book.StatusReserved})
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Equal(book.StatusReserved, suite.bookStatus(b.ID))
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/books/%d", b.ID), suite.adminToken)
+	suite.Equal(409, resp.StatusCode)
+
+	// Updates through PUT /books/:id don't touch the status
+	suite.updateBook(b.ID, map[string]interface{}{"title": "Found Again", "status": book.StatusAvailable}, suite.adminToken)
+	suite.Equal(book.StatusReserved, suite.bookStatus(b.ID))
+
+	counts, err := suite.books.CountBooksByStatus(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(map[string]int64{
+		book.StatusAvailable:  0,
+		book.StatusReserved:   1,
+		book.StatusCheckedOut: 0,
+		book.StatusLost:       0,
+	}, counts)
+
+	var books []book.Book
+	suite.Equal(400, suite.getJSON("/books?status=gone", &books).StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestCacheIntegrity_FindsAndFixesOrphanedKeys() {
+	if suite.cache == nil || suite.cache.Ping() != nil {
+		suite.T().Skip("Redis not available")
+	}
+
+	live := suite.createBookInDB(book.Book{Title: "Still Here", Author: "Cache Author", Year: 2015})
+	gone := suite.createBookInDB(book.Book{Title: "Hard Deleted", Author: "Cache Author", Year: 2016})
+	suite.Require().NoError(suite.db.Unscoped().Delete(&book.Book{}, gone.ID).Error)
+
+	liveKey := fmt.Sprintf("book:%d", live.ID)
+	orphanKey := fmt.Sprintf("book:%d", gone.ID)
+	orphanViews := fmt.Sprintf("book:views:%d", gone.ID)
+	suite.cache.Set(liveKey, live, time.Minute)
+	suite.cache.Set(orphanKey, gone, time.Minute)
+	suite.cache.Set(orphanViews, 3, time.Minute)
+
+	resp := suite.adminRequest("GET", "/admin/cache/integrity", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var report book.IntegrityReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	suite.Equal(3, report.TotalScanned)
+	suite.Equal(2, report.OrphanedCount)
+	suite.ElementsMatch([]string{orphanKey, orphanViews}, report.OrphanedKeys)
+	suite.True(report.Complete)
+
+	exists, _ := suite.cache.Exists(orphanKey)
+	suite.True(exists, "checking doesn't delete")
+
+	resp = suite.adminRequest("GET", "/admin/cache/integrity?limit=0", nil)
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.authRequest("GET", "/admin/cache/integrity", suite.token)
+	suite.Equal(403, resp.StatusCode)
+
+	resp = suite.adminRequest("POST", "/admin/cache/integrity/fix", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	report = book.IntegrityReport{}
+	json.NewDecoder(resp.Body).Decode(&report)
+	suite.Equal(2, report.DeletedCount)
+
+	exists, _ = suite.cache.Exists(orphanKey)
+	suite.False(exists)
+	exists, _ = suite.cache.Exists(liveKey)
+	suite.True(exists)
+}
+
+// Benchmark tests
+func BenchmarkGetBooks(b *testing.B) {
+	// Setup
+	suite := new(BookAPITestSuite)
+	suite.SetupSuite()
+	defer suite.TearDownSuite()
+
+	// Create some test data
+	for i := 0; i < 100; i++ {
+		suite.createBookInDB(book.Book{
+			Title:  fmt.Sprintf("Book %d", i),
+			Author: fmt.Sprintf("Author %d", i),
+			Year:   2020 + (i % 5),
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", "/books", nil)
+		resp, _ := suite.app.Test(req)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+func (suite *BookAPITestSuite) TestNewBooks_RecentFirst() {
+	now := time.Now()
+	suite.createBookInDB(book.Book{Title: "Last Month", Author: "New Author", Year: 2020, CreatedAt: now.AddDate(0, 0, -30)})
+	older := suite.createBookInDB(book.Book{Title: "Five Days Ago", Author: "New Author", Year: 2021, CreatedAt: now.AddDate(0, 0, -5)})
+	newest := suite.createBookInDB(book.Book{Title: "Yesterday", Author: "New Author", Year: 2022, CreatedAt: now.AddDate(0, 0, -1)})
+
+	var books []book.Book
+	resp := suite.getJSON("/books/new", &books)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(books, 2)
+	suite.Equal(newest.ID, books[0].ID)
+	suite.Equal(older.ID, books[1].ID)
+
+	books = nil
+	suite.getJSON("/books/new?days=2", &books)
+	suite.Require().Len(books, 1)
+	suite.Equal(newest.ID, books[0].ID)
+
+	books = nil
+	suite.getJSON("/books/new?days=60&limit=1", &books)
+	suite.Len(books, 1)
+
+	resp = suite.getJSON("/books/new?days=0", &books)
+	suite.Equal(400, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestPopularBooks_RankedByWeeklyViews() {
+	if suite.cache == nil || suite.cache.Ping() != nil {
+		suite.T().Skip("Redis not available")
+	}
+
+	few := suite.createBookInDB(book.Book{Title: "Few Views", Author: "Popular Author", Year: 2019})
+	most := suite.createBookInDB(book.Book{Title: "Most Views", Author: "Popular Author", Year: 2020})
+	some := suite.createBookInDB(book.Book{Title: "Some Views", Author: "Popular Author", Year: 2021})
+	deleted := suite.createBookInDB(book.Book{Title: "Deleted", Author: "Popular Author", Year: 2022})
+	for b, views := range map[uint]int{few.ID: 1, most.ID: 5, some.ID: 3, deleted.ID: 2} {
+		for i := 0; i < views; i++ {
+			suite.bookHandler.RecordView(b, "")
+		}
+	}
+	suite.Require().NoError(suite.db.Delete(&book.Book{}, deleted.ID).Error)
+
+	var popular []book.TrendingBook
+	resp := suite.getJSON("/books/popular?period=week", &popular)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(popular, 3, "deleted books are skipped")
+	suite.Equal(most.ID, popular[0].ID)
+	suite.Equal(int64(5), popular[0].WeeklyViews)
+	suite.Equal(some.ID, popular[1].ID)
+	suite.Equal(int64(3), popular[1].WeeklyViews)
+	suite.Equal(few.ID, popular[2].ID)
+
+	popular = nil
+	suite.getJSON("/books/popular?limit=2", &popular)
+	suite.Require().Len(popular, 2)
+	suite.Equal(most.ID, popular[0].ID)
+	suite.Equal(some.ID, popular[1].ID)
+
+	// Viewing through the API counts too
+	for i := 0; i < 5; i++ {
+		suite.getJSON(fmt.Sprintf("/books/%d", few.ID), &book.BookDetail{})
+	}
+	popular = nil
+	suite.getJSON("/books/popular", &popular)
+	suite.Require().NotEmpty(popular)
+	suite.Equal(few.ID, popular[0].ID)
+	suite.Equal(int64(6), popular[0].WeeklyViews)
+
+	resp = suite.getJSON("/books/popular?period=month", &popular)
+	suite.Equal(400, resp.StatusCode)
+}
+
+// seedRatings rates b once per score, each time as a different user
+func (suite *BookAPITestSuite) seedRatings(b book.Book, scores ...int) {
+	for i, score := range scores {
+		suite.Require().NoError(suite.db.Create(&book.Rating{UserID: uint(1000 + i), BookID: b.ID, Score: score}).Error)
+	}
+}
+
+func (suite *BookAPITestSuite) TestLeaderboard_RanksByAverageThenCount() {
+	best := suite.createBookInDB(book.Book{Title: "Best", Author: "Rated Author", Year: 2020, Genre: "Fiction"})
+	popular := suite.createBookInDB(book.Book{Title: "Popular", Author: "Rated Author", Year: 2020, Genre: "Fiction"})
+	tied := suite.createBookInDB(book.Book{Title: "Tied", Author: "Rated Author", Year: 2020, Genre: "Fiction"})
+	fewer := suite.createBookInDB(book.Book{Title: "Fewer", Author: "Rated Author", Year: 2020, Genre: "Fiction"})
+	unrated := suite.createBookInDB(book.Book{Title: "Too Few", Author: "Rated Author", Year: 2020, Genre: "Fiction"})
+	other := suite.createBookInDB(book.Book{Title: "Other Genre", Author: "Rated Author", Year: 2020, Genre: "History"})
+	deleted := suite.createBookInDB(book.Book{Title: "Deleted", Author: "Rated Author", Year: 2020, Genre: "Fiction"})
+
+	suite.seedRatings(best, 5, 5, 5, 5, 5)
+	suite.seedRatings(popular, 4, 4, 4, 4, 4, 4)
+	suite.seedRatings(tied, 4, 4, 4, 4, 4, 4)
+	suite.seedRatings(fewer, 4, 4, 4, 4, 4)
+	suite.seedRatings(unrated, 5, 5, 5, 5)
+	suite.seedRatings(other, 5, 5, 5, 5, 5, 5)
+	suite.seedRatings(deleted, 5, 5, 5, 5, 5, 5)
+	suite.db.Delete(&deleted)
+
+	var ranked []book.RankedBook
+	resp := suite.getJSON("/books/leaderboard?genre=Fiction", &ranked)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(ranked, 4, "books under min_ratings, of other genres and deleted are left out")
+	suite.Equal(best.ID, ranked[0].ID)
+	suite.Equal(int64(1), ranked[0].Rank)
+	suite.InDelta(5.0, ranked[0].AvgRating, 0.001)
+	suite.Equal(int64(5), ranked[0].RatingCount)
+	// Same average: more ratings rank higher, equal counts share a rank
+	suite.ElementsMatch([]uint{popular.ID, tied.ID}, []uint{ranked[1].ID, ranked[2].ID})
+	suite.Equal(int64(2), ranked[1].Rank)
+	suite.Equal(int64(2), ranked[2].Rank)
+	suite.Equal(fewer.ID, ranked[3].ID)
+	suite.Equal(int64(4), ranked[3].Rank)
+
+	ranked = nil
+	suite.getJSON("/books/leaderboard?genre=Fiction&min_ratings=4&limit=2", &ranked)
+	suite.Require().Len(ranked, 2)
+	suite.ElementsMatch([]uint{best.ID, unrated.ID}, []uint{ranked[0].ID, ranked[1].ID})
+
+	ranked = nil
+	suite.getJSON("/books/leaderboard/all-time", &ranked)
+	suite.Require().Len(ranked, 5)
+	suite.Equal(other.ID, ranked[0].ID, "six fives beat five")
+	suite.Equal(best.ID, ranked[1].ID)
+
+	resp = suite.getJSON("/books/leaderboard?min_ratings=0", &ranked)
+	suite.Equal(400, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestRateBook_ReplacesScoreAndRefreshesLeaderboard() {
+	b := suite.createBookInDB(book.Book{Title: "Rate Me", Author: "Rated Author", Year: 2020, Genre: "Poetry"})
+	suite.seedRatings(b, 3)
+
+	var ranked []book.RankedBook
+	suite.getJSON("/books/leaderboard?genre=Poetry&min_ratings=1", &ranked)
+	suite.Require().Len(ranked, 1)
+	suite.InDelta(3.0, ranked[0].AvgRating, 0.001)
+
+	rate := func(score int) *http.Response {
+		body, _ := json.Marshal(map[string]int{"score": score})
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/books/%d/rating", b.ID), bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+suite.token)
+		resp, err := suite.app.Test(req)
+		suite.Require().NoError(err)
+		return resp
+	}
+	suite.Require().Equal(200, rate(1).StatusCode)
+	suite.Require().Equal(200, rate(5).StatusCode)
+	suite.Equal(400, rate(6).StatusCode)
+
+	var count int64
+	suite.db.Model(&book.Rating{}).Where("book_id = ?", b.ID).Count(&count)
+	suite.Equal(int64(2), count, "rating again replaces the score")
+
+	ranked = nil
+	suite.getJSON("/books/leaderboard?genre=Poetry&min_ratings=1", &ranked)
+	suite.Require().Len(ranked, 1)
+	suite.InDelta(4.0, ranked[0].AvgRating, 0.001, "the cached leaderboard was dropped")
+}
+
+// fakeMailer records the messages sent through it
+type fakeMailer struct {
+	to       []string
+	subjects []string
+	bodies   []string
+	err      error
+}
+
+func (m *fakeMailer) Send(to []string, subject, htmlBody string) error {
+	m.to = append(m.to, to...)
+	m.subjects = append(m.subjects, subject)
+	m.bodies = append(m.bodies, htmlBody)
+	return m.err
+}
+
+func (suite *BookAPITestSuite) TestScheduledReports_CreateListDelete() {
+	resp := suite.adminRequest("POST", "/admin/reports/schedule", map[string]string{
+		"report": "stats", "schedule": "0 8 * * 1", "email": "admin@example.com",
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	var created report.ScheduledReport
+	json.NewDecoder(resp.Body).Decode(&created)
+	suite.NotZero(created.ID)
+	suite.Equal(time.Monday, created.NextRunAt.Weekday())
+	suite.Equal(8, created.NextRunAt.UTC().Hour())
+	suite.True(created.NextRunAt.After(time.Now()))
+
+	resp = suite.adminRequest("POST", "/admin/reports/schedule", map[string]string{
+		"report": "stats", "schedule": "at eight on mondays", "email": "admin@example.com",
+	})
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.adminRequest("POST", "/admin/reports/schedule", map[string]string{
+		"report": "stats", "schedule": "0 0 30 2 *", "email": "admin@example.com",
+	})
+	suite.Equal(400, resp.StatusCode, "a schedule that never runs is rejected")
+
+	resp = suite.adminRequest("GET", "/admin/reports/scheduled", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var reports []report.ScheduledReport
+	json.NewDecoder(resp.Body).Decode(&reports)
+	suite.Require().Len(reports, 1)
+	suite.Equal("0 8 * * 1", reports[0].Schedule)
+
+	resp = suite.authRequest("GET", "/admin/reports/scheduled", suite.token)
+	suite.Equal(403, resp.StatusCode)
+
+	resp = suite.adminRequest("DELETE", fmt.Sprintf("/admin/reports/scheduled/%d", created.ID), nil)
+	suite.Equal(204, resp.StatusCode)
+	resp = suite.adminRequest("DELETE", fmt.Sprintf("/admin/reports/scheduled/%d", created.ID), nil)
+	suite.Equal(404, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestScheduledReports_RunDueReports() {
+	mailer := &fakeMailer{}
+	previous := report.Mailer
+	report.Mailer = mailer
+	defer func() { report.Mailer = previous }()
+
+	suite.createBookInDB(book.Book{Title: "Counted", Author: "Report Author", Year: 2020})
+	now := time.Date(2024, 5, 20, 8, 0, 30, 0, time.UTC)
+	due := report.ScheduledReport{Report: report.ReportStats, Schedule: "0 8 * * 1", Email: "due@example.com", NextRunAt: now.Add(-30 * time.Second)}
+	later := report.ScheduledReport{Report: report.ReportStats, Schedule: "0 8 * * 2", Email: "later@example.com", NextRunAt: now.Add(24 * time.Hour)}
+	suite.Require().NoError(suite.reports.CreateScheduledReport(context.Background(), &due))
+	suite.Require().NoError(suite.reports.CreateScheduledReport(context.Background(), &later))
+
+	ran, err := suite.reports.RunDueReports(context.Background(), now)
+	suite.Require().NoError(err)
+	suite.Equal(1, ran)
+	suite.Equal([]string{"due@example.com"}, mailer.to)
+	suite.Contains(mailer.subjects[0], "Library statistics")
+	suite.Contains(mailer.bodies[0], "<strong>1</strong>")
+
+	var stored report.ScheduledReport
+	suite.Require().NoError(suite.db.First(&stored, due.ID).Error)
+	suite.Equal(time.Date(2024, 5, 27, 8, 0, 0, 0, time.UTC), stored.NextRunAt.UTC())
+	suite.Require().NotNil(stored.LastRunAt)
+	suite.Empty(stored.LastError)
+
+	// Already moved to next week
+	ran, err = suite.reports.RunDueReports(context.Background(), now)
+	suite.Require().NoError(err)
+	suite.Zero(ran)
+
+	// Failures are recorded and the schedule still moves on
+	mailer.err = errors.New("connection refused")
+	ran, err = suite.reports.RunDueReports(context.Background(), now.AddDate(0, 0, 7))
+	suite.Require().NoError(err)
+	suite.Equal(2, ran)
+	suite.Require().NoError(suite.db.First(&stored, due.ID).Error)
+	suite.Equal("connection refused", stored.LastError)
+	suite.Equal(time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC), stored.NextRunAt.UTC())
+}
+
+func (suite *BookAPITestSuite) TestNotifyListener_InvalidatesCachedBook() {
+	if suite.cache == nil || suite.cache.Ping() != nil {
+		suite.T().Skip("Redis not available")
+	}
+	book.NotifyChanges = true
+	defer func() { book.NotifyChanges = false }()
+
+	payloads := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db.StartNotifyListener(ctx, suite.logger, func(payload string) {
+		suite.bookHandler.HandleChangeNotification(payload)
+		payloads <- payload
+	})
+
+	// Notifications sent before LISTEN are lost, so wait until one arrives
+	subscribed := false
+	for i := 0; i < 50 && !subscribed; i++ {
+		suite.Require().NoError(db.Notify(suite.db, "0"))
+		select {
+		case <-payloads:
+			subscribed = true
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	suite.Require().True(subscribed, "listener never subscribed")
+
+	// Skips the probes still in flight
+	nextBookID := func() string {
+		for {
+			select {
+			case payload := <-payloads:
+				if payload != "0" {
+					return payload
+				}
+			case <-time.After(5 * time.Second):
+				suite.FailNow("no notification received")
+			}
+		}
+	}
+
+	b := suite.createBookInDB(book.Book{Title: "Notified", Author: "Notify Author", Year: 2020})
+	suite.Equal(fmt.Sprint(b.ID), nextBookID(), "creating a book notifies too")
+
+	// Stands in for a copy cached by another instance
+	key := fmt.Sprintf("book:%d", b.ID)
+	suite.cache.Set(key, b, time.Minute)
+	suite.Require().NoError(suite.db.Model(&b).Update("genre", "Fantasy").Error)
+
+	suite.Equal(fmt.Sprint(b.ID), nextBookID())
+	exists, _ := suite.cache.Exists(key)
+	suite.False(exists)
+}
+
+func (suite *BookAPITestSuite) TestCountryAnalytics() {
+	suite.Require().NoError(suite.geo.RecordRequest("TR", "85.105.1.1", time.Now()))
+	suite.Require().NoError(suite.geo.RecordRequest("TR", "85.105.1.2", time.Now()))
+	suite.Require().NoError(suite.geo.RecordRequest("DE", "46.114.1.1", time.Now()))
+
+	resp := suite.adminRequest("GET", "/admin/analytics/countries?days=7", nil)
+	suite.Require().Equal(200, resp.StatusCode)
+	var stats geo.CountryStats
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&stats))
+	suite.Equal(int64(3), stats.TotalRequests)
+	suite.Require().Len(stats.Countries, 2)
+	suite.Equal(geo.CountryCount{CountryCode: "TR", Requests: 2, UniqueVisitors: 2}, stats.Countries[0])
+
+	resp = suite.adminRequest("GET", "/admin/analytics/countries?days=31", nil)
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.authRequest("GET", "/admin/analytics/countries", suite.token)
+	suite.Equal(403, resp.StatusCode)
+}
+
+func TestBookAPITestSuite(t *testing.T) {
+	suite.Run(t, new(BookAPITestSuite))
+}
+
+func (suite *BookAPITestSuite) TestMyActivity_AllEventTypesNewestFirst() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	b := suite.createBookInDB(book.Book{Title: "Active Reading", Author: "Activity Author", Year: 2019})
+
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/checkout", b.ID), suite.token)
+	suite.Require().Equal(201, resp.StatusCode)
+	var loan book.Loan
+	json.NewDecoder(resp.Body).Decode(&loan)
+	resp = suite.authRequest("PUT", fmt.Sprintf("/loans/%d/return", loan.ID), suite.token)
+	suite.Require().Equal(200, resp.StatusCode)
+	resp = suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token)
+	suite.Require().Equal(201, resp.StatusCode)
+	body, _ := json.Marshal(map[string]int{"score": 4})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/books/%d/rating", b.ID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.authRequest("GET", "/books?search=Active", suite.token)
+
+	// Three per page, following the cursor
+	var events []activity.Event
+	target := "/me/activity?limit=3"
+	for pages := 0; target != ""; pages++ {
+		suite.Require().Less(pages, 3)
+		resp = suite.authRequest("GET", target, suite.token)
+		suite.Require().Equal(200, resp.StatusCode)
+		var page activity.Page
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&page))
+		events = append(events, page.Events...)
+		target = ""
+		if page.NextCursor != "" {
+			target = "/me/activity?limit=3&cursor=" + page.NextCursor
+		}
+	}
+
+	suite.Require().Len(events, 5)
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	suite.Equal([]string{
+		activity.TypeSearchPerformed,
+		activity.TypeBookRated,
+		activity.TypeBookmarkAdded,
+		activity.TypeBookReturned,
+		activity.TypeBookBorrowed,
+	}, types)
+	suite.Require().NotNil(events[0].Query)
+	suite.Equal("Active", *events[0].Query)
+	suite.Nil(events[0].BookID)
+	suite.Require().NotNil(events[1].Score)
+	suite.Equal(4, *events[1].Score)
+	for _, e := range events[1:] {
+		suite.Require().NotNil(e.BookID)
+		suite.Equal(b.ID, *e.BookID)
+		suite.Equal("Active Reading", *e.BookTitle)
+	}
+
+	resp = suite.authRequest("GET", "/me/activity?cursor=not-a-cursor", suite.token)
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.authRequest("GET", "/me/activity", "")
+	suite.Equal(401, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestMyActivity_FirstPageRefreshedByNewEvents() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	b := suite.createBookInDB(book.Book{Title: "Cached Activity", Author: "Activity Author", Year: 2019})
+
+	var page activity.Page
+	suite.getJSONAs("/me/activity", suite.token, &page)
+	suite.Empty(page.Events)
+
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token)
+	suite.Require().Equal(201, resp.StatusCode)
+
+	suite.getJSONAs("/me/activity", suite.token, &page)
+	suite.Require().Len(page.Events, 1)
+	suite.Equal(activity.TypeBookmarkAdded, page.Events[0].Type)
+}
+
+func (suite *BookAPITestSuite) TestActivityFeed_AdminOnlyWithUsernames() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+	b := suite.createBookInDB(book.Book{Title: "Feed Book", Author: "Activity Author", Year: 2019})
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token)
+	suite.Require().Equal(201, resp.StatusCode)
+
+	resp = suite.authRequest("GET", "/admin/activity/feed", suite.token)
+	suite.Equal(403, resp.StatusCode)
+
+	var feed []activity.Event
+	suite.getJSONAs("/admin/activity/feed?limit=5", suite.adminToken, &feed)
+	suite.Require().NotEmpty(feed)
+	suite.Equal(activity.TypeBookmarkAdded, feed[0].Type)
+	suite.NotEmpty(feed[0].Username)
+}
+
+func (suite *BookAPITestSuite) TestDataExport_ContainsAllFiles() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+	b := suite.createBookInDB(book.Book{Title: "Exported Book", Author: "Privacy Author", Year: 2018})
+	resp := suite.authRequest("POST", fmt.Sprintf("/books/%d/bookmark", b.ID), suite.token)
+	suite.Require().Equal(201, resp.StatusCode)
+
+	readZip := func(resp *http.Response) map[string][]byte {
+		suite.Require().Equal(200, resp.StatusCode)
+		suite.Equal(privacy.ContentTypeZip, resp.Header.Get("Content-Type"))
+		body, err := io.ReadAll(resp.Body)
+		suite.Require().NoError(err)
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		suite.Require().NoError(err)
+		files := map[string][]byte{}
+		for _, f := range archive.File {
+			r, err := f.Open()
+			suite.Require().NoError(err)
+			files[f.Name], _ = io.ReadAll(r)
+			r.Close()
+		}
+		return files
+	}
+
+	files := readZip(suite.authRequest("GET", "/me/export", suite.token))
+	for _, name := range privacy.Files {
+		suite.Contains(files, name)
+	}
+	suite.NotContains(string(files["profile.json"]), "password")
+	var bookmarks []book.Bookmark
+	suite.NoError(json.Unmarshal(files["bookmarks.json"], &bookmarks))
+	suite.Require().Len(bookmarks, 1)
+	suite.Equal(b.ID, bookmarks[0].BookID)
+
+	// Once a day for users, any time for admins
+	resp = suite.authRequest("GET", "/me/export", suite.token)
+	suite.Equal(429, resp.StatusCode)
+	files = readZip(suite.authRequest("GET", fmt.Sprintf("/admin/users/%d/export", suite.userID("testuser")), suite.adminToken))
+	suite.Len(files, len(privacy.Files))
+
+	resp = suite.authRequest("GET", "/admin/users/999999/export", suite.adminToken)
+	suite.Equal(404, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) getJSONAs(target, token string, dest interface{}) {
+	resp := suite.authRequest("GET", target, token)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(dest))
+}
+
+func (suite *BookAPITestSuite) userID(username string) uint {
+	var user auth.User
+	suite.Require().NoError(suite.db.Where("username = ?", username).First(&user).Error)
+	return user.ID
+}
+
+func (suite *BookAPITestSuite) TestBookAttribution_CreatedAndUpdatedBy() {
+	if suite.token == "" || suite.adminToken == "" {
+		suite.T().Skip("No auth token available")
+	}
+	adminID := suite.userID("testadmin")
+	userID := suite.userID("testuser")
+
+	// Attribution in the body is ignored
+	resp := suite.adminRequest("POST", "/books", map[string]interface{}{
+		"title": "Attributed", "author": "Attribution Author", "year": 2020, "created_by_user_id": userID,
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	var created book.Book
+	json.NewDecoder(resp.Body).Decode(&created)
+	suite.Require().NotNil(created.CreatedByUserID)
+	suite.Equal(adminID, *created.CreatedByUserID)
+	suite.Equal("testadmin", created.CreatedByUsername)
+	suite.Nil(created.UpdatedByUserID)
+
+	body, _ := json.Marshal(map[string]interface{}{"genre": "Drama", "version": created.Version})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/books/%d", created.ID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var detail book.BookDetail
+	suite.getJSON(fmt.Sprintf("/books/%d", created.ID), &detail)
+	suite.Equal("testadmin", detail.CreatedByUsername)
+	suite.Require().NotNil(detail.UpdatedByUserID)
+	suite.Equal(userID, *detail.UpdatedByUserID)
+	suite.Equal("testuser", detail.UpdatedByUsername)
+
+	// The change history doesn't list the attribution columns
+	var history []book.BookChangeEntry
+	suite.getJSONAs(fmt.Sprintf("/books/%d/history", created.ID), suite.token, &history)
+	suite.Require().Len(history, 1)
+	suite.Equal("genre", history[0].FieldName)
+}
+
+func (suite *BookAPITestSuite) TestBookAttribution_ListByCreator() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+	adminID := suite.userID("testadmin")
+	suite.createBookInDB(book.Book{Title: "Imported", Author: "Attribution Author", Year: 2018})
+	for _, title := range []string{"First Added", "Second Added"} {
+		resp := suite.adminRequest("POST", "/books", map[string]interface{}{"title": title, "author": "Attribution Author", "year": 2021})
+		suite.Require().Equal(201, resp.StatusCode)
+	}
+
+	for _, target := range []string{fmt.Sprintf("/books?created_by=%d", adminID), fmt.Sprintf("/users/%d/books", adminID)} {
+		var books []book.Book
+		resp := suite.getJSON(target, &books)
+		suite.Require().Equal(200, resp.StatusCode, target)
+		suite.Require().Len(books, 2, target)
+		suite.Equal("Second Added", books[0].Title)
+		suite.Equal("testadmin", books[0].CreatedByUsername)
+	}
+
+	var books []book.Book
+	resp := suite.getJSON("/books?created_by=abc", &books)
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.getJSON("/users/99999/books", &books)
+	suite.Equal(404, resp.StatusCode)
+}
+
+// createSeriesInDB puts books in a new series in the given order
+func (suite *BookAPITestSuite) createSeriesInDB(name string, books ...book.Book) book.Series {
+	series := book.Series{Name: name}
+	suite.Require().NoError(suite.db.Create(&series).Error)
+	for i, b := range books {
+		suite.Require().NoError(suite.db.Create(&book.SeriesEntry{BookID: b.ID, SeriesID: series.ID, SequenceNumber: i + 1}).Error)
+	}
+	return series
+}
+
+func (suite *BookAPITestSuite) setReadingStatus(bookID uint, status string) *http.Response {
+	body, _ := json.Marshal(book.ReadingStatusRequest{Status: status})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/books/%d/reading-status", bookID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	return resp
+}
+
+func (suite *BookAPITestSuite) TestSeriesProgress_CountsFinishedBooks() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	first := suite.createBookInDB(book.Book{Title: "Leviathan Wakes", Author: "James S. A. Corey", Year: 2011})
+	second := suite.createBookInDB(book.Book{Title: "Caliban's War", Author: "James S. A. Corey", Year: 2012})
+	third := suite.createBookInDB(book.Book{Title: "Abaddon's Gate", Author: "James S. A. Corey", Year: 2013})
+	series := suite.createSeriesInDB("The Expanse", first, second, third)
+
+	suite.Require().Equal(200, suite.setReadingStatus(first.ID, book.ReadingFinished).StatusCode)
+	suite.Require().Equal(200, suite.setReadingStatus(second.ID, book.ReadingInProgress).StatusCode)
+
+	var progress book.SeriesProgress
+	suite.getJSONAs(fmt.Sprintf("/series/%d/progress", series.ID), suite.token, &progress)
+	suite.Equal(series.ID, progress.SeriesID)
+	suite.Equal("The Expanse", progress.SeriesName)
+	suite.Equal(int64(3), progress.TotalBooks)
+	suite.Equal(int64(1), progress.FinishedBooks)
+	suite.Equal(int64(1), progress.InProgressBooks)
+
+	// Changing a status drops the cached progress
+	suite.Require().Equal(200, suite.setReadingStatus(second.ID, book.ReadingFinished).StatusCode)
+	progress = book.SeriesProgress{}
+	suite.getJSONAs(fmt.Sprintf("/series/%d/progress", series.ID), suite.token, &progress)
+	suite.Equal(int64(2), progress.FinishedBooks)
+	suite.Equal(int64(0), progress.InProgressBooks)
+	suite.InDelta(66.7, progress.CompletionPercent, 0.001)
+
+	var inProgress []book.SeriesProgress
+	suite.getJSONAs("/me/series/in-progress", suite.token, &inProgress)
+	suite.Require().Len(inProgress, 1)
+	suite.Equal(series.ID, inProgress[0].SeriesID)
+
+	// Finished series are no longer in progress
+	suite.Require().Equal(200, suite.setReadingStatus(third.ID, book.ReadingFinished).StatusCode)
+	inProgress = nil
+	suite.getJSONAs("/me/series/in-progress", suite.token, &inProgress)
+	suite.Empty(inProgress)
+
+	// Other users haven't read anything
+	if suite.adminToken != "" {
+		progress = book.SeriesProgress{}
+		suite.getJSONAs(fmt.Sprintf("/series/%d/progress", series.ID), suite.adminToken, &progress)
+		suite.Equal(int64(0), progress.FinishedBooks)
+		suite.Equal(0.0, progress.CompletionPercent)
+	}
+}
+
+func (suite *BookAPITestSuite) TestSeriesProgress_Errors() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	suite.Equal(404, suite.authRequest("GET", "/series/999999/progress", suite.token).StatusCode)
+	suite.Equal(401, suite.authRequest("GET", "/series/1/progress", "").StatusCode)
+	suite.Equal(404, suite.setReadingStatus(999999, book.ReadingFinished).StatusCode)
+
+	b := suite.createBookInDB(book.Book{Title: "Status Book", Author: "Someone", Year: 2001})
+	suite.Equal(400, suite.setReadingStatus(b.ID, "abandoned").StatusCode)
+}
+
+func (suite *BookAPITestSuite) bookVersion(id uint) int {
+	var b book.Book
+	suite.Require().NoError(suite.db.Select("version").First(&b, id).Error)
+	return b.Version
+}
+
+func (suite *BookAPITestSuite) putBook(id uint, changes map[string]interface{}) *http.Response {
+	body, _ := json.Marshal(changes)
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/books/%d", id), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	return resp
+}
+
+func (suite *BookAPITestSuite) TestUpdateBook_ConcurrentUpdatesOneWins() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	created := suite.createBookInDB(book.Book{Title: "Contested", Author: "Someone", Year: 2000})
+	suite.Require().Equal(1, created.Version)
+
+	const editors = 5
+	statuses := make([]int, editors)
+	bodies := make([]apierrors.VersionConflictBody, editors)
+	var wg sync.WaitGroup
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp := suite.putBook(created.ID, map[string]interface{}{
+				"genre":   fmt.Sprintf("Genre %d", i),
+				"version": created.Version,
+			})
+			statuses[i] = resp.StatusCode
+			json.NewDecoder(resp.Body).Decode(&bodies[i])
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for i, status := range statuses {
+		switch status {
+		case 200:
+			succeeded++
+		case 409:
+			suite.Equal("conflict", bodies[i].Error)
+			suite.Equal(2, bodies[i].CurrentVersion)
+		default:
+			suite.Failf("unexpected status", "editor %d got %d", i, status)
+		}
+	}
+	suite.Equal(1, succeeded, "exactly one update based on version 1 wins")
+	suite.Equal(2, suite.bookVersion(created.ID))
+
+	// Retrying with the current version works
+	resp := suite.putBook(created.ID, map[string]interface{}{"genre": "Retried", "version": 2})
+	suite.Require().Equal(200, resp.StatusCode)
+	var updated book.Book
+	json.NewDecoder(resp.Body).Decode(&updated)
+	suite.Equal(3, updated.Version)
+	suite.Equal("Retried", updated.Genre)
+}
+
+func (suite *BookAPITestSuite) TestUpdateBook_RequiresVersion() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	created := suite.createBookInDB(book.Book{Title: "Unversioned", Author: "Someone", Year: 2000})
+
+	suite.Equal(400, suite.putBook(created.ID, map[string]interface{}{"genre": "Drama"}).StatusCode)
+	suite.Equal(409, suite.putBook(created.ID, map[string]interface{}{"genre": "Drama", "version": 7}).StatusCode)
+	suite.Equal(1, suite.bookVersion(created.ID))
+}
+
+func (suite *BookAPITestSuite) TestSeed_RerunDoesNotDuplicate() {
+	suite.T().Setenv("ADMIN_PASSWORD", "seeded-password")
+	path := suite.T().TempDir() + "/seed.yaml"
+	manifest := `
+users:
+  - match_by: username
+    username: seeded_admin
+    email: seeded_admin@example.com
+    password: $env:ADMIN_PASSWORD
+    role: admin
+books:
+  - match_by: isbn
+    title: Seeded Book
+    author: Seed Author
+    year: 2001
+    isbn: 978-0-14-044913-6
+`
+	suite.Require().NoError(os.WriteFile(path, []byte(manifest), 0o644))
+
+	dry, err := seed.SeedFromFile(context.Background(), suite.db, path, true)
+	suite.Require().NoError(err)
+	suite.Equal(2, dry.Count(seed.ActionCreate))
+	var books int64
+	suite.db.Model(&book.Book{}).Where("isbn = ?", "978-0-14-044913-6").Count(&books)
+	suite.Zero(books, "a dry run writes nothing")
+
+	first, err := seed.SeedFromFile(context.Background(), suite.db, path, false)
+	suite.Require().NoError(err)
+	suite.Equal(2, first.Count(seed.ActionCreate))
+	second, err := seed.SeedFromFile(context.Background(), suite.db, path, false)
+	suite.Require().NoError(err)
+	suite.Equal(2, second.Count(seed.ActionUnchanged))
+
+	var users int64
+	suite.db.Model(&auth.User{}).Where("username = ?", "seeded_admin").Count(&users)
+	suite.db.Model(&book.Book{}).Where("isbn = ?", "978-0-14-044913-6").Count(&books)
+	suite.EqualValues(1, users)
+	suite.EqualValues(1, books)
+
+	var admin auth.User
+	suite.Require().NoError(suite.db.Where("username = ?", "seeded_admin").First(&admin).Error)
+	suite.NoError(bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte("seeded-password")))
+}
+
+// syncISBN is the nth valid ISBN-13 of the catalog used by the sync tests
+func syncISBN(n int) string {
+	digits := fmt.Sprintf("978%09d", n)
+	sum := 0
+	for i, d := range digits {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(d-'0') * weight
+	}
+	return fmt.Sprintf("%s%d", digits, (10-sum%10)%10)
+}
+
+func syncCatalog(n int) []book.SyncBook {
+	books := make([]book.SyncBook, n)
+	for i := range books {
+		books[i] = book.SyncBook{
+			Title:  fmt.Sprintf("Synced Book %d", i),
+			Author: fmt.Sprintf("Sync Author %d", i%20),
+			Year:   1950 + i%70,
+			Genre:  "Catalog",
+			ISBN:   syncISBN(i),
+		}
+	}
+	return books
+}
+
+func (suite *BookAPITestSuite) syncBooks(books []book.SyncBook) book.SyncResult {
+	payload, _ := json.Marshal(books)
+	req := httptest.NewRequest("POST", "/admin/books/sync", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.adminToken)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Require().Equal(200, resp.StatusCode)
+
+	var result book.SyncResult
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	suite.NotEmpty(result.SyncID)
+	return result
+}
+
+func (suite *BookAPITestSuite) TestSyncBooks_200BookCatalog() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+	manual := suite.createBookInDB(book.Book{Title: "Added By Hand", Author: "Librarian", Year: 2020})
+
+	catalog := syncCatalog(200)
+	first := suite.syncBooks(catalog)
+	suite.Equal(book.SyncCounts{Created: 200}, first.Upserted)
+	suite.Equal(1, first.Unlisted, "the book outside the catalog")
+	suite.Empty(first.Errors)
+
+	var synced int64
+	suite.db.Model(&book.Book{}).Where("sync_status = ?", book.SyncStatusSynced).Count(&synced)
+	suite.EqualValues(200, synced)
+	var stored book.Book
+	suite.Require().NoError(suite.db.Where("isbn = ?", syncISBN(7)).First(&stored).Error)
+	suite.NotNil(stored.AuthorID, "COPY links authors like BeforeCreate")
+	var indexed int64
+	suite.db.Model(&book.Book{}).Where("search_vector IS NOT NULL AND sync_status = ?", book.SyncStatusSynced).Count(&indexed)
+	suite.EqualValues(200, indexed)
+	var unlisted book.Book
+	suite.Require().NoError(suite.db.First(&unlisted, manual.ID).Error)
+	suite.Equal(book.SyncStatusUnlisted, unlisted.SyncStatus)
+
+	// The next night: 5 retitled, 10 dropped, 1 invalid
+	next := append([]book.SyncBook{}, catalog[:190]...)
+	for i := 0; i < 5; i++ {
+		next[i].Title += " (2nd edition)"
+	}
+	next[10].Year = 0
+	second := suite.syncBooks(next)
+	suite.Equal(book.SyncCounts{Updated: 5, Unchanged: 184}, second.Upserted)
+	suite.Equal(10, second.Unlisted, "the manual book is already unlisted")
+	suite.Require().Len(second.Errors, 1)
+	suite.Equal(10, second.Errors[0].Index)
+
+	var total int64
+	suite.db.Model(&book.Book{}).Count(&total)
+	suite.EqualValues(201, total, "syncs never delete or duplicate books")
+	suite.Require().NoError(suite.db.Where("isbn = ?", syncISBN(10)).First(&stored).Error)
+	suite.Equal(book.SyncStatusSynced, stored.SyncStatus, "an invalid entry is still in the catalog")
+	suite.Require().NoError(suite.db.Where("isbn = ?", syncISBN(0)).First(&stored).Error)
+	suite.Equal("Synced Book 0 (2nd edition)", stored.Title)
+	suite.Equal(2, stored.Version)
+
+	var history []book.SyncHistory
+	suite.Require().NoError(suite.db.Order("started_at").Find(&history).Error)
+	suite.Require().Len(history, 2)
+	suite.Equal(second.SyncID, history[1].ID)
+	suite.Equal(5, history[1].Updated)
+	suite.Len(history[1].Errors, 1)
+}
+
+func (suite *BookAPITestSuite) TestSyncBooks_FailedRowsDontAbortTheSync() {
+	if suite.adminToken == "" {
+		suite.T().Skip("No admin token available")
+	}
+	// The unique ISBN index still holds the ISBN of a soft-deleted book
+	deleted := suite.createBookInDB(book.Book{Title: "Withdrawn", Author: "Someone", Year: 1990, ISBN: syncISBN(1)})
+	suite.Require().NoError(suite.db.Delete(&book.Book{}, deleted.ID).Error)
+
+	catalog := syncCatalog(3)
+	catalog = append(catalog, catalog[2])
+	result := suite.syncBooks(catalog)
+	suite.Equal(book.SyncCounts{Created: 2}, result.Upserted)
+	suite.Require().Len(result.Errors, 2)
+	// Invalid entries are reported as they are read, failed inserts after
+	suite.Equal(3, result.Errors[0].Index)
+	suite.Equal("isbn appears more than once", result.Errors[0].Error)
+	suite.Equal(1, result.Errors[1].Index)
+}
+
+func (suite *BookAPITestSuite) annotationRequest(method, target, token string, body interface{}) *http.Response {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := suite.app.Test(req)
+	suite.Require().NoError(err)
+	return resp
+}
+
+func (suite *BookAPITestSuite) TestAnnotations_CRUD() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	dune := suite.createBookInDB(book.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965})
+	emma := suite.createBookInDB(book.Book{Title: "Emma", Author: "Jane Austen", Year: 1815})
+	target := fmt.Sprintf("/books/%d/annotations", dune.ID)
+
+	resp := suite.annotationRequest("POST", target, suite.token, book.AnnotationRequest{
+		PassageStart: 500, PassageEnd: 524, PassageText: "Fear is the mind-killer.", Note: "Important litany",
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	var litany book.Annotation
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&litany))
+	suite.Equal(book.DefaultAnnotationColor, litany.Color)
+	suite.Equal(dune.ID, litany.BookID)
+
+	resp = suite.annotationRequest("POST", target, suite.token, book.AnnotationRequest{
+		PassageStart: 10, PassageEnd: 40, PassageText: "A beginning is the time", Color: "blue",
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	resp = suite.annotationRequest("POST", fmt.Sprintf("/books/%d/annotations", emma.ID), suite.token, book.AnnotationRequest{
+		PassageStart: 0, PassageEnd: 30, PassageText: "Emma Woodhouse, handsome, clever", Note: "Important opening",
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+
+	// Invalid passages and unknown books
+	resp = suite.annotationRequest("POST", target, suite.token, book.AnnotationRequest{PassageStart: 50, PassageEnd: 50, PassageText: "x"})
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.annotationRequest("POST", target, suite.token, book.AnnotationRequest{PassageStart: 0, PassageEnd: 5, PassageText: "x", Color: "orange"})
+	suite.Equal(400, resp.StatusCode)
+	resp = suite.annotationRequest("POST", "/books/99999/annotations", suite.token, book.AnnotationRequest{PassageStart: 0, PassageEnd: 5, PassageText: "x"})
+	suite.Equal(404, resp.StatusCode)
+
+	var page book.AnnotationPage
+	suite.getJSONAs(target, suite.token, &page)
+	suite.EqualValues(2, page.Total)
+	suite.Require().Len(page.Annotations, 2)
+	suite.Equal(10, page.Annotations[0].PassageStart, "in passage order")
+
+	page = book.AnnotationPage{}
+	suite.getJSONAs(target+"?q=importance", suite.token, &page)
+	suite.Require().Len(page.Annotations, 1, "stemmed search of notes")
+	suite.Equal(litany.ID, page.Annotations[0].ID)
+
+	page = book.AnnotationPage{}
+	suite.getJSONAs("/me/annotations?q=important", suite.token, &page)
+	suite.EqualValues(2, page.Total, "searches across books")
+
+	note := "Recite before exams"
+	resp = suite.annotationRequest("PUT", fmt.Sprintf("/annotations/%d", litany.ID), suite.token, book.UpdateAnnotationRequest{Note: &note})
+	suite.Require().Equal(200, resp.StatusCode)
+	var updated book.Annotation
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&updated))
+	suite.Equal(note, updated.Note)
+	suite.Equal("Fear is the mind-killer.", updated.PassageText, "omitted fields are kept")
+
+	// The cached page was dropped
+	page = book.AnnotationPage{}
+	suite.getJSONAs(target, suite.token, &page)
+	suite.Equal(note, page.Annotations[1].Note)
+
+	end := 5
+	resp = suite.annotationRequest("PUT", fmt.Sprintf("/annotations/%d", litany.ID), suite.token, book.UpdateAnnotationRequest{PassageEnd: &end})
+	suite.Equal(400, resp.StatusCode, "the passage would end before it starts")
+
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/annotations/%d", litany.ID), suite.token)
+	suite.Equal(204, resp.StatusCode)
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/annotations/%d", litany.ID), suite.token)
+	suite.Equal(404, resp.StatusCode)
+
+	page = book.AnnotationPage{}
+	suite.getJSONAs(target, suite.token, &page)
+	suite.EqualValues(1, page.Total)
+
+	suite.Equal(401, suite.authRequest("GET", target, "").StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestAnnotations_OwnOnly() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	other := suite.createUserWithCost("annotator", bcrypt.MinCost)
+	defer suite.db.Unscoped().Delete(&auth.User{}, other.ID)
+	otherToken, status := suite.login("annotator", "annotatorpass")
+	suite.Require().Equal(200, status)
+
+	b := suite.createBookInDB(book.Book{Title: "Private Notes", Author: "Someone", Year: 2020})
+	target := fmt.Sprintf("/books/%d/annotations", b.ID)
+	resp := suite.annotationRequest("POST", target, suite.token, book.AnnotationRequest{
+		PassageStart: 0, PassageEnd: 10, PassageText: "Mine alone", Note: "secret",
+	})
+	suite.Require().Equal(201, resp.StatusCode)
+	var mine book.Annotation
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&mine))
+
+	var page book.AnnotationPage
+	suite.getJSONAs(target, otherToken, &page)
+	suite.Empty(page.Annotations, "other users' annotations are never listed")
+	page = book.AnnotationPage{}
+	suite.getJSONAs("/me/annotations?q=secret", otherToken, &page)
+	suite.Empty(page.Annotations)
+
+	note := "hijacked"
+	resp = suite.annotationRequest("PUT", fmt.Sprintf("/annotations/%d", mine.ID), otherToken, book.UpdateAnnotationRequest{Note: &note})
+	suite.Equal(404, resp.StatusCode)
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/annotations/%d", mine.ID), otherToken)
+	suite.Equal(404, resp.StatusCode)
+	// Admins don't see them either
+	resp = suite.authRequest("DELETE", fmt.Sprintf("/annotations/%d", mine.ID), suite.adminToken)
+	suite.Equal(404, resp.StatusCode)
+
+	var stored book.Annotation
+	suite.Require().NoError(suite.db.First(&stored, mine.ID).Error)
+	suite.Equal("secret", stored.Note)
+}
+
+func (suite *BookAPITestSuite) postBook(body map[string]interface{}) (book.Book, *http.Response) {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/books", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+
+	var created book.Book
+	if resp.StatusCode == 201 {
+		suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&created))
+	}
+	return created, resp
+}
+
+func (suite *BookAPITestSuite) TestGenres_NormalizeNames() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+
+	var scienceFiction uint
+	for i, genre := range []string{"Science Fiction", "science fiction", "SCIENCE-FICTION", "  Science   Fiction "} {
+		created, resp := suite.postBook(map[string]interface{}{"title": fmt.Sprintf("Book %d", i), "author": "Genre Author", "year": 2000, "genre": genre})
+		suite.Require().Equal(201, resp.StatusCode, genre)
+		suite.Require().NotNil(created.GenreID, genre)
+		suite.Equal("Science Fiction", created.Genre, "stored under the first spelling")
+		if scienceFiction == 0 {
+			scienceFiction = *created.GenreID
+		}
+		suite.Equal(scienceFiction, *created.GenreID, genre)
+	}
+
+	sciFi, err := suite.books.ValidateGenre(context.Background(), "Sci-Fi")
+	suite.Require().NoError(err)
+	again, err := suite.books.ValidateGenre(context.Background(), "sci fi")
+	suite.Require().NoError(err)
+	suite.Equal(sciFi, again)
+	suite.NotEqual(scienceFiction, sciFi)
+	_, err = suite.books.ValidateGenre(context.Background(), " -- ")
+	suite.ErrorIs(err, book.ErrInvalidGenre)
+
+	// By ID
+	created, resp := suite.postBook(map[string]interface{}{"title": "By ID", "author": "Genre Author", "year": 2000, "genre_id": sciFi})
+	suite.Require().Equal(201, resp.StatusCode)
+	suite.Equal("Sci-Fi", created.Genre)
+	_, resp = suite.postBook(map[string]interface{}{"title": "Unknown", "author": "Genre Author", "year": 2000, "genre_id": 999999})
+	suite.Equal(400, resp.StatusCode)
+	_, resp = suite.postBook(map[string]interface{}{"title": "Invalid", "author": "Genre Author", "year": 2000, "genre": "!!!"})
+	suite.Equal(400, resp.StatusCode)
+
+	// Changing the genre relinks the book
+	resp = suite.putBook(created.ID, map[string]interface{}{"genre": "science fiction", "version": created.Version})
+	suite.Require().Equal(200, resp.StatusCode)
+	var stored book.Book
+	suite.Require().NoError(suite.db.First(&stored, created.ID).Error)
+	suite.Equal("Science Fiction", stored.Genre)
+	suite.Require().NotNil(stored.GenreID)
+	suite.Equal(scienceFiction, *stored.GenreID)
+}
+
+func (suite *BookAPITestSuite) TestGenres_ListWithBookCounts() {
+	fantasy := suite.createBookInDB(book.Book{Title: "The Hobbit", Author: "J.R.R. Tolkien", Year: 1937, Genre: "Fantasy"})
+	suite.createBookInDB(book.Book{Title: "Earthsea", Author: "Ursula K. Le Guin", Year: 1968, Genre: "fantasy"})
+	suite.createBookInDB(book.Book{Title: "Gaudy Night", Author: "Dorothy L. Sayers", Year: 1935, Genre: "Mystery"})
+	deleted := suite.createBookInDB(book.Book{Title: "Deleted", Author: "Nobody", Year: 2000, Genre: "Mystery"})
+	suite.Require().NoError(suite.db.Delete(&book.Book{}, deleted.ID).Error)
+	_, err := suite.books.ValidateGenre(context.Background(), "Poetry")
+	suite.Require().NoError(err)
+
+	var genres []book.GenreCount
+	resp := suite.getJSON("/genres", &genres)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(genres, 3)
+	for i, want := range []struct {
+		name  string
+		slug  string
+		count int64
+	}{{"Fantasy", "fantasy", 2}, {"Mystery", "mystery", 1}, {"Poetry", "poetry", 0}} {
+		suite.Equal(want.name, genres[i].Name)
+		suite.Equal(want.slug, genres[i].Slug)
+		suite.Equal(want.count, genres[i].BookCount, want.name)
+	}
+
+	suite.Require().NotNil(fantasy.GenreID)
+	var books []book.Book
+	resp = suite.getJSON(fmt.Sprintf("/books?genre_id=%d", *fantasy.GenreID), &books)
+	suite.Require().Equal(200, resp.StatusCode)
+	suite.Require().Len(books, 2)
+	suite.Equal("Earthsea", books[0].Title)
+	suite.Equal("The Hobbit", books[1].Title)
+
+	resp = suite.getJSON("/books?genre_id=abc", &books)
+	suite.Equal(400, resp.StatusCode)
+}
+
+func (suite *BookAPITestSuite) TestDuplicates_SimilarTitles() {
+	tests := []struct {
+		existing string
+		title    string
+		want     bool
+	}{
+		{"The Hobbit", "the hobbit!", true},
+		{"Harry Potter and the Philosopher's Stone", "Harry Potter and the Philosophers Stone", true},
+		{"Pride and Prejudice", "Pride & Prejudice", true},
+		{"The Lord of the Rings", "Lord of the Rings", true},
+		{"1984", "Nineteen Eighty-Four", false},
+		{"Dune", "Dune Messiah", false},
+		{"The Great Gatsby", "The Great Gatsby (Annotated)", false},
+		{"Emma", "Persuasion", false},
+	}
+	detector := dedup.NewDuplicateDetector(dedup.DefaultSimilarityThreshold)
+	for _, tt := range tests {
+		suite.db.Exec("DELETE FROM books")
+		existing := suite.createBookInDB(book.Book{Title: tt.existing, Author: "Dedup Author", Year: 2000})
+
+		candidates, err := detector.FindDuplicates(context.Background(), suite.db, tt.title)
+		suite.Require().NoError(err, tt.title)
+		if !tt.want {
+			suite.Empty(candidates, "%q vs %q", tt.existing, tt.title)
+			continue
+		}
+		if suite.Len(candidates, 1, "%q vs %q", tt.existing, tt.title) {
+			suite.Equal(existing.ID, candidates[0].ID)
+			suite.Equal(tt.existing, candidates[0].Title)
+			suite.Greater(candidates[0].Similarity, dedup.DefaultSimilarityThreshold)
+		}
+	}
+}
+
+func (suite *BookAPITestSuite) TestDuplicates_AddBookConflict() {
+	if suite.token == "" {
+		suite.T().Skip("No auth token available")
+	}
+	existing := suite.createBookInDB(book.Book{Title: "The Hobbit", Author: "J.R.R. Tolkien", Year: 1937})
+	suite.createBookInDB(book.Book{Title: "The Silmarillion", Author: "J.R.R. Tolkien", Year: 1977})
+
+	_, resp := suite.postBook(map[string]interface{}{"title": "The Hobbit!", "author": "Tolkien", "year": 1937})
+	suite.Require().Equal(409, resp.StatusCode)
+	var body struct {
+		Code    string        `json:"code"`
+		Details dedup.Details `json:"details"`
+	}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+	suite.Equal("POTENTIAL_DUPLICATE", body.Code)
+	suite.Require().Len(body.Details.Candidates, 1)
+	suite.Equal(existing.ID, body.Details.Candidates[0].ID)
+	suite.Equal("J.R.R. Tolkien", body.Details.Candidates[0].Author)
+
+	var count int64
+	suite.db.Model(&book.Book{}).Count(&count)
+	suite.Equal(int64(2), count, "the book isn't added")
+
+	payload, _ := json.Marshal(map[string]interface{}{"title": "The Hobbit!", "author": "Tolkien", "year": 1937})
+	req := httptest.NewRequest("POST", "/books?force=true", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	resp, err := suite.app.Test(req, -1)
+	suite.Require().NoError(err)
+	suite.Equal(201, resp.StatusCode, "force skips the check")
 }
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useSigner makes s the signer for the rest of the test
+func useSigner(t *testing.T, s *tokens.Signer) {
+	tokens.SetSigner(s)
+	t.Cleanup(func() { tokens.SetSigner(nil) })
+}
+
+// writeKeyPair generates an RSA key pair into a temporary directory and
+// points JWT_PRIVATE_KEY_PATH and JWT_PUBLIC_KEY_PATH at it
+func writeKeyPair(t *testing.T) (privatePEM, publicPEM []byte) {
+	privatePEM, publicPEM, err := tokens.GenerateKeyPair(0)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "jwt.key")
+	publicPath := filepath.Join(dir, "jwt.pub")
+	require.NoError(t, os.WriteFile(privatePath, privatePEM, 0o600))
+	require.NoError(t, os.WriteFile(publicPath, publicPEM, 0o644))
+	t.Setenv("JWT_PRIVATE_KEY_PATH", privatePath)
+	t.Setenv("JWT_PUBLIC_KEY_PATH", publicPath)
+	return privatePEM, publicPEM
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": 7, "role": "user", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestSigner_HS256(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	t.Setenv("JWT_SECRET", "hs256-secret")
+	signer, err := tokens.SignerFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, tokens.AlgorithmHS256, signer.Algorithm())
+
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+	parsed, err := signer.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, "HS256", parsed.Method.Alg())
+
+	_, err = tokens.NewHS256Signer([]byte("other-secret")).Parse(token)
+	assert.Error(t, err, "a token signed with another secret is invalid")
+}
+
+func TestSigner_RS256(t *testing.T) {
+	writeKeyPair(t)
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	signer, err := tokens.SignerFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, tokens.AlgorithmRS256, signer.Algorithm())
+
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+	parsed, err := signer.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+
+	// A service with only the public key verifies but can't sign
+	t.Setenv("JWT_PRIVATE_KEY_PATH", "")
+	verifier, err := tokens.SignerFromEnv()
+	require.NoError(t, err)
+	_, err = verifier.Parse(token)
+	assert.NoError(t, err)
+	_, err = verifier.Sign(testClaims())
+	assert.Error(t, err)
+}
+
+func TestSigner_RejectsUnexpectedAlgorithm(t *testing.T) {
+	_, publicPEM := writeKeyPair(t)
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	rs256, err := tokens.SignerFromEnv()
+	require.NoError(t, err)
+
+	// An HS256 token "signed" with the public key must not pass as RS256
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString(publicPEM)
+	require.NoError(t, err)
+	_, err = rs256.Parse(forged)
+	assert.Error(t, err)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = rs256.Parse(unsigned)
+	assert.Error(t, err)
+
+	rsToken, err := rs256.Sign(testClaims())
+	require.NoError(t, err)
+	_, err = tokens.NewHS256Signer([]byte("secret")).Parse(rsToken)
+	assert.Error(t, err)
+}
+
+func TestSignerFromEnv_InvalidConfig(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "ES256")
+	_, err := tokens.SignerFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	t.Setenv("JWT_PRIVATE_KEY_PATH", "")
+	t.Setenv("JWT_PUBLIC_KEY_PATH", "")
+	_, err = tokens.SignerFromEnv()
+	assert.Error(t, err, "RS256 needs a key")
+
+	t.Setenv("JWT_PRIVATE_KEY_PATH", filepath.Join(t.TempDir(), "missing.key"))
+	_, err = tokens.SignerFromEnv()
+	assert.Error(t, err)
+
+	// Keys from different pairs
+	writeKeyPair(t)
+	otherDir := t.TempDir()
+	_, otherPublic, err := tokens.GenerateKeyPair(0)
+	require.NoError(t, err)
+	otherPath := filepath.Join(otherDir, "other.pub")
+	require.NoError(t, os.WriteFile(otherPath, otherPublic, 0o644))
+	t.Setenv("JWT_PUBLIC_KEY_PATH", otherPath)
+	_, err = tokens.SignerFromEnv()
+	assert.Error(t, err)
+}
+
+func TestJWTProtected_RS256(t *testing.T) {
+	writeKeyPair(t)
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	signer, err := tokens.SignerFromEnv()
+	require.NoError(t, err)
+	useSigner(t, signer)
+
+	app := fiber.New()
+	app.Get("/me", middleware.JWTProtected(), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+	request := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	token, err := auth.GenerateJWT(&auth.User{ID: 7, Username: "reader", Role: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, request(token))
+
+	hs256, err := tokens.NewHS256Signer([]byte("supersecret")).Sign(testClaims())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, request(hs256))
+}
@@ -0,0 +1,243 @@
+package test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/ratelimit"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// testRedis returns a cache on the test Redis database, skipping when Redis
+// isn't available
+func testRedis(tb testing.TB) *cache.RedisCache {
+	tb.Helper()
+	c := cache.NewRedisCache("localhost:6379", "", 1)
+	if err := c.Ping(); err != nil {
+		c.Close()
+		tb.Skip("Redis not available, skipping test")
+	}
+	tb.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestLeakyBucketScript_AllowsBurstThenLimits(t *testing.T) {
+	c := testRedis(t)
+	key := "test:bucket:burst"
+	c.Delete(key)
+	defer c.Delete(key)
+
+	bucket, err := ratelimit.NewLeakyBucket(c, 1, 3)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		decision, err := bucket.Take(key, now)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed, "request %d", i)
+		assert.Equal(t, 2-i, decision.Remaining)
+	}
+
+	decision, err := bucket.Take(key, now)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+}
+
+func TestLeakyBucketScript_DrainsAtRate(t *testing.T) {
+	c := testRedis(t)
+	key := "test:bucket:drain"
+	c.Delete(key)
+	defer c.Delete(key)
+
+	bucket, err := ratelimit.NewLeakyBucket(c, 2, 2)
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err := bucket.Take(key, start)
+		require.NoError(t, err)
+	}
+
+	// Half a request has drained after 250ms at 2 per second
+	decision, err := bucket.Take(key, start.Add(250*time.Millisecond))
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 250*time.Millisecond, decision.RetryAfter)
+
+	decision, err = bucket.Take(key, start.Add(500*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+
+	// An idle bucket empties but never goes below zero
+	decision, err = bucket.Take(key, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 1, decision.Remaining)
+}
+
+func TestLeakyBucketScript_ClockBehindDoesNotRefill(t *testing.T) {
+	c := testRedis(t)
+	key := "test:bucket:skew"
+	c.Delete(key)
+	defer c.Delete(key)
+
+	bucket, err := ratelimit.NewLeakyBucket(c, 1, 1)
+	require.NoError(t, err)
+
+	now := time.Now()
+	decision, err := bucket.Take(key, now)
+	require.NoError(t, err)
+	require.True(t, decision.Allowed)
+
+	// Another instance whose clock is behind sees the bucket as still full
+	decision, err = bucket.Take(key, now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+}
+
+func TestLeakyBucketScript_ExpiresWhenDrained(t *testing.T) {
+	c := testRedis(t)
+	key := "test:bucket:ttl"
+	c.Delete(key)
+	defer c.Delete(key)
+
+	bucket, err := ratelimit.NewLeakyBucket(c, 10, 5)
+	require.NoError(t, err)
+	_, err = bucket.Take(key, time.Now())
+	require.NoError(t, err)
+
+	ttl, err := c.TTL(key)
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= 2*time.Second, "ttl %v", ttl)
+}
+
+func TestNewLeakyBucket_Validates(t *testing.T) {
+	_, err := ratelimit.NewLeakyBucket(nil, 0, 10)
+	assert.Error(t, err)
+	_, err = ratelimit.NewLeakyBucket(nil, 1, 0.5)
+	assert.Error(t, err)
+}
+
+// scriptCache answers RunScript with a fixed reply or error
+type scriptCache struct {
+	cache.Cache
+	reply interface{}
+	err   error
+	keys  []string
+}
+
+func (s *scriptCache) RunScript(script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	s.keys = append(s.keys, keys...)
+	return s.reply, s.err
+}
+
+func newLeakyBucketApp(c cache.Cache) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.LeakyBucketRateLimit(1, 5, middleware.RateLimitConfig{Cache: c}))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestLeakyBucketRateLimit_SetsHeaders(t *testing.T) {
+	c := &scriptCache{reply: []interface{}{int64(1), "2.5", int64(0)}}
+	app := newLeakyBucketApp(c)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("X-RateLimit-Limit"))
+	assert.Equal(t, "2", resp.Header.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, []string{"ratelimit:bucket:0.0.0.0"}, c.keys)
+}
+
+func TestLeakyBucketRateLimit_RejectsWhenFull(t *testing.T) {
+	c := &scriptCache{reply: []interface{}{int64(0), "5", int64(1200)}}
+	app := newLeakyBucketApp(c)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(fiber.HeaderRetryAfter))
+	assert.Equal(t, "0", resp.Header.Get("X-RateLimit-Remaining"))
+}
+
+func TestLeakyBucketRateLimit_LetsThroughWhenCacheFails(t *testing.T) {
+	app := newLeakyBucketApp(&scriptCache{err: errors.New("connection refused")})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("X-RateLimit-Remaining"))
+}
+
+func TestRateLimit_SelectsLeakyBucket(t *testing.T) {
+	c := &scriptCache{reply: []interface{}{int64(1), "1", int64(0)}}
+	app := newRateLimitApp(middleware.RateLimitConfig{
+		Max:       10,
+		Algorithm: middleware.AlgorithmLeakyBucket,
+		Cache:     c,
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "9", resp.Header.Get("X-RateLimit-Remaining"))
+	assert.Len(t, c.keys, 1)
+}
+
+// BenchmarkRateLimitAlgorithms compares the Redis-backed limiters at a limit
+// of 10k requests per second, with requests spread over 250 client IPs
+func BenchmarkRateLimitAlgorithms(b *testing.B) {
+	c := testRedis(b)
+
+	for _, algorithm := range []string{
+		middleware.AlgorithmFixedWindow,
+		middleware.AlgorithmSlidingWindow,
+		middleware.AlgorithmLeakyBucket,
+	} {
+		b.Run(algorithm, func(b *testing.B) {
+			handler := middleware.RateLimit(middleware.RateLimitConfig{
+				Max:        10000,
+				Expiration: time.Second,
+				Algorithm:  algorithm,
+				Storage:    middleware.CacheStorage(c),
+				Cache:      c,
+			})
+			app := fiber.New()
+			app.Use(handler)
+			app.Get("/test", func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusNoContent)
+			})
+			serve := app.Handler()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					var req fasthttp.Request
+					req.SetRequestURI("/test")
+					addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, byte(i%250)), Port: 1234}
+					var ctx fasthttp.RequestCtx
+					ctx.Init(&req, addr, nil)
+					serve(&ctx)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoggerApp(l *logger.Logger) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/logger/level", logger.GetLevelHandler(l))
+	app.Put("/admin/logger/level", logger.SetLevelHandler(l))
+	app.Get("/admin/logger/config", logger.GetConfigHandler(l))
+	return app
+}
+
+func putLevel(t *testing.T, app *fiber.App, level string) *http.Response {
+	req := httptest.NewRequest(http.MethodPut, "/admin/logger/level", strings.NewReader(`{"level":"`+level+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range logger.Levels {
+		level, err := logger.ParseLevel(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, level.String())
+	}
+
+	level, err := logger.ParseLevel(" warn ")
+	require.NoError(t, err)
+	assert.Equal(t, logger.WARN, level)
+
+	_, err = logger.ParseLevel("VERBOSE")
+	assert.Error(t, err)
+}
+
+func TestSetLevelAffectsSubsequentLogs(t *testing.T) {
+	var out bytes.Buffer
+	l := logger.NewLogger()
+	l.SetOutput(&out)
+	l.SetLevel(logger.INFO)
+	app := newLoggerApp(l)
+
+	l.Debug("hidden before change")
+	assert.NotContains(t, out.String(), "hidden before change")
+
+	resp := putLevel(t, app, "DEBUG")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body logger.LevelResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "DEBUG", body.Level)
+
+	l.Debug("visible after change")
+	assert.Contains(t, out.String(), "visible after change")
+
+	resp = putLevel(t, app, "error")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	out.Reset()
+	l.Warn("dropped warning")
+	l.Error("kept error")
+	assert.NotContains(t, out.String(), "dropped warning")
+	assert.Contains(t, out.String(), "kept error")
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/logger/level", nil))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "ERROR", body.Level)
+}
+
+func TestSetLevelRejectsUnknownLevel(t *testing.T) {
+	l := logger.NewLogger()
+	l.SetLevel(logger.INFO)
+	app := newLoggerApp(l)
+
+	resp := putLevel(t, app, "VERBOSE")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body apierrors.APIError
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, apierrors.ErrValidation.Code, body.Code)
+	assert.Equal(t, logger.INFO, l.Level())
+}
+
+func TestLoggerConfig(t *testing.T) {
+	l := logger.NewLogger()
+	l.SetLevel(logger.WARN)
+	l.SetJSONFormat(true)
+
+	resp, err := newLoggerApp(l).Test(httptest.NewRequest(http.MethodGet, "/admin/logger/config", nil))
+	require.NoError(t, err)
+
+	var config logger.Config
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&config))
+	assert.Equal(t, logger.Config{Level: "WARN", Format: "json", JSONEnabled: true, Output: "stdout"}, config)
+}
+
+// sampledLogger logs to out with sampling counts that don't reset during
+// the test
+func sampledLogger(t *testing.T, out *bytes.Buffer, config logger.SamplingConfig) *logger.Logger {
+	previous := logger.SamplingTick
+	logger.SamplingTick = time.Hour
+	t.Cleanup(func() { logger.SamplingTick = previous })
+
+	l := logger.NewLogger()
+	l.SetOutput(out)
+	l.SetLevel(logger.DEBUG)
+	l.SetSampling(config)
+	t.Cleanup(func() { l.Close(context.Background()) })
+	return l
+}
+
+func TestLoggerSampling(t *testing.T) {
+	var out bytes.Buffer
+	l := sampledLogger(t, &out, logger.SamplingConfig{Initial: 3, Thereafter: 5})
+
+	for i := 0; i < 20; i++ {
+		l.Debug("cache miss")
+		l.Info("request served")
+		l.Warn("slow query")
+	}
+	// The first 3, then the 8th, 13th and 18th
+	assert.Equal(t, 6, strings.Count(out.String(), "cache miss"))
+	assert.Equal(t, 6, strings.Count(out.String(), "request served"), "levels are counted separately")
+	assert.Equal(t, 20, strings.Count(out.String(), "slow query"), "WARN is never sampled")
+
+	out.Reset()
+	l.Info("another message")
+	assert.Contains(t, out.String(), "another message", "messages are counted separately")
+}
+
+func TestLoggerSampling_DropsAfterInitial(t *testing.T) {
+	var out bytes.Buffer
+	l := sampledLogger(t, &out, logger.SamplingConfig{Initial: 2})
+	for i := 0; i < 10; i++ {
+		l.Info("request served")
+		l.Error("request failed")
+	}
+	assert.Equal(t, 2, strings.Count(out.String(), "request served"))
+	assert.Equal(t, 10, strings.Count(out.String(), "request failed"))
+
+	l.SetSampling(logger.SamplingConfig{})
+	out.Reset()
+	for i := 0; i < 10; i++ {
+		l.Info("request served")
+	}
+	assert.Equal(t, 10, strings.Count(out.String(), "request served"), "a zero config turns sampling off")
+}
+
+func TestLoggerSampling_ResetsEveryTick(t *testing.T) {
+	previous := logger.SamplingTick
+	logger.SamplingTick = 20 * time.Millisecond
+	t.Cleanup(func() { logger.SamplingTick = previous })
+
+	var out bytes.Buffer
+	var mu sync.Mutex
+	l := logger.NewLogger()
+	l.SetOutput(&lockedWriter{mu: &mu, w: &out})
+	l.SetSampling(logger.SamplingConfig{Initial: 1})
+	t.Cleanup(func() { l.Close(context.Background()) })
+
+	l.Info("heartbeat")
+	l.Info("heartbeat")
+	require.Eventually(t, func() bool {
+		l.Info("heartbeat")
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Count(out.String(), "heartbeat") == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func TestSamplingConfigFromEnv(t *testing.T) {
+	t.Setenv("LOG_SAMPLING_INITIAL", "")
+	t.Setenv("LOG_SAMPLING_THEREAFTER", "")
+	config, err := logger.SamplingConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, logger.SamplingConfig{}, config)
+
+	t.Setenv("LOG_SAMPLING_INITIAL", "100")
+	t.Setenv("LOG_SAMPLING_THEREAFTER", "50")
+	config, err = logger.SamplingConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, logger.SamplingConfig{Initial: 100, Thereafter: 50}, config)
+
+	l := logger.NewLogger()
+	defer l.Close(context.Background())
+	assert.Equal(t, &logger.SamplingConfig{Initial: 100, Thereafter: 50}, l.Config().Sampling)
+
+	t.Setenv("LOG_SAMPLING_THEREAFTER", "-1")
+	_, err = logger.SamplingConfigFromEnv()
+	assert.Error(t, err)
+}
+
+// BenchmarkLoggerSampling logs the same INFO message 10,000 times per
+// iteration, a second of a busy endpoint, with and without the sampling
+// of LOG_SAMPLING_INITIAL=100 LOG_SAMPLING_THEREAFTER=100
+func BenchmarkLoggerSampling(b *testing.B) {
+	for _, bench := range []struct {
+		name     string
+		sampling logger.SamplingConfig
+	}{
+		{"Unsampled", logger.SamplingConfig{}},
+		{"Sampled", logger.SamplingConfig{Initial: 100, Thereafter: 100}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			previous := logger.SamplingTick
+			logger.SamplingTick = time.Hour
+			defer func() { logger.SamplingTick = previous }()
+
+			l := logger.NewLogger()
+			l.SetOutput(io.Discard)
+			l.SetSampling(bench.sampling)
+			defer l.Close(context.Background())
+			fields := map[string]interface{}{"path": "/books", "status": 200}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < 10000; j++ {
+					l.Info("request served", fields)
+				}
+			}
+		})
+	}
+}
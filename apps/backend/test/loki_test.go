@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+// fakeLoki records push requests
+type fakeLoki struct {
+	*httptest.Server
+	mu     sync.Mutex
+	pushes []lokiPush
+	paths  []string
+}
+
+func newFakeLoki(t *testing.T) *fakeLoki {
+	f := &fakeLoki{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var push lokiPush
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.pushes = append(f.pushes, push)
+		f.paths = append(f.paths, r.URL.Path)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeLoki) received() []lokiPush {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]lokiPush(nil), f.pushes...)
+}
+
+func TestLokiWriterPushesFullBatch(t *testing.T) {
+	loki := newFakeLoki(t)
+	t.Setenv("LOG_LOKI_ENABLED", "true")
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOKI_ENDPOINT", loki.URL)
+	t.Setenv("LOKI_BATCH_SIZE", "2")
+	t.Setenv("LOKI_FLUSH_INTERVAL_MS", "60000")
+
+	l := logger.NewLogger()
+	defer l.Close(context.Background())
+	assert.Equal(t, "stdout,loki", l.Config().Output)
+
+	before := time.Now().UnixNano()
+	l.Info("book created")
+	l.Error("database down")
+
+	require.Eventually(t, func() bool { return len(loki.received()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	push := loki.received()[0]
+	assert.Equal(t, "/loki/api/v1/push", loki.paths[0])
+
+	require.Len(t, push.Streams, 2)
+	byLevel := map[string][][2]string{}
+	for _, stream := range push.Streams {
+		assert.Equal(t, "gobooklibrary", stream.Stream["app"])
+		byLevel[stream.Stream["level"]] = stream.Values
+	}
+	require.Len(t, byLevel["INFO"], 1)
+	require.Len(t, byLevel["ERROR"], 1)
+	assert.Contains(t, byLevel["INFO"][0][1], "book created")
+	assert.Contains(t, byLevel["ERROR"][0][1], "database down")
+
+	ts, err := strconv.ParseInt(byLevel["INFO"][0][0], 10, 64)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, ts, before)
+}
+
+func TestLokiWriterFlushesOnInterval(t *testing.T) {
+	loki := newFakeLoki(t)
+	w := logger.NewLokiWriter(logger.LokiConfig{
+		Endpoint:      loki.URL + "/loki/api/v1/push",
+		BatchSize:     100,
+		FlushInterval: 50 * time.Millisecond,
+	})
+	defer w.Close(context.Background())
+
+	_, err := w.Write([]byte("[2024-01-01T00:00:00Z] WARN: slow query\n"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(loki.received()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	stream := loki.received()[0].Streams[0]
+	assert.Equal(t, "WARN", stream.Stream["level"])
+	assert.Equal(t, "[2024-01-01T00:00:00Z] WARN: slow query", stream.Values[0][1])
+	assert.Equal(t, "/loki/api/v1/push", loki.paths[0])
+}
+
+func TestLokiWriterFlushesOnClose(t *testing.T) {
+	loki := newFakeLoki(t)
+	w := logger.NewLokiWriter(logger.LokiConfig{Endpoint: loki.URL, BatchSize: 100, FlushInterval: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		w.Write([]byte(`{"level":"DEBUG","message":"queued"}`))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, w.Close(ctx))
+
+	pushes := loki.received()
+	require.Len(t, pushes, 1)
+	assert.Equal(t, "DEBUG", pushes[0].Streams[0].Stream["level"])
+	assert.Len(t, pushes[0].Streams[0].Values, 3)
+
+	_, err := w.Write([]byte("after close"))
+	assert.Error(t, err)
+}
+
+func TestLokiWriterCloseTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	w := logger.NewLokiWriter(logger.LokiConfig{Endpoint: server.URL, BatchSize: 1, FlushInterval: time.Hour})
+	w.Write([]byte("[ts] INFO: stuck"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, w.Close(ctx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
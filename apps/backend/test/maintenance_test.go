@@ -0,0 +1,144 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db/maintenance"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordMaintenanceSQL returns a handler whose Exec records statements in
+// place of running them, and the executed statements. Statements fail with
+// execErr.
+func recordMaintenanceSQL(execErr error) (*maintenance.Handler, func() []string) {
+	var mu sync.Mutex
+	var statements []string
+
+	h := maintenance.NewHandler(nil, newMemoryCache(), nil)
+	h.Exec = func(ctx context.Context, sql string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		statements = append(statements, sql)
+		return execErr
+	}
+
+	return h, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, statements...)
+	}
+}
+
+func newMaintenanceApp(h *maintenance.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/admin/db/analyze", h.Analyze)
+	app.Post("/admin/db/vacuum", h.Vacuum)
+	app.Get("/admin/db/jobs/:id", h.GetJob)
+	return app
+}
+
+func startMaintenanceJob(t *testing.T, app *fiber.App, req *http.Request) maintenance.Job {
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var job maintenance.Job
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, maintenance.StatusRunning, job.Status)
+	return job
+}
+
+func waitForJob(t *testing.T, app *fiber.App, id string) maintenance.Job {
+	var job maintenance.Job
+	require.Eventually(t, func() bool {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/db/jobs/"+id, nil))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+		return job.Status != maintenance.StatusRunning
+	}, time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestMaintenanceSQL(t *testing.T) {
+	assert.Equal(t, "ANALYZE books, users", maintenance.AnalyzeSQL("books", "users"))
+	assert.Equal(t, "VACUUM ANALYZE books", maintenance.VacuumSQL("books", false))
+	assert.Equal(t, "VACUUM FULL ANALYZE books", maintenance.VacuumSQL("books", true))
+}
+
+func TestAnalyzeHandlerRunsInBackground(t *testing.T) {
+	h, executed := recordMaintenanceSQL(nil)
+	app := newMaintenanceApp(h)
+
+	job := startMaintenanceJob(t, app, httptest.NewRequest(http.MethodPost, "/admin/db/analyze", nil))
+	assert.Equal(t, "ANALYZE books, users", job.SQL)
+
+	done := waitForJob(t, app, job.ID)
+	assert.Equal(t, maintenance.StatusSucceeded, done.Status)
+	assert.NotNil(t, done.FinishedAt)
+	assert.Equal(t, []string{"ANALYZE books, users"}, executed())
+}
+
+func TestVacuumHandler(t *testing.T) {
+	h, executed := recordMaintenanceSQL(nil)
+	app := newMaintenanceApp(h)
+
+	job := startMaintenanceJob(t, app, httptest.NewRequest(http.MethodPost, "/admin/db/vacuum?full=false", nil))
+	waitForJob(t, app, job.ID)
+	assert.Equal(t, []string{"VACUUM ANALYZE books"}, executed())
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/db/vacuum?full=true", nil)
+	req.Header.Set(maintenance.ConfirmFullVacuumHeader, "true")
+	job = startMaintenanceJob(t, app, req)
+	waitForJob(t, app, job.ID)
+	assert.Equal(t, []string{"VACUUM ANALYZE books", "VACUUM FULL ANALYZE books"}, executed())
+}
+
+func TestVacuumFullRequiresConfirmation(t *testing.T) {
+	h, executed := recordMaintenanceSQL(nil)
+	app := newMaintenanceApp(h)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/admin/db/vacuum?full=true", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	var apiErr apierrors.APIError
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&apiErr))
+	assert.Equal(t, "CONFIRMATION_REQUIRED", apiErr.Code)
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/admin/db/vacuum?full=maybe", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, executed())
+}
+
+func TestMaintenanceJobRecordsFailure(t *testing.T) {
+	h, _ := recordMaintenanceSQL(errors.New("canceling statement due to lock timeout"))
+	app := newMaintenanceApp(h)
+
+	job := startMaintenanceJob(t, app, httptest.NewRequest(http.MethodPost, "/admin/db/analyze", nil))
+	done := waitForJob(t, app, job.ID)
+	assert.Equal(t, maintenance.StatusFailed, done.Status)
+	assert.Contains(t, done.Error, "lock timeout")
+}
+
+func TestGetJobHandlerNotFound(t *testing.T) {
+	h, _ := recordMaintenanceSQL(nil)
+	app := newMaintenanceApp(h)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/db/jobs/unknown", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
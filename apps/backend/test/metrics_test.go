@@ -0,0 +1,121 @@
+package test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// histogramBuckets returns the upper bounds of the named histogram
+func histogramBuckets(t *testing.T, name string) []float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		require.NotEmpty(t, family.GetMetric())
+		var bounds []float64
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			bounds = append(bounds, bucket.GetUpperBound())
+		}
+		return bounds
+	}
+	t.Fatalf("%s not registered", name)
+	return nil
+}
+
+func TestInitMetrics_CustomBuckets(t *testing.T) {
+	// Runs after t.Setenv restores the environment
+	t.Cleanup(func() { metrics.InitMetrics() })
+	t.Setenv("METRICS_HTTP_BUCKETS", "0.001, 0.005,0.01,0.025,0.05,0.1,0.25,0.5,1.0")
+	require.NoError(t, metrics.InitMetrics())
+
+	metrics.RecordHTTPRequest("GET", "/books", "200", "unknown", 0)
+	metrics.RecordDatabaseQuery("select", "books", "success", 0)
+	want := []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0}
+	assert.Equal(t, want, histogramBuckets(t, "http_request_duration_seconds"))
+	assert.Equal(t, want, histogramBuckets(t, "database_operation_duration_seconds"))
+}
+
+func TestInitMetrics_InvalidBucketsKeepDefaults(t *testing.T) {
+	t.Cleanup(func() { metrics.InitMetrics() })
+	t.Setenv("METRICS_HTTP_BUCKETS", "0.1,0.05,1")
+	assert.Error(t, metrics.InitMetrics())
+
+	metrics.RecordHTTPRequest("GET", "/books", "200", "unknown", 0)
+	metrics.RecordDatabaseQuery("select", "books", "success", 0)
+	assert.Equal(t, prometheus.DefBuckets, histogramBuckets(t, "http_request_duration_seconds"))
+	assert.Equal(t, metrics.DefaultDatabaseBuckets, histogramBuckets(t, "database_operation_duration_seconds"))
+}
+
+func TestParseBuckets(t *testing.T) {
+	buckets, err := metrics.ParseBuckets("0.01,0.1,1")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.01, 0.1, 1}, buckets)
+
+	for _, raw := range []string{"0.1,1", "0.1,0.1,1", "1,0.5,2", "0.1,fast,1", "0.1,1,NaN", "0.1,1,+Inf"} {
+		_, err := metrics.ParseBuckets(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+// gaugeValue returns the value of the named unlabelled gauge
+func gaugeValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			require.NotEmpty(t, family.GetMetric())
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("%s not registered", name)
+	return 0
+}
+
+func postReset(t *testing.T, app *fiber.App, body string) int {
+	req := httptest.NewRequest("POST", "/admin/metrics/reset", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestResetHandler(t *testing.T) {
+	collector := metrics.NewMetricsCollector()
+	resets := 0
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/admin/metrics/reset", metrics.ResetHandler(collector, func(*fiber.Ctx) { resets++ }))
+
+	metrics.RecordCacheOperation("get", "hit")
+	metrics.RecordCacheOperation("get", "miss")
+	metrics.RecordSLO("GET /books", time.Second)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.Equal(t, 428, postReset(t, app, `{}`))
+	assert.Equal(t, 428, postReset(t, app, `{"confirm":false}`))
+	assert.Equal(t, 400, postReset(t, app, `not json`))
+	assert.Zero(t, resets)
+	assert.NotZero(t, metrics.GetCacheMetrics().Total, "unconfirmed requests reset nothing")
+
+	before := time.Now().Unix()
+	require.Equal(t, 200, postReset(t, app, `{"confirm":true}`))
+	assert.Equal(t, 1, resets)
+
+	assert.Equal(t, &metrics.CacheMetrics{}, metrics.GetCacheMetrics())
+	for _, budget := range metrics.SLO.Budgets() {
+		assert.Zero(t, budget.Total, budget.Endpoint)
+		assert.Zero(t, budget.Slow, budget.Endpoint)
+	}
+	assert.Less(t, collector.GetUptime(), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, gaugeValue(t, "metrics_last_reset_timestamp_unix"), float64(before))
+}
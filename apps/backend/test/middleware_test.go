@@ -1,12 +1,21 @@
 package test
 
 import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
 	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
 	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -134,6 +143,274 @@ func TestSecurityMiddleware(t *testing.T) {
 	assert.Equal(t, "no-referrer", resp.Header.Get("Referrer-Policy"))
 }
 
+func TestJWTOptionalMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Get("/test", middleware.JWTOptional(), func(c *fiber.Ctx) error {
+		userID, ok := middleware.UserID(c)
+		return c.JSON(fiber.Map{"user_id": userID, "authenticated": ok})
+	})
+
+	token, err := auth.GenerateJWT(&auth.User{ID: 42, Username: "reader", Role: "user"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		header        string
+		authenticated bool
+		userID        float64
+	}{
+		{name: "No header", header: ""},
+		{name: "Valid token", header: "Bearer " + token, authenticated: true, userID: 42},
+		{name: "Invalid token", header: "Bearer not-a-token"},
+		{name: "Wrong scheme", header: "Basic " + token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var body map[string]interface{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tt.authenticated, body["authenticated"])
+			assert.Equal(t, tt.userID, body["user_id"])
+		})
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(middleware.CSRF(middleware.CSRFConfig{
+		ExemptPaths: []string{"POST /auth/login"},
+	}))
+
+	app.Get("/form", func(c *fiber.Ctx) error {
+		return c.SendString("form")
+	})
+	app.Post("/books", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusCreated)
+	})
+	app.Post("/auth/login", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	// A safe request issues the token cookie
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/form", nil))
+	require.NoError(t, err)
+	var token string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "csrf_token" {
+			token = cookie.Value
+		}
+	}
+	require.Len(t, token, 64)
+
+	tests := []struct {
+		name           string
+		path           string
+		cookie         string
+		header         string
+		expectedStatus int
+	}{
+		{name: "Matching token", path: "/books", cookie: token, header: token, expectedStatus: http.StatusCreated},
+		{name: "Mismatched token", path: "/books", cookie: token, header: "forged", expectedStatus: http.StatusForbidden},
+		{name: "Missing header", path: "/books", cookie: token, expectedStatus: http.StatusForbidden},
+		{name: "Missing cookie", path: "/books", header: token, expectedStatus: http.StatusForbidden},
+		{name: "Exempt path", path: "/auth/login", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-CSRF-Token", tt.header)
+			}
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestCSRFMiddleware_RedisStore(t *testing.T) {
+	store := cache.NewRedisCache("localhost:6379", "", 1)
+	defer store.Close()
+	if err := store.Ping(); err != nil {
+		t.Skip("Redis not available, skipping test")
+	}
+
+	csrf := middleware.NewCSRF(middleware.CSRFConfig{Store: store})
+	app := fiber.New()
+	app.Use(csrf.Handler())
+	app.Get("/token", func(c *fiber.Ctx) error {
+		return c.SendString(csrf.GenerateToken(c))
+	})
+	app.Post("/books", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusCreated)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/token", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	issued := string(body)
+
+	post := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/books", nil)
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusCreated, post(issued))
+	// Matching but never issued, e.g. a cookie planted by an attacker
+	assert.Equal(t, http.StatusForbidden, post("attacker-chosen-value"))
+}
+
+func TestSanitizeMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(middleware.Sanitize())
+	app.Post("/books", func(c *fiber.Ctx) error {
+		var b book.Book
+		if err := c.BodyParser(&b); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		return c.JSON(b)
+	})
+	app.Post("/auth/register", func(c *fiber.Ctx) error {
+		var req auth.RegisterRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		return c.JSON(req)
+	})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedTitle  string
+		expectedAuthor string
+	}{
+		{
+			name:           "Script tag",
+			body:           `{"title":"<script>alert(1)</script>Dune","author":"Frank Herbert","year":1965}`,
+			expectedTitle:  "Dune",
+			expectedAuthor: "Frank Herbert",
+		},
+		{
+			name:           "Event handler attribute",
+			body:           `{"title":"<img src=x onerror=alert(1)>Emma","author":"<b>Jane</b> Austen","year":1815}`,
+			expectedTitle:  "Emma",
+			expectedAuthor: "Jane Austen",
+		},
+		{
+			name:           "Entity encoded tag",
+			body:           `{"title":"&lt;script&gt;alert(1)&lt;/script&gt;Ulysses","author":"James Joyce","year":1922}`,
+			expectedTitle:  "Ulysses",
+			expectedAuthor: "James Joyce",
+		},
+		{
+			name:           "Ampersand is kept",
+			body:           `{"title":"Pride & Prejudice","author":"Jane Austen","year":1813}`,
+			expectedTitle:  "Pride & Prejudice",
+			expectedAuthor: "Jane Austen",
+		},
+		{
+			name:           "NULL bytes and control characters",
+			body:           `{"title":"Moby\u0000 Dick\u0007","author":"Herman\u001bMelville","year":1851}`,
+			expectedTitle:  "Moby Dick",
+			expectedAuthor: "HermanMelville",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var b book.Book
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&b))
+			assert.Equal(t, tt.expectedTitle, b.Title)
+			assert.Equal(t, tt.expectedAuthor, b.Author)
+		})
+	}
+
+	t.Run("Password is left alone", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{"username":"<b>bob</b>","password":"p<a>ss&word"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		var body auth.RegisterRequest
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "bob", body.Username)
+		assert.Equal(t, "p<a>ss&word", body.Password)
+	})
+
+	t.Run("Malformed JSON reaches the handler", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader("invalid json"))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+// entityEncode HTML-escapes s the given number of times
+func entityEncode(s string, times int) string {
+	for i := 0; i < times; i++ {
+		s = html.EscapeString(s)
+	}
+	return s
+}
+
+func TestSanitizeString_NestedEncoding(t *testing.T) {
+	payload := "<script>alert(1)</script>"
+
+	assert.Equal(t, "Dune", middleware.SanitizeString(entityEncode(payload, 3)+"Dune"))
+	for times := 4; times <= 8; times++ {
+		clean := middleware.SanitizeString(entityEncode(payload, times))
+		assert.NotContains(t, clean, "<", "encoded %d times", times)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Use(middleware.Sanitize())
+	app.Post("/books", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	body, err := json.Marshal(map[string]string{"title": entityEncode(payload, 5)})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/books", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	b := book.Book{Title: entityEncode(payload, 5)}
+	assert.ErrorIs(t, middleware.SanitizeStruct(&b), middleware.ErrTooDeeplyEncoded)
+}
+
+func TestSanitizeStruct(t *testing.T) {
+	b := book.Book{Title: "<i>Dracula</i>\x00", Author: "Bram <script>x</script>Stoker", Year: 1897}
+	require.NoError(t, middleware.SanitizeStruct(&b))
+	assert.Equal(t, "Dracula", b.Title)
+	assert.Equal(t, "Bram Stoker", b.Author)
+	assert.Equal(t, 1897, b.Year)
+}
+
 func TestCompressionMiddleware(t *testing.T) {
 	app := fiber.New()
 	app.Use(middleware.Compression())
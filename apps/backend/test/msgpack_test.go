@@ -0,0 +1,162 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleBooks(n int) []book.Book {
+	authorID := uint(7)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	books := make([]book.Book, n)
+	for i := range books {
+		books[i] = book.Book{
+			ID:        uint(i + 1),
+			Title:     fmt.Sprintf("The Book of Things, Volume %d", i+1),
+			Author:    "Jane Doe",
+			AuthorID:  &authorID,
+			Year:      1990 + i%30,
+			Genre:     "Fantasy",
+			ISBN:      "978-0-306-40615-7",
+			ViewCount: int64(i * 13),
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Duration(i) * time.Hour),
+		}
+	}
+	return books
+}
+
+func TestMsgpackRoundTripBook(t *testing.T) {
+	want := sampleBooks(1)[0]
+
+	data, err := cache.MarshalMP(want)
+	require.NoError(t, err)
+
+	var got book.Book
+	require.NoError(t, cache.UnmarshalMP(data, &got))
+	assert.Equal(t, want.Title, got.Title)
+	assert.Equal(t, *want.AuthorID, *got.AuthorID)
+	assert.Equal(t, want.ViewCount, got.ViewCount)
+	assert.True(t, want.CreatedAt.Equal(got.CreatedAt))
+	assert.Nil(t, got.Series)
+}
+
+func TestMsgpackRoundTripBookList(t *testing.T) {
+	want := sampleBooks(50)
+
+	data, err := cache.MarshalMP(want)
+	require.NoError(t, err)
+
+	var got []book.Book
+	require.NoError(t, cache.UnmarshalMP(data, &got))
+	require.Len(t, got, len(want))
+	for i := range want {
+		assert.Equal(t, want[i].ID, got[i].ID)
+		assert.Equal(t, want[i].Title, got[i].Title)
+		assert.True(t, want[i].UpdatedAt.Equal(got[i].UpdatedAt))
+	}
+}
+
+func TestMsgpackSmallerThanJSON(t *testing.T) {
+	books := sampleBooks(1000)
+
+	jsonData, err := json.Marshal(books)
+	require.NoError(t, err)
+	mpData, err := cache.MarshalMP(books)
+	require.NoError(t, err)
+
+	saving := 1 - float64(len(mpData))/float64(len(jsonData))
+	t.Logf("1000 books: JSON %d bytes, MessagePack %d bytes (%.0f%% smaller)", len(jsonData), len(mpData), saving*100)
+	assert.Greater(t, saving, 0.2)
+}
+
+func TestMsgpackCacheSetGet(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewMsgpackCache(cache.NewRedisCacheWithClient(client))
+
+	want := sampleBooks(1)[0]
+	data, err := cache.MarshalMP(want)
+	require.NoError(t, err)
+
+	mock.ExpectSet("book:1", data, time.Minute).SetVal("OK")
+	mock.ExpectGet("book:1").SetVal(string(data))
+
+	require.NoError(t, c.Set("book:1", want, time.Minute))
+	var got book.Book
+	require.NoError(t, c.Get("book:1", &got))
+	assert.Equal(t, want.Title, got.Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMPReadsJSONValues(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	jsonData, err := json.Marshal(sampleBooks(2))
+	require.NoError(t, err)
+	mock.ExpectGet("books:all").SetVal(string(jsonData))
+	mock.ExpectGet("count").SetVal("5")
+	mock.ExpectGet("missing").RedisNil()
+
+	var books []book.Book
+	require.NoError(t, c.GetMP("books:all", &books))
+	require.Len(t, books, 2)
+	assert.Equal(t, "The Book of Things, Volume 2", books[1].Title)
+
+	var count int
+	require.NoError(t, c.GetMP("count", &count))
+	assert.Equal(t, 5, count)
+
+	assert.Error(t, c.GetMP("missing", &count))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func BenchmarkCacheEncodeJSON(b *testing.B) {
+	books := sampleBooks(1000)
+	b.ReportAllocs()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, _ := json.Marshal(books)
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "encoded-bytes")
+}
+
+func BenchmarkCacheEncodeMsgpack(b *testing.B) {
+	books := sampleBooks(1000)
+	b.ReportAllocs()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, _ := cache.MarshalMP(books)
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "encoded-bytes")
+}
+
+func BenchmarkCacheDecodeJSON(b *testing.B) {
+	data, _ := json.Marshal(sampleBooks(1000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var books []book.Book
+		_ = json.Unmarshal(data, &books)
+	}
+}
+
+func BenchmarkCacheDecodeMsgpack(b *testing.B) {
+	data, _ := cache.MarshalMP(sampleBooks(1000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var books []book.Book
+		_ = cache.UnmarshalMP(data, &books)
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func negotiationApp() *fiber.App {
+	authorID := uint(3)
+	books := []book.Book{
+		{ID: 1, Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965, Genre: "Science Fiction", Status: book.StatusAvailable, CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{ID: 2, Title: "Emma & Co <1>", Author: "Jane Austen", Year: 1815, Status: book.StatusCheckedOut},
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Use(middleware.ContentNegotiation())
+	app.Get("/books", func(c *fiber.Ctx) error {
+		return c.JSON(books)
+	})
+	app.Get("/books/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") != "1" {
+			return apierrors.ErrBookNotFound
+		}
+		return c.JSON(books[0])
+	})
+	app.Get("/text", func(c *fiber.Ctx) error {
+		return c.SendString("plain")
+	})
+	return app
+}
+
+func negotiate(t *testing.T, app *fiber.App, path, accept string) (*http.Response, []byte) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func TestContentNegotiation_BooksAsXML(t *testing.T) {
+	resp, body := negotiate(t, negotiationApp(), "/books", "application/xml")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fiber.MIMEApplicationXMLCharsetUTF8, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "<books><book><id>1</id><title>Dune</title>")
+
+	// The elements match the xml tags of Book
+	var list struct {
+		XMLName xml.Name    `xml:"books"`
+		Books   []book.Book `xml:"book"`
+	}
+	require.NoError(t, xml.Unmarshal(body, &list))
+	require.Len(t, list.Books, 2)
+	assert.Equal(t, "Dune", list.Books[0].Title)
+	assert.Equal(t, uint(3), *list.Books[0].AuthorID)
+	assert.Equal(t, 1965, list.Books[0].Year)
+	assert.True(t, list.Books[0].CreatedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.Equal(t, "Emma & Co <1>", list.Books[1].Title, "text is escaped")
+	assert.Equal(t, book.StatusCheckedOut, list.Books[1].Status)
+	assert.Nil(t, list.Books[1].AuthorID)
+}
+
+func TestContentNegotiation_SingleBookAndErrors(t *testing.T) {
+	app := negotiationApp()
+
+	resp, body := negotiate(t, app, "/books/1", "text/xml")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var single struct {
+		XMLName xml.Name `xml:"book"`
+		book.Book
+	}
+	require.NoError(t, xml.Unmarshal(body, &single))
+	assert.Equal(t, "Dune", single.Title)
+
+	resp, body = negotiate(t, app, "/books/2", "application/xml")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	var apiErr struct {
+		XMLName xml.Name `xml:"error"`
+		Code    string   `xml:"code"`
+	}
+	require.NoError(t, xml.Unmarshal(body, &apiErr))
+	assert.Equal(t, "BOOK_NOT_FOUND", apiErr.Code)
+}
+
+func TestContentNegotiation_DefaultsToJSON(t *testing.T) {
+	app := negotiationApp()
+	for _, accept := range []string{"", "*/*", "application/json", "application/json, application/xml;q=0.5"} {
+		resp, body := negotiate(t, app, "/books", accept)
+		require.Equal(t, http.StatusOK, resp.StatusCode, accept)
+		assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get("Content-Type"), accept)
+		assert.Equal(t, byte('['), body[0], accept)
+	}
+
+	// Non-JSON responses are left alone
+	resp, body := negotiate(t, app, "/text", "application/xml")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "plain", string(body))
+}
+
+func TestContentNegotiation_RejectsUnsupportedFormats(t *testing.T) {
+	resp, _ := negotiate(t, negotiationApp(), "/books", "text/csv")
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+}
+
+func TestJSONToXML_NamesElements(t *testing.T) {
+	out, err := middleware.JSONToXML([]byte(`{"books":[{"id":1}],"facets":{"genre":[{"value":"Fiction","count":2}]},"total":null,"2fa":true}`), "response")
+	require.NoError(t, err)
+	assert.Equal(t, xml.Header+
+		"<response><books><book><id>1</id></book></books>"+
+		"<facets><genre><item><value>Fiction</value><count>2</count></item></genre></facets>"+
+		"<total></total><_fa>true</_fa></response>", string(out))
+
+	_, err = middleware.JSONToXML([]byte(`{"broken":`), "response")
+	assert.Error(t, err)
+}
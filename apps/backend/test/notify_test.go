@@ -0,0 +1,67 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyBookChanges turns on book.NotifyChanges for the rest of the test
+func notifyBookChanges(t *testing.T) {
+	book.NotifyChanges = true
+	t.Cleanup(func() { book.NotifyChanges = false })
+}
+
+func TestBookWrites_NotifyInsideTheTransaction(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	notifyBookChanges(t)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "books"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).WithArgs("book_changes", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	authorID := uint(1)
+	require.NoError(t, store.CreateBook(context.Background(), &book.Book{Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "books" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).WithArgs("book_changes", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, store.DeleteBook(context.Background(), 7))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBookWrites_DontNotifyByDefault(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "books" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, store.DeleteBook(context.Background(), 7))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleChangeNotification_DropsCachedBook(t *testing.T) {
+	c := newMemoryCache()
+	h := book.NewBookHandler(newFakeBookStore(), c, nil, nil)
+	for _, key := range []string{"book:7", "book:8", "books:all", "facets:genre:"} {
+		require.NoError(t, c.Set(key, 1, time.Minute))
+	}
+
+	h.HandleChangeNotification("7")
+	assert.ElementsMatch(t, []string{"book:8"}, c.keys())
+
+	h.HandleChangeNotification("not-an-id")
+	assert.ElementsMatch(t, []string{"book:8"}, c.keys())
+}
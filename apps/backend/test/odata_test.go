@@ -0,0 +1,233 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/odata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestODataParseFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		filter        string
+		expectedWhere string
+		expectedArgs  []interface{}
+		expectedError string
+	}{
+		{
+			name:          "Equality on string",
+			filter:        "genre eq 'Fiction'",
+			expectedWhere: "genre = ?",
+			expectedArgs:  []interface{}{"Fiction"},
+		},
+		{
+			name:          "Not equal",
+			filter:        "author ne 'George Orwell'",
+			expectedWhere: "author <> ?",
+			expectedArgs:  []interface{}{"George Orwell"},
+		},
+		{
+			name:          "Greater than",
+			filter:        "year gt 1950",
+			expectedWhere: "year > ?",
+			expectedArgs:  []interface{}{int64(1950)},
+		},
+		{
+			name:          "Greater or equal",
+			filter:        "year ge 2000",
+			expectedWhere: "year >= ?",
+			expectedArgs:  []interface{}{int64(2000)},
+		},
+		{
+			name:          "Less than",
+			filter:        "year lt 1900",
+			expectedWhere: "year < ?",
+			expectedArgs:  []interface{}{int64(1900)},
+		},
+		{
+			name:          "Less or equal",
+			filter:        "id le 10",
+			expectedWhere: "id <= ?",
+			expectedArgs:  []interface{}{int64(10)},
+		},
+		{
+			name:          "And combination",
+			filter:        "year ge 2000 and genre eq 'Fiction'",
+			expectedWhere: "year >= ? AND genre = ?",
+			expectedArgs:  []interface{}{int64(2000), "Fiction"},
+		},
+		{
+			name:          "Or combination",
+			filter:        "genre eq 'Fiction' or genre eq 'Romance'",
+			expectedWhere: "genre = ? OR genre = ?",
+			expectedArgs:  []interface{}{"Fiction", "Romance"},
+		},
+		{
+			name:          "And binds tighter than or",
+			filter:        "year lt 1900 or year gt 2000 and genre eq 'Fiction'",
+			expectedWhere: "year < ? OR year > ? AND genre = ?",
+			expectedArgs:  []interface{}{int64(1900), int64(2000), "Fiction"},
+		},
+		{
+			name:          "Parentheses",
+			filter:        "(year lt 1900 or year gt 2000) and genre eq 'Fiction'",
+			expectedWhere: "(year < ? OR year > ?) AND genre = ?",
+			expectedArgs:  []interface{}{int64(1900), int64(2000), "Fiction"},
+		},
+		{
+			name:          "Escaped quote in string",
+			filter:        "title eq 'Swann''s Way'",
+			expectedWhere: "title = ?",
+			expectedArgs:  []interface{}{"Swann's Way"},
+		},
+		{
+			name:          "Case insensitive keywords",
+			filter:        "year GE 2000 AND genre EQ 'Fiction'",
+			expectedWhere: "year >= ? AND genre = ?",
+			expectedArgs:  []interface{}{int64(2000), "Fiction"},
+		},
+		{
+			name:          "Null comparison",
+			filter:        "isbn eq null",
+			expectedWhere: "isbn IS NULL",
+		},
+		{
+			name:          "Not null comparison",
+			filter:        "isbn ne null",
+			expectedWhere: "isbn IS NOT NULL",
+		},
+		{
+			name:          "Unsupported operator",
+			filter:        "title has 'Go'",
+			expectedError: `unsupported operator "has"`,
+		},
+		{
+			name:          "Unsupported function",
+			filter:        "contains(title)",
+			expectedError: `unknown field "contains"`,
+		},
+		{
+			name:          "Unknown field",
+			filter:        "password eq 'secret'",
+			expectedError: `unknown field "password"`,
+		},
+		{
+			name:          "Missing value",
+			filter:        "year ge",
+			expectedError: "expected literal value",
+		},
+		{
+			name:          "Unterminated string",
+			filter:        "title eq 'Dune",
+			expectedError: "unterminated string",
+		},
+		{
+			name:          "Missing closing parenthesis",
+			filter:        "(year gt 2000",
+			expectedError: "expected ')'",
+		},
+		{
+			name:          "Dangling and",
+			filter:        "year gt 2000 and",
+			expectedError: "unexpected end of expression",
+		},
+		{
+			name:          "Trailing garbage",
+			filter:        "year gt 2000 genre",
+			expectedError: `unexpected "genre"`,
+		},
+		{
+			name:          "Null with ordering operator",
+			filter:        "year gt null",
+			expectedError: "null can only be compared with eq or ne",
+		},
+		{
+			name:          "Invalid character",
+			filter:        "year > 2000",
+			expectedError: "unexpected character",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := odata.Parse(odata.Options{Filter: tt.filter}, book.ODataFields)
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			where, args := query.Where()
+			assert.Equal(t, tt.expectedWhere, where)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestODataParseOrderByAndPaging(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          odata.Options
+		expectedOrder []string
+		expectedError string
+	}{
+		{
+			name:          "Default direction",
+			opts:          odata.Options{OrderBy: "title"},
+			expectedOrder: []string{"title ASC"},
+		},
+		{
+			name:          "Multiple clauses",
+			opts:          odata.Options{OrderBy: "year desc, title asc"},
+			expectedOrder: []string{"year DESC", "title ASC"},
+		},
+		{
+			name:          "Unknown orderby field",
+			opts:          odata.Options{OrderBy: "rating desc"},
+			expectedError: `unknown field "rating"`,
+		},
+		{
+			name:          "Unknown direction",
+			opts:          odata.Options{OrderBy: "title sideways"},
+			expectedError: `unknown direction "sideways"`,
+		},
+		{
+			name:          "Top and skip",
+			opts:          odata.Options{Top: "10", Skip: "20"},
+			expectedOrder: nil,
+		},
+		{
+			name:          "Negative top",
+			opts:          odata.Options{Top: "-1"},
+			expectedError: "$top: must be a non-negative integer",
+		},
+		{
+			name:          "Top too large",
+			opts:          odata.Options{Top: "5000"},
+			expectedError: "$top: must not exceed",
+		},
+		{
+			name:          "Non numeric skip",
+			opts:          odata.Options{Skip: "abc"},
+			expectedError: "$skip: must be a non-negative integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := odata.Parse(tt.opts, book.ODataFields)
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOrder, query.OrderBy())
+		})
+	}
+}
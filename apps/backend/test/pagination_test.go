@@ -0,0 +1,80 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func paginatedApp(total int64) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.ExposeHeaders())
+	app.Use(cors.New(cors.Config{ExposeHeaders: "traceparent"}))
+	app.Get("/items", func(c *fiber.Ctx) error {
+		page := c.QueryInt("page", 1)
+		limit := c.QueryInt("limit", 20)
+		middleware.SetPagination(c, page, limit, total)
+		return c.JSON(fiber.Map{"total": total})
+	})
+	return app
+}
+
+func getPage(t *testing.T, app *fiber.App, target string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestSetPagination_MiddlePage(t *testing.T) {
+	resp := getPage(t, paginatedApp(45), "/items?page=2&limit=20&search=go")
+
+	assert.Equal(t, "45", resp.Header.Get("X-Total-Count"))
+	assert.Equal(t, "2", resp.Header.Get("X-Page"))
+	assert.Equal(t, "20", resp.Header.Get("X-Limit"))
+	assert.Equal(t, "3", resp.Header.Get("X-Pages"))
+	assert.Equal(t,
+		`</items?limit=20&page=1&search=go>; rel="first", `+
+			`</items?limit=20&page=1&search=go>; rel="prev", `+
+			`</items?limit=20&page=3&search=go>; rel="next", `+
+			`</items?limit=20&page=3&search=go>; rel="last"`,
+		resp.Header.Get("Link"))
+}
+
+func TestSetPagination_Edges(t *testing.T) {
+	first := getPage(t, paginatedApp(45), "/items")
+	assert.Equal(t, "1", first.Header.Get("X-Page"))
+	assert.NotContains(t, first.Header.Get("Link"), `rel="prev"`)
+	assert.Contains(t, first.Header.Get("Link"), `</items?limit=20&page=2>; rel="next"`)
+
+	last := getPage(t, paginatedApp(45), "/items?page=3")
+	assert.NotContains(t, last.Header.Get("Link"), `rel="next"`)
+	assert.Contains(t, last.Header.Get("Link"), `rel="prev"`)
+
+	empty := getPage(t, paginatedApp(0), "/items")
+	assert.Equal(t, "0", empty.Header.Get("X-Total-Count"))
+	assert.Equal(t, "0", empty.Header.Get("X-Pages"))
+	assert.Empty(t, empty.Header.Get("Link"))
+}
+
+func TestExposeHeaders(t *testing.T) {
+	resp := getPage(t, paginatedApp(1), "/items")
+	exposed := resp.Header.Get("Access-Control-Expose-Headers")
+	assert.Contains(t, exposed, "traceparent", "keeps the headers CORS exposes")
+	for _, header := range middleware.PaginationHeaders {
+		assert.Contains(t, exposed, header)
+	}
+
+	// Same-origin requests need no CORS headers
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	sameOrigin, err := paginatedApp(1).Test(req)
+	require.NoError(t, err)
+	assert.Empty(t, sameOrigin.Header.Get("Access-Control-Expose-Headers"))
+}
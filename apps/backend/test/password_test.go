@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseBcryptCost(t *testing.T) {
+	cost, err := auth.ParseBcryptCost("12")
+	require.NoError(t, err)
+	assert.Equal(t, 12, cost)
+
+	for _, raw := range []string{"", "twelve", "3", "32"} {
+		_, err := auth.ParseBcryptCost(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestHashPasswordUsesConfiguredCost(t *testing.T) {
+	previous := auth.BcryptCost
+	auth.BcryptCost = bcrypt.MinCost + 1
+	defer func() { auth.BcryptCost = previous }()
+
+	hash, err := auth.HashPassword("secret123")
+	require.NoError(t, err)
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	require.NoError(t, err)
+	assert.Equal(t, auth.BcryptCost, cost)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret123")))
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	previous := auth.BcryptCost
+	auth.BcryptCost = bcrypt.MinCost + 1
+	defer func() { auth.BcryptCost = previous }()
+
+	weak, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	current, err := bcrypt.GenerateFromPassword([]byte("secret123"), auth.BcryptCost)
+	require.NoError(t, err)
+
+	assert.True(t, auth.PasswordNeedsRehash(string(weak)))
+	assert.False(t, auth.PasswordNeedsRehash(string(current)))
+	assert.False(t, auth.PasswordNeedsRehash(""), "anonymized users have no hash")
+}
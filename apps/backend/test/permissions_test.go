@@ -0,0 +1,87 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenPermissions returns the permissions claim of a token for user
+func tokenPermissions(t *testing.T, user *auth.User) []string {
+	signed, err := auth.GenerateJWT(user)
+	require.NoError(t, err)
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(signed, claims)
+	require.NoError(t, err)
+
+	var permissions []string
+	for _, p := range claims["permissions"].([]interface{}) {
+		permissions = append(permissions, p.(string))
+	}
+	return permissions
+}
+
+func TestJWT_CarriesRolePermissions(t *testing.T) {
+	admin := tokenPermissions(t, &auth.User{ID: 1, Username: "admin", Role: "admin"})
+	user := tokenPermissions(t, &auth.User{ID: 7, Username: "reader", Role: "user"})
+
+	for _, permissions := range auth.RolePermissions {
+		assert.Subset(t, admin, permissions, "admins hold every permission")
+	}
+	assert.Subset(t, admin, user)
+	assert.Less(t, len(user), len(admin))
+	assert.Contains(t, user, auth.PermBooksRead)
+	assert.NotContains(t, user, auth.PermBooksDelete)
+
+	assert.Empty(t, tokenPermissions(t, &auth.User{ID: 8, Username: "ghost", Role: "unknown"}))
+}
+
+func newPermissionApp(inject bool) *fiber.App {
+	app := fiber.New()
+	handlers := []fiber.Handler{middleware.JWTProtected()}
+	if inject {
+		handlers = append(handlers, middleware.InjectUser())
+	}
+	group := app.Group("/", handlers...)
+	group.Delete("/books", middleware.RequirePermission(auth.PermBooksDelete), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	group.Get("/books", middleware.RequirePermission(auth.PermBooksRead), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	group.Get("/me/permissions", auth.NewHandler(nil, nil, nil, nil).GetMyPermissions)
+	return app
+}
+
+func TestRequirePermission_UsesTokenClaims(t *testing.T) {
+	app := newPermissionApp(false)
+	admin := &auth.User{ID: 1, Username: "admin", Role: "admin"}
+	reader := &auth.User{ID: 7, Username: "reader", Role: "user"}
+
+	assert.Equal(t, http.StatusOK, requestAs(t, app, "/books", reader).StatusCode)
+	assert.Equal(t, http.StatusForbidden, requestMethodAs(t, app, http.MethodDelete, "/books", reader).StatusCode)
+	assert.Equal(t, http.StatusNoContent, requestMethodAs(t, app, http.MethodDelete, "/books", admin).StatusCode)
+}
+
+func TestRequirePermission_FollowsRoleChanges(t *testing.T) {
+	// The token was issued while the user was an admin
+	issued := &auth.User{ID: 7, Username: "reader", Role: "admin"}
+	useUsers(t, map[uint]*auth.User{7: {ID: 7, Username: "reader", Role: "user"}})
+	app := newPermissionApp(true)
+
+	assert.Equal(t, http.StatusForbidden, requestMethodAs(t, app, http.MethodDelete, "/books", issued).StatusCode)
+
+	resp := requestAs(t, app, "/me/permissions", issued)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body auth.PermissionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "user", body.Role)
+	assert.Equal(t, auth.PermissionsFor("user"), body.Permissions)
+}
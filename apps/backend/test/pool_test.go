@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDriver is a database/sql driver whose queries take a fixed time
+// and which records the most connections it ever had open at once
+type countingDriver struct {
+	queryTime time.Duration
+	open      int64
+	maxOpen   int64
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	open := atomic.AddInt64(&d.open, 1)
+	for {
+		max := atomic.LoadInt64(&d.maxOpen)
+		if open <= max || atomic.CompareAndSwapInt64(&d.maxOpen, max, open) {
+			break
+		}
+	}
+	return &countingConn{driver: d}, nil
+}
+
+type countingConn struct {
+	driver *countingDriver
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *countingConn) Close() error {
+	atomic.AddInt64(&c.driver.open, -1)
+	return nil
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	select {
+	case <-time.After(c.driver.queryTime):
+		return driver.RowsAffected(0), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+var driverSeq int64
+
+// openCountingDB registers a fresh countingDriver and returns a pool over it
+// configured with config
+func openCountingDB(t testing.TB, config db.PoolConfig) (*sql.DB, *countingDriver) {
+	d := &countingDriver{queryTime: time.Millisecond}
+	// sql.Register panics on duplicate names, and benchmarks run setup repeatedly
+	name := fmt.Sprintf("counting-%d", atomic.AddInt64(&driverSeq, 1))
+	sql.Register(name, d)
+
+	sqlDB, err := sql.Open(name, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db.ConfigurePool(sqlDB, config)
+	return sqlDB, d
+}
+
+func TestPoolConfigFromEnv(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+	t.Setenv("DB_MAX_IDLE_CONNS", "")
+	t.Setenv("DB_CONN_MAX_LIFETIME_MINUTES", "")
+	t.Setenv("DB_CONN_MAX_IDLE_TIME_MINUTES", "")
+
+	assert.Equal(t, db.PoolConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 10 * time.Minute,
+	}, db.PoolConfigFromEnv())
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("DB_MAX_IDLE_CONNS", "not-a-number")
+	t.Setenv("DB_CONN_MAX_LIFETIME_MINUTES", "5")
+	t.Setenv("DB_CONN_MAX_IDLE_TIME_MINUTES", "-1")
+
+	config := db.PoolConfigFromEnv()
+	assert.Equal(t, 50, config.MaxOpenConns)
+	assert.Equal(t, 5, config.MaxIdleConns, "invalid values fall back to the default")
+	assert.Equal(t, 5*time.Minute, config.ConnMaxLifetime)
+	assert.Equal(t, 10*time.Minute, config.ConnMaxIdleTime)
+}
+
+func TestPoolRespectsMaxOpenConns(t *testing.T) {
+	config := db.PoolConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: time.Minute, ConnMaxIdleTime: time.Minute}
+	sqlDB, d := openCountingDB(t, config)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sqlDB.ExecContext(context.Background(), "SELECT 1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	stats := sqlDB.Stats()
+	assert.LessOrEqual(t, atomic.LoadInt64(&d.maxOpen), int64(config.MaxOpenConns))
+	assert.Equal(t, config.MaxOpenConns, stats.MaxOpenConnections)
+	assert.Greater(t, stats.WaitCount, int64(0), "50 concurrent queries over 4 connections must wait")
+	assert.LessOrEqual(t, stats.Idle, config.MaxIdleConns)
+}
+
+func BenchmarkPoolUnderConcurrentLoad(b *testing.B) {
+	config := db.PoolConfig{MaxOpenConns: 25, MaxIdleConns: 5, ConnMaxLifetime: 30 * time.Minute, ConnMaxIdleTime: 10 * time.Minute}
+	sqlDB, d := openCountingDB(b, config)
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := sqlDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+	b.StopTimer()
+
+	if max := atomic.LoadInt64(&d.maxOpen); max > int64(config.MaxOpenConns) {
+		b.Fatalf("pool opened %d connections, limit is %d", max, config.MaxOpenConns)
+	}
+	stats := sqlDB.Stats()
+	b.ReportMetric(float64(stats.WaitCount)/float64(b.N), "waits/op")
+}
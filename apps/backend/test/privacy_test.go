@@ -0,0 +1,121 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/privacy"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func privacyApp(h *privacy.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/me/export", middleware.JWTProtected(), h.ExportMyData)
+	return app
+}
+
+// expectUserData expects the queries of an export of user 7
+func expectUserData(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT \* FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "role"}).
+			AddRow(7, "alice", "$2a$10$hash", "alice@example.com", "user"))
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE created_by_user_id = \$1`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(3, "Dune", "Frank Herbert", 1965, "available", 1))
+	mock.ExpectQuery(`SELECT \* FROM "ratings" WHERE user_id = \$1`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "book_id", "score"}).AddRow(1, 7, 3, 5))
+	for _, table := range []string{"bookmarks", "reading_statuses", "loans", "search_history"} {
+		mock.ExpectQuery(`SELECT \* FROM "` + table + `" WHERE user_id = \$1`).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+	mock.ExpectQuery(`SELECT \* FROM \(SELECT 'book.borrowed'`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"event_type", "user_id", "book_id", "score", "occurred_at"}).
+			AddRow("book.rated", 7, 3, 5, time.Now()))
+}
+
+func exportRequest(t *testing.T, app *fiber.App, token string) *http.Response {
+	req := httptest.NewRequest("GET", "/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestExportMyData_Archive(t *testing.T) {
+	signer := tokens.NewHS256Signer([]byte("privacy-secret"))
+	useSigner(t, signer)
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+	conn, mock := mockDB(t)
+	expectUserData(mock)
+
+	resp := exportRequest(t, privacyApp(privacy.NewHandler(conn, newMemoryCache(), nil)), token)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, privacy.ContentTypeZip, resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="user-7-export.zip"`, resp.Header.Get("Content-Disposition"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	var names []string
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(content)
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, privacy.Files, names)
+
+	var profile map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(files["profile.json"]), &profile))
+	assert.Equal(t, "alice", profile["username"])
+	assert.Equal(t, "alice@example.com", profile["email"])
+	assert.NotContains(t, profile, "password")
+	assert.NotContains(t, files["profile.json"], "$2a$")
+
+	assert.Contains(t, files["books_created.json"], `"title": "Dune"`)
+	assert.Contains(t, files["ratings.json"], `"score": 5`)
+	assert.Contains(t, files["activity_feed.json"], `"type": "book.rated"`)
+	assert.JSONEq(t, `[]`, files["reviews.json"])
+	assert.JSONEq(t, `[]`, files["loans.json"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportMyData_OncePerDay(t *testing.T) {
+	signer := tokens.NewHS256Signer([]byte("privacy-secret"))
+	useSigner(t, signer)
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+	conn, mock := mockDB(t)
+	store := newMemoryCache()
+	app := privacyApp(privacy.NewHandler(conn, store, nil))
+
+	// A failed export doesn't use up the day's export
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.Equal(t, http.StatusNotFound, exportRequest(t, app, token).StatusCode)
+	assert.Empty(t, store.keys())
+
+	expectUserData(mock)
+	assert.Equal(t, http.StatusOK, exportRequest(t, app, token).StatusCode)
+	assert.Equal(t, []string{"privacy:export:7"}, store.keys())
+
+	resp := exportRequest(t, app, token)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,52 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_DeliversToTopicSubscribers(t *testing.T) {
+	hub := pubsub.NewHub()
+	first, unsubscribeFirst := hub.Subscribe("a")
+	second, unsubscribeSecond := hub.Subscribe("a")
+	other, unsubscribeOther := hub.Subscribe("b")
+	defer unsubscribeFirst()
+	defer unsubscribeSecond()
+	defer unsubscribeOther()
+
+	assert.Equal(t, 2, hub.Publish("a", "hello"))
+	assert.Equal(t, "hello", <-first)
+	assert.Equal(t, "hello", <-second)
+	assert.Empty(t, other)
+	assert.Equal(t, 0, hub.Publish("nobody", "hello"))
+}
+
+func TestHub_UnsubscribeClosesOnce(t *testing.T) {
+	hub := pubsub.NewHub()
+	ch, unsubscribe := hub.Subscribe("a")
+	require.Equal(t, 1, hub.Subscribers("a"))
+
+	unsubscribe()
+	unsubscribe()
+	_, open := <-ch
+	assert.False(t, open)
+	assert.Equal(t, 0, hub.Subscribers("a"))
+	assert.Equal(t, 0, hub.Publish("a", "hello"))
+}
+
+func TestHub_DropsForFullSubscribers(t *testing.T) {
+	hub := pubsub.NewHub()
+	slow, unsubscribe := hub.Subscribe("a")
+	defer unsubscribe()
+
+	for i := 0; i < pubsub.DefaultBuffer; i++ {
+		require.Equal(t, 1, hub.Publish("a", i))
+	}
+	// Publishing doesn't block on a subscriber that fell behind
+	assert.Equal(t, 0, hub.Publish("a", "dropped"))
+	assert.Equal(t, 0, <-slow)
+	assert.Len(t, slow, pubsub.DefaultBuffer-1)
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/ratelimit"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var envLimits = ratelimit.Config{
+	Default: ratelimit.Limit{Limit: 100, Window: 60},
+	Admin:   ratelimit.Limit{Limit: 100, Window: 60},
+}
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	store := newMemoryCache()
+
+	config, found, err := ratelimit.LoadConfig(store, envLimits)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, envLimits, config)
+
+	// Tiers missing from the hash keep their fallback
+	require.NoError(t, store.HSet(ratelimit.ConfigKey, map[string]interface{}{
+		ratelimit.TierAdmin: ratelimit.Limit{Limit: 1000, Window: 60},
+	}))
+	config, found, err = ratelimit.LoadConfig(store, envLimits)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, envLimits.Default, config.Default)
+	assert.Equal(t, 1000, config.Admin.Limit)
+
+	store.hashes[ratelimit.ConfigKey][ratelimit.TierDefault] = `{"limit":0,"window":60}`
+	config, _, err = ratelimit.LoadConfig(store, envLimits)
+	assert.Error(t, err)
+	assert.Equal(t, envLimits, config)
+}
+
+// rateLimitConfigApp serves the config endpoints without authentication
+func rateLimitConfigApp(source *ratelimit.ConfigSource, onUpdate func(c *fiber.Ctx, previous, config ratelimit.Config)) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/ratelimit/config", ratelimit.GetConfigHandler(source))
+	app.Put("/admin/ratelimit/config", ratelimit.UpdateConfigHandler(source, onUpdate))
+	return app
+}
+
+func putRateLimits(t *testing.T, app *fiber.App, body string) *http.Response {
+	req := httptest.NewRequest(http.MethodPut, "/admin/ratelimit/config", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+// statuses sends n requests to /test and returns their status codes
+func statuses(t *testing.T, app *fiber.App, n int, token string) []int {
+	var codes []int
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		codes = append(codes, resp.StatusCode)
+	}
+	return codes
+}
+
+func TestRateLimitConfig_ChangeAppliesAfterReload(t *testing.T) {
+	store := newMemoryCache()
+	reload := 200 * time.Millisecond
+	// Two instances sharing Redis; the change is made through the first
+	first := ratelimit.NewConfigSource(store, envLimits, reload)
+	second := ratelimit.NewConfigSource(store, envLimits, reload)
+	secondApp := newRateLimitApp(middleware.RateLimitConfig{Limits: second, Storage: middleware.CacheStorage(store)})
+	assert.Equal(t, []int{200, 200, 200}, statuses(t, secondApp, 3, ""))
+
+	var audited []ratelimit.Config
+	admin := rateLimitConfigApp(first, func(c *fiber.Ctx, previous, config ratelimit.Config) {
+		audited = append(audited, previous, config)
+	})
+	resp := putRateLimits(t, admin, `{"default":{"limit":5,"window":60},"admin":{"limit":1000,"window":60}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, audited, 2)
+	assert.Equal(t, envLimits, audited[0])
+	assert.Equal(t, 5, audited[1].Default.Limit)
+
+	var current ratelimit.Config
+	resp, err := admin.Test(httptest.NewRequest(http.MethodGet, "/admin/ratelimit/config", nil))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&current))
+	assert.Equal(t, audited[1], current)
+
+	// The second instance keeps its copy until the reload interval passes;
+	// the counter in storage carries over to the new limit
+	assert.Equal(t, []int{200}, statuses(t, secondApp, 1, ""))
+	time.Sleep(reload)
+	assert.Equal(t, []int{200, 429}, statuses(t, secondApp, 2, ""))
+}
+
+func TestRateLimitConfig_AdminTier(t *testing.T) {
+	signer := tokens.NewHS256Signer([]byte("ratelimit-secret"))
+	useSigner(t, signer)
+	adminToken, err := signer.Sign(jwt.MapClaims{"sub": 1, "role": "admin", "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	userToken, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+
+	store := newMemoryCache()
+	source := ratelimit.NewConfigSource(store, envLimits, time.Minute)
+	require.NoError(t, source.Update(ratelimit.Config{
+		Default: ratelimit.Limit{Limit: 1, Window: 60},
+		Admin:   ratelimit.Limit{Limit: 3, Window: 60},
+	}))
+	app := newRateLimitApp(middleware.RateLimitConfig{Limits: source, Storage: middleware.CacheStorage(store)})
+
+	assert.Equal(t, []int{200, 429}, statuses(t, app, 2, userToken))
+	assert.Equal(t, []int{200, 200, 200, 429}, statuses(t, app, 4, adminToken))
+	assert.ElementsMatch(t, []string{"ratelimit:user:7", "ratelimit:admin:user:1"}, store.keys())
+}
+
+func TestRateLimitConfig_RejectsInvalidLimits(t *testing.T) {
+	source := ratelimit.NewConfigSource(newMemoryCache(), envLimits, time.Minute)
+	app := rateLimitConfigApp(source, func(c *fiber.Ctx, previous, config ratelimit.Config) {
+		t.Error("invalid limits were audited")
+	})
+
+	for _, body := range []string{
+		`{"default":{"limit":0,"window":60},"admin":{"limit":10,"window":60}}`,
+		`{"default":{"limit":10,"window":60}}`,
+		`not json`,
+	} {
+		resp := putRateLimits(t, app, body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+	assert.Equal(t, envLimits, source.Current())
+}
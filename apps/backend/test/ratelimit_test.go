@@ -0,0 +1,353 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCache keeps JSON-encoded values in a map, like Redis would
+type memoryCache struct {
+	cache.Cache
+	mu     sync.Mutex
+	values map[string][]byte
+	hashes map[string]map[string]string
+	scores map[string]map[string]float64
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: map[string][]byte{}, hashes: map[string]map[string]string{}, scores: map[string]map[string]float64{}}
+}
+
+func (m *memoryCache) Incr(key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	if encoded, ok := m.values[key]; ok {
+		if err := json.Unmarshal(encoded, &n); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	m.values[key], _ = json.Marshal(n)
+	return n, nil
+}
+
+func (m *memoryCache) GetInt64(key string) (int64, error) {
+	var n int64
+	return n, m.Get(key, &n)
+}
+
+func (m *memoryCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scores[key] == nil {
+		m.scores[key] = map[string]float64{}
+	}
+	m.scores[key][member] += increment
+	return m.scores[key][member], nil
+}
+
+// Expiry and unique visitor counts aren't kept
+func (m *memoryCache) Expire(key string, expiration time.Duration) error {
+	return nil
+}
+
+func (m *memoryCache) PFAdd(key string, elements ...interface{}) error {
+	return nil
+}
+
+func (m *memoryCache) PFCount(keys ...string) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryCache) HSet(key string, values map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hashes[key] == nil {
+		m.hashes[key] = map[string]string{}
+	}
+	for field, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		m.hashes[key][field] = string(encoded)
+	}
+	return nil
+}
+
+func (m *memoryCache) HGetAll(key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fields := map[string]string{}
+	for field, value := range m.hashes[key] {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+func (m *memoryCache) Set(key string, value interface{}, expiration time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = encoded
+	return nil
+}
+
+func (m *memoryCache) Get(key string, dest interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	encoded, ok := m.values[key]
+	if !ok {
+		return cache.ErrNotFound
+	}
+	return json.Unmarshal(encoded, dest)
+}
+
+func (m *memoryCache) Delete(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.values, key)
+	}
+	return nil
+}
+
+func (m *memoryCache) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	_, exists := m.values[key]
+	m.mu.Unlock()
+	if exists {
+		return false, nil
+	}
+	return true, m.Set(key, value, expiration)
+}
+
+func (m *memoryCache) Keys(pattern string) ([]string, error) {
+	var matched []string
+	for _, key := range m.keys() {
+		if ok, _ := path.Match(pattern, key); ok {
+			matched = append(matched, key)
+		}
+	}
+	return matched, nil
+}
+
+func (m *memoryCache) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// app.Test requests come from 0.0.0.0
+func newRateLimitApp(config middleware.RateLimitConfig) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.RateLimit(config))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestRateLimit_CountsInStorage(t *testing.T) {
+	store := newMemoryCache()
+	app := newRateLimitApp(middleware.RateLimitConfig{Max: 2, Storage: middleware.CacheStorage(store)})
+
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+	assert.Equal(t, []string{"ratelimit:0.0.0.0"}, store.keys())
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func getAs(t *testing.T, app *fiber.App, token string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestRateLimit_ExceededResponse(t *testing.T) {
+	app := newRateLimitApp(middleware.RateLimitConfig{Max: 2, Expiration: time.Minute, Storage: middleware.CacheStorage(newMemoryCache())})
+
+	for i := 0; i < 2; i++ {
+		resp := getAs(t, app, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "2;w=60", resp.Header.Get(middleware.RateLimitPolicyHeader))
+	}
+
+	resp := getAs(t, app, "")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2;w=60", resp.Header.Get(middleware.RateLimitPolicyHeader))
+
+	var body apierrors.RateLimitedBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "RATE_LIMITED", body.Code)
+	assert.Equal(t, "rate_limit_exceeded", body.Error)
+	assert.Equal(t, "You have exceeded 2 requests per 60 seconds", body.Message)
+	assert.Equal(t, 2, body.Limit)
+	assert.Equal(t, 60, body.WindowSeconds)
+	assert.Equal(t, "0.0.0.0", body.Identifier)
+
+	retryAfter, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	require.NoError(t, err, "Retry-After is in whole seconds")
+	assert.Equal(t, retryAfter, body.RetryAfterSeconds)
+	assert.True(t, retryAfter > 0 && retryAfter <= 60, retryAfter)
+}
+
+func TestRateLimit_CountsPerUser(t *testing.T) {
+	signer := tokens.NewHS256Signer([]byte("ratelimit-secret"))
+	useSigner(t, signer)
+	sign := func(sub int) string {
+		token, err := signer.Sign(jwt.MapClaims{"sub": sub, "role": "user", "exp": time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+		return token
+	}
+	alice, bob := sign(7), sign(8)
+
+	store := newMemoryCache()
+	app := newRateLimitApp(middleware.RateLimitConfig{Max: 1, Storage: middleware.CacheStorage(store)})
+
+	// Every request comes from the same IP, but each user has a counter
+	assert.Equal(t, http.StatusOK, getAs(t, app, alice).StatusCode)
+	assert.Equal(t, http.StatusOK, getAs(t, app, bob).StatusCode)
+	assert.Equal(t, http.StatusOK, getAs(t, app, "").StatusCode)
+	// Invalid tokens count against the IP
+	assert.Equal(t, http.StatusTooManyRequests, getAs(t, app, "not-a-token").StatusCode)
+	assert.ElementsMatch(t, []string{"ratelimit:user:7", "ratelimit:user:8", "ratelimit:0.0.0.0"}, store.keys())
+
+	resp := getAs(t, app, alice)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	var body apierrors.RateLimitedBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "user:7", body.Identifier)
+}
+
+func TestRateLimit_ExemptIPSkipsLimiter(t *testing.T) {
+	nets, err := middleware.ParseCIDRs("10.0.0.0/8, 0.0.0.0")
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	log := logger.NewLogger()
+	log.SetLevel(logger.DEBUG)
+	log.SetJSONFormat(true)
+	log.SetOutput(&logs)
+
+	store := newMemoryCache()
+	app := newRateLimitApp(middleware.RateLimitConfig{
+		Max:        1,
+		Storage:    middleware.CacheStorage(store),
+		ExemptNets: nets,
+		Log:        log,
+	})
+
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("X-RateLimit-Limit"))
+		assert.Empty(t, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+	assert.Empty(t, store.keys(), "no counter is written for exempt clients")
+	assert.Contains(t, logs.String(), `"reason":"ip_range"`)
+}
+
+func TestRateLimit_ExemptServiceKey(t *testing.T) {
+	store := newMemoryCache()
+	app := newRateLimitApp(middleware.RateLimitConfig{
+		Max:           1,
+		Storage:       middleware.CacheStorage(store),
+		ExemptAPIKeys: []string{"ci-key"},
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(middleware.ServiceKeyHeader, "ci-key")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("X-RateLimit-Limit"))
+	}
+	assert.Empty(t, store.keys())
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(middleware.ServiceKeyHeader, "wrong-key")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Header.Get("X-RateLimit-Limit"), "unknown keys are limited")
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := middleware.ParseCIDRs("10.0.0.0/8,192.168.0.0/16, ::1 ,")
+	require.NoError(t, err)
+	require.Len(t, nets, 3)
+	assert.Equal(t, "10.0.0.0/8", nets[0].String())
+	assert.Equal(t, "::1/128", nets[2].String())
+
+	nets, err = middleware.ParseCIDRs("")
+	require.NoError(t, err)
+	assert.Empty(t, nets)
+
+	for _, raw := range []string{"10.0.0.0/33", "not-an-ip"} {
+		_, err := middleware.ParseCIDRs(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestRateLimitConfigFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "50")
+	t.Setenv("RATE_WINDOW", "30")
+	t.Setenv("RATE_LIMIT_EXEMPT_IPS", "10.0.0.0/8")
+	t.Setenv("RATE_LIMIT_EXEMPT_API_KEYS", "monitoring, ci")
+	t.Setenv("RATE_LIMIT_ALGORITHM", "leaky_bucket")
+
+	config, err := middleware.RateLimitConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 50, config.Max)
+	assert.Equal(t, 30*time.Second, config.Expiration)
+	assert.Equal(t, middleware.AlgorithmLeakyBucket, config.Algorithm)
+	require.Len(t, config.ExemptNets, 1)
+	assert.Equal(t, []string{"monitoring", "ci"}, config.ExemptAPIKeys)
+
+	t.Setenv("RATE_LIMIT_ALGORITHM", "token_bucket")
+	_, err = middleware.RateLimitConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("RATE_LIMIT_ALGORITHM", "")
+	t.Setenv("RATE_LIMIT_EXEMPT_IPS", "10.0.0.0/99")
+	_, err = middleware.RateLimitConfigFromEnv()
+	assert.Error(t, err)
+}
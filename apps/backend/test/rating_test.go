@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLeaderboard_CachedPerGenreAndParameters(t *testing.T) {
+	conn, mock := mockDB(t)
+	c := newMemoryCache()
+	h := book.NewBookHandler(book.NewDBStore(conn, nil), c, nil, nil)
+
+	mock.ExpectQuery(`RANK\(\) OVER \(ORDER BY AVG\(ratings.score\) DESC, COUNT\(\*\) DESC\)`).
+		WithArgs("Fiction", "Fiction", 5, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "avg_rating", "rating_count", "rank"}).
+			AddRow(2, 4.8, 12, 1).
+			AddRow(1, 4.5, 20, 2))
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE id IN \(\$1,\$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Emma").AddRow(2, "Dune"))
+
+	ranked, err := h.Leaderboard(context.Background(), "Fiction", 5, 10)
+	require.NoError(t, err)
+	require.Len(t, ranked, 2)
+	assert.Equal(t, "Dune", ranked[0].Title)
+	assert.Equal(t, int64(1), ranked[0].Rank)
+	assert.Equal(t, 4.8, ranked[0].AvgRating)
+	assert.Equal(t, "Emma", ranked[1].Title)
+	assert.Equal(t, int64(20), ranked[1].RatingCount)
+
+	// Served from the cache without querying again
+	cached, err := h.Leaderboard(context.Background(), "Fiction", 5, 10)
+	require.NoError(t, err)
+	assert.Equal(t, ranked, cached)
+	assert.Equal(t, []string{"books:leaderboard:Fiction:5:10"}, c.keys())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRateBook_DropsCachedLeaderboards(t *testing.T) {
+	conn, mock := mockDB(t)
+	c := newMemoryCache()
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Put("/books/:id/rating", middleware.JWTProtected(), book.NewBookHandler(book.NewDBStore(conn, nil), c, nil, nil).RateBook)
+	require.NoError(t, c.Set("books:leaderboard:Fiction:5:10", []book.RankedBook{}, book.LeaderboardTTL))
+	require.NoError(t, c.Set("books:leaderboard::5:20", []book.RankedBook{}, book.LeaderboardTTL))
+	require.NoError(t, c.Set("book:7", 1, book.LeaderboardTTL))
+
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Dune"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ratings" .* ON CONFLICT \("user_id","book_id"\) DO UPDATE SET "score"="excluded"."score","updated_at"="excluded"."updated_at"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	resp := sendAs(t, app, http.MethodPut, "/books/7/rating", `{"score":4}`, &auth.User{ID: 3, Username: "reader", Role: "user"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var rating book.Rating
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rating))
+	assert.Equal(t, 4, rating.Score)
+	assert.Equal(t, []string{"book:7"}, c.keys())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/db"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// flakyPing fails the first failures calls
+func flakyPing(failures int32) (func(ctx context.Context) error, *int32) {
+	var calls int32
+	return func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, &calls
+}
+
+func TestHealthPollerReconnectsAfterThreshold(t *testing.T) {
+	ping, _ := flakyPing(3)
+	reconnected := make(chan struct{}, 10)
+	poller := &db.HealthPoller{
+		Ping:      ping,
+		Reconnect: func(ctx context.Context) { reconnected <- struct{}{} },
+		Threshold: 3,
+	}
+	ctx := context.Background()
+
+	assert.Error(t, poller.Poll(ctx))
+	assert.False(t, db.IsHealthy())
+	assert.Error(t, poller.Poll(ctx))
+	assert.Empty(t, reconnected, "no reconnect before the threshold")
+
+	assert.Error(t, poller.Poll(ctx))
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("reconnect not started after 3 failures")
+	}
+
+	assert.NoError(t, poller.Poll(ctx))
+	assert.True(t, db.IsHealthy())
+}
+
+func TestHealthPollerRunsOneReconnectAtATime(t *testing.T) {
+	ping, _ := flakyPing(100)
+	release := make(chan struct{})
+	var reconnects int32
+	poller := &db.HealthPoller{
+		Ping: ping,
+		Reconnect: func(ctx context.Context) {
+			atomic.AddInt32(&reconnects, 1)
+			<-release
+		},
+		Threshold: 1,
+	}
+
+	for i := 0; i < 5; i++ {
+		poller.Poll(context.Background())
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&reconnects) == 1
+	}, time.Second, time.Millisecond)
+	for i := 0; i < 5; i++ {
+		poller.Poll(context.Background())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reconnects))
+	close(release)
+
+	// Once the reconnect finishes, further failures start another one
+	require.Eventually(t, func() bool {
+		poller.Poll(context.Background())
+		return atomic.LoadInt32(&reconnects) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConnectWithRetry(t *testing.T) {
+	previous := db.ReconnectBackoff
+	db.ReconnectBackoff = []time.Duration{time.Millisecond, 2 * time.Millisecond}
+	defer func() { db.ReconnectBackoff = previous }()
+
+	var attempts int
+	want := &gorm.DB{}
+	conn, err := db.ConnectWithRetry(context.Background(), nil, func() (*gorm.DB, error) {
+		attempts++
+		if attempts < 4 {
+			return nil, errors.New("connection refused")
+		}
+		return want, nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, want, conn)
+	assert.Equal(t, 4, attempts)
+}
+
+func TestConnectWithRetryStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := db.ConnectWithRetry(ctx, nil, func() (*gorm.DB, error) {
+		return nil, errors.New("connection refused")
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// closedOnceCache fails its first Get with redis.ErrClosed, like a client
+// that was closed underneath the application
+type closedOnceCache struct {
+	cache.Cache
+	gets int32
+}
+
+func (c *closedOnceCache) Get(key string, dest interface{}) error {
+	atomic.AddInt32(&c.gets, 1)
+	return redis.ErrClosed
+}
+
+func TestReconnectingCacheRecreatesClosedClient(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	mock.ExpectGet("book:1").SetVal(`"Dune"`)
+
+	closed := &closedOnceCache{}
+	var connects int32
+	c := cache.NewReconnectingCache(func() cache.Cache {
+		if atomic.AddInt32(&connects, 1) == 1 {
+			return closed
+		}
+		return cache.NewRedisCacheWithClient(client)
+	})
+
+	var title string
+	require.NoError(t, c.Get("book:1", &title))
+	assert.Equal(t, "Dune", title)
+	assert.Equal(t, int32(1), closed.gets)
+	assert.Equal(t, int32(2), connects)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconnectingCacheDetectsRealClosedClient(t *testing.T) {
+	closedClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	require.NoError(t, closedClient.Close())
+
+	client, mock := redismock.NewClientMock()
+	mock.ExpectIncr("views").SetVal(1)
+
+	var connects int32
+	c := cache.NewReconnectingCache(func() cache.Cache {
+		if atomic.AddInt32(&connects, 1) == 1 {
+			return cache.NewRedisCacheWithClient(closedClient)
+		}
+		return cache.NewRedisCacheWithClient(client)
+	})
+
+	n, err := c.Incr("views")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, int32(2), connects)
+}
+
+func TestReconnectingCacheKeepsClientOnOtherErrors(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	mock.ExpectGet("book:1").SetErr(errors.New("READONLY"))
+
+	var connects int32
+	c := cache.NewReconnectingCache(func() cache.Cache {
+		atomic.AddInt32(&connects, 1)
+		return cache.NewRedisCacheWithClient(client)
+	})
+
+	var title string
+	assert.Error(t, c.Get("book:1", &title))
+	assert.Equal(t, int32(1), connects)
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reindexBatch struct {
+	from, to uint
+	// processed is the progress recorded before the batch ran
+	processed int64
+}
+
+// reindexStore answers the reindex queries with fixed bounds and batch
+type reindexStore struct {
+	book.Store
+	minID, maxID uint
+	total        int64
+	batch        func(ctx context.Context, from, to uint) (int64, error)
+}
+
+func (s *reindexStore) ReindexBounds(ctx context.Context) (uint, uint, int64, error) {
+	return s.minID, s.maxID, s.total, nil
+}
+
+func (s *reindexStore) ReindexBatch(ctx context.Context, from, to uint) (int64, error) {
+	return s.batch(ctx, from, to)
+}
+
+// stubReindex returns a handler reindexing a fake store and a func listing
+// the batches it ran
+func stubReindex(t *testing.T, minID, maxID uint, total int64, batch func(ctx context.Context, from, to uint) (int64, error)) (*book.BookHandler, func() []reindexBatch) {
+	var mu sync.Mutex
+	var batches []reindexBatch
+
+	store := &reindexStore{minID: minID, maxID: maxID, total: total}
+	h := book.NewBookHandler(store, newMemoryCache(), nil, nil)
+	store.batch = func(ctx context.Context, from, to uint) (int64, error) {
+		var processed int64
+		if progress, err := h.GetReindexProgress(); err == nil {
+			processed = progress.Processed
+		}
+		mu.Lock()
+		batches = append(batches, reindexBatch{from, to, processed})
+		mu.Unlock()
+		return batch(ctx, from, to)
+	}
+	t.Cleanup(func() { h.StopReindex() })
+
+	return h, func() []reindexBatch {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]reindexBatch(nil), batches...)
+	}
+}
+
+func waitForReindex(t *testing.T, h *book.BookHandler) *book.ReindexProgress {
+	var progress *book.ReindexProgress
+	require.Eventually(t, func() bool {
+		var err error
+		progress, err = h.GetReindexProgress()
+		return err == nil && progress.Status != book.ReindexRunning
+	}, 2*time.Second, 5*time.Millisecond)
+	return progress
+}
+
+func TestReindex_ProcessesBatchesAndTracksProgress(t *testing.T) {
+	h, batches := stubReindex(t, 1, 1234, 1200, func(ctx context.Context, from, to uint) (int64, error) {
+		// IDs 1201-1234 were never used
+		if to > 1200 {
+			to = 1200
+		}
+		return int64(to - from + 1), nil
+	})
+
+	started, err := h.BeginReindex(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, book.ReindexRunning, started.Status)
+	assert.EqualValues(t, 1200, started.Total)
+
+	progress := waitForReindex(t, h)
+	assert.Equal(t, book.ReindexCompleted, progress.Status)
+	assert.EqualValues(t, 1200, progress.Processed)
+	assert.EqualValues(t, 1200, progress.Total)
+	require.NotNil(t, progress.FinishedAt)
+
+	assert.Equal(t, []reindexBatch{
+		{1, 500, 0},
+		{501, 1000, 500},
+		{1001, 1500, 1000},
+	}, batches())
+}
+
+func TestReindex_EmptyTable(t *testing.T) {
+	h, batches := stubReindex(t, 0, 0, 0, func(ctx context.Context, from, to uint) (int64, error) {
+		return 0, nil
+	})
+
+	_, err := h.BeginReindex(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, book.ReindexCompleted, waitForReindex(t, h).Status)
+	assert.Empty(t, batches())
+}
+
+func TestReindex_OneAtATimeAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	h, _ := stubReindex(t, 1, 5000, 5000, func(ctx context.Context, from, to uint) (int64, error) {
+		if from == 1 {
+			return 500, nil
+		}
+		select {
+		case <-release:
+			return 500, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	})
+
+	_, err := h.BeginReindex(context.Background())
+	require.NoError(t, err)
+	_, err = h.BeginReindex(context.Background())
+	assert.ErrorIs(t, err, book.ErrReindexRunning)
+
+	require.Eventually(t, func() bool {
+		progress, err := h.GetReindexProgress()
+		return err == nil && progress.Processed == 500
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, h.StopReindex())
+	progress, err := h.GetReindexProgress()
+	require.NoError(t, err)
+	assert.Equal(t, book.ReindexCancelled, progress.Status)
+	assert.EqualValues(t, 500, progress.Processed)
+
+	assert.ErrorIs(t, h.StopReindex(), book.ErrReindexNotRunning)
+	close(release)
+}
+
+func TestReindex_BatchFailure(t *testing.T) {
+	h, _ := stubReindex(t, 1, 1000, 1000, func(ctx context.Context, from, to uint) (int64, error) {
+		if from > 1 {
+			return 0, errors.New("deadlock detected")
+		}
+		return 500, nil
+	})
+
+	_, err := h.BeginReindex(context.Background())
+	require.NoError(t, err)
+	progress := waitForReindex(t, h)
+	assert.Equal(t, book.ReindexFailed, progress.Status)
+	assert.Equal(t, "deadlock detected", progress.Error)
+	assert.EqualValues(t, 500, progress.Processed)
+}
+
+func TestReindexHandlers(t *testing.T) {
+	h, _ := stubReindex(t, 1, 10, 10, func(ctx context.Context, from, to uint) (int64, error) {
+		return 10, nil
+	})
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/admin/books/reindex", h.StartReindex)
+	app.Get("/admin/books/reindex/status", h.GetReindexStatus)
+	app.Delete("/admin/books/reindex", h.CancelReindex)
+	request := func(method, target string) *http.Response {
+		resp, err := app.Test(httptest.NewRequest(method, target, nil))
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/admin/books/reindex/status").StatusCode)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/admin/books/reindex").StatusCode)
+
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/admin/books/reindex").StatusCode)
+	waitForReindex(t, h)
+
+	resp := request(http.MethodGet, "/admin/books/reindex/status")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var progress book.ReindexProgress
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&progress))
+	assert.Equal(t, book.ReindexCompleted, progress.Status)
+	assert.EqualValues(t, 10, progress.Processed)
+}
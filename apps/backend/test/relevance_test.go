@@ -0,0 +1,80 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchResults are found by "dune" in the order a database might return them
+func searchResults() []book.Book {
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []book.Book{
+		{ID: 1, Title: "Frank Herbert's World", Author: "Dune Scholars", Genre: "Essays", CreatedAt: day.Add(72 * time.Hour)},
+		{ID: 2, Title: "Sandworms", Author: "Brian Herbert", Genre: "Dune Universe", CreatedAt: day},
+		{ID: 3, Title: "Dune", Author: "Frank Herbert", Genre: "Science Fiction", CreatedAt: day.Add(48 * time.Hour)},
+		{ID: 4, Title: "Dune Messiah", Author: "Frank Herbert", Genre: "Dune Universe", CreatedAt: day.Add(24 * time.Hour)},
+	}
+}
+
+func TestRankResults(t *testing.T) {
+	ranked := book.RankResults(searchResults(), "DUNE")
+
+	ids := make([]uint, len(ranked))
+	scores := make([]float64, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.ID
+		scores[i] = r.Score
+	}
+	assert.Equal(t, []uint{4, 3, 1, 2}, ids)
+	assert.Equal(t, []float64{4, 3, 2, 1}, scores)
+
+	assert.Empty(t, book.RankResults(nil, "dune"))
+	assert.Equal(t, 0.0, book.RelevanceScore(searchResults()[2], "  "))
+}
+
+func TestRankResults_TitleMatchBeatsOtherFields(t *testing.T) {
+	books := []book.Book{
+		{ID: 1, Title: "Collected Essays", Author: "Orwell"},
+		{ID: 2, Title: "Orwell", Author: "D. J. Taylor"},
+	}
+	ranked := book.RankResults(books, "orwell")
+	assert.Equal(t, uint(2), ranked[0].ID)
+	assert.Greater(t, ranked[0].Score, ranked[1].Score)
+}
+
+func TestGetBooks_SearchOrder(t *testing.T) {
+	app := bookApp(stubLoadBooks(func(ctx context.Context, search string) ([]book.Book, error) {
+		return searchResults(), nil
+	}), nil)
+
+	order := func(target string) []uint {
+		resp, err := app.Test(httptest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		var results []book.ScoredBook
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+		ids := make([]uint, len(results))
+		for i, r := range results {
+			ids[i] = r.ID
+		}
+		return ids
+	}
+
+	assert.Equal(t, []uint{4, 3, 1, 2}, order("/books?search=dune"))
+	assert.Equal(t, []uint{4, 3, 1, 2}, order("/books?search=dune&sort=relevance"))
+	assert.Equal(t, []uint{2, 4, 3, 1}, order("/books?search=dune&sort=created_at"))
+	assert.Equal(t, []uint{1, 3, 4, 2}, order("/books?search=dune&sort=created_at&dir=desc"))
+
+	for _, target := range []string{"/books?search=dune&sort=views", "/books?search=dune&sort=created_at&dir=up", "/books?sort=relevance"} {
+		resp, err := app.Test(httptest.NewRequest("GET", target, nil))
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, target)
+	}
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReportPeriod(t *testing.T) {
+	days, err := auth.ParseReportPeriod("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7, days)
+
+	days, err = auth.ParseReportPeriod("365d")
+	require.NoError(t, err)
+	assert.Equal(t, 365, days)
+
+	for _, raw := range []string{"", "7", "d", "0d", "-1d", "366d", "1w"} {
+		_, err := auth.ParseReportPeriod(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestNewUsersReportRejectsInvalidPeriod(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/admin/reports/new-users", auth.NewHandler(nil, nil, nil, nil).GetNewUsersReport)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/reports/new-users?period=week", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
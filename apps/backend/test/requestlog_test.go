@@ -0,0 +1,223 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	tokens "github.com/AtillaTahaK/gobooklibrary/pkg/auth"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/requestlog"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestFilter(t *testing.T) {
+	event := func(status int, path string) requestlog.Event {
+		return requestlog.Event{Status: status, Path: path}
+	}
+
+	filter, err := requestlog.ParseFilter("5xx", "")
+	require.NoError(t, err)
+	assert.True(t, filter.Match(event(503, "/books")))
+	assert.False(t, filter.Match(event(404, "/books")))
+
+	filter, err = requestlog.ParseFilter("404", "/books/")
+	require.NoError(t, err)
+	assert.True(t, filter.Match(event(404, "/books")))
+	assert.True(t, filter.Match(event(404, "/books/1")))
+	assert.False(t, filter.Match(event(404, "/bookshelf")))
+	assert.False(t, filter.Match(event(400, "/books/1")))
+
+	filter, err = requestlog.ParseFilter("", "")
+	require.NoError(t, err)
+	assert.True(t, filter.Match(event(200, "/health")))
+
+	for _, invalid := range []string{"6xx", "abc", "42", "x5x"} {
+		_, err := requestlog.ParseFilter(invalid, "")
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTail_KeepsLastEvents(t *testing.T) {
+	tail := requestlog.NewTail(3)
+	assert.Empty(t, tail.Since(0))
+
+	for i := 1; i <= 5; i++ {
+		tail.Publish(requestlog.Event{Path: fmt.Sprintf("/books/%d", i)})
+	}
+
+	paths := func(events []requestlog.Event) []string {
+		var out []string
+		for _, e := range events {
+			out = append(out, e.Path)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"/books/3", "/books/4", "/books/5"}, paths(tail.Since(0)))
+	assert.Equal(t, []string{"/books/5"}, paths(tail.Since(4)))
+	assert.Empty(t, tail.Since(5))
+}
+
+// sseEvent is one message of an event stream
+type sseEvent struct {
+	ID   string
+	Data requestlog.Event
+}
+
+// readSSE reads n messages from an event stream, skipping comments
+func readSSE(t *testing.T, r *bufio.Reader, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			current.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.Data))
+		case line == "" && current.ID != "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+// newLiveRequestsApp serves /admin/requests/live from tail, recording every
+// other request the way the metrics middleware in main does
+func newLiveRequestsApp(t *testing.T, tail *requestlog.Tail) string {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = apierrors.Status(err)
+		}
+		tail.Publish(requestlog.NewEvent(c.Method(), c.Path(), status, time.Since(start), c.IP()))
+		return err
+	})
+	app.Get("/admin/requests/live", middleware.TokenFromQuery(), middleware.JWTProtected(), middleware.RequireAdmin(), requestlog.LiveHandler(tail))
+	app.Get("/books", func(c *fiber.Ctx) error { return c.SendString("[]") })
+	app.Get("/books/:id", func(c *fiber.Ctx) error { return apierrors.ErrDatabase })
+	app.Get("/bookshelf", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+// openLiveRequests connects to the stream and waits for it to subscribe
+func openLiveRequests(t *testing.T, tail *requestlog.Tail, url string, header http.Header) *bufio.Reader {
+	subscribers := tail.Hub.Subscribers(requestlog.Topic)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, requestlog.ContentTypeEventStream, resp.Header.Get("Content-Type"))
+
+	require.Eventually(t, func() bool {
+		return tail.Hub.Subscribers(requestlog.Topic) > subscribers
+	}, time.Second, 10*time.Millisecond)
+	return bufio.NewReader(resp.Body)
+}
+
+func get(t *testing.T, url string) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func signedToken(t *testing.T, role string) string {
+	signer := tokens.NewHS256Signer([]byte("live-secret"))
+	useSigner(t, signer)
+	token, err := signer.Sign(jwt.MapClaims{"sub": 1, "role": role, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	return token
+}
+
+func TestLiveRequests_StreamsFilteredEvents(t *testing.T) {
+	tail := requestlog.NewTail(requestlog.DefaultBufferSize)
+	base := newLiveRequestsApp(t, tail)
+	token := signedToken(t, "admin")
+	live := base + "/admin/requests/live?access_token=" + token
+
+	errors := openLiveRequests(t, tail, live+"&status=5xx", nil)
+	books := openLiveRequests(t, tail, live+"&path=/books", nil)
+
+	get(t, base+"/bookshelf")
+	get(t, base+"/books")
+	get(t, base+"/books/1")
+
+	got := readSSE(t, errors, 1)[0]
+	assert.Equal(t, "GET", got.Data.Method)
+	assert.Equal(t, "/books/1", got.Data.Path)
+	assert.Equal(t, http.StatusInternalServerError, got.Data.Status)
+	assert.Equal(t, "127.0.0.1", got.Data.IP)
+	assert.WithinDuration(t, time.Now(), got.Data.Timestamp, time.Minute)
+	assert.GreaterOrEqual(t, got.Data.DurationMs, int64(0))
+
+	bookEvents := readSSE(t, books, 2)
+	assert.Equal(t, "/books", bookEvents[0].Data.Path)
+	assert.Equal(t, http.StatusOK, bookEvents[0].Data.Status)
+	assert.Equal(t, "/books/1", bookEvents[1].Data.Path)
+	assert.Equal(t, got.ID, bookEvents[1].ID, "ids are shared by all clients")
+}
+
+func TestLiveRequests_ResumesFromLastEventID(t *testing.T) {
+	tail := requestlog.NewTail(requestlog.DefaultBufferSize)
+	base := newLiveRequestsApp(t, tail)
+	token := signedToken(t, "admin")
+
+	get(t, base+"/books")
+	get(t, base+"/books/1")
+	get(t, base+"/bookshelf")
+	first := tail.Since(0)[0].ID
+
+	header := http.Header{"Last-Event-Id": {fmt.Sprint(first)}}
+	stream := openLiveRequests(t, tail, base+"/admin/requests/live?path=/books&access_token="+token, header)
+	get(t, base+"/books/2")
+
+	events := readSSE(t, stream, 2)
+	assert.Equal(t, "/books/1", events[0].Data.Path, "buffered events after Last-Event-ID come first")
+	assert.Equal(t, "/books/2", events[1].Data.Path)
+}
+
+func TestLiveRequests_RequiresAdmin(t *testing.T) {
+	tail := requestlog.NewTail(requestlog.DefaultBufferSize)
+	base := newLiveRequestsApp(t, tail)
+
+	resp, err := http.Get(base + "/admin/requests/live")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(base + "/admin/requests/live?access_token=" + signedToken(t, "user"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = http.Get(base + "/admin/requests/live?status=9xx&access_token=" + signedToken(t, "admin"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
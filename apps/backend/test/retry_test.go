@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer answers status for the first failures requests, then 200
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func fastRetryClient(maxRetries int) *exthttp.RetryableClient {
+	client := exthttp.NewRetryableClient(maxRetries, time.Second)
+	client.InitialBackoff = time.Millisecond
+	client.MaxBackoff = 10 * time.Millisecond
+	return client
+}
+
+func TestRetryableClient_RetriesUntilSuccess(t *testing.T) {
+	server, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := fastRetryClient(5).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetryableClient_GivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := flakyServer(t, 10, http.StatusTooManyRequests)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := fastRetryClient(2).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetryableClient_DoesNotRetryClientErrors(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusNotFound)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := fastRetryClient(5).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryableClient_DoesNotRetryPost(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+	resp, err := fastRetryClient(5).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryableClient_RetriesPutWithBody(t *testing.T) {
+	var bodies []string
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"a":1}`))
+	resp, err := fastRetryClient(5).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{`{"a":1}`, `{"a":1}`}, bodies)
+}
+
+func TestRetryableClient_RetriesRefusedConnections(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := fastRetryClient(3)
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	_, err := client.Do(req)
+	assert.ErrorContains(t, err, "connection refused")
+}
+
+func TestRetryableClient_StopsWhenContextIsCancelled(t *testing.T) {
+	server, calls := flakyServer(t, 10, http.StatusServiceUnavailable)
+
+	client := fastRetryClient(5)
+	client.InitialBackoff = time.Hour
+	client.MaxBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	start := time.Now()
+	_, err := client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestNewRetryableClientFromEnv(t *testing.T) {
+	t.Setenv("EXTERNAL_HTTP_MAX_RETRIES", "2")
+	t.Setenv("EXTERNAL_HTTP_TIMEOUT_MS", "1500")
+	client, err := exthttp.NewRetryableClientFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.MaxRetries)
+	assert.Equal(t, 1500*time.Millisecond, client.Client.Timeout)
+
+	t.Setenv("EXTERNAL_HTTP_MAX_RETRIES", "-1")
+	client, err = exthttp.NewRetryableClientFromEnv()
+	assert.Error(t, err)
+	assert.Equal(t, exthttp.DefaultMaxRetries, client.MaxRetries)
+}
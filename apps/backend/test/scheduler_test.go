@@ -0,0 +1,107 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/mail"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/AtillaTahaK/gobooklibrary/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_NextRun(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 8 * * 1", time.Date(2024, 5, 20, 8, 0, 0, 0, time.UTC)},
+		{"0 12 * * 3", time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)},
+		{"30 10 * * 3", time.Date(2024, 5, 22, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 29 2 *", time.Date(2028, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=Europe/Istanbul 0 8 * * *", time.Date(2024, 5, 16, 5, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			next, err := scheduler.NextRun(tt.expr, from)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, next)
+			assert.Equal(t, time.UTC, next.Location())
+		})
+	}
+}
+
+func TestScheduler_NextRunIsInUTC(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	require.NoError(t, err)
+
+	// 10:30 in Istanbul is 07:30 UTC, so today's 08:00 UTC run is still ahead
+	next, err := scheduler.NextRun("0 8 * * *", time.Date(2024, 5, 15, 10, 30, 0, 0, istanbul))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC), next)
+}
+
+func TestScheduler_RejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "0 8 * *", "0 8 * * 1 2024", "60 8 * * *", "0 25 * * *", "0 8 * * mon-xyz", "every monday"} {
+		_, err := scheduler.Parse(expr)
+		assert.Error(t, err, expr)
+	}
+
+	// Parses, but February 30th never comes
+	_, err := scheduler.NextRun("0 0 30 2 *", time.Now())
+	assert.Error(t, err)
+}
+
+func TestScheduleRequest_Validation(t *testing.T) {
+	valid := report.ScheduleRequest{Report: "stats", Schedule: "0 8 * * 1", Email: "admin@example.com"}
+	assert.Empty(t, validator.ValidateStruct(&valid))
+
+	invalid := report.ScheduleRequest{Report: "sales", Schedule: "0 8 * *", Email: "admin"}
+	errs := validator.ValidateStruct(&invalid)
+	fields := map[string]string{}
+	for _, e := range errs {
+		fields[e.Field] = e.Tag
+	}
+	assert.Equal(t, map[string]string{"report": "oneof", "schedule": "cron", "email": "email"}, fields)
+}
+
+func TestMailMessage(t *testing.T) {
+	msg := string(mail.Message("reports@example.com", []string{"a@example.com", "b@example.com"}, "Library statistics – weekly", "<p>Hi</p>\n"))
+	headers, body, found := strings.Cut(msg, "\r\n\r\n")
+	require.True(t, found)
+	assert.Contains(t, headers, "From: reports@example.com\r\n")
+	assert.Contains(t, headers, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, headers, "Subject: =?utf-8?q?")
+	assert.Contains(t, headers, "Content-Type: text/html; charset=UTF-8")
+	assert.Equal(t, "<p>Hi</p>\r\n", body)
+}
+
+func TestMailConfigFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("SMTP_USERNAME", "reports@example.com")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SMTP_FROM", "")
+
+	config, err := mail.ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 587, config.Port)
+	assert.Equal(t, "reports@example.com", config.From)
+
+	t.Setenv("SMTP_PORT", "smtp")
+	_, err = mail.ConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("SMTP_PORT", "25")
+	t.Setenv("SMTP_USERNAME", "")
+	_, err = mail.ConfigFromEnv()
+	assert.Error(t, err, "mail needs a sender address")
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/jobs"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const staleBooksQuery = `SELECT id FROM books WHERE id > \$1 AND \(search_vector IS NULL OR search_vector_updated_at IS NULL OR search_vector_updated_at < updated_at\) ORDER BY id LIMIT \$2`
+
+// stubSearchVectorUpdates replaces book.UpdateSearchVector with update for
+// the rest of the test
+func stubSearchVectorUpdates(t *testing.T, update func(id uint) (bool, error)) {
+	previous := book.UpdateSearchVector
+	book.UpdateSearchVector = func(ctx context.Context, conn *gorm.DB, id uint) (bool, error) {
+		return update(id)
+	}
+	t.Cleanup(func() { book.UpdateSearchVector = previous })
+}
+
+func TestBookAfterSave_IndexesInBackground(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	indexed := make(chan uint, 1)
+	stubSearchVectorUpdates(t, func(id uint) (bool, error) {
+		indexed <- id
+		return true, nil
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "books"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	authorID := uint(1)
+	require.NoError(t, store.CreateBook(context.Background(), &book.Book{Title: "Dune", Author: "Frank Herbert", AuthorID: &authorID, Year: 1965}))
+
+	select {
+	case id := <-indexed:
+		assert.Equal(t, uint(7), id)
+	case <-time.After(time.Second):
+		t.Fatal("search vector wasn't updated")
+	}
+}
+
+func TestBookAfterSave_RetriesUntilTheBookIsVisible(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	var calls int32
+	done := make(chan struct{})
+	stubSearchVectorUpdates(t, func(id uint) (bool, error) {
+		// The first attempts run before the insert commits
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return false, nil
+		}
+		close(done)
+		return true, nil
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "books"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	mock.ExpectCommit()
+
+	authorID := uint(1)
+	require.NoError(t, store.CreateBook(context.Background(), &book.Book{Title: "Emma", Author: "Jane Austen", AuthorID: &authorID, Year: 1815}))
+
+	select {
+	case <-done:
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	case <-time.After(3 * time.Second):
+		t.Fatalf("gave up after %d attempts", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestUpdateSearchVector(t *testing.T) {
+	conn, mock := mockDB(t)
+	mock.ExpectExec(`UPDATE books SET search_vector = to_tsvector\('english', .*\), search_vector_updated_at = updated_at WHERE id = \$1`).
+		WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE books SET search_vector`).WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	found, err := book.UpdateSearchVector(context.Background(), conn, 7)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = book.UpdateSearchVector(context.Background(), conn, 8)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSyncSearchIndex_UpdatesStaleBooksInBatches(t *testing.T) {
+	conn, mock := mockDB(t)
+	runner := jobs.NewRunner(conn, newMemoryCache(), nil)
+
+	firstBatch := sqlmock.NewRows([]string{"id"})
+	for id := 1; id <= jobs.SearchIndexSyncBatchSize; id++ {
+		firstBatch.AddRow(id)
+	}
+	mock.ExpectQuery(staleBooksQuery).WithArgs(0, jobs.SearchIndexSyncBatchSize).WillReturnRows(firstBatch)
+	mock.ExpectExec(`UPDATE books SET search_vector = .* WHERE id IN \(\$1,\$2,`).
+		WillReturnResult(sqlmock.NewResult(0, int64(jobs.SearchIndexSyncBatchSize)))
+	// Resumes after the last ID so a book that stays stale can't loop forever
+	mock.ExpectQuery(staleBooksQuery).WithArgs(jobs.SearchIndexSyncBatchSize, jobs.SearchIndexSyncBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(250).AddRow(260))
+	mock.ExpectExec(`UPDATE books SET search_vector = .* WHERE id IN \(\$1,\$2\)`).
+		WithArgs(250, 260).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	progress, err := runner.SyncSearchIndex(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(jobs.SearchIndexSyncBatchSize+2), progress.Processed)
+	assert.Equal(t, uint(260), progress.LastID)
+	assert.Equal(t, jobs.SyncCompleted, progress.Status)
+	assert.NotNil(t, progress.FinishedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	stored, err := runner.GetSearchIndexSyncProgress()
+	require.NoError(t, err)
+	assert.Equal(t, progress.Processed, stored.Processed)
+	assert.Equal(t, jobs.SyncCompleted, stored.Status)
+}
+
+func TestSyncSearchIndex_RecordsFailures(t *testing.T) {
+	conn, mock := mockDB(t)
+	runner := jobs.NewRunner(conn, newMemoryCache(), nil)
+
+	mock.ExpectQuery(staleBooksQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE books SET search_vector`).WillReturnError(errors.New("connection reset"))
+
+	_, err := runner.SyncSearchIndex(context.Background())
+	require.Error(t, err)
+
+	stored, err := runner.GetSearchIndexSyncProgress()
+	require.NoError(t, err)
+	assert.Equal(t, jobs.SyncFailed, stored.Status)
+	assert.Equal(t, "connection reset", stored.Error)
+
+	// The lock is released, so the next run goes ahead
+	mock.ExpectQuery(staleBooksQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = runner.SyncSearchIndex(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSyncSearchIndex_OneInstanceAtATime(t *testing.T) {
+	conn, _ := mockDB(t)
+	c := newMemoryCache()
+	runner := jobs.NewRunner(conn, c, nil)
+	require.NoError(t, c.Set("jobs:sync_search_index:lock", true, time.Hour))
+
+	_, err := runner.SyncSearchIndex(context.Background())
+	assert.ErrorIs(t, err, jobs.ErrSyncRunning)
+}
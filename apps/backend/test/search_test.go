@@ -0,0 +1,69 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/author"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchTypes(t *testing.T) {
+	types, err := search.ParseTypes("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"books", "authors", "series"}, types)
+
+	types, err = search.ParseTypes(" Series, books ,series")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"books", "series"}, types, "canonical order without duplicates")
+
+	_, err = search.ParseTypes("books,users")
+	assert.Error(t, err)
+}
+
+func TestRank(t *testing.T) {
+	results := &search.Results{
+		Books: []book.Book{
+			{ID: 1, Title: "The Hobbit", Author: "J.R.R. Tolkien", Genre: "Fantasy"},
+			{ID: 2, Title: "Tolkien: A Biography", Author: "Humphrey Carpenter", Genre: "Biography"},
+			{ID: 3, Title: "Dune", Author: "Frank Herbert", Genre: "Fantasy"},
+		},
+		Authors: []author.Author{{ID: 7, Name: "J.R.R. Tolkien"}},
+		Series:  []book.Series{{ID: 9, Name: "Middle-earth", Description: "Tolkien's legendarium"}},
+	}
+
+	hits := search.Rank(results, "tolkien")
+	require.Len(t, hits, 5)
+
+	// Shorter documents with the term in the title rank first
+	assert.Equal(t, "authors", hits[0].Type)
+	assert.EqualValues(t, 7, hits[0].ID)
+	assert.Equal(t, "J.R.R. Tolkien", hits[0].Title)
+	assert.Equal(t, "books", hits[1].Type)
+	assert.EqualValues(t, 2, hits[1].ID)
+
+	last := hits[len(hits)-1]
+	assert.EqualValues(t, 3, last.ID, "no matching term")
+	assert.Zero(t, last.Score)
+	for i := 1; i < len(hits); i++ {
+		assert.GreaterOrEqual(t, hits[i-1].Score, hits[i].Score)
+	}
+}
+
+func TestRank_PrefixAndRareTerms(t *testing.T) {
+	results := &search.Results{
+		Books: []book.Book{
+			{ID: 1, Title: "Ring of Fire", Author: "Eric Flint"},
+			{ID: 2, Title: "Lord of the Rings", Author: "J.R.R. Tolkien"},
+		},
+	}
+
+	// "ring" is in both, "tolk" only in one, so it decides the order
+	hits := search.Rank(results, "ring tolk")
+	require.Len(t, hits, 2)
+	assert.EqualValues(t, 2, hits[0].ID)
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+	assert.Greater(t, hits[1].Score, 0.0)
+}
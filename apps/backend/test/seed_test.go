@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/seed"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const seedManifest = `
+users:
+  - match_by: username
+    username: admin
+    email: admin@booklibrary.com
+    password: $env:ADMIN_PASSWORD
+    role: admin
+books:
+  - match_by: isbn
+    title: Dune
+    author: Frank Herbert
+    year: 1965
+    isbn: 978-0-441-01359-3
+`
+
+func TestParseSeed_SubstitutesEnv(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "s3cret: with yaml")
+	m, err := seed.Parse([]byte(seedManifest))
+	require.NoError(t, err)
+	require.Len(t, m.Users, 1)
+	assert.Equal(t, "s3cret: with yaml", m.Users[0].Password)
+	require.Len(t, m.Books, 1)
+	assert.Equal(t, "978-0-441-01359-3", m.Books[0].ISBN)
+}
+
+func TestParseSeed_Invalid(t *testing.T) {
+	_, err := seed.Parse([]byte(seedManifest))
+	assert.ErrorContains(t, err, "ADMIN_PASSWORD is not set")
+
+	for name, manifest := range map[string]string{
+		"unknown match_by": "books:\n  - match_by: author\n    author: Jane Austen\n",
+		"empty match":      "books:\n  - match_by: isbn\n    title: Emma\n",
+		"missing password": "users:\n  - match_by: username\n    username: admin\n",
+		"unknown field":    "books:\n  - match_by: isbn\n    isbn: 978-0-441-01359-3\n    pages: 412\n",
+	} {
+		_, err := seed.Parse([]byte(manifest))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoadSeedFiles(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "change-me")
+	for _, path := range []string{"../seeds/development.yaml", "../seeds/production.yaml"} {
+		m, err := seed.LoadFile(path)
+		require.NoError(t, err, path)
+		assert.NotEmpty(t, m.Users, path)
+	}
+}
+
+// expectSeededRows makes the lookups of seedManifest find the admin and
+// Dune as they are in the manifest
+func expectSeededRows(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "username" = \$1`).
+		WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "role"}).AddRow(1, "admin", "admin@booklibrary.com", "admin"))
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "isbn" = \$1`).
+		WithArgs("978-0-441-01359-3").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author", "year", "isbn"}).AddRow(7, "Dune", "Frank Herbert", 1965, "978-0-441-01359-3"))
+}
+
+func TestApplySeed_RerunCreatesNothing(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "change-me")
+	conn, mock := mockDB(t)
+	mock.ExpectBegin()
+	expectSeededRows(mock)
+	mock.ExpectCommit()
+
+	m, err := seed.Parse([]byte(seedManifest))
+	require.NoError(t, err)
+	report, err := seed.Apply(context.Background(), conn, m, false)
+	require.NoError(t, err)
+
+	// sqlmock fails any INSERT or UPDATE it wasn't told to expect
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []seed.Change{
+		{Kind: "user", Key: "admin", Action: seed.ActionUnchanged},
+		{Kind: "book", Key: "978-0-441-01359-3", Action: seed.ActionUnchanged},
+	}, report.Changes)
+}
+
+func TestApplySeed_DryRunWritesNothing(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "change-me")
+	conn, mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author", "year", "isbn"}).AddRow(7, "Dune (old)", "Frank Herbert", 1965, "978-0-441-01359-3"))
+
+	m, err := seed.Parse([]byte("dry_run: true\n" + seedManifest))
+	require.NoError(t, err)
+	report, err := seed.Apply(context.Background(), conn, m, false)
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []seed.Change{
+		{Kind: "user", Key: "admin", Action: seed.ActionCreate},
+		{Kind: "book", Key: "978-0-441-01359-3", Action: seed.ActionUpdate},
+	}, report.Changes)
+}
+
+const genreManifest = `
+genres:
+  - name: Science Fiction
+    description: Speculative stories about science and technology
+  - name: Fantasy
+books:
+  - match_by: isbn
+    title: Dune
+    isbn: 978-0-441-01359-3
+    genre: science-fiction
+`
+
+func TestApplySeed_Genres(t *testing.T) {
+	conn, mock := mockDB(t)
+	// Science Fiction exists under another spelling and Fantasy is missing
+	mock.ExpectQuery(`SELECT \* FROM "genres" WHERE slug = \$1`).
+		WithArgs("science-fiction").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "description"}).AddRow(3, "science fiction", "science-fiction", ""))
+	mock.ExpectQuery(`SELECT \* FROM "genres" WHERE slug = \$1`).WithArgs("fantasy").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// Dune is filed under the genre already, in its stored spelling
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "isbn" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "isbn", "genre"}).AddRow(7, "Dune", "978-0-441-01359-3", "Science Fiction"))
+
+	m, err := seed.Parse([]byte("dry_run: true\n" + genreManifest))
+	require.NoError(t, err)
+	report, err := seed.Apply(context.Background(), conn, m, false)
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []seed.Change{
+		{Kind: "genre", Key: "science-fiction", Action: seed.ActionUpdate},
+		{Kind: "genre", Key: "fantasy", Action: seed.ActionCreate},
+		{Kind: "book", Key: "978-0-441-01359-3", Action: seed.ActionUnchanged},
+	}, report.Changes)
+
+	_, err = seed.Parse([]byte("genres:\n  - name: '???'\n"))
+	assert.Error(t, err)
+}
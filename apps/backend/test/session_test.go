@@ -0,0 +1,178 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTProtectedRejectsRevokedSessions(t *testing.T) {
+	revoked := map[string]bool{"revoked-session": true}
+	previous := middleware.SessionRevoked
+	middleware.SessionRevoked = func(id string) bool { return revoked[id] }
+	defer func() { middleware.SessionRevoked = previous }()
+
+	app := fiber.New()
+	app.Get("/me", middleware.JWTProtected(), func(c *fiber.Ctx) error {
+		id, _ := middleware.SessionID(c)
+		return c.SendString(id)
+	})
+
+	user := &auth.User{ID: 7, Username: "reader", Role: "user"}
+	expires := time.Now().Add(time.Hour)
+	request := func(token string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	active, err := auth.GenerateSessionJWT(user, &auth.Session{ID: "active-session", ExpiresAt: expires})
+	require.NoError(t, err)
+	resp := request(active)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	gone, err := auth.GenerateSessionJWT(user, &auth.Session{ID: "revoked-session", ExpiresAt: expires})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, request(gone).StatusCode)
+
+	legacy, err := auth.GenerateJWT(user)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, request(legacy).StatusCode, "tokens without a session still work")
+}
+
+func TestSessionTokenCarriesSessionID(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	token, err := auth.GenerateSessionJWT(&auth.User{ID: 7, Username: "reader", Role: "user"}, &auth.Session{ID: "abc", ExpiresAt: expires})
+	require.NoError(t, err)
+
+	parsed, err := middleware.ParseToken(token)
+	require.NoError(t, err)
+	exp, err := parsed.Claims.GetExpirationTime()
+	require.NoError(t, err)
+	assert.True(t, exp.Time.Equal(expires), "the token expires with its session")
+
+	app := fiber.New()
+	app.Get("/", middleware.JWTProtected(), func(c *fiber.Ctx) error {
+		id, ok := middleware.SessionID(c)
+		assert.True(t, ok)
+		return c.SendString(id)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func expectSessionQuery(mock sqlmock.Sqlmock, id string) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(`SELECT "revoked" FROM "sessions" WHERE id = \$1`).WithArgs(id)
+}
+
+func TestIsSessionRevoked_DatabaseDecidesOnCacheMiss(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := newMemoryCache()
+	h := auth.NewHandler(auth.NewDBStore(conn, nil), store, nil, nil)
+
+	// A revocation whose cache entry was evicted or lost in a restart
+	expectSessionQuery(mock, "evicted").WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(true))
+	assert.True(t, h.IsSessionRevoked("evicted"))
+
+	// A session whose row was deleted
+	expectSessionQuery(mock, "deleted").WillReturnRows(sqlmock.NewRows([]string{"revoked"}))
+	assert.True(t, h.IsSessionRevoked("deleted"))
+
+	// Fails closed while the database can't be read
+	expectSessionQuery(mock, "unreadable").WillReturnError(context.DeadlineExceeded)
+	assert.True(t, h.IsSessionRevoked("unreadable"))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.True(t, h.IsSessionRevoked("evicted"), "the database's answer is cached")
+	assert.NotContains(t, store.keys(), "auth:session:status:unreadable", "errors aren't cached")
+}
+
+func TestIsSessionRevoked_CachesActiveUntilRevoked(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := newMemoryCache()
+	h := auth.NewHandler(auth.NewDBStore(conn, nil), store, nil, nil)
+
+	expectSessionQuery(mock, "laptop").WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "sessions" SET "last_used_at"=\$1 WHERE id = \$2`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.False(t, h.IsSessionRevoked("laptop"))
+	assert.False(t, h.IsSessionRevoked("laptop"), "served from the cache")
+
+	mock.ExpectQuery(`SELECT \* FROM "sessions" WHERE id = \$1 AND user_id = \$2 AND revoked = \$3`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at"}).AddRow("laptop", 7, time.Now().Add(time.Hour)))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "sessions" SET "revoked"=\$1 WHERE id IN \(\$2\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, h.RevokeSession(context.Background(), 7, "laptop"))
+
+	assert.True(t, h.IsSessionRevoked("laptop"), "the revocation replaces the cached status")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteUser_RevokesSessions(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := newMemoryCache()
+	h := auth.NewHandler(auth.NewDBStore(conn, nil), store, nil, nil)
+
+	mock.ExpectQuery(`SELECT \* FROM "sessions" WHERE user_id = \$1 AND revoked = \$2 AND expires_at > \$3`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at"}).AddRow("laptop", 7, time.Now().Add(time.Hour)))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "sessions" SET "revoked"=\$1 WHERE id IN \(\$2\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	// Ratings are soft-deleted even without GDPR_ANONYMIZE
+	mock.ExpectExec(`UPDATE ratings SET deleted_at = \$1 WHERE user_id = \$2 AND deleted_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE "users" SET "deleted_at"=\$1 WHERE "users"."id" = \$2`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, h.SoftDeleteUser(context.Background(), 7))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Restoring the user doesn't bring the token back
+	assert.True(t, h.IsSessionRevoked("laptop"))
+}
+
+func TestRestoreUser_KeepsDatabaseErrors(t *testing.T) {
+	conn, mock := mockDB(t)
+	users := auth.NewDBStore(conn, nil)
+
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err := users.RestoreUser(context.Background(), 7)
+	assert.ErrorIs(t, err, auth.ErrUserNotFound)
+
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnError(context.DeadlineExceeded)
+	_, err = users.RestoreUser(context.Background(), 7)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreUser_RestoresRatings(t *testing.T) {
+	conn, mock := mockDB(t)
+	users := auth.NewDBStore(conn, nil)
+
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(7, "reader"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "deleted_at"=\$1,"updated_at"=\$2 WHERE id = \$3 AND deleted_at IS NOT NULL`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE ratings SET deleted_at = NULL WHERE user_id = \$1 AND deleted_at IS NOT NULL`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	user, err := users.RestoreUser(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, "reader", user.Username)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/singleflight"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// concurrentRequests is how many identical requests the tests fire at once
+const concurrentRequests = 50
+
+// loaderStore loads books with stubs and counts the calls
+type loaderStore struct {
+	book.Store
+	loadBook  func(ctx context.Context, id uint) (*book.Book, error)
+	loadBooks func(ctx context.Context, search string) ([]book.Book, error)
+	calls     int32
+}
+
+func (s *loaderStore) LoadBook(ctx context.Context, id uint) (*book.Book, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.loadBook(ctx, id)
+}
+
+func (s *loaderStore) LoadBooks(ctx context.Context, search string) ([]book.Book, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.loadBooks(ctx, search)
+}
+
+// stubLoadBook returns a store loading single books with load
+func stubLoadBook(load func(ctx context.Context, id uint) (*book.Book, error)) *loaderStore {
+	return &loaderStore{loadBook: load}
+}
+
+// slowBook is a database that takes long enough for every concurrent
+// request to miss while the first one is loading
+func slowBook(ctx context.Context, id uint) (*book.Book, error) {
+	time.Sleep(200 * time.Millisecond)
+	return &book.Book{ID: id, Title: "Dune"}, nil
+}
+
+// getConcurrently fires n requests for target at once and returns their
+// status codes
+func getConcurrently(t testing.TB, app *fiber.App, target string, n int) []int {
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil), -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses[i] = resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// bookApp serves the book routes from store and c
+func bookApp(store book.Store, c cache.Cache) *fiber.App {
+	h := book.NewBookHandler(store, c, nil, nil)
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Get("/books", h.GetBooks)
+	app.Get("/books/:id", h.GetBook)
+	return app
+}
+
+func TestGetBook_ConcurrentMissesShareOneQuery(t *testing.T) {
+	store := stubLoadBook(slowBook)
+
+	for _, status := range getConcurrently(t, bookApp(store, nil), "/books/1", concurrentRequests) {
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&store.calls))
+}
+
+func TestGetBook_SingleflightSharesErrors(t *testing.T) {
+	store := stubLoadBook(func(ctx context.Context, id uint) (*book.Book, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, gorm.ErrRecordNotFound
+	})
+	app := bookApp(store, nil)
+
+	for _, status := range getConcurrently(t, app, "/books/404", concurrentRequests) {
+		assert.Equal(t, http.StatusNotFound, status)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&store.calls))
+
+	// The failure isn't remembered once the call is over
+	getConcurrently(t, app, "/books/404", 1)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&store.calls))
+}
+
+func TestGetBooks_ConcurrentMissesShareOneQuery(t *testing.T) {
+	memory := newMemoryCache()
+	store := stubLoadBooks(func(ctx context.Context, search string) ([]book.Book, error) {
+		time.Sleep(200 * time.Millisecond)
+		return []book.Book{{ID: 1, Title: search}}, nil
+	})
+
+	app := bookApp(store, memory)
+	for _, status := range getConcurrently(t, app, "/books?search=dune", concurrentRequests) {
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&store.calls))
+	assert.Equal(t, []string{"books:search:dune"}, memory.keys())
+
+	// Different searches aren't coalesced
+	getConcurrently(t, app, "/books?search=emma", 1)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&store.calls))
+}
+
+func TestGroup_CallerCancellationDoesNotFailOthers(t *testing.T) {
+	var group singleflight.Group
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := group.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "done", ctx.Err()
+		})
+		first <- err
+	}()
+	<-started
+
+	second := make(chan interface{}, 1)
+	go func() {
+		v, _, err := group.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+			return "second call", nil
+		})
+		assert.NoError(t, err)
+		second <- v
+	}()
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	require.NoError(t, <-first)
+	assert.Equal(t, "done", <-second)
+}
+
+// BenchmarkGetBookSingleflight fires concurrentRequests requests for the
+// same uncached book per iteration and checks they cost one query
+func BenchmarkGetBookSingleflight(b *testing.B) {
+	store := stubLoadBook(func(ctx context.Context, id uint) (*book.Book, error) {
+		time.Sleep(20 * time.Millisecond)
+		return &book.Book{ID: id, Title: "Dune"}, nil
+	})
+	app := bookApp(store, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		atomic.StoreInt32(&store.calls, 0)
+		getConcurrently(b, app, fmt.Sprintf("/books/%d", i+1), concurrentRequests)
+		if n := atomic.LoadInt32(&store.calls); n != 1 {
+			b.Fatalf("LoadBook called %d times, want 1", n)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetRemaining(t *testing.T) {
+	assert.Equal(t, 1.0, metrics.BudgetRemaining(0, 0), "no traffic spends no budget")
+	assert.Equal(t, 1.0, metrics.BudgetRemaining(10, 0))
+	assert.InDelta(t, 0.75, metrics.BudgetRemaining(4, 1), 1e-9)
+	assert.Equal(t, 0.0, metrics.BudgetRemaining(5, 5))
+}
+
+func TestSLOTrackerCountsSlowRequests(t *testing.T) {
+	tracker := metrics.NewSLOTracker(map[string]time.Duration{
+		"GET /books":     200 * time.Millisecond,
+		"GET /books/:id": 50 * time.Millisecond,
+	})
+
+	tracker.Record("GET /books", 100*time.Millisecond)
+	tracker.Record("GET /books", 200*time.Millisecond) // at the target is not slow
+	tracker.Record("GET /books", 300*time.Millisecond)
+	tracker.Record("GET /books", 150*time.Millisecond)
+	tracker.Record("GET /books/:id", 80*time.Millisecond)
+	tracker.Record("GET /health", time.Second) // no target
+
+	budgets := tracker.Budgets()
+	require.Len(t, budgets, 2)
+
+	assert.Equal(t, metrics.SLOBudget{
+		Endpoint: "GET /books", TargetMs: 200, Total: 4, Slow: 1, BudgetRemaining: 0.75,
+	}, budgets[0])
+	assert.Equal(t, "GET /books/:id", budgets[1].Endpoint)
+	assert.Equal(t, 0.0, budgets[1].BudgetRemaining)
+}
+
+func TestSLOTrackerReportsLowBudgetOnce(t *testing.T) {
+	tracker := metrics.NewSLOTracker(map[string]time.Duration{"POST /books": 500 * time.Millisecond})
+	assert.Empty(t, tracker.Update())
+
+	tracker.Record("POST /books", time.Second)
+	dropped := tracker.Update()
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "POST /books", dropped[0].Endpoint)
+	assert.True(t, dropped[0].Low())
+
+	tracker.Record("POST /books", time.Second)
+	assert.Empty(t, tracker.Update(), "still low, already reported")
+
+	for i := 0; i < 20; i++ {
+		tracker.Record("POST /books", time.Millisecond)
+	}
+	assert.Empty(t, tracker.Update(), "recovered")
+
+	for i := 0; i < 200; i++ {
+		tracker.Record("POST /books", time.Second)
+	}
+	assert.Len(t, tracker.Update(), 1, "reported again after recovering")
+}
+
+func TestParseSLOTargets(t *testing.T) {
+	targets, err := metrics.ParseSLOTargets(`{"GET /books": "200ms", "GET /authors": "1s"}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"GET /books":   200 * time.Millisecond,
+		"GET /authors": time.Second,
+	}, targets)
+
+	for _, raw := range []string{`not json`, `{"GET /books": "fast"}`, `{"GET /books": "-1s"}`} {
+		_, err := metrics.ParseSLOTargets(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestGetSLOHandler(t *testing.T) {
+	tracker := metrics.NewSLOTracker(map[string]time.Duration{"GET /books": 200 * time.Millisecond})
+	tracker.Record("GET /books", time.Second)
+	tracker.Record("GET /books", time.Millisecond)
+
+	app := fiber.New()
+	app.Get("/admin/slo", metrics.GetSLOHandler(tracker))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/slo", nil))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var body metrics.SLOResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Budgets, 1)
+	assert.Equal(t, 0.5, body.Budgets[0].BudgetRemaining)
+	assert.Equal(t, metrics.SLOLowBudget, body.LowBudget)
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowCache delays reads like a network round trip to Redis would
+type slowCache struct {
+	*memoryCache
+	delay time.Duration
+}
+
+func (s slowCache) Get(key string, dest interface{}) error {
+	time.Sleep(s.delay)
+	return s.memoryCache.Get(key, dest)
+}
+
+// stubLoadBooks returns a store loading book lists with load
+func stubLoadBooks(load func(ctx context.Context, search string) ([]book.Book, error)) *loaderStore {
+	return &loaderStore{loadBooks: load}
+}
+
+func TestFetchBooksSpeculative_MissUsesDatabase(t *testing.T) {
+	want := []book.Book{{ID: 1, Title: "Dune"}, {ID: 2, Title: "Emma"}}
+	store := stubLoadBooks(func(ctx context.Context, search string) ([]book.Book, error) {
+		assert.Equal(t, "du", search)
+		return want, nil
+	})
+
+	books, hit, err := book.FetchBooksSpeculative(context.Background(), newMemoryCache(), store.LoadBooks, "books:search:du", "du")
+	require.NoError(t, err)
+	assert.False(t, hit)
+	assert.Equal(t, want, books)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&store.calls))
+}
+
+func TestFetchBooksSpeculative_HitCancelsDatabase(t *testing.T) {
+	memory := newMemoryCache()
+	want := []book.Book{{ID: 3, Title: "Cached"}}
+	require.NoError(t, memory.Set("books:all", want, time.Minute))
+
+	cancelled := make(chan struct{})
+	load := func(ctx context.Context, search string) ([]book.Book, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	books, hit, err := book.FetchBooksSpeculative(context.Background(), memory, load, "books:all", "")
+	require.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, want, books)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("database query was not cancelled after a cache hit")
+	}
+}
+
+func TestFetchBooksSpeculative_DatabaseError(t *testing.T) {
+	load := func(ctx context.Context, search string) ([]book.Book, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	_, hit, err := book.FetchBooksSpeculative(context.Background(), newMemoryCache(), load, "books:all", "")
+	assert.EqualError(t, err, "connection refused")
+	assert.False(t, hit)
+}
+
+func TestGetBooks_SpeculativeMatchesSequential(t *testing.T) {
+	want := []book.Book{{ID: 1, Title: "Dune", Author: "Frank Herbert", Year: 1965}}
+	store := stubLoadBooks(func(ctx context.Context, search string) ([]book.Book, error) {
+		return want, nil
+	})
+
+	get := func(c cache.Cache) string {
+		resp, err := bookApp(store, c).Test(httptest.NewRequest(http.MethodGet, "/books?search=dune", nil))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	sequential := get(newMemoryCache())
+
+	book.SpeculativeSearch = true
+	defer func() { book.SpeculativeSearch = false }()
+	memory := newMemoryCache()
+	assert.JSONEq(t, sequential, get(memory), "cache miss")
+	assert.JSONEq(t, sequential, get(memory), "cache hit")
+	assert.Len(t, memory.keys(), 1, "the miss populated the cache")
+}
+
+// BenchmarkGetBooksSpeculative compares sequential and speculative lookups
+// with half of the requests hitting a cache 200µs away and the rest going
+// to a database that takes 1ms
+func BenchmarkGetBooksSpeculative(b *testing.B) {
+	store := stubLoadBooks(func(ctx context.Context, search string) ([]book.Book, error) {
+		select {
+		case <-time.After(time.Millisecond):
+			return []book.Book{{ID: 1, Title: search}}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	for _, speculative := range []bool{false, true} {
+		name := "sequential"
+		if speculative {
+			name = "speculative"
+		}
+		b.Run(name, func(b *testing.B) {
+			memory := newMemoryCache()
+			for i := 0; i < b.N; i += 2 {
+				memory.Set(fmt.Sprintf("books:search:q%d", i), []book.Book{{ID: 1}}, time.Minute)
+			}
+			book.SpeculativeSearch = speculative
+			defer func() { book.SpeculativeSearch = false }()
+
+			app := bookApp(store, slowCache{memory, 200 * time.Microsecond})
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/books?search=q%d", i), nil))
+				if err != nil || resp.StatusCode != http.StatusOK {
+					b.Fatal(err, resp.StatusCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/startup"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline_RecordsDurationsAndErrors(t *testing.T) {
+	timeline := startup.NewTimeline()
+	require.NoError(t, timeline.Record("redis", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}))
+	refused := errors.New("connection refused")
+	assert.Equal(t, refused, timeline.Record("database", func() error { return refused }))
+
+	entries := timeline.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "redis", entries[0].Component)
+	assert.GreaterOrEqual(t, entries[0].Duration, 20*time.Millisecond)
+	assert.NoError(t, entries[0].Error)
+	assert.Equal(t, startup.StatusOK, entries[0].Status())
+	assert.Equal(t, "database", entries[1].Component)
+	assert.Equal(t, refused, entries[1].Error)
+	assert.Equal(t, startup.StatusFailed, entries[1].Status())
+
+	assert.True(t, timeline.Failed())
+	assert.Equal(t, entries[0].Duration+entries[1].Duration, timeline.Total())
+	summary := timeline.Summary()
+	assert.Equal(t, startup.StatusFailed, summary.Status)
+	assert.Equal(t, "connection refused", summary.Components[1].Error)
+}
+
+func TestTimeline_Handler(t *testing.T) {
+	timeline := startup.NewTimeline()
+	timeline.Record("migrations", func() error { return nil })
+
+	app := fiber.New()
+	app.Get("/admin/startup-timeline", startup.Handler(timeline))
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/startup-timeline", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Status     string `json:"status"`
+		Components []struct {
+			Component string  `json:"component"`
+			Duration  float64 `json:"duration_ms"`
+			Status    string  `json:"status"`
+			Error     *string `json:"error"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "ok", body.Status)
+	require.Len(t, body.Components, 1)
+	assert.Equal(t, "migrations", body.Components[0].Component)
+	assert.Equal(t, "ok", body.Components[0].Status)
+	assert.Nil(t, body.Components[0].Error)
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectBookBatches makes the batched queries of book.StreamBooks return
+// total books, batchSize per query
+func expectBookBatches(mock sqlmock.Sqlmock, total, batchSize int) {
+	for start := 0; start <= total; start += batchSize {
+		rows := sqlmock.NewRows(bookColumns)
+		for id := start + 1; id <= total && id <= start+batchSize; id++ {
+			rows.AddRow(id, fmt.Sprintf("Book %d", id), "Author", 2000, "available", 1)
+		}
+		mock.ExpectQuery(`SELECT \* FROM "books"`).WillReturnRows(rows)
+		if total-start < batchSize {
+			return
+		}
+	}
+}
+
+func TestWriteBooksNDJSON(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	expectBookBatches(mock, 250, 100)
+
+	var buf bytes.Buffer
+	written, err := book.WriteBooksNDJSON(context.Background(), store, bufio.NewWriter(&buf), 100, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 250, written)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	scanner := bufio.NewScanner(&buf)
+	id := uint(0)
+	for scanner.Scan() {
+		var b book.Book
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &b))
+		id++
+		assert.Equal(t, id, b.ID)
+	}
+	assert.Equal(t, uint(250), id)
+}
+
+// heapSampler is a writer that discards what it is given and, every
+// sampleEvery writes, records the live heap
+type heapSampler struct {
+	writes      int
+	sampleEvery int
+	peak        uint64
+}
+
+func liveHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func (s *heapSampler) Write(p []byte) (int, error) {
+	s.writes++
+	if s.writes%s.sampleEvery == 0 {
+		if heap := liveHeap(); heap > s.peak {
+			s.peak = heap
+		}
+	}
+	return len(p), nil
+}
+
+// The stream holds one batch of books at a time, however many there are
+func TestWriteBooksNDJSON_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const total = 20000
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	expectBookBatches(mock, total, book.StreamBatchSize)
+
+	baseline := liveHeap()
+	sampler := &heapSampler{sampleEvery: 25}
+	written, err := book.WriteBooksNDJSON(context.Background(), store, bufio.NewWriter(io.Writer(sampler)), book.StreamBatchSize, 0)
+	require.NoError(t, err)
+	require.Equal(t, total, written)
+	require.NotZero(t, sampler.peak)
+
+	// Holding every book would take several MB; one batch takes tens of KB
+	growth := int64(sampler.peak) - int64(baseline)
+	assert.Less(t, growth, int64(2<<20), "live heap grew by %d bytes while streaming %d books", growth, total)
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/requestlog"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamMediaTypes are the media types main lets through content
+// negotiation
+var streamMediaTypes = []string{requestlog.ContentTypeEventStream, book.ContentTypeNDJSON}
+
+// responseStackApp has the global middleware of main that act on the Accept
+// header or the response body, in main's order, with the envelope always on
+func responseStackApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Use(middleware.CancelOnClientClose())
+	app.Use(middleware.TraceContext())
+	app.Use(middleware.Baggage())
+	app.Use(middleware.Compression(middleware.CompressionConfig{Algorithm: middleware.CompressionAuto}))
+	app.Use(middleware.ContentNegotiation(middleware.ContentNegotiationConfig{Passthrough: streamMediaTypes}))
+	app.Use(middleware.Envelope(middleware.EnvelopeConfig{Enabled: true}))
+	app.Use(middleware.Sanitize())
+	return app
+}
+
+func serve(t *testing.T, app *fiber.App) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+func TestResponseStack_LiveRequests(t *testing.T) {
+	tail := requestlog.NewTail(requestlog.DefaultBufferSize)
+	app := responseStackApp()
+	app.Get("/admin/requests/live", middleware.TokenFromQuery(), middleware.JWTProtected(), middleware.RequireAdmin(), requestlog.LiveHandler(tail))
+	base := serve(t, app)
+
+	// What a browser's EventSource sends
+	header := http.Header{
+		"Accept":          {requestlog.ContentTypeEventStream},
+		"Accept-Encoding": {"gzip, deflate, br"},
+	}
+	stream := openLiveRequests(t, tail, base+"/admin/requests/live?access_token="+signedToken(t, "admin"), header)
+	tail.Publish(requestlog.NewEvent(http.MethodGet, "/books", http.StatusOK, 0, "127.0.0.1"))
+
+	events := readSSE(t, stream, 1)
+	assert.Equal(t, "/books", events[0].Data.Path)
+}
+
+func TestResponseStack_BookStream(t *testing.T) {
+	conn, mock := mockDB(t)
+	expectBookBatches(mock, 3, book.StreamBatchSize)
+	app := responseStackApp()
+	app.Get("/books/stream", book.NewBookHandler(book.NewDBStore(conn, nil), nil, nil, nil).StreamBooks)
+
+	req, err := http.NewRequest(http.MethodGet, serve(t, app)+"/books/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", book.ContentTypeNDJSON)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, book.ContentTypeNDJSON, resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	var ids []uint
+	for scanner.Scan() {
+		var b book.Book
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &b))
+		ids = append(ids, b.ID)
+	}
+	assert.Equal(t, []uint{1, 2, 3}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResponseStack_RejectsUnservedMediaTypes(t *testing.T) {
+	app := responseStackApp()
+	app.Get("/books", func(c *fiber.Ctx) error { return c.JSON([]string{}) })
+
+	req, err := http.NewRequest(http.MethodGet, serve(t, app)+"/books", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/csv")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+}
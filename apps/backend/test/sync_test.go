@@ -0,0 +1,49 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postSync(t *testing.T, body []byte) int {
+	app := fiber.New(fiber.Config{ErrorHandler: apierrors.ErrorHandler})
+	app.Post("/admin/books/sync", book.NewBookHandler(newFakeBookStore(), nil, nil, nil).SyncBooks)
+	req := httptest.NewRequest("POST", "/admin/books/sync", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestSyncBooksHandler_RejectsOversizedCatalog(t *testing.T) {
+	books := make([]book.SyncBook, book.MaxSyncBooks+1)
+	body, err := json.Marshal(books)
+	require.NoError(t, err)
+	assert.Equal(t, 400, postSync(t, body))
+}
+
+func TestSyncBooksHandler_RejectsNonArray(t *testing.T) {
+	assert.Equal(t, 400, postSync(t, []byte(`{"title":"Dune"}`)))
+}
+
+func TestSyncErrors_RoundTrip(t *testing.T) {
+	errs := book.SyncErrors{{Index: 3, ISBN: "978-0-441-01359-3", Error: "year is required"}}
+	value, err := errs.Value()
+	require.NoError(t, err)
+
+	var scanned book.SyncErrors
+	require.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, errs, scanned)
+
+	empty, err := book.SyncErrors(nil).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "[]", empty)
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/tracing"
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sampleTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	sampleParentID    = "00f067aa0ba902b7"
+	sampleTraceparent = "00-" + sampleTraceID + "-" + sampleParentID + "-01"
+)
+
+var traceparentPattern = regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+func TestGeneratedIDs(t *testing.T) {
+	traceID, spanID := tracing.TraceID(), tracing.SpanID()
+	assert.Regexp(t, `^[0-9a-f]{32}$`, traceID)
+	assert.Regexp(t, `^[0-9a-f]{16}$`, spanID)
+	assert.NotEqual(t, traceID, tracing.TraceID())
+	assert.NotEqual(t, spanID, tracing.SpanID())
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := tracing.ParseTraceparent(sampleTraceparent)
+	require.NoError(t, err)
+	assert.Equal(t, sampleTraceID, sc.TraceID)
+	assert.Equal(t, sampleParentID, sc.SpanID)
+	assert.Equal(t, tracing.FlagSampled, sc.Flags)
+	assert.Equal(t, sampleTraceparent, sc.Traceparent())
+
+	// Future versions may append fields
+	_, err = tracing.ParseTraceparent("01-" + sampleTraceID + "-" + sampleParentID + "-00-extra")
+	assert.NoError(t, err)
+
+	invalid := []string{
+		"",
+		"garbage",
+		"00-" + sampleTraceID + "-" + sampleParentID,
+		"00-" + sampleTraceID + "-" + sampleParentID + "-01-extra",
+		"ff-" + sampleTraceID + "-" + sampleParentID + "-01",
+		"00-00000000000000000000000000000000-" + sampleParentID + "-01",
+		"00-" + sampleTraceID + "-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-" + sampleParentID + "-01",
+		"00-" + sampleTraceID + "-" + sampleParentID + "-zz",
+	}
+	for _, value := range invalid {
+		_, err := tracing.ParseTraceparent(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func traceApp(handler fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.TraceContext())
+	app.Get("/", handler)
+	return app
+}
+
+func TestTraceContextContinuesIncomingTrace(t *testing.T) {
+	var locals map[string]interface{}
+	var fromCtx tracing.SpanContext
+	app := traceApp(func(c *fiber.Ctx) error {
+		locals = map[string]interface{}{
+			"trace_id":       c.Locals(middleware.TraceIDKey),
+			"span_id":        c.Locals(middleware.SpanIDKey),
+			"parent_span_id": c.Locals(middleware.ParentSpanIDKey),
+		}
+		fromCtx, _ = tracing.FromContext(c.UserContext())
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", sampleTraceparent)
+	req.Header.Set("tracestate", "vendor=abc")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, sampleTraceID, locals["trace_id"])
+	assert.Equal(t, sampleParentID, locals["parent_span_id"])
+	assert.Regexp(t, `^[0-9a-f]{16}$`, locals["span_id"])
+	assert.NotEqual(t, sampleParentID, locals["span_id"])
+
+	assert.Equal(t, locals["span_id"], fromCtx.SpanID)
+	assert.Equal(t, "vendor=abc", fromCtx.State)
+
+	out, err := tracing.ParseTraceparent(resp.Header.Get("traceparent"))
+	require.NoError(t, err)
+	assert.Equal(t, sampleTraceID, out.TraceID)
+	assert.Equal(t, locals["span_id"], out.SpanID)
+}
+
+func TestTraceContextStartsNewTrace(t *testing.T) {
+	for _, header := range []string{"", "00-not-a-valid-header"} {
+		var traceID interface{}
+		var parent interface{}
+		app := traceApp(func(c *fiber.Ctx) error {
+			traceID = c.Locals(middleware.TraceIDKey)
+			parent = c.Locals(middleware.ParentSpanIDKey)
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("traceparent", header)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		assert.Regexp(t, `^[0-9a-f]{32}$`, traceID)
+		assert.Nil(t, parent)
+		assert.Regexp(t, traceparentPattern, resp.Header.Get("traceparent"))
+	}
+}
+
+func TestWebhookSendPropagatesTrace(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	sc := tracing.Continue(sampleTraceparent, "vendor=abc")
+	ctx := tracing.NewContext(context.Background(), sc)
+	_, err := webhook.Send(ctx, server.URL, "secret", webhook.EventBookCreated, "evt-trace", []byte(`{}`))
+	require.NoError(t, err)
+
+	select {
+	case header := <-received:
+		assert.Equal(t, "00-"+sampleTraceID+"-"+sc.SpanID+"-01", header.Get("traceparent"))
+		assert.Equal(t, "vendor=abc", header.Get("tracestate"))
+	case <-time.After(time.Second):
+		t.Fatal("webhook not received")
+	}
+
+	// Without a span nothing is injected
+	_, err = webhook.Send(context.Background(), server.URL, "secret", webhook.EventBookCreated, "evt-plain", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Empty(t, (<-received).Get("traceparent"))
+}
+
+func TestLogEntryIncludesTrace(t *testing.T) {
+	var out bytes.Buffer
+	l := logger.NewLogger()
+	l.SetOutput(&out)
+	l.SetJSONFormat(true)
+
+	app := traceApp(func(c *fiber.Ctx) error {
+		l.LogRequest(c.Method(), c.Path(), c.IP(), "", 200, time.Millisecond, middleware.TraceFields(c))
+		return nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", sampleTraceparent)
+	_, err := app.Test(req)
+	require.NoError(t, err)
+
+	var entry logger.LogEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, sampleTraceID, entry.TraceID)
+	assert.Regexp(t, `^[0-9a-f]{16}$`, entry.SpanID)
+	assert.NotContains(t, entry.Data, "trace_id")
+	assert.Equal(t, "GET", entry.Data["method"])
+}
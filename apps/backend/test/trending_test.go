@@ -0,0 +1,203 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/analytics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sortedSetCache keeps sorted sets in maps, like Redis would. ZAdd members
+// are stored as JSON, the others raw.
+type sortedSetCache struct {
+	cache.Cache
+	mu   sync.Mutex
+	sets map[string]map[string]float64
+	ttls map[string]time.Duration
+}
+
+func newSortedSetCache() *sortedSetCache {
+	return &sortedSetCache{sets: map[string]map[string]float64{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *sortedSetCache) set(key string) map[string]float64 {
+	if s.sets[key] == nil {
+		s.sets[key] = map[string]float64{}
+	}
+	return s.sets[key]
+}
+
+func (s *sortedSetCache) ZAdd(key string, score float64, member interface{}) error {
+	encoded, err := json.Marshal(member)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key)[string(encoded)] = score
+	return nil
+}
+
+func (s *sortedSetCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key)[member] += increment
+	return s.sets[key][member], nil
+}
+
+func (s *sortedSetCache) ZRem(key string, members ...interface{}) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed int64
+	for _, member := range members {
+		if _, ok := s.sets[key][member.(string)]; ok {
+			delete(s.sets[key], member.(string))
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *sortedSetCache) ZRevRangeWithScores(key string, start, stop int64) ([]cache.ScoredMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := make([]cache.ScoredMember, 0, len(s.sets[key]))
+	for member, score := range s.sets[key] {
+		members = append(members, cache.ScoredMember{Member: member, Score: score})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Score > members[j].Score })
+	if stop < 0 || stop >= int64(len(members)) {
+		stop = int64(len(members)) - 1
+	}
+	if start > stop {
+		return []cache.ScoredMember{}, nil
+	}
+	return members[start : stop+1], nil
+}
+
+func (s *sortedSetCache) Expire(key string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttls[key] = expiration
+	return nil
+}
+
+func (s *sortedSetCache) Incr(key string) (int64, error) { return 1, nil }
+
+func (s *sortedSetCache) PFAdd(key string, elements ...interface{}) error { return nil }
+
+// addHourlyViews simulates views of book id in the hour of t
+func addHourlyViews(c *sortedSetCache, t time.Time, id uint, views int) {
+	for i := 0; i < views; i++ {
+		c.ZIncrBy(book.HourlyViewsKey(t), 1, strconv.FormatUint(uint64(id), 10))
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	assert.Equal(t, 9.0, analytics.Velocity(100, 10))
+	assert.Equal(t, -0.5, analytics.Velocity(5, 10))
+	// A book new this hour is compared with a single view
+	assert.Equal(t, 6.0, analytics.Velocity(7, 0))
+	assert.Equal(t, 0.0, analytics.Velocity(1, 0))
+}
+
+func TestRecordView_CountsHourlyViews(t *testing.T) {
+	c := newSortedSetCache()
+	h := book.NewBookHandler(newFakeBookStore(), c, nil, nil)
+
+	h.RecordView(7, "")
+	h.RecordView(7, "")
+	h.RecordView(8, "")
+
+	hourly := book.HourlyViewsKey(time.Now())
+	assert.Equal(t, map[string]float64{"7": 2, "8": 1}, c.sets[hourly])
+	assert.Equal(t, 48*time.Hour, c.ttls[hourly])
+	assert.Regexp(t, `^books:views:hour:\d{10}$`, hourly)
+}
+
+func TestUpdateTrending(t *testing.T) {
+	c := newSortedSetCache()
+	h := analytics.NewHandler(nil, c, nil)
+	now := time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+
+	// 1 grew from 10 to 100 views an hour, 2 from 0 to 7, 3 is popular but
+	// steady, 4 is new but barely read, 5 slowed down
+	addHourlyViews(c, before, 1, 10)
+	addHourlyViews(c, now, 1, 100)
+	addHourlyViews(c, now, 2, 7)
+	addHourlyViews(c, before, 3, 500)
+	addHourlyViews(c, now, 3, 600)
+	addHourlyViews(c, now, 4, 3)
+	addHourlyViews(c, before, 5, 50)
+
+	count, err := h.UpdateTrending(now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, map[string]float64{"1": 9, "2": 6}, c.sets[analytics.TrendingKey])
+
+	// An hour later book 1 is steady and book 3 spikes; book 1 drops out
+	later := now.Add(time.Hour)
+	addHourlyViews(c, later, 1, 100)
+	addHourlyViews(c, later, 3, 6000)
+	count, err = h.UpdateTrending(later)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, map[string]float64{"3": 9}, c.sets[analytics.TrendingKey])
+}
+
+func TestUpdateTrending_Threshold(t *testing.T) {
+	c := newSortedSetCache()
+	h := analytics.NewHandler(nil, c, nil)
+	previous := analytics.VelocityThreshold
+	analytics.VelocityThreshold = 1
+	t.Cleanup(func() { analytics.VelocityThreshold = previous })
+
+	now := time.Now()
+	addHourlyViews(c, now.Add(-time.Hour), 1, 10)
+	addHourlyViews(c, now, 1, 25)
+
+	count, err := h.UpdateTrending(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestGetTrendingBooksHandler(t *testing.T) {
+	conn, mock := mockDB(t)
+	c := newSortedSetCache()
+	h := analytics.NewHandler(conn, c, nil)
+	require.NoError(t, c.ZAdd(analytics.TrendingKey, 9, 7))
+	require.NoError(t, c.ZAdd(analytics.TrendingKey, 12.5, 8))
+	// 9 was deleted since it started trending
+	require.NoError(t, c.ZAdd(analytics.TrendingKey, 20, 9))
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE id IN \(\$1,\$2,\$3\)`).
+		WithArgs(9, 8, 7).
+		WillReturnRows(sqlmock.NewRows(bookColumns).
+			AddRow(7, "Dune", "Frank Herbert", 1965, "available", 1).
+			AddRow(8, "Emma", "Jane Austen", 1815, "available", 1))
+
+	app := fiber.New()
+	app.Get("/books/trending", h.GetTrendingBooks)
+	resp, err := app.Test(httptest.NewRequest("GET", "/books/trending?limit=10", nil))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var trending []analytics.TrendingBook
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&trending))
+	require.Len(t, trending, 2)
+	assert.Equal(t, "Emma", trending[0].Title)
+	assert.Equal(t, 12.5, trending[0].Velocity)
+	assert.Equal(t, "Dune", trending[1].Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
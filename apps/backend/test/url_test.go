@@ -0,0 +1,77 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalizeStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"lowercases the scheme", "HTTPS://example.com/a", "https://example.com/a"},
+		{"lowercases the host", "https://Example.COM/a", "https://example.com/a"},
+		{"keeps the path's case", "https://example.com/Path/To", "https://example.com/Path/To"},
+		{"drops port 80 for http", "http://example.com:80/a", "http://example.com/a"},
+		{"drops port 443 for https", "https://example.com:443/a", "https://example.com/a"},
+		{"keeps port 443 for http", "http://example.com:443/a", "http://example.com:443/a"},
+		{"keeps other ports", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"drops an empty port", "https://example.com:/a", "https://example.com/a"},
+		{"removes a trailing slash", "https://example.com/a/", "https://example.com/a"},
+		{"removes repeated trailing slashes", "https://example.com/a///", "https://example.com/a"},
+		{"removes the root slash", "https://example.com/", "https://example.com"},
+		{"drops the query and fragment", "https://example.com/a?b=1#c", "https://example.com/a"},
+		{"decodes escaped letters", "https://example.com/%41%62c", "https://example.com/Abc"},
+		{"decodes escaped unreserved marks", "https://example.com/%7Euser%2Dname%5F%2E", "https://example.com/~user-name_."},
+		{"uppercases escapes it keeps", "https://example.com/a%2fb", "https://example.com/a%2Fb"},
+		{"keeps escaped reserved characters", "https://example.com/a%3Fb%23c", "https://example.com/a%3Fb%23c"},
+		{"encodes spaces", "https://example.com/a b", "https://example.com/a%20b"},
+		{"encodes non-ASCII characters", "https://example.com/café", "https://example.com/caf%C3%A9"},
+		{"keeps characters allowed in a path", "https://example.com/a:b@c!$&'()*+,;=", "https://example.com/a:b@c!$&'()*+,;="},
+		{"lowercases IPv6 hosts and drops their default port", "http://[2001:DB8::1]:80/a", "http://[2001:db8::1]/a"},
+		{"keeps user info", "https://Bob@Example.com/a", "https://Bob@example.com/a"},
+		{"normalizes everything at once", "HTTP://EXAMPLE.COM:80/Path/", "http://example.com/Path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := url.CanonicalizeStrict(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			again, err := url.CanonicalizeStrict(got)
+			require.NoError(t, err)
+			assert.Equal(t, got, again, "canonical URLs are stable")
+		})
+	}
+}
+
+func TestCanonicalizeStrict_Errors(t *testing.T) {
+	for _, raw := range []string{"", "example.com/a", "/a/b", "https://example.com/%zz", "https://exa mple.com/"} {
+		_, err := url.CanonicalizeStrict(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestCanonicalizeStrict_KeepTrailingSlash(t *testing.T) {
+	url.StripTrailingSlash = false
+	t.Cleanup(func() { url.StripTrailingSlash = true })
+
+	got, err := url.CanonicalizeStrict("HTTPS://EXAMPLE.COM:443/Path/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/Path/", got)
+}
+
+func TestCleanURL_StrictCanonical(t *testing.T) {
+	got, err := url.CleanURL("HTTP://EXAMPLE.COM:80/Path/?q=1", "strict_canonical")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/Path", got)
+
+	got, err = url.CleanURL("HTTP://EXAMPLE.COM:80/Path/?q=1", "canonical")
+	require.NoError(t, err)
+	assert.Equal(t, "http://EXAMPLE.COM:80/Path", got, "canonical only drops the query, fragment and trailing slash")
+}
@@ -0,0 +1,218 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/auth"
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func fieldTags(errs []apierrors.FieldError) map[string]string {
+	tags := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		tags[fe.Field] = fe.Tag
+	}
+	return tags
+}
+
+func TestValidateStruct(t *testing.T) {
+	nextYear := time.Now().Year() + 1
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected map[string]string
+	}{
+		{
+			name:     "Valid register request",
+			input:    &auth.RegisterRequest{Username: "alice", Password: "secret1", Email: "alice@example.com"},
+			expected: map[string]string{},
+		},
+		{
+			name:     "Register without email",
+			input:    &auth.RegisterRequest{Username: "alice", Password: "secret1"},
+			expected: map[string]string{},
+		},
+		{
+			name:     "Register with every field invalid",
+			input:    &auth.RegisterRequest{Password: "123", Email: "not-an-email"},
+			expected: map[string]string{"username": "required", "password": "min", "email": "email"},
+		},
+		{
+			name:     "Login missing password",
+			input:    &auth.LoginRequest{Username: "alice"},
+			expected: map[string]string{"password": "required"},
+		},
+		{
+			name:     "Valid book with hyphenated ISBN-13",
+			input:    &book.Book{Title: "1984", Author: "George Orwell", Year: 1949, ISBN: "978-0-452-28423-4"},
+			expected: map[string]string{},
+		},
+		{
+			name:     "Book announced for next year",
+			input:    &book.Book{Title: "Upcoming", Author: "Someone", Year: nextYear},
+			expected: map[string]string{},
+		},
+		{
+			name:     "Book missing required fields",
+			input:    &book.Book{},
+			expected: map[string]string{"title": "required", "author": "required", "year": "required"},
+		},
+		{
+			name:     "Book year too early",
+			input:    &book.Book{Title: "Old", Author: "Someone", Year: 1200},
+			expected: map[string]string{"year": "book_year"},
+		},
+		{
+			name:     "Book year too late",
+			input:    &book.Book{Title: "Future", Author: "Someone", Year: nextYear + 1},
+			expected: map[string]string{"year": "book_year"},
+		},
+		{
+			name:     "Book with bad ISBN checksum",
+			input:    &book.Book{Title: "1984", Author: "George Orwell", Year: 1949, ISBN: "978-0-452-28423-5"},
+			expected: map[string]string{"isbn": "isbn"},
+		},
+		{
+			name:     "User with unknown role",
+			input:    &auth.User{Username: "alice", Password: "secret1", Role: "superuser"},
+			expected: map[string]string{"role": "role"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validator.ValidateStruct(tt.input)
+			assert.Equal(t, tt.expected, fieldTags(errs))
+			for _, fe := range errs {
+				assert.NotEmpty(t, fe.Message)
+			}
+		})
+	}
+}
+
+func TestValidatePartial(t *testing.T) {
+	// Omitted fields are not required on update
+	assert.Empty(t, validator.ValidatePartial(&book.Book{Genre: "Fiction"}))
+
+	// Fields that are sent must still be valid
+	errs := validator.ValidatePartial(&book.Book{Year: 1000, ISBN: "12345"})
+	assert.Equal(t, map[string]string{"year": "book_year", "isbn": "isbn"}, fieldTags(errs))
+}
+
+func TestValidationMessages(t *testing.T) {
+	errs := validator.ValidateStruct(&book.Book{Title: "Old", Author: "Someone", Year: 1200})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, fmt.Sprintf("must be between %d and %d", validator.MinYear, time.Now().Year()+1), errs[0].Message)
+	}
+
+	errs = validator.ValidateStruct(&auth.RegisterRequest{Username: "alice", Password: "123"})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "must be at least 6 characters", errs[0].Message)
+	}
+}
+
+func TestIsValidISBN(t *testing.T) {
+	valid := []string{"0-306-40615-2", "0306406152", "080442957X", "978-0-306-40615-7", "9780306406157", "978 0 06 112008 4"}
+	for _, isbn := range valid {
+		assert.True(t, validator.IsValidISBN(isbn), isbn)
+	}
+
+	invalid := []string{"", "0306406153", "9780306406158", "X306406152", "978030640615", "abcdefghij"}
+	for _, isbn := range invalid {
+		assert.False(t, validator.IsValidISBN(isbn), isbn)
+	}
+}
+
+type nestedAuthor struct {
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"omitempty,email"`
+}
+
+type nestedEntry struct {
+	Sequence int `json:"sequence" validate:"min=1"`
+}
+
+type nestedBookRequest struct {
+	Title   string        `json:"title" validate:"required"`
+	Author  nestedAuthor  `json:"author"`
+	Entries []nestedEntry `json:"entries" validate:"dive"`
+}
+
+func TestValidateStruct_NestedPaths(t *testing.T) {
+	errs := validator.ValidateStruct(&nestedBookRequest{
+		Author:  nestedAuthor{Email: "nope"},
+		Entries: []nestedEntry{{Sequence: 1}, {Sequence: 0}},
+	})
+
+	paths := make(map[string]apierrors.FieldError, len(errs))
+	for _, fe := range errs {
+		paths[fe.Path] = fe
+	}
+	assert.Len(t, paths, 4)
+	assert.Equal(t, "title", paths["title"].Field)
+	assert.Equal(t, "name", paths["author.name"].Field)
+	assert.Equal(t, "is required", paths["author.name"].Message)
+	assert.Equal(t, "must be a valid email address", paths["author.email"].Message)
+	assert.Equal(t, "must be at least 1", paths["entries[1].sequence"].Message)
+}
+
+func TestNewValidationError_DefaultsPathToField(t *testing.T) {
+	err := apierrors.NewValidationError(apierrors.FieldError{Field: "name", Message: "is required"})
+	assert.Equal(t, []apierrors.FieldError{{Field: "name", Path: "name", Message: "is required"}}, err.Details)
+}
+
+func TestCustomValidators(t *testing.T) {
+	type yearInput struct {
+		Year int `json:"year" validate:"book_year"`
+	}
+	type isbnInput struct {
+		ISBN string `json:"isbn" validate:"isbn"`
+	}
+	type roleInput struct {
+		Role string `json:"role" validate:"role"`
+	}
+	type cronInput struct {
+		Schedule string `json:"schedule" validate:"cron"`
+	}
+	nextYear := time.Now().Year() + 1
+
+	tests := []struct {
+		name    string
+		input   interface{}
+		valid   bool
+		message string
+	}{
+		{"year at the minimum", &yearInput{Year: validator.MinYear}, true, ""},
+		{"year announced for next year", &yearInput{Year: nextYear}, true, ""},
+		{"year before printing", &yearInput{Year: validator.MinYear - 1}, false, fmt.Sprintf("must be between %d and %d", validator.MinYear, nextYear)},
+		{"year too far ahead", &yearInput{Year: nextYear + 1}, false, fmt.Sprintf("must be between %d and %d", validator.MinYear, nextYear)},
+		{"ISBN-10 with X check digit", &isbnInput{ISBN: "0-8044-2957-X"}, true, ""},
+		{"hyphenated ISBN-13", &isbnInput{ISBN: "978-0-306-40615-7"}, true, ""},
+		{"ISBN with bad check digit", &isbnInput{ISBN: "978-0-306-40615-8"}, false, "must be a valid ISBN-10 or ISBN-13"},
+		{"ISBN of the wrong length", &isbnInput{ISBN: "12345"}, false, "must be a valid ISBN-10 or ISBN-13"},
+		{"known role", &roleInput{Role: "admin"}, true, ""},
+		{"unknown role", &roleInput{Role: "superuser"}, false, "must be one of: user, admin"},
+		{"cron expression", &cronInput{Schedule: "0 8 * * 1"}, true, ""},
+		{"cron descriptor", &cronInput{Schedule: "@daily"}, true, ""},
+		{"not a cron expression", &cronInput{Schedule: "every monday"}, false, `must be a cron expression like "0 8 * * 1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validator.ValidateStruct(tt.input)
+			if tt.valid {
+				assert.Empty(t, errs)
+				return
+			}
+			if assert.Len(t, errs, 1) {
+				assert.Equal(t, tt.message, errs[0].Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var bookColumns = []string{"id", "title", "author", "year", "status", "version"}
+
+// expectLoadBook expects UpdateBookTx's read of the stored book and the read
+// of BeforeUpdate
+func expectLoadBook(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(7, "Dune", "Frank Herbert", 1965, "available", version))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(7, "Dune", "Frank Herbert", 1965, "available", version))
+}
+
+func TestUpdateBook_IncrementsVersion(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+	expectLoadBook(mock, 5)
+	mock.ExpectExec(`UPDATE "books" SET .*"version"=\$\d+ WHERE version = \$\d+`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 6, 5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	updated, err := store.UpdateBook(context.Background(), 7, &book.Book{Title: "Dune", Version: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 6, updated.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateBook_StaleVersionConflicts(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+	expectLoadBook(mock, 5)
+	mock.ExpectExec(`UPDATE "books" SET .* WHERE version = \$\d+`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "version" FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+
+	_, err := store.UpdateBook(context.Background(), 7, &book.Book{Title: "Dune", Version: 4})
+	var conflict *book.VersionConflictError
+	require.True(t, errors.As(err, &conflict), "got %v", err)
+	assert.Equal(t, 5, conflict.CurrentVersion)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetBookStatus_IncrementsVersion(t *testing.T) {
+	conn, mock := mockDB(t)
+	store := book.NewDBStore(conn, nil)
+	stubSearchVectorUpdates(t, func(uint) (bool, error) { return true, nil })
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "books" .* FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(7, "Dune", "Frank Herbert", 1965, "available", 5))
+	mock.ExpectQuery(`SELECT \* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(7, "Dune", "Frank Herbert", 1965, "available", 5))
+	mock.ExpectExec(`UPDATE "books" SET "status"=\$1,"version"=version \+ 1,"updated_at"=\$2`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	updated, err := store.SetBookStatus(context.Background(), 7, book.StatusLost)
+	require.NoError(t, err)
+	assert.Equal(t, 6, updated.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
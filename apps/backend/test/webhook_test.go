@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSend(t *testing.T) {
+	secret := "0123456789abcdef"
+	body := []byte(`{"id":"evt-1","type":"book.created","data":{"id":1}}`)
+
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	status, err := webhook.Send(context.Background(), server.URL, secret, webhook.EventBookCreated, "evt-1", body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	require.NotNil(t, received)
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, webhook.EventBookCreated, received.Header.Get("X-Webhook-Event"))
+	assert.Equal(t, "evt-1", received.Header.Get("X-Webhook-ID"))
+	assert.Equal(t, body, receivedBody)
+
+	// Receivers verify the signature by recomputing the HMAC of the raw body
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(receivedBody)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), received.Header.Get("X-Signature"))
+}
+
+func TestWebhookSendFailures(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus int
+	}{
+		{
+			name: "Server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "Not modified is not a success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotModified)
+			},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name: "Client error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusGone)
+			},
+			expectedStatus: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			status, err := webhook.Send(context.Background(), server.URL, "secret", webhook.EventBookDeleted, "evt-2", []byte(`{}`))
+			assert.Error(t, err)
+			assert.Equal(t, tt.expectedStatus, status)
+		})
+	}
+}
+
+func TestWebhookSendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	status, err := webhook.Send(ctx, server.URL, "secret", webhook.EventUserCreated, "evt-3", []byte(`{}`))
+	assert.Error(t, err)
+	assert.Equal(t, 0, status)
+}
+
+func TestWebhookSendUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	status, err := webhook.Send(context.Background(), url, "secret", webhook.EventUserDeleted, "evt-4", []byte(`{}`))
+	assert.Error(t, err)
+	assert.Equal(t, 0, status)
+}
+
+func TestWebhookRetryBackoff(t *testing.T) {
+	assert.Equal(t, []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}, webhook.RetryBackoff)
+}
+
+func TestWebhookStringList(t *testing.T) {
+	value, err := webhook.StringList{webhook.EventBookCreated, webhook.EventUserDeleted}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, `["book.created","user.deleted"]`, value)
+
+	var list webhook.StringList
+	require.NoError(t, list.Scan([]byte(`["book.updated"]`)))
+	assert.True(t, list.Contains(webhook.EventBookUpdated))
+	assert.False(t, list.Contains(webhook.EventBookDeleted))
+
+	empty, err := webhook.StringList(nil).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "[]", empty)
+}
+
+func TestWebhookPayloadJSON(t *testing.T) {
+	entry := webhook.DeadLetter{ID: 1, Payload: webhook.Payload(`{"id":"evt-1","data":{"id":7}}`)}
+	encoded, err := json.Marshal(entry)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"payload":{"id":"evt-1","data":{"id":7}}`)
+
+	var decoded webhook.DeadLetter
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.JSONEq(t, `{"id":"evt-1","data":{"id":7}}`, string(decoded.Payload))
+
+	value, err := webhook.Payload(nil).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "null", value)
+	var scanned webhook.Payload
+	require.NoError(t, scanned.Scan([]byte(`{"a":1}`)))
+	assert.Equal(t, webhook.Payload(`{"a":1}`), scanned)
+}
@@ -0,0 +1,294 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/book"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecomputeEarly(t *testing.T) {
+	delta := 100 * time.Millisecond
+	tests := []struct {
+		name      string
+		remaining time.Duration
+		random    float64
+		want      bool
+	}{
+		{"expired", 0, 0.99, true},
+		{"far from expiry", 10 * time.Minute, 0.001, false},
+		{"near expiry, likely draw", 50 * time.Millisecond, 0.5, true},
+		{"near expiry, unlikely draw", 50 * time.Millisecond, 0.9, false},
+		{"no expiry", -time.Nanosecond, 0.001, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cache.RecomputeEarly(tt.remaining, delta, cache.DefaultXFetchBeta, tt.random))
+		})
+	}
+
+	// A larger beta refreshes earlier
+	assert.True(t, cache.RecomputeEarly(50*time.Millisecond, delta, 2, 0.7))
+	assert.False(t, cache.RecomputeEarly(50*time.Millisecond, delta, 1, 0.7))
+}
+
+func TestCacheGetXFetch_MissFetchesAndStores(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	// The mock stops a pipeline at the miss, so PTTL isn't sent
+	mock.ExpectGet("book:1").RedisNil()
+	mock.ExpectSet("book:1", []byte(`{"title":"Dune"}`), 10*time.Minute).SetVal("OK")
+
+	var got map[string]string
+	err := c.GetXFetch("book:1", &got, 10*time.Minute, 100*time.Millisecond, 1, func() (interface{}, error) {
+		return map[string]string{"title": "Dune"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", got["title"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheGetXFetch_FreshHitSkipsFetch(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	mock.ExpectGet("book:1").SetVal(`{"title":"Dune"}`)
+	mock.ExpectPTTL("book:1").SetVal(10 * time.Minute)
+
+	var got map[string]string
+	err := c.GetXFetch("book:1", &got, 10*time.Minute, 100*time.Millisecond, 1, func() (interface{}, error) {
+		t.Fatal("fetch called for a fresh key")
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", got["title"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheGetXFetch_ExpiringKeyRefreshes(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	mock.ExpectGet("book:1").SetVal(`{"title":"Dune"}`)
+	mock.ExpectPTTL("book:1").SetVal(0)
+	mock.ExpectSet("book:1", []byte(`{"title":"Dune Messiah"}`), 10*time.Minute).SetVal("OK")
+
+	var got map[string]string
+	err := c.GetXFetch("book:1", &got, 10*time.Minute, 100*time.Millisecond, 1, func() (interface{}, error) {
+		return map[string]string{"title": "Dune Messiah"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Dune Messiah", got["title"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheGetXFetch_FailedRefreshKeepsCachedValue(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	mock.ExpectGet("book:1").SetVal(`{"title":"Dune"}`)
+	mock.ExpectPTTL("book:1").SetVal(0)
+
+	var got map[string]string
+	err := c.GetXFetch("book:1", &got, 10*time.Minute, 100*time.Millisecond, 1, func() (interface{}, error) {
+		return nil, errors.New("database down")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", got["title"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCacheGetXFetch_MissReturnsFetchError(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	c := cache.NewRedisCacheWithClient(client)
+
+	// The mock stops a pipeline at the miss, so PTTL isn't sent
+	mock.ExpectGet("book:1").RedisNil()
+
+	var got map[string]string
+	err := c.GetXFetch("book:1", &got, 10*time.Minute, 100*time.Millisecond, 1, func() (interface{}, error) {
+		return nil, errors.New("database down")
+	})
+	assert.EqualError(t, err, "database down")
+}
+
+// expiringCache keeps JSON-encoded values with their expiry, enough for
+// GetBook with and without XFetch
+type expiringCache struct {
+	cache.Cache
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+func newExpiringCache() *expiringCache {
+	return &expiringCache{values: map[string][]byte{}, expires: map[string]time.Time{}}
+}
+
+func (e *expiringCache) Set(key string, value interface{}, expiration time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.values[key] = encoded
+	e.expires[key] = time.Now().Add(expiration)
+	return nil
+}
+
+func (e *expiringCache) read(key string) ([]byte, time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	remaining := time.Until(e.expires[key])
+	if remaining <= 0 {
+		return nil, 0, false
+	}
+	return e.values[key], remaining, true
+}
+
+func (e *expiringCache) Get(key string, dest interface{}) error {
+	encoded, _, ok := e.read(key)
+	if !ok {
+		return cache.ErrNotFound
+	}
+	return json.Unmarshal(encoded, dest)
+}
+
+func (e *expiringCache) GetXFetch(key string, dest interface{}, ttl, delta time.Duration, beta float64, fetch func() (interface{}, error)) error {
+	encoded, remaining, ok := e.read(key)
+	if ok && !cache.ShouldRecomputeEarly(remaining, delta, beta) {
+		return json.Unmarshal(encoded, dest)
+	}
+
+	value, err := fetch()
+	if err != nil {
+		if ok {
+			return json.Unmarshal(encoded, dest)
+		}
+		return err
+	}
+	e.Set(key, value, ttl)
+	encoded, _, _ = e.read(key)
+	return json.Unmarshal(encoded, dest)
+}
+
+// Views aren't counted
+func (e *expiringCache) Incr(key string) (int64, error) { return 1, nil }
+func (e *expiringCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	return increment, nil
+}
+func (e *expiringCache) Expire(key string, expiration time.Duration) error { return nil }
+func (e *expiringCache) PFAdd(key string, elements ...interface{}) error   { return nil }
+func (e *expiringCache) GetInt64(key string) (int64, error)                { return 0, nil }
+func (e *expiringCache) PFCount(keys ...string) (int64, error)             { return 0, nil }
+
+func useXFetch(t testing.TB, enabled bool) {
+	previous := book.XFetchCache
+	book.XFetchCache = enabled
+	t.Cleanup(func() { book.XFetchCache = previous })
+}
+
+func TestGetBook_XFetchRefreshesExpiringBook(t *testing.T) {
+	store := newExpiringCache()
+	useXFetch(t, true)
+	books := stubLoadBook(func(ctx context.Context, id uint) (*book.Book, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &book.Book{ID: id, Title: "Dune Messiah"}, nil
+	})
+
+	// Each read refreshes with a chance of 1/e, so one of them all but
+	// certainly does; the others don't wait for it
+	require.NoError(t, store.Set("book:1", book.Book{ID: 1, Title: "Dune"}, 100*time.Millisecond))
+
+	for _, status := range getConcurrently(t, bookApp(books, store), "/books/1", concurrentRequests) {
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&books.calls))
+
+	_, remaining, ok := store.read("book:1")
+	require.True(t, ok)
+	assert.Greater(t, remaining, 9*time.Minute)
+}
+
+func TestGetBook_XFetchNotFound(t *testing.T) {
+	useXFetch(t, true)
+	books := stubLoadBook(func(ctx context.Context, id uint) (*book.Book, error) {
+		return nil, errors.New("record not found")
+	})
+
+	assert.Equal(t, []int{http.StatusNotFound}, getConcurrently(t, bookApp(books, newExpiringCache()), "/books/404", 1))
+}
+
+// xfetchClients and xfetchLoad are the load BenchmarkGetBookExpiring runs:
+// that many readers of one book arriving over xfetchWindow while it
+// expires, against a database taking xfetchLoad per query
+const (
+	xfetchClients = 1000
+	xfetchLoad    = 100 * time.Millisecond
+	xfetchWindow  = 150 * time.Millisecond
+)
+
+// BenchmarkGetBookExpiring compares singleflight alone with XFetch when a
+// popular book expires under load. Per iteration a cached book expires 50ms
+// into the window; blocked/op counts readers that waited on the database
+// and loads/op the queries made.
+func BenchmarkGetBookExpiring(b *testing.B) {
+	for _, xfetch := range []bool{false, true} {
+		name := "singleflight"
+		if xfetch {
+			name = "xfetch"
+		}
+		b.Run(name, func(b *testing.B) {
+			store := newExpiringCache()
+			useXFetch(b, xfetch)
+			books := stubLoadBook(func(ctx context.Context, id uint) (*book.Book, error) {
+				time.Sleep(xfetchLoad)
+				return &book.Book{ID: id, Title: "Dune"}, nil
+			})
+			app := bookApp(books, store)
+
+			var blocked int64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				target := fmt.Sprintf("/books/%d", i+1)
+				store.Set(fmt.Sprintf("book:%d", i+1), book.Book{ID: uint(i + 1), Title: "Dune"}, 50*time.Millisecond)
+
+				var wg sync.WaitGroup
+				for j := 0; j < xfetchClients; j++ {
+					wg.Add(1)
+					go func(arrival time.Duration) {
+						defer wg.Done()
+						time.Sleep(arrival)
+						start := time.Now()
+						resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil), -1)
+						if err != nil || resp.StatusCode != http.StatusOK {
+							b.Errorf("GET %s: %v", target, err)
+							return
+						}
+						if time.Since(start) >= xfetchLoad/4 {
+							atomic.AddInt64(&blocked, 1)
+						}
+					}(time.Duration(rand.Int63n(int64(xfetchWindow))))
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(&books.calls))/float64(b.N), "loads/op")
+			b.ReportMetric(float64(blocked)/float64(b.N), "blocked/op")
+		})
+	}
+}
@@ -1,27 +1,30 @@
 package url
 
 import (
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
 	"github.com/gofiber/fiber/v2"
 )
 
 // CleanURLHandler godoc
 // @Summary Clean and redirect URL
+// @Description canonical drops the query, fragment and a trailing slash. strict_canonical also lowercases the scheme and host, drops default ports (80 for http, 443 for https), decodes needlessly percent-encoded characters and encodes those that need it; trailing slashes are removed unless URL_STRIP_TRAILING_SLASH=false. redirection forces https and www. and lowercases the path. all runs canonical, then redirection.
 // @Tags url
 // @Accept json
 // @Produce json
 // @Param data body URLRequest true "URL cleanup input"
 // @Success 200 {object} URLResponse
-// @Failure 400
+// @Failure 400 {object} apierrors.APIError
+// @Failure 429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
 // @Router /url/clean [post]
 func CleanURLHandler(c *fiber.Ctx) error {
 	var req URLRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		return apierrors.ErrInvalidRequestBody
 	}
 
 	cleaned, err := CleanURL(req.URL, req.Operation)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Processing failed"})
+		return apierrors.ErrInvalidRequestBody.WithMessage("Processing failed")
 	}
 
 	return c.JSON(URLResponse{ProcessedURL: cleaned})
@@ -2,7 +2,7 @@ package url
 
 type URLRequest struct {
 	URL       string `json:"url" validate:"required,url"`
-	Operation string `json:"operation" validate:"required,oneof=canonical redirection all"`
+	Operation string `json:"operation" validate:"required,oneof=canonical strict_canonical redirection all" enums:"canonical,strict_canonical,redirection,all"`
 }
 
 type URLResponse struct {
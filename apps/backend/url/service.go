@@ -1,6 +1,7 @@
 package url
 
 import (
+	"fmt"
 	"net/url"
 	"strings"
 )
@@ -16,6 +17,97 @@ func Canonicalize(raw string) (string, error) {
 	return parsed.String(), nil
 }
 
+// StripTrailingSlash makes CanonicalizeStrict remove trailing slashes from
+// the path. Set from URL_STRIP_TRAILING_SLASH.
+var StripTrailingSlash = true
+
+// defaultPorts are the ports CanonicalizeStrict drops for each scheme
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// CanonicalizeStrict canonicalizes raw like Canonicalize and also normalizes
+// how the same address can be written: the scheme and host are lowercased,
+// the scheme's default port is dropped, percent-encoded unreserved
+// characters are decoded, other escapes are uppercased and characters that
+// must be encoded are. The path keeps its case. raw must be absolute.
+func CanonicalizeStrict(raw string) (string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("url %q is not absolute", raw)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := parsed.Port(); port != "" && port != defaultPorts[parsed.Scheme] {
+		host += ":" + port
+	}
+	parsed.Host = host
+	parsed.RawQuery = ""
+	parsed.ForceQuery = false
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	path := normalizeEscapes(parsed.EscapedPath())
+	if StripTrailingSlash {
+		path = strings.TrimRight(path, "/")
+	}
+	if parsed.Path, err = url.PathUnescape(path); err != nil {
+		return "", err
+	}
+	parsed.RawPath = path
+	return parsed.String(), nil
+}
+
+// normalizeEscapes rewrites an escaped path so each character has one
+// spelling: unreserved characters unescaped, escapes in uppercase hex and
+// characters not allowed in a path escaped
+func normalizeEscapes(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '%' && i+2 < len(path) && isHex(path[i+1]) && isHex(path[i+2]) {
+			decoded := unhex(path[i+1])<<4 | unhex(path[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", decoded)
+			}
+			i += 2
+			continue
+		}
+		if isUnreserved(c) || strings.IndexByte("/!$&'()*+,;=:@", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c never needs percent-encoding (RFC 3986 2.3)
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
 func Redirect(raw string) (string, error) {
 	parsed, err := url.Parse(raw)
 	if err != nil {
@@ -41,6 +133,8 @@ func CleanURL(raw, operation string) (string, error) {
 	switch operation {
 	case "canonical":
 		result, err = Canonicalize(raw)
+	case "strict_canonical":
+		result, err = CanonicalizeStrict(raw)
 	case "redirection":
 		result, err = Redirect(raw)
 	case "all":
@@ -0,0 +1,263 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	exthttp "github.com/AtillaTahaK/gobooklibrary/pkg/http"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/tracing"
+	"github.com/google/uuid"
+)
+
+// DeliveryTimeout bounds how long a webhook URL has to respond
+const DeliveryTimeout = 10 * time.Second
+
+// RetryBackoff is the wait before each retry of a failed delivery. A delivery
+// that still fails after the last retry is moved to the dead letter queue.
+var RetryBackoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+const retryKeyPrefix = "webhook:retry:"
+
+// retryKey is the sorted set of pending retries for a webhook, scored by the
+// unix time they are due
+func retryKey(webhookID uint) string {
+	return fmt.Sprintf("%s%d", retryKeyPrefix, webhookID)
+}
+
+// pendingDelivery is an event waiting to be (re)delivered to one webhook
+type pendingDelivery struct {
+	EventID string          `json:"event_id"`
+	Event   string          `json:"event"`
+	Body    json.RawMessage `json:"body"`
+	Attempt int             `json:"attempt"`
+	// Traceparent and Tracestate keep retries in the trace of the request
+	// that caused the event
+	Traceparent string `json:"traceparent,omitempty"`
+	Tracestate  string `json:"tracestate,omitempty"`
+}
+
+// context returns ctx carrying the delivery's trace, if it has one
+func (p pendingDelivery) context(ctx context.Context) context.Context {
+	sc, err := tracing.ParseTraceparent(p.Traceparent)
+	if err != nil {
+		return ctx
+	}
+	sc.State = p.Tracestate
+	return tracing.NewContext(ctx, sc)
+}
+
+var client = exthttp.NewClient(DeliveryTimeout)
+
+// Sign returns the X-Signature header value for body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send POSTs body to url, signed with secret, propagating the trace in ctx.
+// It returns the response status and an error for transport failures and
+// non-2xx responses.
+func Send(ctx context.Context, url, secret, event, eventID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BookLibrary-Webhooks/1.0")
+	req.Header.Set("X-Signature", Sign(secret, body))
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-ID", eventID)
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Dispatch notifies every active webhook subscribed to event. It returns
+// immediately; lookups and deliveries run in the background so a slow
+// endpoint never delays the request that caused the event. Only the trace in
+// ctx is carried over, not its cancellation. A nil Handler dispatches
+// nothing.
+func (h *Handler) Dispatch(ctx context.Context, event string, data interface{}) {
+	if h == nil || h.db == nil {
+		return
+	}
+
+	payload := Event{
+		ID:        uuid.NewString(),
+		Type:      event,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		h.logError(err, "marshal_event", map[string]interface{}{"event": event})
+		return
+	}
+
+	pending := pendingDelivery{EventID: payload.ID, Event: event, Body: body, Attempt: 1}
+	if sc, ok := tracing.FromContext(ctx); ok {
+		pending.Traceparent = sc.Traceparent()
+		pending.Tracestate = sc.State
+	}
+
+	go func() {
+		ctx := pending.context(context.Background())
+		hooks, err := h.activeWebhooksFor(ctx, event)
+		if err != nil {
+			h.logError(err, "find_webhooks", map[string]interface{}{"event": event})
+			return
+		}
+		for i := range hooks {
+			h.deliver(ctx, &hooks[i], pending)
+		}
+	}()
+}
+
+// deliver makes one delivery attempt, records it, and schedules a retry if
+// it failed
+func (h *Handler) deliver(ctx context.Context, hook *Webhook, pending pendingDelivery) {
+	if _, err := h.attempt(ctx, hook, pending); err != nil {
+		h.scheduleRetry(ctx, hook.ID, pending, err)
+	}
+}
+
+// attempt makes one delivery attempt and records it. It returns the
+// recorded delivery and the error of the attempt.
+func (h *Handler) attempt(ctx context.Context, hook *Webhook, pending pendingDelivery) (*Delivery, error) {
+	start := time.Now()
+	status, err := Send(ctx, hook.URL, hook.Secret, pending.Event, pending.EventID, pending.Body)
+
+	delivery := Delivery{
+		WebhookID:  hook.ID,
+		EventID:    pending.EventID,
+		Event:      pending.Event,
+		Attempt:    pending.Attempt,
+		StatusCode: status,
+		Success:    err == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if recordErr := h.recordDelivery(ctx, &delivery); recordErr != nil {
+		h.logError(recordErr, "record_delivery", map[string]interface{}{"webhook_id": hook.ID})
+	}
+	return &delivery, err
+}
+
+// scheduleRetry queues the next attempt of a failed delivery, or moves it to
+// the dead letter queue when no retries are left. Without a cache there is
+// nowhere to queue retries, so the first failure is dead-lettered.
+func (h *Handler) scheduleRetry(ctx context.Context, webhookID uint, pending pendingDelivery, lastErr error) {
+	if h.cache == nil || pending.Attempt > len(RetryBackoff) {
+		h.deadLetter(ctx, webhookID, pending, lastErr)
+		return
+	}
+
+	due := time.Now().Add(RetryBackoff[pending.Attempt-1])
+	pending.Attempt++
+	if err := h.cache.ZAdd(retryKey(webhookID), float64(due.Unix()), pending); err != nil {
+		h.logError(err, "schedule_retry", map[string]interface{}{"webhook_id": webhookID})
+	}
+}
+
+// ProcessRetries redelivers every retry that is due and returns how many
+// were attempted. Retries for webhooks that were deleted or deactivated are
+// dropped.
+func (h *Handler) ProcessRetries(ctx context.Context) (int, error) {
+	if h.cache == nil {
+		return 0, nil
+	}
+
+	keys, err := h.cache.Keys(retryKeyPrefix + "*")
+	if err != nil {
+		return 0, err
+	}
+
+	now := float64(time.Now().Unix())
+	attempted := 0
+	for _, key := range keys {
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, retryKeyPrefix), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		members, err := h.cache.ZRangeByScore(key, now)
+		if err != nil || len(members) == 0 {
+			continue
+		}
+		hook, err := h.getWebhook(ctx, uint(id))
+		if err != nil || !hook.Active {
+			hook = nil
+		}
+
+		for _, member := range members {
+			// Whoever removes the member owns the retry, so concurrent
+			// workers never deliver it twice
+			removed, err := h.cache.ZRem(key, member)
+			if err != nil || removed == 0 || hook == nil {
+				continue
+			}
+
+			var pending pendingDelivery
+			if err := json.Unmarshal([]byte(member), &pending); err != nil {
+				continue
+			}
+			h.deliver(pending.context(ctx), hook, pending)
+			attempted++
+		}
+	}
+
+	return attempted, nil
+}
+
+// StartRetryWorker runs ProcessRetries every interval until ctx is done
+func (h *Handler) StartRetryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := h.ProcessRetries(ctx); err != nil {
+					h.logError(err, "process_webhook_retries", nil)
+				}
+			}
+		}
+	}()
+}
+
+func (h *Handler) logError(err error, operation string, fields map[string]interface{}) {
+	if h.log == nil {
+		return
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["operation"] = operation
+	h.log.LogError(err, fields)
+}
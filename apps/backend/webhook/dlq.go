@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/AtillaTahaK/gobooklibrary/pkg/metrics"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/scheduler"
+	"gorm.io/gorm"
+)
+
+// DLQRetention is how long a dead letter is kept before it is purged
+const DLQRetention = 30 * 24 * time.Hour
+
+// DLQPurgeSchedule purges expired dead letters daily at 04:00 UTC
+const DLQPurgeSchedule = "0 4 * * *"
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// deadLetter stores a delivery whose retries ran out
+func (h *Handler) deadLetter(ctx context.Context, webhookID uint, pending pendingDelivery, lastErr error) {
+	now := time.Now()
+	entry := DeadLetter{
+		WebhookID:    webhookID,
+		EventID:      pending.EventID,
+		Event:        pending.Event,
+		Payload:      Payload(pending.Body),
+		AttemptCount: pending.Attempt,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(DLQRetention),
+	}
+	if lastErr != nil {
+		entry.LastError = lastErr.Error()
+	}
+	if err := h.db.WithContext(ctx).Create(&entry).Error; err != nil {
+		h.logError(err, "dead_letter_delivery", map[string]interface{}{"webhook_id": webhookID, "event_id": pending.EventID})
+		return
+	}
+	metrics.RecordWebhookDLQEntry()
+
+	if h.log != nil {
+		h.log.Warn("Webhook delivery moved to the dead letter queue", map[string]interface{}{
+			"webhook_id":     webhookID,
+			"event_id":       pending.EventID,
+			"attempts":       pending.Attempt,
+			"dead_letter_id": entry.ID,
+		})
+	}
+}
+
+// listDeadLetters returns up to limit dead letters, newest first
+func (h *Handler) listDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var entries []DeadLetter
+	if err := h.db.WithContext(ctx).Order("created_at DESC, id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// retryDeadLetter delivers a dead letter again, to its webhook's current URL
+// even if the webhook was deactivated. A successful delivery removes the
+// dead letter; a failed one updates its error and attempt count. The
+// returned delivery is the recorded attempt.
+func (h *Handler) retryDeadLetter(ctx context.Context, id uint) (*Delivery, error) {
+	var entry DeadLetter
+	if err := h.db.WithContext(ctx).First(&entry, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+	hook, err := h.getWebhook(ctx, entry.WebhookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	pending := pendingDelivery{
+		EventID: entry.EventID,
+		Event:   entry.Event,
+		Body:    json.RawMessage(entry.Payload),
+		Attempt: entry.AttemptCount + 1,
+	}
+	delivery, sendErr := h.attempt(ctx, hook, pending)
+	if sendErr == nil {
+		return delivery, h.db.WithContext(ctx).Delete(&entry).Error
+	}
+	err = h.db.WithContext(ctx).Model(&entry).Updates(map[string]interface{}{
+		"last_error":    sendErr.Error(),
+		"attempt_count": pending.Attempt,
+	}).Error
+	return delivery, err
+}
+
+func (h *Handler) deleteDeadLetter(ctx context.Context, id uint) error {
+	result := h.db.WithContext(ctx).Delete(&DeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeExpiredDeadLetters deletes the dead letters past their ExpiresAt and
+// returns how many there were
+func (h *Handler) PurgeExpiredDeadLetters(ctx context.Context) (int64, error) {
+	result := h.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&DeadLetter{})
+	return result.RowsAffected, result.Error
+}
+
+// StartDLQPurger runs PurgeExpiredDeadLetters on DLQPurgeSchedule until ctx
+// is done
+func (h *Handler) StartDLQPurger(ctx context.Context) {
+	schedule, err := scheduler.Parse(DLQPurgeSchedule)
+	if err != nil {
+		panic(err)
+	}
+	scheduler.StartCron(ctx, schedule, func(ctx context.Context) {
+		purged, err := h.PurgeExpiredDeadLetters(ctx)
+		if err != nil {
+			h.logError(err, "purge_dead_letters", nil)
+			return
+		}
+		if purged > 0 && h.log != nil {
+			h.log.Info("Purged expired webhook dead letters", map[string]interface{}{"purged": purged})
+		}
+	})
+}
@@ -0,0 +1,319 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/AtillaTahaK/gobooklibrary/middleware"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/cache"
+	apierrors "github.com/AtillaTahaK/gobooklibrary/pkg/errors"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/logger"
+	"github.com/AtillaTahaK/gobooklibrary/pkg/validator"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Handler serves the webhook admin endpoints and delivers events to the
+// registered webhooks. Retries of failed deliveries are queued in the cache.
+type Handler struct {
+	db    *gorm.DB
+	cache cache.Cache
+	log   *logger.Logger
+}
+
+// NewHandler returns a Handler storing webhooks and deliveries in conn
+func NewHandler(conn *gorm.DB, c cache.Cache, log *logger.Logger) *Handler {
+	return &Handler{db: conn, cache: c, log: log}
+}
+
+// ListWebhooks godoc
+// @Summary      List webhooks (admin only)
+// @Tags         webhooks
+// @Produce      json
+// @Security     Bearer
+// @Success      200 {array}  Webhook
+// @Failure      429 {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500 {object} apierrors.APIError
+// @Router       /admin/webhooks [get]
+func (h *Handler) ListWebhooks(c *fiber.Ctx) error {
+	hooks, err := h.listWebhooks(c.UserContext())
+	if err != nil {
+		h.logError(err, "list_webhooks", nil)
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch webhooks")
+	}
+	return c.JSON(hooks)
+}
+
+// GetWebhook godoc
+// @Summary      Get a webhook (admin only)
+// @Tags         webhooks
+// @Produce      json
+// @Security     Bearer
+// @Param        id   path  int  true  "Webhook ID"
+// @Success      200  {object} Webhook
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks/{id} [get]
+func (h *Handler) GetWebhook(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid webhook ID")
+	}
+
+	hook, err := h.getWebhook(c.UserContext(), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrWebhookNotFound
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch webhook")
+	}
+	return c.JSON(hook)
+}
+
+// CreateWebhook godoc
+// @Summary      Create a webhook (admin only)
+// @Description  Deliveries are POSTed with an X-Signature header holding sha256=<hex HMAC-SHA256 of the body keyed by secret>
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        webhook  body  WebhookRequest  true  "Webhook to create"
+// @Success      201  {object} Webhook
+// @Failure      400  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks [post]
+func (h *Handler) CreateWebhook(c *fiber.Ctx) error {
+	var req WebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidateStruct(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	hook := Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: StringList(req.Events),
+		Active: req.Active == nil || *req.Active,
+	}
+	if userID, ok := middleware.UserID(c); ok {
+		hook.CreatedByUserID = userID
+	}
+
+	if err := h.createWebhook(c.UserContext(), &hook); err != nil {
+		h.logError(err, "create_webhook", map[string]interface{}{"url": hook.URL})
+		return apierrors.ErrDatabase.WithMessage("Failed to create webhook")
+	}
+
+	return c.Status(201).JSON(hook)
+}
+
+// UpdateWebhook godoc
+// @Summary      Update a webhook (admin only)
+// @Description  Omitted fields keep their current value
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        id       path  int             true  "Webhook ID"
+// @Param        webhook  body  WebhookRequest  true  "Fields to change"
+// @Success      200  {object} Webhook
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks/{id} [put]
+func (h *Handler) UpdateWebhook(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid webhook ID")
+	}
+
+	var req WebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apierrors.ErrInvalidRequestBody
+	}
+	if errs := validator.ValidatePartial(&req); len(errs) > 0 {
+		return apierrors.NewValidationError(errs...)
+	}
+
+	updated := Webhook{URL: req.URL, Secret: req.Secret, Events: StringList(req.Events)}
+	hook, err := h.updateWebhook(c.UserContext(), uint(id), &updated, req.Active)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrWebhookNotFound
+		}
+		h.logError(err, "update_webhook", map[string]interface{}{"webhook_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to update webhook")
+	}
+
+	return c.JSON(hook)
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete a webhook and its delivery history (admin only)
+// @Tags         webhooks
+// @Security     Bearer
+// @Param        id   path  int  true  "Webhook ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid webhook ID")
+	}
+
+	if err := h.deleteWebhook(c.UserContext(), uint(id)); err != nil {
+		if err == ErrWebhookNotFound {
+			return apierrors.ErrWebhookNotFound
+		}
+		h.logError(err, "delete_webhook", map[string]interface{}{"webhook_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to delete webhook")
+	}
+
+	if h.cache != nil {
+		h.cache.Delete(retryKey(uint(id)))
+	}
+
+	return c.SendStatus(204)
+}
+
+// GetDeliveries godoc
+// @Summary      List a webhook's delivery attempts, newest first (admin only)
+// @Tags         webhooks
+// @Produce      json
+// @Security     Bearer
+// @Param        id     path   int  true   "Webhook ID"
+// @Param        page   query  int  false  "Page number" default(1)
+// @Param        limit  query  int  false  "Page size" default(20)
+// @Success      200  {object} map[string]interface{}
+// @Header       200  {integer} X-Total-Count "Total number of items"
+// @Header       200  {integer} X-Page "Current page"
+// @Header       200  {integer} X-Limit "Page size"
+// @Header       200  {integer} X-Pages "Number of pages"
+// @Header       200  {string} Link "First, previous, next and last pages (RFC 5988)"
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks/{id}/deliveries [get]
+func (h *Handler) GetDeliveries(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid webhook ID")
+	}
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	if _, err := h.getWebhook(c.UserContext(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apierrors.ErrWebhookNotFound
+		}
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch webhook")
+	}
+
+	deliveries, total, err := h.listDeliveries(c.UserContext(), uint(id), page, limit)
+	if err != nil {
+		h.logError(err, "list_webhook_deliveries", map[string]interface{}{"webhook_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch deliveries")
+	}
+
+	middleware.SetPagination(c, page, limit, total)
+	return c.JSON(fiber.Map{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// ListDeadLetters godoc
+// @Summary      List webhook deliveries in the dead letter queue, newest first (admin only)
+// @Description  Deliveries land here when their last retry fails, and are purged 30 days later
+// @Tags         webhooks
+// @Produce      json
+// @Security     Bearer
+// @Param        limit  query  int  false  "Maximum number of entries, up to 100" default(20)
+// @Success      200  {array}  DeadLetter
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Failure      500  {object} apierrors.APIError
+// @Router       /admin/webhooks/dlq [get]
+func (h *Handler) ListDeadLetters(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	entries, err := h.listDeadLetters(c.UserContext(), limit)
+	if err != nil {
+		h.logError(err, "list_dead_letters", nil)
+		return apierrors.ErrDatabase.WithMessage("Failed to fetch dead letters")
+	}
+	return c.JSON(entries)
+}
+
+// RetryDeadLetter godoc
+// @Summary      Redeliver a dead letter (admin only)
+// @Description  Delivers the payload once more, right away. On success the entry is removed from the queue; on failure it stays with the new error.
+// @Tags         webhooks
+// @Produce      json
+// @Security     Bearer
+// @Param        id   path  int  true  "Dead letter ID"
+// @Success      200  {object} Delivery
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks/dlq/{id}/retry [post]
+func (h *Handler) RetryDeadLetter(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid dead letter ID")
+	}
+
+	delivery, err := h.retryDeadLetter(c.UserContext(), uint(id))
+	switch {
+	case err == ErrDeadLetterNotFound:
+		return apierrors.ErrDeadLetterNotFound
+	case err == ErrWebhookNotFound:
+		return apierrors.ErrWebhookNotFound
+	case err != nil:
+		h.logError(err, "retry_dead_letter", map[string]interface{}{"dead_letter_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to retry dead letter")
+	}
+	return c.JSON(delivery)
+}
+
+// DeleteDeadLetter godoc
+// @Summary      Discard a dead letter (admin only)
+// @Tags         webhooks
+// @Security     Bearer
+// @Param        id   path  int  true  "Dead letter ID"
+// @Success      204
+// @Failure      400  {object} apierrors.APIError
+// @Failure      404  {object} apierrors.APIError
+// @Failure      429  {object} apierrors.RateLimitedBody "Rate limit exceeded"
+// @Router       /admin/webhooks/dlq/{id} [delete]
+func (h *Handler) DeleteDeadLetter(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apierrors.ErrInvalidID.WithMessage("Invalid dead letter ID")
+	}
+
+	if err := h.deleteDeadLetter(c.UserContext(), uint(id)); err != nil {
+		if err == ErrDeadLetterNotFound {
+			return apierrors.ErrDeadLetterNotFound
+		}
+		h.logError(err, "delete_dead_letter", map[string]interface{}{"dead_letter_id": id})
+		return apierrors.ErrDatabase.WithMessage("Failed to delete dead letter")
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types a webhook can subscribe to
+const (
+	EventBookCreated = "book.created"
+	EventBookUpdated = "book.updated"
+	EventBookDeleted = "book.deleted"
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+// Events lists every event type, in the order they are documented
+var Events = []string{
+	EventBookCreated, EventBookUpdated, EventBookDeleted,
+	EventUserCreated, EventUserUpdated, EventUserDeleted,
+}
+
+// StringList is a []string stored as a jsonb array
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	}
+	return fmt.Errorf("cannot scan %T into StringList", value)
+}
+
+// Contains reports whether s is in the list
+func (l StringList) Contains(s string) bool {
+	for _, item := range l {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is an external URL notified when subscribed events occur
+type Webhook struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	URL             string     `json:"url" gorm:"not null"`
+	Secret          string     `json:"-" gorm:"not null"`
+	Events          StringList `json:"events" gorm:"type:jsonb;not null;default:'[]'"`
+	Active          bool       `json:"active" gorm:"not null;default:true;index"`
+	CreatedByUserID uint       `json:"created_by_user_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// WebhookRequest is the body for creating or updating a webhook. The secret
+// is write-only: it is used to sign deliveries and never returned.
+type WebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url"`
+	Secret string   `json:"secret" validate:"required,min=16"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=book.created book.updated book.deleted user.created user.updated user.deleted"`
+	Active *bool    `json:"active"`
+}
+
+// Delivery records one attempt to deliver an event to a webhook
+type Delivery struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	WebhookID  uint      `json:"webhook_id" gorm:"not null;index"`
+	EventID    string    `json:"event_id" gorm:"not null;index"`
+	Event      string    `json:"event" gorm:"not null"`
+	Attempt    int       `json:"attempt" gorm:"not null"`
+	StatusCode int       `json:"status_code"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Event is the JSON body POSTed to webhook URLs
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Payload is a raw JSON document stored as jsonb
+type Payload json.RawMessage
+
+func (p Payload) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return "null", nil
+	}
+	return string(p), nil
+}
+
+func (p *Payload) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		*p = append(Payload(nil), v...)
+		return nil
+	case string:
+		*p = Payload(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Payload", value)
+}
+
+// MarshalJSON embeds the payload as is
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// UnmarshalJSON keeps a copy of the raw document
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	*p = append(Payload(nil), data...)
+	return nil
+}
+
+// DeadLetter is a delivery whose last retry failed. It is kept until it is
+// retried successfully, discarded or ExpiresAt passes.
+type DeadLetter struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	WebhookID    uint      `json:"webhook_id" gorm:"not null;index"`
+	EventID      string    `json:"event_id" gorm:"not null"`
+	Event        string    `json:"event" gorm:"not null"`
+	Payload      Payload   `json:"payload" gorm:"type:jsonb;not null" swaggertype:"object"`
+	LastError    string    `json:"last_error"`
+	AttemptCount int       `json:"attempt_count" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letter_queue"
+}
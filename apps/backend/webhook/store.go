@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+func (h *Handler) listWebhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	if err := h.db.WithContext(ctx).Order("id").Find(&hooks).Error; err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (h *Handler) getWebhook(ctx context.Context, id uint) (*Webhook, error) {
+	var hook Webhook
+	if err := h.db.WithContext(ctx).First(&hook, id).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (h *Handler) createWebhook(ctx context.Context, hook *Webhook) error {
+	return h.db.WithContext(ctx).Create(hook).Error
+}
+
+// updateWebhook applies the non-zero fields of updated. Active is a separate
+// argument because false is its zero value.
+func (h *Handler) updateWebhook(ctx context.Context, id uint, updated *Webhook, active *bool) (*Webhook, error) {
+	var hook Webhook
+	if err := h.db.WithContext(ctx).First(&hook, id).Error; err != nil {
+		return nil, err
+	}
+
+	if err := h.db.WithContext(ctx).Model(&hook).Updates(updated).Error; err != nil {
+		return nil, err
+	}
+	if active != nil {
+		if err := h.db.WithContext(ctx).Model(&hook).Update("active", *active).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &hook, nil
+}
+
+func (h *Handler) deleteWebhook(ctx context.Context, id uint) error {
+	result := h.db.WithContext(ctx).Delete(&Webhook{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return h.db.WithContext(ctx).Where("webhook_id = ?", id).Delete(&Delivery{}).Error
+}
+
+// activeWebhooksFor returns the active webhooks subscribed to event
+func (h *Handler) activeWebhooksFor(ctx context.Context, event string) ([]Webhook, error) {
+	subscribed, err := json.Marshal([]string{event})
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []Webhook
+	err = h.db.WithContext(ctx).
+		Where("active = ? AND events @> ?::jsonb", true, string(subscribed)).
+		Find(&hooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (h *Handler) recordDelivery(ctx context.Context, delivery *Delivery) error {
+	return h.db.WithContext(ctx).Create(delivery).Error
+}
+
+// listDeliveries returns a page of a webhook's delivery attempts, newest first
+func (h *Handler) listDeliveries(ctx context.Context, webhookID uint, page, limit int) ([]Delivery, int64, error) {
+	var deliveries []Delivery
+	var total int64
+
+	query := h.db.WithContext(ctx).Model(&Delivery{}).Where("webhook_id = ?", webhookID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
+
+var ErrWebhookNotFound = errors.New("webhook not found")
@@ -72,13 +72,13 @@ export default function BooksPage() {
 		setIsBookModalOpen(true);
 	};
 
-	const handleSaveBook = async (bookData: Omit<Book, 'id' | 'created_at' | 'updated_at'>) => {
+	const handleSaveBook = async (bookData: Omit<Book, 'id' | 'created_at' | 'updated_at' | 'version'>) => {
 		try {
 			setIsBookModalLoading(true);
 			setError('');
 
 			if (editingBook) {
-				await api.updateBook(editingBook.id, bookData);
+				await api.updateBook(editingBook.id, editingBook.version, bookData);
 			} else {
 				await api.createBook(bookData);
 			}
@@ -8,7 +8,7 @@ interface BookModalProps {
 	book?: Book;
 	isOpen: boolean;
 	onClose: () => void;
-	onSave: (book: Omit<Book, 'id' | 'created_at' | 'updated_at'>) => void;
+	onSave: (book: Omit<Book, 'id' | 'created_at' | 'updated_at' | 'version'>) => void;
 	isLoading?: boolean;
 }
 
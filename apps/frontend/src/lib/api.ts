@@ -7,8 +7,12 @@ export interface Book {
 	year: number;
 	genre?: string;
 	isbn?: string;
+	cover_url?: string;
+	sync_status?: 'synced' | 'unlisted';
 	created_at: string;
 	updated_at: string;
+	// version must be sent back when updating the book
+	version: number;
 }
 
 export interface User {
@@ -113,7 +117,7 @@ class ApiClient {
 		return this.handleResponse<Book>(response);
 	}
 
-	async createBook(book: Omit<Book, 'id' | 'created_at' | 'updated_at'>): Promise<Book> {
+	async createBook(book: Omit<Book, 'id' | 'created_at' | 'updated_at' | 'version'>): Promise<Book> {
 		const response = await fetch(`${this.baseURL}/books`, {
 			method: 'POST',
 			headers: this.getHeaders(true),
@@ -123,11 +127,11 @@ class ApiClient {
 		return this.handleResponse<Book>(response);
 	}
 
-	async updateBook(id: number, book: Partial<Omit<Book, 'id' | 'created_at' | 'updated_at'>>): Promise<Book> {
+	async updateBook(id: number, version: number, book: Partial<Omit<Book, 'id' | 'created_at' | 'updated_at' | 'version'>>): Promise<Book> {
 		const response = await fetch(`${this.baseURL}/books/${id}`, {
 			method: 'PUT',
 			headers: this.getHeaders(true),
-			body: JSON.stringify(book),
+			body: JSON.stringify({ ...book, version }),
 		});
 
 		return this.handleResponse<Book>(response);